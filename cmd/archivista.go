@@ -0,0 +1,92 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/archivista"
+	"github.com/testifysec/witness/pkg/result"
+)
+
+func newArchivistaClient(archivistaURL string, o options.ArchivistaClientOptions) (*archivista.Client, error) {
+	opts := []archivista.Option{
+		archivista.WithConcurrency(o.Concurrency),
+		archivista.WithRateLimit(o.RateLimit),
+		archivista.WithMaxRetries(o.MaxRetries),
+		archivista.WithChunkSize(o.ChunkSize),
+	}
+
+	token := ""
+	if o.TokenFile != "" {
+		tokenBytes, err := os.ReadFile(o.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archivista token: %w", err)
+		}
+
+		token = strings.TrimSpace(string(tokenBytes))
+		// the token would be readable by anyone on the path to archivista, so it's only sent in the clear to this host
+		u, err := url.Parse(archivistaURL)
+		if err != nil {
+			return nil, result.Usage(fmt.Errorf("invalid archivista url %v: %w", archivistaURL, err))
+		}
+
+		if u.Scheme != "https" && !loopbackHost(u.Hostname()) {
+			return nil, result.Usage(fmt.Errorf("refusing to send the archivista token to %v without tls, use an https url", archivistaURL))
+		}
+
+		opts = append(opts, archivista.WithToken(token))
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.CAPath != "" {
+		caBytes, err := os.ReadFile(o.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archivista ca: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("no certificates found in archivista ca %v", o.CAPath)
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		transport.MaxIdleConnsPerHost = o.Concurrency
+		opts = append(opts, archivista.WithHTTPClient(&http.Client{Transport: transport}))
+	}
+
+	if o.GRPCTarget != "" {
+		if o.GRPCInsecure {
+			tlsConfig = nil
+		}
+
+		conn, err := archivista.DialGRPC(o.GRPCTarget, tlsConfig, token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to archivista grpc api: %w", err)
+		}
+
+		opts = append(opts, archivista.WithGRPCConn(conn))
+	}
+
+	return archivista.New(archivistaURL, opts...), nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/result"
+)
+
+func TestNewArchivistaClientToken(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0600))
+	o := options.ArchivistaClientOptions{TokenFile: tokenFile}
+
+	for _, url := range []string{"https://archivista.example.com", "http://localhost:8082", "http://127.0.0.1:8082", "http://[::1]:8082"} {
+		client, err := newArchivistaClient(url, o)
+		require.NoError(t, err, url)
+		require.NoError(t, client.Close())
+	}
+
+	_, err := newArchivistaClient("http://archivista.example.com", o)
+	require.ErrorContains(t, err, "without tls")
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+
+	client, err := newArchivistaClient("http://archivista.example.com", options.ArchivistaClientOptions{})
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+}
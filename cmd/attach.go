@@ -0,0 +1,107 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/oci"
+)
+
+func AttachCmd() *cobra.Command {
+	o := options.AttachOptions{}
+	cmd := &cobra.Command{
+		Use:   "attach",
+		Short: "Attaches signed attestations to an image",
+		Long: "Attaches signed attestations to an image in an OCI image layout as referrer artifacts, so the attestations " +
+			"are copied along with the image and can be found by witness verify --image.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAttach(o, cmd.OutOrStdout())
+		},
+	}
+
+	o.AddFlags(cmd)
+	return cmd
+}
+
+func runAttach(o options.AttachOptions, out io.Writer) error {
+	if o.Image == "" {
+		return errors.New("an image is required")
+	}
+
+	if len(o.AttestationFilePaths) == 0 {
+		return errors.New("at least one attestation file is required")
+	}
+
+	// parse the envelopes first so nothing is attached if any of them is invalid
+	envelopes, err := loadEnvelopes(o.AttestationFilePaths, "attestation")
+	if err != nil {
+		return err
+	}
+
+	layout, image, err := openImage(o.Image)
+	if err != nil {
+		return err
+	}
+
+	for i, path := range o.AttestationFilePaths {
+		if len(envelopes[i].Signatures) == 0 {
+			return fmt.Errorf("attestation %v is not signed", path)
+		}
+
+		// attestations given as sigstore bundles are attached as the envelopes they contain
+		envelopeBytes, err := json.Marshal(&envelopes[i])
+		if err != nil {
+			return fmt.Errorf("failed to encode attestation %v: %w", path, err)
+		}
+
+		desc, err := layout.Attach(image, envelopeBytes)
+		if err != nil {
+			return fmt.Errorf("failed to attach %v: %w", path, err)
+		}
+
+		fmt.Fprintf(out, "%v\t%v\n", path, desc.Digest)
+	}
+
+	return nil
+}
+
+// openImage opens the layout an image reference points into and resolves the image in it.
+func openImage(ref string) (*oci.Layout, oci.Descriptor, error) {
+	parsed, err := oci.ParseReference(ref)
+	if err != nil {
+		return nil, oci.Descriptor{}, err
+	}
+
+	layout, err := oci.Open(parsed.Path)
+	if err != nil {
+		return nil, oci.Descriptor{}, err
+	}
+
+	image, err := layout.Resolve(parsed)
+	if err != nil {
+		return nil, oci.Descriptor{}, err
+	}
+
+	return layout, image, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/options"
+)
+
+// runOnlyFlags are the flags of witness run that only apply to running a command.
+var runOnlyFlags = []string{"trace", "trace-degraded", "max-run-duration", "grace-period"}
+
+func AttestCmd() *cobra.Command {
+	o := options.RunOptions{
+		AttestorOptSetters: make(map[string][]func(attestation.Attestor) (attestation.Attestor, error)),
+	}
+
+	cmd := &cobra.Command{
+		Use:   "attest",
+		Short: "Records attestations about the current state of a directory without running a command",
+		Long: "Records and signs the same attestations as witness run, such as the material, product, git, and " +
+			"environment attestations, without running a command. Every file in the working directory is recorded as " +
+			"a product, so artifacts produced elsewhere can be attested after the fact.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAttest(cmd.Context(), o, cmd.OutOrStdout())
+		},
+		Args: cobra.NoArgs,
+	}
+
+	o.AddFlags(cmd)
+	for _, name := range runOnlyFlags {
+		if err := cmd.Flags().MarkHidden(name); err != nil {
+			log.Debugf("failed to hide %v flag: %v", name, err)
+		}
+	}
+
+	return cmd
+}
+
+func runAttest(ctx context.Context, ro options.RunOptions, out io.Writer) error {
+	ro.Existing = true
+	if ro.DryRun {
+		return runDryRun(ctx, ro, nil, out)
+	}
+
+	return runRun(ctx, ro, nil, nil)
+}
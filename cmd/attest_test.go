@@ -0,0 +1,62 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/attestation/product"
+)
+
+func TestRunAttest(t *testing.T) {
+	priv, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workingDir, "app.tar.gz"), []byte("built elsewhere"), 0644))
+	attestationPath := filepath.Join(t.TempDir(), "outfile.txt")
+	runOptions := options.RunOptions{
+		KeyOptions:   options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:   workingDir,
+		Attestations: []string{"environment"},
+		OutFilePath:  attestationPath,
+		StepName:     "package",
+	}
+
+	require.NoError(t, runAttest(context.Background(), runOptions, io.Discard))
+	attestationBytes, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(attestationBytes, &env))
+	require.NotContains(t, string(env.Payload), commandrun.Type)
+
+	statement := intoto.Statement{}
+	require.NoError(t, json.Unmarshal(env.Payload, &statement))
+	subjects := []string{}
+	for _, subject := range statement.Subject {
+		subjects = append(subjects, subject.Name)
+	}
+
+	require.Contains(t, subjects, product.Type+"/file:app.tar.gz")
+	require.Error(t, AttestCmd().Args(AttestCmd(), []string{"make"}))
+}
@@ -0,0 +1,34 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	// imported so their init functions run
+	_ "github.com/testifysec/witness/pkg/attestation/ancestry"
+	_ "github.com/testifysec/witness/pkg/attestation/archive"
+	_ "github.com/testifysec/witness/pkg/attestation/azuredevops"
+	_ "github.com/testifysec/witness/pkg/attestation/buildcache"
+	_ "github.com/testifysec/witness/pkg/attestation/circleci"
+	_ "github.com/testifysec/witness/pkg/attestation/codegen"
+	_ "github.com/testifysec/witness/pkg/attestation/firmware"
+	_ "github.com/testifysec/witness/pkg/attestation/gitlab"
+	_ "github.com/testifysec/witness/pkg/attestation/gobuild"
+	_ "github.com/testifysec/witness/pkg/attestation/jar"
+	_ "github.com/testifysec/witness/pkg/attestation/nix"
+	_ "github.com/testifysec/witness/pkg/attestation/publish"
+	_ "github.com/testifysec/witness/pkg/attestation/sbom"
+	_ "github.com/testifysec/witness/pkg/attestation/vuln"
+	_ "github.com/testifysec/witness/pkg/attestation/wasm"
+)
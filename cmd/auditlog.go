@@ -0,0 +1,150 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/signer/file"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/auditlog"
+	"github.com/testifysec/witness/pkg/result"
+)
+
+func AuditLogCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "audit-log",
+		Short:             "Checks audit logs of verification decisions",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(auditLogVerifyCmd())
+	return cmd
+}
+
+func auditLogVerifyCmd() *cobra.Command {
+	ao := options.AuditLogVerifyOptions{}
+	cmd := &cobra.Command{
+		Use:   "verify [file]",
+		Short: "Verifies that an audit log of verification decisions wasn't tampered with",
+		Long: "Checks that the records of an audit log written with --audit-log form an unbroken hash chain, so no record " +
+			"was edited, removed, or reordered, and with --publickey that each record is signed by a trusted key",
+		Args:              cobra.ExactArgs(1),
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAuditLogVerify(args[0], ao)
+		},
+	}
+
+	ao.AddFlags(cmd)
+	return cmd
+}
+
+func runAuditLogVerify(path string, ao options.AuditLogVerifyOptions) error {
+	verifiers := make([]cryptoutil.Verifier, 0, len(ao.KeyPaths))
+	for _, keyPath := range ao.KeyPaths {
+		f, err := os.Open(keyPath)
+		if err != nil {
+			return result.Usage(fmt.Errorf("failed to open key file: %w", err))
+		}
+
+		verifier, err := cryptoutil.NewVerifierFromReader(f)
+		f.Close()
+		if err != nil {
+			return result.Usage(fmt.Errorf("failed to create verifier from %v: %w", keyPath, err))
+		}
+
+		verifiers = append(verifiers, verifier)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return result.Storage(fmt.Errorf("failed to open audit log: %w", err))
+	}
+
+	defer f.Close()
+	records, err := auditlog.Verify(f, verifiers...)
+	if err != nil {
+		return result.Policy(fmt.Errorf("audit log failed to verify after %v records: %w", len(records), err))
+	}
+
+	dropped := uint64(0)
+	for _, r := range records {
+		dropped += r.Dropped
+	}
+
+	log.Infof("Verified %v audit log records", len(records))
+	if dropped > 0 {
+		log.Warnf("%v decisions were dropped by the audit log rate limit", dropped)
+	}
+
+	return nil
+}
+
+// openAuditLog opens the audit log ao configures, which is nil if there is none.
+func openAuditLog(ctx context.Context, ao options.AuditLogOptions, extraOpts ...auditlog.Option) (*auditlog.Log, error) {
+	opts := append([]auditlog.Option{auditlog.WithRateLimit(ao.Rate, ao.Burst)}, extraOpts...)
+	if ao.SigningKeyPath != "" {
+		if ao.Target == "" {
+			return nil, result.Usage(fmt.Errorf("--audit-log-signing-key requires --audit-log"))
+		}
+
+		signer, err := file.Signer(ctx, ao.SigningKeyPath, "", nil)
+		if err != nil {
+			return nil, result.Usage(fmt.Errorf("failed to load audit log signing key: %w", err))
+		}
+
+		opts = append(opts, auditlog.WithSigner(signer))
+	}
+
+	l, err := auditlog.Open(ao.Target, opts...)
+	if err != nil {
+		return nil, result.Storage(err)
+	}
+
+	return l, nil
+}
+
+// newDecision describes the outcome err of verifying subjects against the policy with digest policyDigest.
+func newDecision(source string, subjects []cryptoutil.DigestSet, policyDigest string, err error) auditlog.Decision {
+	d := auditlog.Decision{Source: source, PolicyDigest: policyDigest, Result: auditlog.ResultAllowed}
+	for _, subject := range subjects {
+		names, nameErr := subject.ToNameMap()
+		if nameErr != nil {
+			continue
+		}
+
+		for name, digest := range names {
+			d.Subjects = append(d.Subjects, fmt.Sprintf("%v:%v", name, digest))
+		}
+	}
+
+	sort.Strings(d.Subjects)
+	if err != nil {
+		d.Result = auditlog.ResultDenied
+		d.Category = string(result.CategoryOf(err))
+		d.Reasons = []string{err.Error()}
+	}
+
+	return d
+}
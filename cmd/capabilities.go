@@ -0,0 +1,56 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/attestation/capabilities"
+)
+
+func CapabilitiesCmd() *cobra.Command {
+	o := options.CapabilitiesOptions{}
+	cmd := &cobra.Command{
+		Use:   "capabilities",
+		Short: "Reports the attestors and tracing features available on this host",
+		Long: "Reports which attestors are built in and which tracing features are available on the current OS, architecture, " +
+			"and privilege level, along with what keeps unavailable features from working. witness run records the same " +
+			"snapshot in a capabilities attestation with every step",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCapabilities(o, cmd.OutOrStdout())
+		},
+	}
+
+	o.AddFlags(cmd)
+	return cmd
+}
+
+func runCapabilities(o options.CapabilitiesOptions, out io.Writer) error {
+	snapshot := capabilities.Detect(detectTracing())
+	if !o.JSON {
+		_, err := io.WriteString(out, capabilities.Format(snapshot))
+		return err
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(snapshot)
+}
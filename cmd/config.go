@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -57,6 +58,10 @@ func initConfig(rootCmd *cobra.Command, rootOptions *options.RootOptions) error
 		flags := cm.Flags()
 		flags.VisitAll(func(f *pflag.Flag) {
 			configKey := fmt.Sprintf("%s.%s", cm.Name(), f.Name)
+			if !v.IsSet(configKey) {
+				configKey = fallbackConfigKey(v, cm, f.Name, configKey)
+			}
+
 			if !f.Changed {
 				if f.Value.Type() == "stringSlice" {
 					configValue := v.GetStringSlice(configKey)
@@ -82,6 +87,26 @@ func initConfig(rootCmd *cobra.Command, rootOptions *options.RootOptions) error
 	return nil
 }
 
+// configFallbackAnnotation lists, separated by commas, the config sections a command reads flags from when its own
+// section doesn't set them.
+const configFallbackAnnotation = "witness.config.fallback"
+
+func fallbackConfigKey(v *viper.Viper, cm *cobra.Command, flagName, configKey string) string {
+	fallbacks, ok := cm.Annotations[configFallbackAnnotation]
+	if !ok {
+		return configKey
+	}
+
+	for _, section := range strings.Split(fallbacks, ",") {
+		fallbackKey := fmt.Sprintf("%s.%s", section, flagName)
+		if v.IsSet(fallbackKey) {
+			return fallbackKey
+		}
+	}
+
+	return configKey
+}
+
 func contains(s []string, str string) bool {
 	for _, v := range s {
 		if v == str {
@@ -0,0 +1,121 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/timestamp"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/statement"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+func CountersignCmd() *cobra.Command {
+	o := options.CountersignOptions{}
+	cmd := &cobra.Command{
+		Use:   "countersign",
+		Short: "Adds a signature to a signed envelope",
+		Long: "Verifies a signed envelope against trusted keys or CA certificates and adds a signature from the configured signers, " +
+			"keeping the payload and the signatures it already has, so a reviewer such as a security team can endorse an attestation " +
+			"after the fact. Policies can then require the countersigner as a functionary of the step.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCountersign(cmd.Context(), o)
+		},
+		Args: cobra.NoArgs,
+	}
+
+	o.AddFlags(cmd)
+	return cmd
+}
+
+func runCountersign(ctx context.Context, o options.CountersignOptions) error {
+	if o.InFilePath == "" {
+		return result.Usage(errors.New("an envelope to countersign is required, provide --infile"))
+	}
+
+	if len(o.TrustKeyPaths) == 0 && len(o.TrustCAPaths) == 0 {
+		return result.Usage(errors.New("the envelope is verified before it is countersigned, provide --verify-key or --verify-ca"))
+	}
+
+	if err := checkOutputFormat(o.OutputFormat); err != nil {
+		return err
+	}
+
+	if o.OutputFormat == bundle.FormatSigstoreBundle {
+		return result.Usage(fmt.Errorf("countersigned envelopes can't be written as %v, which carry exactly one signature", bundle.FormatSigstoreBundle))
+	}
+
+	trust, err := loadSubjectTrust(options.VerifySubjectOptions{
+		KeyPaths:         o.TrustKeyPaths,
+		CAPaths:          o.TrustCAPaths,
+		TimestampCAPaths: o.TimestampCAPaths,
+		ClockSkew:        o.ClockSkew,
+	})
+	if err != nil {
+		return err
+	}
+
+	envelopes, err := loadEnvelopes([]string{o.InFilePath}, "envelope")
+	if err != nil {
+		return err
+	}
+
+	env := envelopes[0]
+	verifiedBy, err := verify.VerifyEnvelope(ctx, env, trust)
+	if err != nil {
+		return result.Policy(fmt.Errorf("envelope %v: %w", o.InFilePath, err))
+	}
+
+	signers, err := loadAllSigners(ctx, o.KeyOptions)
+	if err != nil {
+		return err
+	}
+
+	timestampers := []dsse.Timestamper{}
+	for _, url := range o.TimestampServers {
+		timestampers = append(timestampers, timestamp.NewTimestamper(timestamp.TimestampWithUrl(url)))
+	}
+
+	countersigned, err := statement.Countersign(env, signers, timestampers...)
+	if err != nil {
+		return result.Signer(fmt.Errorf("failed to countersign envelope: %w", err))
+	}
+
+	// the envelope is read before the out file is opened, so it can be countersigned in place
+	out, err := loadOutfile(o.OutFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open out file: %w", err)
+	}
+
+	defer out.Close()
+	if err := writeSigned(countersigned, out, o.OutputFormat, ""); err != nil {
+		return err
+	}
+
+	log.Infof("Countersigned envelope signed by %v, it now has %v signatures", strings.Join(verifiedBy, ", "), len(countersigned.Signatures))
+	return nil
+}
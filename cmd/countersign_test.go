@@ -0,0 +1,92 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+func TestRunCountersign(t *testing.T) {
+	buildPriv, buildPub := rsakeypair(t)
+	reviewPriv, reviewPub := rsakeypair(t)
+	attestationPath := filepath.Join(t.TempDir(), "build.json")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:  options.KeyOptions{KeyPath: buildPriv.Name()},
+		WorkingDir:  t.TempDir(),
+		OutFilePath: attestationPath,
+		StepName:    "build",
+	}, []string{"bash", "-c", "echo 'built' > app.bin"}, nil))
+
+	o := options.CountersignOptions{
+		KeyOptions:    options.KeyOptions{KeyPath: reviewPriv.Name()},
+		InFilePath:    attestationPath,
+		OutFilePath:   attestationPath,
+		OutputFormat:  bundle.FormatDSSECBOR,
+		TrustKeyPaths: []string{buildPub.Name()},
+	}
+
+	original, err := loadEnvelopes([]string{attestationPath}, "envelope")
+	require.NoError(t, err)
+	require.NoError(t, runCountersign(context.Background(), o))
+	countersigned, err := loadEnvelopes([]string{attestationPath}, "envelope")
+	require.NoError(t, err)
+	require.Equal(t, original[0].Payload, countersigned[0].Payload)
+	require.Len(t, countersigned[0].Signatures, 2)
+	require.Equal(t, original[0].Signatures[0], countersigned[0].Signatures[0])
+
+	verifiers := []cryptoutil.Verifier{}
+	for _, pub := range []*os.File{buildPub, reviewPub} {
+		pubBytes, err := os.ReadFile(pub.Name())
+		require.NoError(t, err)
+		verifier, err := verify.NewVerifierFromBytes(pubBytes)
+		require.NoError(t, err)
+		verifiers = append(verifiers, verifier)
+	}
+
+	_, err = countersigned[0].Verify(dsse.VerifyWithVerifiers(verifiers...), dsse.VerifyWithThreshold(2))
+	require.NoError(t, err)
+
+	// the reviewer has already signed
+	require.Equal(t, result.CategorySigner, result.CategoryOf(runCountersign(context.Background(), o)))
+
+	o.TrustKeyPaths = []string{reviewPub.Name()}
+	o.KeyOptions.KeyPath = buildPriv.Name()
+	o.InFilePath = filepath.Join(t.TempDir(), "untrusted.json")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:  options.KeyOptions{KeyPath: buildPriv.Name()},
+		WorkingDir:  t.TempDir(),
+		OutFilePath: o.InFilePath,
+		StepName:    "build",
+	}, []string{"true"}, nil))
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(runCountersign(context.Background(), o)))
+
+	o.TrustKeyPaths = nil
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(runCountersign(context.Background(), o)))
+
+	o.TrustKeyPaths = []string{buildPub.Name()}
+	o.OutputFormat = bundle.FormatSigstoreBundle
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(runCountersign(context.Background(), o)))
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+func CoverageCmd() *cobra.Command {
+	co := options.CoverageOptions{}
+	cmd := &cobra.Command{
+		Use:   "coverage",
+		Short: "Reports which steps of a policy have evidence",
+		Long: "Searches the attestation files, store, and Archivista it is given for the evidence of each step of a policy " +
+			"and reports which steps have evidence signed by their functionaries and which required attestations are " +
+			"still missing or denied by the policy's rego. Unlike witness verify it succeeds whether or not the evidence " +
+			"satisfies the policy, which helps while a pipeline is instrumented a step at a time. Each step is judged on " +
+			"its own, so complete coverage doesn't guarantee witness verify passes.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		Annotations:       map[string]string{configFallbackAnnotation: "verify"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCoverage(cmd.Context(), co, cmd.OutOrStdout())
+		},
+	}
+
+	co.AddFlags(cmd)
+	return cmd
+}
+
+func runCoverage(ctx context.Context, co options.CoverageOptions, out io.Writer) error {
+	vo := co.VerifyOptions
+	vo.AdditionalSubjects = append(append([]string{}, vo.AdditionalSubjects...), co.Subjects...)
+	vo.ArchivistaOptions.Enable = vo.ArchivistaOptions.Enable || co.FromArchivista
+	inputs, err := loadVerifyInputs(ctx, vo)
+	if err != nil {
+		return err
+	}
+
+	defer inputs.close()
+	report, err := verify.Coverage(
+		ctx,
+		inputs.policyEnvelope,
+		inputs.verifiers,
+		verify.WithSubjectDigests(inputs.subjects),
+		verify.WithCollectionSource(inputs.collectionSource),
+		verify.WithClockSkew(vo.ClockSkew),
+		verify.WithEnvironment(vo.Environment),
+		verify.WithRevocations(inputs.revocations),
+		verify.WithStoredEnvelopes(inputs.storedEnvelopes),
+		verify.WithSubPolicies(inputs.subPolicies),
+		verify.WithStatementVersions(vo.StatementVersions...),
+		verify.WithStrictStatements(vo.StrictInToto),
+	)
+	if err != nil {
+		return result.Policy(fmt.Errorf("failed to report coverage: %w", err))
+	}
+
+	if !co.JSON {
+		_, err := io.WriteString(out, verify.FormatCoverage(report))
+		return err
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+func TestRunCoverage(t *testing.T) {
+	policy, funcPriv := makepolicyRSAPub(t)
+	signedPolicy, pub := signPolicyRSA(t, policy)
+	workingDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(workingDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	// only the first step of the pipeline is instrumented so far
+	attestationPath := filepath.Join(t.TempDir(), "step01.json")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:  options.KeyOptions{KeyPath: funcPrivFilepath},
+		WorkingDir:  workingDir,
+		OutFilePath: attestationPath,
+		StepName:    "step01",
+	}, []string{"bash", "-c", "echo 'test01' > test.txt"}, nil))
+
+	artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(filepath.Join(workingDir, "test.txt"), []crypto.Hash{crypto.SHA256})
+	require.NoError(t, err)
+	subjects := []string{}
+	for _, digest := range artifactDigest {
+		subjects = append(subjects, digest)
+	}
+
+	co := options.CoverageOptions{
+		VerifyOptions: options.VerifyOptions{
+			KeyPath:              policyPubFilePath,
+			PolicyFilePath:       policyFilePath,
+			AttestationFilePaths: []string{attestationPath},
+		},
+		Subjects: subjects,
+		JSON:     true,
+	}
+
+	out := &bytes.Buffer{}
+	require.NoError(t, runCoverage(context.Background(), co, out))
+	report := verify.CoverageReport{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	require.Len(t, report.Steps, 2)
+	require.Equal(t, "step01", report.Steps[0].Step)
+	require.Equal(t, []string{attestationPath}, report.Steps[0].Evidence)
+	require.Equal(t, "step02", report.Steps[1].Step)
+	require.False(t, report.Steps[1].Covered())
+	require.Equal(t, []string{commandrun.Type}, report.Steps[1].Missing)
+
+	out.Reset()
+	co.JSON = false
+	require.NoError(t, runCoverage(context.Background(), co, out))
+	require.Contains(t, out.String(), "[covered] step01")
+	require.Contains(t, out.String(), "[missing] step02")
+	require.Contains(t, out.String(), "1 of 2 steps have evidence")
+
+	// the evidence doesn't satisfy the policy, which verify still rejects
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(runVerify(context.Background(), options.VerifyOptions{
+		KeyPath:              policyPubFilePath,
+		PolicyFilePath:       policyFilePath,
+		AttestationFilePaths: []string{attestationPath},
+		AdditionalSubjects:   subjects,
+	})))
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/attestation/deployment"
+	"github.com/testifysec/witness/pkg/result"
+)
+
+func DeployCmd() *cobra.Command {
+	do := options.DeployOptions{}
+	cmd := &cobra.Command{
+		Use:   "deploy",
+		Short: "Verifies an artifact for an environment and attests to its deployment",
+		Long: "Verifies the evidence of an artifact against the steps of a policy that apply to the environment it is " +
+			"deployed to, then records and signs a deployment attestation with the environment, cluster, and namespace " +
+			"the artifact is deployed to, when it was deployed, the deployer's identity, and the evidence that was verified.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDeploy(cmd.Context(), do)
+		},
+	}
+
+	do.AddFlags(cmd)
+	return cmd
+}
+
+func runDeploy(ctx context.Context, do options.DeployOptions) error {
+	if do.VerifyOptions.Environment == "" {
+		return result.Usage(errors.New("the environment the artifact is deployed to is required, provide --environment"))
+	}
+
+	return recordVerifiedStep(ctx, verifiedStep{
+		kind:              "deployment",
+		verifyOptions:     do.VerifyOptions,
+		keyOptions:        do.KeyOptions,
+		stepName:          do.StepName,
+		outFilePath:       do.OutFilePath,
+		outputFormat:      do.OutputFormat,
+		bundleOutFilePath: do.BundleOutFilePath,
+		timestampServers:  do.TimestampServers,
+		attestor: func(signer cryptoutil.Signer, inputs verifyInputs, verified map[string][]source.VerifiedCollection) attestation.Attestor {
+			return deployment.New(
+				deployment.WithEnvironment(do.VerifyOptions.Environment),
+				deployment.WithCluster(do.Cluster),
+				deployment.WithNamespace(do.Namespace),
+				deployment.WithSigner(signer),
+				deployment.WithArtifacts(inputs.subjects),
+				deployment.WithVerification(inputs.policyEnvelope, verified),
+			)
+		},
+	})
+}
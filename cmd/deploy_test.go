@@ -0,0 +1,132 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/attestation/deployment"
+	"github.com/testifysec/witness/pkg/result"
+)
+
+func TestRunDeploy(t *testing.T) {
+	p, funcPriv := makepolicyRSAPub(t)
+	policyFields := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(p, &policyFields))
+	policyFields["environments"] = []string{"staging", "production"}
+	steps := policyFields["steps"].(map[string]interface{})
+	approve := map[string]interface{}{}
+	for key, value := range steps["step01"].(map[string]interface{}) {
+		approve[key] = value
+	}
+
+	// production requires an approval that staging doesn't
+	approve["name"] = "approve"
+	approve["environments"] = []string{"production"}
+	steps["approve"] = approve
+	p, err := json.Marshal(policyFields)
+	require.NoError(t, err)
+
+	signedPolicy, pub := signPolicyRSA(t, p)
+	workingDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(workingDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	subjects := []string{}
+	runStep := func(step, command, product string) string {
+		attestationPath := filepath.Join(t.TempDir(), step+".json")
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:   options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:   workingDir,
+			Attestations: []string{},
+			OutFilePath:  attestationPath,
+			StepName:     step,
+		}, []string{"bash", "-c", command}, nil))
+
+		productDigest, err := cryptoutil.CalculateDigestSetFromFile(filepath.Join(workingDir, product), []crypto.Hash{crypto.SHA256})
+		require.NoError(t, err)
+		for _, digest := range productDigest {
+			subjects = append(subjects, digest)
+		}
+
+		return attestationPath
+	}
+
+	attestationPaths := []string{
+		runStep("step01", "echo 'test01' > test.txt", "test.txt"),
+		runStep("step02", "echo 'test02' >> test.txt", "test.txt"),
+	}
+
+	deploymentPath := filepath.Join(t.TempDir(), "deployment.json")
+	do := options.DeployOptions{
+		VerifyOptions: options.VerifyOptions{
+			KeyPath:              policyPubFilePath,
+			PolicyFilePath:       policyFilePath,
+			AttestationFilePaths: attestationPaths,
+			AdditionalSubjects:   subjects,
+			Environment:          "staging",
+		},
+		KeyOptions:  options.KeyOptions{KeyPath: funcPrivFilepath},
+		Cluster:     "staging-us-east-1",
+		Namespace:   "app",
+		StepName:    "deploy",
+		OutFilePath: deploymentPath,
+	}
+
+	require.NoError(t, runDeploy(context.Background(), do))
+	envBytes, err := os.ReadFile(deploymentPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(envBytes, &env))
+	require.Contains(t, string(env.Payload), deployment.Type)
+	require.Contains(t, string(env.Payload), "staging-us-east-1")
+
+	// nothing is deployed to production without the approval
+	do.VerifyOptions.Environment = "production"
+	err = runDeploy(context.Background(), do)
+	require.Error(t, err)
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(err))
+
+	// verifying without an environment requires every step too
+	require.Error(t, runVerify(context.Background(), options.VerifyOptions{
+		KeyPath:              policyPubFilePath,
+		PolicyFilePath:       policyFilePath,
+		AttestationFilePaths: attestationPaths,
+		AdditionalSubjects:   subjects,
+	}))
+
+	do.VerifyOptions.AttestationFilePaths = append(attestationPaths, runStep("approve", "echo 'approved' > approval.txt", "approval.txt"))
+	do.VerifyOptions.AdditionalSubjects = subjects
+	require.NoError(t, runDeploy(context.Background(), do))
+
+	do.VerifyOptions.Environment = "prod"
+	require.Error(t, runDeploy(context.Background(), do))
+
+	do.VerifyOptions.Environment = ""
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(runDeploy(context.Background(), do)))
+}
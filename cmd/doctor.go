@@ -0,0 +1,135 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/doctor"
+)
+
+func DoctorCmd() *cobra.Command {
+	o := options.DoctorOptions{}
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Checks signers, policies, and services for problems",
+		Long: "Inspects the configured signers, policies, and trust roots and warns about certificates or policies that expire soon, " +
+			"timestamp authorities or Archivista that can't be reached, and hosts that can't trace commands. " +
+			"Values missing from the doctor section of the config file are read from the run and verify sections.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		Annotations:       map[string]string{configFallbackAnnotation: "run,verify"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDoctor(cmd.Context(), o, cmd.OutOrStdout())
+		},
+	}
+
+	o.AddFlags(cmd)
+	return cmd
+}
+
+func runDoctor(ctx context.Context, o options.DoctorOptions, out io.Writer) error {
+	now := time.Now()
+	results := []doctor.Result{}
+	signers, errs := loadSigners(ctx, o.KeyOptions)
+	for _, err := range errs {
+		results = append(results, doctor.Result{Check: "signer", Status: doctor.StatusError, Message: err.Error()})
+	}
+
+	for _, signer := range signers {
+		results = append(results, checkSigner(signer, now, o.WarnWithin)...)
+	}
+
+	if o.PolicyFilePath != "" {
+		policyEnvelope := dsse.Envelope{}
+		policyBytes, err := os.ReadFile(o.PolicyFilePath)
+		if err == nil {
+			policyEnvelope, err = bundle.Decode(policyBytes)
+		}
+
+		if err != nil {
+			results = append(results, doctor.Result{Check: "policy", Status: doctor.StatusError, Message: fmt.Sprintf("failed to load %v: %v", o.PolicyFilePath, err)})
+		} else {
+			results = append(results, doctor.CheckPolicy(policyEnvelope, now, o.WarnWithin)...)
+		}
+	}
+
+	for _, caPath := range o.CAPaths {
+		caBytes, err := os.ReadFile(caPath)
+		if err != nil {
+			results = append(results, doctor.Result{Check: "policy ca", Status: doctor.StatusError, Message: fmt.Sprintf("failed to read %v: %v", caPath, err)})
+			continue
+		}
+
+		ca, err := cryptoutil.TryParseCertificate(caBytes)
+		if err != nil {
+			results = append(results, doctor.Result{Check: "policy ca", Status: doctor.StatusError, Message: fmt.Sprintf("failed to parse %v: %v", caPath, err)})
+			continue
+		}
+
+		results = append(results, doctor.CheckCertificate("policy ca", ca, now, o.WarnWithin))
+	}
+
+	hc := &http.Client{Timeout: o.Timeout}
+	for _, url := range o.TimestampServers {
+		results = append(results, doctor.CheckReachable(ctx, hc, "timestamp authority", url))
+	}
+
+	if o.ArchivistaOptions.Enable {
+		results = append(results, doctor.CheckReachable(ctx, hc, "archivista", o.ArchivistaOptions.Url))
+	}
+
+	results = append(results, doctor.CheckTracing())
+	if _, err := io.WriteString(out, doctor.Format(results)); err != nil {
+		return err
+	}
+
+	if doctor.Worst(results) == doctor.StatusError {
+		return fmt.Errorf("doctor found problems")
+	}
+
+	return nil
+}
+
+func checkSigner(signer cryptoutil.Signer, now time.Time, warnWithin time.Duration) []doctor.Result {
+	keyID, err := signer.KeyID()
+	if err != nil {
+		return []doctor.Result{{Check: "signer", Status: doctor.StatusError, Message: fmt.Sprintf("failed to get key id: %v", err)}}
+	}
+
+	check := fmt.Sprintf("signer %v", keyID)
+	bundler, ok := signer.(cryptoutil.TrustBundler)
+	if !ok || bundler.Certificate() == nil {
+		return []doctor.Result{{Check: check, Status: doctor.StatusOK, Message: "signs with a key without a certificate"}}
+	}
+
+	results := []doctor.Result{doctor.CheckCertificate(check+" certificate", bundler.Certificate(), now, warnWithin)}
+	for _, intermediate := range bundler.Intermediates() {
+		results = append(results, doctor.CheckCertificate(check+" intermediate", intermediate, now, warnWithin))
+	}
+
+	return results
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/witness/options"
+)
+
+func TestRunDoctor(t *testing.T) {
+	ca, intermediates, leafcert, leafkey := fullChain(t)
+	caBytes, err := os.ReadFile(ca.Name())
+	require.NoError(t, err)
+	signedPolicy, _ := signPolicyRSA(t, makepolicyCA(t, caBytes))
+	policyPath := filepath.Join(t.TempDir(), "policy.signed.json")
+	require.NoError(t, os.WriteFile(policyPath, signedPolicy, 0644))
+
+	tsa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer tsa.Close()
+
+	o := options.DoctorOptions{
+		KeyOptions: options.KeyOptions{
+			KeyPath:           leafkey.Name(),
+			CertPath:          leafcert.Name(),
+			IntermediatePaths: []string{intermediates[0].Name()},
+		},
+		PolicyFilePath:   policyPath,
+		TimestampServers: []string{tsa.URL},
+		WarnWithin:       30 * 24 * time.Hour,
+		Timeout:          time.Second,
+	}
+
+	out := &bytes.Buffer{}
+	require.NoError(t, runDoctor(context.Background(), o, out))
+	report := out.String()
+	require.Contains(t, report, `[OK   ] signer`)
+	require.Contains(t, report, `certificate "CN=Witness Testing Leaf,O=Witness Testing": valid until`)
+	// the test policy expires in an hour
+	require.Contains(t, report, "[WARN ] policy: expires in 1h0m0s")
+	require.Contains(t, report, `[OK   ] policy root "CN=Witness Testing CA,O=Witness Testing"`)
+	require.Contains(t, report, "[OK   ] timestamp authority "+tsa.URL)
+
+	tsa.Close()
+	out.Reset()
+	require.ErrorContains(t, runDoctor(context.Background(), o, out), "doctor found problems")
+	require.True(t, strings.Contains(out.String(), "[ERROR] timestamp authority "+tsa.URL+": unreachable"), out.String())
+}
+
+func TestFallbackConfigKey(t *testing.T) {
+	v := viper.New()
+	v.Set("run.key", "run.pem")
+	v.Set("verify.policy", "policy.json")
+	cmd := DoctorCmd()
+	require.Equal(t, "run.key", fallbackConfigKey(v, cmd, "key", "doctor.key"))
+	require.Equal(t, "verify.policy", fallbackConfigKey(v, cmd, "policy", "doctor.policy"))
+	require.Equal(t, "doctor.warn-within", fallbackConfigKey(v, cmd, "warn-within", "doctor.warn-within"))
+	require.Equal(t, "sign.key", fallbackConfigKey(v, SignCmd(), "key", "sign.key"))
+}
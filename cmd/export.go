@@ -0,0 +1,168 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/audit"
+	"github.com/testifysec/witness/pkg/oscal"
+	"github.com/testifysec/witness/pkg/result"
+)
+
+func ExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "export",
+		Short:             "Exports evidence collected by witness",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(exportAuditCmd())
+	cmd.AddCommand(exportOSCALCmd())
+	return cmd
+}
+
+func exportAuditCmd() *cobra.Command {
+	eo := options.ExportAuditOptions{}
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Exports an audit package of the evidence for a subject",
+		Long: "Verifies a policy against the provided subjects and writes an audit package containing an HTML summary, " +
+			"normalized JSON evidence, a verification report, and a manifest of file digests. A package is written even if verification fails, " +
+			"but the command exits with a non-zero code",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExportAudit(cmd.Context(), eo)
+		},
+	}
+
+	eo.AddFlags(cmd)
+	return cmd
+}
+
+func runExportAudit(ctx context.Context, eo options.ExportAuditOptions) error {
+	if eo.OutputDir == "" {
+		return result.Usage(errors.New("an output directory is required"))
+	}
+
+	inputs, err := loadVerifyInputs(ctx, eo.VerifyOptions)
+	if err != nil {
+		return err
+	}
+
+	defer inputs.close()
+	generatedAt := time.Now().UTC()
+	serial := eo.Serial
+	if serial == "" {
+		serial = generatedAt.Format("20060102T150405Z")
+	}
+
+	verifiedEvidence, verifyErr := inputs.verify(ctx, eo.VerifyOptions)
+	pkg, err := audit.New(serial, inputs.policyEnvelope, inputs.subjects, verifiedEvidence, verifyErr, audit.WithGeneratedAt(generatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to build audit package: %w", err)
+	}
+
+	if err := pkg.Write(eo.OutputDir, eo.MaxSize); err != nil {
+		return fmt.Errorf("failed to write audit package: %w", err)
+	}
+
+	log.Infof("Audit package %v written to %v", serial, eo.OutputDir)
+	if verifyErr != nil {
+		return result.Policy(fmt.Errorf("failed to verify policy: %w", verifyErr))
+	}
+
+	return nil
+}
+
+func exportOSCALCmd() *cobra.Command {
+	eo := options.ExportOSCALOptions{}
+	cmd := &cobra.Command{
+		Use:   "oscal",
+		Short: "Exports verification results as OSCAL assessment results",
+		Long: "Verifies a policy against the provided subjects and writes the results as an OSCAL assessment results document. " +
+			"Each verified collection is recorded as an observation with its signed envelope attached, and each control mapped with --control " +
+			"is recorded as a finding. The document is written even if verification fails, but the command exits with a non-zero code",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExportOSCAL(cmd.Context(), eo)
+		},
+	}
+
+	eo.AddFlags(cmd)
+	return cmd
+}
+
+func runExportOSCAL(ctx context.Context, eo options.ExportOSCALOptions) error {
+	controls, err := oscal.ParseControls(eo.Controls)
+	if err != nil {
+		return err
+	}
+
+	inputs, err := loadVerifyInputs(ctx, eo.VerifyOptions)
+	if err != nil {
+		return err
+	}
+
+	defer inputs.close()
+	generatedAt := time.Now().UTC()
+	serial := eo.Serial
+	if serial == "" {
+		serial = generatedAt.Format("20060102T150405Z")
+	}
+
+	verifiedEvidence, verifyErr := inputs.verify(ctx, eo.VerifyOptions)
+	pkg, err := audit.New(serial, inputs.policyEnvelope, inputs.subjects, verifiedEvidence, verifyErr, audit.WithGeneratedAt(generatedAt))
+	if err != nil {
+		return fmt.Errorf("failed to normalize evidence: %w", err)
+	}
+
+	doc, err := oscal.New(pkg, oscal.WithControls(controls), oscal.WithAttestationTypes(eo.AttestationTypes))
+	if err != nil {
+		return fmt.Errorf("failed to build assessment results: %w", err)
+	}
+
+	docBytes, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	out, err := loadOutfile(eo.OutFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open out file: %w", err)
+	}
+
+	defer out.Close()
+	if _, err := out.Write(append(docBytes, '\n')); err != nil {
+		return fmt.Errorf("failed to write assessment results: %w", err)
+	}
+
+	if verifyErr != nil {
+		return result.Policy(fmt.Errorf("failed to verify policy: %w", verifyErr))
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/groups"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+func GroupsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "groups",
+		Short:             "Resolves the functionary groups of policies",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(groupsResolveCmd())
+	return cmd
+}
+
+func groupsResolveCmd() *cobra.Command {
+	gro := options.GroupsResolveOptions{}
+	cmd := &cobra.Command{
+		Use:   "resolve",
+		Short: "Resolves and signs the members of functionary groups",
+		Long: "Resolves the members of functionary groups from an identity provider and signs the snapshot, which " +
+			"witness verify accepts with --groups-snapshot when it can't reach the identity provider itself. The " +
+			"snapshot must be signed by the policy signer or one of the policy's group signers.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGroupsResolve(cmd.Context(), gro)
+		},
+	}
+
+	gro.AddFlags(cmd)
+	return cmd
+}
+
+func runGroupsResolve(ctx context.Context, gro options.GroupsResolveOptions) error {
+	resolver, err := newGroupsResolver(gro.SCIM, gro.LDAP)
+	if err != nil {
+		return err
+	}
+
+	if resolver == nil {
+		return result.Usage(errors.New("an identity provider is required, provide --groups-scim-url or --groups-ldap-url"))
+	}
+
+	names := append([]string{}, gro.Groups...)
+	if gro.PolicyFilePath != "" {
+		policyJSON, err := readPolicyPayload(gro.PolicyFilePath)
+		if err != nil {
+			return result.Policy(err)
+		}
+
+		referenced, err := verify.ReferencedGroups(policyJSON)
+		if err != nil {
+			return result.Policy(err)
+		}
+
+		names = append(names, referenced...)
+	}
+
+	if len(names) == 0 {
+		return result.Usage(errors.New("no groups to resolve, provide --group or a policy that names groups"))
+	}
+
+	signer, err := loadSigner(ctx, gro.KeyOptions)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := resolver.Resolve(ctx, names)
+	if err != nil {
+		return result.Storage(fmt.Errorf("failed to resolve groups from %v: %w", resolver.Source(), err))
+	}
+
+	payload, err := json.Marshal(&snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal group snapshot: %w", err)
+	}
+
+	env, err := dsse.Sign(groups.SnapshotType, bytes.NewReader(payload), dsse.SignWithSigners(signer))
+	if err != nil {
+		return result.Signer(fmt.Errorf("failed to sign group snapshot: %w", err))
+	}
+
+	out, err := loadOutfile(gro.OutFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open out file: %w", err)
+	}
+
+	defer out.Close()
+	if err := json.NewEncoder(out).Encode(&env); err != nil {
+		return fmt.Errorf("failed to write group snapshot: %w", err)
+	}
+
+	for name, members := range snapshot.Groups {
+		log.Infof("Group %v has %v members", name, len(members))
+	}
+
+	return nil
+}
+
+// newGroupsResolver returns a resolver for the identity provider configured by so or lo, or nil if neither is set.
+func newGroupsResolver(so options.GroupsSCIMOptions, lo options.GroupsLDAPOptions) (groups.Resolver, error) {
+	switch {
+	case so.URL != "" && lo.URL != "":
+		return nil, result.Usage(errors.New("--groups-scim-url and --groups-ldap-url can't be used together"))
+	case so.URL != "":
+		return newSCIMResolver(so)
+	case lo.URL != "":
+		if lo.BaseDN == "" {
+			return nil, result.Usage(errors.New("--groups-ldap-base-dn is required with --groups-ldap-url"))
+		}
+
+		opts := []groups.LDAPOption{groups.WithLDAPSearch(lo.Tool)}
+		if lo.BindDN != "" {
+			if lo.PasswordFile == "" {
+				return nil, result.Usage(errors.New("--groups-ldap-password-file is required with --groups-ldap-bind-dn"))
+			}
+
+			opts = append(opts, groups.WithBind(lo.BindDN, lo.PasswordFile))
+		}
+
+		return groups.NewLDAP(lo.URL, lo.BaseDN, opts...), nil
+	default:
+		return nil, nil
+	}
+}
+
+// newSCIMResolver returns a resolver for the SCIM service of so, authenticated with the token in its token file.
+func newSCIMResolver(so options.GroupsSCIMOptions) (*groups.SCIMResolver, error) {
+	token := ""
+	if so.TokenFile != "" {
+		tokenBytes, err := os.ReadFile(so.TokenFile)
+		if err != nil {
+			return nil, result.Usage(fmt.Errorf("failed to read scim token: %w", err))
+		}
+
+		token = strings.TrimSpace(string(tokenBytes))
+	}
+
+	return groups.NewSCIM(so.URL, token), nil
+}
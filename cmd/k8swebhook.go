@@ -0,0 +1,350 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/admission"
+	"github.com/testifysec/witness/pkg/archivista"
+	"github.com/testifysec/witness/pkg/auditlog"
+	"github.com/testifysec/witness/pkg/metrics"
+	"github.com/testifysec/witness/pkg/oci"
+	"github.com/testifysec/witness/pkg/registry"
+	"github.com/testifysec/witness/pkg/reload"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/routing"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+// auditLogQueue is how many decisions the webhook holds while earlier ones are written to the audit log.
+const auditLogQueue = 1024
+
+func K8sWebhookCmd() *cobra.Command {
+	wo := options.K8sWebhookOptions{}
+	cmd := &cobra.Command{
+		Use:   "k8s-webhook",
+		Short: "Runs a Kubernetes admission webhook that only admits Pods with verified images",
+		Long: "Serves a validating admission webhook at " + admission.Path + " that verifies the attestations attached to the " +
+			"images of each Pod against a signed policy, and rejects the Pod if any image doesn't satisfy it. Images must be " +
+			"referenced by digest, since a tag could be moved to another image before the kubelet pulls it. Images are " +
+			"verified under their manifest digest and image id, with the attestations attached to them in their registry " +
+			"and, with --enable-archivista, those stored in Archivista. The policy and keys are reloaded when they change " +
+			"and on SIGHUP. A policy that fails to verify is reported and the last good one is kept. With --routing-config, " +
+			"images are verified against the policy of the first route that selects them by namespace, repository, and " +
+			"Pod labels, so one webhook can enforce the policies of many teams. With --metrics-listen, Prometheus metrics are " +
+			"served at " + metrics.Path + " on a separate address: witness_verifications_total, " +
+			"witness_verification_duration_seconds, and witness_policy_denials_total for the images verified, and " +
+			"witness_policy_reloads_total and witness_policy_last_reload_timestamp_seconds for the policies loaded",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return runK8sWebhook(ctx, wo)
+		},
+	}
+
+	wo.AddFlags(cmd)
+	return cmd
+}
+
+func runK8sWebhook(ctx context.Context, wo options.K8sWebhookOptions) error {
+	if wo.TLSCertPath == "" || wo.TLSKeyPath == "" {
+		return result.Usage(errors.New("--tls-cert and --tls-key are required, the Kubernetes API server only calls webhooks over HTTPS"))
+	}
+
+	var archivistaClient *archivista.Client
+	if wo.ArchivistaOptions.Enable {
+		var err error
+		if archivistaClient, err = newArchivistaClient(wo.ArchivistaOptions.Url, wo.ArchivistaOptions.ArchivistaClientOptions); err != nil {
+			return result.Storage(err)
+		}
+
+		defer archivistaClient.Close()
+	}
+
+	m, err := serveMetrics(ctx, wo.MetricsListen)
+	if err != nil {
+		return err
+	}
+
+	// decisions are written in the background so admission reviews are answered without waiting on the log
+	auditLog, err := openAuditLog(ctx, wo.AuditLog, auditlog.WithBackground(auditLogQueue))
+	if err != nil {
+		return err
+	}
+
+	defer auditLog.Close()
+	registryOpts := []registry.Option{registry.WithPlainHTTP(wo.RegistryPlainHTTP)}
+	router, err := startPolicyRouter(ctx, wo, archivistaClient, registryOpts, m)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(admission.Path, admission.NewHandler(newImageVerifier(wo, router, archivistaClient, registryOpts, m, auditLog)))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{Addr: wo.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Errorf("failed to shut down webhook: %v", err)
+		}
+	}()
+
+	log.Infof("Serving admission reviews on %v%v", wo.Listen, admission.Path)
+	if err := server.ListenAndServeTLS(wo.TLSCertPath, wo.TLSKeyPath); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve webhook: %w", err)
+	}
+
+	return nil
+}
+
+// startPolicyWatcher loads the policy and keys po selects, failing if they don't verify, and keeps reloading them
+// until ctx is done.
+func startPolicyWatcher(ctx context.Context, po options.PolicySourceOptions, archivistaClient *archivista.Client, registryOpts []registry.Option, m *metrics.Metrics) (*reload.Watcher, error) {
+	if po.Policy == "" {
+		return nil, result.Usage(errors.New("--policy is required"))
+	}
+
+	if len(po.KeyPaths) == 0 {
+		return nil, result.Usage(errors.New("at least one --publickey is required"))
+	}
+
+	policySource, err := newPolicySource(po.Policy, archivistaClient, registryOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	keySources := make([]reload.Source, 0, len(po.KeyPaths))
+	for _, path := range po.KeyPaths {
+		keySources = append(keySources, reload.File(path))
+	}
+
+	watcher := reload.New(policySource, keySources, reload.WithInterval(po.ReloadInterval), reload.WithMetrics(m))
+	if _, err := watcher.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Loaded policy %v from %v", watcher.Bundle().PolicyDigest, policySource)
+	triggers := make(chan os.Signal, 1)
+	signal.Notify(triggers, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(triggers)
+		watcher.Run(ctx, triggers)
+	}()
+
+	return watcher, nil
+}
+
+// newPolicySource returns where the policy ref names is loaded from: an artifact in a registry for oci://
+// references, Archivista for gitoids that aren't files, or otherwise a file.
+func newPolicySource(ref string, archivistaClient *archivista.Client, registryOpts []registry.Option) (reload.Source, error) {
+	if strings.HasPrefix(ref, "oci://") {
+		registryRef, err := registry.ParseReference(strings.TrimPrefix(ref, "oci://"))
+		if err != nil {
+			return nil, result.Usage(fmt.Errorf("invalid policy reference %v: %w", ref, err))
+		}
+
+		return reload.Registry(registry.New(registryOpts...), registryRef), nil
+	}
+
+	if _, err := os.Stat(ref); err != nil && isGitoid(ref) {
+		if archivistaClient == nil {
+			return nil, result.Usage(fmt.Errorf("policy %v is a gitoid, which requires --enable-archivista", ref))
+		}
+
+		return reload.Archivista(archivistaClient, ref), nil
+	}
+
+	return reload.File(ref), nil
+}
+
+// policyRoute is the policy images are verified against, and the environment they are verified for.
+type policyRoute struct {
+	// name is the name of the route of the routing config, or empty without one
+	name        string
+	environment string
+	watcher     *reload.Watcher
+}
+
+func (r policyRoute) String() string {
+	if r.name == "" {
+		return "policy"
+	}
+
+	return fmt.Sprintf("policy of route %v", r.name)
+}
+
+// policyRouter selects the policy route an image is verified with.
+type policyRouter func(image admission.Image, ref registry.Reference) (policyRoute, error)
+
+// startPolicyRouter starts the policy watchers of the routes of --routing-config, or of --policy when there is no
+// routing config.
+func startPolicyRouter(ctx context.Context, wo options.K8sWebhookOptions, archivistaClient *archivista.Client, registryOpts []registry.Option, m *metrics.Metrics) (policyRouter, error) {
+	if wo.RoutingConfigPath == "" {
+		watcher, err := startPolicyWatcher(ctx, wo.PolicySource, archivistaClient, registryOpts, m)
+		if err != nil {
+			return nil, err
+		}
+
+		route := policyRoute{environment: wo.Environment, watcher: watcher}
+		return func(admission.Image, registry.Reference) (policyRoute, error) {
+			return route, nil
+		}, nil
+	}
+
+	if wo.PolicySource.Policy != "" || len(wo.PolicySource.KeyPaths) > 0 {
+		return nil, result.Usage(errors.New("--policy and --publickey can't be used with --routing-config, routes name their own policy and keys"))
+	}
+
+	config, err := routing.Load(wo.RoutingConfigPath)
+	if err != nil {
+		return nil, result.Usage(err)
+	}
+
+	routes := make(map[string]policyRoute, len(config.Routes))
+	for _, r := range config.Routes {
+		watcher, err := startPolicyWatcher(ctx, options.PolicySourceOptions{
+			Policy:         r.Policy,
+			KeyPaths:       r.PublicKeys,
+			ReloadInterval: wo.PolicySource.ReloadInterval,
+		}, archivistaClient, registryOpts, m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load policy of route %v: %w", r.Name, err)
+		}
+
+		route := policyRoute{name: r.Name, environment: r.Environment, watcher: watcher}
+		if route.environment == "" {
+			route.environment = wo.Environment
+		}
+
+		routes[r.Name] = route
+	}
+
+	return func(image admission.Image, ref registry.Reference) (policyRoute, error) {
+		r, ok := config.Route(routing.Request{Namespace: image.Namespace, Repository: ref.Registry + "/" + ref.Repository, Labels: image.Labels})
+		if !ok {
+			return policyRoute{}, result.Policy(errors.New("no route of the routing config selects it"))
+		}
+
+		return routes[r.Name], nil
+	}, nil
+}
+
+// newImageVerifier returns the function the webhook verifies images with, against the policy router currently
+// selects for them. Each image is read with its own registry client, so images of a Pod can be read concurrently.
+// Every decision is recorded in auditLog; failing to record one doesn't change it.
+func newImageVerifier(wo options.K8sWebhookOptions, router policyRouter, archivistaClient *archivista.Client, registryOpts []registry.Option, m *metrics.Metrics, auditLog *auditlog.Log) admission.VerifyFunc {
+	return func(ctx context.Context, image admission.Image) (err error) {
+		start := time.Now()
+		var subjects []cryptoutil.DigestSet
+		route, policyDigest := policyRoute{}, ""
+		defer func() {
+			m.ObserveVerification(start, err)
+			d := newDecision("k8s-webhook", subjects, policyDigest, err)
+			d.Context = map[string]string{"image": image.Reference, "namespace": image.Namespace}
+			if route.name != "" {
+				d.Context["route"] = route.name
+			}
+
+			if recordErr := auditLog.Record(ctx, d); recordErr != nil {
+				log.Errorf("%v", recordErr)
+			}
+		}()
+
+		ref, err := registry.ParseReference(image.Reference)
+		if err != nil {
+			return result.Usage(fmt.Errorf("invalid image reference: %w", err))
+		}
+
+		// a tag can be moved between verifying the image and the kubelet pulling it, so only a digest pins the
+		// image that runs to the one verified
+		if ref.Digest == "" {
+			return result.Policy(errors.New("the image isn't pinned by digest, reference it as image@sha256:<digest>"))
+		}
+
+		route, err = router(image, ref)
+		if err != nil {
+			return err
+		}
+
+		client := registry.New(registryOpts...)
+		digests, desc, err := client.SubjectDigests(ctx, ref)
+		if err != nil {
+			return result.Storage(fmt.Errorf("failed to read image: %w", err))
+		}
+
+		envelopes, err := client.Attestations(ctx, ref, desc)
+		if err != nil {
+			return result.Storage(fmt.Errorf("failed to read attestations attached to image: %w", err))
+		}
+
+		memSource := source.NewMemorySource()
+		for _, envelope := range envelopes {
+			if err := memSource.LoadBytes(fmt.Sprintf("%v@%v", ref, oci.Digest(envelope)), envelope); err != nil {
+				return fmt.Errorf("failed to load attestation attached to image: %w", err)
+			}
+		}
+
+		var collectionSource source.Sourcer = memSource
+		if archivistaClient != nil {
+			collectionSource = source.NewMultiSource(memSource, storageSource{archivista.NewSource(archivistaClient), wo.ArchivistaOptions.Url})
+		}
+
+		subjects = make([]cryptoutil.DigestSet, 0, len(digests))
+		for _, digest := range digests {
+			subjects = append(subjects, cryptoutil.DigestSet{cryptoutil.DigestValue{Hash: crypto.SHA256}: digest})
+		}
+
+		b := route.watcher.Bundle()
+		policyDigest = b.PolicyDigest
+		if _, err := verify.Verify(
+			ctx,
+			b.PolicyEnvelope,
+			b.Verifiers,
+			verify.WithSubjectDigests(subjects),
+			verify.WithCollectionSource(collectionSource),
+			verify.WithClockSkew(wo.ClockSkew),
+			verify.WithEnvironment(route.environment),
+		); err != nil {
+			return result.Policy(fmt.Errorf("failed to verify %v: %w", route, err))
+		}
+
+		log.Infof("Verified %v for namespace %v against %v %v", image.Reference, image.Namespace, route, b.PolicyDigest)
+		return nil
+	}
+}
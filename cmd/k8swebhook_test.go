@@ -0,0 +1,269 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/admission"
+	"github.com/testifysec/witness/pkg/auditlog"
+	"github.com/testifysec/witness/pkg/metrics"
+	"github.com/testifysec/witness/pkg/oci"
+	"github.com/testifysec/witness/pkg/registry"
+	"github.com/testifysec/witness/pkg/result"
+)
+
+// fakeRegistry serves the manifests and blobs it holds for reading, without the referrers API.
+type fakeRegistry struct {
+	manifests map[string][]byte
+	blobs     map[string][]byte
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v2/app/")
+	if strings.HasPrefix(path, "manifests/") {
+		data, ok := f.manifests[strings.TrimPrefix(path, "manifests/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		manifest := struct {
+			MediaType string `json:"mediaType"`
+		}{}
+		_ = json.Unmarshal(data, &manifest)
+		w.Header().Set("Content-Type", manifest.MediaType)
+		_, _ = w.Write(data)
+		return
+	}
+
+	if data, ok := f.blobs[strings.TrimPrefix(path, "blobs/")]; ok {
+		_, _ = w.Write(data)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+func (f *fakeRegistry) putManifest(t *testing.T, tag string, manifest interface{}) oci.Descriptor {
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	desc := oci.Descriptor{MediaType: oci.MediaTypeImageManifest, Digest: oci.Digest(data), Size: int64(len(data))}
+	f.manifests[desc.Digest] = data
+	if tag != "" {
+		f.manifests[tag] = data
+	}
+
+	return desc
+}
+
+func (f *fakeRegistry) putBlob(data []byte) oci.Descriptor {
+	f.blobs[oci.Digest(data)] = data
+	return oci.Descriptor{Digest: oci.Digest(data), Size: int64(len(data))}
+}
+
+func TestK8sWebhookVerifiesImages(t *testing.T) {
+	_, ver, pub, funcPriv, err := createTestRSAKey()
+	require.NoError(t, err)
+	keyID, err := ver.KeyID()
+	require.NoError(t, err)
+	functionary := policy.Functionary{Type: "PublicKey", PublicKeyID: keyID}
+	p, err := json.Marshal(policy.Policy{
+		Expires:    time.Now().Add(time.Hour),
+		PublicKeys: map[string]policy.PublicKey{keyID: {KeyID: keyID, Key: pub}},
+		Steps: map[string]policy.Step{"build": {
+			Name:          "build",
+			Functionaries: []policy.Functionary{functionary},
+			Attestations:  []policy.Attestation{{Type: commandrun.Type}},
+		}},
+	})
+	require.NoError(t, err)
+
+	signedPolicy, policyPub := signPolicyRSA(t, p)
+	dir := t.TempDir()
+	policyPath, keyPath, funcPrivPath := filepath.Join(dir, "policy.json"), filepath.Join(dir, "policy-pub.pem"), filepath.Join(dir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(policyPath, signedPolicy, 0644))
+	require.NoError(t, os.WriteFile(keyPath, policyPub, 0644))
+	require.NoError(t, os.WriteFile(funcPrivPath, funcPriv, 0644))
+
+	// the image's config is the product of the build step, so its image id is a subject of the attestation
+	workingDir := t.TempDir()
+	attestationPath := filepath.Join(t.TempDir(), "build.json")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:  options.KeyOptions{KeyPath: funcPrivPath},
+		WorkingDir:  workingDir,
+		OutFilePath: attestationPath,
+		StepName:    "build",
+	}, []string{"bash", "-c", "echo 'config' > config.json"}, nil))
+
+	config, err := os.ReadFile(filepath.Join(workingDir, "config.json"))
+	require.NoError(t, err)
+	envelope, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+
+	fake := &fakeRegistry{manifests: map[string][]byte{}, blobs: map[string][]byte{}}
+	configDesc := fake.putBlob(config)
+	configDesc.MediaType = "application/vnd.oci.image.config.v1+json"
+	verified := fake.putManifest(t, "verified", oci.Manifest{SchemaVersion: 2, MediaType: oci.MediaTypeImageManifest, Config: configDesc, Layers: []oci.Descriptor{}})
+	unverified := fake.putManifest(t, "unverified", oci.Manifest{SchemaVersion: 2, MediaType: oci.MediaTypeImageManifest, Config: fake.putBlob([]byte("{}")), Layers: []oci.Descriptor{}})
+
+	envelopeDesc := fake.putBlob(envelope)
+	envelopeDesc.MediaType = oci.MediaTypeDSSE
+	artifact := fake.putManifest(t, "", oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeImageManifest,
+		ArtifactType:  oci.MediaTypeDSSE,
+		Config:        fake.putBlob([]byte("{}")),
+		Layers:        []oci.Descriptor{envelopeDesc},
+		Subject:       &verified,
+	})
+	artifact.ArtifactType = oci.MediaTypeDSSE
+	referrers, err := json.Marshal(oci.Index{SchemaVersion: 2, MediaType: oci.MediaTypeImageIndex, Manifests: []oci.Descriptor{artifact}})
+	require.NoError(t, err)
+	fake.manifests[strings.Replace(verified.Digest, ":", "-", 1)] = referrers
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wo := options.K8sWebhookOptions{
+		PolicySource:      options.PolicySourceOptions{Policy: policyPath, KeyPaths: []string{keyPath}},
+		RegistryPlainHTTP: true,
+	}
+
+	registryOpts := []registry.Option{registry.WithPlainHTTP(true)}
+	m := metrics.New()
+	router, err := startPolicyRouter(ctx, wo, nil, registryOpts, m)
+	require.NoError(t, err)
+	auditLogPath := filepath.Join(dir, "audit.log")
+	auditLog, err := auditlog.Open(auditLogPath)
+	require.NoError(t, err)
+	verify := newImageVerifier(wo, router, nil, registryOpts, m, auditLog)
+
+	verifiedRef, unverifiedRef := host+"/app@"+verified.Digest, host+"/app@"+unverified.Digest
+	require.NoError(t, verify(ctx, admission.Image{Reference: verifiedRef}))
+
+	err = verify(ctx, admission.Image{Reference: unverifiedRef})
+	require.Error(t, err)
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(err))
+
+	err = verify(ctx, admission.Image{Reference: host + "/app@sha256:" + strings.Repeat("0", 64)})
+	require.Error(t, err)
+	require.Equal(t, result.CategoryStorage, result.CategoryOf(err))
+
+	// a tag could be moved to another image before the kubelet pulls it, so the image is denied even though the
+	// tag points at a verified image now
+	err = verify(ctx, admission.Image{Reference: host + "/app:verified"})
+	require.ErrorContains(t, err, "isn't pinned by digest")
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(err))
+
+	// every decision is counted in the metrics by its result and the category of its error
+	scrape := httptest.NewRecorder()
+	m.Handler().ServeHTTP(scrape, httptest.NewRequest(http.MethodGet, metrics.Path, nil))
+	require.Contains(t, scrape.Body.String(), `witness_verifications_total{reason="",result="success"} 1`)
+	require.Contains(t, scrape.Body.String(), `witness_verifications_total{reason="policy",result="failure"} 2`)
+	require.Contains(t, scrape.Body.String(), `witness_verifications_total{reason="storage",result="failure"} 1`)
+	require.Contains(t, scrape.Body.String(), `witness_policy_reloads_total{reason="",result="success"} 1`)
+
+	// every decision is recorded in the audit log
+	auditLogFile, err := os.Open(auditLogPath)
+	require.NoError(t, err)
+	defer auditLogFile.Close()
+	records, err := auditlog.Verify(auditLogFile)
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	require.Equal(t, auditlog.ResultAllowed, records[0].Result)
+	require.Equal(t, "sha256:"+strings.TrimPrefix(verified.Digest, "sha256:"), records[0].Subjects[0])
+	require.NotEmpty(t, records[0].PolicyDigest)
+	require.Equal(t, unverifiedRef, records[1].Context["image"])
+	require.Equal(t, auditlog.ResultDenied, records[1].Result)
+	require.Equal(t, string(result.CategoryPolicy), records[1].Category)
+
+	handler := admission.NewHandler(verify)
+	pod, err := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"containers": []map[string]string{
+		{"image": verifiedRef},
+		{"image": unverifiedRef},
+	}}})
+	require.NoError(t, err)
+	response := handler.Review(ctx, &admission.Request{UID: "1", Kind: admission.GroupVersion{Version: "v1", Kind: "Pod"}, Object: pod})
+	require.False(t, response.Allowed)
+	require.Contains(t, response.Status.Message, unverifiedRef)
+	require.NotContains(t, response.Status.Message, verifiedRef)
+
+	// routes select the policy and environment by namespace
+	routingConfig, err := json.Marshal(map[string]interface{}{"routes": []map[string]interface{}{
+		{"name": "production", "namespaces": []string{"prod-*"}, "policy": policyPath, "publickeys": []string{keyPath}, "environment": "production"},
+		{"name": "team-a", "namespaces": []string{"team-a"}, "policy": policyPath, "publickeys": []string{keyPath}},
+	}})
+	require.NoError(t, err)
+	routingPath := filepath.Join(dir, "routing.json")
+	require.NoError(t, os.WriteFile(routingPath, routingConfig, 0644))
+
+	wo = options.K8sWebhookOptions{RoutingConfigPath: routingPath, RegistryPlainHTTP: true}
+	router, err = startPolicyRouter(ctx, wo, nil, registryOpts, nil)
+	require.NoError(t, err)
+	verify = newImageVerifier(wo, router, nil, registryOpts, nil, nil)
+	require.NoError(t, verify(ctx, admission.Image{Reference: verifiedRef, Namespace: "team-a"}))
+	require.ErrorContains(t, verify(ctx, admission.Image{Reference: unverifiedRef, Namespace: "team-a"}), "failed to verify policy of route team-a")
+	require.ErrorContains(t, verify(ctx, admission.Image{Reference: verifiedRef, Namespace: "prod-eu"}), "environment production is not an environment of the policy")
+
+	err = verify(ctx, admission.Image{Reference: verifiedRef, Namespace: "team-b"})
+	require.ErrorContains(t, err, "no route of the routing config selects it")
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(err))
+
+	_, err = startPolicyRouter(ctx, options.K8sWebhookOptions{RoutingConfigPath: routingPath, PolicySource: options.PolicySourceOptions{Policy: policyPath}}, nil, registryOpts, nil)
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+}
+
+func TestK8sWebhookPolicySource(t *testing.T) {
+	_, err := startPolicyWatcher(context.Background(), options.PolicySourceOptions{KeyPaths: []string{"key.pem"}}, nil, nil, nil)
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+
+	_, err = startPolicyWatcher(context.Background(), options.PolicySourceOptions{Policy: "policy.json"}, nil, nil, nil)
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+
+	gitoid := strings.Repeat("ab", 32)
+	_, err = newPolicySource(gitoid, nil, nil)
+	require.ErrorContains(t, err, "requires --enable-archivista")
+
+	source, err := newPolicySource("oci://ghcr.io/org/policy:v1", nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "oci://ghcr.io/org/policy:v1", source.String())
+
+	source, err = newPolicySource("policy.json", nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "policy.json", source.String())
+
+	// the webhook doesn't start with a policy that can't be verified
+	_, err = startPolicyWatcher(context.Background(), options.PolicySourceOptions{Policy: filepath.Join(t.TempDir(), "policy.json"), KeyPaths: []string{"key.pem"}}, nil, nil, nil)
+	require.ErrorContains(t, err, "failed to load policy")
+
+	err = runK8sWebhook(context.Background(), options.K8sWebhookOptions{})
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+}
@@ -15,14 +15,30 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net/http"
+	"os"
+	"strings"
 
 	"github.com/testifysec/go-witness/cryptoutil"
 	"github.com/testifysec/go-witness/signer/file"
 	"github.com/testifysec/go-witness/signer/fulcio"
 	"github.com/testifysec/go-witness/signer/spiffe"
 	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/signer/aia"
+	"github.com/testifysec/witness/pkg/signer/azurekms"
+	"github.com/testifysec/witness/pkg/signer/gcpkms"
+	"github.com/testifysec/witness/pkg/signer/gpg"
+	"github.com/testifysec/witness/pkg/signer/piv"
+	"github.com/testifysec/witness/pkg/signer/pkcs11"
+	"github.com/testifysec/witness/pkg/signer/remote"
+	"github.com/testifysec/witness/pkg/signer/smime"
+	"github.com/testifysec/witness/pkg/signer/ssh"
+	"github.com/testifysec/witness/pkg/signer/tpm"
 )
 
 func loadSigners(ctx context.Context, ko options.KeyOptions) ([]cryptoutil.Signer, []error) {
@@ -51,6 +67,17 @@ func loadSigners(ctx context.Context, ko options.KeyOptions) ([]cryptoutil.Signe
 		}
 	}
 
+	//Load additional keys from files
+	for _, keyPath := range ko.AdditionalKeyPaths {
+		fileSigner, err := file.Signer(ctx, keyPath, "", nil)
+		if err != nil {
+			err := fmt.Errorf("failed to create signer from file %v: %w", keyPath, err)
+			errors = append(errors, err)
+		} else {
+			signers = append(signers, fileSigner)
+		}
+	}
+
 	//Load key from spire agent
 	if ko.SpiffePath != "" {
 		spiffeSigner, err := spiffe.Signer(ctx, ko.SpiffePath)
@@ -62,5 +89,306 @@ func loadSigners(ctx context.Context, ko options.KeyOptions) ([]cryptoutil.Signe
 		}
 	}
 
+	//Load key from a remote signing service
+	if ko.RemoteSigner.URL != "" {
+		remoteSigner, err := loadRemoteSigner(ctx, ko.RemoteSigner)
+		if err != nil {
+			err := fmt.Errorf("failed to create signer from remote signing service: %w", err)
+			errors = append(errors, err)
+		} else {
+			signers = append(signers, remoteSigner)
+		}
+	}
+
+	//Load key from gpg
+	if ko.GPG.KeyPath != "" || ko.GPG.AgentKeyID != "" {
+		gpgSigner, err := loadGPGSigner(ctx, ko.GPG)
+		if err != nil {
+			err := fmt.Errorf("failed to create signer from gpg: %w", err)
+			errors = append(errors, err)
+		} else {
+			signers = append(signers, gpgSigner)
+		}
+	}
+
+	//Load key from ssh-agent
+	if ko.SSH.AgentKey != "" {
+		sshSigner, err := ssh.Signer(ctx, ko.SSH.AgentSocket, ko.SSH.AgentKey)
+		if err != nil {
+			err := fmt.Errorf("failed to create signer from ssh-agent: %w", err)
+			errors = append(errors, err)
+		} else {
+			signers = append(signers, sshSigner)
+		}
+	}
+
+	//Load keys from PIV token slots
+	for _, slot := range ko.PIV.Slots {
+		pivSigner, err := loadPIVSigner(ctx, ko.PIV, slot)
+		if err != nil {
+			err := fmt.Errorf("failed to create signer from piv slot %v: %w", slot, err)
+			errors = append(errors, err)
+		} else {
+			signers = append(signers, pivSigner)
+		}
+	}
+
+	//Load keys from a TPM
+	if len(ko.TPM.CertPaths) > 0 && len(ko.TPM.CertPaths) != len(ko.TPM.Keys) {
+		errors = append(errors, fmt.Errorf("%v tpm certificates were given for %v tpm keys, expected one for each key", len(ko.TPM.CertPaths), len(ko.TPM.Keys)))
+	} else {
+		for i, key := range ko.TPM.Keys {
+			tpmSigner, err := loadTPMSigner(ctx, ko.TPM, key, perKey(ko.TPM.CertPaths, i))
+			if err != nil {
+				err := fmt.Errorf("failed to create signer from tpm key %v: %w", key, err)
+				errors = append(errors, err)
+			} else {
+				signers = append(signers, tpmSigner)
+			}
+		}
+	}
+
+	//Load keys from a PKCS#11 token
+	if ko.PKCS11.Module != "" {
+		pkcs11Signers, err := loadPKCS11Signers(ctx, ko.PKCS11)
+		if err != nil {
+			err := fmt.Errorf("failed to create signer from pkcs11: %w", err)
+			errors = append(errors, err)
+		} else {
+			signers = append(signers, pkcs11Signers...)
+		}
+	}
+
+	//Load keys from Azure Key Vault
+	for _, url := range ko.AzureKMS.URLs {
+		azureSigner, err := loadAzureKMSSigner(ctx, ko.AzureKMS, url)
+		if err != nil {
+			err := fmt.Errorf("failed to create signer from azure key vault key %v: %w", url, err)
+			errors = append(errors, err)
+		} else {
+			signers = append(signers, azureSigner)
+		}
+	}
+
+	//Load keys from Google Cloud KMS
+	for _, key := range ko.GCPKMS.Keys {
+		gcpSigner, err := gcpkms.Signer(ctx, key, gcpkms.WithCredentialsFile(ko.GCPKMS.CredentialsFile))
+		if err != nil {
+			err := fmt.Errorf("failed to create signer from google cloud kms key %v: %w", key, err)
+			errors = append(errors, err)
+		} else {
+			signers = append(signers, gcpSigner)
+		}
+	}
+
+	//Load key from an S/MIME identity
+	if ko.SMIME.PKCS12Path != "" {
+		smimeSigner, err := loadSMIMESigner(ko.SMIME)
+		if err != nil {
+			err := fmt.Errorf("failed to create signer from s/mime identity: %w", err)
+			errors = append(errors, err)
+		} else {
+			signers = append(signers, smimeSigner)
+		}
+	}
+
+	//Complete certificate chains from AIA
+	if ko.FetchIntermediates {
+		for i, signer := range signers {
+			completed, err := aia.CompleteChain(ctx, http.DefaultClient, signer)
+			if err != nil {
+				err := fmt.Errorf("failed to complete certificate chain: %w", err)
+				errors = append(errors, err)
+			} else {
+				signers[i] = completed
+			}
+		}
+	}
+
 	return signers, errors
 }
+
+func loadSMIMESigner(so options.SMIMEOptions) (cryptoutil.Signer, error) {
+	pfxData, err := os.ReadFile(so.PKCS12Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pkcs12 file: %w", err)
+	}
+
+	var password []byte
+	if so.PasswordFile != "" {
+		if password, err = os.ReadFile(so.PasswordFile); err != nil {
+			return nil, fmt.Errorf("failed to read password file: %w", err)
+		}
+	}
+
+	return smime.Signer(pfxData, string(bytes.TrimRight(password, "\r\n")))
+}
+
+// perKey returns the value of values given for the i-th key, or "" if values is empty. Values given for each of a
+// list of keys are matched to them by position.
+func perKey(values []string, i int) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[i]
+}
+
+func loadTPMSigner(ctx context.Context, to options.TPMOptions, key, certPath string) (cryptoutil.Signer, error) {
+	opts := []tpm.Option{tpm.WithTCTI(to.TCTI), tpm.WithAuthFile(to.AuthFile)}
+	var certificate []byte
+	if certPath != "" {
+		var err error
+		if certificate, err = os.ReadFile(certPath); err != nil {
+			return nil, fmt.Errorf("failed to read certificate: %w", err)
+		}
+	}
+
+	return tpm.Signer(ctx, key, certificate, opts...)
+}
+
+// loadAzureKMSSigner authenticates as a service principal when a client secret is given, through the flag or the
+// environment variables the Azure SDKs read, and as the host's managed identity otherwise.
+func loadAzureKMSSigner(ctx context.Context, ao options.AzureKMSOptions, url string) (cryptoutil.Signer, error) {
+	tenantID, clientID := ao.TenantID, ao.ClientID
+	if tenantID == "" {
+		tenantID = os.Getenv("AZURE_TENANT_ID")
+	}
+
+	if clientID == "" {
+		clientID = os.Getenv("AZURE_CLIENT_ID")
+	}
+
+	clientSecret := os.Getenv("AZURE_CLIENT_SECRET")
+	if ao.ClientSecretFile != "" {
+		secret, err := os.ReadFile(ao.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client secret file: %w", err)
+		}
+
+		clientSecret = strings.TrimSpace(string(secret))
+	}
+
+	credential := azurekms.ManagedIdentity(clientID)
+	if clientSecret != "" {
+		credential = azurekms.ServicePrincipal(tenantID, clientID, clientSecret)
+	}
+
+	return azurekms.Signer(ctx, url, credential)
+}
+
+// loadPKCS11Signers loads a signer for each key of the token. Keys are selected by label, by ID, or by both, in which
+// case the labels and IDs are matched by position.
+func loadPKCS11Signers(ctx context.Context, po options.PKCS11Options) ([]cryptoutil.Signer, error) {
+	keys := len(po.KeyLabels)
+	if len(po.KeyIDs) > keys {
+		keys = len(po.KeyIDs)
+	}
+
+	if keys == 0 {
+		return nil, fmt.Errorf("a key label or key id is required")
+	}
+
+	if len(po.KeyLabels) > 0 && len(po.KeyIDs) > 0 && len(po.KeyLabels) != len(po.KeyIDs) {
+		return nil, fmt.Errorf("%v key labels and %v key ids were given, expected one id for each label", len(po.KeyLabels), len(po.KeyIDs))
+	}
+
+	if len(po.CertPaths) > 0 && len(po.CertPaths) != keys {
+		return nil, fmt.Errorf("%v certificates were given for %v keys, expected one for each key", len(po.CertPaths), keys)
+	}
+
+	opts := []pkcs11.Option{pkcs11.WithSlot(po.Slot)}
+	if po.PINFile != "" {
+		pin, err := os.ReadFile(po.PINFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pin file: %w", err)
+		}
+
+		opts = append(opts, pkcs11.WithPIN(strings.TrimSpace(string(pin))))
+	}
+
+	signers := make([]cryptoutil.Signer, 0, keys)
+	for i := 0; i < keys; i++ {
+		var certificate []byte
+		if certPath := perKey(po.CertPaths, i); certPath != "" {
+			var err error
+			if certificate, err = os.ReadFile(certPath); err != nil {
+				return nil, fmt.Errorf("failed to read certificate: %w", err)
+			}
+		}
+
+		keyOpts := append([]pkcs11.Option{pkcs11.WithKeyLabel(perKey(po.KeyLabels, i)), pkcs11.WithKeyID(perKey(po.KeyIDs, i))}, opts...)
+		signer, err := pkcs11.Signer(ctx, po.Module, certificate, keyOpts...)
+		if err != nil {
+			return nil, err
+		}
+
+		signers = append(signers, signer)
+	}
+
+	return signers, nil
+}
+
+func loadPIVSigner(ctx context.Context, po options.PIVOptions, slot string) (cryptoutil.Signer, error) {
+	opts := []piv.Option{piv.WithReader(po.Reader)}
+	if po.PINFile != "" {
+		pin, err := os.ReadFile(po.PINFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pin file: %w", err)
+		}
+
+		opts = append(opts, piv.WithPIN(strings.TrimSpace(string(pin))))
+	}
+
+	return piv.Signer(ctx, slot, opts...)
+}
+
+func loadGPGSigner(ctx context.Context, gpgOpts options.GPGOptions) (cryptoutil.Signer, error) {
+	if gpgOpts.KeyPath != "" && gpgOpts.AgentKeyID != "" {
+		return nil, fmt.Errorf("only one of a gpg key file or gpg agent key may be used")
+	}
+
+	if gpgOpts.AgentKeyID != "" {
+		return gpg.NewAgentSigner(ctx, gpgOpts.AgentKeyID)
+	}
+
+	var passphrase []byte
+	if gpgOpts.PassphraseFile != "" {
+		passphraseBytes, err := os.ReadFile(gpgOpts.PassphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+
+		passphrase = bytes.TrimRight(passphraseBytes, "\r\n")
+	}
+
+	return gpg.Signer(gpgOpts.KeyPath, passphrase)
+}
+
+func loadRemoteSigner(ctx context.Context, ro options.RemoteSignerOptions) (cryptoutil.Signer, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ro.ClientCertPath != "" || ro.ClientKeyPath != "" {
+		clientCert, err := tls.LoadX509KeyPair(ro.ClientCertPath, ro.ClientKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	if ro.CAPath != "" {
+		caBytes, err := os.ReadFile(ro.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("no certificates found in ca %v", ro.CAPath)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return remote.Signer(ctx, &http.Client{Transport: transport}, ro.URL, ro.KeyID)
+}
@@ -0,0 +1,264 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+func PolicyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "policy",
+		Short:             "Manages witness policies",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(policyInitCmd())
+	cmd.AddCommand(policySignCmd())
+	cmd.AddCommand(policyRevokeKeyCmd())
+	return cmd
+}
+
+func policyInitCmd() *cobra.Command {
+	po := options.PolicyInitOptions{}
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Scaffolds a policy from example attestations",
+		Long: "Scaffolds a policy from the attestations of a known good run. Each step the attestations were recorded " +
+			"for becomes a step of the policy that requires the attestation types its examples recorded, may be " +
+			"performed by the keys or certificate identities whose signatures on them verify, and takes its artifacts from " +
+			"the steps whose products it used. Review the policy and add rego policies before signing it with witness policy sign.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPolicyInit(po, time.Now())
+		},
+	}
+
+	po.AddFlags(cmd)
+	return cmd
+}
+
+func runPolicyInit(po options.PolicyInitOptions, now time.Time) error {
+	if len(po.AttestationFilePaths) == 0 {
+		return result.Usage(errors.New("at least one example attestation is required, provide --attestations"))
+	}
+
+	if len(po.PublicKeyPaths) == 0 && len(po.RootCAPaths) == 0 {
+		return result.Usage(errors.New("provide the public keys or root CAs that signed the attestations with --publickey or --root-ca"))
+	}
+
+	envelopes, err := loadEnvelopes(po.AttestationFilePaths, "attestation file")
+	if err != nil {
+		return result.Usage(err)
+	}
+
+	scaffold := verify.Scaffold{Expires: now.Add(po.Expires).UTC().Truncate(time.Second)}
+	for _, path := range po.PublicKeyPaths {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return result.Usage(fmt.Errorf("failed to read public key: %w", err))
+		}
+
+		scaffold.PublicKeys = append(scaffold.PublicKeys, key)
+	}
+
+	for _, path := range po.RootCAPaths {
+		root, err := os.ReadFile(path)
+		if err != nil {
+			return result.Usage(fmt.Errorf("failed to read root CA: %w", err))
+		}
+
+		scaffold.Roots = append(scaffold.Roots, root)
+	}
+
+	policyJSON, err := scaffold.Policy(envelopes)
+	if err != nil {
+		return result.Policy(err)
+	}
+
+	out, err := loadOutfile(po.OutFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open out file: %w", err)
+	}
+
+	defer out.Close()
+	if _, err := out.Write(append(policyJSON, '\n')); err != nil {
+		return fmt.Errorf("failed to write policy: %w", err)
+	}
+
+	return nil
+}
+
+func policySignCmd() *cobra.Command {
+	po := options.PolicySignOptions{}
+	cmd := &cobra.Command{
+		Use:   "sign",
+		Short: "Checks and signs a policy",
+		Long: "Checks that a policy can be verified against, such as that it hasn't expired and that every functionary " +
+			"refers to a key or root in the policy, and signs it with the provided key source.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPolicySign(po, time.Now())
+		},
+	}
+
+	po.AddFlags(cmd)
+	return cmd
+}
+
+func runPolicySign(po options.PolicySignOptions, now time.Time) error {
+	if po.PolicyFilePath == "" {
+		return result.Usage(errors.New("a policy is required, provide --policy"))
+	}
+
+	policyJSON, err := os.ReadFile(po.PolicyFilePath)
+	if err != nil {
+		return result.Usage(fmt.Errorf("failed to read policy: %w", err))
+	}
+
+	if err := verify.CheckPolicy(policyJSON, now); err != nil {
+		return result.Policy(fmt.Errorf("invalid policy: %w", err))
+	}
+
+	return runSign(options.SignOptions{
+		KeyOptions:        po.KeyOptions,
+		DataType:          policy.PolicyPredicate,
+		InFilePath:        po.PolicyFilePath,
+		OutFilePath:       po.OutFilePath,
+		TimestampServers:  po.TimestampServers,
+		OutputFormat:      po.OutputFormat,
+		BundleOutFilePath: po.BundleOutFilePath,
+	})
+}
+
+func policyRevokeKeyCmd() *cobra.Command {
+	po := options.PolicyRevokeKeyOptions{}
+	cmd := &cobra.Command{
+		Use:   "revoke-key",
+		Short: "Marks a functionary key of a policy as compromised",
+		Long: "Marks a public key of a policy as compromised after a point in time. Once the policy is signed again " +
+			"with witness sign, witness verify only accepts signatures of the key with a trusted timestamp from " +
+			"before the compromise, so evidence signed earlier still verifies.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPolicyRevokeKey(po)
+		},
+	}
+
+	po.AddFlags(cmd)
+	return cmd
+}
+
+func runPolicyRevokeKey(po options.PolicyRevokeKeyOptions) error {
+	if po.PolicyFilePath == "" {
+		return result.Usage(errors.New("a policy is required, provide --policy"))
+	}
+
+	keyID, err := revokedKeyID(po)
+	if err != nil {
+		return err
+	}
+
+	compromisedAt := time.Now()
+	if po.CompromisedAt != "" {
+		if compromisedAt, err = time.Parse(time.RFC3339, po.CompromisedAt); err != nil {
+			return result.Usage(fmt.Errorf("failed to parse --compromised-at: %w", err))
+		}
+	}
+
+	policyJSON, err := readPolicyPayload(po.PolicyFilePath)
+	if err != nil {
+		return result.Policy(err)
+	}
+
+	revoked, err := verify.RevokeKey(policyJSON, keyID, compromisedAt)
+	if err != nil {
+		return result.Policy(err)
+	}
+
+	out, err := loadOutfile(po.OutFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open out file: %w", err)
+	}
+
+	defer out.Close()
+	if _, err := out.Write(append(revoked, '\n')); err != nil {
+		return fmt.Errorf("failed to write policy: %w", err)
+	}
+
+	log.Infof("Key %v is compromised as of %v. Sign the policy again for verifiers to enforce it", keyID, compromisedAt.UTC().Format(time.RFC3339))
+	return nil
+}
+
+// revokedKeyID returns the id of the key to revoke, given either directly or as the public key itself.
+func revokedKeyID(po options.PolicyRevokeKeyOptions) (string, error) {
+	if (po.KeyID == "") == (po.PublicKeyPath == "") {
+		return "", result.Usage(errors.New("provide exactly one of --key-id or --publickey"))
+	}
+
+	if po.KeyID != "" {
+		return po.KeyID, nil
+	}
+
+	keyBytes, err := os.ReadFile(po.PublicKeyPath)
+	if err != nil {
+		return "", result.Usage(fmt.Errorf("failed to read public key: %w", err))
+	}
+
+	verifier, err := verify.NewVerifierFromBytes(keyBytes)
+	if err != nil {
+		return "", result.Usage(fmt.Errorf("failed to load public key: %w", err))
+	}
+
+	return verifier.KeyID()
+}
+
+// readPolicyPayload reads a policy document, taking it from the payload of its envelope if the policy is signed in any
+// of the output formats.
+func readPolicyPayload(path string) ([]byte, error) {
+	policyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+
+	env, err := bundle.Decode(policyBytes)
+	if err == nil && env.PayloadType != "" && len(env.Payload) > 0 {
+		return env.Payload, nil
+	}
+
+	if !json.Valid(policyBytes) {
+		return nil, fmt.Errorf("failed to decode policy envelope: %w", err)
+	}
+
+	return policyBytes, nil
+}
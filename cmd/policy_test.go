@@ -0,0 +1,170 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/result"
+)
+
+func TestPolicyInitAndSign(t *testing.T) {
+	funcPriv, funcPub := rsakeypair(t)
+	policyPriv, policyPub := rsakeypair(t)
+	workingDir := t.TempDir()
+	outDir := t.TempDir()
+	attestationPaths := []string{}
+	subjects := []string{}
+	for _, step := range []struct{ name, command string }{{"build", "echo 'test01' > test.txt"}, {"package", "echo 'test02' >> test.txt"}} {
+		attestationPath := filepath.Join(outDir, step.name+".json")
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:   options.KeyOptions{KeyPath: funcPriv.Name()},
+			WorkingDir:   workingDir,
+			Attestations: []string{},
+			OutFilePath:  attestationPath,
+			StepName:     step.name,
+		}, []string{"bash", "-c", step.command}, nil))
+
+		attestationPaths = append(attestationPaths, attestationPath)
+		artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(filepath.Join(workingDir, "test.txt"), []crypto.Hash{crypto.SHA256})
+		require.NoError(t, err)
+		for _, digest := range artifactDigest {
+			subjects = append(subjects, digest)
+		}
+	}
+
+	policyPath := filepath.Join(outDir, "policy.json")
+	require.NoError(t, runPolicyInit(options.PolicyInitOptions{
+		AttestationFilePaths: attestationPaths,
+		PublicKeyPaths:       []string{funcPub.Name()},
+		Expires:              time.Hour,
+		OutFilePath:          policyPath,
+	}, time.Now()))
+
+	policyJSON, err := os.ReadFile(policyPath)
+	require.NoError(t, err)
+	pol := policy.Policy{}
+	require.NoError(t, json.Unmarshal(policyJSON, &pol))
+	require.Len(t, pol.PublicKeys, 1)
+	require.Len(t, pol.Steps, 2)
+	require.Equal(t, []string{"build"}, pol.Steps["package"].ArtifactsFrom)
+	require.Empty(t, pol.Steps["build"].ArtifactsFrom)
+	require.Contains(t, pol.Steps["build"].Attestations, policy.Attestation{Type: commandrun.Type, RegoPolicies: []policy.RegoPolicy{}})
+
+	signedPolicyPath := filepath.Join(outDir, "policy-signed.json")
+	require.NoError(t, runPolicySign(options.PolicySignOptions{
+		KeyOptions:     options.KeyOptions{KeyPath: policyPriv.Name()},
+		PolicyFilePath: policyPath,
+		OutFilePath:    signedPolicyPath,
+	}, time.Now()))
+
+	require.NoError(t, runVerify(context.Background(), options.VerifyOptions{
+		KeyPath:              policyPub.Name(),
+		PolicyFilePath:       signedPolicyPath,
+		AttestationFilePaths: attestationPaths,
+		AdditionalSubjects:   subjects,
+	}))
+
+	// the policy subcommands read policies signed in any output format
+	for _, format := range []string{bundle.FormatDSSECBOR, bundle.FormatDSSEProtobuf} {
+		formatPath := filepath.Join(outDir, "policy-signed."+format)
+		require.NoError(t, runPolicySign(options.PolicySignOptions{
+			KeyOptions:     options.KeyOptions{KeyPath: policyPriv.Name()},
+			PolicyFilePath: policyPath,
+			OutFilePath:    formatPath,
+			OutputFormat:   format,
+		}, time.Now()))
+
+		payload, err := readPolicyPayload(formatPath)
+		require.NoError(t, err)
+		require.JSONEq(t, string(policyJSON), string(payload))
+	}
+
+	// an expired policy is refused rather than signed
+	err = runPolicySign(options.PolicySignOptions{
+		KeyOptions:     options.KeyOptions{KeyPath: policyPriv.Name()},
+		PolicyFilePath: policyPath,
+		OutFilePath:    filepath.Join(outDir, "expired.json"),
+	}, time.Now().Add(2*time.Hour))
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(err))
+}
+
+func TestPolicyInitUnknownSigner(t *testing.T) {
+	funcPriv, _ := rsakeypair(t)
+	_, otherPub := rsakeypair(t)
+	workingDir := t.TempDir()
+	attestationPath := filepath.Join(t.TempDir(), "build.json")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:   options.KeyOptions{KeyPath: funcPriv.Name()},
+		WorkingDir:   workingDir,
+		Attestations: []string{},
+		OutFilePath:  attestationPath,
+		StepName:     "build",
+	}, []string{"true"}, nil))
+
+	err := runPolicyInit(options.PolicyInitOptions{
+		AttestationFilePaths: []string{attestationPath},
+		PublicKeyPaths:       []string{otherPub.Name()},
+		Expires:              time.Hour,
+		OutFilePath:          filepath.Join(t.TempDir(), "policy.json"),
+	}, time.Now())
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(err))
+}
+
+func TestPolicyInitTamperedExample(t *testing.T) {
+	funcPriv, funcPub := rsakeypair(t)
+	workingDir := t.TempDir()
+	attestationPath := filepath.Join(t.TempDir(), "build.json")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:   options.KeyOptions{KeyPath: funcPriv.Name()},
+		WorkingDir:   workingDir,
+		Attestations: []string{},
+		OutFilePath:  attestationPath,
+		StepName:     "build",
+	}, []string{"true"}, nil))
+
+	// the signature names the trusted key, but no longer covers the payload
+	envelopeJSON, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(envelopeJSON, &env))
+	env.Payload = bytes.Replace(env.Payload, []byte(`"name":"build"`), []byte(`"name":"release"`), 1)
+	envelopeJSON, err = json.Marshal(env)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(attestationPath, envelopeJSON, 0644))
+
+	err = runPolicyInit(options.PolicyInitOptions{
+		AttestationFilePaths: []string{attestationPath},
+		PublicKeyPaths:       []string{funcPub.Name()},
+		Expires:              time.Hour,
+		OutFilePath:          filepath.Join(t.TempDir(), "policy.json"),
+	}, time.Now())
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(err))
+	require.ErrorContains(t, err, "no example of release has a valid signature")
+}
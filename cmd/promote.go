@@ -0,0 +1,74 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/attestation/promotion"
+	"github.com/testifysec/witness/pkg/result"
+)
+
+func PromoteCmd() *cobra.Command {
+	po := options.PromoteOptions{}
+	cmd := &cobra.Command{
+		Use:   "promote",
+		Short: "Verifies an artifact and attests to its promotion",
+		Long: "Verifies the evidence of an artifact against a policy, then records and signs a promotion attestation with " +
+			"the reference the artifact is promoted from and to, the promoter's identity, and the evidence that was " +
+			"verified. Policies for later environments can require the promotion step.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPromote(cmd.Context(), po)
+		},
+	}
+
+	po.AddFlags(cmd)
+	return cmd
+}
+
+func runPromote(ctx context.Context, po options.PromoteOptions) error {
+	if po.Source == "" || po.Destination == "" {
+		return result.Usage(errors.New("the references the artifact is promoted from and to are required, provide --from and --to"))
+	}
+
+	return recordVerifiedStep(ctx, verifiedStep{
+		kind:              "promotion",
+		verifyOptions:     po.VerifyOptions,
+		keyOptions:        po.KeyOptions,
+		stepName:          po.StepName,
+		outFilePath:       po.OutFilePath,
+		outputFormat:      po.OutputFormat,
+		bundleOutFilePath: po.BundleOutFilePath,
+		timestampServers:  po.TimestampServers,
+		attestor: func(signer cryptoutil.Signer, inputs verifyInputs, verified map[string][]source.VerifiedCollection) attestation.Attestor {
+			return promotion.New(
+				promotion.WithSource(po.Source),
+				promotion.WithDestination(po.Destination),
+				promotion.WithSigner(signer),
+				promotion.WithArtifacts(inputs.subjects),
+				promotion.WithVerification(inputs.policyEnvelope, verified),
+			)
+		},
+	})
+}
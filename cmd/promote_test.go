@@ -0,0 +1,138 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/attestation/promotion"
+	"github.com/testifysec/witness/pkg/result"
+)
+
+func TestRunPromote(t *testing.T) {
+	p, funcPriv := makepolicyRSAPub(t)
+	signedPolicy, pub := signPolicyRSA(t, p)
+	workingDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(workingDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	subjects := []string{}
+	attestationPaths := []string{}
+	for _, step := range []struct{ name, command string }{{"step01", "echo 'test01' > test.txt"}, {"step02", "echo 'test02' >> test.txt"}} {
+		attestationPath := filepath.Join(t.TempDir(), step.name+".json")
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:   options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:   workingDir,
+			Attestations: []string{},
+			OutFilePath:  attestationPath,
+			StepName:     step.name,
+		}, []string{"bash", "-c", step.command}, nil))
+
+		attestationPaths = append(attestationPaths, attestationPath)
+		artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(filepath.Join(workingDir, "test.txt"), []crypto.Hash{crypto.SHA256})
+		require.NoError(t, err)
+		for _, digest := range artifactDigest {
+			subjects = append(subjects, digest)
+		}
+	}
+
+	staging := options.VerifyOptions{
+		KeyPath:              policyPubFilePath,
+		PolicyFilePath:       policyFilePath,
+		AttestationFilePaths: attestationPaths,
+		AdditionalSubjects:   subjects,
+	}
+
+	promotionPath := filepath.Join(t.TempDir(), "promotion.json")
+	po := options.PromoteOptions{
+		VerifyOptions: staging,
+		KeyOptions:    options.KeyOptions{KeyPath: funcPrivFilepath},
+		Source:        "registry.example.com/staging/app:v1",
+		Destination:   "registry.example.com/production/app:v1",
+		StepName:      "promote",
+		OutFilePath:   promotionPath,
+	}
+
+	require.NoError(t, runPromote(context.Background(), po))
+	envBytes, err := os.ReadFile(promotionPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(envBytes, &env))
+	require.Contains(t, string(env.Payload), promotion.Type)
+	require.Contains(t, string(env.Payload), "registry.example.com/production/app:v1")
+
+	// a production policy requires the promotion to production on top of the build steps
+	production := policy.Policy{}
+	require.NoError(t, json.Unmarshal(p, &production))
+	functionary := production.Steps["step01"].Functionaries
+	production.Steps["promote"] = policy.Step{
+		Name:          "promote",
+		Functionaries: functionary,
+		Attestations: []policy.Attestation{{
+			Type: promotion.Type,
+			RegoPolicies: []policy.RegoPolicy{{
+				Name:   "production",
+				Module: []byte("package promotion\n\ndeny[msg] {\n\tnot startswith(input.destination, \"registry.example.com/production/\")\n\tmsg := \"not promoted to production\"\n}\n"),
+			}},
+		}},
+	}
+
+	productionBytes, err := json.Marshal(production)
+	require.NoError(t, err)
+	signedProduction, productionPub := signPolicyRSA(t, productionBytes)
+	productionPolicyPath := filepath.Join(workingDir, "signed-production-policy.json")
+	require.NoError(t, os.WriteFile(productionPolicyPath, signedProduction, 0644))
+	productionPubPath := filepath.Join(workingDir, "production-policy-pub.pem")
+	require.NoError(t, os.WriteFile(productionPubPath, productionPub, 0644))
+
+	vo := options.VerifyOptions{
+		KeyPath:              productionPubPath,
+		PolicyFilePath:       productionPolicyPath,
+		AttestationFilePaths: attestationPaths,
+		AdditionalSubjects:   subjects,
+	}
+
+	require.Error(t, runVerify(context.Background(), vo))
+	vo.AttestationFilePaths = append(vo.AttestationFilePaths, promotionPath)
+	require.NoError(t, runVerify(context.Background(), vo))
+
+	// promoting somewhere the policy doesn't allow doesn't satisfy it
+	po.Destination = "registry.example.com/scratch/app:v1"
+	require.NoError(t, runPromote(context.Background(), po))
+	require.Error(t, runVerify(context.Background(), vo))
+
+	// nothing is promoted if the artifact's evidence doesn't satisfy the policy
+	po.VerifyOptions.AttestationFilePaths = attestationPaths[:1]
+	err = runPromote(context.Background(), po)
+	require.Error(t, err)
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(err))
+
+	po.Source = ""
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(runPromote(context.Background(), po)))
+}
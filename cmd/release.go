@@ -0,0 +1,207 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/go-witness/timestamp"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/notify"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/statement"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+func ReleaseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "release",
+		Short:             "Checks releases against policy",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(releaseGateCmd())
+	return cmd
+}
+
+func releaseGateCmd() *cobra.Command {
+	ro := options.ReleaseGateOptions{}
+	cmd := &cobra.Command{
+		Use:   "gate",
+		Short: "Decides whether an artifact can be released",
+		Long: "Collects the evidence of an artifact from the attestation files, store, and Archivista it is given, " +
+			"verifies it against a policy, and signs a SLSA verification summary of the decision whether it passes " +
+			"or fails. The summary is uploaded to Archivista when it is enabled, the outcome is posted to each --notify webhook, and " +
+			"the command exits with code 0 only if the artifact can be released.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runReleaseGate(cmd.Context(), ro)
+		},
+	}
+
+	ro.AddFlags(cmd)
+	return cmd
+}
+
+func runReleaseGate(ctx context.Context, ro options.ReleaseGateOptions) error {
+	signer, err := loadSigner(ctx, ro.KeyOptions)
+	if err != nil {
+		return err
+	}
+
+	if err := checkOutputFormat(ro.OutputFormat); err != nil {
+		return result.Usage(err)
+	}
+
+	auditLog, err := openAuditLog(ctx, ro.VerifyOptions.AuditLog)
+	if err != nil {
+		return err
+	}
+
+	defer auditLog.Close()
+	inputs, err := loadVerifyInputs(ctx, ro.VerifyOptions)
+	if err != nil {
+		return err
+	}
+
+	defer inputs.close()
+	verifiedEvidence, verifyErr := inputs.verify(ctx, ro.VerifyOptions)
+	if verifyErr != nil {
+		verifyErr = result.Policy(fmt.Errorf("failed to verify policy: %w", verifyErr))
+	}
+
+	if err := auditLog.Record(ctx, newDecision("release-gate", inputs.subjects, inputs.policyDigest, verifyErr)); err != nil {
+		if verifyErr == nil {
+			return result.Storage(err)
+		}
+
+		log.Warnf("%v", err)
+	}
+
+	resourceURI := releaseResourceURI(ro, inputs.subjects)
+	signedEnvelope, err := signVSA(ro, resourceURI, inputs, verifiedEvidence, verifyErr, signer)
+	if err != nil {
+		return err
+	}
+
+	out, err := loadOutfile(ro.OutFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open out file: %w", err)
+	}
+
+	defer out.Close()
+	if err := writeSigned(signedEnvelope, out, ro.OutputFormat, ro.BundleOutFilePath); err != nil {
+		return err
+	}
+
+	// the store only holds attestation collections, so the summary is only uploaded to Archivista
+	if err := publish(ctx, "", ro.VerifyOptions.ArchivistaOptions, signedEnvelope); err != nil {
+		return err
+	}
+
+	if len(ro.NotifyURLs) > 0 {
+		n := releaseNotification(resourceURI, inputs, verifyErr)
+		if n.VSADigest, err = verify.EnvelopeDigest(signedEnvelope); err != nil {
+			return err
+		}
+
+		// the gate's decision stands whether or not anyone could be told about it
+		if err := notify.Send(ctx, ro.NotifyURLs, n); err != nil {
+			log.Warnf("%v", err)
+		}
+	}
+
+	if verifyErr != nil {
+		return verifyErr
+	}
+
+	log.Infof("Release gate passed for %v", resourceURI)
+	return nil
+}
+
+// releaseResourceURI is the artifact the gate decides on: the --resource-uri, the image or artifact file being
+// verified, or else its first subject.
+func releaseResourceURI(ro options.ReleaseGateOptions, subjects []cryptoutil.DigestSet) string {
+	switch {
+	case ro.ResourceURI != "":
+		return ro.ResourceURI
+	case ro.VerifyOptions.Image != "":
+		return ro.VerifyOptions.Image
+	case ro.VerifyOptions.ArtifactFilePath != "":
+		return ro.VerifyOptions.ArtifactFilePath
+	}
+
+	for _, subject := range subjects {
+		if digest, ok := subject[cryptoutil.DigestValue{Hash: crypto.SHA256}]; ok {
+			return "sha256:" + digest
+		}
+	}
+
+	return ""
+}
+
+// signVSA signs a verification summary of the gate's decision about the subjects of inputs.
+func signVSA(ro options.ReleaseGateOptions, resourceURI string, inputs verifyInputs, verifiedEvidence map[string][]source.VerifiedCollection, verifyErr error, signer cryptoutil.Signer) (dsse.Envelope, error) {
+	verifier := verify.VSAVerifier{ID: ro.VerifierID, Version: map[string]string{"witness": Version}}
+	vsa, err := verify.NewVSA(verifier, resourceURI, inputs.subjects, ro.VerifyOptions.PolicyFilePath, inputs.policyDigest, verifiedEvidence, ro.VerifiedLevels, verifyErr)
+	if err != nil {
+		return dsse.Envelope{}, fmt.Errorf("failed to create verification summary: %w", err)
+	}
+
+	st, err := vsa.Statement()
+	if err != nil {
+		return dsse.Envelope{}, fmt.Errorf("failed to create verification summary: %w", err)
+	}
+
+	timestampers := []dsse.Timestamper{}
+	for _, url := range ro.TimestampServers {
+		timestampers = append(timestampers, timestamp.NewTimestamper(timestamp.TimestampWithUrl(url)))
+	}
+
+	signedEnvelope, err := statement.SignStatement(st, []cryptoutil.Signer{signer}, timestampers...)
+	if err != nil {
+		return dsse.Envelope{}, result.Signer(fmt.Errorf("failed to sign verification summary: %w", err))
+	}
+
+	return signedEnvelope, nil
+}
+
+func releaseNotification(resourceURI string, inputs verifyInputs, verifyErr error) notify.Notification {
+	decision := newDecision("release-gate", inputs.subjects, inputs.policyDigest, verifyErr)
+	n := notify.Notification{
+		Result:       notify.ResultPassed,
+		Resource:     resourceURI,
+		Subjects:     decision.Subjects,
+		PolicyDigest: inputs.policyDigest,
+	}
+
+	if verifyErr != nil {
+		n.Result = notify.ResultFailed
+		n.Category = decision.Category
+		n.Reason = verifyErr.Error()
+	}
+
+	n.Summarize()
+	return n
+}
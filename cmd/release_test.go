@@ -0,0 +1,133 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/notify"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+func TestRunReleaseGate(t *testing.T) {
+	policy, funcPriv := makepolicyRSAPub(t)
+	signedPolicy, pub := signPolicyRSA(t, policy)
+	workingDir := t.TempDir()
+	storeDir := filepath.Join(t.TempDir(), "store")
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(workingDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	artifactPath := filepath.Join(workingDir, "test.txt")
+	subjects := []string{}
+	for _, step := range []struct{ name, command string }{{"step01", "echo 'test01' > test.txt"}, {"step02", "echo 'test02' >> test.txt"}} {
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:  options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:  workingDir,
+			OutFilePath: filepath.Join(t.TempDir(), step.name+".json"),
+			StepName:    step.name,
+			StoreDir:    storeDir,
+		}, []string{"bash", "-c", step.command}, nil))
+
+		artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(artifactPath, []crypto.Hash{crypto.SHA256})
+		require.NoError(t, err)
+		for _, digest := range artifactDigest {
+			subjects = append(subjects, digest)
+		}
+	}
+
+	notifications := []notify.Notification{}
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := notify.Notification{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&n))
+		notifications = append(notifications, n)
+	}))
+
+	defer webhook.Close()
+	vsaPath := filepath.Join(t.TempDir(), "vsa.json")
+	ro := options.ReleaseGateOptions{
+		VerifyOptions: options.VerifyOptions{
+			KeyPath:            policyPubFilePath,
+			PolicyFilePath:     policyFilePath,
+			AdditionalSubjects: subjects,
+			StoreDir:           storeDir,
+		},
+		KeyOptions:     options.KeyOptions{KeyPath: funcPrivFilepath},
+		VerifierID:     "https://ci.example.com/release-gate",
+		ResourceURI:    "pkg:generic/test.txt",
+		VerifiedLevels: []string{"SLSA_BUILD_LEVEL_2"},
+		OutFilePath:    vsaPath,
+		NotifyURLs:     []string{webhook.URL},
+	}
+
+	readVSA := func() verify.VSA {
+		envBytes, err := os.ReadFile(vsaPath)
+		require.NoError(t, err)
+		env := dsse.Envelope{}
+		require.NoError(t, json.Unmarshal(envBytes, &env))
+		st := intoto.Statement{}
+		require.NoError(t, json.Unmarshal(env.Payload, &st))
+		require.Equal(t, verify.VSAType, st.PredicateType)
+		require.NotEmpty(t, st.Subject)
+		vsa := verify.VSA{}
+		require.NoError(t, json.Unmarshal(st.Predicate, &vsa))
+		return vsa
+	}
+
+	require.NoError(t, runReleaseGate(context.Background(), ro))
+	vsa := readVSA()
+	require.Equal(t, verify.VSAPassed, vsa.VerificationResult)
+	require.Equal(t, "pkg:generic/test.txt", vsa.ResourceURI)
+	require.Equal(t, []string{"SLSA_BUILD_LEVEL_2"}, vsa.VerifiedLevels)
+	require.Len(t, vsa.InputAttestations, 2)
+	require.Len(t, notifications, 1)
+	require.Equal(t, notify.ResultPassed, notifications[0].Result)
+	require.NotEmpty(t, notifications[0].VSADigest)
+
+	// evidence of a different artifact doesn't satisfy the policy, and the failure is still summarized and announced
+	ro.VerifyOptions.AdditionalSubjects = []string{"0000000000000000000000000000000000000000000000000000000000000000"}
+	err := runReleaseGate(context.Background(), ro)
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(err))
+	vsa = readVSA()
+	require.Equal(t, verify.VSAFailed, vsa.VerificationResult)
+	require.Empty(t, vsa.VerifiedLevels)
+	require.Len(t, notifications, 2)
+	require.Equal(t, notify.ResultFailed, notifications[1].Result)
+	require.Equal(t, string(result.CategoryPolicy), notifications[1].Category)
+
+	// a webhook that can't be reached doesn't change the decision
+	ro.VerifyOptions.AdditionalSubjects = subjects
+	ro.NotifyURLs = []string{"http://127.0.0.1:1"}
+	require.NoError(t, runReleaseGate(context.Background(), ro))
+
+	ro.KeyOptions = options.KeyOptions{}
+	require.Error(t, runReleaseGate(context.Background(), ro))
+}
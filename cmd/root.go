@@ -15,12 +15,18 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/dsse"
 	"github.com/testifysec/go-witness/log"
 	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/result"
 )
 
 var (
@@ -39,19 +45,56 @@ func New() *cobra.Command {
 	log.SetLogger(logger)
 
 	ro.AddFlags(cmd)
+	cmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return result.Usage(err)
+	})
+
 	cmd.AddCommand(SignCmd())
+	cmd.AddCommand(CountersignCmd())
 	cmd.AddCommand(VerifyCmd())
+	cmd.AddCommand(VerifySubjectCmd())
+	cmd.AddCommand(CoverageCmd())
+	cmd.AddCommand(AuditLogCmd())
+	cmd.AddCommand(PolicyCmd())
+	cmd.AddCommand(GroupsCmd())
+	cmd.AddCommand(AttachCmd())
+	cmd.AddCommand(PromoteCmd())
+	cmd.AddCommand(DeployCmd())
+	cmd.AddCommand(ReleaseCmd())
+	cmd.AddCommand(TektonCmd())
+	cmd.AddCommand(ExportCmd())
+	cmd.AddCommand(StoreCmd())
+	cmd.AddCommand(DoctorCmd())
+	cmd.AddCommand(CapabilitiesCmd())
+	cmd.AddCommand(UpdateCmd())
+	cmd.AddCommand(ServeCmd())
+	cmd.AddCommand(K8sWebhookCmd())
 	cmd.AddCommand(RunCmd())
+	cmd.AddCommand(AttestCmd())
 	cmd.AddCommand(CompletionCmd())
 	cmd.AddCommand(versionCmd())
 	cobra.OnInitialize(func() { preRoot(cmd, ro, logger) })
 	return cmd
 }
 
+// Execute runs witness and exits with the exit code of the category of any error, so wrappers can tell failures
+// apart without parsing the output.
 func Execute() {
-	if err := New().Execute(); err != nil {
+	cmd, err := New().ExecuteC()
+	if ro.ResultFile != "" {
+		commandPath := ""
+		if cmd != nil {
+			commandPath = cmd.CommandPath()
+		}
+
+		if writeErr := result.New(commandPath, err).Write(ro.ResultFile); writeErr != nil {
+			log.Errorf("failed to write result file: %v", writeErr)
+		}
+	}
+
+	if err != nil {
 		log.Error(err)
-		os.Exit(1)
+		os.Exit(result.ExitCode(err))
 	}
 }
 
@@ -65,6 +108,49 @@ func preRoot(cmd *cobra.Command, ro *options.RootOptions, logger *logrusLogger)
 	}
 }
 
+// writeSigned writes a signed envelope to out in format and, if bundlePath is set, to bundlePath as a Sigstore bundle.
+// Sigstore bundles include tlogEntries.
+func writeSigned(env dsse.Envelope, out io.Writer, format, bundlePath string, tlogEntries ...json.RawMessage) error {
+	encoded, err := bundle.Encode(env, format, tlogEntries...)
+	if err != nil {
+		return fmt.Errorf("failed to encode envelope: %w", err)
+	}
+
+	if _, err := out.Write(encoded); err != nil {
+		return fmt.Errorf("failed to write envelope to out file: %w", err)
+	}
+
+	if bundlePath == "" {
+		return nil
+	}
+
+	encoded, err = bundle.Encode(env, bundle.FormatSigstoreBundle, tlogEntries...)
+	if err != nil {
+		return fmt.Errorf("failed to encode sigstore bundle: %w", err)
+	}
+
+	if err := os.WriteFile(bundlePath, encoded, 0644); err != nil {
+		return fmt.Errorf("failed to write sigstore bundle: %w", err)
+	}
+
+	return nil
+}
+
+// checkOutputFormat fails early on an unknown output format, before anything is signed. An empty format means dsse.
+func checkOutputFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+
+	for _, f := range bundle.Formats {
+		if format == f {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown output format %v, expected one of %v", format, strings.Join(bundle.Formats, ", "))
+}
+
 func loadOutfile(outFilePath string) (*os.File, error) {
 	var err error
 	out := os.Stdout
@@ -16,22 +16,62 @@ package cmd
 
 import (
 	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
-	witness "github.com/testifysec/go-witness"
-	"github.com/testifysec/go-witness/archivista"
 	"github.com/testifysec/go-witness/attestation"
 	"github.com/testifysec/go-witness/attestation/commandrun"
-	"github.com/testifysec/go-witness/attestation/material"
-	"github.com/testifysec/go-witness/attestation/product"
+	"github.com/testifysec/go-witness/cryptoutil"
 	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
 	"github.com/testifysec/go-witness/log"
 	"github.com/testifysec/go-witness/timestamp"
 	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/anonymize"
+	"github.com/testifysec/witness/pkg/archivista"
+	"github.com/testifysec/witness/pkg/attestation/capabilities"
+	"github.com/testifysec/witness/pkg/attestation/cicontext"
+	"github.com/testifysec/witness/pkg/attestation/fetch"
+	"github.com/testifysec/witness/pkg/attestation/material"
+	"github.com/testifysec/witness/pkg/attestation/previousstep"
+	"github.com/testifysec/witness/pkg/attestation/product"
+	"github.com/testifysec/witness/pkg/attestation/runtimeout"
+	"github.com/testifysec/witness/pkg/attestation/slsa"
+	"github.com/testifysec/witness/pkg/attestation/subjectname"
+	"github.com/testifysec/witness/pkg/attestation/subjectsource"
+	"github.com/testifysec/witness/pkg/attestation/tracestatus"
+	"github.com/testifysec/witness/pkg/attestation/upstream"
+	"github.com/testifysec/witness/pkg/attestation/witnessbinary"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/digest"
+	"github.com/testifysec/witness/pkg/eventlog"
+	"github.com/testifysec/witness/pkg/guard"
+	"github.com/testifysec/witness/pkg/predicate"
+	"github.com/testifysec/witness/pkg/profile"
+	"github.com/testifysec/witness/pkg/registry"
+	"github.com/testifysec/witness/pkg/rekor"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/schedule"
+	"github.com/testifysec/witness/pkg/scope"
+	"github.com/testifysec/witness/pkg/statement"
+	"github.com/testifysec/witness/pkg/store"
+	"github.com/testifysec/witness/pkg/supervise"
+	"github.com/testifysec/witness/pkg/verify"
 )
 
+// detectTracing is replaced in tests to simulate hosts that can't trace.
+var detectTracing = tracestatus.Detect
+
 func RunCmd() *cobra.Command {
 	o := options.RunOptions{
 		AttestorOptSetters: make(map[string][]func(attestation.Attestor) (attestation.Attestor, error)),
@@ -43,7 +83,11 @@ func RunCmd() *cobra.Command {
 		SilenceErrors: true,
 		SilenceUsage:  true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runRun(cmd.Context(), o, args)
+			if o.DryRun {
+				return runDryRun(cmd.Context(), o, args, cmd.OutOrStdout())
+			}
+
+			return runRun(cmd.Context(), o, args, nil)
 		},
 		Args: cobra.ArbitraryArgs,
 	}
@@ -52,46 +96,389 @@ func RunCmd() *cobra.Command {
 	return cmd
 }
 
-func runRun(ctx context.Context, ro options.RunOptions, args []string) error {
-	signers, errors := loadSigners(ctx, ro.KeyOptions)
-	if len(errors) > 0 {
-		for _, err := range errors {
-			log.Error(err)
+func runRun(ctx context.Context, ro options.RunOptions, args []string, interrupts <-chan os.Signal) error {
+	signers, err := loadRunSigners(ctx, ro)
+	if err != nil {
+		return err
+	}
+
+	if err := checkRunOutputs(ro, len(signers)); err != nil {
+		return err
+	}
+
+	out, err := loadOutfile(ro.OutFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open out file: %w", err)
+	}
+
+	defer out.Close()
+	rekorKey, err := loadRekorKey(ro.RekorServer, ro.RekorPublicKeyPath)
+	if err != nil {
+		return err
+	}
+
+	// a run whose command was stopped is still written and published, and its error returned after
+	signedEnvelope, runErr := recordRun(ctx, ro, signers, args, interrupts)
+	if runErr != nil && !stopped(runErr) {
+		return runErr
+	}
+
+	// the signed envelope is written even if it can't be logged, without an entry, so the run isn't lost
+	tlogEntries, rekorErr := uploadRekor(ctx, ro.RekorServer, rekorKey, signers, signedEnvelope)
+	if err := writeSigned(signedEnvelope, out, ro.OutputFormat, ro.BundleOutFilePath, tlogEntries...); err != nil {
+		return err
+	}
+
+	if rekorErr != nil {
+		return rekorErr
+	}
+
+	if err := publishRun(ctx, ro, signedEnvelope); err != nil {
+		return err
+	}
+
+	return runErr
+}
+
+// runDryRun resolves the options of a run and writes what it would do to out: the attestors it would run in the
+// order they would run, the signers that would sign, and where the signed envelope would be written and uploaded.
+// Signers are loaded, so ones that can't be are reported, but the command isn't run and nothing is signed, written,
+// or uploaded.
+func runDryRun(ctx context.Context, ro options.RunOptions, args []string, out io.Writer) error {
+	signers, err := loadRunSigners(ctx, ro)
+	if err != nil {
+		return err
+	}
+
+	if err := checkRunOutputs(ro, len(signers)); err != nil {
+		return err
+	}
+
+	if _, err := loadRekorKey(ro.RekorServer, ro.RekorPublicKeyPath); err != nil {
+		return err
+	}
+
+	plan, err := planRun(ctx, ro, args, nil)
+	if err != nil {
+		return err
+	}
+
+	attestors, err := schedule.New(ro.MaxAttestorConcurrency).Apply(plan.attestors)
+	if err != nil {
+		return result.Attestor(fmt.Errorf("failed to schedule attestors: %w", err))
+	}
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "step\t%v\n", plan.stepName)
+	if len(args) > 0 {
+		fmt.Fprintf(sb, "command\t%v\n", strings.Join(args, " "))
+	}
+
+	for _, attestor := range schedule.Order(attestors) {
+		fmt.Fprintf(sb, "attestor\t%v\t%v\n", attestor.Name(), attestor.RunType())
+	}
+
+	for _, signer := range signers {
+		keyID, err := signer.KeyID()
+		if err != nil {
+			return result.Signer(fmt.Errorf("failed to get key id of signer: %w", err))
+		}
+
+		if bundler, ok := signer.(cryptoutil.TrustBundler); ok && bundler.Certificate() != nil {
+			fmt.Fprintf(sb, "signer\t%v\t%v\n", keyID, bundler.Certificate().Subject)
+		} else {
+			fmt.Fprintf(sb, "signer\t%v\n", keyID)
+		}
+	}
+
+	if ro.SignerThreshold > 0 {
+		fmt.Fprintf(sb, "signer-threshold\t%v\n", ro.SignerThreshold)
+	}
+
+	for _, url := range ro.TimestampServers {
+		fmt.Fprintf(sb, "timestamp-server\t%v\n", url)
+	}
+
+	outFile, format := ro.OutFilePath, ro.OutputFormat
+	if outFile == "" {
+		outFile = "stdout"
+	}
+
+	if format == "" {
+		format = bundle.FormatDSSE
+	}
+
+	fmt.Fprintf(sb, "outfile\t%v\t%v\n", outFile, format)
+	outputs := []struct{ name, value string }{
+		{"sigstore-bundle-outfile", ro.BundleOutFilePath},
+		{"slsa-outfile", ro.SLSAOutFilePath},
+		{"event-log", ro.EventLog},
+		{"rekor-server", ro.RekorServer},
+		{"store-dir", ro.StoreDir},
+		{"store-oci", ro.StoreOCI},
+	}
+
+	if ro.ArchivistaOptions.Enable {
+		outputs = append(outputs, struct{ name, value string }{"archivista", ro.ArchivistaOptions.Url})
+	}
+
+	for _, output := range outputs {
+		if output.value != "" {
+			fmt.Fprintf(sb, "%v\t%v\n", output.name, output.value)
 		}
-		return fmt.Errorf("failed to load signers")
+	}
+
+	_, err = io.WriteString(out, sb.String())
+	return err
+}
+
+// checkRunOutputs checks the formats a run's envelope is written in, and the image it is attached to, before its
+// command runs. Sigstore bundles carry a single signature, so they can't hold an envelope signed by more than one
+// signer.
+func checkRunOutputs(ro options.RunOptions, signers int) error {
+	if err := checkOutputFormat(ro.OutputFormat); err != nil {
+		return err
+	}
+
+	if err := checkStoreOCI(ro.StoreOCI); err != nil {
+		return err
+	}
+
+	if signers > 1 && (ro.BundleOutFilePath != "" || ro.OutputFormat == bundle.FormatSigstoreBundle) {
+		return result.Usage(fmt.Errorf("sigstore bundles carry one signature, so they can't be written for an envelope signed by %v signers", signers))
+	}
+
+	return nil
+}
+
+// loadSigner loads the signer of commands that sign with exactly one key, such as sign and deploy. Only run signs
+// with more than one, so configuring several is an error here.
+func loadSigner(ctx context.Context, ko options.KeyOptions) (cryptoutil.Signer, error) {
+	signers, err := loadAllSigners(ctx, ko)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(signers) > 1 {
 		log.Error("only one signer is supported")
-		return fmt.Errorf("only one signer is supported")
+		return nil, result.Signer(fmt.Errorf("only one signer is supported"))
+	}
+
+	return signers[0], nil
+}
+
+// loadAllSigners loads every configured signer, each of which signs the envelope, such as a build key co-signed by
+// an organizational key.
+func loadAllSigners(ctx context.Context, ko options.KeyOptions) ([]cryptoutil.Signer, error) {
+	signers, errors := loadSigners(ctx, ko)
+	if len(errors) > 0 {
+		for _, err := range errors {
+			log.Error(err)
+		}
+		return nil, result.Signer(fmt.Errorf("failed to load signers"))
 	}
 
 	if len(signers) == 0 {
 		log.Error("no signers found")
-		return fmt.Errorf("no signers found")
+		return nil, result.Signer(fmt.Errorf("no signers found"))
 	}
 
-	out, err := loadOutfile(ro.OutFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to open out file: %w", err)
+	return signers, nil
+}
+
+// loadRunSigners loads the signers of a run. When a signer threshold is set, signers that fail to load are skipped as
+// long as enough remain to meet it.
+func loadRunSigners(ctx context.Context, ro options.RunOptions) ([]cryptoutil.Signer, error) {
+	if ro.SignerThreshold <= 0 {
+		return loadAllSigners(ctx, ro.KeyOptions)
+	}
+
+	signers, errors := loadSigners(ctx, ro.KeyOptions)
+	configured := len(signers) + len(errors)
+	if ro.SignerThreshold > configured {
+		return nil, result.Usage(fmt.Errorf("signer threshold of %v is more than the %v configured signers", ro.SignerThreshold, configured))
+	}
+
+	if len(signers) < ro.SignerThreshold {
+		for _, err := range errors {
+			log.Error(err)
+		}
+
+		return nil, result.Signer(fmt.Errorf("%v of %v signers loaded but %v are required", len(signers), configured, ro.SignerThreshold))
+	}
+
+	for _, err := range errors {
+		log.Warnf("skipping signer that failed to load, the threshold can still be met: %v", err)
 	}
 
+	return signers, nil
+}
+
+// runPlan is a run whose options have been resolved: the step it records, the attestors it runs, and how the
+// statement is written and signed.
+type runPlan struct {
+	stepName      string
+	attestors     []attestation.Attestor
+	supervisor    *supervise.Supervisor
+	provenance    *slsa.Attestor
+	attestorGuard *guard.Guard
+	format        statement.Format
+	timestampers  []dsse.Timestamper
+	epoch         time.Time
+}
+
+// planRun resolves the options of a run into the attestors it runs, running args as the step's command if there is
+// one. SIGINT and SIGTERM received while the command runs are forwarded to it so an interrupted run is still recorded,
+// or signals are taken from interrupts if it isn't nil. Material attestations are downloaded and verified, but nothing
+// is run.
+func planRun(ctx context.Context, ro options.RunOptions, args []string, interrupts <-chan os.Signal) (runPlan, error) {
 	timestampers := []dsse.Timestamper{}
 	for _, url := range ro.TimestampServers {
 		timestampers = append(timestampers, timestamp.NewTimestamper(timestamp.TimestampWithUrl(url)))
 	}
 
-	attestors := []attestation.Attestor{product.New(), material.New()}
+	captureProfile, err := profile.Get(ro.CaptureProfile)
+	if err != nil {
+		return runPlan{}, err
+	}
+
+	var epoch time.Time
+	if ro.Deterministic {
+		if len(timestampers) > 0 {
+			return runPlan{}, result.Usage(fmt.Errorf("--deterministic can't be used with --timestamp-servers, since timestamps differ between runs"))
+		}
+
+		if epoch, err = statement.SourceDateEpoch(); err != nil {
+			return runPlan{}, result.Usage(err)
+		}
+	}
+
+	aliases, err := predicate.ParseAliases(ro.PredicateTypes)
+	if err != nil {
+		return runPlan{}, err
+	}
+
+	stepName := ro.StepName
+	var runScope *scope.Scope
+	if ro.ScopePath != "" {
+		s, err := scope.New(ro.ScopePath, ro.ScopeTarget)
+		if err != nil {
+			return runPlan{}, err
+		}
+
+		runScope = &s
+		stepName = s.StepName(stepName)
+	} else if ro.ScopeTarget != "" {
+		return runPlan{}, fmt.Errorf("--scope-target requires --scope-path")
+	}
+
+	binaryOpts := []witnessbinary.Option{}
+	if Version != "dev" {
+		binaryOpts = append(binaryOpts, witnessbinary.WithVersion(Version))
+	}
+
+	if ro.HashWorkers < 0 {
+		return runPlan{}, result.Usage(fmt.Errorf("--hash-workers must not be negative"))
+	}
+
+	if ro.MaxAttestorConcurrency < 0 {
+		return runPlan{}, result.Usage(fmt.Errorf("--max-attestor-concurrency must not be negative"))
+	}
+
+	attestorGuard, err := newAttestorGuard(ro)
+	if err != nil {
+		return runPlan{}, result.Usage(err)
+	}
+
+	format := statement.Format{Version: ro.StatementVersion, Strict: ro.StrictInToto}
+	if format.Version != "" {
+		if _, err := statement.TypeOfVersion(format.Version); err != nil {
+			return runPlan{}, result.Usage(err)
+		}
+	}
+
+	productDigestOpts := []digest.Option{digest.WithWorkers(ro.HashWorkers), digest.WithProgress(hashProgress(product.Name))}
+	materialDigestOpts := []digest.Option{digest.WithWorkers(ro.HashWorkers), digest.WithProgress(hashProgress(material.Name))}
+	attestors := []attestation.Attestor{
+		product.New(product.WithContentTable(ro.DeduplicateDigests), product.WithUnchanged(ro.Existing), product.WithDigestOptions(productDigestOpts...)),
+		material.New(material.WithContentTable(ro.DeduplicateDigests), material.WithDigestOptions(materialDigestOpts...)),
+		witnessbinary.New(binaryOpts...),
+	}
+	// probing for tracing runs a traced process, so hosts are only probed when the step is to be traced
+	tracing := len(args) > 0 && (ro.Tracing || captureProfile.Tracing)
+	if tracing && ro.Deterministic {
+		return runPlan{}, result.Usage(fmt.Errorf("--deterministic can't be used with tracing, since the processes traced differ between runs"))
+	}
+
+	capability := tracestatus.Unprobed
+	if tracing {
+		capability = detectTracing()
+	}
+
 	if len(args) > 0 {
-		attestors = append(attestors, commandrun.New(commandrun.WithCommand(args), commandrun.WithTracing(ro.Tracing)))
+		if tracing {
+			if !capability.Available {
+				if !ro.TraceDegraded {
+					return runPlan{}, fmt.Errorf("tracing was requested but is unavailable: %v. Pass --trace-degraded to run without tracing", strings.Join(capability.Missing, "; "))
+				}
+
+				log.Warnf("tracing is unavailable, running without it: %v", strings.Join(capability.Missing, "; "))
+				tracing = false
+			}
+
+			attestors = append(attestors, tracestatus.New(tracestatus.WithRequested(true), tracestatus.WithCapability(capability)))
+		}
+
+		attestors = append(attestors, commandrun.New(commandrun.WithCommand(args), commandrun.WithTracing(tracing)))
 	}
 
 	addtlAttestors, err := attestation.Attestors(ro.Attestations)
 	if err != nil {
-		return fmt.Errorf("failed to create attestors := %w", err)
+		return runPlan{}, result.Usage(fmt.Errorf("failed to create attestors := %w", err))
 	}
 
 	attestors = append(attestors, addtlAttestors...)
+	// the host's capabilities are recorded with every step, so reviewers can tell evidence the host couldn't record
+	// from evidence that is missing
+	snapshot := capabilities.WithSnapshot(capabilities.Detect(capability))
+	if !hasAttestor(attestors, capabilities.Type) {
+		attestors = append(attestors, capabilities.New())
+	}
+
+	for _, attestor := range attestors {
+		if c, ok := attestor.(*capabilities.Attestor); ok {
+			snapshot(c)
+		}
+	}
+
+	if ro.CIContext && cicontext.Detected() && !hasAttestor(attestors, cicontext.Type) {
+		attestors = append(attestors, cicontext.New())
+	}
+	if len(ro.PreviousEnvelopes) > 0 {
+		attestors = append(attestors, previousstep.New(previousstep.WithEnvelopePaths(ro.PreviousEnvelopes)))
+	}
+
+	if len(ro.MaterialAttestations) > 0 {
+		inputs, err := loadMaterialAttestations(ctx, ro)
+		if err != nil {
+			return runPlan{}, err
+		}
+
+		attestors = append(attestors, upstream.New(upstream.WithInputs(inputs)))
+	}
+
+	if len(ro.SubjectNames) > 0 {
+		attestors = append(attestors, subjectname.New(subjectname.WithNames(ro.SubjectNames)))
+	}
+
+	if len(ro.SubjectFiles) > 0 || len(ro.SubjectCommands) > 0 {
+		attestors = append(attestors, subjectsource.New(subjectsource.WithFiles(ro.SubjectFiles), subjectsource.WithCommands(ro.SubjectCommands)))
+	}
+
+	if ro.SLSAOutFilePath != "" && !hasAttestor(attestors, slsa.Type) {
+		attestors = append(attestors, slsa.New())
+	}
+
 	for _, attestor := range attestors {
 		setters, ok := ro.AttestorOptSetters[attestor.Type()]
 		if !ok {
@@ -101,37 +488,355 @@ func runRun(ctx context.Context, ro options.RunOptions, args []string) error {
 		for _, setter := range setters {
 			attestor, err = setter(attestor)
 			if err != nil {
-				return fmt.Errorf("failed to set attestor option for %v: %w", attestor.Type(), err)
+				return runPlan{}, fmt.Errorf("failed to set attestor option for %v: %w", attestor.Type(), err)
 			}
 		}
 	}
 
-	defer out.Close()
-	result, err := witness.Run(
-		ro.StepName,
-		signers[0],
-		witness.RunWithAttestors(attestors),
-		witness.RunWithAttestationOpts(attestation.WithWorkingDir(ro.WorkingDir)),
-		witness.RunWithTimestampers(timestampers...),
-	)
+	for _, attestor := range attestors {
+		if capture, ok := attestor.(*fetch.Attestor); ok && len(args) > 0 {
+			attestors = capture.Apply(attestors)
+			break
+		}
+	}
+
+	var provenance *slsa.Attestor
+	for _, attestor := range attestors {
+		if p, ok := attestor.(*slsa.Attestor); ok {
+			provenance = p
+			if ro.Deterministic {
+				slsa.WithEpoch(epoch)(provenance)
+			}
+		}
+	}
+
+	attestors = captureProfile.Apply(attestors)
+	if runScope != nil {
+		attestors = runScope.Apply(attestors)
+	}
+
+	attestors = predicate.Apply(attestors, aliases)
+	var supervisor *supervise.Supervisor
+	if len(args) > 0 {
+		opts := []supervise.Option{supervise.WithCommand(args), supervise.WithGracePeriod(ro.GracePeriod), supervise.WithSignals(syscall.SIGINT, syscall.SIGTERM), supervise.WithInterrupts(interrupts)}
+		if ro.MaxRunDuration > 0 {
+			opts = append(opts, supervise.WithDeadline(time.Now().Add(ro.MaxRunDuration)))
+		}
+
+		supervisor = supervise.New(opts...)
+		attestors = supervisor.Apply(attestors)
+		if ro.MaxRunDuration > 0 {
+			attestors = append(attestors, runtimeout.New(runtimeout.WithMaxDuration(ro.MaxRunDuration), runtimeout.WithSupervisor(supervisor)))
+		}
+	}
+
+	if stepName == "" {
+		return runPlan{}, fmt.Errorf("step name is required")
+	}
+
+	return runPlan{
+		stepName:      stepName,
+		attestors:     attestors,
+		supervisor:    supervisor,
+		provenance:    provenance,
+		attestorGuard: attestorGuard,
+		format:        format,
+		timestampers:  timestampers,
+		epoch:         epoch,
+	}, nil
+}
+
+// recordRun runs the attestors planned for a step, running args as the step's command if there is one, and returns
+// the signed collection. Signals are forwarded to the command as described by planRun. If the command was stopped
+// by a signal or at --max-run-duration, the signed collection is returned along with an error wrapping
+// supervise.ErrInterrupted or supervise.ErrTimedOut.
+func recordRun(ctx context.Context, ro options.RunOptions, signers []cryptoutil.Signer, args []string, interrupts <-chan os.Signal) (_ dsse.Envelope, runErr error) {
+	plan, err := planRun(ctx, ro, args, interrupts)
+	if err != nil {
+		return dsse.Envelope{}, err
+	}
+
+	events, err := eventlog.Open(ro.EventLog)
+	if err != nil {
+		return dsse.Envelope{}, result.Usage(err)
+	}
+
+	defer func() {
+		events.RunFinished(plan.stepName, runErr)
+		events.Close()
+	}()
+
+	attestors := plan.attestorGuard.Apply(events.Apply(plan.attestors))
+	if attestors, err = schedule.New(ro.MaxAttestorConcurrency).Apply(attestors); err != nil {
+		return dsse.Envelope{}, result.Attestor(fmt.Errorf("failed to schedule attestors: %w", err))
+	}
+
+	runCtx, err := attestation.NewContext(attestors, attestation.WithWorkingDir(ro.WorkingDir))
+	if err != nil {
+		return dsse.Envelope{}, result.Attestor(fmt.Errorf("failed to create attestation context: %w", err))
+	}
+
+	events.RunStarted(plan.stepName)
+	if err := runCtx.RunAttestors(); err != nil {
+		return dsse.Envelope{}, result.Attestor(fmt.Errorf("failed to run attestors: %w", err))
+	}
+
+	// the statement is built by witness rather than go-witness so identical evidence is signed identically
+	collection := attestation.NewCollection(plan.stepName, plan.attestorGuard.Completed(schedule.Completed(runCtx.CompletedAttestors())))
+	if !ro.RecordTimes {
+		statement.SetTimes(&collection, time.Time{})
+	} else if ro.Deterministic {
+		statement.SetTimes(&collection, plan.epoch)
+	}
+
+	st, err := statement.New(collection)
+	if err != nil {
+		return dsse.Envelope{}, fmt.Errorf("failed to create statement: %w", err)
+	}
+
+	var anonymizer *anonymize.Anonymizer
+	if ro.Anonymize {
+		if anonymizer, err = anonymize.New(ro.WorkingDir, anonymize.WithReplacements(ro.AnonymizeReplacements)); err != nil {
+			return dsse.Envelope{}, fmt.Errorf("failed to anonymize statement: %w", err)
+		}
+
+		if st, err = anonymizer.Statement(st); err != nil {
+			return dsse.Envelope{}, fmt.Errorf("failed to anonymize statement: %w", err)
+		}
+	}
+
+	if st, err = plan.format.Apply(st); err != nil {
+		return dsse.Envelope{}, fmt.Errorf("failed to create statement: %w", err)
+	}
+
+	sign := func(st intoto.Statement) (dsse.Envelope, error) {
+		if ro.SignerThreshold > 0 {
+			return statement.SignStatementThreshold(st, signers, ro.SignerThreshold, plan.timestampers...)
+		}
+
+		return statement.SignStatement(st, signers, plan.timestampers...)
+	}
 
+	signedEnvelope, err := sign(st)
 	if err != nil {
+		return dsse.Envelope{}, result.Signer(fmt.Errorf("failed to sign collection: %w", err))
+	}
+
+	if ro.SLSAOutFilePath != "" {
+		provenanceStatement, err := plan.provenance.Statement()
+		if err != nil {
+			return dsse.Envelope{}, fmt.Errorf("failed to create slsa statement: %w", err)
+		}
+
+		if anonymizer != nil {
+			if provenanceStatement, err = anonymizer.Statement(provenanceStatement); err != nil {
+				return dsse.Envelope{}, fmt.Errorf("failed to anonymize slsa statement: %w", err)
+			}
+		}
+
+		if provenanceStatement, err = plan.format.Apply(provenanceStatement); err != nil {
+			return dsse.Envelope{}, fmt.Errorf("failed to create slsa statement: %w", err)
+		}
+
+		provenanceEnvelope, err := sign(provenanceStatement)
+		if err != nil {
+			return dsse.Envelope{}, result.Signer(fmt.Errorf("failed to sign slsa statement: %w", err))
+		}
+
+		encoded, err := bundle.Encode(provenanceEnvelope, bundle.FormatDSSE)
+		if err != nil {
+			return dsse.Envelope{}, fmt.Errorf("failed to encode slsa envelope: %w", err)
+		}
+
+		if err := os.WriteFile(ro.SLSAOutFilePath, encoded, 0644); err != nil {
+			return dsse.Envelope{}, fmt.Errorf("failed to write slsa envelope: %w", err)
+		}
+	}
+
+	if plan.supervisor != nil && plan.supervisor.Err() != nil {
+		return signedEnvelope, result.Attestor(plan.supervisor.Err())
+	}
+
+	return signedEnvelope, nil
+}
+
+// newAttestorGuard returns the guard that applies the attestor timeouts and failure policy of ro.
+func newAttestorGuard(ro options.RunOptions) (*guard.Guard, error) {
+	opts := []guard.Option{}
+	if ro.AttestorFailurePolicy != "" {
+		policy, err := guard.ParseFailurePolicy(ro.AttestorFailurePolicy)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, guard.WithFailurePolicy(policy))
+	}
+
+	timeouts, err := guard.ParseTimeouts(ro.AttestorTimeouts)
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range timeouts {
+		if name == guard.DefaultTimeout {
+			continue
+		}
+
+		factory, ok := attestation.FactoryByName(name)
+		if !ok {
+			return nil, fmt.Errorf("--attestor-timeout names unknown attestor %v", name)
+		}
+
+		if !guard.CanTimeout(factory()) {
+			return nil, fmt.Errorf("--attestor-timeout can't bound the %v attestor, which can't be stopped once it has started", name)
+		}
+	}
+
+	return guard.New(append(opts, guard.WithTimeouts(timeouts))...), nil
+}
+
+// checkStoreOCI checks the image reference of --store-oci, if it is set, so a run isn't recorded only to fail to be
+// attached.
+func checkStoreOCI(storeOCI string) error {
+	if storeOCI == "" {
+		return nil
+	}
+
+	if _, err := registry.ParseReference(storeOCI); err != nil {
+		return result.Usage(fmt.Errorf("invalid --store-oci: %w", err))
+	}
+
+	return nil
+}
+
+// stopped returns whether err is from a run whose command was stopped, which is still recorded.
+func stopped(err error) bool {
+	return errors.Is(err, supervise.ErrTimedOut) || errors.Is(err, supervise.ErrInterrupted)
+}
+
+// publishRun stores a signed collection in the local store and Archivista if they are enabled, and attaches it to
+// the image of --store-oci if it is set.
+func publishRun(ctx context.Context, ro options.RunOptions, signedEnvelope dsse.Envelope) error {
+	if err := publish(ctx, ro.StoreDir, ro.ArchivistaOptions, signedEnvelope); err != nil {
 		return err
 	}
 
-	signedBytes, err := json.Marshal(&result.SignedEnvelope)
+	if ro.StoreOCI == "" {
+		return nil
+	}
+
+	ref, err := registry.ParseReference(ro.StoreOCI)
+	if err != nil {
+		return result.Usage(err)
+	}
+
+	signedBytes, err := json.Marshal(&signedEnvelope)
 	if err != nil {
 		return fmt.Errorf("failed to marshal envelope: %w", err)
 	}
 
-	if _, err := out.Write(signedBytes); err != nil {
-		return fmt.Errorf("failed to write envelope to out file: %w", err)
+	desc, err := registry.New(registry.WithPlainHTTP(ro.StoreOCIPlainHTTP)).Attach(ctx, ref, signedBytes)
+	if err != nil {
+		return result.Storage(fmt.Errorf("failed to attach envelope to %v: %w", ref, err))
 	}
 
-	if ro.ArchivistaOptions.Enable {
-		archivistaClient := archivista.New(ro.ArchivistaOptions.Url)
-		if gitoid, err := archivistaClient.Store(ctx, result.SignedEnvelope); err != nil {
-			return fmt.Errorf("failed to store artifact in archivist: %w", err)
+	log.Infof("Attached to %v as %v", ref, desc.Digest)
+	return nil
+}
+
+// loadRekorKey reads the public key of a Rekor log from keyPath. It is required when server is set.
+func loadRekorKey(server, keyPath string) (crypto.PublicKey, error) {
+	if keyPath == "" {
+		if server != "" {
+			return nil, result.Usage(errors.New("--rekor-public-key is required with --rekor-server, so entries are checked against the log's key"))
+		}
+
+		return nil, nil
+	}
+
+	keyBytes, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, result.Usage(fmt.Errorf("failed to read rekor public key: %w", err))
+	}
+
+	key, err := rekor.ParsePublicKey(keyBytes)
+	if err != nil {
+		return nil, result.Usage(err)
+	}
+
+	return key, nil
+}
+
+// uploadRekor logs a signed envelope in the Rekor instance at server, if it is set, and returns its entry encoded for
+// Sigstore bundles. The entry must log the envelope and be signed by logKey, and its inclusion proof must verify.
+func uploadRekor(ctx context.Context, server string, logKey crypto.PublicKey, signers []cryptoutil.Signer, signedEnvelope dsse.Envelope) ([]json.RawMessage, error) {
+	if server == "" {
+		return nil, nil
+	}
+
+	// signers that didn't meet a signer threshold have no signature in the envelope to log
+	signed := make(map[string]bool, len(signedEnvelope.Signatures))
+	for _, sig := range signedEnvelope.Signatures {
+		signed[sig.KeyID] = true
+	}
+
+	verifiers := make([]cryptoutil.Verifier, 0, len(signers))
+	for _, signer := range signers {
+		if keyID, err := signer.KeyID(); err == nil && !signed[keyID] {
+			continue
+		}
+
+		verifier, err := signer.Verifier()
+		if err != nil {
+			return nil, result.Signer(fmt.Errorf("failed to get verifier from signer: %w", err))
+		}
+
+		verifiers = append(verifiers, verifier)
+	}
+
+	entry, err := rekor.New(server).Upload(ctx, signedEnvelope, verifiers)
+	if err != nil {
+		return nil, result.Storage(fmt.Errorf("failed to upload envelope to %v: %w", server, err))
+	}
+
+	if err := entry.Verify(signedEnvelope, logKey); err != nil {
+		return nil, result.Storage(fmt.Errorf("invalid rekor entry %v: %w", entry.UUID, err))
+	}
+
+	log.Infof("Logged in %v at index %v with UUID %v", server, entry.LogIndex, entry.UUID)
+	tlogEntry, err := entry.TransparencyLogEntry()
+	if err != nil {
+		return nil, result.Storage(fmt.Errorf("failed to encode rekor entry: %w", err))
+	}
+
+	return []json.RawMessage{tlogEntry}, nil
+}
+
+// publish stores a signed envelope in the local store at storeDir, if it is set, and Archivista if it is enabled.
+func publish(ctx context.Context, storeDir string, ao options.ArchivistaOptions, signedEnvelope dsse.Envelope) error {
+	if storeDir != "" {
+		signedBytes, err := json.Marshal(&signedEnvelope)
+		if err != nil {
+			return fmt.Errorf("failed to marshal envelope: %w", err)
+		}
+
+		entry, err := store.Put(storeDir, signedBytes)
+		if err != nil {
+			return result.Storage(fmt.Errorf("failed to store envelope in %v: %w", storeDir, err))
+		}
+
+		log.Infof("Stored in %v as %v", storeDir, entry.Path)
+	}
+
+	if ao.Enable {
+		archivistaClient, err := newArchivistaClient(ao.Url, ao.ArchivistaClientOptions)
+		if err != nil {
+			return result.Storage(err)
+		}
+
+		defer archivistaClient.Close()
+		if gitoid, err := archivistaClient.Store(ctx, signedEnvelope); err != nil {
+			return result.Storage(fmt.Errorf("failed to store artifact in archivist: %w", err))
 		} else {
 			log.Infof("Stored in archivist as %v\n", gitoid)
 		}
@@ -139,3 +844,93 @@ func runRun(ctx context.Context, ro options.RunOptions, args []string) error {
 
 	return nil
 }
+
+// loadMaterialAttestations reads and verifies the upstream attestations a step consumes. Attestations are read
+// from files, or downloaded from Archivista when given as gitoids.
+func loadMaterialAttestations(ctx context.Context, ro options.RunOptions) ([]upstream.Input, error) {
+	if len(ro.MaterialAttestationKeyPaths) == 0 && len(ro.MaterialAttestationCAPaths) == 0 {
+		return nil, fmt.Errorf("material attestations require trusted keys or ca certificates, provide --material-attestation-key or --material-attestation-ca")
+	}
+
+	trust, err := loadSubjectTrust(options.VerifySubjectOptions{KeyPaths: ro.MaterialAttestationKeyPaths, CAPaths: ro.MaterialAttestationCAPaths})
+	if err != nil {
+		return nil, err
+	}
+
+	var archivistaClient *archivista.Client
+	inputs := make([]upstream.Input, 0, len(ro.MaterialAttestations))
+	for _, ref := range ro.MaterialAttestations {
+		var env dsse.Envelope
+		if _, err := os.Stat(ref); err == nil || !isGitoid(ref) {
+			envelopes, err := loadEnvelopes([]string{ref}, "material attestation")
+			if err != nil {
+				return nil, err
+			}
+
+			env = envelopes[0]
+		} else {
+			if !ro.ArchivistaOptions.Enable {
+				return nil, fmt.Errorf("material attestation %v is a gitoid, which requires --enable-archivista", ref)
+			}
+
+			if archivistaClient == nil {
+				if archivistaClient, err = newArchivistaClient(ro.ArchivistaOptions.Url, ro.ArchivistaOptions.ArchivistaClientOptions); err != nil {
+					return nil, err
+				}
+
+				defer archivistaClient.Close()
+			}
+
+			if env, err = archivistaClient.Download(ctx, ref); err != nil {
+				return nil, result.Storage(fmt.Errorf("failed to download material attestation %v: %w", ref, err))
+			}
+		}
+
+		signers, err := verify.VerifyEnvelope(ctx, env, trust)
+		if err != nil {
+			return nil, result.Policy(fmt.Errorf("material attestation %v: %w", ref, err))
+		}
+
+		inputs = append(inputs, upstream.Input{Reference: ref, Envelope: env, Signers: signers})
+	}
+
+	return inputs, nil
+}
+
+func isGitoid(ref string) bool {
+	if len(ref) != sha256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(ref)
+	return err == nil
+}
+
+// hashProgressInterval is how often the progress of hashing the working directory is logged.
+const hashProgressInterval = 10 * time.Second
+
+// hashProgress logs how much of the working directory the attestor has hashed, at most every hashProgressInterval,
+// so runs that hash large artifacts show they are still going. Hashing that finishes within the interval isn't
+// logged.
+func hashProgress(attestor string) func(digest.Progress) {
+	last, logged := time.Now(), false
+	return func(p digest.Progress) {
+		finished := p.Files == p.TotalFiles
+		if time.Since(last) < hashProgressInterval && !(finished && logged) {
+			return
+		}
+
+		last, logged = time.Now(), true
+		log.Infof("(%v) hashed %v of %v files, %v of %v MiB", attestor, p.Files, p.TotalFiles, p.Bytes>>20, p.TotalBytes>>20)
+	}
+}
+
+func hasAttestor(attestors []attestation.Attestor, attestorType string) bool {
+	for _, attestor := range attestors {
+		if attestor.Type() == attestorType {
+			return true
+		}
+	}
+
+	return false
+}
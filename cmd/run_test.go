@@ -18,18 +18,41 @@ import (
 	"bytes"
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation/commandrun"
 	"github.com/testifysec/go-witness/cryptoutil"
 	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
 	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/attestation/capabilities"
+	"github.com/testifysec/witness/pkg/attestation/runtimeout"
+	"github.com/testifysec/witness/pkg/attestation/slsa"
+	"github.com/testifysec/witness/pkg/attestation/subjectsource"
+	"github.com/testifysec/witness/pkg/attestation/tracestatus"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/eventlog"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/supervise"
 )
 
 func TestRunRSAKeyPair(t *testing.T) {
@@ -55,7 +78,7 @@ func TestRunRSAKeyPair(t *testing.T) {
 		"echo 'test' > test.txt",
 	}
 
-	err := runRun(context.Background(), runOptions, args)
+	err := runRun(context.Background(), runOptions, args, nil)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -71,6 +94,87 @@ func TestRunRSAKeyPair(t *testing.T) {
 	}
 }
 
+func TestRunMultipleSigners(t *testing.T) {
+	buildKey, _ := rsakeypair(t)
+	orgKey, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	attestationPath := filepath.Join(workingDir, "outfile.txt")
+	runOptions := options.RunOptions{
+		KeyOptions:   options.KeyOptions{KeyPath: buildKey.Name(), AdditionalKeyPaths: []string{orgKey.Name()}},
+		WorkingDir:   workingDir,
+		Attestations: []string{},
+		OutFilePath:  attestationPath,
+		StepName:     "teststep",
+	}
+
+	require.NoError(t, runRun(context.Background(), runOptions, []string{"bash", "-c", "echo 'test' > test.txt"}, nil))
+	attestationBytes, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(attestationBytes, &env))
+	require.Len(t, env.Signatures, 2)
+
+	signers, err := loadAllSigners(context.Background(), runOptions.KeyOptions)
+	require.NoError(t, err)
+	for _, signer := range signers {
+		verifier, err := signer.Verifier()
+		require.NoError(t, err)
+		_, err = env.Verify(dsse.VerifyWithVerifiers(verifier))
+		require.NoError(t, err)
+	}
+
+	// other commands still sign with a single signer
+	_, err = loadSigner(context.Background(), runOptions.KeyOptions)
+	require.Equal(t, result.CategorySigner, result.CategoryOf(err))
+
+	// sigstore bundles carry one signature, which is caught before the command runs
+	runOptions.BundleOutFilePath = filepath.Join(workingDir, "bundle.json")
+	err = runRun(context.Background(), runOptions, []string{"bash", "-c", "echo 'test' > bundled.txt"}, nil)
+	require.ErrorContains(t, err, "signed by 2 signers")
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+	require.NoFileExists(t, filepath.Join(workingDir, "bundled.txt"))
+}
+
+func TestLoadSignersPerKey(t *testing.T) {
+	_, errs := loadSigners(context.Background(), options.KeyOptions{TPM: options.TPMOptions{Keys: []string{"0x81010001", "0x81010002"}, CertPaths: []string{"tpm.pem"}}})
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], "1 tpm certificates were given for 2 tpm keys")
+
+	_, errs = loadSigners(context.Background(), options.KeyOptions{PKCS11: options.PKCS11Options{Module: "libsofthsm2.so", KeyLabels: []string{"build", "org"}, KeyIDs: []string{"01"}}})
+	require.Len(t, errs, 1)
+	require.ErrorContains(t, errs[0], "2 key labels and 1 key ids were given")
+}
+
+func TestRunSignerThreshold(t *testing.T) {
+	buildKey, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	attestationPath := filepath.Join(workingDir, "outfile.txt")
+	runOptions := options.RunOptions{
+		KeyOptions:      options.KeyOptions{KeyPath: buildKey.Name(), AdditionalKeyPaths: []string{filepath.Join(workingDir, "missing.pem")}},
+		WorkingDir:      workingDir,
+		Attestations:    []string{},
+		OutFilePath:     attestationPath,
+		StepName:        "teststep",
+		SignerThreshold: 1,
+	}
+
+	// the missing key is skipped, since the build key alone meets the threshold
+	require.NoError(t, runRun(context.Background(), runOptions, []string{"bash", "-c", "echo 'test' > test.txt"}, nil))
+	attestationBytes, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(attestationBytes, &env))
+	require.Len(t, env.Signatures, 1)
+
+	runOptions.SignerThreshold = 2
+	err = runRun(context.Background(), runOptions, []string{"true"}, nil)
+	require.Equal(t, result.CategorySigner, result.CategoryOf(err))
+
+	runOptions.SignerThreshold = 3
+	err = runRun(context.Background(), runOptions, []string{"true"}, nil)
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+}
+
 func Test_runRunRSACA(t *testing.T) {
 	_, intermediates, leafcert, leafkey := fullChain(t)
 	workingDir := t.TempDir()
@@ -102,7 +206,7 @@ func Test_runRunRSACA(t *testing.T) {
 		"echo 'test' > test.txt",
 	}
 
-	err := runRun(context.Background(), runOptions, args)
+	err := runRun(context.Background(), runOptions, args, nil)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -166,3 +270,589 @@ func createTestRSAKey() (cryptoutil.Signer, cryptoutil.Verifier, []byte, []byte,
 
 	return signer, verifier, pemBytes, privKeyBytes, nil
 }
+
+func TestRunDeterministic(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}), 0600))
+
+	workingDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workingDir, "app.tar.gz"), []byte("app"), 0644))
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	outputs := []string{}
+	for i := 0; i < 2; i++ {
+		attestationPath := filepath.Join(t.TempDir(), "outfile.txt")
+		require.NoError(t, runAttest(context.Background(), options.RunOptions{
+			KeyOptions:    options.KeyOptions{KeyPath: keyPath},
+			WorkingDir:    workingDir,
+			Attestations:  []string{},
+			OutFilePath:   attestationPath,
+			StepName:      "package",
+			Deterministic: true,
+			RecordTimes:   true,
+		}, io.Discard))
+
+		attestationBytes, err := os.ReadFile(attestationPath)
+		require.NoError(t, err)
+		outputs = append(outputs, string(attestationBytes))
+	}
+
+	require.Equal(t, outputs[0], outputs[1])
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal([]byte(outputs[0]), &env))
+	require.Contains(t, string(env.Payload), "2023-11-14T22:13:20Z")
+
+	// without --record-times there are no times to pin
+	attestationPath := filepath.Join(t.TempDir(), "outfile.txt")
+	require.NoError(t, runAttest(context.Background(), options.RunOptions{
+		KeyOptions:   options.KeyOptions{KeyPath: keyPath},
+		WorkingDir:   workingDir,
+		Attestations: []string{},
+		OutFilePath:  attestationPath,
+		StepName:     "package",
+	}, io.Discard))
+
+	attestationBytes, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(attestationBytes, &env))
+	require.NotContains(t, string(env.Payload), "starttime")
+	require.NotContains(t, string(env.Payload), "endtime")
+
+	err = runAttest(context.Background(), options.RunOptions{
+		KeyOptions:       options.KeyOptions{KeyPath: keyPath},
+		WorkingDir:       workingDir,
+		OutFilePath:      filepath.Join(t.TempDir(), "outfile.txt"),
+		StepName:         "package",
+		TimestampServers: []string{"http://localhost"},
+		Deterministic:    true,
+	}, io.Discard)
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+}
+
+func TestRunAnonymize(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}), 0600))
+
+	workingDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workingDir, "app.tar.gz"), []byte("app"), 0644))
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	t.Setenv("WITNESS_TEST_BUILD_HOST", "build-07.corp.example.com")
+
+	attestationPath := filepath.Join(t.TempDir(), "outfile.txt")
+	require.NoError(t, runAttest(context.Background(), options.RunOptions{
+		KeyOptions:            options.KeyOptions{KeyPath: keyPath},
+		WorkingDir:            workingDir,
+		Attestations:          []string{"environment"},
+		OutFilePath:           attestationPath,
+		StepName:              "package",
+		Anonymize:             true,
+		AnonymizeReplacements: map[string]string{"corp.example.com": "example.com"},
+	}, io.Discard))
+
+	attestationBytes, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(attestationBytes, &env))
+	payload := string(env.Payload)
+	require.NotContains(t, payload, workingDir)
+	require.NotContains(t, payload, "corp.example.com")
+	require.NotContains(t, payload, `"`+hostname+`"`)
+	require.Contains(t, payload, "REDACTED")
+	require.Contains(t, payload, "app.tar.gz")
+}
+
+func TestRunCaptureProfileMinimal(t *testing.T) {
+	priv, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	attestationPath := filepath.Join(workingDir, "outfile.txt")
+	runOptions := options.RunOptions{
+		KeyOptions:     options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:     workingDir,
+		Attestations:   []string{"environment"},
+		OutFilePath:    attestationPath,
+		StepName:       "teststep",
+		CaptureProfile: "minimal",
+	}
+
+	require.NoError(t, runRun(context.Background(), runOptions, []string{"bash", "-c", "echo $((6*7))secret"}, nil))
+	attestationBytes, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(attestationBytes, &env))
+	require.NotContains(t, string(env.Payload), "42secret")
+	require.NotContains(t, string(env.Payload), `"hostname"`)
+	require.Contains(t, string(env.Payload), commandrun.Type)
+}
+
+func TestRunTraceUnavailable(t *testing.T) {
+	defer func(detect func() tracestatus.Capability) { detectTracing = detect }(detectTracing)
+	detectTracing = func() tracestatus.Capability {
+		return tracestatus.Capability{Missing: []string{"the process does not have CAP_SYS_PTRACE"}}
+	}
+
+	priv, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	attestationPath := filepath.Join(workingDir, "outfile.txt")
+	runOptions := options.RunOptions{
+		KeyOptions:   options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:   workingDir,
+		Attestations: []string{},
+		OutFilePath:  attestationPath,
+		StepName:     "teststep",
+		Tracing:      true,
+	}
+
+	err := runRun(context.Background(), runOptions, []string{"bash", "-c", "true"}, nil)
+	require.ErrorContains(t, err, "CAP_SYS_PTRACE")
+	require.ErrorContains(t, err, "--trace-degraded")
+
+	runOptions.TraceDegraded = true
+	require.NoError(t, runRun(context.Background(), runOptions, []string{"bash", "-c", "true"}, nil))
+	attestationBytes, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(attestationBytes, &env))
+	require.Contains(t, string(env.Payload), tracestatus.Type)
+	require.Contains(t, string(env.Payload), `"degraded":true`)
+	require.Contains(t, string(env.Payload), capabilities.Type)
+	require.Contains(t, string(env.Payload), `"missing":["the process does not have CAP_SYS_PTRACE"],"name":"process-tracing"`)
+}
+
+func TestRunCapabilitiesWithoutTracing(t *testing.T) {
+	defer func(detect func() tracestatus.Capability) { detectTracing = detect }(detectTracing)
+	detectTracing = func() tracestatus.Capability {
+		t.Error("the host was probed for tracing, which wasn't requested")
+		return tracestatus.Capability{}
+	}
+
+	priv, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	attestationPath := filepath.Join(workingDir, "outfile.txt")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:   options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:   workingDir,
+		Attestations: []string{"capabilities"},
+		OutFilePath:  attestationPath,
+		StepName:     "teststep",
+	}, []string{"bash", "-c", "true"}, nil))
+
+	attestationBytes, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(attestationBytes, &env))
+	require.Equal(t, 1, strings.Count(string(env.Payload), `"type":"`+capabilities.Type+`"`))
+	require.Contains(t, string(env.Payload), "wasn't probed")
+	require.NotContains(t, string(env.Payload), tracestatus.Type)
+}
+
+func TestRunErrorCategories(t *testing.T) {
+	workingDir := t.TempDir()
+	runOptions := options.RunOptions{
+		KeyOptions:   options.KeyOptions{KeyPath: filepath.Join(workingDir, "missing.pem")},
+		WorkingDir:   workingDir,
+		Attestations: []string{},
+		OutFilePath:  filepath.Join(workingDir, "outfile.txt"),
+		StepName:     "teststep",
+	}
+
+	err := runRun(context.Background(), runOptions, []string{"bash", "-c", "true"}, nil)
+	require.Equal(t, result.CategorySigner, result.CategoryOf(err))
+
+	priv, _ := rsakeypair(t)
+	runOptions.KeyOptions.KeyPath = priv.Name()
+	err = runRun(context.Background(), runOptions, []string{"bash", "-c", "exit 1"}, nil)
+	require.Equal(t, result.CategoryAttestor, result.CategoryOf(err))
+	require.Equal(t, 4, result.ExitCode(err))
+
+	runOptions.HashWorkers = -1
+	err = runRun(context.Background(), runOptions, []string{"bash", "-c", "true"}, nil)
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+
+	runOptions.HashWorkers = 0
+	runOptions.MaxAttestorConcurrency = -1
+	err = runRun(context.Background(), runOptions, []string{"bash", "-c", "true"}, nil)
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+
+	runOptions.MaxAttestorConcurrency = 0
+	runOptions.AttestorFailurePolicy = "ignore"
+	err = runRun(context.Background(), runOptions, []string{"bash", "-c", "true"}, nil)
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+
+	runOptions.AttestorFailurePolicy = "warn"
+	runOptions.AttestorTimeouts = map[string]string{"imds": "5s"}
+	err = runRun(context.Background(), runOptions, []string{"bash", "-c", "true"}, nil)
+	require.ErrorContains(t, err, "unknown attestor imds")
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+
+	// an attestor that reads what the step recorded can't be abandoned, and can only be bounded if it can be stopped
+	runOptions.AttestorTimeouts = map[string]string{"slsa": "5s"}
+	err = runRun(context.Background(), runOptions, []string{"bash", "-c", "true"}, nil)
+	require.ErrorContains(t, err, "can't bound the slsa attestor")
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+
+	// a failing command fails the run whatever the attestor failure policy is
+	runOptions.AttestorTimeouts = map[string]string{"default": "1m", "environment": "5s"}
+	err = runRun(context.Background(), runOptions, []string{"bash", "-c", "exit 1"}, nil)
+	require.Equal(t, result.CategoryAttestor, result.CategoryOf(err))
+
+	// an image the envelope can't be attached to is caught before the command runs
+	runOptions.AttestorTimeouts = nil
+	runOptions.StoreOCI = "ghcr.io/org/app@md5:abcd"
+	err = runRun(context.Background(), runOptions, []string{"bash", "-c", "echo 'test' > attached.txt"}, nil)
+	require.ErrorContains(t, err, "invalid --store-oci")
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+	require.NoFileExists(t, filepath.Join(workingDir, "attached.txt"))
+}
+
+func TestRunRekorUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	workingDir := t.TempDir()
+	priv, _ := rsakeypair(t)
+	runOptions := options.RunOptions{
+		KeyOptions:   options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:   workingDir,
+		Attestations: []string{},
+		OutFilePath:  filepath.Join(workingDir, "outfile.txt"),
+		StepName:     "teststep",
+		RekorServer:  server.URL,
+	}
+
+	// entries can't be checked without the log's key
+	err := runRun(context.Background(), runOptions, []string{"bash", "-c", "true"}, nil)
+	require.ErrorContains(t, err, "--rekor-public-key is required")
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&logKey.PublicKey)
+	require.NoError(t, err)
+	runOptions.RekorPublicKeyPath = filepath.Join(workingDir, "rekor.pub")
+	require.NoError(t, os.WriteFile(runOptions.RekorPublicKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+
+	// the signed envelope is still written when the log can't be reached
+	err = runRun(context.Background(), runOptions, []string{"bash", "-c", "true"}, nil)
+	require.Equal(t, result.CategoryStorage, result.CategoryOf(err))
+	written, err := os.ReadFile(runOptions.OutFilePath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(written, &env))
+	require.Len(t, env.Signatures, 1)
+}
+
+func TestRunMaxRunDuration(t *testing.T) {
+	priv, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	attestationPath := filepath.Join(workingDir, "outfile.txt")
+	runOptions := options.RunOptions{
+		KeyOptions:     options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:     workingDir,
+		Attestations:   []string{},
+		OutFilePath:    attestationPath,
+		StepName:       "teststep",
+		MaxRunDuration: 200 * time.Millisecond,
+	}
+
+	err := runRun(context.Background(), runOptions, []string{"bash", "-c", "sleep 30; echo done"}, nil)
+	require.ErrorIs(t, err, supervise.ErrTimedOut)
+	require.Equal(t, result.CategoryAttestor, result.CategoryOf(err))
+	attestationBytes, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(attestationBytes, &env))
+	require.Contains(t, string(env.Payload), runtimeout.Type)
+	require.Contains(t, string(env.Payload), `"timedout":true`)
+	require.Contains(t, string(env.Payload), `"signal":"terminated"`)
+}
+
+func TestRunInterrupted(t *testing.T) {
+	priv, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	attestationPath := filepath.Join(workingDir, "outfile.txt")
+	runOptions := options.RunOptions{
+		KeyOptions:   options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:   workingDir,
+		Attestations: []string{},
+		OutFilePath:  attestationPath,
+		StepName:     "teststep",
+		GracePeriod:  time.Second,
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	interrupts <- syscall.SIGTERM
+	err := runRun(context.Background(), runOptions, []string{"bash", "-c", "sleep 30; echo done"}, interrupts)
+	require.ErrorIs(t, err, supervise.ErrInterrupted)
+	attestationBytes, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(attestationBytes, &env))
+	require.Contains(t, string(env.Payload), `"termination":{"reason":"signal","received":"terminated"`)
+	require.NotContains(t, string(env.Payload), runtimeout.Type)
+}
+
+func TestRunMaterialAttestation(t *testing.T) {
+	priv, pub := rsakeypair(t)
+	otherPriv, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	upstreamPath := filepath.Join(t.TempDir(), "build.json")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:  options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:  workingDir,
+		OutFilePath: upstreamPath,
+		StepName:    "build",
+	}, []string{"bash", "-c", "echo 'release' > app.txt"}, nil))
+
+	untrustedPath := filepath.Join(t.TempDir(), "untrusted.json")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:  options.KeyOptions{KeyPath: otherPriv.Name()},
+		WorkingDir:  workingDir,
+		OutFilePath: untrustedPath,
+		StepName:    "build",
+	}, []string{"bash", "-c", "echo 'release' > other.txt"}, nil))
+
+	runOptions := func(attestationPath, outPath string) options.RunOptions {
+		return options.RunOptions{
+			KeyOptions:                  options.KeyOptions{KeyPath: priv.Name()},
+			WorkingDir:                  workingDir,
+			OutFilePath:                 outPath,
+			StepName:                    "package",
+			MaterialAttestations:        []string{attestationPath},
+			MaterialAttestationKeyPaths: []string{pub.Name()},
+		}
+	}
+
+	packagePath := filepath.Join(t.TempDir(), "package.json")
+	require.NoError(t, runRun(context.Background(), runOptions(upstreamPath, packagePath), []string{"bash", "-c", "cat app.txt > /dev/null"}, nil))
+	envBytes, err := os.ReadFile(packagePath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(envBytes, &env))
+	require.Contains(t, string(env.Payload), "https://witness.dev/attestations/upstream/v0.1")
+
+	require.ErrorContains(t, runRun(context.Background(), runOptions(untrustedPath, filepath.Join(t.TempDir(), "untrusted-package.json")), []string{"true"}, nil), "signature did not verify")
+
+	require.NoError(t, os.WriteFile(filepath.Join(workingDir, "app.txt"), []byte("tampered"), 0644))
+	require.ErrorContains(t, runRun(context.Background(), runOptions(upstreamPath, filepath.Join(t.TempDir(), "tampered-package.json")), []string{"true"}, nil), "does not match the digest recorded upstream")
+}
+
+func TestRunScopePath(t *testing.T) {
+	priv, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	for _, dir := range []string{"services/foo", "services/bar"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(workingDir, dir), 0755))
+	}
+
+	attestationPath := filepath.Join(t.TempDir(), "attestation.json")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:  options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:  workingDir,
+		OutFilePath: attestationPath,
+		StepName:    "build",
+		ScopePath:   "services/foo",
+	}, []string{"bash", "-c", "echo foo > services/foo/app && echo bar > services/bar/app"}, nil))
+
+	attestationBytes, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(attestationBytes, &env))
+	statement := struct {
+		Subject []struct {
+			Name string `json:"name"`
+		} `json:"subject"`
+		Predicate struct {
+			Name string `json:"name"`
+		} `json:"predicate"`
+	}{}
+
+	require.NoError(t, json.Unmarshal(env.Payload, &statement))
+	require.Equal(t, "build-services-foo", statement.Predicate.Name)
+	subjects := []string{}
+	for _, subject := range statement.Subject {
+		subjects = append(subjects, subject.Name)
+	}
+
+	require.Contains(t, subjects, "https://witness.dev/attestations/product/v0.1/file:services/foo/app")
+	require.NotContains(t, subjects, "https://witness.dev/attestations/product/v0.1/file:services/bar/app")
+
+	require.Error(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions: options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir: workingDir,
+		StepName:   "build",
+		ScopePath:  "../elsewhere",
+	}, []string{"true"}, nil))
+}
+
+func TestRunEventLog(t *testing.T) {
+	priv, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	eventLogPath := filepath.Join(t.TempDir(), "events.jsonl")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:  options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:  workingDir,
+		OutFilePath: filepath.Join(t.TempDir(), "step.json"),
+		StepName:    "teststep",
+		EventLog:    eventLogPath,
+	}, []string{"bash", "-c", "echo 'test' > test.txt"}, nil))
+
+	data, err := os.ReadFile(eventLogPath)
+	require.NoError(t, err)
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	first, last := eventlog.Event{}, eventlog.Event{}
+	require.NoError(t, json.Unmarshal(lines[0], &first))
+	require.NoError(t, json.Unmarshal(lines[len(lines)-1], &last))
+	require.Equal(t, eventlog.TypeRunStarted, first.Type)
+	require.Equal(t, eventlog.TypeRunFinished, last.Type)
+	require.Equal(t, "teststep", last.Step)
+	require.Empty(t, last.Error)
+}
+
+func TestRunSLSAOutfile(t *testing.T) {
+	priv, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	slsaPath := filepath.Join(t.TempDir(), "provenance.json")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:      options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:      workingDir,
+		OutFilePath:     filepath.Join(t.TempDir(), "step.json"),
+		StepName:        "teststep",
+		SLSAOutFilePath: slsaPath,
+	}, []string{"bash", "-c", "echo 'test' > test.txt"}, nil))
+
+	data, err := os.ReadFile(slsaPath)
+	require.NoError(t, err)
+	envelope := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(data, &envelope))
+	require.Len(t, envelope.Signatures, 1)
+	st := intoto.Statement{}
+	require.NoError(t, json.Unmarshal(envelope.Payload, &st))
+	require.Equal(t, slsa.Type, st.PredicateType)
+	require.Len(t, st.Subject, 1)
+	require.Equal(t, "test.txt", st.Subject[0].Name)
+}
+
+func TestRunMaxAttestorConcurrency(t *testing.T) {
+	priv, _ := rsakeypair(t)
+	types := map[int][]string{}
+	for _, concurrency := range []int{1, 4} {
+		outPath := filepath.Join(t.TempDir(), "step.json")
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:             options.KeyOptions{KeyPath: priv.Name()},
+			WorkingDir:             t.TempDir(),
+			OutFilePath:            outPath,
+			StepName:               "teststep",
+			SLSAOutFilePath:        filepath.Join(t.TempDir(), "provenance.json"),
+			MaxAttestorConcurrency: concurrency,
+			RecordTimes:            true,
+		}, []string{"bash", "-c", "echo 'test' > test.txt"}, nil))
+
+		data, err := os.ReadFile(outPath)
+		require.NoError(t, err)
+		envelope := dsse.Envelope{}
+		require.NoError(t, json.Unmarshal(data, &envelope))
+		st := intoto.Statement{}
+		require.NoError(t, json.Unmarshal(envelope.Payload, &st))
+		collection := struct {
+			Attestations []struct {
+				Type      string    `json:"type"`
+				StartTime time.Time `json:"starttime"`
+			} `json:"attestations"`
+		}{}
+		require.NoError(t, json.Unmarshal(st.Predicate, &collection))
+		for _, a := range collection.Attestations {
+			require.False(t, a.StartTime.IsZero())
+			types[concurrency] = append(types[concurrency], a.Type)
+		}
+	}
+
+	// attestors of the same run type may finish in any order, but the same evidence is recorded
+	require.ElementsMatch(t, types[1], types[4])
+}
+
+func TestRunDryRun(t *testing.T) {
+	priv, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	outPath := filepath.Join(t.TempDir(), "step.json")
+	storeDir := filepath.Join(t.TempDir(), "store")
+	out := &bytes.Buffer{}
+	require.NoError(t, runDryRun(context.Background(), options.RunOptions{
+		KeyOptions:   options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:   workingDir,
+		OutFilePath:  outPath,
+		OutputFormat: bundle.FormatDSSECBOR,
+		StepName:     "teststep",
+		Attestations: []string{"environment"},
+		StoreDir:     storeDir,
+	}, []string{"bash", "-c", "echo 'test' > test.txt"}, out))
+
+	plan := out.String()
+	require.Contains(t, plan, "step\tteststep\n")
+	require.Contains(t, plan, "command\tbash -c echo 'test' > test.txt\n")
+	require.Contains(t, plan, "outfile\t"+outPath+"\tdsse-cbor\n")
+	require.Contains(t, plan, "store-dir\t"+storeDir+"\n")
+	require.Contains(t, plan, "signer\t")
+	require.Less(t, strings.Index(plan, "attestor\tenvironment\tprematerial"), strings.Index(plan, "attestor\tcommand-run\texecute"))
+	require.Less(t, strings.Index(plan, "attestor\tcommand-run\texecute"), strings.Index(plan, "attestor\tproduct\tproduct"))
+
+	// nothing is run or written
+	require.NoFileExists(t, filepath.Join(workingDir, "test.txt"))
+	require.NoFileExists(t, outPath)
+	require.NoDirExists(t, storeDir)
+
+	err := runDryRun(context.Background(), options.RunOptions{
+		KeyOptions: options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir: workingDir,
+	}, []string{"true"}, io.Discard)
+	require.ErrorContains(t, err, "step name is required")
+}
+
+func TestRunSubjectSources(t *testing.T) {
+	priv, _ := rsakeypair(t)
+	workingDir := t.TempDir()
+	imageDigest := strings.Repeat("a", 64)
+	subjectFile := filepath.Join(t.TempDir(), "subjects.txt")
+	require.NoError(t, os.WriteFile(subjectFile, []byte("# pushed by the build tool\nghcr.io/org/app=sha256:"+imageDigest+"\n"), 0644))
+
+	attestationPath := filepath.Join(t.TempDir(), "attestation.json")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:      options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:      workingDir,
+		OutFilePath:     attestationPath,
+		StepName:        "build",
+		SubjectFiles:    []string{subjectFile},
+		SubjectCommands: []string{"echo \"release.tar.gz=$(sha256sum < digest-input | cut -d' ' -f1)\""},
+	}, []string{"bash", "-c", "echo release > digest-input"}, nil))
+
+	attestationBytes, err := os.ReadFile(attestationPath)
+	require.NoError(t, err)
+	env := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(attestationBytes, &env))
+	st := intoto.Statement{}
+	require.NoError(t, json.Unmarshal(env.Payload, &st))
+	subjects := map[string]string{}
+	for _, subject := range st.Subject {
+		subjects[subject.Name] = subject.Digest["sha256"]
+	}
+
+	releaseDigest := sha256.Sum256([]byte("release\n"))
+	require.Equal(t, imageDigest, subjects[subjectsource.Type+"/external:ghcr.io/org/app"])
+	require.Equal(t, hex.EncodeToString(releaseDigest[:]), subjects[subjectsource.Type+"/external:release.tar.gz"])
+
+	require.ErrorContains(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:      options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir:      workingDir,
+		OutFilePath:     attestationPath,
+		StepName:        "build",
+		SubjectCommands: []string{"exit 3"},
+	}, []string{"true"}, nil), `failed to read subjects from output of "exit 3"`)
+}
@@ -0,0 +1,337 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/attestation/fetch"
+	"github.com/testifysec/witness/pkg/metrics"
+	"github.com/testifysec/witness/pkg/relay"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/runner"
+)
+
+func ServeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Runs long lived witness services",
+		Long: "Runs long lived witness services. With --metrics-listen, each service serves Prometheus metrics at /metrics on a " +
+			"separate address: witness_runs_total and witness_run_duration_seconds for serve run, witness_cache_requests_total " +
+			"and witness_upstream_requests_total for serve relay, and Go runtime and process metrics for both. Failures are " +
+			"labeled with the category of the error, which matches the exit code categories of the CLI",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(serveRelayCmd())
+	cmd.AddCommand(serveRunCmd())
+	return cmd
+}
+
+func serveRelayCmd() *cobra.Command {
+	ro := options.RelayOptions{}
+	cmd := &cobra.Command{
+		Use:   "relay",
+		Short: "Relays and caches timestamp authority, Fulcio, and Rekor requests for build jobs",
+		Long: "Runs a relay that build jobs send their timestamp authority, Fulcio, and Rekor requests to, so jobs don't need " +
+			"to reach those services directly and the relay is the single point of egress to them. Point --timestamp-servers " +
+			"at https://<relay>/tsa and --fulcio at https://<relay>. Successful GET responses are cached. The relay only " +
+			"serves without TLS on loopback addresses, as build jobs send OIDC tokens to Fulcio through it",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return runServeRelay(ctx, ro)
+		},
+	}
+
+	ro.AddFlags(cmd)
+	return cmd
+}
+
+func runServeRelay(ctx context.Context, ro options.RelayOptions) error {
+	if (ro.TLSCertPath == "") != (ro.TLSKeyPath == "") {
+		return result.Usage(errors.New("--tls-cert and --tls-key must be given together"))
+	}
+
+	if ro.TLSCertPath == "" && !loopback(ro.Listen) {
+		return result.Usage(fmt.Errorf("--tls-cert and --tls-key are required to listen on %v, build jobs send OIDC tokens to Fulcio through the relay", ro.Listen))
+	}
+
+	m, err := serveMetrics(ctx, ro.MetricsListen)
+	if err != nil {
+		return err
+	}
+
+	r, err := newRelay(ro, m)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Relaying on %v", ro.Listen)
+	if ro.TLSCertPath != "" {
+		return r.ListenAndServeTLS(ctx, ro.Listen, ro.TLSCertPath, ro.TLSKeyPath)
+	}
+
+	return r.ListenAndServe(ctx, ro.Listen)
+}
+
+// loopback reports whether addr only accepts connections from this host.
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	return loopbackHost(host)
+}
+
+// loopbackHost reports whether host is localhost or a loopback address.
+func loopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func newRelay(ro options.RelayOptions, m *metrics.Metrics) (*relay.Relay, error) {
+	opts := []relay.Option{relay.WithCache(ro.CacheTTL, ro.CacheEntries), relay.WithMetrics(m)}
+	for _, upstream := range []struct {
+		flag   string
+		rawURL string
+		option func(*url.URL) relay.Option
+	}{
+		{"--tsa-url", ro.TSAURL, relay.WithTSA},
+		{"--fulcio-url", ro.FulcioURL, relay.WithFulcio},
+		{"--rekor-url", ro.RekorURL, relay.WithRekor},
+	} {
+		if upstream.rawURL == "" {
+			continue
+		}
+
+		u, err := url.Parse(upstream.rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%v must be an http or https url: %v", upstream.flag, upstream.rawURL)
+		}
+
+		opts = append(opts, upstream.option(u))
+	}
+
+	return relay.New(opts...)
+}
+
+func serveRunCmd() *cobra.Command {
+	so := options.ServeRunOptions{
+		RunOptions: options.RunOptions{
+			AttestorOptSetters: make(map[string][]func(attestation.Attestor) (attestation.Attestor, error)),
+		},
+	}
+
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Serves a gRPC API that records attestations for other processes",
+		Long: "Serves the witness.Runner gRPC API, described by pkg/runner/runner.proto, on a Unix socket. Build systems call Run " +
+			"with a step name and optionally a command and working directory, and receive the signed envelope back instead of running " +
+			"witness run and parsing its output. The run flags apply to every request",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return runServeRun(ctx, so)
+		},
+	}
+
+	so.AddFlags(cmd)
+	return cmd
+}
+
+func runServeRun(ctx context.Context, so options.ServeRunOptions) error {
+	if so.RunOptions.OutFilePath != "" || so.RunOptions.BundleOutFilePath != "" || so.RunOptions.SLSAOutFilePath != "" {
+		return fmt.Errorf("--outfile, --sigstore-bundle-outfile, and --slsa-outfile can't be used with serve run, envelopes are returned to the caller")
+	}
+
+	if so.RunOptions.DryRun {
+		return fmt.Errorf("--dry-run can't be used with serve run, run witness run --dry-run with the same flags instead")
+	}
+
+	if err := checkStoreOCI(so.RunOptions.StoreOCI); err != nil {
+		return err
+	}
+
+	rekorKey, err := loadRekorKey(so.RunOptions.RekorServer, so.RunOptions.RekorPublicKeyPath)
+	if err != nil {
+		return err
+	}
+
+	var listener net.Listener
+	if so.Listen != "" {
+		listener, err = net.Listen("tcp", so.Listen)
+	} else {
+		listener, err = runner.ListenUnix(so.Socket)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	m, err := serveMetrics(ctx, so.MetricsListen)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	server := runner.NewServer(newServeRunFunc(so.RunOptions, rekorKey, m))
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	log.Infof("Serving runs on %v", listener.Addr())
+	return server.Serve(listener)
+}
+
+// newServeRunFunc returns the function serve run records requests with. Runs in the same working directory are
+// recorded one at a time, since the material and product attestors of concurrent runs would see each other's files.
+// Runs that capture fetches are recorded while no other run is, since on Windows the fetch attestor points the
+// process environment at its capture proxy and every command started meanwhile would inherit it.
+func newServeRunFunc(base options.RunOptions, rekorKey crypto.PublicKey, m *metrics.Metrics) runner.RunFunc {
+	var mu sync.Mutex
+	var envLock sync.RWMutex
+	dirLocks := make(map[string]*sync.Mutex)
+	return func(ctx context.Context, req *runner.RunRequest) (env dsse.Envelope, err error) {
+		start := time.Now()
+		defer func() {
+			m.ObserveRun(start, err)
+		}()
+
+		ro := base
+		ro.StepName = req.Step
+		if len(req.Attestations) > 0 {
+			ro.Attestations = req.Attestations
+		}
+
+		if req.WorkingDir != "" {
+			ro.WorkingDir = req.WorkingDir
+			if !filepath.IsAbs(ro.WorkingDir) {
+				ro.WorkingDir = filepath.Join(base.WorkingDir, req.WorkingDir)
+			}
+		}
+
+		dir, err := filepath.Abs(ro.WorkingDir)
+		if err != nil {
+			return dsse.Envelope{}, err
+		}
+
+		mu.Lock()
+		dirLock, ok := dirLocks[dir]
+		if !ok {
+			dirLock = &sync.Mutex{}
+			dirLocks[dir] = dirLock
+		}
+
+		mu.Unlock()
+		dirLock.Lock()
+		defer dirLock.Unlock()
+		if len(req.Command) > 0 && capturesFetches(ro.Attestations) {
+			envLock.Lock()
+			defer envLock.Unlock()
+		} else {
+			envLock.RLock()
+			defer envLock.RUnlock()
+		}
+
+		signers, err := loadRunSigners(ctx, ro)
+		if err != nil {
+			return dsse.Envelope{}, err
+		}
+
+		env, runErr := recordRun(ctx, ro, signers, req.Command, nil)
+		if runErr != nil && !stopped(runErr) {
+			return dsse.Envelope{}, runErr
+		}
+
+		if _, err := uploadRekor(ctx, ro.RekorServer, rekorKey, signers, env); err != nil {
+			return dsse.Envelope{}, err
+		}
+
+		if err := publishRun(ctx, ro, env); err != nil {
+			return dsse.Envelope{}, err
+		}
+
+		if runErr != nil {
+			return dsse.Envelope{}, runErr
+		}
+
+		log.Infof("Recorded step %v in %v", req.Step, dir)
+		return env, nil
+	}
+}
+
+// capturesFetches reports whether attestations, given by name or type, include the fetch attestor.
+func capturesFetches(attestations []string) bool {
+	for _, nameOrType := range attestations {
+		if nameOrType == fetch.Name || nameOrType == fetch.Type {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serveMetrics serves Prometheus metrics on addr until ctx is done, returning the metrics for the server to record
+// in. It returns nil metrics if addr is empty.
+func serveMetrics(ctx context.Context, addr string) (*metrics.Metrics, error) {
+	if addr == "" {
+		return nil, nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics: %w", err)
+	}
+
+	m := metrics.New()
+	go func() {
+		if err := m.Serve(ctx, listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("failed to serve metrics: %v", err)
+		}
+	}()
+
+	log.Infof("Serving metrics on %v%v", listener.Addr(), metrics.Path)
+	return m, nil
+}
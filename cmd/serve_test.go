@@ -0,0 +1,84 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/attestation/product"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/attestation/fetch"
+	"github.com/testifysec/witness/pkg/metrics"
+	"github.com/testifysec/witness/pkg/runner"
+)
+
+func TestServeRun(t *testing.T) {
+	priv, _ := rsakeypair(t)
+	baseDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(baseDir, "app"), 0755))
+	m := metrics.New()
+	run := newServeRunFunc(options.RunOptions{
+		KeyOptions: options.KeyOptions{KeyPath: priv.Name()},
+		WorkingDir: baseDir,
+		StoreDir:   filepath.Join(t.TempDir(), "store"),
+	}, nil, m)
+
+	env, err := run(context.Background(), &runner.RunRequest{Step: "build", Command: []string{"bash", "-c", "echo built > out.txt"}, WorkingDir: "app"})
+	require.NoError(t, err)
+	require.Contains(t, string(env.Payload), commandrun.Type)
+	require.Contains(t, string(env.Payload), product.Type)
+	require.FileExists(t, filepath.Join(baseDir, "app", "out.txt"))
+
+	// without a command only the files are recorded
+	env, err = run(context.Background(), &runner.RunRequest{Step: "package", WorkingDir: "app"})
+	require.NoError(t, err)
+	require.NotContains(t, string(env.Payload), commandrun.Type)
+
+	_, err = run(context.Background(), &runner.RunRequest{Step: "build", Command: []string{"false"}, WorkingDir: "app"})
+	require.Error(t, err)
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", metrics.Path, nil))
+	require.Contains(t, recorder.Body.String(), `witness_runs_total{reason="",result="success"} 2`)
+	require.Contains(t, recorder.Body.String(), `witness_runs_total{reason="attestor",result="failure"} 1`)
+
+	require.True(t, capturesFetches([]string{"git", fetch.Name}))
+	require.True(t, capturesFetches([]string{fetch.Type}))
+	require.False(t, capturesFetches([]string{"git"}))
+
+	require.Error(t, runServeRun(context.Background(), options.ServeRunOptions{RunOptions: options.RunOptions{OutFilePath: "out.json"}}))
+}
+
+func TestServeRelayRequiresTLS(t *testing.T) {
+	err := runServeRelay(context.Background(), options.RelayOptions{Listen: ":8080", TSAURL: "https://tsa.example.com"})
+	require.ErrorContains(t, err, "--tls-cert and --tls-key are required to listen on :8080")
+
+	err = runServeRelay(context.Background(), options.RelayOptions{Listen: "0.0.0.0:8080", TSAURL: "https://tsa.example.com", TLSCertPath: "relay.pem"})
+	require.ErrorContains(t, err, "must be given together")
+
+	for _, addr := range []string{"localhost:8080", "127.0.0.1:0", "[::1]:8080"} {
+		require.True(t, loopback(addr), addr)
+	}
+
+	for _, addr := range []string{":8080", "0.0.0.0:8080", "relay.example.com:8080", "localhost"} {
+		require.False(t, loopback(addr), addr)
+	}
+}
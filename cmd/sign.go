@@ -15,16 +15,18 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
 	witness "github.com/testifysec/go-witness"
 	"github.com/testifysec/go-witness/dsse"
-	"github.com/testifysec/go-witness/log"
 	"github.com/testifysec/go-witness/timestamp"
 	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/result"
 )
 
 func SignCmd() *cobra.Command {
@@ -55,22 +57,9 @@ func runSign(so options.SignOptions) error {
 		return err
 	}
 
-	signers, errors := loadSigners(ctx, so.KeyOptions)
-	if len(errors) > 0 {
-		for _, err := range errors {
-			log.Error(err)
-		}
-		return fmt.Errorf("failed to load signers")
-	}
-
-	if len(signers) > 1 {
-		log.Error("only one signer is supported")
-		return fmt.Errorf("only one signer is supported")
-	}
-
-	if len(signers) == 0 {
-		log.Error("no signers found")
-		return fmt.Errorf("no signers found")
+	signer, err := loadSigner(ctx, so.KeyOptions)
+	if err != nil {
+		return err
 	}
 
 	timestampers := []dsse.Timestamper{}
@@ -78,6 +67,10 @@ func runSign(so options.SignOptions) error {
 		timestampers = append(timestampers, timestamp.NewTimestamper(timestamp.TimestampWithUrl(url)))
 	}
 
+	if err := checkOutputFormat(so.OutputFormat); err != nil {
+		return err
+	}
+
 	inFile, err := os.Open(so.InFilePath)
 	if err != nil {
 		return fmt.Errorf("failed to open file to sign: %v", err)
@@ -89,5 +82,15 @@ func runSign(so options.SignOptions) error {
 	}
 
 	defer outFile.Close()
-	return witness.Sign(inFile, so.DataType, outFile, dsse.SignWithSigners(signers[0]), dsse.SignWithTimestampers(timestampers...))
+	signed := &bytes.Buffer{}
+	if err := witness.Sign(inFile, so.DataType, signed, dsse.SignWithSigners(signer), dsse.SignWithTimestampers(timestampers...)); err != nil {
+		return result.Signer(err)
+	}
+
+	env := dsse.Envelope{}
+	if err := json.Unmarshal(signed.Bytes(), &env); err != nil {
+		return fmt.Errorf("failed to parse signed envelope: %w", err)
+	}
+
+	return writeSigned(env, outFile, so.OutputFormat, so.BundleOutFilePath)
 }
@@ -0,0 +1,269 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/store"
+)
+
+func StoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "store",
+		Short:             "Manages local directories of signed attestations",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(storePruneCmd())
+	cmd.AddCommand(storeSearchCmd())
+	cmd.AddCommand(storeUploadCmd())
+	return cmd
+}
+
+func storePruneCmd() *cobra.Command {
+	po := options.StorePruneOptions{}
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Deletes attestations from a local store according to retention rules",
+		Long: "Deletes signed attestations from a local store that match every retention rule given. Attestations for steps of a " +
+			"policy passed with --keep-policy and the most recent attestations of each step kept with --keep-latest are never deleted. " +
+			"Archivista does not support deleting attestations, so only local stores can be pruned",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return result.Storage(runStorePrune(po))
+		},
+	}
+
+	po.AddFlags(cmd)
+	return cmd
+}
+
+func runStorePrune(po options.StorePruneOptions) error {
+	if po.StoreDir == "" {
+		return errors.New("a store directory is required")
+	}
+
+	keepSteps := make([]string, 0)
+	for _, policyPath := range po.KeepPolicies {
+		steps, err := policySteps(policyPath)
+		if err != nil {
+			return fmt.Errorf("failed to read steps of policy %v: %w", policyPath, err)
+		}
+
+		keepSteps = append(keepSteps, steps...)
+	}
+
+	entries, err := store.Load(po.StoreDir)
+	if err != nil {
+		return fmt.Errorf("failed to load store: %w", err)
+	}
+
+	rules := store.RetentionRules{
+		OlderThan:  po.OlderThan,
+		Subjects:   po.Subjects,
+		KeepSteps:  keepSteps,
+		KeepLatest: po.KeepLatest,
+	}
+
+	pruned, err := rules.Select(entries)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range pruned {
+		log.Infof("Pruning %v (step %v, finished %v)", entry.Path, entry.Step, entry.Time)
+	}
+
+	if po.DryRun || len(pruned) == 0 {
+		log.Infof("%v of %v attestations would be pruned", len(pruned), len(entries))
+		return nil
+	}
+
+	if po.ExportDir != "" {
+		if err := store.Export(po.StoreDir, po.ExportDir, pruned); err != nil {
+			return fmt.Errorf("failed to export pruned attestations, nothing was deleted: %w", err)
+		}
+	}
+
+	if err := store.Remove(po.StoreDir, pruned); err != nil {
+		return err
+	}
+
+	log.Infof("Pruned %v of %v attestations", len(pruned), len(entries))
+	return nil
+}
+
+func storeSearchCmd() *cobra.Command {
+	so := options.StoreSearchOptions{}
+	cmd := &cobra.Command{
+		Use:               "search",
+		Short:             "Lists attestations in a local store by subject, step, and time using the store's index",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return result.Storage(runStoreSearch(so, cmd.OutOrStdout(), time.Now()))
+		},
+	}
+
+	so.AddFlags(cmd)
+	return cmd
+}
+
+func runStoreSearch(so options.StoreSearchOptions, out io.Writer, now time.Time) error {
+	if so.StoreDir == "" {
+		return errors.New("a store directory is required")
+	}
+
+	idx, err := store.LoadIndex(so.StoreDir)
+	if err != nil {
+		return fmt.Errorf("failed to load store index: %w", err)
+	}
+
+	since := time.Time{}
+	if so.Since > 0 {
+		since = now.Add(-so.Since)
+	}
+
+	for _, entry := range idx.Find(so.Step, so.Subjects, since) {
+		if _, err := fmt.Fprintf(out, "%v\t%v\t%v\n", entry.Path, entry.Step, entry.Time.Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func storeUploadCmd() *cobra.Command {
+	uo := options.StoreUploadOptions{}
+	cmd := &cobra.Command{
+		Use:               "upload",
+		Short:             "Uploads every attestation in a local store to Archivista",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return result.Storage(runStoreUpload(cmd.Context(), uo))
+		},
+	}
+
+	uo.AddFlags(cmd)
+	return cmd
+}
+
+func runStoreUpload(ctx context.Context, uo options.StoreUploadOptions) error {
+	if uo.StoreDir == "" {
+		return errors.New("a store directory is required")
+	}
+
+	entries, err := store.Load(uo.StoreDir)
+	if err != nil {
+		return fmt.Errorf("failed to load store: %w", err)
+	}
+
+	journal, err := store.LoadUploadJournal(uo.StoreDir)
+	if err != nil {
+		return fmt.Errorf("failed to load upload journal: %w", err)
+	}
+
+	pending := make([]store.Entry, 0, len(entries))
+	envelopes := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		if !uo.Force && journal.Has(uo.ArchivistaUrl, entry.GitOID) {
+			continue
+		}
+
+		envelope, err := store.Read(uo.StoreDir, entry)
+		if err != nil {
+			return err
+		}
+
+		pending = append(pending, entry)
+		envelopes = append(envelopes, envelope)
+	}
+
+	archivistaClient, err := newArchivistaClient(uo.ArchivistaUrl, uo.ArchivistaClientOptions)
+	if err != nil {
+		return err
+	}
+
+	defer archivistaClient.Close()
+	log.Infof("Uploading %v of %v attestations", len(pending), len(entries))
+	// envelopes are uploaded as they are stored, so the gitoid Archivista returns can be checked against the file
+	gitoids, uploadErr := archivistaClient.StoreAllBytes(ctx, envelopes)
+	for i, gitoid := range gitoids {
+		if gitoid == "" {
+			continue
+		}
+
+		journal.Add(uo.ArchivistaUrl, gitoid)
+		log.Infof("Stored %v in Archivista as %v", pending[i].Path, gitoid)
+	}
+
+	if err := journal.Save(); err != nil {
+		return fmt.Errorf("failed to save upload journal: %w", err)
+	}
+
+	if uploadErr != nil {
+		return fmt.Errorf("failed to upload attestations, run the upload again to resume: %w", uploadErr)
+	}
+
+	return nil
+}
+
+// policySteps returns the names of the steps of a signed policy. The signature isn't checked because the policy
+// is only used to decide which attestations to keep.
+func policySteps(policyPath string) ([]string, error) {
+	policyBytes, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	policyEnvelope, err := bundle.Decode(policyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	p := policy.Policy{}
+	if err := json.Unmarshal(policyEnvelope.Payload, &p); err != nil {
+		return nil, err
+	}
+
+	steps := make([]string, 0, len(p.Steps))
+	for key, step := range p.Steps {
+		if step.Name == "" {
+			step.Name = key
+		}
+
+		steps = append(steps, step.Name)
+	}
+
+	return steps, nil
+}
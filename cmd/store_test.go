@@ -0,0 +1,83 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/attestation/previousstep"
+)
+
+func TestRunStoreUploadResumes(t *testing.T) {
+	storeDir := t.TempDir()
+	for _, step := range []string{"build", "test", "package"} {
+		payload := fmt.Sprintf(`{"_type":"https://in-toto.io/Statement/v0.1","subject":[],"predicateType":"https://witness.testifysec.com/attestation-collection/v0.1","predicate":{"name":%q,"attestations":[]}}`, step)
+		envelope, err := json.Marshal(dsse.Envelope{Payload: []byte(payload), PayloadType: "application/vnd.in-toto+json", Signatures: []dsse.Signature{{KeyID: "key", Signature: []byte("sig")}}})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(storeDir, step+".json"), envelope, 0644))
+	}
+
+	failing, err := os.ReadFile(filepath.Join(storeDir, "test.json"))
+	require.NoError(t, err)
+	mu := &sync.Mutex{}
+	fail := true
+	uploads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		mu.Lock()
+		defer mu.Unlock()
+		if fail && string(body) == string(failing) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		uploads++
+		fmt.Fprintf(w, `{"gitoid":%q}`, previousstep.GitOID(body))
+	}))
+	defer server.Close()
+
+	uo := options.StoreUploadOptions{
+		StoreDir:                storeDir,
+		ArchivistaUrl:           server.URL,
+		ArchivistaClientOptions: options.ArchivistaClientOptions{Concurrency: 1},
+	}
+
+	require.Error(t, runStoreUpload(context.Background(), uo))
+	require.FileExists(t, filepath.Join(storeDir, ".witness-uploads.json"))
+
+	mu.Lock()
+	fail = false
+	uploaded := uploads
+	mu.Unlock()
+	require.NoError(t, runStoreUpload(context.Background(), uo))
+	require.Equal(t, 3, uploads)
+	require.Less(t, uploaded, 3)
+
+	require.NoError(t, runStoreUpload(context.Background(), uo))
+	require.Equal(t, 3, uploads)
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/timestamp"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/statement"
+	"github.com/testifysec/witness/pkg/tekton"
+)
+
+// tektonCluster connects to the cluster runs are read from, and is replaced in tests.
+var tektonCluster = tekton.InCluster
+
+func TektonCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:               "tekton",
+		Short:             "Interoperates with Tekton Pipelines and Tekton Chains",
+		DisableAutoGenTag: true,
+	}
+
+	cmd.AddCommand(tektonProvenanceCmd())
+	return cmd
+}
+
+func tektonProvenanceCmd() *cobra.Command {
+	to := options.TektonProvenanceOptions{}
+	cmd := &cobra.Command{
+		Use:   "provenance",
+		Short: "Signs provenance of a TaskRun or PipelineRun in the format Tekton Chains produces",
+		Long: "Reads the status of a TaskRun or PipelineRun from a file, from the cluster by name, or from the cluster " +
+			"as the run the pod's downward API labels name, and signs SLSA v0.2 provenance of it in the format Tekton " +
+			"Chains produces. Its subjects are the artifacts the run's IMAGE_URL, IMAGES, ARTIFACT_URI, and " +
+			"ARTIFACT_OUTPUTS results name. witness verify accepts the provenance, and provenance signed by Chains, " +
+			"as evidence of the policy step named after the task.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTektonProvenance(cmd.Context(), to)
+		},
+	}
+
+	to.AddFlags(cmd)
+	return cmd
+}
+
+func runTektonProvenance(ctx context.Context, to options.TektonProvenanceOptions) error {
+	signer, err := loadSigner(ctx, to.KeyOptions)
+	if err != nil {
+		return err
+	}
+
+	if err := checkOutputFormat(to.OutputFormat); err != nil {
+		return result.Usage(err)
+	}
+
+	run, err := loadTektonRun(ctx, to)
+	if err != nil {
+		return err
+	}
+
+	st, err := tekton.NewProvenance(run, to.BuilderID)
+	if err != nil {
+		return fmt.Errorf("failed to create provenance of %v %v: %w", run.Kind, run.Metadata.Name, err)
+	}
+
+	if len(st.Subject) == 0 {
+		return result.Usage(fmt.Errorf("%v %v has no results that name the artifacts it built, such as IMAGE_URL and IMAGE_DIGEST", run.Kind, run.Metadata.Name))
+	}
+
+	timestampers := []dsse.Timestamper{}
+	for _, url := range to.TimestampServers {
+		timestampers = append(timestampers, timestamp.NewTimestamper(timestamp.TimestampWithUrl(url)))
+	}
+
+	signedEnvelope, err := statement.SignStatement(st, []cryptoutil.Signer{signer}, timestampers...)
+	if err != nil {
+		return result.Signer(fmt.Errorf("failed to sign provenance: %w", err))
+	}
+
+	out, err := loadOutfile(to.OutFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open out file: %w", err)
+	}
+
+	defer out.Close()
+	return writeSigned(signedEnvelope, out, to.OutputFormat, to.BundleOutFilePath)
+}
+
+// loadTektonRun reads the run from --run-file, or from the cluster by the name given or the pod's labels.
+func loadTektonRun(ctx context.Context, to options.TektonProvenanceOptions) (tekton.Run, error) {
+	if to.RunFilePath != "" {
+		data, err := os.ReadFile(to.RunFilePath)
+		if err != nil {
+			return tekton.Run{}, fmt.Errorf("failed to read run file: %w", err)
+		}
+
+		run, err := tekton.Parse(data)
+		if err != nil {
+			return tekton.Run{}, result.Usage(err)
+		}
+
+		return run, nil
+	}
+
+	taskRun, pipelineRun := to.TaskRun, to.PipelineRun
+	if to.PodLabelsPath != "" {
+		labels, err := tekton.PodLabels(to.PodLabelsPath)
+		if err != nil {
+			return tekton.Run{}, result.Usage(err)
+		}
+
+		if pipelineRun == "" {
+			pipelineRun = labels[tekton.LabelPipelineRun]
+		}
+
+		if taskRun == "" && to.PipelineTask == "" {
+			taskRun = labels[tekton.LabelTaskRun]
+		}
+	}
+
+	if taskRun == "" && pipelineRun == "" {
+		return tekton.Run{}, result.Usage(errors.New("a run is required, provide --run-file, --taskrun, --pipelinerun, or --pod-labels"))
+	}
+
+	if to.PipelineTask != "" && pipelineRun == "" {
+		return tekton.Run{}, result.Usage(errors.New("--pipeline-task requires the PipelineRun it ran in"))
+	}
+
+	namespace := to.Namespace
+	if namespace == "" {
+		var err error
+		if namespace, err = tekton.PodNamespace(); err != nil {
+			return tekton.Run{}, result.Usage(fmt.Errorf("the namespace of the run is required outside of a pod, provide --namespace: %w", err))
+		}
+	}
+
+	cluster, err := tektonCluster()
+	if err != nil {
+		return tekton.Run{}, result.Usage(err)
+	}
+
+	var run tekton.Run
+	switch {
+	case to.PipelineTask != "":
+		run, err = cluster.TaskRunOf(ctx, namespace, pipelineRun, to.PipelineTask)
+	case taskRun != "":
+		run, err = cluster.Get(ctx, tekton.KindTaskRun, namespace, taskRun)
+	default:
+		run, err = cluster.Get(ctx, tekton.KindPipelineRun, namespace, pipelineRun)
+	}
+
+	if err != nil {
+		return tekton.Run{}, result.Storage(err)
+	}
+
+	return run, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/tekton"
+)
+
+const tektonImageDigest = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+const tektonTaskRun = `{
+  "apiVersion": "tekton.dev/v1",
+  "kind": "TaskRun",
+  "metadata": {"name": "release-build-x7k2p", "namespace": "ci", "labels": {"tekton.dev/pipelineTask": "build"}},
+  "status": {
+    "results": [
+      {"name": "IMAGE_URL", "value": "ghcr.io/acme/app:1.4"},
+      {"name": "IMAGE_DIGEST", "value": "sha256:` + tektonImageDigest + `"}
+    ]
+  }
+}`
+
+func TestRunTektonProvenance(t *testing.T) {
+	p, funcPriv := makepolicyRSAPub(t)
+	pol := policy.Policy{}
+	require.NoError(t, json.Unmarshal(p, &pol))
+	build := pol.Steps["step01"]
+	build.Name = "build"
+	build.Attestations = []policy.Attestation{{Type: tekton.ProvenanceType}}
+	pol.Steps = map[string]policy.Step{"build": build}
+	p, err := json.Marshal(&pol)
+	require.NoError(t, err)
+
+	signedPolicy, pub := signPolicyRSA(t, p)
+	dir := t.TempDir()
+	policyFilePath := filepath.Join(dir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(dir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(dir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+	runFilePath := filepath.Join(dir, "taskrun.json")
+	require.NoError(t, os.WriteFile(runFilePath, []byte(tektonTaskRun), 0644))
+
+	provenancePath := filepath.Join(dir, "provenance.json")
+	to := options.TektonProvenanceOptions{
+		KeyOptions:  options.KeyOptions{KeyPath: funcPrivFilepath},
+		RunFilePath: runFilePath,
+		BuilderID:   tekton.ChainsBuilderID,
+		OutFilePath: provenancePath,
+	}
+
+	require.NoError(t, runTektonProvenance(context.Background(), to))
+
+	// the provenance is evidence of the policy step named after the task
+	vo := options.VerifyOptions{
+		KeyPath:              policyPubFilePath,
+		PolicyFilePath:       policyFilePath,
+		AttestationFilePaths: []string{provenancePath},
+		AdditionalSubjects:   []string{tektonImageDigest},
+	}
+
+	require.NoError(t, runVerify(context.Background(), vo))
+	vo.AdditionalSubjects = []string{"0000000000000000000000000000000000000000000000000000000000000000"}
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(runVerify(context.Background(), vo)))
+
+	// the run is read from the cluster as the one the pod's labels name
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/apis/tekton.dev/v1/namespaces/ci/taskruns/release-build-x7k2p", r.URL.Path)
+		w.Write([]byte(tektonTaskRun))
+	}))
+
+	defer server.Close()
+	tektonCluster = func() (*tekton.Cluster, error) { return tekton.NewCluster(server.URL, "", server.Client()), nil }
+	defer func() { tektonCluster = tekton.InCluster }()
+	labelsPath := filepath.Join(dir, "labels")
+	require.NoError(t, os.WriteFile(labelsPath, []byte(`tekton.dev/taskRun="release-build-x7k2p"`), 0644))
+	to.RunFilePath = ""
+	to.PodLabelsPath = labelsPath
+	to.Namespace = "ci"
+	require.NoError(t, runTektonProvenance(context.Background(), to))
+	vo.AdditionalSubjects = []string{tektonImageDigest}
+	require.NoError(t, runVerify(context.Background(), vo))
+
+	to.PodLabelsPath = ""
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(runTektonProvenance(context.Background(), to)))
+}
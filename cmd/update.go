@@ -0,0 +1,117 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/update"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+func UpdateCmd() *cobra.Command {
+	o := options.UpdateOptions{}
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Replaces witness with a newer release after verifying its release attestation",
+		Long: "Downloads a witness release for this platform and replaces the running binary with it. " +
+			"The release's attestation must be signed by one of the keys passed with --release-key, " +
+			"and the digest of the new binary must be one of its subjects.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runUpdate(cmd.Context(), o, cmd.OutOrStdout())
+		},
+	}
+
+	o.AddFlags(cmd)
+	return cmd
+}
+
+func runUpdate(ctx context.Context, o options.UpdateOptions, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+	client := update.New(update.WithAPI(o.API), update.WithRepository(o.Repository))
+	var (
+		release update.Release
+		err     error
+	)
+
+	if o.Version != "" {
+		release, err = client.Tag(ctx, o.Version)
+	} else {
+		release, err = client.Latest(ctx)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if o.Version == "" && !update.Newer(Version, release) {
+		_, err := fmt.Fprintf(out, "witness %v is up to date\n", Version)
+		return err
+	}
+
+	// older releases are still validly signed, so installing one could bring back fixed vulnerabilities
+	if o.Version != "" && !o.AllowDowngrade && !update.Newer(Version, release) {
+		return fmt.Errorf("witness %v is not newer than the installed %v, pass --allow-downgrade to install it anyway", release.Tag, Version)
+	}
+
+	if o.Check {
+		_, err := fmt.Fprintf(out, "witness %v is available, %v is installed\n", release.Tag, Version)
+		return err
+	}
+
+	verifiers := make([]cryptoutil.Verifier, 0, len(o.ReleaseKeyPaths))
+	for _, keyPath := range o.ReleaseKeyPaths {
+		keyBytes, err := os.ReadFile(keyPath)
+		if err != nil {
+			return fmt.Errorf("failed to read release key %v: %w", keyPath, err)
+		}
+
+		verifier, err := verify.NewVerifierFromBytes(keyBytes)
+		if err != nil {
+			return fmt.Errorf("failed to load release key %v: %w", keyPath, err)
+		}
+
+		verifiers = append(verifiers, verifier)
+	}
+
+	binary, err := client.Download(ctx, release, verifiers)
+	if err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the witness binary: %w", err)
+	}
+
+	if err := update.Replace(executable, binary); err != nil {
+		return fmt.Errorf("failed to replace %v: %w", executable, err)
+	}
+
+	log.Infof("verified the release attestation of witness %v", release.Tag)
+	_, err = fmt.Fprintf(out, "updated witness from %v to %v\n", Version, release.Tag)
+	return err
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/witness/options"
+)
+
+func TestUpdateRefusesDowngrade(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"tag_name":"v0.1.0","assets":[]}`))
+	}))
+	defer server.Close()
+
+	installed := Version
+	Version = "v0.2.0-abc1234"
+	defer func() { Version = installed }()
+
+	o := options.UpdateOptions{Version: "v0.1.0", Repository: "testifysec/witness", API: server.URL, Timeout: time.Minute}
+	err := runUpdate(context.Background(), o, &bytes.Buffer{})
+	require.ErrorContains(t, err, "pass --allow-downgrade")
+
+	o.AllowDowngrade = true
+	err = runUpdate(context.Background(), o, &bytes.Buffer{})
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "allow-downgrade")
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/go-witness/timestamp"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/attestation/cicontext"
+	"github.com/testifysec/witness/pkg/attestation/witnessbinary"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/statement"
+)
+
+// verifiedStep is a step, such as a promotion or deployment, that is only recorded once the evidence of an artifact
+// satisfies a policy.
+type verifiedStep struct {
+	// kind names what the step records in errors, such as deployment.
+	kind              string
+	verifyOptions     options.VerifyOptions
+	keyOptions        options.KeyOptions
+	stepName          string
+	outFilePath       string
+	outputFormat      string
+	bundleOutFilePath string
+	timestampServers  []string
+	// attestor returns the attestor that records the step, given the signer of the step and the artifact's inputs and
+	// verified evidence.
+	attestor func(signer cryptoutil.Signer, inputs verifyInputs, verified map[string][]source.VerifiedCollection) attestation.Attestor
+}
+
+// recordVerifiedStep verifies the artifact's evidence against the policy, then records the step with the witness
+// binary and CI context attestors, signs it, writes it, and publishes it to the configured stores.
+func recordVerifiedStep(ctx context.Context, step verifiedStep) error {
+	if step.stepName == "" {
+		return result.Usage(errors.New("step name is required"))
+	}
+
+	signer, err := loadSigner(ctx, step.keyOptions)
+	if err != nil {
+		return err
+	}
+
+	if err := checkOutputFormat(step.outputFormat); err != nil {
+		return err
+	}
+
+	inputs, err := loadVerifyInputs(ctx, step.verifyOptions)
+	if err != nil {
+		return err
+	}
+
+	defer inputs.close()
+	// nothing is recorded unless the artifact's evidence satisfies the policy
+	verifiedEvidence, err := inputs.verify(ctx, step.verifyOptions)
+	if err != nil {
+		return result.Policy(fmt.Errorf("failed to verify policy: %w", err))
+	}
+
+	binaryOpts := []witnessbinary.Option{}
+	if Version != "dev" {
+		binaryOpts = append(binaryOpts, witnessbinary.WithVersion(Version))
+	}
+
+	attestors := []attestation.Attestor{step.attestor(signer, inputs, verifiedEvidence), witnessbinary.New(binaryOpts...)}
+	if cicontext.Detected() {
+		attestors = append(attestors, cicontext.New())
+	}
+
+	stepCtx, err := attestation.NewContext(attestors)
+	if err != nil {
+		return result.Attestor(fmt.Errorf("failed to create attestation context: %w", err))
+	}
+
+	if err := stepCtx.RunAttestors(); err != nil {
+		return result.Attestor(fmt.Errorf("failed to run attestors: %w", err))
+	}
+
+	timestampers := []dsse.Timestamper{}
+	for _, url := range step.timestampServers {
+		timestampers = append(timestampers, timestamp.NewTimestamper(timestamp.TimestampWithUrl(url)))
+	}
+
+	collection := attestation.NewCollection(step.stepName, stepCtx.CompletedAttestors())
+	signedEnvelope, err := statement.Sign(collection, []cryptoutil.Signer{signer}, timestampers...)
+	if err != nil {
+		return result.Signer(fmt.Errorf("failed to sign %v: %w", step.kind, err))
+	}
+
+	out, err := loadOutfile(step.outFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open out file: %w", err)
+	}
+
+	defer out.Close()
+	if err := writeSigned(signedEnvelope, out, step.outputFormat, step.bundleOutFilePath); err != nil {
+		return err
+	}
+
+	return publish(ctx, step.verifyOptions.StoreDir, step.verifyOptions.ArchivistaOptions, signedEnvelope)
+}
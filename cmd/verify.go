@@ -17,19 +17,38 @@ package cmd
 import (
 	"context"
 	"crypto"
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
-	"github.com/testifysec/go-witness"
-	"github.com/testifysec/go-witness/archivista"
 	"github.com/testifysec/go-witness/cryptoutil"
 	"github.com/testifysec/go-witness/dsse"
 	"github.com/testifysec/go-witness/log"
 	"github.com/testifysec/go-witness/source"
 	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/archivista"
+	"github.com/testifysec/witness/pkg/attestation/subjectname"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/groups"
+	"github.com/testifysec/witness/pkg/oci"
+	"github.com/testifysec/witness/pkg/predicate"
+	"github.com/testifysec/witness/pkg/rekor"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/statement"
+	"github.com/testifysec/witness/pkg/store"
+	"github.com/testifysec/witness/pkg/tekton"
+	"github.com/testifysec/witness/pkg/verify"
 )
 
 func VerifyCmd() *cobra.Command {
@@ -46,6 +65,8 @@ func VerifyCmd() *cobra.Command {
 		},
 	}
 	vo.AddFlags(cmd)
+	vo.Cache.AddFlags(cmd)
+	vo.AuditLog.AddFlags(cmd)
 	return cmd
 }
 
@@ -56,91 +77,731 @@ const (
 // todo: this logic should be broken out and moved to pkg/
 // we need to abstract where keys are coming from, etc
 func runVerify(ctx context.Context, vo options.VerifyOptions) error {
+	auditLog, err := openAuditLog(ctx, vo.AuditLog)
+	if err != nil {
+		return err
+	}
+
+	defer auditLog.Close()
+	inputs, err := loadVerifyInputs(ctx, vo)
+	if err != nil {
+		return err
+	}
+
+	defer inputs.close()
+	verifyErr := verifyAndCache(ctx, vo, inputs)
+	if err := auditLog.Record(ctx, newDecision("verify", inputs.subjects, inputs.policyDigest, verifyErr)); err != nil {
+		if verifyErr != nil {
+			log.Warnf("%v", err)
+			return verifyErr
+		}
+
+		return result.Storage(err)
+	}
+
+	return verifyErr
+}
+
+// verifyAndCache verifies inputs, returning a cached result of verifying the same inputs if there is one.
+func verifyAndCache(ctx context.Context, vo options.VerifyOptions, inputs verifyInputs) error {
+	var cache *verify.Cache
+	cacheKey := ""
+	if vo.Cache.Dir != "" {
+		var err error
+		if cacheKey, err = inputs.cacheKey(vo); err != nil {
+			return err
+		}
+
+		if cacheKey == "" {
+			log.Warn("verification results can't be cached when attestations are searched for in a store or Archivista")
+		} else {
+			if cache, err = loadCache(vo.Cache); err != nil {
+				return err
+			}
+
+			if entry, ok := cache.Get(cacheKey); ok {
+				log.Infof("Verification succeeded (cached result from %v)", entry.VerifiedAt.Format(time.RFC3339))
+				logEvidence(entry.Evidence)
+				return nil
+			}
+		}
+	}
+
+	verifiedEvidence, err := inputs.verify(ctx, vo)
+	if err != nil {
+		return result.Policy(fmt.Errorf("failed to verify policy: %w", err))
+
+	}
+
+	evidence := []string{}
+	for _, stepEvidence := range verifiedEvidence {
+		for _, e := range stepEvidence {
+			if names := subjectNames(e); names != "" {
+				evidence = append(evidence, fmt.Sprintf("%s (%s)", e.Reference, names))
+			} else {
+				evidence = append(evidence, e.Reference)
+			}
+		}
+	}
+
+	log.Info("Verification succeeded")
+	logEvidence(evidence)
+	if cache != nil {
+		if err := cache.Put(cacheKey, inputs.policyEnvelope, evidence); err != nil {
+			log.Warnf("failed to cache verification result: %v", err)
+		}
+	}
+
+	return nil
+
+}
+
+// loadCache opens the cache of --cache-dir, authenticated with the key in --cache-key-file.
+func loadCache(co options.VerifyCacheOptions) (*verify.Cache, error) {
+	key, err := readCacheKey(co.Dir, co.KeyPath, "cache")
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := verify.NewCache(co.Dir, co.TTL, key)
+	if err != nil {
+		return nil, result.Usage(err)
+	}
+
+	return cache, nil
+}
+
+// readCacheKey reads the key the cache in dir is authenticated with from keyPath, which must be outside dir so
+// whoever can write the cache can't also replace the key. flag is the prefix of the cache's --<flag>-dir and
+// --<flag>-key-file flags.
+func readCacheKey(dir, keyPath, flag string) ([]byte, error) {
+	if keyPath == "" {
+		return nil, result.Usage(fmt.Errorf("cached results are authenticated with a key kept outside the cache, provide --%v-key-file", flag))
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, result.Usage(err)
+	}
+
+	absKeyPath, err := filepath.Abs(keyPath)
+	if err != nil {
+		return nil, result.Usage(err)
+	}
+
+	if rel, err := filepath.Rel(absDir, absKeyPath); err == nil && !strings.HasPrefix(rel, "..") {
+		return nil, result.Usage(fmt.Errorf("--%v-key-file must be outside --%v-dir", flag, flag))
+	}
+
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, result.Usage(fmt.Errorf("failed to read %v key: %w", flag, err))
+	}
+
+	return key, nil
+}
+
+func logEvidence(evidence []string) {
+	log.Info("Evidence:")
+	for num, e := range evidence {
+		log.Info(fmt.Sprintf("%d: %s", num, e))
+	}
+}
+
+// verifyInputs holds everything verification needs that is loaded from the verify flags
+type verifyInputs struct {
+	policyEnvelope dsse.Envelope
+	// policyDigest is the sha256 digest of the policy file, as the k8s-webhook reports the policies it loads
+	policyDigest     string
+	verifiers        []cryptoutil.Verifier
+	subjects         []cryptoutil.DigestSet
+	collectionSource source.Sourcer
+	witnessReleases  []dsse.Envelope
+	vex              []dsse.Envelope
+	revocations      []dsse.Envelope
+	storedEnvelopes  *verify.StoredEnvelopes
+	groupSnapshots   []dsse.Envelope
+	subPolicies      []dsse.Envelope
+	resolvedGroups   []groups.Snapshot
+	// goBuildInfo is the buildinfo of the artifact when --check-buildinfo is set
+	goBuildInfo *debug.BuildInfo
+	// trustDigests and evidenceDigests identify the policy key and the evidence given directly to verify, and are
+	// only used to key cached results
+	trustDigests    []string
+	evidenceDigests []string
+	searchesStores  bool
+	// archivistaClient is the client the collection source and revocations are read through, if archivista is enabled
+	archivistaClient *archivista.Client
+}
+
+// close closes the connections to archivista, if inputs were read from it.
+func (inputs verifyInputs) close() {
+	if inputs.archivistaClient != nil {
+		inputs.archivistaClient.Close()
+	}
+}
+
+func loadVerifyInputs(ctx context.Context, vo options.VerifyOptions) (verifyInputs, error) {
+	inputs := verifyInputs{storedEnvelopes: verify.NewStoredEnvelopes()}
 	if vo.KeyPath == "" && len(vo.CAPaths) == 0 {
-		return fmt.Errorf("must suply public key or ca paths")
+		return inputs, result.Usage(fmt.Errorf("must suply public key or ca paths"))
+	}
+
+	for _, version := range vo.StatementVersions {
+		if _, err := statement.TypeOfVersion(version); err != nil {
+			return inputs, result.Usage(err)
+		}
+	}
+
+	// predicate types have to be registered before any collection is parsed
+	if err := registerPredicateTypes(vo); err != nil {
+		return inputs, err
 	}
 
 	var verifier cryptoutil.Verifier
 	if vo.KeyPath != "" {
-		keyFile, err := os.Open(vo.KeyPath)
+		keyBytes, err := os.ReadFile(vo.KeyPath)
 		if err != nil {
-			return fmt.Errorf("failed to open key file: %w", err)
+			return inputs, fmt.Errorf("failed to open key file: %w", err)
 		}
-		defer keyFile.Close()
 
-		verifier, err = cryptoutil.NewVerifierFromReader(keyFile)
+		verifier, err = verify.NewVerifierFromBytes(keyBytes)
 		if err != nil {
-			return fmt.Errorf("failed to create verifier: %w", err)
+			return inputs, fmt.Errorf("failed to create verifier: %w", err)
 		}
 
+		inputs.trustDigests = append(inputs.trustDigests, digestBytes(keyBytes))
+
 	}
 
-	inFile, err := os.Open(vo.PolicyFilePath)
+	inputs.verifiers = []cryptoutil.Verifier{verifier}
+	policyBytes, err := os.ReadFile(vo.PolicyFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file to sign: %v", err)
+		return inputs, fmt.Errorf("failed to open file to sign: %v", err)
 	}
 
-	defer inFile.Close()
-	policyEnvelope := dsse.Envelope{}
-	decoder := json.NewDecoder(inFile)
-	if err := decoder.Decode(&policyEnvelope); err != nil {
-		return fmt.Errorf("could not unmarshal policy envelope: %w", err)
+	inputs.policyDigest = digestBytes(policyBytes)
+	if inputs.policyEnvelope, err = bundle.Decode(policyBytes); err != nil {
+		return inputs, result.Policy(fmt.Errorf("could not unmarshal policy envelope: %w", err))
 	}
 
-	subjects := []cryptoutil.DigestSet{}
 	if len(vo.ArtifactFilePath) > 0 {
 		artifactDigestSet, err := cryptoutil.CalculateDigestSetFromFile(vo.ArtifactFilePath, []crypto.Hash{crypto.SHA256})
 		if err != nil {
-			return fmt.Errorf("failed to calculate artifact digest: %w", err)
+			return inputs, fmt.Errorf("failed to calculate artifact digest: %w", err)
 		}
 
-		subjects = append(subjects, artifactDigestSet)
+		inputs.subjects = append(inputs.subjects, artifactDigestSet)
 	}
 
-	for _, subDigest := range vo.AdditionalSubjects {
-		subjects = append(subjects, cryptoutil.DigestSet{cryptoutil.DigestValue{Hash: crypto.SHA256, GitOID: false}: subDigest})
+	if vo.CheckBuildInfo {
+		if vo.ArtifactFilePath == "" {
+			return inputs, result.Usage(errors.New("--check-buildinfo requires an artifact file"))
+		}
+
+		if inputs.goBuildInfo, err = buildinfo.ReadFile(vo.ArtifactFilePath); err != nil {
+			return inputs, result.Usage(fmt.Errorf("could not read buildinfo of %v: %w", vo.ArtifactFilePath, err))
+		}
 	}
 
-	if len(subjects) == 0 {
-		return errors.New("at least one subject is required, provide an artifact file or subject")
+	for _, subDigest := range vo.AdditionalSubjects {
+		inputs.subjects = append(inputs.subjects, cryptoutil.DigestSet{cryptoutil.DigestValue{Hash: crypto.SHA256, GitOID: false}: subDigest})
 	}
 
-	var collectionSource source.Sourcer
 	memSource := source.NewMemorySource()
-	for _, path := range vo.AttestationFilePaths {
-		if err := memSource.LoadFile(path); err != nil {
-			return fmt.Errorf("failed to load attestation file: %w", err)
+	if vo.Image != "" {
+		imageSubjects, imageEvidence, err := loadImage(vo.Image, memSource, inputs.storedEnvelopes)
+		if err != nil {
+			return inputs, err
 		}
+
+		inputs.evidenceDigests = append(inputs.evidenceDigests, imageEvidence...)
+
+		inputs.subjects = append(inputs.subjects, imageSubjects...)
+	}
+
+	if len(inputs.subjects) == 0 {
+		return inputs, result.Usage(errors.New("at least one subject is required, provide an artifact file, image, or subject"))
+	}
+
+	inputs.witnessReleases, err = loadEnvelopes(vo.WitnessReleasePaths, "witness release attestation")
+	if err != nil {
+		return inputs, err
+	}
+
+	inputs.vex, err = loadEnvelopes(vo.VEXPaths, "vex attestation")
+	if err != nil {
+		return inputs, err
+	}
+
+	attestationBytes, attestations, err := readEnvelopes(vo.AttestationFilePaths, "attestation file")
+	if err != nil {
+		return inputs, err
+	}
+
+	if err := verifyLogged(vo.AttestationFilePaths, attestationBytes, vo.RekorPublicKeyPath); err != nil {
+		return inputs, err
+	}
+
+	// provenance signed by Tekton Chains is verified as a collection named after the task it describes
+	tektonSource := tekton.NewSource()
+	for i, path := range vo.AttestationFilePaths {
+		if tekton.IsProvenance(attestations[i]) {
+			if err := tektonSource.Load(path, attestations[i]); err != nil {
+				return inputs, fmt.Errorf("failed to load attestation file: %w", err)
+			}
+		} else if err := memSource.LoadEnvelope(path, attestations[i]); err != nil {
+			return inputs, fmt.Errorf("failed to load attestation file: %w", err)
+		}
+
+		if err := inputs.storedEnvelopes.Add(attestationBytes[i]); err != nil {
+			return inputs, fmt.Errorf("failed to load attestation file: %w", err)
+		}
+
+		digest, err := verify.EnvelopeDigest(attestations[i])
+		if err != nil {
+			return inputs, err
+		}
+
+		inputs.evidenceDigests = append(inputs.evidenceDigests, digest)
+	}
+
+	inputs.collectionSource = source.NewMultiSource(memSource, tektonSource)
+	inputs.searchesStores = vo.StoreDir != "" || vo.ArchivistaOptions.Enable
+	if vo.StoreDir != "" {
+		inputs.collectionSource = source.NewMultiSource(inputs.collectionSource, storageSource{store.NewSource(vo.StoreDir, store.WithOnRead(inputs.storedEnvelopes.Add)), vo.StoreDir})
 	}
 
-	collectionSource = memSource
 	if vo.ArchivistaOptions.Enable {
-		collectionSource = source.NewMultiSource(collectionSource, source.NewArchvistSource(archivista.New(vo.ArchivistaOptions.Url)))
+		if inputs.archivistaClient, err = newArchivistaClient(vo.ArchivistaOptions.Url, vo.ArchivistaOptions.ArchivistaClientOptions); err != nil {
+			return inputs, result.Storage(err)
+		}
+
+		inputs.collectionSource = source.NewMultiSource(inputs.collectionSource, storageSource{archivista.NewSource(inputs.archivistaClient), vo.ArchivistaOptions.Url})
+	}
+
+	if inputs.revocations, err = loadRevocations(ctx, vo.RevocationRefs, inputs.archivistaClient); err != nil {
+		return inputs, err
+	}
+
+	if inputs.groupSnapshots, err = loadEnvelopes(vo.GroupSnapshotPaths, "group snapshot"); err != nil {
+		return inputs, err
+	}
+
+	if inputs.subPolicies, err = loadEnvelopes(vo.SubPolicyPaths, "sub-policy"); err != nil {
+		return inputs, err
+	}
+
+	if inputs.resolvedGroups, err = resolvePolicyGroups(ctx, vo, inputs.policyEnvelope); err != nil {
+		return inputs, err
+	}
+
+	return inputs, nil
+}
+
+// storageSource searches a store or Archivista for the attestations of each step by the subjects being verified.
+// Failures to search are storage errors rather than evidence that doesn't satisfy the policy.
+type storageSource struct {
+	source.Sourcer
+	location string
+}
+
+func (s storageSource) Search(ctx context.Context, collectionName string, subjectDigests, attestations []string) ([]source.CollectionEnvelope, error) {
+	found, err := s.Sourcer.Search(ctx, collectionName, subjectDigests, attestations)
+	if err != nil {
+		return nil, result.Storage(fmt.Errorf("failed to search %v for attestations of %v: %w", s.location, collectionName, err))
 	}
 
-	verifiedEvidence, err := witness.Verify(
+	log.Debugf("found %v attestations of %v in %v", len(found), collectionName, s.location)
+	return found, nil
+}
+
+// resolvePolicyGroups resolves the functionary groups the policy names from the SCIM service of --groups-scim-url or
+// the LDAP directory of --groups-ldap-url, if either is set.
+func resolvePolicyGroups(ctx context.Context, vo options.VerifyOptions, policyEnvelope dsse.Envelope) ([]groups.Snapshot, error) {
+	resolver, err := newGroupsResolver(vo.GroupsSCIM, vo.GroupsLDAP)
+	if err != nil || resolver == nil {
+		return nil, err
+	}
+
+	names, err := verify.ReferencedGroups(policyEnvelope.Payload)
+	if err != nil {
+		return nil, result.Policy(err)
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	source := resolver.Source()
+	if vo.GroupsCacheDir != "" {
+		key, err := readCacheKey(vo.GroupsCacheDir, vo.GroupsCacheKeyPath, "groups-cache")
+		if err != nil {
+			return nil, err
+		}
+
+		if resolver, err = groups.Cached(resolver, vo.GroupsCacheDir, vo.GroupsCacheTTL, key); err != nil {
+			return nil, result.Usage(err)
+		}
+	}
+
+	snapshot, err := resolver.Resolve(ctx, names)
+	if err != nil {
+		return nil, result.Storage(fmt.Errorf("failed to resolve groups from %v: %w", source, err))
+	}
+
+	return []groups.Snapshot{snapshot}, nil
+}
+
+// loadRevocations reads the signed revocation lists at refs. Each ref is a file, a gitoid to download from
+// Archivista, or an OCI layout reference whose attached revocation lists are read.
+func loadRevocations(ctx context.Context, refs []string, archivistaClient *archivista.Client) ([]dsse.Envelope, error) {
+	revocations := make([]dsse.Envelope, 0, len(refs))
+	for _, ref := range refs {
+		switch _, statErr := os.Stat(ref); {
+		case oci.IsLayoutReference(ref):
+			layout, image, err := openImage(ref)
+			if err != nil {
+				return nil, err
+			}
+
+			attached, err := layout.Attestations(image)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read revocation lists attached to %v: %w", ref, err)
+			}
+
+			for _, envelopeBytes := range attached {
+				env, err := bundle.Decode(envelopeBytes)
+				if err != nil {
+					return nil, fmt.Errorf("could not unmarshal envelope attached to %v: %w", ref, err)
+				}
+
+				if env.PayloadType == verify.RevocationsType {
+					revocations = append(revocations, env)
+				}
+			}
+		case statErr != nil && isGitoid(ref):
+			if archivistaClient == nil {
+				return nil, result.Usage(fmt.Errorf("revocation list %v is a gitoid, which requires --enable-archivista", ref))
+			}
+
+			env, err := archivistaClient.Download(ctx, ref)
+			if err != nil {
+				return nil, result.Storage(fmt.Errorf("failed to download revocation list %v: %w", ref, err))
+			}
+
+			revocations = append(revocations, env)
+		default:
+			envelopes, err := loadEnvelopes([]string{ref}, "revocation list")
+			if err != nil {
+				return nil, err
+			}
+
+			revocations = append(revocations, envelopes...)
+		}
+	}
+
+	return revocations, nil
+}
+
+// loadImage returns the subjects an image in an OCI layout is recorded under and loads the attestations attached
+// to it into memSource. The digests of the attestations are returned with the subjects.
+func loadImage(ref string, memSource *source.MemorySource, stored *verify.StoredEnvelopes) ([]cryptoutil.DigestSet, []string, error) {
+	layout, image, err := openImage(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	digests, err := layout.SubjectDigests(image)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read image %v: %w", ref, err)
+	}
+
+	subjects := make([]cryptoutil.DigestSet, 0, len(digests))
+	for _, digest := range digests {
+		subjects = append(subjects, cryptoutil.DigestSet{cryptoutil.DigestValue{Hash: crypto.SHA256}: digest})
+	}
+
+	envelopes, err := layout.Attestations(image)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read attestations attached to %v: %w", ref, err)
+	}
+
+	evidence := make([]string, 0, len(envelopes))
+	for _, envelope := range envelopes {
+		evidence = append(evidence, oci.Digest(envelope))
+		if err := memSource.LoadBytes(fmt.Sprintf("%v@%v", ref, oci.Digest(envelope)), envelope); err != nil {
+			return nil, nil, fmt.Errorf("failed to load attestation attached to %v: %w", ref, err)
+		}
+
+		if err := stored.Add(envelope); err != nil {
+			return nil, nil, fmt.Errorf("failed to load attestation attached to %v: %w", ref, err)
+		}
+	}
+
+	return subjects, evidence, nil
+}
+
+// registerPredicateTypes registers the custom predicate types of built-in attestors and the opaque predicate types
+// collections may contain.
+func registerPredicateTypes(vo options.VerifyOptions) error {
+	aliases, err := predicate.ParseAliases(vo.PredicateTypes)
+	if err != nil {
+		return err
+	}
+
+	for _, alias := range aliases {
+		if err := predicate.RegisterAlias(alias); err != nil {
+			return err
+		}
+	}
+
+	for _, opaque := range vo.OpaquePredicates {
+		predicateType, schemaPath := opaque, ""
+		if i := strings.LastIndex(opaque, "="); i >= 0 {
+			predicateType, schemaPath = opaque[:i], opaque[i+1:]
+		}
+
+		var schema *predicate.Schema
+		if schemaPath != "" {
+			if schema, err = predicate.LoadSchema(schemaPath); err != nil {
+				return err
+			}
+		}
+
+		if err := predicate.RegisterOpaque(predicateType, schema); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyLogged checks that every attestation file is logged in the Rekor log whose key is at keyPath, if it is set.
+func verifyLogged(paths []string, attestationBytes [][]byte, keyPath string) error {
+	if keyPath == "" {
+		return nil
+	}
+
+	logKey, err := loadRekorKey("", keyPath)
+	if err != nil {
+		return err
+	}
+
+	for i, path := range paths {
+		if err := rekor.VerifyLogged(attestationBytes[i], logKey); err != nil {
+			return result.Policy(fmt.Errorf("attestation file %v is not logged in rekor: %w", path, err))
+		}
+	}
+
+	return nil
+}
+
+// loadEnvelopes reads the signed envelopes or Sigstore bundles at paths, describing them as what in errors.
+func loadEnvelopes(paths []string, what string) ([]dsse.Envelope, error) {
+	_, envelopes, err := readEnvelopes(paths, what)
+	return envelopes, err
+}
+
+// readEnvelopes is loadEnvelopes that also returns the bytes each envelope was read from.
+func readEnvelopes(paths []string, what string) ([][]byte, []dsse.Envelope, error) {
+	data := make([][]byte, 0, len(paths))
+	envelopes := make([]dsse.Envelope, 0, len(paths))
+	for _, path := range paths {
+		envelopeBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %v: %w", what, err)
+		}
+
+		envelope, err := bundle.Decode(envelopeBytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not unmarshal %v %v: %w", what, path, err)
+		}
+
+		data = append(data, envelopeBytes)
+		envelopes = append(envelopes, envelope)
+	}
+
+	return data, envelopes, nil
+}
+
+func (vi verifyInputs) verify(ctx context.Context, vo options.VerifyOptions) (map[string][]source.VerifiedCollection, error) {
+	verifiedEvidence, err := verify.Verify(
 		ctx,
-		policyEnvelope,
-		[]cryptoutil.Verifier{verifier},
-		witness.VerifyWithSubjectDigests(subjects),
-		witness.VerifyWithCollectionSource(collectionSource),
+		vi.policyEnvelope,
+		vi.verifiers,
+		verify.WithSubjectDigests(vi.subjects),
+		verify.WithCollectionSource(vi.collectionSource),
+		verify.WithClockSkew(vo.ClockSkew),
+		verify.WithSubjectNames(vo.SubjectNames),
+		verify.WithWitnessReleases(vi.witnessReleases),
+		verify.WithVEX(vi.vex),
+		verify.WithEnvironment(vo.Environment),
+		verify.WithRevocations(vi.revocations),
+		verify.WithStoredEnvelopes(vi.storedEnvelopes),
+		verify.WithGroupSnapshots(vi.groupSnapshots),
+		verify.WithSubPolicies(vi.subPolicies),
+		verify.WithStatementVersions(vo.StatementVersions...),
+		verify.WithStrictStatements(vo.StrictInToto),
+		verify.WithResolvedGroups(vi.resolvedGroups...),
+		verify.WithCUETool(vo.CUEPath),
 	)
+	if err != nil || vi.goBuildInfo == nil {
+		return verifiedEvidence, err
+	}
+
+	if err := verify.CheckBuildInfo(vi.goBuildInfo, verifiedEvidence); err != nil {
+		return nil, fmt.Errorf("failed to check buildinfo of %v: %w", vo.ArtifactFilePath, err)
+	}
+
+	return verifiedEvidence, nil
+}
+
+// cacheKey returns the digest verification results are cached under, or an empty string if they can't be cached
+// because the evidence isn't known until a store or Archivista is searched.
+func (vi verifyInputs) cacheKey(vo options.VerifyOptions) (string, error) {
+	if vi.searchesStores {
+		return "", nil
+	}
 
+	policyDigest, err := verify.EnvelopeDigest(vi.policyEnvelope)
 	if err != nil {
-		return fmt.Errorf("failed to verify policy: %w", err)
+		return "", err
+	}
 
+	trustDigests := append([]string{}, vi.trustDigests...)
+	for _, caPath := range vo.CAPaths {
+		caBytes, err := os.ReadFile(caPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to open ca file: %w", err)
+		}
+
+		trustDigests = append(trustDigests, digestBytes(caBytes))
 	}
 
-	log.Info("Verification succeeded")
-	log.Info("Evidence:")
-	num := 0
-	for _, stepEvidence := range verifiedEvidence {
-		for _, e := range stepEvidence {
-			log.Info(fmt.Sprintf("%d: %s", num, e.Reference))
-			num++
+	key := verify.CacheKey{
+		Verifier:        Version,
+		PolicyDigest:    policyDigest,
+		TrustDigests:    trustDigests,
+		SubjectNames:    vo.SubjectNames,
+		ClockSkew:       vo.ClockSkew,
+		EvidenceDigests: vi.evidenceDigests,
+		Environment:     vo.Environment,
+		CheckBuildInfo:  vo.CheckBuildInfo,
+		// stricter statement settings can reject evidence a lenient verification accepted
+		StatementVersions: vo.StatementVersions,
+		StrictStatements:  vo.StrictInToto,
+	}
+
+	for name, predicateType := range vo.PredicateTypes {
+		key.PredicateTypes = append(key.PredicateTypes, fmt.Sprintf("%v=%v", name, predicateType))
+	}
+
+	for _, opaque := range vo.OpaquePredicates {
+		predicateType, schemaPath := opaque, ""
+		if i := strings.LastIndex(opaque, "="); i >= 0 {
+			predicateType, schemaPath = opaque[:i], opaque[i+1:]
 		}
+
+		if schemaPath != "" {
+			schemaBytes, err := os.ReadFile(schemaPath)
+			if err != nil {
+				return "", fmt.Errorf("failed to open schema file: %w", err)
+			}
+
+			predicateType = fmt.Sprintf("%v=%v", predicateType, digestBytes(schemaBytes))
+		}
+
+		key.OpaquePredicates = append(key.OpaquePredicates, predicateType)
 	}
 
-	return nil
+	// the cue command is only run for policies with CUE policies, so a missing one doesn't stop the result being cached
+	key.CUEDigest = vo.CUEPath
+	if cuePath, err := exec.LookPath(vo.CUEPath); err == nil {
+		cueBytes, err := os.ReadFile(cuePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read cue command: %w", err)
+		}
+
+		key.CUEDigest = digestBytes(cueBytes)
+	}
+
+	for _, subject := range vi.subjects {
+		for digestValue, digest := range subject {
+			key.Subjects = append(key.Subjects, fmt.Sprintf("%v:%v:%v", digestValue.Hash, digestValue.GitOID, digest))
+		}
+	}
+
+	for _, env := range vi.witnessReleases {
+		digest, err := verify.EnvelopeDigest(env)
+		if err != nil {
+			return "", err
+		}
+
+		key.WitnessReleaseDigests = append(key.WitnessReleaseDigests, digest)
+	}
+
+	for _, env := range vi.vex {
+		digest, err := verify.EnvelopeDigest(env)
+		if err != nil {
+			return "", err
+		}
+
+		key.VEXDigests = append(key.VEXDigests, digest)
+	}
+
+	for _, env := range vi.revocations {
+		digest, err := verify.EnvelopeDigest(env)
+		if err != nil {
+			return "", err
+		}
+
+		key.RevocationDigests = append(key.RevocationDigests, digest)
+	}
+
+	for _, env := range vi.groupSnapshots {
+		digest, err := verify.EnvelopeDigest(env)
+		if err != nil {
+			return "", err
+		}
+
+		key.GroupDigests = append(key.GroupDigests, digest)
+	}
+
+	for _, env := range vi.subPolicies {
+		digest, err := verify.EnvelopeDigest(env)
+		if err != nil {
+			return "", err
+		}
+
+		key.SubPolicyDigests = append(key.SubPolicyDigests, digest)
+	}
+
+	for _, snapshot := range vi.resolvedGroups {
+		data, err := json.Marshal(&snapshot)
+		if err != nil {
+			return "", err
+		}
+
+		key.GroupDigests = append(key.GroupDigests, digestBytes(data))
+	}
+
+	return key.Digest()
+}
+
+func digestBytes(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
+
+// subjectNames describes the named subjects recorded in a collection, such as "release-artifact=app.tar.gz"
+func subjectNames(collection source.VerifiedCollection) string {
+	names := subjectname.FromCollection(collection.Collection)
+	described := make([]string, 0, len(names))
+	for name, subject := range names {
+		described = append(described, fmt.Sprintf("%v=%v", name, subject.Path))
+	}
 
+	sort.Strings(described)
+	return strings.Join(described, ", ")
 }
@@ -18,19 +18,33 @@ import (
 	"bytes"
 	"context"
 	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 	witness "github.com/testifysec/go-witness"
+	archivistaapi "github.com/testifysec/go-witness/archivista"
 	"github.com/testifysec/go-witness/attestation/commandrun"
 	"github.com/testifysec/go-witness/cryptoutil"
 	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
 	"github.com/testifysec/go-witness/policy"
 	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/attestation/previousstep"
+	"github.com/testifysec/witness/pkg/auditlog"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/oci"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/verify"
 )
 
 func TestRunVerifyCA(t *testing.T) {
@@ -76,7 +90,7 @@ func TestRunVerifyCA(t *testing.T) {
 		Tracing:      false,
 	}
 
-	require.NoError(t, runRun(context.Background(), s1RunOptions, step1Args))
+	require.NoError(t, runRun(context.Background(), s1RunOptions, step1Args, nil))
 
 	subjects := []string{}
 	artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(artifactPath, []crypto.Hash{crypto.SHA256})
@@ -102,7 +116,7 @@ func TestRunVerifyCA(t *testing.T) {
 		Tracing:      false,
 	}
 
-	require.NoError(t, runRun(context.Background(), s2RunOptions, step2Args))
+	require.NoError(t, runRun(context.Background(), s2RunOptions, step2Args, nil))
 
 	vo := options.VerifyOptions{
 		KeyPath:              policyPubFilePath,
@@ -166,7 +180,7 @@ func TestRunVerifyKeyPair(t *testing.T) {
 		Tracing:      false,
 	}
 
-	require.NoError(t, runRun(context.Background(), s1RunOptions, step1Args))
+	require.NoError(t, runRun(context.Background(), s1RunOptions, step1Args, nil))
 
 	subjects := []string{}
 	artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(artifactPath, []crypto.Hash{crypto.SHA256})
@@ -192,7 +206,7 @@ func TestRunVerifyKeyPair(t *testing.T) {
 		Tracing:      false,
 	}
 
-	require.NoError(t, runRun(context.Background(), s2RunOptions, step2Args))
+	require.NoError(t, runRun(context.Background(), s2RunOptions, step2Args, nil))
 
 	vo := options.VerifyOptions{
 		KeyPath:              policyPubFilePath,
@@ -221,6 +235,66 @@ func TestRunVerifyKeyPair(t *testing.T) {
 	require.NoError(t, runVerify(context.Background(), vo))
 }
 
+func TestRunVerifyStatementVersion(t *testing.T) {
+	policy, funcPriv := makepolicyRSAPub(t)
+	signedPolicy, pub := signPolicyRSA(t, policy)
+	dir := t.TempDir()
+	policyFilePath := filepath.Join(dir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(dir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(dir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	// record both steps of the policy and return the options that verify them
+	record := func(version string, strict bool) options.VerifyOptions {
+		workingDir := t.TempDir()
+		paths, subjects := []string{}, []string{}
+		for _, step := range []string{"step01", "step02"} {
+			path := filepath.Join(t.TempDir(), step+".json")
+			require.NoError(t, runRun(context.Background(), options.RunOptions{
+				KeyOptions:       options.KeyOptions{KeyPath: funcPrivFilepath},
+				WorkingDir:       workingDir,
+				OutFilePath:      path,
+				StepName:         step,
+				StatementVersion: version,
+				StrictInToto:     strict,
+			}, []string{"bash", "-c", "echo '" + step + "' >> test.txt"}, nil))
+			paths = append(paths, path)
+
+			// each step changes the artifact, so evidence of the first step is found by its digest after that step
+			digests, err := cryptoutil.CalculateDigestSetFromFile(filepath.Join(workingDir, "test.txt"), []crypto.Hash{crypto.SHA256})
+			require.NoError(t, err)
+			for _, digest := range digests {
+				subjects = append(subjects, digest)
+			}
+		}
+
+		return options.VerifyOptions{
+			KeyPath:              policyPubFilePath,
+			AttestationFilePaths: paths,
+			PolicyFilePath:       policyFilePath,
+			AdditionalSubjects:   subjects,
+		}
+	}
+
+	vo := record("v1", true)
+	require.NoError(t, runVerify(context.Background(), vo))
+	vo.StrictInToto = true
+	vo.StatementVersions = []string{"v1"}
+	require.NoError(t, runVerify(context.Background(), vo))
+	vo.StatementVersions = []string{"v0.1"}
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(runVerify(context.Background(), vo)))
+	vo.StatementVersions = []string{"v2"}
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(runVerify(context.Background(), vo)))
+
+	// witness's default statements record gitoids, which strict verification doesn't accept
+	vo = record("", false)
+	require.NoError(t, runVerify(context.Background(), vo))
+	vo.StrictInToto = true
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(runVerify(context.Background(), vo)))
+}
+
 func signPolicyRSA(t *testing.T, p []byte) (signedPolicy []byte, pub []byte) {
 	sign, _, pub, _, err := createTestRSAKey()
 	require.NoError(t, err)
@@ -316,3 +390,877 @@ func makepolicy(t *testing.T, functionary policy.Functionary, publicKey policy.P
 	require.NoError(t, err)
 	return pb
 }
+
+func TestRunVerifyChainedSteps(t *testing.T) {
+	p, funcPriv := makepolicyRSAPub(t)
+	policyFields := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(p, &policyFields))
+	steps := policyFields["steps"].(map[string]interface{})
+	steps["step02"].(map[string]interface{})["chainedFrom"] = []string{"step01"}
+	p, err := json.Marshal(policyFields)
+	require.NoError(t, err)
+
+	signedPolicy, pub := signPolicyRSA(t, p)
+	workingDir := t.TempDir()
+	attestationDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(attestationDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	runStep := func(step, command string, previous []string) string {
+		outFilePath := filepath.Join(attestationDir, step+".json")
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:        options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:        workingDir,
+			Attestations:      []string{},
+			OutFilePath:       outFilePath,
+			StepName:          step,
+			PreviousEnvelopes: previous,
+		}, []string{"bash", "-c", command}, nil))
+		return outFilePath
+	}
+
+	s1FilePath := runStep("step01", "echo 'test01' > test.txt", nil)
+	s2FilePath := runStep("step02", "echo 'test02' >> test.txt", []string{s1FilePath})
+	vo := options.VerifyOptions{
+		KeyPath:              policyPubFilePath,
+		AttestationFilePaths: []string{s1FilePath, s2FilePath},
+		PolicyFilePath:       policyFilePath,
+		ArtifactFilePath:     filepath.Join(workingDir, "test.txt"),
+	}
+
+	// step01 is only found by following the back references recorded in step02
+	require.NoError(t, runVerify(context.Background(), vo))
+
+	unchainedFilePath := runStep("step02-unchained", "true", nil)
+	require.NoError(t, os.Rename(unchainedFilePath, s2FilePath))
+	require.NoError(t, os.WriteFile(filepath.Join(workingDir, "test.txt"), []byte("test01\ntest02\n"), 0644))
+	require.Error(t, runVerify(context.Background(), vo))
+}
+
+func TestRunVerifyChainFromRejectedCollection(t *testing.T) {
+	p, funcPriv := makepolicyRSAPub(t)
+	policyFields := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(p, &policyFields))
+	steps := policyFields["steps"].(map[string]interface{})
+	steps["step01"].(map[string]interface{})["requiredProducts"] = []string{"release.bin"}
+	delete(steps["step02"].(map[string]interface{}), "artifactsFrom")
+	steps["step02"].(map[string]interface{})["chainedFrom"] = []string{"step01"}
+	p, err := json.Marshal(policyFields)
+	require.NoError(t, err)
+
+	signedPolicy, pub := signPolicyRSA(t, p)
+	attestationDir := t.TempDir()
+	policyFilePath := filepath.Join(attestationDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(attestationDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(attestationDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	runStep := func(name, step, command string, previous []string) string {
+		outFilePath := filepath.Join(attestationDir, name+".json")
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:        options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:        t.TempDir(),
+			Attestations:      []string{},
+			OutFilePath:       outFilePath,
+			StepName:          step,
+			PreviousEnvelopes: previous,
+		}, []string{"bash", "-c", command}, nil))
+		return outFilePath
+	}
+
+	// step02 is chained from a build missing the required product, while another build of step01 has it
+	released := runStep("released", "step01", "echo 'release' > release.bin", nil)
+	unreleased := runStep("unreleased", "step01", "echo 'test01' > test.txt", nil)
+	deployed := runStep("deployed", "step02", "echo 'test02' > deployed.txt", []string{unreleased})
+	subjects := []string{}
+	for _, content := range []string{"release\n", "test02\n"} {
+		digest := sha256.Sum256([]byte(content))
+		subjects = append(subjects, hex.EncodeToString(digest[:]))
+	}
+
+	vo := options.VerifyOptions{
+		KeyPath:              policyPubFilePath,
+		AttestationFilePaths: []string{released, unreleased, deployed},
+		PolicyFilePath:       policyFilePath,
+		AdditionalSubjects:   subjects,
+	}
+
+	require.ErrorContains(t, runVerify(context.Background(), vo), "chain of custody")
+}
+
+func TestRunVerifyRegoDenied(t *testing.T) {
+	p, funcPriv := makepolicyRSAPub(t)
+	policyFields := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(p, &policyFields))
+	steps := policyFields["steps"].(map[string]interface{})
+	steps["step01"].(map[string]interface{})["attestations"] = []policy.Attestation{{
+		Type: commandrun.Type,
+		RegoPolicies: []policy.RegoPolicy{{
+			Name:   "no-bash.rego",
+			Module: []byte("package nobash\n\ndeny[msg] {\n\tinput.cmd[0] == \"bash\"\n\tmsg := \"bash is not allowed\"\n}\n"),
+		}},
+	}}
+
+	p, err := json.Marshal(policyFields)
+	require.NoError(t, err)
+	signedPolicy, pub := signPolicyRSA(t, p)
+	workingDir := t.TempDir()
+	attestationDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(attestationDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	s1FilePath := filepath.Join(attestationDir, "step01.json")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:  options.KeyOptions{KeyPath: funcPrivFilepath},
+		WorkingDir:  workingDir,
+		OutFilePath: s1FilePath,
+		StepName:    "step01",
+	}, []string{"bash", "-c", "echo 'test01' > test.txt"}, nil))
+
+	_, _, auditPub, auditPriv, err := createTestRSAKey()
+	require.NoError(t, err)
+	auditKeyPath := filepath.Join(workingDir, "audit-priv.pem")
+	require.NoError(t, os.WriteFile(auditKeyPath, auditPriv, 0600))
+	auditPubPath := filepath.Join(workingDir, "audit-pub.pem")
+	require.NoError(t, os.WriteFile(auditPubPath, auditPub, 0644))
+	auditLogPath := filepath.Join(workingDir, "audit.log")
+
+	err = runVerify(context.Background(), options.VerifyOptions{
+		KeyPath:              policyPubFilePath,
+		AttestationFilePaths: []string{s1FilePath},
+		PolicyFilePath:       policyFilePath,
+		ArtifactFilePath:     filepath.Join(workingDir, "test.txt"),
+		AuditLog:             options.AuditLogOptions{Target: auditLogPath, SigningKeyPath: auditKeyPath},
+	})
+
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(err))
+	denied := verify.ErrRegoDenied{}
+	require.ErrorAs(t, err, &denied)
+	require.ErrorContains(t, err, "step step01: no-bash.rego:3 denied "+commandrun.Type+" in "+s1FilePath+": bash is not allowed (reads input.cmd[0])")
+
+	// the denial is recorded in the signed audit log
+	require.NoError(t, runAuditLogVerify(auditLogPath, options.AuditLogVerifyOptions{KeyPaths: []string{auditPubPath}}))
+	auditLogFile, err := os.Open(auditLogPath)
+	require.NoError(t, err)
+	defer auditLogFile.Close()
+	records, err := auditlog.Verify(auditLogFile)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, auditlog.ResultDenied, records[0].Result)
+	require.Equal(t, "verify", records[0].Source)
+	require.Len(t, records[0].Subjects, 1)
+	require.Contains(t, records[0].Reasons[0], "bash is not allowed")
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(runAuditLogVerify(auditLogPath, options.AuditLogVerifyOptions{KeyPaths: []string{policyPubFilePath}})))
+}
+
+func TestRunVerifySubject(t *testing.T) {
+	_, _, pub, priv, err := createTestRSAKey()
+	require.NoError(t, err)
+	workingDir := t.TempDir()
+	privPath := filepath.Join(workingDir, "priv.pem")
+	require.NoError(t, os.WriteFile(privPath, priv, 0644))
+	pubPath := filepath.Join(workingDir, "pub.pem")
+	require.NoError(t, os.WriteFile(pubPath, pub, 0644))
+	_, _, otherPub, _, err := createTestRSAKey()
+	require.NoError(t, err)
+	otherPubPath := filepath.Join(workingDir, "other-pub.pem")
+	require.NoError(t, os.WriteFile(otherPubPath, otherPub, 0644))
+
+	attestationPath := filepath.Join(t.TempDir(), "build.json")
+	require.NoError(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:  options.KeyOptions{KeyPath: privPath},
+		WorkingDir:  workingDir,
+		OutFilePath: attestationPath,
+		StepName:    "build",
+	}, []string{"bash", "-c", "echo 'built' > app.bin"}, nil))
+
+	out := &bytes.Buffer{}
+	o := options.VerifySubjectOptions{
+		ArtifactFilePath:     filepath.Join(workingDir, "app.bin"),
+		AttestationFilePaths: []string{attestationPath},
+		KeyPaths:             []string{pubPath},
+	}
+
+	require.NoError(t, runVerifySubject(context.Background(), o, out))
+	require.Contains(t, out.String(), "product/v0.1/file:app.bin, signed by")
+
+	out.Reset()
+	o.KeyPaths = []string{otherPubPath}
+	require.ErrorContains(t, runVerifySubject(context.Background(), o, out), "not a subject of any verified attestation")
+	require.Contains(t, out.String(), "signature did not verify")
+
+	out.Reset()
+	o.KeyPaths = []string{pubPath}
+	o.ArtifactFilePath = privPath
+	require.Error(t, runVerifySubject(context.Background(), o, out))
+	require.Contains(t, out.String(), "artifact is not a subject of the attestation")
+}
+
+func TestRunVerifyStoreDir(t *testing.T) {
+	policy, funcPriv := makepolicyRSAPub(t)
+	signedPolicy, pub := signPolicyRSA(t, policy)
+	workingDir := t.TempDir()
+	storeDir := filepath.Join(t.TempDir(), "store")
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(workingDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	artifactPath := filepath.Join(workingDir, "test.txt")
+	subjects := []string{}
+	for _, step := range []struct{ name, command string }{{"step01", "echo 'test01' > test.txt"}, {"step02", "echo 'test02' >> test.txt"}} {
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:  options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:  workingDir,
+			OutFilePath: filepath.Join(t.TempDir(), step.name+".json"),
+			StepName:    step.name,
+			StoreDir:    storeDir,
+		}, []string{"bash", "-c", step.command}, nil))
+
+		artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(artifactPath, []crypto.Hash{crypto.SHA256})
+		require.NoError(t, err)
+		for _, digest := range artifactDigest {
+			subjects = append(subjects, digest)
+		}
+	}
+
+	vo := options.VerifyOptions{
+		KeyPath:            policyPubFilePath,
+		PolicyFilePath:     policyFilePath,
+		AdditionalSubjects: subjects,
+		StoreDir:           storeDir,
+	}
+
+	require.NoError(t, runVerify(context.Background(), vo))
+
+	out := &bytes.Buffer{}
+	require.NoError(t, runStoreSearch(options.StoreSearchOptions{StoreDir: storeDir, Step: "step02"}, out, time.Now()))
+	require.Equal(t, 1, strings.Count(out.String(), "\n"))
+	require.Contains(t, out.String(), "step02")
+}
+
+func TestRunVerifyArchivista(t *testing.T) {
+	policy, funcPriv := makepolicyRSAPub(t)
+	signedPolicy, pub := signPolicyRSA(t, policy)
+	workingDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(workingDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	// envelopes are indexed by step and subject digest, as Archivista indexes them
+	type stored struct {
+		step    string
+		digests map[string]bool
+		data    []byte
+	}
+
+	envelopes := map[string]stored{}
+	subjects := []string{}
+	for _, step := range []struct{ name, command string }{{"step01", "echo 'test01' > test.txt"}, {"step02", "echo 'test02' >> test.txt"}} {
+		outFile := filepath.Join(t.TempDir(), step.name+".json")
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:  options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:  workingDir,
+			OutFilePath: outFile,
+			StepName:    step.name,
+		}, []string{"bash", "-c", step.command}, nil))
+
+		artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(filepath.Join(workingDir, "test.txt"), []crypto.Hash{crypto.SHA256})
+		require.NoError(t, err)
+		for _, digest := range artifactDigest {
+			subjects = append(subjects, digest)
+		}
+
+		data, err := os.ReadFile(outFile)
+		require.NoError(t, err)
+		env := dsse.Envelope{}
+		require.NoError(t, json.Unmarshal(data, &env))
+		statement := intoto.Statement{}
+		require.NoError(t, json.Unmarshal(env.Payload, &statement))
+		digests := map[string]bool{}
+		for _, subject := range statement.Subject {
+			for _, digest := range subject.Digest {
+				digests[digest] = true
+			}
+		}
+
+		envelopes[previousstep.GitOID(data)] = stored{step.name, digests, data}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/query" {
+			_, _ = w.Write(envelopes[strings.TrimPrefix(r.URL.Path, "/download/")].data)
+			return
+		}
+
+		req := struct {
+			Variables archivistaapi.SearchGitoidVariables `json:"variables"`
+		}{}
+
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		edges := []string{}
+		for gitoid, env := range envelopes {
+			if env.step != req.Variables.CollectionName {
+				continue
+			}
+
+			for _, digest := range req.Variables.SubjectDigests {
+				if env.digests[digest] {
+					edges = append(edges, fmt.Sprintf(`{"node":{"gitoidSha256":%q}}`, gitoid))
+					break
+				}
+			}
+		}
+
+		fmt.Fprintf(w, `{"data":{"dsses":{"edges":[%v]}}}`, strings.Join(edges, ","))
+	}))
+	defer server.Close()
+
+	vo := options.VerifyOptions{
+		KeyPath:            policyPubFilePath,
+		PolicyFilePath:     policyFilePath,
+		AdditionalSubjects: subjects,
+		ArchivistaOptions:  options.ArchivistaOptions{Enable: true, Url: server.URL},
+	}
+
+	require.NoError(t, runVerify(context.Background(), vo))
+
+	// an Archivista that can't be searched is a storage failure rather than evidence that fails the policy
+	vo.ArchivistaOptions.Url = "http://127.0.0.1:1"
+	err := runVerify(context.Background(), vo)
+	require.Equal(t, result.CategoryStorage, result.CategoryOf(err))
+}
+
+func TestRunVerifyImage(t *testing.T) {
+	policy, funcPriv := makepolicyRSAPub(t)
+	signedPolicy, pub := signPolicyRSA(t, policy)
+	workingDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(workingDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	artifactPath := filepath.Join(workingDir, "test.txt")
+	attestationPaths := []string{}
+	step01Subject := ""
+	for _, step := range []struct{ name, command string }{{"step01", "echo 'test01' > test.txt"}, {"step02", "echo 'test02' >> test.txt"}} {
+		attestationPath := filepath.Join(t.TempDir(), step.name+".json")
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:  options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:  workingDir,
+			OutFilePath: attestationPath,
+			StepName:    step.name,
+		}, []string{"bash", "-c", step.command}, nil))
+
+		attestationPaths = append(attestationPaths, attestationPath)
+		if step01Subject == "" {
+			artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(artifactPath, []crypto.Hash{crypto.SHA256})
+			require.NoError(t, err)
+			for _, digest := range artifactDigest {
+				step01Subject = digest
+			}
+		}
+	}
+
+	// an image whose config is the final artifact, so its image id is a product of step02
+	layoutDir := t.TempDir()
+	config, err := os.ReadFile(artifactPath)
+	require.NoError(t, err)
+	writeBlob := func(data []byte) string {
+		digest := oci.Digest(data)
+		path := filepath.Join(layoutDir, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, data, 0644))
+		return digest
+	}
+
+	manifest, err := json.Marshal(oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeImageManifest,
+		Config:        oci.Descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: writeBlob(config), Size: int64(len(config))},
+		Layers:        []oci.Descriptor{},
+	})
+	require.NoError(t, err)
+	index, err := json.Marshal(oci.Index{SchemaVersion: 2, Manifests: []oci.Descriptor{{
+		MediaType:   oci.MediaTypeImageManifest,
+		Digest:      writeBlob(manifest),
+		Size:        int64(len(manifest)),
+		Annotations: map[string]string{oci.AnnotationRefName: "v1"},
+	}}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(layoutDir, "index.json"), index, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(layoutDir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644))
+
+	image := oci.LayoutScheme + layoutDir + ":v1"
+	vo := options.VerifyOptions{
+		KeyPath:            policyPubFilePath,
+		PolicyFilePath:     policyFilePath,
+		AdditionalSubjects: []string{step01Subject},
+		Image:              image,
+	}
+
+	require.Error(t, runVerify(context.Background(), vo))
+
+	out := &bytes.Buffer{}
+	require.NoError(t, runAttach(options.AttachOptions{Image: image, AttestationFilePaths: attestationPaths}, out))
+	require.Equal(t, 2, strings.Count(out.String(), "\n"))
+	require.NoError(t, runVerify(context.Background(), vo))
+}
+
+func TestRunVerifySigstoreBundle(t *testing.T) {
+	policy, funcPriv := makepolicyRSAPub(t)
+	signedPolicy, pub := signPolicyRSA(t, policy)
+	workingDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(workingDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	artifactPath := filepath.Join(workingDir, "test.txt")
+	subjects := []string{}
+	bundlePaths := []string{}
+	for _, step := range []struct{ name, command string }{{"step01", "echo 'test01' > test.txt"}, {"step02", "echo 'test02' >> test.txt"}} {
+		dsseFilePath := filepath.Join(t.TempDir(), step.name+".json")
+		bundleFilePath := filepath.Join(t.TempDir(), step.name+".sigstore.json")
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:        options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:        workingDir,
+			OutFilePath:       dsseFilePath,
+			OutputFormat:      bundle.FormatDSSE,
+			BundleOutFilePath: bundleFilePath,
+			StepName:          step.name,
+		}, []string{"bash", "-c", step.command}, nil))
+
+		dsseBytes, err := os.ReadFile(dsseFilePath)
+		require.NoError(t, err)
+		env := dsse.Envelope{}
+		require.NoError(t, json.Unmarshal(dsseBytes, &env))
+
+		bundleBytes, err := os.ReadFile(bundleFilePath)
+		require.NoError(t, err)
+		b := bundle.Bundle{}
+		require.NoError(t, json.Unmarshal(bundleBytes, &b))
+		require.Equal(t, bundle.MediaTypeV03, b.MediaType)
+		require.Equal(t, env.Payload, b.DSSEEnvelope.Payload)
+
+		bundlePaths = append(bundlePaths, bundleFilePath)
+		artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(artifactPath, []crypto.Hash{crypto.SHA256})
+		require.NoError(t, err)
+		for _, digest := range artifactDigest {
+			subjects = append(subjects, digest)
+		}
+	}
+
+	require.NoError(t, runVerify(context.Background(), options.VerifyOptions{
+		KeyPath:              policyPubFilePath,
+		PolicyFilePath:       policyFilePath,
+		AttestationFilePaths: bundlePaths,
+		AdditionalSubjects:   subjects,
+	}))
+
+	require.Error(t, runRun(context.Background(), options.RunOptions{
+		KeyOptions:   options.KeyOptions{KeyPath: funcPrivFilepath},
+		WorkingDir:   workingDir,
+		OutputFormat: "cbor",
+		StepName:     "step01",
+	}, []string{"true"}, nil))
+}
+
+func TestRunVerifyBinaryFormats(t *testing.T) {
+	policy, funcPriv := makepolicyRSAPub(t)
+	signedPolicy, pub := signPolicyRSA(t, policy)
+	workingDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(workingDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	artifactPath := filepath.Join(workingDir, "test.txt")
+	subjects := []string{}
+	attestationPaths := []string{}
+	for _, step := range []struct{ name, command, format string }{
+		{"step01", "echo 'test01' > test.txt", bundle.FormatDSSECBOR},
+		{"step02", "echo 'test02' >> test.txt", bundle.FormatDSSEProtobuf},
+	} {
+		outFilePath := filepath.Join(t.TempDir(), step.name+"."+step.format)
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:   options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:   workingDir,
+			OutFilePath:  outFilePath,
+			OutputFormat: step.format,
+			StepName:     step.name,
+		}, []string{"bash", "-c", step.command}, nil))
+
+		encoded, err := os.ReadFile(outFilePath)
+		require.NoError(t, err)
+		require.False(t, json.Valid(encoded))
+
+		attestationPaths = append(attestationPaths, outFilePath)
+		artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(artifactPath, []crypto.Hash{crypto.SHA256})
+		require.NoError(t, err)
+		for _, digest := range artifactDigest {
+			subjects = append(subjects, digest)
+		}
+	}
+
+	require.NoError(t, runVerify(context.Background(), options.VerifyOptions{
+		KeyPath:              policyPubFilePath,
+		PolicyFilePath:       policyFilePath,
+		AttestationFilePaths: attestationPaths,
+		AdditionalSubjects:   subjects,
+	}))
+}
+
+func TestRunVerifyPredicateType(t *testing.T) {
+	policy, funcPriv := makepolicyRSAPub(t)
+	signedPolicy, pub := signPolicyRSA(t, policy)
+	workingDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(workingDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	const environmentType = "https://example.com/attestations/environment/v1"
+	predicateTypes := map[string]string{"environment": environmentType}
+	artifactPath := filepath.Join(workingDir, "test.txt")
+	subjects := []string{}
+	attestationPaths := []string{}
+	for _, step := range []struct{ name, command string }{{"step01", "echo 'test01' > test.txt"}, {"step02", "echo 'test02' >> test.txt"}} {
+		attestationPath := filepath.Join(t.TempDir(), step.name+".json")
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:     options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:     workingDir,
+			Attestations:   []string{"environment"},
+			OutFilePath:    attestationPath,
+			StepName:       step.name,
+			PredicateTypes: predicateTypes,
+		}, []string{"bash", "-c", step.command}, nil))
+
+		envBytes, err := os.ReadFile(attestationPath)
+		require.NoError(t, err)
+		env := dsse.Envelope{}
+		require.NoError(t, json.Unmarshal(envBytes, &env))
+		require.Contains(t, string(env.Payload), environmentType)
+
+		attestationPaths = append(attestationPaths, attestationPath)
+		artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(artifactPath, []crypto.Hash{crypto.SHA256})
+		require.NoError(t, err)
+		for _, digest := range artifactDigest {
+			subjects = append(subjects, digest)
+		}
+	}
+
+	vo := options.VerifyOptions{
+		KeyPath:              policyPubFilePath,
+		PolicyFilePath:       policyFilePath,
+		AttestationFilePaths: attestationPaths,
+		AdditionalSubjects:   subjects,
+	}
+
+	// the collections can't be read until the custom predicate type is registered
+	require.Error(t, runVerify(context.Background(), vo))
+	vo.PredicateTypes = predicateTypes
+	require.NoError(t, runVerify(context.Background(), vo))
+
+	vo.PredicateTypes = map[string]string{"not-an-attestor": environmentType}
+	require.Error(t, runVerify(context.Background(), vo))
+}
+
+func TestRunVerifyDeduplicateDigests(t *testing.T) {
+	policy, funcPriv := makepolicyRSAPub(t)
+	signedPolicy, pub := signPolicyRSA(t, policy)
+	workingDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(workingDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	artifactPath := filepath.Join(workingDir, "test.txt")
+	subjects := []string{}
+	attestationPaths := []string{}
+	for _, step := range []struct{ name, command string }{{"step01", "echo 'test01' > test.txt && echo 'test01' > copy.txt"}, {"step02", "echo 'test02' >> test.txt"}} {
+		attestationPath := filepath.Join(t.TempDir(), step.name+".json")
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:         options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:         workingDir,
+			Attestations:       []string{},
+			OutFilePath:        attestationPath,
+			StepName:           step.name,
+			DeduplicateDigests: true,
+		}, []string{"bash", "-c", step.command}, nil))
+
+		envBytes, err := os.ReadFile(attestationPath)
+		require.NoError(t, err)
+		env := dsse.Envelope{}
+		require.NoError(t, json.Unmarshal(envBytes, &env))
+		require.Contains(t, string(env.Payload), `"contents":[`)
+
+		attestationPaths = append(attestationPaths, attestationPath)
+		artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(artifactPath, []crypto.Hash{crypto.SHA256})
+		require.NoError(t, err)
+		for _, digest := range artifactDigest {
+			subjects = append(subjects, digest)
+		}
+	}
+
+	require.NoError(t, runVerify(context.Background(), options.VerifyOptions{
+		KeyPath:              policyPubFilePath,
+		PolicyFilePath:       policyFilePath,
+		AttestationFilePaths: attestationPaths,
+		AdditionalSubjects:   subjects,
+	}))
+}
+
+func TestRunVerifyCache(t *testing.T) {
+	policy, funcPriv := makepolicyRSAPub(t)
+	signedPolicy, pub := signPolicyRSA(t, policy)
+	workingDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(workingDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	artifactPath := filepath.Join(workingDir, "test.txt")
+	subjects := []string{}
+	attestationPaths := []string{}
+	for _, step := range []struct{ name, command string }{{"step01", "echo 'test01' > test.txt"}, {"step02", "echo 'test02' >> test.txt"}} {
+		attestationPath := filepath.Join(t.TempDir(), step.name+".json")
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:  options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:  workingDir,
+			OutFilePath: attestationPath,
+			StepName:    step.name,
+		}, []string{"bash", "-c", step.command}, nil))
+
+		attestationPaths = append(attestationPaths, attestationPath)
+		artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(artifactPath, []crypto.Hash{crypto.SHA256})
+		require.NoError(t, err)
+		for _, digest := range artifactDigest {
+			subjects = append(subjects, digest)
+		}
+	}
+
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	cacheKeyPath := filepath.Join(t.TempDir(), "cache.key")
+	cacheKey := bytes.Repeat([]byte("k"), verify.MinCacheKeySize)
+	require.NoError(t, os.WriteFile(cacheKeyPath, cacheKey, 0600))
+	vo := options.VerifyOptions{
+		KeyPath:              policyPubFilePath,
+		PolicyFilePath:       policyFilePath,
+		AttestationFilePaths: attestationPaths,
+		AdditionalSubjects:   subjects,
+		Cache:                options.VerifyCacheOptions{Dir: cacheDir, TTL: time.Hour, KeyPath: cacheKeyPath},
+	}
+
+	require.NoError(t, runVerify(context.Background(), vo))
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.NoError(t, runVerify(context.Background(), vo))
+
+	// missing the second step fails, and the failure isn't cached
+	incomplete := vo
+	incomplete.AttestationFilePaths = attestationPaths[:1]
+	require.Error(t, runVerify(context.Background(), incomplete))
+	entries, err = os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// a success cached by someone without the cache key isn't taken as a verification
+	inputs, err := loadVerifyInputs(context.Background(), incomplete)
+	require.NoError(t, err)
+	key, err := inputs.cacheKey(incomplete)
+	require.NoError(t, err)
+	forger, err := verify.NewCache(cacheDir, time.Hour, bytes.Repeat([]byte("f"), verify.MinCacheKeySize))
+	require.NoError(t, err)
+	require.NoError(t, forger.Put(key, inputs.policyEnvelope, nil))
+	require.Error(t, runVerify(context.Background(), incomplete))
+
+	// a cached success is returned without verifying again
+	cache, err := verify.NewCache(cacheDir, time.Hour, cacheKey)
+	require.NoError(t, err)
+	require.NoError(t, cache.Put(key, inputs.policyEnvelope, nil))
+	require.NoError(t, runVerify(context.Background(), incomplete))
+
+	// the cache key is required, and can't be kept in the cache
+	unkeyed := incomplete
+	unkeyed.Cache.KeyPath = ""
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(runVerify(context.Background(), unkeyed)))
+	unkeyed.Cache.KeyPath = filepath.Join(cacheDir, "cache.key")
+	require.NoError(t, os.WriteFile(unkeyed.Cache.KeyPath, cacheKey, 0600))
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(runVerify(context.Background(), unkeyed)))
+
+	// the predicate types collections are parsed with and the cue command change the key, by content rather than path
+	schemaPath := filepath.Join(t.TempDir(), "schema.json")
+	require.NoError(t, os.WriteFile(schemaPath, []byte(`{"type": "object"}`), 0644))
+	cuePath := filepath.Join(t.TempDir(), "cue")
+	require.NoError(t, os.WriteFile(cuePath, []byte("#!/bin/sh\n"), 0755))
+	aliased := incomplete
+	aliased.PredicateTypes = map[string]string{"git": "https://example.com/git/v1"}
+	opaque := incomplete
+	opaque.OpaquePredicates = []string{"https://example.com/scan/v1=" + schemaPath}
+	withCUE := incomplete
+	withCUE.CUEPath = cuePath
+	keys := map[string]struct{}{key: {}}
+	for _, changed := range []options.VerifyOptions{aliased, opaque, withCUE} {
+		changedKey, err := inputs.cacheKey(changed)
+		require.NoError(t, err)
+		keys[changedKey] = struct{}{}
+	}
+
+	require.NoError(t, os.WriteFile(schemaPath, []byte(`{"type": "array"}`), 0644))
+	require.NoError(t, os.WriteFile(cuePath, []byte("#!/bin/sh\nexit 0\n"), 0755))
+	for _, changed := range []options.VerifyOptions{opaque, withCUE} {
+		changedKey, err := inputs.cacheKey(changed)
+		require.NoError(t, err)
+		keys[changedKey] = struct{}{}
+	}
+
+	require.Len(t, keys, 6)
+
+	// searching a store makes the evidence unknown up front, so nothing is cached
+	stored := incomplete
+	stored.StoreDir = t.TempDir()
+	require.Error(t, runVerify(context.Background(), stored))
+}
+
+func TestRunVerifyRevocations(t *testing.T) {
+	p, funcPriv := makepolicyRSAPub(t)
+	policyFields := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(p, &policyFields))
+	revocationSigners := []string{}
+	for keyID := range policyFields["publickeys"].(map[string]interface{}) {
+		revocationSigners = append(revocationSigners, keyID)
+	}
+
+	policyFields["revocationSigners"] = revocationSigners
+	p, err := json.Marshal(policyFields)
+	require.NoError(t, err)
+
+	signedPolicy, pub := signPolicyRSA(t, p)
+	workingDir := t.TempDir()
+	attestationDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	funcPrivFilepath := filepath.Join(attestationDir, "func-priv.pem")
+	require.NoError(t, os.WriteFile(funcPrivFilepath, funcPriv, 0644))
+
+	subjects := []string{}
+	attestationPaths := []string{}
+	for _, step := range []struct{ name, command string }{{"step01", "echo 'test01' > test.txt"}, {"step02", "echo 'test02' >> test.txt"}} {
+		attestationPath := filepath.Join(attestationDir, step.name+".json")
+		require.NoError(t, runRun(context.Background(), options.RunOptions{
+			KeyOptions:   options.KeyOptions{KeyPath: funcPrivFilepath},
+			WorkingDir:   workingDir,
+			Attestations: []string{},
+			OutFilePath:  attestationPath,
+			StepName:     step.name,
+		}, []string{"bash", "-c", step.command}, nil))
+		attestationPaths = append(attestationPaths, attestationPath)
+		artifactDigest, err := cryptoutil.CalculateDigestSetFromFile(filepath.Join(workingDir, "test.txt"), []crypto.Hash{crypto.SHA256})
+		require.NoError(t, err)
+		for _, digest := range artifactDigest {
+			subjects = append(subjects, digest)
+		}
+	}
+
+	vo := options.VerifyOptions{
+		KeyPath:              policyPubFilePath,
+		AttestationFilePaths: attestationPaths,
+		PolicyFilePath:       policyFilePath,
+		AdditionalSubjects:   subjects,
+	}
+
+	require.NoError(t, runVerify(context.Background(), vo))
+
+	step02Bytes, err := os.ReadFile(attestationPaths[1])
+	require.NoError(t, err)
+	step02 := dsse.Envelope{}
+	require.NoError(t, json.Unmarshal(step02Bytes, &step02))
+	payloadDigest := sha256.Sum256(step02.Payload)
+	revocations, err := json.Marshal(verify.Revocations{Attestations: []string{hex.EncodeToString(payloadDigest[:])}, Reason: "compromised runner"})
+	require.NoError(t, err)
+	revocationsPath := filepath.Join(attestationDir, "revocations.json")
+	require.NoError(t, os.WriteFile(revocationsPath, revocations, 0644))
+	signedRevocationsPath := filepath.Join(attestationDir, "revocations.signed.json")
+	require.NoError(t, runSign(options.SignOptions{
+		KeyOptions:   options.KeyOptions{KeyPath: funcPrivFilepath},
+		DataType:     verify.RevocationsType,
+		InFilePath:   revocationsPath,
+		OutFilePath:  signedRevocationsPath,
+		OutputFormat: bundle.FormatDSSE,
+	}))
+
+	// the revoked step02 no longer counts as evidence
+	vo.RevocationRefs = []string{signedRevocationsPath}
+	require.Error(t, runVerify(context.Background(), vo))
+
+	// revocation lists signed by anyone else are rejected
+	otherSigner, _, _, _, err := createTestRSAKey()
+	require.NoError(t, err)
+	otherRevocations := bytes.Buffer{}
+	require.NoError(t, witness.Sign(bytes.NewReader(revocations), verify.RevocationsType, &otherRevocations, dsse.SignWithSigners(otherSigner)))
+	otherRevocationsPath := filepath.Join(attestationDir, "revocations.other.json")
+	require.NoError(t, os.WriteFile(otherRevocationsPath, otherRevocations.Bytes(), 0644))
+	vo.RevocationRefs = []string{otherRevocationsPath}
+	require.Error(t, runVerify(context.Background(), vo))
+
+	vo.RevocationRefs = []string{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(runVerify(context.Background(), vo)))
+}
+
+func TestRunVerifyCheckBuildInfo(t *testing.T) {
+	policy, _ := makepolicyRSAPub(t)
+	signedPolicy, pub := signPolicyRSA(t, policy)
+	workingDir := t.TempDir()
+	policyFilePath := filepath.Join(workingDir, "signed-policy.json")
+	require.NoError(t, os.WriteFile(policyFilePath, signedPolicy, 0644))
+	policyPubFilePath := filepath.Join(workingDir, "policy-pub.pem")
+	require.NoError(t, os.WriteFile(policyPubFilePath, pub, 0644))
+	artifactPath := filepath.Join(workingDir, "test.txt")
+	require.NoError(t, os.WriteFile(artifactPath, []byte("not a go binary\n"), 0644))
+
+	vo := options.VerifyOptions{
+		KeyPath:            policyPubFilePath,
+		PolicyFilePath:     policyFilePath,
+		AdditionalSubjects: []string{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+		CheckBuildInfo:     true,
+	}
+
+	// the buildinfo is read from the artifact, so one is required
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(runVerify(context.Background(), vo)))
+
+	vo.ArtifactFilePath = artifactPath
+	err := runVerify(context.Background(), vo)
+	require.Equal(t, result.CategoryUsage, result.CategoryOf(err))
+	require.ErrorContains(t, err, "could not read buildinfo of "+artifactPath)
+}
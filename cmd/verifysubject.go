@@ -0,0 +1,163 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/timestamp"
+	"github.com/testifysec/witness/options"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+func VerifySubjectCmd() *cobra.Command {
+	o := options.VerifySubjectOptions{}
+	cmd := &cobra.Command{
+		Use:   "verify-subject",
+		Short: "Checks that an artifact is a subject of signed attestations",
+		Long: "Checks the signature of each attestation and whether the artifact's digest is one of its subjects, without a policy. " +
+			"Exits with code 0 if the artifact is a subject of at least one attestation whose signature verified.",
+		SilenceErrors:     true,
+		SilenceUsage:      true,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVerifySubject(cmd.Context(), o, cmd.OutOrStdout())
+		},
+	}
+
+	o.AddFlags(cmd)
+	return cmd
+}
+
+func runVerifySubject(ctx context.Context, o options.VerifySubjectOptions, out io.Writer) error {
+	if o.ArtifactFilePath == "" {
+		return result.Usage(errors.New("an artifact file is required"))
+	}
+
+	if len(o.AttestationFilePaths) == 0 {
+		return result.Usage(errors.New("at least one attestation file is required"))
+	}
+
+	if len(o.KeyPaths) == 0 && len(o.CAPaths) == 0 {
+		return result.Usage(errors.New("must supply public keys or ca paths"))
+	}
+
+	trust, err := loadSubjectTrust(o)
+	if err != nil {
+		return err
+	}
+
+	artifact, err := cryptoutil.CalculateDigestSetFromFile(o.ArtifactFilePath, []crypto.Hash{crypto.SHA256})
+	if err != nil {
+		return fmt.Errorf("failed to calculate artifact digest: %w", err)
+	}
+
+	envelopes, err := loadEnvelopes(o.AttestationFilePaths, "attestation")
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i, envelope := range envelopes {
+		path := o.AttestationFilePaths[i]
+		match, err := verify.VerifySubject(ctx, envelope, artifact, trust)
+		if err != nil {
+			if _, err := fmt.Fprintf(out, "%v: %v\n", path, err); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		found = true
+		if _, err := fmt.Fprintf(out, "%v: subject %v, signed by %v\n", path, strings.Join(match.Subjects, ", "), strings.Join(match.Signers, ", ")); err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return result.Policy(fmt.Errorf("%v is not a subject of any verified attestation", o.ArtifactFilePath))
+	}
+
+	return nil
+}
+
+func loadSubjectTrust(o options.VerifySubjectOptions) (verify.SubjectTrust, error) {
+	trust := verify.SubjectTrust{ClockSkew: o.ClockSkew}
+	if o.ClockSkew < 0 {
+		return trust, errors.New("clock skew must not be negative")
+	}
+
+	for _, keyPath := range o.KeyPaths {
+		keyBytes, err := os.ReadFile(keyPath)
+		if err != nil {
+			return trust, fmt.Errorf("failed to read public key %v: %w", keyPath, err)
+		}
+
+		verifier, err := verify.NewVerifierFromBytes(keyBytes)
+		if err != nil {
+			return trust, fmt.Errorf("failed to load public key %v: %w", keyPath, err)
+		}
+
+		trust.Verifiers = append(trust.Verifiers, verifier)
+	}
+
+	roots, err := loadCertificates(o.CAPaths)
+	if err != nil {
+		return trust, err
+	}
+
+	trust.Roots = roots
+	timestampCAs, err := loadCertificates(o.TimestampCAPaths)
+	if err != nil {
+		return trust, err
+	}
+
+	if len(timestampCAs) > 0 {
+		trust.TimestampVerifiers = []dsse.TimestampVerifier{timestamp.NewVerifier(timestamp.VerifyWithCerts(timestampCAs))}
+	}
+
+	return trust, nil
+}
+
+func loadCertificates(paths []string) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, len(paths))
+	for _, path := range paths {
+		certBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate %v: %w", path, err)
+		}
+
+		cert, err := cryptoutil.TryParseCertificate(certBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %v: %w", path, err)
+		}
+
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
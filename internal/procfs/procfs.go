@@ -0,0 +1,102 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package procfs reads processes from the Linux /proc filesystem.
+package procfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Stat is what witness reads of a process's /proc/<pid>/stat.
+type Stat struct {
+	Pid  int
+	Comm string
+	Ppid int
+}
+
+// ParseStat parses the contents of /proc/<pid>/stat. The command name in parentheses can contain spaces and
+// parentheses itself, so it runs to the last closing parenthesis and the other fields are counted from there.
+func ParseStat(data []byte) (Stat, error) {
+	start := bytes.IndexByte(data, '(')
+	end := bytes.LastIndexByte(data, ')')
+	if start < 0 || end < start {
+		return Stat{}, errors.New("command name not found")
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data[:start])))
+	if err != nil {
+		return Stat{}, fmt.Errorf("invalid pid: %w", err)
+	}
+
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 2 {
+		return Stat{}, errors.New("parent pid not found")
+	}
+
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return Stat{}, fmt.Errorf("invalid parent pid: %w", err)
+	}
+
+	return Stat{Pid: pid, Comm: string(data[start+1 : end]), Ppid: ppid}, nil
+}
+
+// ReadStat reads and parses /proc/<pid>/stat.
+func ReadStat(pid int) (Stat, error) {
+	path := filepath.Join("/proc", strconv.Itoa(pid), "stat")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Stat{}, err
+	}
+
+	stat, err := ParseStat(data)
+	if err != nil {
+		return Stat{}, fmt.Errorf("unexpected format of %v: %w", path, err)
+	}
+
+	return stat, nil
+}
+
+// Parents returns the parent of every running process, keyed by pid. Processes that exit while /proc is read are
+// left out.
+func Parents() (map[int]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make(map[int]int, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		stat, err := ReadStat(pid)
+		if err != nil {
+			continue
+		}
+
+		parents[pid] = stat.Ppid
+	}
+
+	return parents, nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStat(t *testing.T) {
+	tests := []struct {
+		name string
+		stat string
+		want Stat
+		err  string
+	}{
+		{name: "simple", stat: "42 (bash) S 7 42 42 0 -1", want: Stat{Pid: 42, Comm: "bash", Ppid: 7}},
+		{name: "spaces", stat: "42 (tmux: server) S 1 42 42 0 -1", want: Stat{Pid: 42, Comm: "tmux: server", Ppid: 1}},
+		{name: "parentheses", stat: "42 (a) S 9 (b)) R 3 42 42 0 -1", want: Stat{Pid: 42, Comm: "a) S 9 (b)", Ppid: 3}},
+		{name: "no command", stat: "42 bash S 7", err: "command name not found"},
+		{name: "truncated", stat: "42 (bash) S", err: "parent pid not found"},
+		{name: "bad parent", stat: "42 (bash) S x", err: "invalid parent pid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stat, err := ParseStat([]byte(tt.stat))
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, stat)
+		})
+	}
+}
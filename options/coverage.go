@@ -0,0 +1,33 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"github.com/spf13/cobra"
+)
+
+type CoverageOptions struct {
+	VerifyOptions  VerifyOptions
+	Subjects       []string
+	FromArchivista bool
+	JSON           bool
+}
+
+func (co *CoverageOptions) AddFlags(cmd *cobra.Command) {
+	co.VerifyOptions.AddFlags(cmd)
+	cmd.Flags().StringSliceVar(&co.Subjects, "subject", []string{}, "Digests of the subjects to report the evidence of, the same as --subjects")
+	cmd.Flags().BoolVar(&co.FromArchivista, "from-archivista", false, "Search Archivista for the evidence, the same as --enable-archivista")
+	cmd.Flags().BoolVar(&co.JSON, "json", false, "Print the report as JSON")
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/testifysec/witness/pkg/bundle"
+)
+
+type DeployOptions struct {
+	VerifyOptions     VerifyOptions
+	KeyOptions        KeyOptions
+	Cluster           string
+	Namespace         string
+	StepName          string
+	OutFilePath       string
+	OutputFormat      string
+	BundleOutFilePath string
+	TimestampServers  []string
+}
+
+func (do *DeployOptions) AddFlags(cmd *cobra.Command) {
+	do.VerifyOptions.AddFlags(cmd)
+	// the verify flags already use -k and -i, so the signing flags are added without their shorthands
+	signing := &cobra.Command{}
+	do.KeyOptions.AddFlags(signing)
+	signing.Flags().VisitAll(func(flag *pflag.Flag) {
+		flag.Shorthand = ""
+		cmd.Flags().AddFlag(flag)
+	})
+
+	cmd.Flags().StringVar(&do.Cluster, "cluster", "", "Cluster the artifact is deployed to")
+	cmd.Flags().StringVar(&do.Namespace, "namespace", "", "Namespace of the cluster the artifact is deployed to")
+	cmd.Flags().StringVar(&do.StepName, "step", "deploy", "Name of the step the deployment is recorded as")
+	cmd.Flags().StringVarP(&do.OutFilePath, "outfile", "o", "", "File to which to write the signed deployment.  Defaults to stdout")
+	cmd.Flags().StringVar(&do.OutputFormat, "output-format", bundle.FormatDSSE, fmt.Sprintf("Format to write the signed envelope to the out file in. One of %v", strings.Join(bundle.Formats, ", ")))
+	cmd.Flags().StringVar(&do.BundleOutFilePath, "sigstore-bundle-outfile", "", "File to also write the signed envelope to as a Sigstore bundle")
+	cmd.Flags().StringSliceVar(&do.TimestampServers, "timestamp-servers", []string{}, "Timestamp Authority Servers to use when signing envelope")
+}
@@ -0,0 +1,41 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type DoctorOptions struct {
+	KeyOptions        KeyOptions
+	ArchivistaOptions ArchivistaOptions
+	PolicyFilePath    string
+	CAPaths           []string
+	TimestampServers  []string
+	WarnWithin        time.Duration
+	Timeout           time.Duration
+}
+
+func (do *DoctorOptions) AddFlags(cmd *cobra.Command) {
+	do.KeyOptions.AddFlags(cmd)
+	do.ArchivistaOptions.AddFlags(cmd)
+	cmd.Flags().StringVarP(&do.PolicyFilePath, "policy", "p", "", "Path to a signed policy to check")
+	cmd.Flags().StringSliceVar(&do.CAPaths, "policy-ca", []string{}, "Paths to CA certificates used to verify policies to check")
+	cmd.Flags().StringSliceVar(&do.TimestampServers, "timestamp-servers", []string{}, "Timestamp Authority Servers to check")
+	cmd.Flags().DurationVar(&do.WarnWithin, "warn-within", 30*24*time.Hour, "Warn about certificates and policies that expire within this duration")
+	cmd.Flags().DurationVar(&do.Timeout, "timeout", 10*time.Second, "Time to wait for each service to respond")
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import "github.com/spf13/cobra"
+
+type ExportAuditOptions struct {
+	VerifyOptions VerifyOptions
+	OutputDir     string
+	MaxSize       int64
+	Serial        string
+}
+
+func (eo *ExportAuditOptions) AddFlags(cmd *cobra.Command) {
+	eo.VerifyOptions.AddFlags(cmd)
+	cmd.Flags().StringVarP(&eo.OutputDir, "output", "o", "", "Directory to write the audit package to. The directory must not exist or be empty")
+	cmd.Flags().Int64Var(&eo.MaxSize, "max-size", 0, "Maximum size of the audit package in bytes. Nothing is written if the package would be larger. 0 means no limit")
+	cmd.Flags().StringVar(&eo.Serial, "serial", "", "Serial number to record in the audit package. Defaults to a timestamp based serial")
+}
+
+type ExportOSCALOptions struct {
+	VerifyOptions    VerifyOptions
+	OutFilePath      string
+	Serial           string
+	Controls         []string
+	AttestationTypes []string
+}
+
+func (eo *ExportOSCALOptions) AddFlags(cmd *cobra.Command) {
+	eo.VerifyOptions.AddFlags(cmd)
+	cmd.Flags().StringVarP(&eo.OutFilePath, "outfile", "o", "", "File to write the OSCAL assessment results to. Defaults to stdout")
+	cmd.Flags().StringVar(&eo.Serial, "serial", "", "Serial number to record in the assessment results. Defaults to a timestamp based serial")
+	cmd.Flags().StringSliceVar(&eo.Controls, "control", []string{}, "Controls the evidence of a step supports, in the form control-id=step, such as cm-3=review. Repeat to map a control to several steps")
+	cmd.Flags().StringSliceVar(&eo.AttestationTypes, "include-attestation", []string{}, "Types of attestations to attach to the assessment results individually, in addition to the signed envelopes of their collections")
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import "github.com/spf13/cobra"
+
+// GroupsSCIMOptions configure the SCIM service functionary groups are resolved from.
+type GroupsSCIMOptions struct {
+	URL       string
+	TokenFile string
+}
+
+func (gso *GroupsSCIMOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&gso.URL, "groups-scim-url", "", "Base URL of a SCIM 2.0 service to resolve the functionary groups named by the policy from, such as https://idp.example.com/scim/v2")
+	cmd.Flags().StringVar(&gso.TokenFile, "groups-scim-token-file", "", "File containing the bearer token to authenticate to the SCIM service with")
+}
+
+// GroupsLDAPOptions configure the LDAP directory functionary groups are resolved from.
+type GroupsLDAPOptions struct {
+	URL          string
+	BaseDN       string
+	BindDN       string
+	PasswordFile string
+	Tool         string
+}
+
+func (glo *GroupsLDAPOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&glo.URL, "groups-ldap-url", "", "URL of an LDAP directory to resolve the functionary groups named by the policy from, such as ldaps://ldap.example.com. Groups are looked up by common name with ldapsearch")
+	cmd.Flags().StringVar(&glo.BaseDN, "groups-ldap-base-dn", "", "Base DN groups are searched for under in the LDAP directory, such as dc=example,dc=com")
+	cmd.Flags().StringVar(&glo.BindDN, "groups-ldap-bind-dn", "", "DN to bind to the LDAP directory as. Binds anonymously if unset")
+	cmd.Flags().StringVar(&glo.PasswordFile, "groups-ldap-password-file", "", "File containing the password of --groups-ldap-bind-dn, without a trailing newline")
+	cmd.Flags().StringVar(&glo.Tool, "groups-ldap-tool", "ldapsearch", "Path to the ldapsearch binary of the OpenLDAP clients")
+}
+
+type GroupsResolveOptions struct {
+	KeyOptions     KeyOptions
+	SCIM           GroupsSCIMOptions
+	LDAP           GroupsLDAPOptions
+	PolicyFilePath string
+	Groups         []string
+	OutFilePath    string
+}
+
+func (gro *GroupsResolveOptions) AddFlags(cmd *cobra.Command) {
+	gro.KeyOptions.AddFlags(cmd)
+	gro.SCIM.AddFlags(cmd)
+	gro.LDAP.AddFlags(cmd)
+	cmd.Flags().StringVarP(&gro.PolicyFilePath, "policy", "p", "", "Path to a policy whose functionary groups are resolved. A signed policy is read from its envelope")
+	cmd.Flags().StringSliceVar(&gro.Groups, "group", []string{}, "Names of groups to resolve, in addition to the groups of --policy")
+	cmd.Flags().StringVarP(&gro.OutFilePath, "outfile", "o", "", "File to write the signed group snapshot to. Defaults to stdout")
+}
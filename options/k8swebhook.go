@@ -0,0 +1,64 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/witness/pkg/reload"
+)
+
+// PolicySourceOptions select the signed policy a server verifies against and the keys trusted to sign it. Both are
+// reloaded while the server runs.
+type PolicySourceOptions struct {
+	Policy         string
+	KeyPaths       []string
+	ReloadInterval time.Duration
+}
+
+func (po *PolicySourceOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&po.Policy, "policy", "p", "", "Signed policy to verify against. A file, an oci:// reference to an artifact in a registry, or a gitoid to download from Archivista")
+	cmd.Flags().StringSliceVarP(&po.KeyPaths, "publickey", "k", []string{}, "Paths to the public keys trusted to sign the policy")
+	cmd.Flags().DurationVar(&po.ReloadInterval, "policy-reload-interval", reload.DefaultInterval, "How often the policy and keys are checked for changes. 0 only reloads them on SIGHUP")
+}
+
+type K8sWebhookOptions struct {
+	PolicySource      PolicySourceOptions
+	RoutingConfigPath string
+	ArchivistaOptions ArchivistaOptions
+	Listen            string
+	TLSCertPath       string
+	TLSKeyPath        string
+	RegistryPlainHTTP bool
+	ClockSkew         time.Duration
+	Environment       string
+	MetricsListen     string
+	AuditLog          AuditLogOptions
+}
+
+func (wo *K8sWebhookOptions) AddFlags(cmd *cobra.Command) {
+	wo.PolicySource.AddFlags(cmd)
+	cmd.Flags().StringVar(&wo.RoutingConfigPath, "routing-config", "", "Path to a routing config that selects the policy and keys each image is verified against by namespace, repository, and Pod labels, instead of --policy and --publickey")
+	wo.ArchivistaOptions.AddFlags(cmd)
+	cmd.Flags().StringVar(&wo.Listen, "listen", ":8443", "Address to serve admission reviews on")
+	cmd.Flags().StringVar(&wo.TLSCertPath, "tls-cert", "", "Path to the PEM certificate to serve with. The Kubernetes API server only calls webhooks over HTTPS")
+	cmd.Flags().StringVar(&wo.TLSKeyPath, "tls-key", "", "Path to the PEM private key of --tls-cert")
+	cmd.Flags().BoolVar(&wo.RegistryPlainHTTP, "registry-plain-http", false, "Talk to registries over HTTP rather than HTTPS, for local test registries")
+	cmd.Flags().DurationVar(&wo.ClockSkew, "clock-skew", 0, "Tolerance allowed when checking certificate validity and policy expiration against the verifier's clock or trusted timestamps")
+	cmd.Flags().StringVar(&wo.Environment, "environment", "", "Environment the images are verified for, such as production. Steps of the policy limited to other environments are not required")
+	addMetricsFlag(cmd, &wo.MetricsListen)
+	wo.AuditLog.AddFlags(cmd)
+}
@@ -17,23 +17,125 @@ package options
 import "github.com/spf13/cobra"
 
 type KeyOptions struct {
-	KeyPath           string
-	CertPath          string
-	IntermediatePaths []string
-	SpiffePath        string
-	FulcioURL         string
-	OIDCIssuer        string
-	OIDCClientID      string
-	Token             string
+	KeyPath            string
+	AdditionalKeyPaths []string
+	CertPath           string
+	IntermediatePaths  []string
+	FetchIntermediates bool
+	SpiffePath         string
+	FulcioURL          string
+	OIDCIssuer         string
+	OIDCClientID       string
+	Token              string
+	RemoteSigner       RemoteSignerOptions
+	GPG                GPGOptions
+	SSH                SSHOptions
+	PIV                PIVOptions
+	SMIME              SMIMEOptions
+	TPM                TPMOptions
+	PKCS11             PKCS11Options
+	AzureKMS           AzureKMSOptions
+	GCPKMS             GCPKMSOptions
+}
+
+type RemoteSignerOptions struct {
+	URL            string
+	KeyID          string
+	ClientCertPath string
+	ClientKeyPath  string
+	CAPath         string
+}
+
+type GPGOptions struct {
+	KeyPath        string
+	PassphraseFile string
+	AgentKeyID     string
+}
+
+type SSHOptions struct {
+	AgentKey    string
+	AgentSocket string
+}
+
+type PIVOptions struct {
+	Slots   []string
+	PINFile string
+	Reader  string
+}
+
+type TPMOptions struct {
+	Keys      []string
+	AuthFile  string
+	TCTI      string
+	CertPaths []string
+}
+
+type PKCS11Options struct {
+	Module    string
+	Slot      string
+	PINFile   string
+	KeyLabels []string
+	KeyIDs    []string
+	CertPaths []string
+}
+
+type AzureKMSOptions struct {
+	URLs             []string
+	TenantID         string
+	ClientID         string
+	ClientSecretFile string
+}
+
+type GCPKMSOptions struct {
+	Keys            []string
+	CredentialsFile string
+}
+
+type SMIMEOptions struct {
+	PKCS12Path   string
+	PasswordFile string
 }
 
 func (ko *KeyOptions) AddFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&ko.Token, "fulcio-token", "", "Raw token to use for authentication")
 	cmd.Flags().StringVarP(&ko.KeyPath, "key", "k", "", "Path to the signing key")
+	cmd.Flags().StringSliceVar(&ko.AdditionalKeyPaths, "additional-key", []string{}, "Paths to more signing keys. witness run signs the envelope with each of them alongside any other signer, such as an organizational key co-signing a build key")
 	cmd.Flags().StringVar(&ko.CertPath, "certificate", "", "Path to the signing key's certificate")
 	cmd.Flags().StringSliceVarP(&ko.IntermediatePaths, "intermediates", "i", []string{}, "Intermediates that link trust back to a root of trust in the policy")
+	cmd.Flags().BoolVar(&ko.FetchIntermediates, "fetch-intermediates", false, "Fetch missing intermediates of the signing certificate from its Authority Information Access extension and include them in signatures")
 	cmd.Flags().StringVar(&ko.SpiffePath, "spiffe-socket", "", "Path to the SPIFFE Workload API socket")
 	cmd.Flags().StringVar(&ko.FulcioURL, "fulcio", "", "Fulcio address to sign with")
 	cmd.Flags().StringVar(&ko.OIDCIssuer, "fulcio-oidc-issuer", "", "OIDC issuer to use for authentication")
 	cmd.Flags().StringVar(&ko.OIDCClientID, "fulcio-oidc-client-id", "", "OIDC client ID to use for authentication")
+	cmd.Flags().StringVar(&ko.RemoteSigner.URL, "remote-signer", "", "URL of a signing service to sign with")
+	cmd.Flags().StringVar(&ko.RemoteSigner.KeyID, "remote-signer-key-id", "", "ID of the key the signing service should sign with")
+	cmd.Flags().StringVar(&ko.RemoteSigner.ClientCertPath, "remote-signer-client-cert", "", "Path to the client certificate to authenticate to the signing service with")
+	cmd.Flags().StringVar(&ko.RemoteSigner.ClientKeyPath, "remote-signer-client-key", "", "Path to the private key of the client certificate for the signing service")
+	cmd.Flags().StringVar(&ko.RemoteSigner.CAPath, "remote-signer-ca", "", "Path to a CA certificate bundle used to verify the signing service's certificate instead of the system roots")
+	cmd.Flags().StringVar(&ko.GPG.KeyPath, "gpg-key", "", "Path to an OpenPGP private key to sign with")
+	cmd.Flags().StringVar(&ko.GPG.PassphraseFile, "gpg-passphrase-file", "", "Path to a file containing the passphrase of the OpenPGP private key")
+	cmd.Flags().StringVar(&ko.GPG.AgentKeyID, "gpg-agent-key", "", "Fingerprint, key ID, or user ID of a key to sign with through gpg and gpg-agent")
+	cmd.Flags().StringVar(&ko.SSH.AgentKey, "ssh-agent-key", "", "Fingerprint, comment, or public key file of an ssh-agent key to sign with")
+	cmd.Flags().StringVar(&ko.SSH.AgentSocket, "ssh-agent-socket", "", "Path to the ssh-agent socket. Defaults to SSH_AUTH_SOCK")
+	cmd.Flags().StringSliceVar(&ko.PIV.Slots, "signer-piv-slot", []string{}, "PIV slots of a hardware token, such as 9c, to sign with through yubico-piv-tool. Each slot signs the envelope")
+	cmd.Flags().StringVar(&ko.PIV.PINFile, "signer-piv-pin-file", "", "Path to a file containing the PIV PIN. When not set, the PIN is prompted for on the terminal")
+	cmd.Flags().StringVar(&ko.SMIME.PKCS12Path, "smime-p12", "", "Path to a PKCS #12 file with an S/MIME certificate and its key to sign with, such as one issued to a person by a corporate PKI")
+	cmd.Flags().StringVar(&ko.SMIME.PasswordFile, "smime-password-file", "", "Path to a file containing the password of the PKCS #12 file")
+	cmd.Flags().StringSliceVar(&ko.TPM.Keys, "signer-tpm-key", []string{}, "Persistent handles, such as 0x81010001, or context files of TPM 2.0 signing keys to sign with through tpm2-tools. Each key signs the envelope")
+	cmd.Flags().StringVar(&ko.TPM.AuthFile, "signer-tpm-auth-file", "", "Path to a file containing the auth value of the TPM key, if it has one")
+	cmd.Flags().StringVar(&ko.TPM.TCTI, "signer-tpm-tcti", "", "TCTI to reach the TPM through, such as device:/dev/tpmrm0. Defaults to TPM2TOOLS_TCTI or the tpm2-tools default")
+	cmd.Flags().StringSliceVar(&ko.TPM.CertPaths, "signer-tpm-certificate", []string{}, "Paths to certificates issued to the TPM keys to include in signatures, one for each --signer-tpm-key in the same order")
+	cmd.Flags().StringVar(&ko.PKCS11.Module, "signer-pkcs11-module", "", "Path to the PKCS#11 module of an HSM or token to sign with through pkcs11-tool, such as /usr/lib/softhsm/libsofthsm2.so")
+	cmd.Flags().StringVar(&ko.PKCS11.Slot, "signer-pkcs11-slot", "", "ID of the PKCS#11 slot the token is in. Defaults to the first slot with a token")
+	cmd.Flags().StringVar(&ko.PKCS11.PINFile, "signer-pkcs11-pin-file", "", "Path to a file containing the PKCS#11 user PIN. When not set, the PIN is prompted for on the terminal")
+	cmd.Flags().StringSliceVar(&ko.PKCS11.KeyLabels, "signer-pkcs11-key-label", []string{}, "Labels of the PKCS#11 keys to sign with. Each key signs the envelope")
+	cmd.Flags().StringSliceVar(&ko.PKCS11.KeyIDs, "signer-pkcs11-key-id", []string{}, "Hex encoded IDs of the PKCS#11 keys to sign with, such as 01. When given with --signer-pkcs11-key-label, there must be one for each label in the same order")
+	cmd.Flags().StringSliceVar(&ko.PKCS11.CertPaths, "signer-pkcs11-certificate", []string{}, "Paths to certificates issued to the PKCS#11 keys to include in signatures, one for each key in the same order")
+	cmd.Flags().StringSliceVar(&ko.AzureKMS.URLs, "signer-azurekms-url", []string{}, "URLs of Azure Key Vault keys to sign with, such as https://myvault.vault.azure.net/keys/witness. Each key signs the envelope")
+	cmd.Flags().StringVar(&ko.AzureKMS.TenantID, "signer-azurekms-tenant-id", "", "Tenant of the service principal to authenticate to Azure Key Vault as. Defaults to AZURE_TENANT_ID")
+	cmd.Flags().StringVar(&ko.AzureKMS.ClientID, "signer-azurekms-client-id", "", "Client ID of the service principal or user-assigned managed identity to authenticate to Azure Key Vault as. Defaults to AZURE_CLIENT_ID")
+	cmd.Flags().StringVar(&ko.AzureKMS.ClientSecretFile, "signer-azurekms-client-secret-file", "", "Path to a file containing the client secret of the service principal. When neither it nor AZURE_CLIENT_SECRET is set, the managed identity of the host is used")
+	cmd.Flags().StringSliceVar(&ko.GCPKMS.Keys, "signer-gcpkms-key", []string{}, "Resource names of Google Cloud KMS key versions to sign with, such as projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1. Each key signs the envelope")
+	cmd.Flags().StringVar(&ko.GCPKMS.CredentialsFile, "signer-gcpkms-credentials-file", "", "Path to a service account key, user credentials, or workload identity federation (external_account) file to authenticate to Google Cloud KMS with. Defaults to Application Default Credentials")
+	cmd.Flags().StringVar(&ko.PIV.Reader, "signer-piv-reader", "", "Name of the smartcard reader to use when more than one token is connected")
 }
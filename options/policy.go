@@ -0,0 +1,74 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/witness/pkg/bundle"
+)
+
+type PolicyRevokeKeyOptions struct {
+	PolicyFilePath string
+	KeyID          string
+	PublicKeyPath  string
+	CompromisedAt  string
+	OutFilePath    string
+}
+
+func (po *PolicyRevokeKeyOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&po.PolicyFilePath, "policy", "p", "", "Path to the policy to revoke the key in. A signed policy is read from its envelope")
+	cmd.Flags().StringVar(&po.KeyID, "key-id", "", "ID of the compromised public key in the policy")
+	cmd.Flags().StringVarP(&po.PublicKeyPath, "publickey", "k", "", "Path to the compromised public key, as an alternative to --key-id")
+	cmd.Flags().StringVar(&po.CompromisedAt, "compromised-at", "", "Time the key was compromised at in RFC 3339 format, such as 2023-06-01T00:00:00Z. Signatures of the key are only accepted with a trusted timestamp from before then. Defaults to now")
+	cmd.Flags().StringVarP(&po.OutFilePath, "outfile", "o", "", "File to write the unsigned policy to. Defaults to stdout")
+}
+
+type PolicyInitOptions struct {
+	AttestationFilePaths []string
+	PublicKeyPaths       []string
+	RootCAPaths          []string
+	Expires              time.Duration
+	OutFilePath          string
+}
+
+func (po *PolicyInitOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVarP(&po.AttestationFilePaths, "attestations", "a", []string{}, "Example attestations to scaffold the policy from, such as those of a known good run of the pipeline. Each step they were recorded for becomes a step of the policy")
+	cmd.Flags().StringSliceVarP(&po.PublicKeyPaths, "publickey", "k", []string{}, "Public keys that signed the example attestations. Steps signed by one of them may be performed by it")
+	cmd.Flags().StringSliceVar(&po.RootCAPaths, "root-ca", []string{}, "CA certificates that issued the certificates the example attestations were signed with. Steps signed with a certificate they issued may be performed by the identity in the certificate")
+	cmd.Flags().DurationVar(&po.Expires, "expires", 365*24*time.Hour, "How long from now the policy is valid for")
+	cmd.Flags().StringVarP(&po.OutFilePath, "outfile", "o", "", "File to write the unsigned policy to. Defaults to stdout")
+}
+
+type PolicySignOptions struct {
+	KeyOptions        KeyOptions
+	PolicyFilePath    string
+	OutFilePath       string
+	TimestampServers  []string
+	OutputFormat      string
+	BundleOutFilePath string
+}
+
+func (po *PolicySignOptions) AddFlags(cmd *cobra.Command) {
+	po.KeyOptions.AddFlags(cmd)
+	cmd.Flags().StringVarP(&po.PolicyFilePath, "policy", "p", "", "Path to the unsigned policy to check and sign")
+	cmd.Flags().StringVarP(&po.OutFilePath, "outfile", "o", "", "File to write the signed policy to. Defaults to stdout")
+	cmd.Flags().StringSliceVar(&po.TimestampServers, "timestamp-servers", []string{}, "Timestamp Authority Servers to use when signing the policy")
+	cmd.Flags().StringVar(&po.OutputFormat, "output-format", bundle.FormatDSSE, fmt.Sprintf("Format to write the signed policy to the out file in. One of %v", strings.Join(bundle.Formats, ", ")))
+	cmd.Flags().StringVar(&po.BundleOutFilePath, "sigstore-bundle-outfile", "", "File to also write the signed policy to as a Sigstore bundle")
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/testifysec/witness/pkg/bundle"
+)
+
+type PromoteOptions struct {
+	VerifyOptions     VerifyOptions
+	KeyOptions        KeyOptions
+	Source            string
+	Destination       string
+	StepName          string
+	OutFilePath       string
+	OutputFormat      string
+	BundleOutFilePath string
+	TimestampServers  []string
+}
+
+func (po *PromoteOptions) AddFlags(cmd *cobra.Command) {
+	po.VerifyOptions.AddFlags(cmd)
+	// the verify flags already use -k and -i, so the signing flags are added without their shorthands
+	signing := &cobra.Command{}
+	po.KeyOptions.AddFlags(signing)
+	signing.Flags().VisitAll(func(flag *pflag.Flag) {
+		flag.Shorthand = ""
+		cmd.Flags().AddFlag(flag)
+	})
+
+	cmd.Flags().StringVar(&po.Source, "from", "", "Reference the artifact is promoted from, such as registry.example.com/staging/app:v1.2.0")
+	cmd.Flags().StringVar(&po.Destination, "to", "", "Reference the artifact is promoted to, such as registry.example.com/production/app:v1.2.0")
+	cmd.Flags().StringVar(&po.StepName, "step", "promote", "Name of the step the promotion is recorded as")
+	cmd.Flags().StringVarP(&po.OutFilePath, "outfile", "o", "", "File to which to write the signed promotion.  Defaults to stdout")
+	cmd.Flags().StringVar(&po.OutputFormat, "output-format", bundle.FormatDSSE, fmt.Sprintf("Format to write the signed envelope to the out file in. One of %v", strings.Join(bundle.Formats, ", ")))
+	cmd.Flags().StringVar(&po.BundleOutFilePath, "sigstore-bundle-outfile", "", "File to also write the signed envelope to as a Sigstore bundle")
+	cmd.Flags().StringSliceVar(&po.TimestampServers, "timestamp-servers", []string{}, "Timestamp Authority Servers to use when signing envelope")
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/testifysec/witness/pkg/bundle"
+)
+
+type ReleaseGateOptions struct {
+	VerifyOptions     VerifyOptions
+	KeyOptions        KeyOptions
+	VerifierID        string
+	ResourceURI       string
+	VerifiedLevels    []string
+	OutFilePath       string
+	OutputFormat      string
+	BundleOutFilePath string
+	TimestampServers  []string
+	NotifyURLs        []string
+}
+
+func (ro *ReleaseGateOptions) AddFlags(cmd *cobra.Command) {
+	ro.VerifyOptions.AddFlags(cmd)
+	ro.VerifyOptions.AuditLog.AddFlags(cmd)
+	// the verify flags already use -k and -i, so the signing flags are added without their shorthands
+	signing := &cobra.Command{}
+	ro.KeyOptions.AddFlags(signing)
+	signing.Flags().VisitAll(func(flag *pflag.Flag) {
+		flag.Shorthand = ""
+		cmd.Flags().AddFlag(flag)
+	})
+
+	cmd.Flags().StringVar(&ro.VerifierID, "verifier-id", "https://witness.dev/release-gate", "URI identifying the verifier in the verification summary")
+	cmd.Flags().StringVar(&ro.ResourceURI, "resource-uri", "", "URI of the artifact being released, such as pkg:oci/app@sha256:... Defaults to the image or artifact file")
+	cmd.Flags().StringSliceVar(&ro.VerifiedLevels, "verified-levels", []string{}, "SLSA levels the policy verifies, such as SLSA_BUILD_LEVEL_3, recorded in the verification summary when the gate passes")
+	cmd.Flags().StringVarP(&ro.OutFilePath, "outfile", "o", "", "File to which to write the signed verification summary.  Defaults to stdout")
+	cmd.Flags().StringVar(&ro.OutputFormat, "output-format", bundle.FormatDSSE, fmt.Sprintf("Format to write the signed envelope to the out file in. One of %v", strings.Join(bundle.Formats, ", ")))
+	cmd.Flags().StringVar(&ro.BundleOutFilePath, "sigstore-bundle-outfile", "", "File to also write the signed envelope to as a Sigstore bundle")
+	cmd.Flags().StringSliceVar(&ro.TimestampServers, "timestamp-servers", []string{}, "Timestamp Authority Servers to use when signing envelope")
+	cmd.Flags().StringSliceVar(&ro.NotifyURLs, "notify", []string{}, "Webhook URLs to POST the outcome of the gate to, such as a Slack or Mattermost incoming webhook")
+}
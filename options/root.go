@@ -17,11 +17,13 @@ package options
 import "github.com/spf13/cobra"
 
 type RootOptions struct {
-	Config   string
-	LogLevel string
+	Config     string
+	LogLevel   string
+	ResultFile string
 }
 
 func (ro *RootOptions) AddFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringVarP(&ro.Config, "config", "c", ".witness.yaml", "Path to the witness config file")
 	cmd.PersistentFlags().StringVarP(&ro.LogLevel, "log-level", "l", "info", "Level of logging to output (debug, info, warn, error)")
+	cmd.PersistentFlags().StringVar(&ro.ResultFile, "result-file", "", "Path to write a JSON result of the command to, including the category of any error and the exit code")
 }
@@ -16,21 +16,65 @@ package options
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/testifysec/go-witness/attestation"
 	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/profile"
 )
 
 type RunOptions struct {
-	KeyOptions         KeyOptions
-	ArchivistaOptions  ArchivistaOptions
-	WorkingDir         string
-	Attestations       []string
-	OutFilePath        string
-	StepName           string
-	Tracing            bool
-	TimestampServers   []string
+	KeyOptions                  KeyOptions
+	ArchivistaOptions           ArchivistaOptions
+	WorkingDir                  string
+	Attestations                []string
+	OutFilePath                 string
+	StepName                    string
+	Tracing                     bool
+	TraceDegraded               bool
+	CaptureProfile              string
+	SubjectNames                map[string]string
+	SubjectFiles                []string
+	SubjectCommands             []string
+	CIContext                   bool
+	PreviousEnvelopes           []string
+	MaterialAttestations        []string
+	MaterialAttestationKeyPaths []string
+	MaterialAttestationCAPaths  []string
+	TimestampServers            []string
+	StoreDir                    string
+	StoreOCI                    string
+	StoreOCIPlainHTTP           bool
+	RekorServer                 string
+	RekorPublicKeyPath          string
+	Anonymize                   bool
+	AnonymizeReplacements       map[string]string
+	ScopePath                   string
+	ScopeTarget                 string
+	OutputFormat                string
+	BundleOutFilePath           string
+	PredicateTypes              map[string]string
+	MaxRunDuration              time.Duration
+	GracePeriod                 time.Duration
+	DeduplicateDigests          bool
+	HashWorkers                 int
+	MaxAttestorConcurrency      int
+	AttestorTimeouts            map[string]string
+	AttestorFailurePolicy       string
+	StatementVersion            string
+	StrictInToto                bool
+	Deterministic               bool
+	RecordTimes                 bool
+	SignerThreshold             int
+	EventLog                    string
+	SLSAOutFilePath             string
+	DryRun                      bool
+	// Existing records the working directory as it is, with no command, for witness attest. Every file is
+	// recorded as both a material and a product.
+	Existing           bool
 	AttestorOptSetters map[string][]func(attestation.Attestor) (attestation.Attestor, error)
 }
 
@@ -40,9 +84,46 @@ func (ro *RunOptions) AddFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&ro.WorkingDir, "workingdir", "d", "", "Directory from which commands will run")
 	cmd.Flags().StringSliceVarP(&ro.Attestations, "attestations", "a", []string{"environment", "git"}, "Attestations to record")
 	cmd.Flags().StringVarP(&ro.OutFilePath, "outfile", "o", "", "File to which to write signed data.  Defaults to stdout")
+	cmd.Flags().StringVar(&ro.OutputFormat, "output-format", bundle.FormatDSSE, fmt.Sprintf("Format to write the signed envelope to the out file in. One of %v", strings.Join(bundle.Formats, ", ")))
+	cmd.Flags().StringVar(&ro.BundleOutFilePath, "sigstore-bundle-outfile", "", "File to also write the signed envelope to as a Sigstore bundle")
 	cmd.Flags().StringVarP(&ro.StepName, "step", "s", "", "Name of the step being run")
+	cmd.Flags().StringVar(&ro.ScopePath, "scope-path", "", "Subdirectory of the working directory to restrict the material, product, and git attestors to. The step name is suffixed with the scope's target")
+	cmd.Flags().StringVar(&ro.ScopeTarget, "scope-target", "", "Target identifier to suffix the step name with when --scope-path is set. Defaults to the scope path with slashes replaced by dashes")
 	cmd.Flags().BoolVar(&ro.Tracing, "trace", false, "Enable tracing for the command")
+	cmd.Flags().BoolVar(&ro.TraceDegraded, "trace-degraded", false, "Run the command without tracing if tracing was requested but the host can't trace, recording that in the tracestatus attestation instead of failing")
+	cmd.Flags().StringToStringVar(&ro.SubjectNames, "subject-name", map[string]string{}, "Human readable names to record for products or materials, in the form path=name")
+	cmd.Flags().StringSliceVar(&ro.SubjectFiles, "subject-file", []string{}, "Files of name=digest pairs, one per line, relative to the working directory, to add as subjects, for artifacts produced outside the working directory such as images pushed straight to a registry")
+	cmd.Flags().StringArrayVar(&ro.SubjectCommands, "subject-cmd", []string{}, "Shell commands run in the working directory after the step's command, whose output of name=digest pairs is added as subjects")
+	cmd.Flags().StringSliceVar(&ro.PreviousEnvelopes, "previous-step-envelope", []string{}, "Signed envelopes of previous steps to reference, chaining this step to them")
+	cmd.Flags().StringSliceVar(&ro.MaterialAttestations, "material-attestation", []string{}, "Verified upstream attestations, as files or gitoids in Archivista, whose subjects are recorded as materials of this step")
+	cmd.Flags().StringSliceVar(&ro.MaterialAttestationKeyPaths, "material-attestation-key", []string{}, "Paths to public keys trusted to sign material attestations")
+	cmd.Flags().StringSliceVar(&ro.MaterialAttestationCAPaths, "material-attestation-ca", []string{}, "Paths to CA certificates trusted to issue certificates that sign material attestations")
+	cmd.Flags().BoolVar(&ro.CIContext, "ci-context", true, "Record the cicontext attestation automatically when running in a recognized CI environment")
+	cmd.Flags().StringVar(&ro.CaptureProfile, "capture-profile", profile.Standard, fmt.Sprintf("Profile that adjusts how much data attestors record. One of %v", strings.Join(profile.Names(), ", ")))
 	cmd.Flags().StringSliceVar(&ro.TimestampServers, "timestamp-servers", []string{}, "Timestamp Authority Servers to use when signing envelope")
+	cmd.Flags().StringToStringVar(&ro.PredicateTypes, "predicate-type", map[string]string{}, "Custom predicate types to record the attestations of built-in attestors under, in the form attestor=uri")
+	cmd.Flags().DurationVar(&ro.MaxRunDuration, "max-run-duration", 0, "Maximum time the run may take. The command is then sent SIGTERM, then SIGKILL, and the step is still recorded, marked as timed out in the runtimeout attestation. 0 means no limit")
+	cmd.Flags().DurationVar(&ro.GracePeriod, "grace-period", 10*time.Second, "Time the command is given to exit after being forwarded SIGINT or SIGTERM, or stopped at --max-run-duration, before it is sent SIGKILL")
+	cmd.Flags().BoolVar(&ro.DeduplicateDigests, "deduplicate-digests", false, "Record digests shared by materials or products once, in a content table the files refer to, to shrink attestations of trees with many identical files. Verifiers older than this version of witness can't read these attestations")
+	cmd.Flags().IntVar(&ro.HashWorkers, "hash-workers", 1, "Number of files the material and product attestors hash at once. Raising it speeds up hashing many large artifacts on fast disks")
+	cmd.Flags().IntVar(&ro.MaxAttestorConcurrency, "max-attestor-concurrency", 1, "Number of attestors of the same run type that run at once. Attestors still run after the attestors of earlier run types and the attestors they depend on, and execute attestors always run one at a time")
+	cmd.Flags().StringToStringVar(&ro.AttestorTimeouts, "attestor-timeout", map[string]string{}, "Maximum time attestors may run for, in the form name=duration such as aws=5s. The name default applies to every attestor not named. Of the attestors that run after the command, which read what the step recorded, only publish, sbom, subjectsource, and vuln can be stopped and take a timeout. Execute attestors are bounded by --max-run-duration instead")
+	cmd.Flags().StringVar(&ro.AttestorFailurePolicy, "attestor-failure-policy", "fail", "What an attestor that fails or times out does to the run: fail fails it, warn logs a warning and records the step without the attestor, and skip records the step without the attestor quietly. Execute, material, and product attestors always fail the run")
+	cmd.Flags().StringVar(&ro.StatementVersion, "statement-version", "v0.1", "Version of the in-toto statement to write, v0.1 or v1. Statements of both versions can be verified by witness")
+	cmd.Flags().BoolVar(&ro.StrictInToto, "strict-intoto", false, "Write statements that strictly follow the in-toto statement specification, for third-party in-toto tooling. Subject digests of algorithms the specification doesn't define, such as gitoids, are left out, and the run fails rather than sign a statement that violates the specification")
+	cmd.Flags().BoolVar(&ro.Deterministic, "deterministic", false, "Record attestations at the time in SOURCE_DATE_EPOCH, or the Unix epoch if it isn't set, so identical evidence yields identical output for golden file tests. Signatures are only identical for ed25519 keys, and timestamping and tracing can't be used")
+	cmd.Flags().BoolVar(&ro.RecordTimes, "record-times", false, "Record when each attestor started and finished in the collection. Times are left out by default so identical evidence yields an identical statement, and verify can only check that a step started after the steps it depends on finished when they are recorded")
+	cmd.Flags().BoolVar(&ro.Anonymize, "anonymize", false, "Remove details that identify the host and user from the attestations before signing, for publishing provenance publicly. Paths are rewritten relative to the working directory, the home directory is replaced with ~, and hostnames, usernames, and environment variable values are redacted. Digests are kept")
+	cmd.Flags().StringToStringVar(&ro.AnonymizeReplacements, "anonymize-replace", map[string]string{}, "Text to replace in the attestations when anonymizing, in the form internal=public, such as corp.example.com=example.com")
+	cmd.Flags().IntVar(&ro.SignerThreshold, "signer-threshold", 0, "Number of the configured signers that must sign for the envelope to be written, such as 2 to require a CI key and a release manager's key out of three. Signers that fail to load or sign are skipped as long as the threshold is met. 0 requires every signer")
+	cmd.Flags().StringVar(&ro.EventLog, "event-log", "", "File to stream the progress of the run to as newline-delimited JSON events, such as attestors starting and finishing, the number of files hashed, and processes the command starts. Use fd:N to write to an inherited file descriptor")
+	cmd.Flags().StringVar(&ro.SLSAOutFilePath, "slsa-outfile", "", "File to also write a signed SLSA Provenance v1.0 statement of the run to, with the products as its subjects, for verifiers that don't read witness collections. The slsa attestor is added if it isn't in --attestations")
+	cmd.Flags().StringVar(&ro.StoreDir, "store-dir", "", "Directory of a local attestation store to also write the signed envelope to")
+	cmd.Flags().StringVar(&ro.StoreOCI, "store-oci", "", "Image in an OCI registry to attach the signed envelope to as a referrer artifact, such as ghcr.io/org/app@sha256:<digest>. Credentials are read from the Docker config file")
+	cmd.Flags().BoolVar(&ro.StoreOCIPlainHTTP, "store-oci-plain-http", false, "Talk to the registry of --store-oci over HTTP instead of HTTPS")
+	cmd.Flags().BoolVar(&ro.DryRun, "dry-run", false, "Print the attestors that would run, in the order they would run, the signers that would sign, and where the signed envelope would be written and uploaded, then exit without running the command. Signers are loaded, but nothing is signed, written, or uploaded")
+	cmd.Flags().StringVar(&ro.RekorServer, "rekor-server", "", "Rekor transparency log to upload the signed envelope to, such as https://rekor.sigstore.dev. The entry's log index and UUID are logged and included in Sigstore bundle output")
+	cmd.Flags().StringVar(&ro.RekorPublicKeyPath, "rekor-public-key", "", "Path to the PEM encoded public key of the Rekor log of --rekor-server, which the entry's signed entry timestamp must verify with. Required with --rekor-server")
 
 	attestationRegistrations := attestation.RegistrationEntries()
 	for _, registration := range attestationRegistrations {
@@ -67,8 +148,7 @@ func (ro *RunOptions) AddFlags(cmd *cobra.Command) {
 
 			case attestation.ConfigOption[[]string]:
 				{
-					val := cmd.Flags().StringSlice(name, []string{}, opt.Description())
-					cmd.Flags().StringSlice(name, optT.DefaultVal(), opt.Description())
+					val := cmd.Flags().StringSlice(name, optT.DefaultVal(), opt.Description())
 					ro.AttestorOptSetters[registration.Type] = append(ro.AttestorOptSetters[registration.Type], func(a attestation.Attestor) (attestation.Attestor, error) {
 						return optT.Setter()(a, *val)
 					})
@@ -84,6 +164,19 @@ func (ro *RunOptions) AddFlags(cmd *cobra.Command) {
 type ArchivistaOptions struct {
 	Enable bool
 	Url    string
+	ArchivistaClientOptions
+}
+
+// ArchivistaClientOptions tune how witness talks to Archivista during bulk uploads and downloads.
+type ArchivistaClientOptions struct {
+	Concurrency  int
+	RateLimit    float64
+	MaxRetries   int
+	ChunkSize    int
+	GRPCTarget   string
+	GRPCInsecure bool
+	CAPath       string
+	TokenFile    string
 }
 
 func (o *ArchivistaOptions) AddFlags(cmd *cobra.Command) {
@@ -98,4 +191,17 @@ func (o *ArchivistaOptions) AddFlags(cmd *cobra.Command) {
 	if err := cmd.Flags().MarkHidden("archivist-server"); err != nil {
 		log.Debugf("failed to hide archivist-server flag: %v", err)
 	}
+
+	o.ArchivistaClientOptions.AddFlags(cmd)
+}
+
+func (o *ArchivistaClientOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&o.Concurrency, "archivista-concurrency", 4, "Maximum number of concurrent requests to Archivista")
+	cmd.Flags().Float64Var(&o.RateLimit, "archivista-rate-limit", 0, "Maximum number of requests per second to Archivista. 0 means no limit")
+	cmd.Flags().IntVar(&o.MaxRetries, "archivista-max-retries", 3, "Number of times requests to Archivista are retried when throttled or the server is temporarily unavailable")
+	cmd.Flags().StringVar(&o.GRPCTarget, "archivista-grpc", "", "Address of Archivista's gRPC API, such as archivista.example.com:443. When set, attestations are stored and downloaded over gRPC")
+	cmd.Flags().IntVar(&o.ChunkSize, "archivista-chunk-size", 64*1024, "Size in bytes of the chunks attestations are streamed to Archivista in, over gRPC or as HTTP chunked transfer encoding. Attestations no larger than one chunk are sent whole over HTTP")
+	cmd.Flags().BoolVar(&o.GRPCInsecure, "archivista-grpc-insecure", false, "Connect to Archivista's gRPC API without TLS")
+	cmd.Flags().StringVar(&o.CAPath, "archivista-ca", "", "Path to a CA certificate bundle used to verify Archivista's TLS certificate instead of the system roots")
+	cmd.Flags().StringVar(&o.TokenFile, "archivista-token-file", "", "Path to a file containing a bearer token to authenticate to Archivista with. The token is only sent over https, or plain http to a loopback address")
 }
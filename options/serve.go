@@ -0,0 +1,66 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/witness/pkg/relay"
+)
+
+type RelayOptions struct {
+	Listen        string
+	TSAURL        string
+	FulcioURL     string
+	RekorURL      string
+	CacheTTL      time.Duration
+	CacheEntries  int
+	MetricsListen string
+	TLSCertPath   string
+	TLSKeyPath    string
+}
+
+func (ro *RelayOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&ro.Listen, "listen", "localhost:8080", "Address to listen for build jobs on. Addresses other than loopback ones require --tls-cert, as build jobs send OIDC tokens to Fulcio through the relay")
+	cmd.Flags().StringVar(&ro.TLSCertPath, "tls-cert", "", "Path to the PEM certificate to serve with")
+	cmd.Flags().StringVar(&ro.TLSKeyPath, "tls-key", "", "Path to the PEM private key of --tls-cert")
+	cmd.Flags().StringVar(&ro.TSAURL, "tsa-url", "", "URL of the timestamp authority to relay requests to <relay>/tsa to")
+	cmd.Flags().StringVar(&ro.FulcioURL, "fulcio-url", "", "URL of the Fulcio instance to relay gRPC requests and requests to <relay>/fulcio to")
+	cmd.Flags().StringVar(&ro.RekorURL, "rekor-url", "", "URL of the Rekor instance to relay requests to <relay>/rekor to")
+	cmd.Flags().DurationVar(&ro.CacheTTL, "cache-ttl", relay.DefaultCacheTTL, "How long successful GET responses, such as certificate chains and log entries, are cached. 0 disables caching")
+	cmd.Flags().IntVar(&ro.CacheEntries, "cache-entries", relay.DefaultCacheEntries, "Maximum number of responses to cache")
+	addMetricsFlag(cmd, &ro.MetricsListen)
+}
+
+func addMetricsFlag(cmd *cobra.Command, metricsListen *string) {
+	cmd.Flags().StringVar(metricsListen, "metrics-listen", "", "Address to serve Prometheus metrics on at /metrics, such as :9090. Metrics aren't served if it isn't set")
+}
+
+// ServeRunOptions configure witness serve run. The run flags apply to every request, which can override the
+// step, working directory, and attestors.
+type ServeRunOptions struct {
+	RunOptions    RunOptions
+	Socket        string
+	Listen        string
+	MetricsListen string
+}
+
+func (so *ServeRunOptions) AddFlags(cmd *cobra.Command) {
+	so.RunOptions.AddFlags(cmd)
+	cmd.Flags().StringVar(&so.Socket, "socket", "witness.sock", "Path of the Unix socket to serve the API on. The socket is created in a private directory and moved into place once only the current user can connect to it. A socket left at the path by a previous server is replaced")
+	cmd.Flags().StringVar(&so.Listen, "listen", "", "TCP address to serve the API on instead of the Unix socket, such as localhost:8081. Unlike the socket, which only the current user can connect to, a TCP address is open to anyone who can reach it, and they can sign with the server's key, so only listen on trusted interfaces")
+	addMetricsFlag(cmd, &so.MetricsListen)
+}
@@ -14,20 +14,55 @@
 
 package options
 
-import "github.com/spf13/cobra"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/witness/pkg/bundle"
+)
 
 type SignOptions struct {
-	KeyOptions       KeyOptions
-	DataType         string
-	OutFilePath      string
-	InFilePath       string
-	TimestampServers []string
+	KeyOptions        KeyOptions
+	DataType          string
+	OutFilePath       string
+	InFilePath        string
+	TimestampServers  []string
+	OutputFormat      string
+	BundleOutFilePath string
 }
 
 func (so *SignOptions) AddFlags(cmd *cobra.Command) {
 	so.KeyOptions.AddFlags(cmd)
 	cmd.Flags().StringVarP(&so.DataType, "datatype", "t", "https://witness.testifysec.com/policy/v0.1", "The URI reference to the type of data being signed. Defaults to the Witness policy type")
 	cmd.Flags().StringVarP(&so.OutFilePath, "outfile", "o", "", "File to write signed data. Defaults to stdout")
+	cmd.Flags().StringVar(&so.OutputFormat, "output-format", bundle.FormatDSSE, fmt.Sprintf("Format to write the signed envelope to the out file in. One of %v", strings.Join(bundle.Formats, ", ")))
+	cmd.Flags().StringVar(&so.BundleOutFilePath, "sigstore-bundle-outfile", "", "File to also write the signed envelope to as a Sigstore bundle")
 	cmd.Flags().StringVarP(&so.InFilePath, "infile", "f", "", "Witness policy file to sign")
 	cmd.Flags().StringSliceVar(&so.TimestampServers, "timestamp-servers", []string{}, "Timestamp Authority Servers to use when signing envelope")
 }
+
+type CountersignOptions struct {
+	KeyOptions       KeyOptions
+	InFilePath       string
+	OutFilePath      string
+	OutputFormat     string
+	TimestampServers []string
+	TrustKeyPaths    []string
+	TrustCAPaths     []string
+	TimestampCAPaths []string
+	ClockSkew        time.Duration
+}
+
+func (co *CountersignOptions) AddFlags(cmd *cobra.Command) {
+	co.KeyOptions.AddFlags(cmd)
+	cmd.Flags().StringVarP(&co.InFilePath, "infile", "f", "", "Signed envelope to countersign, as a dsse envelope or Sigstore bundle")
+	cmd.Flags().StringVarP(&co.OutFilePath, "outfile", "o", "", "File to write the countersigned envelope to. It may be the infile. Defaults to stdout")
+	cmd.Flags().StringVar(&co.OutputFormat, "output-format", bundle.FormatDSSE, fmt.Sprintf("Format to write the countersigned envelope to the out file in. One of %v, except %v, since bundles carry one signature", strings.Join(bundle.Formats, ", "), bundle.FormatSigstoreBundle))
+	cmd.Flags().StringSliceVar(&co.TimestampServers, "timestamp-servers", []string{}, "Timestamp Authority Servers to use when countersigning the envelope")
+	cmd.Flags().StringSliceVar(&co.TrustKeyPaths, "verify-key", []string{}, "Paths to public keys trusted to have signed the envelope. The envelope must verify against one of these or --verify-ca before it is countersigned")
+	cmd.Flags().StringSliceVar(&co.TrustCAPaths, "verify-ca", []string{}, "Paths to CA certificates trusted to issue certificates that signed the envelope")
+	cmd.Flags().StringSliceVar(&co.TimestampCAPaths, "verify-timestamp-ca", []string{}, "Paths to CA certificates of timestamp authorities trusted to timestamp the envelope's signatures")
+	cmd.Flags().DurationVar(&co.ClockSkew, "clock-skew", 0, "Tolerance allowed when checking the validity of the certificates that signed the envelope against the verifier's clock or trusted timestamps")
+}
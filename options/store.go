@@ -0,0 +1,69 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type StorePruneOptions struct {
+	StoreDir     string
+	OlderThan    time.Duration
+	Subjects     []string
+	KeepPolicies []string
+	KeepLatest   int
+	ExportDir    string
+	DryRun       bool
+}
+
+func (po *StorePruneOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&po.StoreDir, "store-dir", "", "Directory of signed attestation envelopes to prune")
+	cmd.Flags().DurationVar(&po.OlderThan, "older-than", 0, "Prune attestations that finished longer ago than this duration")
+	cmd.Flags().StringSliceVarP(&po.Subjects, "subjects", "s", []string{}, "Prune attestations with a subject matching any of these digests")
+	cmd.Flags().StringSliceVar(&po.KeepPolicies, "keep-policy", []string{}, "Paths to policies whose steps are retained regardless of the other rules")
+	cmd.Flags().IntVar(&po.KeepLatest, "keep-latest", 0, "Number of the most recent attestations of each step to retain regardless of the other rules")
+	cmd.Flags().StringVar(&po.ExportDir, "export-dir", "", "Directory to copy pruned attestations into before they are deleted. The directory must not exist or be empty")
+	cmd.Flags().BoolVar(&po.DryRun, "dry-run", false, "List the attestations that would be pruned without deleting them")
+}
+
+type StoreSearchOptions struct {
+	StoreDir string
+	Subjects []string
+	Step     string
+	Since    time.Duration
+}
+
+func (so *StoreSearchOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&so.StoreDir, "store-dir", "", "Directory of signed attestation envelopes to search")
+	cmd.Flags().StringSliceVarP(&so.Subjects, "subjects", "s", []string{}, "Find attestations with a subject matching any of these digests")
+	cmd.Flags().StringVar(&so.Step, "step", "", "Find attestations of this step")
+	cmd.Flags().DurationVar(&so.Since, "since", 0, "Find attestations that finished within this duration")
+}
+
+type StoreUploadOptions struct {
+	StoreDir                string
+	ArchivistaUrl           string
+	Force                   bool
+	ArchivistaClientOptions ArchivistaClientOptions
+}
+
+func (uo *StoreUploadOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&uo.StoreDir, "store-dir", "", "Directory of signed attestation envelopes to upload")
+	cmd.Flags().StringVar(&uo.ArchivistaUrl, "archivista-server", "https://archivista.testifysec.io", "URL of the Archivista server to upload attestations to")
+	cmd.Flags().BoolVar(&uo.Force, "force", false, "Upload every attestation, including ones already recorded as uploaded by a previous upload")
+	uo.ArchivistaClientOptions.AddFlags(cmd)
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/tekton"
+)
+
+type TektonProvenanceOptions struct {
+	KeyOptions        KeyOptions
+	RunFilePath       string
+	TaskRun           string
+	PipelineRun       string
+	PipelineTask      string
+	PodLabelsPath     string
+	Namespace         string
+	BuilderID         string
+	OutFilePath       string
+	OutputFormat      string
+	BundleOutFilePath string
+	TimestampServers  []string
+}
+
+func (to *TektonProvenanceOptions) AddFlags(cmd *cobra.Command) {
+	to.KeyOptions.AddFlags(cmd)
+	cmd.Flags().StringVarP(&to.RunFilePath, "run-file", "f", "", "File with the TaskRun or PipelineRun to describe, as kubectl get -o json prints it")
+	cmd.Flags().StringVar(&to.TaskRun, "taskrun", "", "Name of the TaskRun to read from the cluster")
+	cmd.Flags().StringVar(&to.PipelineRun, "pipelinerun", "", "Name of the PipelineRun to read from the cluster")
+	cmd.Flags().StringVar(&to.PipelineTask, "pipeline-task", "", "Task of the PipelineRun whose TaskRun is described instead of the PipelineRun, such as a task that finished before this one")
+	cmd.Flags().StringVar(&to.PodLabelsPath, "pod-labels", "", "File the downward API projects the pod's labels to, such as /etc/podinfo/labels. The TaskRun or PipelineRun is the one the pod runs for")
+	cmd.Flags().StringVar(&to.Namespace, "namespace", "", "Namespace of the run in the cluster. Defaults to the pod's namespace")
+	cmd.Flags().StringVar(&to.BuilderID, "builder-id", tekton.ChainsBuilderID, "ID of the builder recorded in the provenance")
+	cmd.Flags().StringVarP(&to.OutFilePath, "outfile", "o", "", "File to which to write the signed provenance.  Defaults to stdout")
+	cmd.Flags().StringVar(&to.OutputFormat, "output-format", bundle.FormatDSSE, fmt.Sprintf("Format to write the signed envelope to the out file in. One of %v", strings.Join(bundle.Formats, ", ")))
+	cmd.Flags().StringVar(&to.BundleOutFilePath, "sigstore-bundle-outfile", "", "File to also write the signed envelope to as a Sigstore bundle")
+	cmd.Flags().StringSliceVar(&to.TimestampServers, "timestamp-servers", []string{}, "Timestamp Authority Servers to use when signing envelope")
+}
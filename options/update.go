@@ -0,0 +1,42 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/testifysec/witness/pkg/update"
+)
+
+type UpdateOptions struct {
+	ReleaseKeyPaths []string
+	Version         string
+	Check           bool
+	AllowDowngrade  bool
+	Repository      string
+	API             string
+	Timeout         time.Duration
+}
+
+func (uo *UpdateOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&uo.ReleaseKeyPaths, "release-key", []string{}, "Paths to public keys trusted to sign witness release attestations")
+	cmd.Flags().StringVar(&uo.Version, "version", "", "Release to install instead of the latest one")
+	cmd.Flags().BoolVar(&uo.Check, "check", false, "Only report whether a newer release is available")
+	cmd.Flags().BoolVar(&uo.AllowDowngrade, "allow-downgrade", false, "Allow --version to install a release that isn't newer than the installed one")
+	cmd.Flags().StringVar(&uo.Repository, "repository", update.DefaultRepository, "GitHub repository witness releases are published to")
+	cmd.Flags().StringVar(&uo.API, "github-api", update.DefaultAPI, "URL of the GitHub API, for GitHub Enterprise or mirrors of the releases")
+	cmd.Flags().DurationVar(&uo.Timeout, "timeout", 5*time.Minute, "Time to wait for the release to download")
+}
@@ -14,7 +14,11 @@
 
 package options
 
-import "github.com/spf13/cobra"
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+)
 
 type VerifyOptions struct {
 	ArchivistaOptions    ArchivistaOptions
@@ -24,15 +28,115 @@ type VerifyOptions struct {
 	ArtifactFilePath     string
 	AdditionalSubjects   []string
 	CAPaths              []string
+	ClockSkew            time.Duration
+	SubjectNames         []string
+	WitnessReleasePaths  []string
+	VEXPaths             []string
+	StoreDir             string
+	Image                string
+	PredicateTypes       map[string]string
+	OpaquePredicates     []string
+	Environment          string
+	RevocationRefs       []string
+	GroupSnapshotPaths   []string
+	SubPolicyPaths       []string
+	StatementVersions    []string
+	StrictInToto         bool
+	GroupsSCIM           GroupsSCIMOptions
+	GroupsLDAP           GroupsLDAPOptions
+	GroupsCacheDir       string
+	GroupsCacheTTL       time.Duration
+	GroupsCacheKeyPath   string
+	CUEPath              string
+	RekorPublicKeyPath   string
+	CheckBuildInfo       bool
+	Cache                VerifyCacheOptions
+	AuditLog             AuditLogOptions
 }
 
 func (vo *VerifyOptions) AddFlags(cmd *cobra.Command) {
 	vo.ArchivistaOptions.AddFlags(cmd)
 	cmd.Flags().StringVarP(&vo.KeyPath, "publickey", "k", "", "Path to the policy signer's public key")
-	cmd.Flags().StringSliceVarP(&vo.AttestationFilePaths, "attestations", "a", []string{}, "Attestation files to test against the policy")
+	cmd.Flags().StringSliceVarP(&vo.AttestationFilePaths, "attestations", "a", []string{}, "Attestation files to test against the policy, including provenance signed by Tekton Chains")
 	cmd.Flags().StringVarP(&vo.PolicyFilePath, "policy", "p", "", "Path to the policy to verify")
 	cmd.Flags().StringVarP(&vo.ArtifactFilePath, "artifactfile", "f", "", "Path to the artifact to verify")
 	cmd.Flags().StringSliceVarP(&vo.AdditionalSubjects, "subjects", "s", []string{}, "Additional subjects to lookup attestations")
 	cmd.Flags().StringSliceVarP(&vo.CAPaths, "policy-ca", "", []string{}, "Paths to CA certificates to use for verifying the policy")
+	cmd.Flags().StringSliceVar(&vo.SubjectNames, "subject-name", []string{}, "Names that verified evidence must have recorded for the artifact or subjects with --subject-name during witness run")
+	cmd.Flags().StringSliceVar(&vo.WitnessReleasePaths, "witness-release", []string{}, "Signed release attestations of witness, used when the policy requires evidence recorded by a released witness binary")
+	cmd.Flags().StringSliceVar(&vo.VEXPaths, "vex", []string{}, "Signed OpenVEX attestations that remediate vulnerabilities found by scans of steps with vulnerability constraints")
+	cmd.Flags().StringVar(&vo.StoreDir, "store-dir", "", "Directory of a local attestation store to search for attestations")
+	cmd.Flags().StringVar(&vo.Image, "image", "", "Image to verify, such as oci-layout://path/to/layout:tag. The image is added as a subject and the attestations attached to it are tested against the policy")
+	cmd.Flags().StringToStringVar(&vo.PredicateTypes, "predicate-type", map[string]string{}, "Custom predicate types attestations of built-in attestors were recorded under with witness run --predicate-type, in the form attestor=uri")
+	cmd.Flags().StringSliceVar(&vo.OpaquePredicates, "opaque-predicate", []string{}, "Predicate types witness has no attestor for to accept in collections, in the form uri or uri=schema.json. Attestations of these types are kept as opaque JSON and validated against the JSON Schema if one is given")
+	cmd.Flags().StringVar(&vo.Environment, "environment", "", "Environment the artifact is verified for, such as production. Steps of the policy limited to other environments are not required. When not set every step is required")
+	cmd.Flags().StringSliceVar(&vo.RevocationRefs, "revocations", []string{}, "Signed revocation lists of attestations and subjects that must not be accepted as evidence. Each is a file, a gitoid to download from Archivista, or an oci-layout:// reference whose attached revocation lists are read")
+	cmd.Flags().StringSliceVar(&vo.GroupSnapshotPaths, "groups-snapshot", []string{}, "Signed snapshots of the members of the functionary groups named by the policy, written by witness groups resolve")
+	vo.GroupsSCIM.AddFlags(cmd)
+	vo.GroupsLDAP.AddFlags(cmd)
+	cmd.Flags().StringSliceVar(&vo.SubPolicyPaths, "sub-policy", []string{}, "Signed sub-policies that define the steps the policy delegates, each signed by a delegate the policy names for the step")
+	cmd.Flags().StringVar(&vo.GroupsCacheDir, "groups-cache-dir", "", "Directory to cache groups resolved from --groups-scim-url or --groups-ldap-url in")
+	cmd.Flags().DurationVar(&vo.GroupsCacheTTL, "groups-cache-ttl", 15*time.Minute, "How long groups cached in --groups-cache-dir are used before they are resolved again")
+	cmd.Flags().StringVar(&vo.GroupsCacheKeyPath, "groups-cache-key-file", "", "File holding the secret key, at least 32 bytes, cached groups are authenticated with. Required with --groups-cache-dir, and must be kept outside it")
+	cmd.Flags().DurationVar(&vo.ClockSkew, "clock-skew", 0, "Tolerance allowed when checking certificate validity and policy expiration against the verifier's clock or trusted timestamps")
+	cmd.Flags().StringSliceVar(&vo.StatementVersions, "statement-versions", []string{}, "Versions of the in-toto statement evidence is accepted in, v0.1 or v1. By default evidence of any version is accepted")
+	cmd.Flags().StringVar(&vo.RekorPublicKeyPath, "rekor-public-key", "", "Path to the PEM encoded public key of a Rekor log. When set, every attestation file must be a Sigstore bundle written by witness run --rekor-server whose transparency log entry logs its envelope and is signed by the log")
+	cmd.Flags().BoolVar(&vo.StrictInToto, "strict-intoto", false, "Only accept evidence whose statements strictly follow the in-toto statement specification, such as evidence recorded with witness run --strict-intoto")
+	cmd.Flags().BoolVar(&vo.CheckBuildInfo, "check-buildinfo", false, "Require the buildinfo embedded in the Go binary given with --artifactfile to match the verified evidence: the binary must be stamped with a commit a git attestation recorded, and its module versions must match those a gobuild attestation recorded")
+	cmd.Flags().StringVar(&vo.CUEPath, "cue-path", "cue", "Path to the cue command that evaluates the CUE policies of the policy's attestations")
+}
+
+// VerifyCacheOptions configure caching of verification results. They are only added to witness verify, since
+// the export commands need the verified evidence itself rather than the result.
+type VerifyCacheOptions struct {
+	Dir     string
+	TTL     time.Duration
+	KeyPath string
+}
+
+func (vco *VerifyCacheOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&vco.Dir, "cache-dir", "", "Directory to cache successful verifications in. A verification of the same evidence under the same policy, trusted keys, and subjects returns the cached result")
+	cmd.Flags().DurationVar(&vco.TTL, "cache-ttl", time.Hour, "How long cached verification results are valid for. Results never outlive the policy's expiration")
+	cmd.Flags().StringVar(&vco.KeyPath, "cache-key-file", "", "File holding the secret key, at least 32 bytes, cached verifications are authenticated with. Required with --cache-dir, and must be kept outside it so anyone able to write the cache can't forge a verification")
+}
+
+// AuditLogOptions configure the audit log verification decisions are appended to.
+type AuditLogOptions struct {
+	Target         string
+	SigningKeyPath string
+	Rate           float64
+	Burst          int
+}
+
+func (ao *AuditLogOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&ao.Target, "audit-log", "", "File to append a hash-chained record of each verification decision to, or an http(s):// URL of a service to POST each record to")
+	cmd.Flags().StringVar(&ao.SigningKeyPath, "audit-log-signing-key", "", "Path to a private key that signs each audit log record")
+	cmd.Flags().Float64Var(&ao.Rate, "audit-log-rate", 0, "Decisions recorded per second on average. Decisions over the rate are dropped and counted in the next record. 0 records every decision")
+	cmd.Flags().IntVar(&ao.Burst, "audit-log-burst", 10, "Decisions recorded at once before --audit-log-rate applies")
+}
+
+type VerifySubjectOptions struct {
+	ArtifactFilePath     string
+	AttestationFilePaths []string
+	KeyPaths             []string
+	CAPaths              []string
+	TimestampCAPaths     []string
+	ClockSkew            time.Duration
+}
+
+func (vso *VerifySubjectOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&vso.ArtifactFilePath, "artifactfile", "f", "", "Path to the artifact to look for")
+	cmd.Flags().StringSliceVarP(&vso.AttestationFilePaths, "attestations", "a", []string{}, "Attestation files to check for the artifact")
+	cmd.Flags().StringSliceVarP(&vso.KeyPaths, "publickey", "k", []string{}, "Paths to public keys trusted to sign the attestations")
+	cmd.Flags().StringSliceVar(&vso.CAPaths, "ca", []string{}, "Paths to CA certificates trusted to issue certificates that sign the attestations")
+	cmd.Flags().StringSliceVar(&vso.TimestampCAPaths, "timestamp-ca", []string{}, "Paths to CA certificates of timestamp authorities trusted to timestamp the signatures")
+	cmd.Flags().DurationVar(&vso.ClockSkew, "clock-skew", 0, "Tolerance allowed when checking certificate validity against the verifier's clock or trusted timestamps")
+}
+
+type AuditLogVerifyOptions struct {
+	KeyPaths []string
+}
 
+func (ao *AuditLogVerifyOptions) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVarP(&ao.KeyPaths, "publickey", "k", []string{}, "Paths to the public keys trusted to sign the audit log. Without any, only the hash chain is checked")
 }
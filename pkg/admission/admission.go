@@ -0,0 +1,201 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package admission implements a Kubernetes validating admission webhook that admits Pods only if every image they
+// run is verified, so clusters can enforce that workloads were built the way a witness policy requires.
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/testifysec/go-witness/log"
+)
+
+const (
+	// Path is where admission reviews are served.
+	Path = "/validate"
+
+	reviewAPIVersion = "admission.k8s.io/v1"
+	reviewKind       = "AdmissionReview"
+
+	// maxReviewSize bounds the admission reviews read, which the API server limits to a few megabytes.
+	maxReviewSize = 8 << 20
+)
+
+// Review is an admission.k8s.io/v1 AdmissionReview, with the fields the webhook uses.
+type Review struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Request    *Request  `json:"request,omitempty"`
+	Response   *Response `json:"response,omitempty"`
+}
+
+type Request struct {
+	UID       string          `json:"uid"`
+	Kind      GroupVersion    `json:"kind"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Operation string          `json:"operation,omitempty"`
+	Object    json.RawMessage `json:"object,omitempty"`
+}
+
+type GroupVersion struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+type Response struct {
+	UID      string   `json:"uid"`
+	Allowed  bool     `json:"allowed"`
+	Status   *Status  `json:"status,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type Status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// pod is the part of a Pod the images are read from.
+type pod struct {
+	Metadata struct {
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		Containers          []container `json:"containers"`
+		InitContainers      []container `json:"initContainers"`
+		EphemeralContainers []container `json:"ephemeralContainers"`
+	} `json:"spec"`
+}
+
+type container struct {
+	Image string `json:"image"`
+}
+
+// Image is an image of a Pod being admitted, with the namespace and labels of the Pod.
+type Image struct {
+	Reference string
+	Namespace string
+	Labels    map[string]string
+}
+
+// VerifyFunc verifies an image of a Pod being admitted, returning why it isn't verified.
+type VerifyFunc func(ctx context.Context, image Image) error
+
+// Handler serves admission reviews, denying Pods with an image that doesn't verify. Requests for other kinds are
+// admitted, so the webhook can be registered broadly without blocking them.
+type Handler struct {
+	verify VerifyFunc
+}
+
+func NewHandler(verify VerifyFunc) *Handler {
+	return &Handler{verify: verify}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "admission reviews must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	review := Review{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxReviewSize)).Decode(&review); err != nil {
+		http.Error(w, fmt.Sprintf("invalid admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if review.Request == nil {
+		http.Error(w, "admission review has no request", http.StatusBadRequest)
+		return
+	}
+
+	response := h.Review(r.Context(), review.Request)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(Review{APIVersion: reviewAPIVersion, Kind: reviewKind, Response: &response}); err != nil {
+		log.Errorf("failed to write admission response: %v", err)
+	}
+}
+
+// Review decides whether to admit the object of request. The images of a Pod are verified concurrently.
+func (h *Handler) Review(ctx context.Context, request *Request) Response {
+	response := Response{UID: request.UID, Allowed: true}
+	if request.Kind.Group != "" || request.Kind.Kind != "Pod" || request.Operation == "DELETE" {
+		return response
+	}
+
+	p := pod{}
+	if err := json.Unmarshal(request.Object, &p); err != nil {
+		return deny(request.UID, http.StatusBadRequest, fmt.Sprintf("failed to read pod: %v", err))
+	}
+
+	images := p.images()
+
+	failures := make([]string, len(images))
+	wg := sync.WaitGroup{}
+	for i, image := range images {
+		wg.Add(1)
+		go func(i int, image string) {
+			defer wg.Done()
+			if err := h.verify(ctx, Image{Reference: image, Namespace: request.Namespace, Labels: p.Metadata.Labels}); err != nil {
+				failures[i] = fmt.Sprintf("%v: %v", image, err)
+			}
+		}(i, image)
+	}
+
+	wg.Wait()
+	denied := []string{}
+	for _, failure := range failures {
+		if failure != "" {
+			denied = append(denied, failure)
+		}
+	}
+
+	if len(denied) > 0 {
+		log.Infof("Denied pod %v/%v: %v", request.Namespace, request.Name, strings.Join(denied, "; "))
+		return deny(request.UID, http.StatusForbidden, fmt.Sprintf("witness could not verify %v", strings.Join(denied, "; ")))
+	}
+
+	return response
+}
+
+func deny(uid string, code int, message string) Response {
+	return Response{UID: uid, Allowed: false, Status: &Status{Code: code, Message: message}}
+}
+
+// images returns the images of every container of the Pod, each once and sorted.
+func (p pod) images() []string {
+	seen := map[string]struct{}{}
+	images := []string{}
+	for _, containers := range [][]container{p.Spec.InitContainers, p.Spec.Containers, p.Spec.EphemeralContainers} {
+		for _, c := range containers {
+			if _, ok := seen[c.Image]; ok || c.Image == "" {
+				continue
+			}
+
+			seen[c.Image] = struct{}{}
+			images = append(images, c.Image)
+		}
+	}
+
+	sort.Strings(images)
+	return images
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const podJSON = `{
+  "apiVersion": "v1",
+  "kind": "Pod",
+  "metadata": {"name": "app", "namespace": "team-a", "labels": {"team": "a"}},
+  "spec": {
+    "initContainers": [{"name": "migrate", "image": "ghcr.io/org/migrate:v1"}],
+    "containers": [
+      {"name": "app", "image": "ghcr.io/org/app@sha256:0123"},
+      {"name": "sidecar", "image": "ghcr.io/org/app@sha256:0123"}
+    ],
+    "ephemeralContainers": [{"name": "debug", "image": "busybox"}]
+  }
+}`
+
+func podReview(uid string) []byte {
+	data, _ := json.Marshal(Review{
+		APIVersion: reviewAPIVersion,
+		Kind:       reviewKind,
+		Request: &Request{
+			UID:       uid,
+			Kind:      GroupVersion{Version: "v1", Kind: "Pod"},
+			Namespace: "team-a",
+			Name:      "app",
+			Operation: "CREATE",
+			Object:    json.RawMessage(podJSON),
+		},
+	})
+
+	return data
+}
+
+func TestPodImages(t *testing.T) {
+	p := pod{}
+	require.NoError(t, json.Unmarshal([]byte(podJSON), &p))
+	require.Equal(t, []string{"busybox", "ghcr.io/org/app@sha256:0123", "ghcr.io/org/migrate:v1"}, p.images())
+}
+
+func TestHandler(t *testing.T) {
+	var mu sync.Mutex
+	verified := []string{}
+	handler := NewHandler(func(ctx context.Context, image Image) error {
+		require.Equal(t, "team-a", image.Namespace)
+		require.Equal(t, map[string]string{"team": "a"}, image.Labels)
+		mu.Lock()
+		verified = append(verified, image.Reference)
+		mu.Unlock()
+		if image.Reference == "busybox" {
+			return errors.New("no attestations found")
+		}
+
+		return nil
+	})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, Path, bytes.NewReader(podReview("1234"))))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	review := Review{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &review))
+	require.Equal(t, reviewAPIVersion, review.APIVersion)
+	require.Equal(t, "1234", review.Response.UID)
+	require.False(t, review.Response.Allowed)
+	require.Equal(t, http.StatusForbidden, review.Response.Status.Code)
+	require.Equal(t, "witness could not verify busybox: no attestations found", review.Response.Status.Message)
+
+	// each image is verified once
+	sort.Strings(verified)
+	require.Equal(t, []string{"busybox", "ghcr.io/org/app@sha256:0123", "ghcr.io/org/migrate:v1"}, verified)
+}
+
+func TestHandlerAdmits(t *testing.T) {
+	handler := NewHandler(func(ctx context.Context, image Image) error {
+		return nil
+	})
+
+	response := handler.Review(context.Background(), &Request{UID: "1", Kind: GroupVersion{Version: "v1", Kind: "Pod"}, Object: json.RawMessage(podJSON)})
+	require.True(t, response.Allowed)
+
+	// other kinds and deletions aren't verified
+	deny := NewHandler(func(ctx context.Context, image Image) error {
+		return errors.New("denied")
+	})
+
+	response = deny.Review(context.Background(), &Request{UID: "2", Kind: GroupVersion{Group: "apps", Version: "v1", Kind: "Deployment"}, Object: json.RawMessage(`{}`)})
+	require.True(t, response.Allowed)
+	response = deny.Review(context.Background(), &Request{UID: "3", Kind: GroupVersion{Version: "v1", Kind: "Pod"}, Operation: "DELETE"})
+	require.True(t, response.Allowed)
+	response = deny.Review(context.Background(), &Request{UID: "4", Kind: GroupVersion{Version: "v1", Kind: "Pod"}, Object: json.RawMessage(`[]`)})
+	require.False(t, response.Allowed)
+	require.Equal(t, http.StatusBadRequest, response.Status.Code)
+}
+
+func TestHandlerInvalidReview(t *testing.T) {
+	handler := NewHandler(func(ctx context.Context, image Image) error {
+		return nil
+	})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, Path, nil))
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, Path, bytes.NewReader([]byte(`{"kind": "AdmissionReview"}`))))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, Path, bytes.NewReader([]byte(`not json`))))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,271 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package anonymize removes details that identify the hosts and people that recorded a statement, so provenance can
+// be published without revealing internal infrastructure. Digests and the structure of the statement are kept, so
+// anonymized statements still verify against policies that check artifacts and attestation types.
+package anonymize
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/witness/pkg/statement"
+)
+
+// Redacted replaces values that are removed rather than rewritten.
+const Redacted = "REDACTED"
+
+// redactedKeys are the fields whose values identify a host or person regardless of their content. Environment
+// variables are removed wholesale, since their values routinely hold internal hostnames, paths, and URLs.
+var redactedKeys = map[string]bool{
+	"hostname":  true,
+	"username":  true,
+	"variables": true,
+	"environ":   true,
+}
+
+type replacement struct {
+	pattern *regexp.Regexp
+	with    string
+}
+
+// Anonymizer rewrites statements. Paths in the workspace are made relative to it, paths in the home directory are
+// rewritten relative to ~, and the hostname is replaced, wherever they appear in a value.
+type Anonymizer struct {
+	replacements []replacement
+}
+
+type Option func(*options)
+
+type options struct {
+	hostname string
+	homeDir  string
+	literals map[string]string
+}
+
+// WithReplacements also replaces each key of literals with its value, such as an internal domain with a public one.
+func WithReplacements(literals map[string]string) Option {
+	return func(o *options) {
+		o.literals = literals
+	}
+}
+
+// WithHost sets the hostname and home directory that are replaced, which default to those of the current host and
+// user.
+func WithHost(hostname, homeDir string) Option {
+	return func(o *options) {
+		o.hostname, o.homeDir = hostname, homeDir
+	}
+}
+
+// New returns an anonymizer for statements recorded in workspace.
+func New(workspace string, opts ...Option) (*Anonymizer, error) {
+	o := options{}
+	o.hostname, _ = os.Hostname()
+	if current, err := user.Current(); err == nil {
+		o.homeDir = current.HomeDir
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	workspace, err := filepath.Abs(workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Anonymizer{}
+	// the workspace is often in the home directory, so it is rewritten first
+	a.addPath(workspace, ".")
+	if o.homeDir != "" && o.homeDir != "/" {
+		a.addPath(filepath.Clean(o.homeDir), "~")
+	}
+
+	if o.hostname != "" {
+		names := []string{o.hostname}
+		if short, _, ok := strings.Cut(o.hostname, "."); ok && short != "" {
+			names = append(names, short)
+		}
+
+		for _, name := range names {
+			a.replacements = append(a.replacements, replacement{regexp.MustCompile(`(^|[^A-Za-z0-9.-])` + regexp.QuoteMeta(name) + `($|[^A-Za-z0-9-])`), "${1}" + Redacted + "${2}"})
+		}
+	}
+
+	// literals are replaced after the hostname, so replacing a domain doesn't keep the hostname from being found
+	// and longer literals are replaced first so one that contains another is replaced whole
+	literals := make([]string, 0, len(o.literals))
+	for literal := range o.literals {
+		if literal != "" {
+			literals = append(literals, literal)
+		}
+	}
+
+	sort.Slice(literals, func(i, j int) bool { return len(literals[i]) > len(literals[j]) })
+	for _, literal := range literals {
+		a.replacements = append(a.replacements, replacement{regexp.MustCompile(regexp.QuoteMeta(literal)), o.literals[literal]})
+	}
+
+	return a, nil
+}
+
+// addPath rewrites paths under dir relative to root, such as dir/src/main.go to src/main.go when root is ".".
+func (a *Anonymizer) addPath(dir, root string) {
+	if dir == "/" {
+		return
+	}
+
+	prefix := root + "/"
+	if root == "." {
+		prefix = ""
+	}
+
+	quoted := regexp.QuoteMeta(dir)
+	a.replacements = append(a.replacements,
+		replacement{regexp.MustCompile(quoted + `/`), prefix},
+		replacement{regexp.MustCompile(quoted + `($|[^A-Za-z0-9._-])`), root + "${1}"},
+	)
+}
+
+// String rewrites a single value.
+func (a *Anonymizer) String(value string) string {
+	for _, r := range a.replacements {
+		value = r.pattern.ReplaceAllString(value, r.with)
+	}
+
+	return value
+}
+
+// Statement returns an anonymized copy of st. The predicate is rewritten and kept in canonical form, and subjects
+// keep their digests under rewritten names. Statements with keys or subjects that would be rewritten to the same name,
+// such as a file in the workspace and one with the same relative path elsewhere, are rejected rather than merged.
+func (a *Anonymizer) Statement(st intoto.Statement) (intoto.Statement, error) {
+	decoder := json.NewDecoder(bytes.NewReader(st.Predicate))
+	decoder.UseNumber()
+	var predicate interface{}
+	if err := decoder.Decode(&predicate); err != nil {
+		return intoto.Statement{}, err
+	}
+
+	rewritten, err := a.value(predicate)
+	if err != nil {
+		return intoto.Statement{}, err
+	}
+
+	data, err := json.Marshal(rewritten)
+	if err != nil {
+		return intoto.Statement{}, err
+	}
+
+	if data, err = statement.Canonicalize(data); err != nil {
+		return intoto.Statement{}, err
+	}
+
+	anonymized := st
+	anonymized.Predicate = data
+	anonymized.Subject = make([]intoto.Subject, 0, len(st.Subject))
+	names := make(map[string]string, len(st.Subject))
+	for _, subject := range st.Subject {
+		name := a.String(subject.Name)
+		if original, ok := names[name]; ok {
+			return intoto.Statement{}, fmt.Errorf("subjects %v and %v would both be anonymized as %v", original, subject.Name, name)
+		}
+
+		names[name] = subject.Name
+		anonymized.Subject = append(anonymized.Subject, intoto.Subject{Name: name, Digest: subject.Digest})
+	}
+
+	return anonymized, nil
+}
+
+func (a *Anonymizer) value(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return a.String(v), nil
+	case []interface{}:
+		for i := range v {
+			value, err := a.value(v[i])
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = value
+		}
+
+		return v, nil
+	case map[string]interface{}:
+		rewritten := make(map[string]interface{}, len(v))
+		originals := make(map[string]string, len(v))
+		for key, value := range v {
+			rewrittenKey := key
+			if redactedKeys[key] {
+				value = redact(value)
+			} else {
+				rewrittenKey = a.String(key)
+				var err error
+				if value, err = a.value(value); err != nil {
+					return nil, err
+				}
+			}
+
+			if original, ok := originals[rewrittenKey]; ok {
+				return nil, fmt.Errorf("keys %v and %v would both be anonymized as %v", original, key, rewrittenKey)
+			}
+
+			originals[rewrittenKey] = key
+			rewritten[rewrittenKey] = value
+		}
+
+		return rewritten, nil
+	default:
+		return v, nil
+	}
+}
+
+// redact replaces the strings of a value while keeping its shape, so the names of environment variables are kept
+// while their values aren't.
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if v == "" {
+			return v
+		}
+
+		return Redacted
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = redact(value)
+		}
+
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package anonymize
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/intoto"
+)
+
+func TestString(t *testing.T) {
+	a, err := New("/home/ci/work/app", WithHost("build-07.corp.example.com", "/home/ci"), WithReplacements(map[string]string{"git.corp.example.com": "github.com", "corp.example.com": "example.com"}))
+	require.NoError(t, err)
+
+	for value, expected := range map[string]string{
+		"/home/ci/work/app/src/main.go":                  "src/main.go",
+		"/home/ci/work/app":                              ".",
+		"cd /home/ci/work/app && make":                   "cd . && make",
+		"/home/ci/work/application/main.go":              "~/work/application/main.go",
+		"/home/ci/.cache/go-build":                       "~/.cache/go-build",
+		"/home/cid/file":                                 "/home/cid/file",
+		"/usr/lib/go/bin/go":                             "/usr/lib/go/bin/go",
+		"build-07":                                       Redacted,
+		"ssh://build-07.corp.example.com:22":             "ssh://" + Redacted + ":22",
+		"build-07-cache":                                 "build-07-cache",
+		"https://git.corp.example.com/team/app.git":      "https://github.com/team/app.git",
+		"https://artifacts.corp.example.com/releases/v1": "https://artifacts.example.com/releases/v1",
+	} {
+		require.Equal(t, expected, a.String(value), value)
+	}
+}
+
+func TestStatement(t *testing.T) {
+	a, err := New("/work", WithHost("builder", "/home/ci"))
+	require.NoError(t, err)
+
+	predicate := json.RawMessage(`{"name":"build","attestations":[
+		{"type":"https://witness.dev/attestations/environment/v0.1","attestation":{"os":"linux","hostname":"builder","username":"ci","variables":{"PATH":"/home/ci/bin:/usr/bin","EMPTY":""}}},
+		{"type":"https://witness.dev/attestations/command-run/v0.1","attestation":{"cmd":["make","-C","/work/src"],"exitcode":0,"processes":[{"processid":12,"environ":"HOME=/home/ci","openedfiles":{"/work/src/main.c":{"sha256":"abcd"}}}]}}
+	]}`)
+
+	st := intoto.Statement{
+		Type:          intoto.StatementType,
+		PredicateType: "https://witness.testifysec.com/attestation-collection/v0.1",
+		Subject:       []intoto.Subject{{Name: "file:/work/out/app", Digest: map[string]string{"sha256": "ef01"}}},
+		Predicate:     predicate,
+	}
+
+	anonymized, err := a.Statement(st)
+	require.NoError(t, err)
+	require.Equal(t, []intoto.Subject{{Name: "file:out/app", Digest: map[string]string{"sha256": "ef01"}}}, anonymized.Subject)
+	require.JSONEq(t, `{"name":"build","attestations":[
+		{"type":"https://witness.dev/attestations/environment/v0.1","attestation":{"os":"linux","hostname":"REDACTED","username":"REDACTED","variables":{"PATH":"REDACTED","EMPTY":""}}},
+		{"type":"https://witness.dev/attestations/command-run/v0.1","attestation":{"cmd":["make","-C","src"],"exitcode":0,"processes":[{"processid":12,"environ":"REDACTED","openedfiles":{"src/main.c":{"sha256":"abcd"}}}]}}
+	]}`, string(anonymized.Predicate))
+
+	// the original statement is left as it was
+	require.Equal(t, "file:/work/out/app", st.Subject[0].Name)
+	require.Equal(t, predicate, st.Predicate)
+}
+
+func TestStatementCollisions(t *testing.T) {
+	a, err := New("/work", WithHost("builder", "/home/ci"))
+	require.NoError(t, err)
+
+	// a file in the workspace and one with the same relative path elsewhere can't both be kept under one name
+	st := intoto.Statement{
+		Type:          intoto.StatementType,
+		PredicateType: "https://witness.testifysec.com/attestation-collection/v0.1",
+		Predicate:     json.RawMessage(`{"openedfiles":{"/work/src/main.c":{"sha256":"abcd"},"src/main.c":{"sha256":"ef01"}}}`),
+	}
+
+	_, err = a.Statement(st)
+	require.ErrorContains(t, err, "would both be anonymized as src/main.c")
+
+	st.Predicate = json.RawMessage(`{}`)
+	st.Subject = []intoto.Subject{{Name: "file:/work/app", Digest: map[string]string{"sha256": "abcd"}}, {Name: "file:app", Digest: map[string]string{"sha256": "ef01"}}}
+	_, err = a.Statement(st)
+	require.ErrorContains(t, err, "would both be anonymized as file:app")
+}
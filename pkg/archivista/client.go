@@ -0,0 +1,518 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package archivista is a client for Archivista that pools connections, bounds concurrency, and limits its request
+// rate so bulk uploads and downloads don't overload the server or the gateways in front of it.
+package archivista
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/testifysec/go-witness/archivista"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/witness/pkg/attestation/previousstep"
+	"google.golang.org/grpc"
+)
+
+const (
+	defaultConcurrency = 4
+	defaultMaxRetries  = 3
+	defaultChunkSize   = 64 * 1024
+	baseRetryDelay     = 500 * time.Millisecond
+	maxRetryDelay      = 30 * time.Second
+)
+
+type Client struct {
+	url         string
+	hc          *http.Client
+	conn        *grpc.ClientConn
+	token       string
+	limiter     *limiter
+	concurrency int
+	maxRetries  int
+	chunkSize   int
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests. By default a client with a connection pool sized to the
+// concurrency is used.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.hc = hc
+	}
+}
+
+// WithToken sets a bearer token sent with every request.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithConcurrency sets how many requests bulk operations make at once.
+func WithConcurrency(concurrency int) Option {
+	return func(c *Client) {
+		if concurrency > 0 {
+			c.concurrency = concurrency
+		}
+	}
+}
+
+// WithRateLimit limits the client to requestsPerSecond requests. 0 means no limit.
+func WithRateLimit(requestsPerSecond float64) Option {
+	return func(c *Client) {
+		c.limiter = newLimiter(requestsPerSecond)
+	}
+}
+
+// WithChunkSize sets the size of the chunks envelopes are streamed in, over gRPC and over HTTP with chunked transfer
+// encoding.
+func WithChunkSize(chunkSize int) Option {
+	return func(c *Client) {
+		if chunkSize > 0 {
+			c.chunkSize = chunkSize
+		}
+	}
+}
+
+// WithMaxRetries sets how many times requests that were throttled or failed with a temporary error are retried.
+func WithMaxRetries(maxRetries int) Option {
+	return func(c *Client) {
+		if maxRetries >= 0 {
+			c.maxRetries = maxRetries
+		}
+	}
+}
+
+func New(url string, opts ...Option) *Client {
+	c := &Client{
+		url:         url,
+		concurrency: defaultConcurrency,
+		maxRetries:  defaultMaxRetries,
+		chunkSize:   defaultChunkSize,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.hc == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = c.concurrency
+		c.hc = &http.Client{Transport: transport}
+	}
+
+	return c
+}
+
+// Close closes the idle connections of the http client and the gRPC connection of the client, if it has one.
+func (c *Client) Close() error {
+	c.hc.CloseIdleConnections()
+	if c.conn == nil {
+		return nil
+	}
+
+	return c.conn.Close()
+}
+
+func (c *Client) Store(ctx context.Context, env dsse.Envelope) (string, error) {
+	body, err := json.Marshal(env)
+	if err != nil {
+		return "", err
+	}
+
+	return c.StoreBytes(ctx, body)
+}
+
+// StoreBytes stores a serialized envelope. Archivista identifies objects by the gitoid of the bytes it received,
+// so the gitoid it returns is checked against the envelope to make sure it was assembled intact.
+func (c *Client) StoreBytes(ctx context.Context, envelope []byte) (string, error) {
+	var gitoid string
+	if c.conn != nil {
+		var err error
+		if gitoid, err = c.storeGRPC(ctx, envelope); err != nil {
+			return "", err
+		}
+	} else {
+		respBody, err := c.do(ctx, http.MethodPost, "upload", envelope)
+		if err != nil {
+			return "", err
+		}
+
+		storeResp := struct {
+			Gitoid string `json:"gitoid"`
+		}{}
+
+		if err := json.Unmarshal(respBody, &storeResp); err != nil {
+			return "", err
+		}
+
+		gitoid = storeResp.Gitoid
+	}
+
+	if expected := previousstep.GitOID(envelope); gitoid != expected {
+		return "", fmt.Errorf("archivista stored the envelope as %v, but the uploaded envelope has gitoid %v", gitoid, expected)
+	}
+
+	return gitoid, nil
+}
+
+func (c *Client) Download(ctx context.Context, gitoid string) (dsse.Envelope, error) {
+	var (
+		respBody []byte
+		err      error
+	)
+
+	if c.conn != nil {
+		respBody, err = c.downloadGRPC(ctx, gitoid)
+	} else {
+		respBody, err = c.do(ctx, http.MethodGet, "download/"+url.PathEscape(gitoid), nil)
+	}
+
+	if err != nil {
+		return dsse.Envelope{}, err
+	}
+
+	if actual := previousstep.GitOID(respBody); actual != gitoid {
+		return dsse.Envelope{}, fmt.Errorf("downloaded envelope has gitoid %v, expected %v", actual, gitoid)
+	}
+
+	env := dsse.Envelope{}
+	if err := json.Unmarshal(respBody, &env); err != nil {
+		return env, err
+	}
+
+	return env, nil
+}
+
+// StoreAll uploads envelopes using up to the client's concurrency, and returns their gitoids in the same order.
+func (c *Client) StoreAll(ctx context.Context, envs []dsse.Envelope) ([]string, error) {
+	envelopes := make([][]byte, 0, len(envs))
+	for _, env := range envs {
+		envelope, err := json.Marshal(env)
+		if err != nil {
+			return nil, err
+		}
+
+		envelopes = append(envelopes, envelope)
+	}
+
+	return c.StoreAllBytes(ctx, envelopes)
+}
+
+// StoreAllBytes uploads serialized envelopes using up to the client's concurrency, and returns their gitoids in
+// the same order. If an upload fails, the gitoids of the envelopes that were stored are still returned so the
+// upload can be resumed.
+func (c *Client) StoreAllBytes(ctx context.Context, envelopes [][]byte) ([]string, error) {
+	gitoids := make([]string, len(envelopes))
+	err := c.forEach(ctx, len(envelopes), func(ctx context.Context, i int) error {
+		gitoid, err := c.StoreBytes(ctx, envelopes[i])
+		if err != nil {
+			return fmt.Errorf("failed to store envelope %v: %w", i, err)
+		}
+
+		gitoids[i] = gitoid
+		return nil
+	})
+
+	return gitoids, err
+}
+
+// DownloadAll downloads envelopes using up to the client's concurrency, and returns them in the same order as gitoids.
+func (c *Client) DownloadAll(ctx context.Context, gitoids []string) ([]dsse.Envelope, error) {
+	envs := make([]dsse.Envelope, len(gitoids))
+	err := c.forEach(ctx, len(gitoids), func(ctx context.Context, i int) error {
+		env, err := c.Download(ctx, gitoids[i])
+		if err != nil {
+			return fmt.Errorf("failed to download %v: %w", gitoids[i], err)
+		}
+
+		envs[i] = env
+		return nil
+	})
+
+	return envs, err
+}
+
+func (c *Client) SearchGitoids(ctx context.Context, vars archivista.SearchGitoidVariables) ([]string, error) {
+	body, err := json.Marshal(struct {
+		Query     string                           `json:"query"`
+		Variables archivista.SearchGitoidVariables `json:"variables"`
+	}{searchGitoidsQuery, vars})
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := c.do(ctx, http.MethodPost, "query", body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := struct {
+		Data struct {
+			Dsses struct {
+				Edges []struct {
+					Node struct {
+						Gitoid string `json:"gitoidSha256"`
+					} `json:"node"`
+				} `json:"edges"`
+			} `json:"dsses"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return nil, err
+	}
+
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("graph ql query failed: %v", response.Errors)
+	}
+
+	gitoids := make([]string, 0, len(response.Data.Dsses.Edges))
+	for _, edge := range response.Data.Dsses.Edges {
+		gitoids = append(gitoids, edge.Node.Gitoid)
+	}
+
+	return gitoids, nil
+}
+
+// forEach calls fn for each index from 0 to n with up to the client's concurrency, stopping at the first error.
+func (c *Client) forEach(ctx context.Context, n int, fn func(context.Context, int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indexes := make(chan int)
+	errs := make(chan error, n)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < c.concurrency && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := fn(ctx, i); err != nil {
+					errs <- err
+					cancel()
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+
+	close(indexes)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+// do makes a request, retrying throttled requests and temporary server errors.
+func (c *Client) do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	reqURL, err := url.JoinPath(c.url, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var respBody []byte
+	err = c.retry(ctx, func(ctx context.Context) (time.Duration, error) {
+		var (
+			retryAfter time.Duration
+			err        error
+		)
+
+		respBody, retryAfter, err = c.doOnce(ctx, method, reqURL, body)
+		return retryAfter, err
+	})
+
+	return respBody, err
+}
+
+// retry calls fn until it succeeds, it returns a negative retry delay, or the client runs out of retries. Retries
+// back off exponentially with full jitter unless fn returns how long to wait.
+func (c *Client) retry(ctx context.Context, fn func(context.Context) (time.Duration, error)) error {
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.wait(ctx); err != nil {
+			return err
+		}
+
+		retryAfter, err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if retryAfter < 0 || attempt >= c.maxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		if retryAfter == 0 {
+			retryAfter = backoff(attempt)
+		}
+
+		if err := sleep(ctx, retryAfter); err != nil {
+			return err
+		}
+	}
+}
+
+// doOnce makes a single request. retryAfter is negative if the request shouldn't be retried, and zero if it
+// should be retried after the default backoff.
+func (c *Client) doOnce(ctx context.Context, method, reqURL string, body []byte) (respBody []byte, retryAfter time.Duration, err error) {
+	var reqBody io.Reader
+	if len(body) > c.chunkSize {
+		// net/http doesn't know the length of a chunkReader, so it sends each read as a chunk of its own
+		reqBody = &chunkReader{r: bytes.NewReader(body), size: c.chunkSize}
+	} else if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, reqBody)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer resp.Body.Close()
+	respBody, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return respBody, 0, nil
+	}
+
+	err = errors.New(string(respBody))
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")), err
+	default:
+		return nil, -1, err
+	}
+}
+
+// chunkReader reads at most size bytes at a time from r.
+type chunkReader struct {
+	r    io.Reader
+	size int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(p) > c.size {
+		p = p[:c.size]
+	}
+
+	return c.r.Read(p)
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return minDuration(time.Duration(seconds)*time.Second, maxRetryDelay)
+	}
+
+	if t, err := http.ParseTime(value); err == nil && time.Until(t) > 0 {
+		return minDuration(time.Until(t), maxRetryDelay)
+	}
+
+	return 0
+}
+
+func backoff(attempt int) time.Duration {
+	// the delay reaches its cap long before shifting by attempt could overflow
+	delay := maxRetryDelay
+	if attempt < 16 {
+		delay = minDuration(baseRetryDelay<<attempt, maxRetryDelay)
+	}
+
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+const searchGitoidsQuery = `query ($subjectDigests: [String!], $attestations: [String!], $collectionName: String!, $excludeGitoids: [String!]) {
+  dsses(
+    where: {
+      gitoidSha256NotIn: $excludeGitoids,
+      hasStatementWith: {
+        hasAttestationCollectionsWith: {
+          name: $collectionName,
+          hasAttestationsWith: {
+            typeIn: $attestations
+          }
+        },
+        hasSubjectsWith: {
+          hasSubjectDigestsWith: {
+            valueIn: $subjectDigests
+          }
+        }
+      }
+    }
+  ) {
+    edges {
+      node {
+        gitoidSha256
+      }
+    }
+  }
+}`
@@ -0,0 +1,223 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archivista
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/witness/pkg/attestation/previousstep"
+)
+
+func TestStoreAllBoundsConcurrency(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		fmt.Fprintf(w, `{"gitoid":%q}`, previousstep.GitOID(body))
+	}))
+	defer server.Close()
+
+	envs := make([]dsse.Envelope, 20)
+	for i := range envs {
+		envs[i] = dsse.Envelope{PayloadType: fmt.Sprintf("gitoid-%v", i)}
+	}
+
+	gitoids, err := New(server.URL, WithConcurrency(3)).StoreAll(context.Background(), envs)
+	require.NoError(t, err)
+	require.Len(t, gitoids, 20)
+	env7, err := json.Marshal(envs[7])
+	require.NoError(t, err)
+	require.Equal(t, previousstep.GitOID(env7), gitoids[7])
+	require.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(3))
+}
+
+func TestRetryThrottled(t *testing.T) {
+	const envelope = `{"payloadType":"test"}`
+	gitoid := previousstep.GitOID([]byte(envelope))
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		require.Equal(t, "/download/"+gitoid, r.URL.Path)
+		fmt.Fprint(w, envelope)
+	}))
+	defer server.Close()
+
+	env, err := New(server.URL).Download(context.Background(), gitoid)
+	require.NoError(t, err)
+	require.Equal(t, "test", env.PayloadType)
+	require.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+
+	atomic.StoreInt32(&attempts, 0)
+	_, err = New(server.URL, WithMaxRetries(1)).Download(context.Background(), gitoid)
+	require.Error(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestIntegrityMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/upload" {
+			fmt.Fprint(w, `{"gitoid":"truncated"}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"payloadType":"tampered"}`)
+	}))
+	defer server.Close()
+
+	client := New(server.URL)
+	_, err := client.Store(context.Background(), dsse.Envelope{PayloadType: "test"})
+	require.ErrorContains(t, err, "uploaded envelope has gitoid")
+	_, err = client.Download(context.Background(), previousstep.GitOID([]byte(`{"payloadType":"test"}`)))
+	require.ErrorContains(t, err, "downloaded envelope has gitoid")
+}
+
+func TestStoreStreamsChunks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, []string{"chunked"}, r.TransferEncoding)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		fmt.Fprintf(w, `{"gitoid":%q}`, previousstep.GitOID(body))
+	}))
+	defer server.Close()
+
+	env := dsse.Envelope{PayloadType: "test", Payload: []byte(strings.Repeat("sbom", 1024))}
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+	gitoid, err := New(server.URL, WithChunkSize(512)).Store(context.Background(), env)
+	require.NoError(t, err)
+	require.Equal(t, previousstep.GitOID(data), gitoid)
+
+	reader := &chunkReader{r: strings.NewReader(strings.Repeat("a", 100)), size: 16}
+	n, err := reader.Read(make([]byte, 64))
+	require.NoError(t, err)
+	require.Equal(t, 16, n)
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "bad envelope")
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL).Store(context.Background(), dsse.Envelope{})
+	require.ErrorContains(t, err, "bad envelope")
+	require.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.Copy(io.Discard, r.Body)
+		require.NoError(t, err)
+		fmt.Fprintf(w, `{"gitoid":%q}`, previousstep.GitOID([]byte(`{}`)))
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	client := New(server.URL, WithRateLimit(50), WithConcurrency(5))
+	err := client.forEach(context.Background(), 6, func(ctx context.Context, i int) error {
+		_, err := client.StoreBytes(ctx, []byte(`{}`))
+		return err
+	})
+	require.NoError(t, err)
+	// six requests at 50 per second are spaced 20ms apart
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestSourceSearch(t *testing.T) {
+	payload := `{"_type":"https://in-toto.io/Statement/v0.1","subject":[],"predicateType":"https://witness.testifysec.com/attestation-collection/v0.1","predicate":{"name":"build","attestations":[]}}`
+	envelopes := make(map[string][]byte)
+	gitoids := make([]string, 0)
+	for _, payloadType := range []string{"one", "two"} {
+		data, err := json.Marshal(dsse.Envelope{Payload: []byte(payload), PayloadType: payloadType})
+		require.NoError(t, err)
+		envelopes[previousstep.GitOID(data)] = data
+		gitoids = append(gitoids, previousstep.GitOID(data))
+	}
+
+	mu := &sync.Mutex{}
+	excluded := make([][]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/query" {
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			req := struct {
+				Variables struct {
+					ExcludeGitoids []string `json:"excludeGitoids"`
+				} `json:"variables"`
+			}{}
+
+			require.NoError(t, json.Unmarshal(body, &req))
+			mu.Lock()
+			excluded = append(excluded, req.Variables.ExcludeGitoids)
+			mu.Unlock()
+			fmt.Fprintf(w, `{"data":{"dsses":{"edges":[{"node":{"gitoidSha256":%q}},{"node":{"gitoidSha256":%q}}]}}}`, gitoids[0], gitoids[1])
+			return
+		}
+
+		_, err := w.Write(envelopes[strings.TrimPrefix(r.URL.Path, "/download/")])
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+
+	s := NewSource(New(server.URL))
+	found, err := s.Search(context.Background(), "build", []string{"abcd"}, nil)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, gitoids[0], found[0].Reference)
+	require.Equal(t, "two", found[1].Envelope.PayloadType)
+	require.Equal(t, "build", found[1].Collection.Name)
+
+	_, err = s.Search(context.Background(), "build", []string{"abcd"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, gitoids, excluded[1])
+}
+
+func TestBackoff(t *testing.T) {
+	for _, attempt := range []int{0, 1, 10, 40, 64, 1000} {
+		delay := backoff(attempt)
+		require.Greater(t, delay, time.Duration(0))
+		require.LessOrEqual(t, delay, maxRetryDelay)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archivista
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	collectorStoreMethod = "/archivist.Collector/Store"
+	collectorGetMethod   = "/archivist.Collector/Get"
+)
+
+var (
+	storeStreamDesc = &grpc.StreamDesc{StreamName: "Store", ClientStreams: true}
+	getStreamDesc   = &grpc.StreamDesc{StreamName: "Get", ServerStreams: true}
+)
+
+// WithGRPCConn stores and downloads envelopes with Archivista's gRPC Collector service over conn instead of the
+// HTTP API. Envelopes are streamed in chunks, which is much faster for large envelopes. Searches still use the
+// GraphQL API, since the gRPC API can't filter by collection name or attestation type.
+func WithGRPCConn(conn *grpc.ClientConn) Option {
+	return func(c *Client) {
+		c.conn = conn
+	}
+}
+
+// DialGRPC connects to Archivista's gRPC API at target. The connection is made with TLS unless tlsConfig is nil.
+// If token isn't empty it is sent as a bearer token with every call, which requires TLS.
+func DialGRPC(target string, tlsConfig *tls.Config, token string) (*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{grpc.WithDefaultCallOptions(grpc.ForceCodec(wireCodec{}))}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else if token != "" {
+		return nil, errors.New("a token can't be sent to archivista over an insecure connection")
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken(token)))
+	}
+
+	return grpc.Dial(target, opts...)
+}
+
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool {
+	return true
+}
+
+func (c *Client) storeGRPC(ctx context.Context, envelope []byte) (string, error) {
+	resp := &storeResponse{}
+	err := c.retry(ctx, func(ctx context.Context) (time.Duration, error) {
+		stream, err := c.conn.NewStream(ctx, storeStreamDesc, collectorStoreMethod)
+		if err != nil {
+			return grpcRetryAfter(err), err
+		}
+
+		for offset := 0; offset < len(envelope); offset += c.chunkSize {
+			end := offset + c.chunkSize
+			if end > len(envelope) {
+				end = len(envelope)
+			}
+
+			if err := stream.SendMsg(&chunk{data: envelope[offset:end]}); err != nil {
+				// the server's reason for ending the stream is only available from RecvMsg
+				if err == io.EOF {
+					err = stream.RecvMsg(resp)
+				}
+
+				return grpcRetryAfter(err), err
+			}
+		}
+
+		if err := stream.CloseSend(); err != nil {
+			return grpcRetryAfter(err), err
+		}
+
+		err = stream.RecvMsg(resp)
+		return grpcRetryAfter(err), err
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return resp.gitoid, nil
+}
+
+func (c *Client) downloadGRPC(ctx context.Context, gitoid string) ([]byte, error) {
+	envelope := &bytes.Buffer{}
+	err := c.retry(ctx, func(ctx context.Context) (time.Duration, error) {
+		envelope.Reset()
+		stream, err := c.conn.NewStream(ctx, getStreamDesc, collectorGetMethod)
+		if err != nil {
+			return grpcRetryAfter(err), err
+		}
+
+		if err := stream.SendMsg(&getRequest{gitoid: gitoid}); err != nil {
+			return grpcRetryAfter(err), err
+		}
+
+		if err := stream.CloseSend(); err != nil {
+			return grpcRetryAfter(err), err
+		}
+
+		for {
+			msg := &chunk{}
+			if err := stream.RecvMsg(msg); err == io.EOF {
+				return 0, nil
+			} else if err != nil {
+				return grpcRetryAfter(err), err
+			}
+
+			envelope.Write(msg.data)
+		}
+	})
+
+	return envelope.Bytes(), err
+}
+
+// grpcRetryAfter returns 0 for errors that should be retried after the default backoff and -1 for everything else.
+func grpcRetryAfter(err error) time.Duration {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+		return 0
+	default:
+		return -1
+	}
+}
+
+// wireMessage is implemented by the messages of Archivista's gRPC API. They're small enough that encoding them
+// by hand is simpler than generating and vendoring code for the whole API.
+type wireMessage interface {
+	marshal() []byte
+	unmarshal([]byte) error
+}
+
+// wireCodec encodes wireMessages in the protobuf wire format.
+type wireCodec struct{}
+
+func (wireCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T", v)
+	}
+
+	return m.marshal(), nil
+}
+
+func (wireCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T", v)
+	}
+
+	return m.unmarshal(data)
+}
+
+func (wireCodec) Name() string {
+	return "proto"
+}
+
+// chunk is archivist.Chunk, with the chunk in field 1.
+type chunk struct {
+	data []byte
+}
+
+func (c *chunk) marshal() []byte {
+	return appendBytesField(nil, 1, c.data)
+}
+
+func (c *chunk) unmarshal(data []byte) error {
+	return consumeBytesField(data, 1, func(b []byte) { c.data = append([]byte{}, b...) })
+}
+
+// storeResponse is archivist.StoreResponse, with the gitoid in field 1.
+type storeResponse struct {
+	gitoid string
+}
+
+func (r *storeResponse) marshal() []byte {
+	return appendBytesField(nil, 1, []byte(r.gitoid))
+}
+
+func (r *storeResponse) unmarshal(data []byte) error {
+	return consumeBytesField(data, 1, func(b []byte) { r.gitoid = string(b) })
+}
+
+// getRequest is archivist.GetRequest, with the gitoid in field 1.
+type getRequest struct {
+	gitoid string
+}
+
+func (r *getRequest) marshal() []byte {
+	return appendBytesField(nil, 1, []byte(r.gitoid))
+}
+
+func (r *getRequest) unmarshal(data []byte) error {
+	return consumeBytesField(data, 1, func(b []byte) { r.gitoid = string(b) })
+}
+
+func appendBytesField(b []byte, num protowire.Number, value []byte) []byte {
+	if len(value) == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+// consumeBytesField calls set with the value of the length delimited field num, skipping any other fields.
+func consumeBytesField(data []byte, num protowire.Number, set func([]byte)) error {
+	for len(data) > 0 {
+		fieldNum, fieldType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		data = data[n:]
+		if fieldNum == num && fieldType == protowire.BytesType {
+			value, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+
+			set(value)
+			data = data[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(fieldNum, fieldType, data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		data = data[n:]
+	}
+
+	return nil
+}
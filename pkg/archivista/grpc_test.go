@@ -0,0 +1,155 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archivista
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/witness/pkg/attestation/previousstep"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// collector is an in memory implementation of Archivista's gRPC Collector service.
+type collector struct {
+	mu          sync.Mutex
+	envelopes   map[string][]byte
+	chunks      int
+	unavailable int
+}
+
+func (c *collector) handle(srv interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	c.mu.Lock()
+	if c.unavailable > 0 {
+		c.unavailable--
+		c.mu.Unlock()
+		return status.Error(codes.Unavailable, "try again")
+	}
+
+	c.mu.Unlock()
+	switch method {
+	case collectorStoreMethod:
+		envelope := &bytes.Buffer{}
+		for {
+			msg := &chunk{}
+			if err := stream.RecvMsg(msg); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+
+			c.mu.Lock()
+			c.chunks++
+			c.mu.Unlock()
+			envelope.Write(msg.data)
+		}
+
+		gitoid := previousstep.GitOID(envelope.Bytes())
+		c.mu.Lock()
+		c.envelopes[gitoid] = envelope.Bytes()
+		c.mu.Unlock()
+		return stream.SendMsg(&storeResponse{gitoid: gitoid})
+	case collectorGetMethod:
+		req := &getRequest{}
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		envelope, ok := c.envelopes[req.gitoid]
+		c.mu.Unlock()
+		if !ok {
+			return status.Error(codes.NotFound, "not found")
+		}
+
+		for offset := 0; offset < len(envelope); offset += 10 {
+			end := offset + 10
+			if end > len(envelope) {
+				end = len(envelope)
+			}
+
+			if err := stream.SendMsg(&chunk{data: envelope[offset:end]}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return status.Error(codes.Unimplemented, method)
+	}
+}
+
+func newGRPCClient(t *testing.T, c *collector) *Client {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.ForceServerCodec(wireCodec{}), grpc.UnknownServiceHandler(c.handle))
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(wireCodec{})),
+	)
+
+	require.NoError(t, err)
+	client := New("http://unused", WithGRPCConn(conn))
+	t.Cleanup(func() { require.NoError(t, client.Close()) })
+	return client
+}
+
+func TestGRPCStoreAndDownload(t *testing.T) {
+	c := &collector{envelopes: make(map[string][]byte), unavailable: 1}
+	client := newGRPCClient(t, c)
+	env := dsse.Envelope{Payload: bytes.Repeat([]byte("a"), 3*defaultChunkSize), PayloadType: "test"}
+
+	gitoid, err := client.Store(context.Background(), env)
+	require.NoError(t, err)
+	require.Greater(t, c.chunks, 1)
+
+	downloaded, err := client.Download(context.Background(), gitoid)
+	require.NoError(t, err)
+	require.Equal(t, env.Payload, downloaded.Payload)
+	require.Equal(t, "test", downloaded.PayloadType)
+
+	_, err = client.Download(context.Background(), "missing")
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestWireMessages(t *testing.T) {
+	original := &chunk{data: []byte("envelope")}
+	// unknown fields are skipped so newer servers can add fields
+	data := append(protowire.AppendVarint(protowire.AppendTag(nil, 2, protowire.VarintType), 7), original.marshal()...)
+	decoded := &chunk{}
+	require.NoError(t, decoded.unmarshal(data))
+	require.Equal(t, original.data, decoded.data)
+	require.Error(t, decoded.unmarshal([]byte{0x0a, 0x05}))
+}
+
+func TestDialGRPCRefusesTokenWithoutTLS(t *testing.T) {
+	_, err := DialGRPC("localhost:1", nil, "token")
+	require.Error(t, err)
+}
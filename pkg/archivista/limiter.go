@@ -0,0 +1,64 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archivista
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// limiter spaces requests evenly at a fixed rate. Each request is delayed by a small random jitter so many
+// witness processes started by the same pipeline don't send their requests in lockstep.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newLimiter returns a limiter allowing requestsPerSecond requests, or nil if requestsPerSecond isn't positive.
+// A nil limiter doesn't limit anything.
+func newLimiter(requestsPerSecond float64) *limiter {
+	if requestsPerSecond <= 0 {
+		return nil
+	}
+
+	return &limiter{interval: time.Duration(float64(time.Second) / requestsPerSecond)}
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	jitter := time.Duration(rand.Int63n(int64(l.interval)/10 + 1))
+	delay := slot.Sub(now) + jitter
+	if delay <= 0 {
+		return nil
+	}
+
+	return sleep(ctx, delay)
+}
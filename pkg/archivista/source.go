@@ -0,0 +1,94 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archivista
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/testifysec/go-witness/archivista"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/go-witness/source"
+)
+
+// Source searches Archivista for collections during verification, downloading the envelopes found by each
+// search concurrently.
+type Source struct {
+	client      *Client
+	mu          sync.Mutex
+	seenGitoids []string
+}
+
+func NewSource(client *Client) *Source {
+	return &Source{
+		client:      client,
+		seenGitoids: make([]string, 0),
+	}
+}
+
+func (s *Source) Search(ctx context.Context, collectionName string, subjectDigests, attestations []string) ([]source.CollectionEnvelope, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	gitoids, err := s.client.SearchGitoids(ctx, archivista.SearchGitoidVariables{
+		CollectionName: collectionName,
+		SubjectDigests: subjectDigests,
+		Attestations:   attestations,
+		ExcludeGitoids: s.seenGitoids,
+	})
+
+	if err != nil {
+		return []source.CollectionEnvelope{}, err
+	}
+
+	envs, err := s.client.DownloadAll(ctx, gitoids)
+	if err != nil {
+		return []source.CollectionEnvelope{}, err
+	}
+
+	envelopes := make([]source.CollectionEnvelope, 0, len(gitoids))
+	for i, gitoid := range gitoids {
+		s.seenGitoids = append(s.seenGitoids, gitoid)
+		collectionEnv, err := envelopeToCollectionEnvelope(gitoid, envs[i])
+		if err != nil {
+			return envelopes, err
+		}
+
+		envelopes = append(envelopes, collectionEnv)
+	}
+
+	return envelopes, nil
+}
+
+func envelopeToCollectionEnvelope(reference string, env dsse.Envelope) (source.CollectionEnvelope, error) {
+	statement := intoto.Statement{}
+	if err := json.Unmarshal(env.Payload, &statement); err != nil {
+		return source.CollectionEnvelope{}, err
+	}
+
+	collection := attestation.Collection{}
+	if err := json.Unmarshal(statement.Predicate, &collection); err != nil {
+		return source.CollectionEnvelope{}, err
+	}
+
+	return source.CollectionEnvelope{
+		Reference:  reference,
+		Envelope:   env,
+		Statement:  statement,
+		Collection: collection,
+	}, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ancestry
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+)
+
+const (
+	Name    = "ancestry"
+	Type    = "https://witness.dev/attestations/ancestry/v0.1"
+	RunType = attestation.PreMaterialRunType
+
+	// maxDepth bounds the walk up the process tree in case parents can't be trusted to end at init.
+	maxDepth = 64
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Process is a process witness descends from.
+type Process struct {
+	Pid       int                  `json:"pid"`
+	Ppid      int                  `json:"ppid"`
+	Comm      string               `json:"comm,omitempty"`
+	Cmdline   []string             `json:"cmdline,omitempty"`
+	Exe       string               `json:"exe,omitempty"`
+	ExeDigest cryptoutil.DigestSet `json:"exedigest,omitempty"`
+}
+
+// Attestor records the processes witness descends from, starting with its parent, and the container it runs in, so
+// a policy can check that witness was invoked by the expected CI runner agent rather than an arbitrary shell.
+type Attestor struct {
+	Processes   []Process `json:"processes"`
+	ContainerID string    `json:"containerid,omitempty"`
+
+	readProcess     func(pid int) (Process, error)
+	readContainerID func() (string, error)
+}
+
+func New() *Attestor {
+	return &Attestor{
+		readProcess:     readProcess,
+		readContainerID: readContainerID,
+	}
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	seen := make(map[int]struct{})
+	for pid := os.Getppid(); pid > 0 && len(a.Processes) < maxDepth; {
+		if _, ok := seen[pid]; ok {
+			break
+		}
+
+		seen[pid] = struct{}{}
+		process, err := a.readProcess(pid)
+		if err != nil {
+			log.Debugf("failed to read ancestor process %v: %v", pid, err)
+			a.Processes = append(a.Processes, Process{Pid: pid})
+			break
+		}
+
+		if process.Exe != "" {
+			if process.ExeDigest, err = cryptoutil.CalculateDigestSetFromFile(process.Exe, ctx.Hashes()); err != nil {
+				log.Debugf("failed to hash the executable of ancestor process %v: %v", pid, err)
+			}
+		}
+
+		a.Processes = append(a.Processes, process)
+		pid = process.Ppid
+	}
+
+	containerID, err := a.readContainerID()
+	if err != nil {
+		log.Debugf("failed to find the container witness runs in: %v", err)
+	}
+
+	a.ContainerID = containerID
+	return nil
+}
+
+var (
+	cgroupContainerID    = regexp.MustCompile(`[0-9a-f]{64}`)
+	mountinfoContainerID = regexp.MustCompile(`/containers/([0-9a-f]{64})/`)
+)
+
+// parseContainerID finds the ID of the container a process runs in from its cgroups, or failing that, from the
+// files container runtimes mount into containers, which is needed under cgroup namespaces where the cgroup is "/".
+func parseContainerID(cgroup, mountinfo string) string {
+	for _, line := range strings.Split(cgroup, "\n") {
+		if id := cgroupContainerID.FindString(line); id != "" {
+			return id
+		}
+	}
+
+	if match := mountinfoContainerID.FindStringSubmatch(mountinfo); match != nil {
+		return match[1]
+	}
+
+	return ""
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ancestry
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/testifysec/witness/internal/procfs"
+)
+
+func readProcess(pid int) (Process, error) {
+	stat, err := procfs.ReadStat(pid)
+	if err != nil {
+		return Process{}, err
+	}
+
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	process := Process{Pid: pid, Ppid: stat.Ppid, Comm: stat.Comm}
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(cmdline) > 0 {
+		process.Cmdline = strings.Split(string(bytes.TrimSuffix(cmdline, []byte{0})), "\x00")
+	}
+
+	// the executables of processes owned by other users can't be read, which leaves them unrecorded
+	if exe, err := os.Readlink(filepath.Join(dir, "exe")); err == nil {
+		process.Exe = exe
+	}
+
+	return process, nil
+}
+
+func readContainerID() (string, error) {
+	cgroup, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	mountinfo, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	return parseContainerID(string(cgroup), string(mountinfo)), nil
+}
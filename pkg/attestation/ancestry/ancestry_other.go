@@ -0,0 +1,26 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package ancestry
+
+// readProcess only knows the parent of witness itself, since walking further up the process tree relies on procfs.
+func readProcess(pid int) (Process, error) {
+	return Process{Pid: pid}, nil
+}
+
+func readContainerID() (string, error) {
+	return "", nil
+}
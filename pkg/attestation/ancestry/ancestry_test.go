@@ -0,0 +1,82 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ancestry
+
+import (
+	"crypto"
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+)
+
+func TestAttest(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process ancestry is only walked on linux")
+	}
+
+	a := New()
+	ctx, err := attestation.NewContext([]attestation.Attestor{a}, attestation.WithHashes([]crypto.Hash{crypto.SHA256}))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	require.NotEmpty(t, a.Processes)
+	require.Equal(t, os.Getppid(), a.Processes[0].Pid)
+	require.NotEmpty(t, a.Processes[0].Comm)
+	require.NotEmpty(t, a.Processes[0].Cmdline)
+	require.NotEmpty(t, a.Processes[0].ExeDigest)
+	for i := 1; i < len(a.Processes); i++ {
+		require.Equal(t, a.Processes[i-1].Ppid, a.Processes[i].Pid)
+	}
+}
+
+func TestAttestUnreadableAncestor(t *testing.T) {
+	a := New()
+	a.readProcess = func(pid int) (Process, error) {
+		if pid == os.Getppid() {
+			return Process{Pid: pid, Ppid: 4242, Comm: "runner"}, nil
+		}
+
+		return Process{}, errors.New("permission denied")
+	}
+
+	a.readContainerID = func() (string, error) { return "", nil }
+	require.NoError(t, a.Attest(nil))
+	require.Equal(t, []Process{{Pid: os.Getppid(), Ppid: 4242, Comm: "runner"}, {Pid: 4242}}, a.Processes)
+}
+
+func TestParseContainerID(t *testing.T) {
+	id := "4f1b6e0a3c0b2b8fd1e7a9f0d3b5c6a7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a2b3"
+	tests := []struct {
+		name      string
+		cgroup    string
+		mountinfo string
+		want      string
+	}{
+		{name: "docker cgroup v1", cgroup: "12:memory:/docker/" + id + "\n1:name=systemd:/docker/" + id, want: id},
+		{name: "systemd scope", cgroup: "0::/system.slice/docker-" + id + ".scope", want: id},
+		{name: "kubernetes", cgroup: "0::/kubepods/besteffort/pod1234/cri-containerd-" + id + ".scope", want: id},
+		{name: "cgroup namespace", cgroup: "0::/", mountinfo: "612 598 254:1 /var/lib/docker/containers/" + id + "/hostname /etc/hostname rw", want: id},
+		{name: "host", cgroup: "0::/user.slice/user-1000.slice/session-2.scope", mountinfo: "22 1 254:1 / / rw", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, parseContainerID(tt.cgroup, tt.mountinfo))
+		})
+	}
+}
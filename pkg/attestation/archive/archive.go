@@ -0,0 +1,353 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+)
+
+const (
+	Name    = "archive"
+	Type    = "https://witness.dev/attestations/archive/v0.1"
+	RunType = attestation.PostProductRunType
+
+	defaultMaxDepth = 2
+
+	// nested archives have to be buffered in memory to be inspected, so they are skipped past this size
+	maxNestedArchiveSize = 256 << 20
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor  = &Attestor{}
+	_ attestation.Subjecter = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() },
+		attestation.IntConfigOption(
+			"maxDepth",
+			"How many levels of nested archives to inspect when recording archive members.",
+			defaultMaxDepth,
+			func(a attestation.Attestor, maxDepth int) (attestation.Attestor, error) {
+				archiveAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not an archive attestor", a)
+				}
+
+				WithMaxDepth(maxDepth)(archiveAttestor)
+				return archiveAttestor, nil
+			},
+		),
+	)
+}
+
+type Format string
+
+const (
+	FormatZip     Format = "zip"
+	FormatTar     Format = "tar"
+	FormatTarGzip Format = "tar+gzip"
+)
+
+type Archive struct {
+	Format  Format                          `json:"format"`
+	Digest  cryptoutil.DigestSet            `json:"digest"`
+	Members map[string]cryptoutil.DigestSet `json:"members"`
+}
+
+type Option func(*Attestor)
+
+func WithMaxDepth(maxDepth int) Option {
+	return func(a *Attestor) {
+		a.maxDepth = maxDepth
+	}
+}
+
+type Attestor struct {
+	archives map[string]Archive
+	maxDepth int
+	hashes   []crypto.Hash
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		archives: make(map[string]Archive),
+		maxDepth: defaultMaxDepth,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	if a.maxDepth < 1 {
+		return attestation.ErrInvalidOption{
+			Option: "maxDepth",
+			Reason: "at least one level of archives must be inspected",
+		}
+	}
+
+	a.hashes = ctx.Hashes()
+	for path, product := range ctx.Products() {
+		archive, err := a.inspectFile(filepath.Join(ctx.WorkingDir(), path))
+		if err != nil {
+			log.Debugf("(attestation/archive) could not inspect product %v: %v", path, err)
+			continue
+		}
+
+		if archive == nil {
+			continue
+		}
+
+		archive.Digest = product.Digest
+		a.archives[path] = *archive
+	}
+
+	return nil
+}
+
+func (a *Attestor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.archives)
+}
+
+func (a *Attestor) UnmarshalJSON(data []byte) error {
+	archives := make(map[string]Archive)
+	if err := json.Unmarshal(data, &archives); err != nil {
+		return err
+	}
+
+	a.archives = archives
+	return nil
+}
+
+func (a *Attestor) Archives() map[string]Archive {
+	return a.archives
+}
+
+// Subjects returns each archive member so attestations can be found by the digest of a file that was
+// packaged into an archive, even after the archive itself has been repackaged.
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for archivePath, archive := range a.archives {
+		for memberPath, digest := range archive.Members {
+			subjects[fmt.Sprintf("file:%v!/%v", archivePath, memberPath)] = digest
+		}
+	}
+
+	return subjects
+}
+
+// inspectFile returns the members of the archive at path, or nil if the file is not a recognized archive.
+func (a *Attestor) inspectFile(path string) (*Archive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if !stat.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	format, err := detectFormat(f, stat.Size())
+	if err != nil || format == "" {
+		return nil, err
+	}
+
+	archive := &Archive{
+		Format:  format,
+		Members: make(map[string]cryptoutil.DigestSet),
+	}
+
+	if err := a.inspect(f, stat.Size(), format, "", 1, archive.Members); err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+func (a *Attestor) inspect(r io.ReaderAt, size int64, format Format, prefix string, depth int, members map[string]cryptoutil.DigestSet) error {
+	switch format {
+	case FormatZip:
+		zipReader, err := zip.NewReader(r, size)
+		if err != nil {
+			return err
+		}
+
+		for _, zipFile := range zipReader.File {
+			if zipFile.FileInfo().IsDir() {
+				continue
+			}
+
+			memberReader, err := zipFile.Open()
+			if err != nil {
+				return err
+			}
+
+			err = a.recordMember(memberReader, int64(zipFile.UncompressedSize64), prefix+zipFile.Name, depth, members)
+			memberReader.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+	case FormatTar, FormatTarGzip:
+		var tarStream io.Reader = io.NewSectionReader(r, 0, size)
+		if format == FormatTarGzip {
+			gzipReader, err := gzip.NewReader(tarStream)
+			if err != nil {
+				return err
+			}
+
+			defer gzipReader.Close()
+			tarStream = gzipReader
+		}
+
+		tarReader := tar.NewReader(tarStream)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+
+			if err := a.recordMember(tarReader, header.Size, prefix+header.Name, depth, members); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("unsupported archive format: %v", format)
+	}
+
+	return nil
+}
+
+// recordMember digests a single archive member. Members that are archives themselves are descended into
+// until the attestor's max depth is reached.
+func (a *Attestor) recordMember(r io.Reader, size int64, name string, depth int, members map[string]cryptoutil.DigestSet) error {
+	if depth >= a.maxDepth || size > maxNestedArchiveSize {
+		digest, err := cryptoutil.CalculateDigestSet(r, a.hashes)
+		if err != nil {
+			return err
+		}
+
+		members[name] = digest
+		return nil
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	digest, err := cryptoutil.CalculateDigestSetFromBytes(data, a.hashes)
+	if err != nil {
+		return err
+	}
+
+	members[name] = digest
+	nestedReader := bytes.NewReader(data)
+	format, err := detectFormat(nestedReader, int64(len(data)))
+	if err != nil || format == "" {
+		return nil
+	}
+
+	if err := a.inspect(nestedReader, int64(len(data)), format, name+"!/", depth+1, members); err != nil {
+		log.Debugf("(attestation/archive) could not inspect nested archive %v: %v", name, err)
+	}
+
+	return nil
+}
+
+// detectFormat sniffs the archive format from the file's signature rather than trusting its extension.
+// An empty format is returned if the data is not a supported archive.
+func detectFormat(r io.ReaderAt, size int64) (Format, error) {
+	header := make([]byte, 512)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	header = header[:n]
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return FormatZip, nil
+	case isTar(header):
+		return FormatTar, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		gzipReader, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return "", nil
+		}
+
+		defer gzipReader.Close()
+		inner, err := bufio.NewReaderSize(gzipReader, 512).Peek(512)
+		if err != nil && err != io.EOF {
+			return "", nil
+		}
+
+		if isTar(inner) {
+			return FormatTarGzip, nil
+		}
+	}
+
+	return "", nil
+}
+
+func isTar(header []byte) bool {
+	return len(header) >= 262 && bytes.Equal(header[257:262], []byte("ustar"))
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+func TestInspectNestedArchive(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho hello\n")
+	jarBuf := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(jarBuf)
+	w, err := zipWriter.Create("bin/app")
+	require.NoError(t, err)
+	_, err = w.Write(binary)
+	require.NoError(t, err)
+	require.NoError(t, zipWriter.Close())
+
+	tgzPath := filepath.Join(t.TempDir(), "release.tar.gz")
+	f, err := os.Create(tgzPath)
+	require.NoError(t, err)
+	gzipWriter := gzip.NewWriter(f)
+	tarWriter := tar.NewWriter(gzipWriter)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "lib/app.jar", Mode: 0644, Size: int64(jarBuf.Len()), Typeflag: tar.TypeReg}))
+	_, err = tarWriter.Write(jarBuf.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	require.NoError(t, f.Close())
+
+	a := New()
+	a.hashes = []crypto.Hash{crypto.SHA256}
+	archive, err := a.inspectFile(tgzPath)
+	require.NoError(t, err)
+	require.NotNil(t, archive)
+	require.Equal(t, FormatTarGzip, archive.Format)
+
+	expected, err := cryptoutil.CalculateDigestSetFromBytes(binary, a.hashes)
+	require.NoError(t, err)
+	require.Contains(t, archive.Members, "lib/app.jar")
+	require.True(t, expected.Equal(archive.Members["lib/app.jar!/bin/app"]))
+
+	WithMaxDepth(1)(a)
+	archive, err = a.inspectFile(tgzPath)
+	require.NoError(t, err)
+	require.Len(t, archive.Members, 1)
+}
+
+func TestInspectNotArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(path, []byte("not an archive"), 0644))
+
+	a := New()
+	archive, err := a.inspectFile(path)
+	require.NoError(t, err)
+	require.Nil(t, archive)
+}
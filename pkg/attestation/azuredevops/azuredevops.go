@@ -0,0 +1,329 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package azuredevops records the Azure Pipelines run a step ran in. When the pipeline can request an OIDC token for
+// a service connection, the token is verified against its organization's issuer and its subject is checked against
+// the organization and project of the run, so policies can trust where the build came from.
+package azuredevops
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/jwt"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/oidc"
+)
+
+const (
+	Name    = "azure-devops"
+	Type    = "https://witness.dev/attestations/azure-devops/v0.1"
+	RunType = attestation.PreMaterialRunType
+
+	// DefaultAudience is the audience Azure DevOps issues service connection tokens for.
+	DefaultAudience = "api://AzureADTokenExchange"
+	// DefaultIssuerURL is where the issuer of each organization is, under the organization's id.
+	DefaultIssuerURL = "https://vstoken.dev.azure.com"
+
+	oidcAPIVersion = "7.1"
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor   = &Attestor{}
+	_ attestation.Subjecter  = &Attestor{}
+	_ attestation.BackReffer = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() },
+		attestation.StringConfigOption(
+			"serviceConnection",
+			"ID of the service connection to request the pipeline's OIDC token for. The token isn't requested if empty",
+			"",
+			func(a attestation.Attestor, serviceConnection string) (attestation.Attestor, error) {
+				adoAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not an azure-devops attestor", a)
+				}
+
+				WithServiceConnection(serviceConnection)(adoAttestor)
+				return adoAttestor, nil
+			},
+		),
+		attestation.StringConfigOption(
+			"audience",
+			"Audience the pipeline's OIDC token must be issued for",
+			DefaultAudience,
+			func(a attestation.Attestor, audience string) (attestation.Attestor, error) {
+				adoAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not an azure-devops attestor", a)
+				}
+
+				WithAudience(audience)(adoAttestor)
+				return adoAttestor, nil
+			},
+		),
+	)
+}
+
+type ErrNotAzureDevOps struct{}
+
+func (e ErrNotAzureDevOps) Error() string {
+	return "not in an azure pipelines job"
+}
+
+type Option func(*Attestor)
+
+// WithServiceConnection requests the pipeline's OIDC token for the service connection with id serviceConnection.
+func WithServiceConnection(serviceConnection string) Option {
+	return func(a *Attestor) {
+		a.serviceConnection = serviceConnection
+	}
+}
+
+// WithAudience requires the pipeline's OIDC token to be issued for audience.
+func WithAudience(audience string) Option {
+	return func(a *Attestor) {
+		a.audience = audience
+	}
+}
+
+// WithIssuerURL trusts tokens issued under issuerURL rather than DefaultIssuerURL.
+func WithIssuerURL(issuerURL string) Option {
+	return func(a *Attestor) {
+		a.issuerURL = strings.TrimSuffix(issuerURL, "/")
+	}
+}
+
+type Attestor struct {
+	JWT             *jwt.Attestor `json:"jwt,omitempty"`
+	OrganizationURL string        `json:"organizationurl"`
+	Organization    string        `json:"organization"`
+	OrganizationID  string        `json:"organizationid"`
+	Project         string        `json:"project"`
+	ProjectID       string        `json:"projectid"`
+	PipelineID      string        `json:"pipelineid"`
+	PipelineName    string        `json:"pipelinename"`
+	RunID           string        `json:"runid"`
+	RunNumber       string        `json:"runnumber"`
+	RunUrl          string        `json:"runurl"`
+	ProjectUrl      string        `json:"projecturl"`
+	JobID           string        `json:"jobid"`
+	Reason          string        `json:"reason"`
+	Repository      string        `json:"repository"`
+	SourceBranch    string        `json:"sourcebranch"`
+	SourceVersion   string        `json:"sourceversion"`
+	AgentName       string        `json:"agentname"`
+	AgentOS         string        `json:"agentos"`
+	AgentArch       string        `json:"agentarch"`
+
+	serviceConnection string
+	audience          string
+	issuerURL         string
+	subjects          map[string]cryptoutil.DigestSet
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		audience:  DefaultAudience,
+		issuerURL: DefaultIssuerURL,
+		subjects:  make(map[string]cryptoutil.DigestSet),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	if !strings.EqualFold(os.Getenv("TF_BUILD"), "true") {
+		return ErrNotAzureDevOps{}
+	}
+
+	a.OrganizationURL = os.Getenv("SYSTEM_COLLECTIONURI")
+	a.Organization = organization(a.OrganizationURL)
+	a.OrganizationID = os.Getenv("SYSTEM_COLLECTIONID")
+	a.Project = os.Getenv("SYSTEM_TEAMPROJECT")
+	a.ProjectID = os.Getenv("SYSTEM_TEAMPROJECTID")
+	a.PipelineID = os.Getenv("SYSTEM_DEFINITIONID")
+	a.PipelineName = os.Getenv("BUILD_DEFINITIONNAME")
+	a.RunID = os.Getenv("BUILD_BUILDID")
+	a.RunNumber = os.Getenv("BUILD_BUILDNUMBER")
+	a.JobID = os.Getenv("SYSTEM_JOBID")
+	a.Reason = os.Getenv("BUILD_REASON")
+	a.Repository = os.Getenv("BUILD_REPOSITORY_URI")
+	a.SourceBranch = os.Getenv("BUILD_SOURCEBRANCH")
+	a.SourceVersion = os.Getenv("BUILD_SOURCEVERSION")
+	a.AgentName = os.Getenv("AGENT_NAME")
+	a.AgentOS = os.Getenv("AGENT_OS")
+	a.AgentArch = os.Getenv("AGENT_OSARCHITECTURE")
+	a.ProjectUrl = fmt.Sprintf("%v%v", withSlash(a.OrganizationURL), url.PathEscape(a.Project))
+	a.RunUrl = fmt.Sprintf("%v/_build/results?buildId=%v", a.ProjectUrl, a.RunID)
+
+	if a.serviceConnection != "" {
+		token, err := a.fetchToken()
+		if err != nil {
+			return err
+		}
+
+		jwksURL, err := oidc.DiscoverJWKS(a.issuer())
+		if err != nil {
+			return err
+		}
+
+		a.JWT = jwt.New(jwt.WithToken(token), jwt.WithJWKSUrl(jwksURL))
+		if err := a.JWT.Attest(ctx); err != nil {
+			return fmt.Errorf("failed to verify azure pipelines oidc token: %w", err)
+		}
+
+		if err := a.checkClaims(); err != nil {
+			return err
+		}
+	} else {
+		log.Warnf("No service connection is configured with --%v-serviceConnection, the pipeline run can't be verified", Name)
+	}
+
+	for kind, value := range map[string]string{"pipelineurl": a.RunUrl, "projecturl": a.ProjectUrl} {
+		digestSet, err := cryptoutil.CalculateDigestSetFromBytes([]byte(value), ctx.Hashes())
+		if err != nil {
+			return err
+		}
+
+		a.subjects[fmt.Sprintf("%v:%v", kind, value)] = digestSet
+	}
+
+	return nil
+}
+
+// issuer returns the issuer of the tokens of the run's organization.
+func (a *Attestor) issuer() string {
+	return fmt.Sprintf("%v/%v", a.issuerURL, a.OrganizationID)
+}
+
+// fetchToken requests the pipeline's OIDC token for the service connection. The job must map System.AccessToken
+// into its environment for the request to be authorized.
+func (a *Attestor) fetchToken() (string, error) {
+	requestURI, accessToken := os.Getenv("SYSTEM_OIDCREQUESTURI"), os.Getenv("SYSTEM_ACCESSTOKEN")
+	if requestURI == "" || accessToken == "" {
+		return "", fmt.Errorf("azure pipelines oidc token can't be requested: SYSTEM_OIDCREQUESTURI and SYSTEM_ACCESSTOKEN must be set, map $(System.AccessToken) into the job's env")
+	}
+
+	u, err := url.Parse(requestURI)
+	if err != nil {
+		return "", fmt.Errorf("invalid SYSTEM_OIDCREQUESTURI: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("api-version", oidcAPIVersion)
+	q.Set("serviceConnectionId", a.serviceConnection)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader([]byte("{}")))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp := struct {
+		OIDCToken string `json:"oidcToken"`
+	}{}
+
+	if err := oidc.GetJSON(req, &resp); err != nil {
+		return "", fmt.Errorf("failed to request azure pipelines oidc token: %w", err)
+	}
+
+	if resp.OIDCToken == "" {
+		return "", fmt.Errorf("azure pipelines returned no oidc token for service connection %v", a.serviceConnection)
+	}
+
+	return resp.OIDCToken, nil
+}
+
+// checkClaims checks that the verified token was issued by the run's organization for the configured audience,
+// hasn't expired, and names the run's project.
+func (a *Attestor) checkClaims() error {
+	if err := oidc.CheckClaims(a.JWT, "azure pipelines oidc token", a.issuer(), a.audience); err != nil {
+		return err
+	}
+
+	// service connection tokens are issued for sc://<organization>/<project>/<service connection>
+	sub := fmt.Sprint(a.JWT.Claims["sub"])
+	parts := strings.SplitN(strings.TrimPrefix(sub, "sc://"), "/", 3)
+	if !strings.HasPrefix(sub, "sc://") || len(parts) != 3 {
+		return fmt.Errorf("azure pipelines oidc token has unexpected subject %v", sub)
+	}
+
+	if !strings.EqualFold(parts[0], a.Organization) || !strings.EqualFold(parts[1], a.Project) {
+		return fmt.Errorf("azure pipelines oidc token was issued for %v/%v, but the run is in %v/%v", parts[0], parts[1], a.Organization, a.Project)
+	}
+
+	return nil
+}
+
+// organization returns the name of the organization from its url, which is https://dev.azure.com/<organization>/
+// or, for older organizations, https://<organization>.visualstudio.com/.
+func organization(organizationURL string) string {
+	u, err := url.Parse(organizationURL)
+	if err != nil {
+		return ""
+	}
+
+	if host := strings.ToLower(u.Hostname()); strings.HasSuffix(host, ".visualstudio.com") {
+		return strings.TrimSuffix(host, ".visualstudio.com")
+	}
+
+	return strings.Split(strings.Trim(u.Path, "/"), "/")[0]
+}
+
+func withSlash(s string) string {
+	if strings.HasSuffix(s, "/") {
+		return s
+	}
+
+	return s + "/"
+}
+
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	return a.subjects
+}
+
+func (a *Attestor) BackRefs() map[string]cryptoutil.DigestSet {
+	backRefs := make(map[string]cryptoutil.DigestSet)
+	pipelineUrl := fmt.Sprintf("pipelineurl:%v", a.RunUrl)
+	backRefs[pipelineUrl] = a.subjects[pipelineUrl]
+	return backRefs
+}
@@ -0,0 +1,217 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azuredevops
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+)
+
+const (
+	orgID             = "0b5d6f39-5a3c-4d3b-8b1a-1f2e3d4c5b6a"
+	serviceConnection = "6d2d3e4f-0000-4000-8000-000000000001"
+	accessToken       = "system-access-token"
+)
+
+// fakeAzureDevOps issues OIDC tokens for service connections and serves the keys of the organization's issuer.
+type fakeAzureDevOps struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{}
+}
+
+func newFakeAzureDevOps(t *testing.T) *fakeAzureDevOps {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	f := &fakeAzureDevOps{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oidctoken", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer "+accessToken || r.URL.Query().Get("serviceConnectionId") != serviceConnection {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]string{"oidcToken": f.token(t, f.claims)}))
+	})
+
+	mux.HandleFunc("/"+orgID+"/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]string{"issuer": f.issuer(), "jwks_uri": f.issuer() + "/keys"}))
+	})
+
+	mux.HandleFunc("/"+orgID+"/keys", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "ado",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}}))
+	})
+
+	f.Server = httptest.NewServer(mux)
+	f.claims = f.validClaims()
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeAzureDevOps) issuer() string {
+	return f.URL + "/" + orgID
+}
+
+func (f *fakeAzureDevOps) token(t *testing.T, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "ado", "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (f *fakeAzureDevOps) validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss": f.issuer(),
+		"aud": DefaultAudience,
+		"sub": "sc://contoso/supplychain/release-connection",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// claimsWith returns the claims of a token for the run with claim replaced by value.
+func (f *fakeAzureDevOps) claimsWith(claim string, value interface{}) map[string]interface{} {
+	claims := f.validClaims()
+	claims[claim] = value
+	return claims
+}
+
+func setRunEnv(t *testing.T, ado *fakeAzureDevOps) {
+	for env, value := range map[string]string{
+		"TF_BUILD":              "True",
+		"SYSTEM_COLLECTIONURI":  "https://dev.azure.com/contoso/",
+		"SYSTEM_COLLECTIONID":   orgID,
+		"SYSTEM_TEAMPROJECT":    "supplychain",
+		"SYSTEM_TEAMPROJECTID":  "a1b2",
+		"SYSTEM_DEFINITIONID":   "12",
+		"BUILD_DEFINITIONNAME":  "release",
+		"BUILD_BUILDID":         "345",
+		"BUILD_BUILDNUMBER":     "20231015.1",
+		"SYSTEM_JOBID":          "job-1",
+		"BUILD_REASON":          "IndividualCI",
+		"BUILD_REPOSITORY_URI":  "https://dev.azure.com/contoso/supplychain/_git/app",
+		"BUILD_SOURCEBRANCH":    "refs/heads/main",
+		"BUILD_SOURCEVERSION":   "abc123",
+		"AGENT_NAME":            "Hosted Agent",
+		"AGENT_OS":              "Linux",
+		"AGENT_OSARCHITECTURE":  "X64",
+		"SYSTEM_OIDCREQUESTURI": ado.URL + "/oidctoken",
+		"SYSTEM_ACCESSTOKEN":    accessToken,
+	} {
+		t.Setenv(env, value)
+	}
+}
+
+func attest(t *testing.T, a *Attestor) error {
+	ctx, err := attestation.NewContext([]attestation.Attestor{a})
+	require.NoError(t, err)
+	return ctx.RunAttestors()
+}
+
+func TestAttest(t *testing.T) {
+	ado := newFakeAzureDevOps(t)
+	setRunEnv(t, ado)
+
+	a := New(WithServiceConnection(serviceConnection), WithIssuerURL(ado.URL))
+	require.NoError(t, attest(t, a))
+	require.Equal(t, "contoso", a.Organization)
+	require.Equal(t, orgID, a.OrganizationID)
+	require.Equal(t, "supplychain", a.Project)
+	require.Equal(t, "12", a.PipelineID)
+	require.Equal(t, "345", a.RunID)
+	require.Equal(t, "https://dev.azure.com/contoso/supplychain/_build/results?buildId=345", a.RunUrl)
+	require.Equal(t, ado.issuer()+"/keys", a.JWT.VerifiedBy.JWKSUrl)
+	require.Equal(t, "sc://contoso/supplychain/release-connection", a.JWT.Claims["sub"])
+	require.Contains(t, a.Subjects(), "projecturl:https://dev.azure.com/contoso/supplychain")
+	require.Contains(t, a.BackRefs(), "pipelineurl:https://dev.azure.com/contoso/supplychain/_build/results?buildId=345")
+
+	// without a service connection the run is recorded unverified
+	a = New()
+	require.NoError(t, attest(t, a))
+	require.Nil(t, a.JWT)
+	require.Equal(t, "release", a.PipelineName)
+}
+
+func TestAttestRejectsTokens(t *testing.T) {
+	ado := newFakeAzureDevOps(t)
+	setRunEnv(t, ado)
+
+	for name, test := range map[string]struct {
+		claims  map[string]interface{}
+		message string
+	}{
+		"another project": {
+			claims:  ado.claimsWith("sub", "sc://contoso/other/release-connection"),
+			message: "issued for contoso/other, but the run is in contoso/supplychain",
+		},
+		"expired": {
+			claims:  ado.claimsWith("exp", time.Now().Add(-time.Hour).Unix()),
+			message: "expired",
+		},
+		"another audience": {
+			claims:  ado.claimsWith("aud", "witness"),
+			message: "not issued for audience " + DefaultAudience,
+		},
+		"another issuer": {
+			claims:  ado.claimsWith("iss", "https://vstoken.dev.azure.com/other"),
+			message: "issued by https://vstoken.dev.azure.com/other",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ado.claims = test.claims
+			require.ErrorContains(t, attest(t, New(WithServiceConnection(serviceConnection), WithIssuerURL(ado.URL))), test.message)
+		})
+	}
+
+	t.Run("no access token", func(t *testing.T) {
+		t.Setenv("SYSTEM_ACCESSTOKEN", "")
+		require.ErrorContains(t, attest(t, New(WithServiceConnection(serviceConnection), WithIssuerURL(ado.URL))), "map $(System.AccessToken)")
+	})
+}
+
+func TestOrganization(t *testing.T) {
+	require.Equal(t, "contoso", organization("https://dev.azure.com/contoso/"))
+	require.Equal(t, "fabrikam", organization("https://fabrikam.visualstudio.com/"))
+}
+
+func TestRegistered(t *testing.T) {
+	attestors, err := attestation.Attestors([]string{Type})
+	require.NoError(t, err)
+	require.IsType(t, &Attestor{}, attestors[0])
+	require.Equal(t, DefaultAudience, attestors[0].(*Attestor).audience)
+}
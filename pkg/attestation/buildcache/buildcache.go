@@ -0,0 +1,286 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buildcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/attestation/recorded"
+	"github.com/testifysec/witness/pkg/schedule"
+)
+
+const (
+	Name    = "buildcache"
+	Type    = "https://witness.dev/attestations/buildcache/v0.1"
+	RunType = attestation.PostProductRunType
+
+	ToolBazel   = "bazel"
+	ToolGradle  = "gradle"
+	ToolSccache = "sccache"
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor = &Attestor{}
+
+	urlPattern = regexp.MustCompile(`[A-Za-z][A-Za-z0-9+.-]*://[^\s,]+`)
+)
+
+func init() {
+	schedule.RegisterDependencies(Name, commandrun.Name)
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() },
+		attestation.StringConfigOption(
+			"bazelExecutionLog",
+			"Path to the execution log Bazel wrote with --execution_log_json_file, relative to the working directory, to record the actions served from its remote cache.",
+			"",
+			func(a attestation.Attestor, path string) (attestation.Attestor, error) {
+				cacheAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a buildcache attestor", a)
+				}
+
+				WithBazelExecutionLog(path)(cacheAttestor)
+				return cacheAttestor, nil
+			},
+		),
+		attestation.StringConfigOption(
+			"sccacheStats",
+			"Path to the output of sccache --show-stats --stats-format=json, relative to the working directory, to record sccache hits and its cache location.",
+			"",
+			func(a attestation.Attestor, path string) (attestation.Attestor, error) {
+				cacheAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a buildcache attestor", a)
+				}
+
+				WithSccacheStats(path)(cacheAttestor)
+				return cacheAttestor, nil
+			},
+		),
+	)
+}
+
+// Cache is how a build tool used a remote build cache during the step.
+type Cache struct {
+	// Servers are the remote caches the tool was configured with, without credentials.
+	Servers []string `json:"servers,omitempty"`
+	Hits    int      `json:"hits"`
+	// Misses is only recorded when the tool reports it.
+	Misses  int            `json:"misses,omitempty"`
+	Outputs []CachedOutput `json:"outputs,omitempty"`
+
+	// local is set when the hits came from a cache on the host, such as a disk cache, rather than a server.
+	local bool
+}
+
+// CachedOutput is an output, or the outputs of a task, that was downloaded from the cache rather than built.
+type CachedOutput struct {
+	Path     string               `json:"path,omitempty"`
+	Task     string               `json:"task,omitempty"`
+	CacheKey string               `json:"cachekey,omitempty"`
+	Digest   cryptoutil.DigestSet `json:"digest,omitempty"`
+}
+
+type Option func(*Attestor)
+
+// WithBazelExecutionLog reads the actions served from Bazel's remote cache from the JSON execution log at path.
+func WithBazelExecutionLog(path string) Option {
+	return func(a *Attestor) {
+		a.bazelExecutionLog = path
+	}
+}
+
+// WithSccacheStats reads sccache's hits and cache location from the JSON statistics at path.
+func WithSccacheStats(path string) Option {
+	return func(a *Attestor) {
+		a.sccacheStats = path
+	}
+}
+
+// Attestor records which outputs of the step came from a remote build cache and which cache servers served them,
+// so policies can require that caches are on an approved list. Gradle is detected from the output of the command,
+// while Bazel and sccache are read from the reports they write.
+type Attestor struct {
+	caches            map[string]Cache
+	bazelExecutionLog string
+	sccacheStats      string
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		caches: make(map[string]Cache),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	run := recorded.CommandRun(ctx)
+	getenv := commandEnv(run)
+	home, _ := os.UserHomeDir()
+
+	if a.bazelExecutionLog != "" {
+		cache, err := bazelCache(ctx.WorkingDir(), a.resolve(ctx, a.bazelExecutionLog), run, home)
+		if err != nil {
+			return fmt.Errorf("failed to read bazel execution log: %w", err)
+		}
+
+		a.caches[ToolBazel] = cache
+	}
+
+	if a.sccacheStats != "" {
+		cache, err := sccacheCache(a.resolve(ctx, a.sccacheStats), getenv)
+		if err != nil {
+			return fmt.Errorf("failed to read sccache stats: %w", err)
+		}
+
+		a.caches[ToolSccache] = cache
+	}
+
+	if run != nil && isGradle(run.Cmd) {
+		if cache, ok := gradleCache(ctx.WorkingDir(), run, getenv, home); ok {
+			a.caches[ToolGradle] = cache
+		}
+	}
+
+	// a policy can't check where cached outputs came from without a server, and an empty list of servers would pass
+	// any list of approved ones
+	for tool, cache := range a.caches {
+		if cache.Hits > 0 && len(cache.Servers) == 0 && !cache.local {
+			return fmt.Errorf("%v took %v outputs from a remote cache, but the cache's server could not be found", tool, cache.Hits)
+		}
+	}
+
+	if len(a.caches) == 0 {
+		log.Debugf("(attestation/buildcache) no build cache usage found")
+	}
+
+	return nil
+}
+
+// commandEnv returns a lookup of the environment the command's build tools ran with. Traced commands record the
+// environment of each process, and the latest sccache process's is used, or the command's own. Commands that weren't
+// traced were started with witness's environment.
+func commandEnv(run *commandrun.CommandRun) func(string) string {
+	if run == nil || len(run.Processes) == 0 {
+		return os.Getenv
+	}
+
+	environ := run.Processes[0].Environ
+	for _, process := range run.Processes {
+		if filepath.Base(process.Program) == "sccache" && process.Environ != "" {
+			environ = process.Environ
+		}
+	}
+
+	// the recorded environment joins variables with spaces
+	vars := make(map[string]string)
+	for _, variable := range strings.Fields(environ) {
+		if name, value, ok := strings.Cut(variable, "="); ok {
+			vars[name] = value
+		}
+	}
+
+	return func(name string) string {
+		return vars[name]
+	}
+}
+
+func (a *Attestor) resolve(ctx *attestation.AttestationContext, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(ctx.WorkingDir(), path)
+}
+
+func (a *Attestor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.caches)
+}
+
+func (a *Attestor) UnmarshalJSON(data []byte) error {
+	caches := make(map[string]Cache)
+	if err := json.Unmarshal(data, &caches); err != nil {
+		return err
+	}
+
+	a.caches = caches
+	return nil
+}
+
+func (a *Attestor) Caches() map[string]Cache {
+	return a.caches
+}
+
+// redactServer removes credentials from the URLs in a cache server's description, which are commonly embedded in
+// the user info or query. Values that aren't URLs, such as bucket names, are kept as is.
+func redactServer(server string) string {
+	return urlPattern.ReplaceAllStringFunc(strings.TrimSpace(server), func(match string) string {
+		u, err := url.Parse(match)
+		if err != nil {
+			return match
+		}
+
+		u.User = nil
+		u.RawQuery = ""
+		u.Fragment = ""
+		return u.String()
+	})
+}
+
+func addServer(servers []string, server string) []string {
+	if server == "" {
+		return servers
+	}
+
+	server = redactServer(server)
+	for _, existing := range servers {
+		if existing == server {
+			return servers
+		}
+	}
+
+	servers = append(servers, server)
+	sort.Strings(servers)
+	return servers
+}
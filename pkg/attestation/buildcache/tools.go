@@ -0,0 +1,342 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buildcache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+var (
+	bazelRemoteFlags = []string{"--remote_cache", "--remote_executor"}
+	// bazelSystemRC is the rc file Bazel reads for every workspace on the host.
+	bazelSystemRC = "/etc/bazel.bazelrc"
+
+	gradleFromCache   = regexp.MustCompile(`(?m)^> Task (\S+) FROM-CACHE\s*$`)
+	gradleCacheKey    = regexp.MustCompile(`(?m)Build cache key for task '(\S+)' is ([0-9a-f]+)`)
+	gradleRemoteCache = regexp.MustCompile(`(?s)remote\s*[(<].*?(?:url|setUrl)\s*[=(]\s*(?:uri\s*\(\s*)?["']([^"']+)["']`)
+
+	// sccacheServerVariables configure sccache's remote storage. Variables that hold credentials, such as
+	// SCCACHE_AZURE_CONNECTION_STRING, aren't recorded.
+	sccacheServerVariables = []string{"SCCACHE_ENDPOINT", "SCCACHE_BUCKET", "SCCACHE_GCS_BUCKET", "SCCACHE_REDIS", "SCCACHE_REDIS_ENDPOINT", "SCCACHE_MEMCACHED", "SCCACHE_MEMCACHED_ENDPOINT", "SCCACHE_WEBDAV_ENDPOINT", "SCCACHE_AZURE_BLOB_CONTAINER"}
+)
+
+// bazelDigest is a digest in Bazel's execution log.
+type bazelDigest struct {
+	Hash             string `json:"hash"`
+	HashFunctionName string `json:"hashFunctionName"`
+}
+
+// bazelSpawn is the part of a SpawnExec in Bazel's JSON execution log that describes cache use.
+type bazelSpawn struct {
+	TargetLabel     string       `json:"targetLabel"`
+	Mnemonic        string       `json:"mnemonic"`
+	RemoteCacheable bool         `json:"remoteCacheable"`
+	RemoteCacheHit  bool         `json:"remoteCacheHit"`
+	Digest          *bazelDigest `json:"digest"`
+	ActualOutputs   []struct {
+		Path   string       `json:"path"`
+		Digest *bazelDigest `json:"digest"`
+	} `json:"actualOutputs"`
+}
+
+func (d *bazelDigest) digestSet() cryptoutil.DigestSet {
+	if d == nil || d.Hash == "" {
+		return nil
+	}
+
+	hash, err := cryptoutil.HashFromString(strings.ReplaceAll(strings.ToLower(d.HashFunctionName), "-", ""))
+	if err != nil {
+		return nil
+	}
+
+	return cryptoutil.DigestSet{cryptoutil.DigestValue{Hash: hash}: d.Hash}
+}
+
+// bazelCache reads the execution log, a stream of JSON SpawnExec messages, and the remote caches Bazel was
+// configured with on the command line or in its rc files. Bazel reports hits from a --disk_cache as remote cache hits,
+// so a cache configured with only a disk cache is local.
+func bazelCache(workingDir, logPath string, run *commandrun.CommandRun, home string) (Cache, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return Cache{}, err
+	}
+
+	defer f.Close()
+	cache := Cache{}
+	decoder := json.NewDecoder(bufio.NewReader(f))
+	for {
+		spawn := bazelSpawn{}
+		if err := decoder.Decode(&spawn); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return Cache{}, err
+		}
+
+		if !spawn.RemoteCacheHit {
+			if spawn.RemoteCacheable {
+				cache.Misses++
+			}
+
+			continue
+		}
+
+		cache.Hits++
+		cacheKey := ""
+		if spawn.Digest != nil {
+			cacheKey = spawn.Digest.Hash
+		}
+
+		for _, output := range spawn.ActualOutputs {
+			cache.Outputs = append(cache.Outputs, CachedOutput{Path: output.Path, Task: spawn.TargetLabel, CacheKey: cacheKey, Digest: output.Digest.digestSet()})
+		}
+	}
+
+	args := []string{}
+	if run != nil {
+		args = run.Cmd
+	}
+
+	// the options of every rc file are read, even ones the command might skip with --nohome_rc or similar, so
+	// a cache configured anywhere Bazel could read it is recorded
+	rcFiles := []string{bazelSystemRC, filepath.Join(workingDir, ".bazelrc")}
+	if home != "" {
+		rcFiles = append(rcFiles, filepath.Join(home, ".bazelrc"))
+	}
+
+	rcFiles = append(rcFiles, flagValues(args, "--bazelrc")...)
+	options := append([]string{}, args...)
+	visited := make(map[string]bool)
+	for _, rcFile := range rcFiles {
+		options = append(options, bazelRCOptions(workingDir, rcFile, visited)...)
+	}
+
+	for _, server := range flagValues(options, bazelRemoteFlags...) {
+		cache.Servers = addServer(cache.Servers, server)
+	}
+
+	cache.local = len(cache.Servers) == 0 && len(flagValues(options, "--disk_cache")) > 0
+	sortOutputs(cache.Outputs)
+	return cache, nil
+}
+
+// bazelRCOptions returns the options in the rc file at path and in the rc files it imports. Paths are relative to the
+// workspace, and files that don't exist are skipped.
+func bazelRCOptions(workingDir, path string, visited map[string]bool) []string {
+	path = filepath.Clean(strings.ReplaceAll(path, "%workspace%", workingDir))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workingDir, path)
+	}
+
+	if visited[path] {
+		return nil
+	}
+
+	visited[path] = true
+	rc, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	options := []string{}
+	for _, line := range strings.Split(string(rc), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if (fields[0] == "import" || fields[0] == "try-import") && len(fields) > 1 {
+			options = append(options, bazelRCOptions(workingDir, fields[1], visited)...)
+			continue
+		}
+
+		for _, field := range fields[1:] {
+			options = append(options, strings.Trim(field, `"'`))
+		}
+	}
+
+	return options
+}
+
+// flagValues returns the values of flags in args, given either as --flag=value or as --flag value.
+func flagValues(args []string, flags ...string) []string {
+	values := []string{}
+	for i, arg := range args {
+		for _, flag := range flags {
+			if strings.HasPrefix(arg, flag+"=") {
+				values = append(values, strings.TrimPrefix(arg, flag+"="))
+			} else if arg == flag && i+1 < len(args) {
+				values = append(values, args[i+1])
+			}
+		}
+	}
+
+	return values
+}
+
+func isGradle(cmd []string) bool {
+	for _, arg := range cmd {
+		switch filepath.Base(arg) {
+		case "gradle", "gradlew", "gradlew.bat", "gradle.bat":
+			return true
+		}
+	}
+
+	return false
+}
+
+// gradleCache reads the tasks Gradle took from its build cache from the plain console output of the command, which
+// marks them FROM-CACHE. Their cache keys are recorded when Gradle is run with -Dorg.gradle.caching.debug=true. The
+// remote cache is read from the build cache configuration of the workspace's settings script and of the init scripts
+// Gradle runs, which are those given with --init-script and those in the Gradle user home.
+func gradleCache(workingDir string, run *commandrun.CommandRun, getenv func(string) string, home string) (Cache, bool) {
+	output := run.Stdout + "\n" + run.Stderr
+	keys := make(map[string]string)
+	for _, match := range gradleCacheKey.FindAllStringSubmatch(output, -1) {
+		keys[match[1]] = match[2]
+	}
+
+	cache := Cache{}
+	for _, match := range gradleFromCache.FindAllStringSubmatch(output, -1) {
+		cache.Hits++
+		cache.Outputs = append(cache.Outputs, CachedOutput{Task: match[1], CacheKey: keys[match[1]]})
+	}
+
+	scripts := []string{filepath.Join(workingDir, "settings.gradle"), filepath.Join(workingDir, "settings.gradle.kts")}
+	for _, script := range append(flagValues(run.Cmd, "--init-script", "-I"), gradleUserInitScripts(run.Cmd, getenv, home)...) {
+		if !filepath.IsAbs(script) {
+			script = filepath.Join(workingDir, script)
+		}
+
+		scripts = append(scripts, script)
+	}
+
+	for _, script := range scripts {
+		content, err := os.ReadFile(script)
+		if err != nil {
+			continue
+		}
+
+		_, buildCache, ok := strings.Cut(string(content), "buildCache")
+		if !ok {
+			continue
+		}
+
+		for _, match := range gradleRemoteCache.FindAllStringSubmatch(buildCache, -1) {
+			cache.Servers = addServer(cache.Servers, match[1])
+		}
+	}
+
+	if cache.Hits == 0 && len(cache.Servers) == 0 {
+		return Cache{}, false
+	}
+
+	sortOutputs(cache.Outputs)
+	return cache, true
+}
+
+// gradleUserInitScripts returns the init scripts in the Gradle user home, which is given with --gradle-user-home or
+// GRADLE_USER_HOME and is ~/.gradle otherwise.
+func gradleUserInitScripts(args []string, getenv func(string) string, home string) []string {
+	userHome := getenv("GRADLE_USER_HOME")
+	if homes := flagValues(args, "--gradle-user-home", "-g"); len(homes) > 0 {
+		userHome = homes[len(homes)-1]
+	}
+
+	if userHome == "" {
+		if home == "" {
+			return nil
+		}
+
+		userHome = filepath.Join(home, ".gradle")
+	}
+
+	scripts := []string{filepath.Join(userHome, "init.gradle"), filepath.Join(userHome, "init.gradle.kts")}
+	for _, pattern := range []string{"*.gradle", "*.gradle.kts"} {
+		matches, _ := filepath.Glob(filepath.Join(userHome, "init.d", pattern))
+		scripts = append(scripts, matches...)
+	}
+
+	return scripts
+}
+
+type sccacheCounts struct {
+	Counts map[string]int `json:"counts"`
+}
+
+type sccacheInfo struct {
+	Stats struct {
+		CacheHits   sccacheCounts `json:"cache_hits"`
+		CacheMisses sccacheCounts `json:"cache_misses"`
+	} `json:"stats"`
+	CacheLocation string `json:"cache_location"`
+}
+
+// sccacheCache reads sccache's statistics, which count hits by language but don't identify the outputs. The
+// statistics are kept for the lifetime of the sccache server, so it should be started fresh for the step, such as
+// with sccache --zero-stats, for them to describe only the step. Remote storage is read from the cache location
+// and from sccache's environment variables, looked up with getenv.
+func sccacheCache(statsPath string, getenv func(string) string) (Cache, error) {
+	data, err := os.ReadFile(statsPath)
+	if err != nil {
+		return Cache{}, err
+	}
+
+	info := sccacheInfo{}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return Cache{}, err
+	}
+
+	cache := Cache{}
+	for _, count := range info.Stats.CacheHits.Counts {
+		cache.Hits += count
+	}
+
+	for _, count := range info.Stats.CacheMisses.Counts {
+		cache.Misses += count
+	}
+
+	if strings.HasPrefix(info.CacheLocation, "Local disk") {
+		cache.local = true
+	} else if info.CacheLocation != "" {
+		cache.Servers = addServer(cache.Servers, info.CacheLocation)
+	}
+
+	for _, variable := range sccacheServerVariables {
+		cache.Servers = addServer(cache.Servers, getenv(variable))
+	}
+
+	return cache, nil
+}
+
+func sortOutputs(outputs []CachedOutput) {
+	sort.Slice(outputs, func(i, j int) bool {
+		if outputs[i].Task != outputs[j].Task {
+			return outputs[i].Task < outputs[j].Task
+		}
+
+		return outputs[i].Path < outputs[j].Path
+	})
+}
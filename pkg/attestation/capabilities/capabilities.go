@@ -0,0 +1,192 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package capabilities reports which attestors and tracing features are available on the OS, architecture, and
+// privilege level witness runs with, so fleets of mixed platforms know what evidence each host can record.
+package capabilities
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/witness/pkg/attestation/ancestry"
+	"github.com/testifysec/witness/pkg/attestation/tracestatus"
+)
+
+const (
+	Name    = "capabilities"
+	Type    = "https://witness.dev/attestations/capabilities/v0.1"
+	RunType = attestation.PreMaterialRunType
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Feature is evidence witness records only on some platforms or with some privileges.
+type Feature struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Attestors are the attestors that record the evidence.
+	Attestors []string `json:"attestors"`
+	Available bool     `json:"available"`
+	// Missing is what keeps the feature from being available.
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Snapshot is what witness can record on the host it runs on.
+type Snapshot struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+	// Privileged is whether witness runs as root. It is always false on Windows.
+	Privileged bool      `json:"privileged"`
+	Features   []Feature `json:"features"`
+	// Attestors are the names of the attestors built into witness.
+	Attestors []string `json:"attestors"`
+}
+
+// Detect takes a snapshot of the host's capabilities. tracing is whether the host can trace commands, which callers
+// that already probed for tracing pass to avoid probing again.
+func Detect(tracing tracestatus.Capability) Snapshot {
+	s := Snapshot{
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Privileged: os.Geteuid() == 0,
+	}
+
+	s.Features = []Feature{
+		{
+			Name:        "process-tracing",
+			Description: "Programs, arguments, and digests of every process the command starts, with --trace",
+			Attestors:   []string{commandrun.Name},
+			Available:   tracing.Available,
+			Missing:     tracing.Missing,
+		},
+		{
+			Name:        "file-tracing",
+			Description: "Digests of the files traced processes open, with --trace",
+			Attestors:   []string{commandrun.Name},
+			Available:   tracing.Available,
+			Missing:     tracing.Missing,
+		},
+		procfsFeature("process-ancestry", "Every process from witness up to init, rather than only witness's parent", "/proc/self/status"),
+		procfsFeature("container-id", "The container witness runs in", "/proc/self/cgroup"),
+	}
+
+	for _, entry := range attestation.RegistrationEntries() {
+		s.Attestors = append(s.Attestors, entry.Name)
+	}
+
+	sort.Strings(s.Attestors)
+	return s
+}
+
+// procfsFeature is evidence the ancestry attestor reads from path in procfs.
+func procfsFeature(name, description, path string) Feature {
+	f := Feature{Name: name, Description: description, Attestors: []string{ancestry.Name}}
+	if runtime.GOOS != "linux" {
+		f.Missing = []string{fmt.Sprintf("it is read from procfs, which %v doesn't have", runtime.GOOS)}
+		return f
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		f.Missing = []string{fmt.Sprintf("%v can't be read: %v", path, err)}
+		return f
+	}
+
+	f.Available = true
+	return f
+}
+
+// Format describes s for people.
+func Format(s Snapshot) string {
+	sb := &strings.Builder{}
+	privilege := "unprivileged"
+	if s.Privileged {
+		privilege = "privileged"
+	}
+
+	fmt.Fprintf(sb, "witness on %v/%v, %v\n\n", s.OS, s.Arch, privilege)
+	for _, f := range s.Features {
+		status := "available"
+		if !f.Available {
+			status = "unavailable"
+		}
+
+		fmt.Fprintf(sb, "[%-11v] %v (%v): %v\n", status, f.Name, strings.Join(f.Attestors, ", "), f.Description)
+		for _, missing := range f.Missing {
+			fmt.Fprintf(sb, "              %v\n", missing)
+		}
+	}
+
+	fmt.Fprintf(sb, "\nattestors: %v\n", strings.Join(s.Attestors, ", "))
+	return sb.String()
+}
+
+type Option func(*Attestor)
+
+// WithSnapshot records snapshot rather than detecting the host's capabilities.
+func WithSnapshot(snapshot Snapshot) Option {
+	return func(a *Attestor) {
+		a.detect = func() Snapshot { return snapshot }
+	}
+}
+
+// Attestor records the capabilities of the host a step ran on, so policies and reviewers know whether evidence is
+// missing because the host couldn't record it.
+type Attestor struct {
+	Snapshot
+
+	detect func() Snapshot
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		detect: func() Snapshot { return Detect(tracestatus.Detect()) },
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	a.Snapshot = a.detect()
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capabilities
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/witness/pkg/attestation/tracestatus"
+)
+
+func feature(t *testing.T, s Snapshot, name string) Feature {
+	for _, f := range s.Features {
+		if f.Name == name {
+			return f
+		}
+	}
+
+	require.Failf(t, "missing feature", "snapshot has no %v feature", name)
+	return Feature{}
+}
+
+func TestDetect(t *testing.T) {
+	s := Detect(tracestatus.Capability{Missing: []string{"the process does not have CAP_SYS_PTRACE"}})
+	require.Equal(t, runtime.GOOS, s.OS)
+	require.Equal(t, runtime.GOARCH, s.Arch)
+	require.Contains(t, s.Attestors, Name)
+
+	tracing := feature(t, s, "process-tracing")
+	require.False(t, tracing.Available)
+	require.Equal(t, []string{"the process does not have CAP_SYS_PTRACE"}, tracing.Missing)
+	require.Equal(t, runtime.GOOS == "linux", feature(t, s, "process-ancestry").Available)
+
+	s = Detect(tracestatus.Capability{Available: true})
+	require.True(t, feature(t, s, "file-tracing").Available)
+	require.Empty(t, feature(t, s, "file-tracing").Missing)
+}
+
+func TestFormat(t *testing.T) {
+	formatted := Format(Snapshot{
+		OS:   "darwin",
+		Arch: "arm64",
+		Features: []Feature{
+			{Name: "process-tracing", Description: "Processes", Attestors: []string{"command-run"}, Missing: []string{"tracing is only supported on linux, not darwin"}},
+			{Name: "container-id", Description: "Container", Attestors: []string{"ancestry"}, Available: true},
+		},
+		Attestors: []string{"capabilities", "git"},
+	})
+
+	require.Equal(t, "witness on darwin/arm64, unprivileged\n\n"+
+		"[unavailable] process-tracing (command-run): Processes\n"+
+		"              tracing is only supported on linux, not darwin\n"+
+		"[available  ] container-id (ancestry): Container\n"+
+		"\nattestors: capabilities, git\n", formatted)
+}
+
+func TestAttest(t *testing.T) {
+	ctx, err := attestation.NewContext([]attestation.Attestor{})
+	require.NoError(t, err)
+	snapshot := Snapshot{OS: "windows", Arch: "amd64"}
+	a := New(WithSnapshot(snapshot))
+	require.NoError(t, a.Attest(ctx))
+	require.Equal(t, snapshot, a.Snapshot)
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cicontext
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+const (
+	Name    = "cicontext"
+	Type    = "https://witness.dev/attestations/cicontext/v0.1"
+	RunType = attestation.PreMaterialRunType
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor  = &Attestor{}
+	_ attestation.Subjecter = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Attestor records a normalized view of the CI system that ran the step. Unlike the provider specific
+// attestors it records the same small set of fields for every supported provider.
+type Attestor struct {
+	Provider    string `json:"provider"`
+	PipelineURL string `json:"pipelineurl,omitempty"`
+	RunID       string `json:"runid,omitempty"`
+	Trigger     string `json:"trigger,omitempty"`
+	Actor       string `json:"actor,omitempty"`
+	Repository  string `json:"repository,omitempty"`
+	Revision    string `json:"revision,omitempty"`
+	Ref         string `json:"ref,omitempty"`
+
+	getenv func(string) string
+	hashes []crypto.Hash
+}
+
+func New() *Attestor {
+	return &Attestor{
+		getenv: os.Getenv,
+	}
+}
+
+// Detected returns true if the current environment is a CI system recognized by the attestor.
+func Detected() bool {
+	_, ok := detect(os.Getenv)
+	return ok
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	a.hashes = ctx.Hashes()
+	p, ok := detect(a.getenv)
+	if !ok {
+		return fmt.Errorf("no supported CI environment detected")
+	}
+
+	p.populate(a, a.getenv)
+	a.Provider = p.name
+	return nil
+}
+
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjects := make(map[string]cryptoutil.DigestSet)
+	if a.PipelineURL == "" {
+		return subjects
+	}
+
+	ds, err := cryptoutil.CalculateDigestSetFromBytes([]byte(a.PipelineURL), a.hashes)
+	if err != nil {
+		return subjects
+	}
+
+	subjects[fmt.Sprintf("pipelineurl:%v", a.PipelineURL)] = ds
+	return subjects
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cicontext
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+)
+
+func attest(t *testing.T, env map[string]string) (*Attestor, error) {
+	a := New()
+	a.getenv = func(key string) string { return env[key] }
+	ctx, err := attestation.NewContext([]attestation.Attestor{a})
+	require.NoError(t, err)
+	return a, ctx.RunAttestors()
+}
+
+func TestGitHubActions(t *testing.T) {
+	a, err := attest(t, map[string]string{
+		"CI":                "true",
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_SERVER_URL": "https://github.com",
+		"GITHUB_REPOSITORY": "testifysec/witness",
+		"GITHUB_RUN_ID":     "42",
+		"GITHUB_EVENT_NAME": "push",
+		"GITHUB_ACTOR":      "octocat",
+		"GITHUB_SHA":        "abc123",
+		"GITHUB_REF":        "refs/heads/main",
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, "github-actions", a.Provider)
+	require.Equal(t, "https://github.com/testifysec/witness/actions/runs/42", a.PipelineURL)
+	require.Equal(t, "push", a.Trigger)
+	require.Equal(t, "octocat", a.Actor)
+	require.Equal(t, "refs/heads/main", a.Ref)
+	require.Contains(t, a.Subjects(), "pipelineurl:https://github.com/testifysec/witness/actions/runs/42")
+}
+
+func TestAzurePipelines(t *testing.T) {
+	a, err := attest(t, map[string]string{
+		"TF_BUILD":             "True",
+		"SYSTEM_COLLECTIONURI": "https://dev.azure.com/witness/",
+		"SYSTEM_TEAMPROJECT":   "supplychain",
+		"BUILD_BUILDID":        "7",
+		"BUILD_REASON":         "Manual",
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, "azure-pipelines", a.Provider)
+	require.Equal(t, "https://dev.azure.com/witness/supplychain/_build/results?buildId=7", a.PipelineURL)
+	require.Equal(t, "Manual", a.Trigger)
+}
+
+func TestGeneric(t *testing.T) {
+	a, err := attest(t, map[string]string{"CI": "true"})
+	require.NoError(t, err)
+	require.Equal(t, "generic", a.Provider)
+	require.Empty(t, a.Subjects())
+}
+
+func TestNotDetected(t *testing.T) {
+	_, err := attest(t, map[string]string{})
+	require.ErrorContains(t, err, "no supported CI environment")
+}
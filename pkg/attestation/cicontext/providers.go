@@ -0,0 +1,179 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cicontext
+
+import (
+	"fmt"
+	"strings"
+)
+
+type provider struct {
+	name     string
+	detect   func(getenv func(string) string) bool
+	populate func(a *Attestor, getenv func(string) string)
+}
+
+// providers are checked in order, so the generic provider must stay last
+var providers = []provider{
+	{
+		name:   "github-actions",
+		detect: envEquals("GITHUB_ACTIONS", "true"),
+		populate: func(a *Attestor, getenv func(string) string) {
+			a.RunID = getenv("GITHUB_RUN_ID")
+			a.Repository = getenv("GITHUB_REPOSITORY")
+			if server := getenv("GITHUB_SERVER_URL"); server != "" && a.Repository != "" && a.RunID != "" {
+				a.PipelineURL = fmt.Sprintf("%v/%v/actions/runs/%v", server, a.Repository, a.RunID)
+			}
+
+			a.Trigger = getenv("GITHUB_EVENT_NAME")
+			a.Actor = getenv("GITHUB_ACTOR")
+			a.Revision = getenv("GITHUB_SHA")
+			a.Ref = getenv("GITHUB_REF")
+		},
+	},
+	{
+		name:   "gitlab-ci",
+		detect: envEquals("GITLAB_CI", "true"),
+		populate: func(a *Attestor, getenv func(string) string) {
+			a.PipelineURL = getenv("CI_PIPELINE_URL")
+			a.RunID = getenv("CI_PIPELINE_ID")
+			a.Trigger = getenv("CI_PIPELINE_SOURCE")
+			a.Actor = getenv("GITLAB_USER_LOGIN")
+			a.Repository = getenv("CI_PROJECT_PATH")
+			a.Revision = getenv("CI_COMMIT_SHA")
+			a.Ref = getenv("CI_COMMIT_REF_NAME")
+		},
+	},
+	{
+		name:   "azure-pipelines",
+		detect: envEquals("TF_BUILD", "true"),
+		populate: func(a *Attestor, getenv func(string) string) {
+			a.RunID = getenv("BUILD_BUILDID")
+			if collection, project := getenv("SYSTEM_COLLECTIONURI"), getenv("SYSTEM_TEAMPROJECT"); collection != "" && project != "" && a.RunID != "" {
+				a.PipelineURL = fmt.Sprintf("%v%v/_build/results?buildId=%v", collection, project, a.RunID)
+			}
+
+			a.Trigger = getenv("BUILD_REASON")
+			a.Actor = getenv("BUILD_REQUESTEDFOR")
+			a.Repository = getenv("BUILD_REPOSITORY_NAME")
+			a.Revision = getenv("BUILD_SOURCEVERSION")
+			a.Ref = getenv("BUILD_SOURCEBRANCH")
+		},
+	},
+	{
+		name:   "circleci",
+		detect: envEquals("CIRCLECI", "true"),
+		populate: func(a *Attestor, getenv func(string) string) {
+			a.PipelineURL = getenv("CIRCLE_BUILD_URL")
+			a.RunID = getenv("CIRCLE_WORKFLOW_ID")
+			a.Actor = getenv("CIRCLE_USERNAME")
+			if user, repo := getenv("CIRCLE_PROJECT_USERNAME"), getenv("CIRCLE_PROJECT_REPONAME"); user != "" && repo != "" {
+				a.Repository = fmt.Sprintf("%v/%v", user, repo)
+			}
+
+			a.Revision = getenv("CIRCLE_SHA1")
+			a.Ref = firstEnv(getenv, "CIRCLE_TAG", "CIRCLE_BRANCH")
+		},
+	},
+	{
+		name:   "buildkite",
+		detect: envEquals("BUILDKITE", "true"),
+		populate: func(a *Attestor, getenv func(string) string) {
+			a.PipelineURL = getenv("BUILDKITE_BUILD_URL")
+			a.RunID = getenv("BUILDKITE_BUILD_ID")
+			a.Trigger = getenv("BUILDKITE_SOURCE")
+			a.Actor = getenv("BUILDKITE_BUILD_CREATOR")
+			a.Repository = getenv("BUILDKITE_REPO")
+			a.Revision = getenv("BUILDKITE_COMMIT")
+			a.Ref = firstEnv(getenv, "BUILDKITE_TAG", "BUILDKITE_BRANCH")
+		},
+	},
+	{
+		name:   "travis-ci",
+		detect: envEquals("TRAVIS", "true"),
+		populate: func(a *Attestor, getenv func(string) string) {
+			a.PipelineURL = getenv("TRAVIS_BUILD_WEB_URL")
+			a.RunID = getenv("TRAVIS_BUILD_ID")
+			a.Trigger = getenv("TRAVIS_EVENT_TYPE")
+			a.Repository = getenv("TRAVIS_REPO_SLUG")
+			a.Revision = getenv("TRAVIS_COMMIT")
+			a.Ref = firstEnv(getenv, "TRAVIS_TAG", "TRAVIS_BRANCH")
+		},
+	},
+	{
+		name:   "bitbucket-pipelines",
+		detect: envSet("BITBUCKET_BUILD_NUMBER"),
+		populate: func(a *Attestor, getenv func(string) string) {
+			a.Repository = getenv("BITBUCKET_REPO_FULL_NAME")
+			if buildNumber := getenv("BITBUCKET_BUILD_NUMBER"); a.Repository != "" {
+				a.PipelineURL = fmt.Sprintf("https://bitbucket.org/%v/pipelines/results/%v", a.Repository, buildNumber)
+			}
+
+			a.RunID = getenv("BITBUCKET_PIPELINE_UUID")
+			a.Actor = getenv("BITBUCKET_STEP_TRIGGERER_UUID")
+			a.Revision = getenv("BITBUCKET_COMMIT")
+			a.Ref = firstEnv(getenv, "BITBUCKET_TAG", "BITBUCKET_BRANCH")
+		},
+	},
+	{
+		name:   "jenkins",
+		detect: envSet("JENKINS_URL"),
+		populate: func(a *Attestor, getenv func(string) string) {
+			a.PipelineURL = getenv("BUILD_URL")
+			a.RunID = getenv("BUILD_TAG")
+			a.Actor = getenv("BUILD_USER_ID")
+			a.Repository = getenv("GIT_URL")
+			a.Revision = getenv("GIT_COMMIT")
+			a.Ref = getenv("GIT_BRANCH")
+		},
+	},
+	{
+		name:     "generic",
+		detect:   envEquals("CI", "true"),
+		populate: func(a *Attestor, getenv func(string) string) {},
+	},
+}
+
+func detect(getenv func(string) string) (provider, bool) {
+	for _, p := range providers {
+		if p.detect(getenv) {
+			return p, true
+		}
+	}
+
+	return provider{}, false
+}
+
+func envEquals(key, value string) func(func(string) string) bool {
+	return func(getenv func(string) string) bool {
+		return strings.EqualFold(getenv(key), value)
+	}
+}
+
+func envSet(key string) func(func(string) string) bool {
+	return func(getenv func(string) string) bool {
+		return getenv(key) != ""
+	}
+}
+
+func firstEnv(getenv func(string) string, keys ...string) string {
+	for _, key := range keys {
+		if value := getenv(key); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
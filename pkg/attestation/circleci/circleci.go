@@ -0,0 +1,409 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package circleci records the CircleCI job a step ran in. The job's OIDC token is verified against the keys of its
+// organization's issuer and its claims are checked against the job's environment, so policies can trust the recorded
+// organization, project, and repository rather than environment variables anyone could set.
+package circleci
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/jwt"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/oidc"
+)
+
+const (
+	Name    = "circleci"
+	Type    = "https://witness.dev/attestations/circleci/v0.1"
+	RunType = attestation.PreMaterialRunType
+
+	// DefaultTokenEnv is the variable the job's OIDC token is read from when none is configured. CIRCLE_OIDC_TOKEN is
+	// used when it isn't set.
+	DefaultTokenEnv = "CIRCLE_OIDC_TOKEN_V2"
+	// DefaultIssuerURL is where the issuer of each organization is, under /org/<organization id>.
+	DefaultIssuerURL = "https://oidc.circleci.com"
+
+	claimProjectID = "oidc.circleci.com/project-id"
+	claimVCSOrigin = "oidc.circleci.com/vcs-origin"
+	claimVCSRef    = "oidc.circleci.com/vcs-ref"
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor   = &Attestor{}
+	_ attestation.Subjecter  = &Attestor{}
+	_ attestation.BackReffer = &Attestor{}
+)
+
+// vcsTypes are the short names CircleCI uses for version control providers in project slugs.
+var vcsTypes = map[string]string{
+	"gh":        "gh",
+	"github":    "gh",
+	"bb":        "bb",
+	"bitbucket": "bb",
+}
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() },
+		attestation.StringConfigOption(
+			"tokenEnv",
+			"Variable holding the job's OIDC token. CIRCLE_OIDC_TOKEN is used when it isn't set",
+			DefaultTokenEnv,
+			func(a attestation.Attestor, tokenEnv string) (attestation.Attestor, error) {
+				circleAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a circleci attestor", a)
+				}
+
+				WithTokenEnv(tokenEnv)(circleAttestor)
+				return circleAttestor, nil
+			},
+		),
+		attestation.StringConfigOption(
+			"organizationID",
+			"ID of the organization the job's OIDC token must be issued by. Tokens of any organization are accepted if empty",
+			"",
+			func(a attestation.Attestor, organizationID string) (attestation.Attestor, error) {
+				circleAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a circleci attestor", a)
+				}
+
+				WithOrganizationID(organizationID)(circleAttestor)
+				return circleAttestor, nil
+			},
+		),
+	)
+}
+
+type ErrNotCircleCI struct{}
+
+func (e ErrNotCircleCI) Error() string {
+	return "not in a circleci job"
+}
+
+type Option func(*Attestor)
+
+// WithTokenEnv reads the job's OIDC token from the variable tokenEnv.
+func WithTokenEnv(tokenEnv string) Option {
+	return func(a *Attestor) {
+		a.tokenEnv = tokenEnv
+	}
+}
+
+// WithOrganizationID requires the job's OIDC token to be issued by the organization with id organizationID.
+func WithOrganizationID(organizationID string) Option {
+	return func(a *Attestor) {
+		a.organizationID = organizationID
+	}
+}
+
+// WithIssuerURL trusts tokens issued under issuerURL rather than DefaultIssuerURL.
+func WithIssuerURL(issuerURL string) Option {
+	return func(a *Attestor) {
+		a.issuerURL = strings.TrimSuffix(issuerURL, "/")
+	}
+}
+
+type Attestor struct {
+	JWT            *jwt.Attestor `json:"jwt,omitempty"`
+	OrganizationID string        `json:"organizationid"`
+	ProjectID      string        `json:"projectid"`
+	ProjectSlug    string        `json:"projectslug"`
+	PipelineID     string        `json:"pipelineid"`
+	WorkflowID     string        `json:"workflowid"`
+	WorkflowUrl    string        `json:"workflowurl"`
+	JobName        string        `json:"jobname"`
+	JobNumber      string        `json:"jobnumber"`
+	JobUrl         string        `json:"joburl"`
+	Repository     string        `json:"repository"`
+	Branch         string        `json:"branch,omitempty"`
+	Tag            string        `json:"tag,omitempty"`
+	Revision       string        `json:"revision"`
+	PullRequest    string        `json:"pullrequest,omitempty"`
+	Username       string        `json:"username,omitempty"`
+
+	tokenEnv       string
+	organizationID string
+	issuerURL      string
+	subjects       map[string]cryptoutil.DigestSet
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		tokenEnv:  DefaultTokenEnv,
+		issuerURL: DefaultIssuerURL,
+		subjects:  make(map[string]cryptoutil.DigestSet),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	if os.Getenv("CIRCLECI") != "true" {
+		return ErrNotCircleCI{}
+	}
+
+	a.OrganizationID = os.Getenv("CIRCLE_ORGANIZATION_ID")
+	a.ProjectID = os.Getenv("CIRCLE_PROJECT_ID")
+	a.PipelineID = os.Getenv("CIRCLE_PIPELINE_ID")
+	a.WorkflowID = os.Getenv("CIRCLE_WORKFLOW_ID")
+	a.JobName = os.Getenv("CIRCLE_JOB")
+	a.JobNumber = os.Getenv("CIRCLE_BUILD_NUM")
+	a.JobUrl = os.Getenv("CIRCLE_BUILD_URL")
+	a.Repository = os.Getenv("CIRCLE_REPOSITORY_URL")
+	a.Branch = os.Getenv("CIRCLE_BRANCH")
+	a.Tag = os.Getenv("CIRCLE_TAG")
+	a.Revision = os.Getenv("CIRCLE_SHA1")
+	a.PullRequest = os.Getenv("CIRCLE_PULL_REQUEST")
+	a.Username = os.Getenv("CIRCLE_USERNAME")
+	if a.WorkflowID != "" {
+		a.WorkflowUrl = fmt.Sprintf("https://app.circleci.com/pipelines/workflows/%v", a.WorkflowID)
+	}
+
+	if token := a.token(); token != "" {
+		if err := a.verify(ctx, token); err != nil {
+			return err
+		}
+	} else {
+		log.Warnf("No circleci oidc token is set in %v, the job can't be verified", a.tokenEnv)
+	}
+
+	a.ProjectSlug = projectSlug(a.JobUrl, a.Repository, a.OrganizationID, a.ProjectID)
+	subjects := []struct{ kind, value string }{
+		{"joburl", a.JobUrl},
+		{"workflowurl", a.WorkflowUrl},
+		{"projectslug", a.ProjectSlug},
+	}
+
+	for _, subject := range subjects {
+		if subject.value == "" {
+			continue
+		}
+
+		digestSet, err := cryptoutil.CalculateDigestSetFromBytes([]byte(subject.value), ctx.Hashes())
+		if err != nil {
+			return err
+		}
+
+		a.subjects[fmt.Sprintf("%v:%v", subject.kind, subject.value)] = digestSet
+	}
+
+	return nil
+}
+
+// token returns the job's OIDC token.
+func (a *Attestor) token() string {
+	for _, env := range []string{a.tokenEnv, "CIRCLE_OIDC_TOKEN"} {
+		if env == "" {
+			continue
+		}
+
+		if token := os.Getenv(env); token != "" {
+			return token
+		}
+	}
+
+	return ""
+}
+
+// verify verifies token against the keys of the issuer of the job's organization and checks its claims. The
+// organization is the one configured, or else the one the job's environment or the token names, which is then
+// only trusted once the token is verified against that organization's keys.
+func (a *Attestor) verify(ctx *attestation.AttestationContext, token string) error {
+	organizationID := a.organizationID
+	if organizationID == "" {
+		organizationID = a.OrganizationID
+	}
+
+	if organizationID == "" {
+		claims, err := unverifiedClaims(token)
+		if err != nil {
+			return fmt.Errorf("failed to read circleci oidc token: %w", err)
+		}
+
+		organizationID = fmt.Sprint(claims["aud"])
+	}
+
+	if a.OrganizationID != "" && a.OrganizationID != organizationID {
+		return fmt.Errorf("circleci oidc token must be issued by organization %v, but the job is in %v", organizationID, a.OrganizationID)
+	}
+
+	a.OrganizationID = organizationID
+	jwksURL, err := oidc.DiscoverJWKS(a.issuer())
+	if err != nil {
+		return err
+	}
+
+	a.JWT = jwt.New(jwt.WithToken(token), jwt.WithJWKSUrl(jwksURL))
+	if err := a.JWT.Attest(ctx); err != nil {
+		return fmt.Errorf("failed to verify circleci oidc token: %w", err)
+	}
+
+	return a.checkClaims()
+}
+
+// issuer returns the issuer of the tokens of the job's organization.
+func (a *Attestor) issuer() string {
+	return fmt.Sprintf("%v/org/%v", a.issuerURL, a.OrganizationID)
+}
+
+// checkClaims checks that the verified token was issued by the job's organization, for it, and hasn't expired, and
+// that the project and repository it names are the job's. The job's variables are only trusted if they match the
+// claims.
+func (a *Attestor) checkClaims() error {
+	// tokens are issued for the organization's id as their audience
+	if err := oidc.CheckClaims(a.JWT, "circleci oidc token", a.issuer(), a.OrganizationID); err != nil {
+		return err
+	}
+
+	// the subject is org/<organization id>/project/<project id>/user/<user id>
+	claims := a.JWT.Claims
+	parts := strings.Split(fmt.Sprint(claims["sub"]), "/")
+	if len(parts) < 4 || parts[0] != "org" || parts[2] != "project" || parts[1] != a.OrganizationID {
+		return fmt.Errorf("circleci oidc token has unexpected subject %v", claims["sub"])
+	}
+
+	projectID := parts[3]
+	if claimed, ok := claims[claimProjectID]; ok {
+		projectID = fmt.Sprint(claimed)
+	}
+
+	if a.ProjectID != "" && a.ProjectID != projectID {
+		return fmt.Errorf("circleci oidc token was issued for project %v, but CIRCLE_PROJECT_ID is %v", projectID, a.ProjectID)
+	}
+
+	a.ProjectID = projectID
+	if origin, ok := claims[claimVCSOrigin]; ok && !strings.EqualFold(fmt.Sprint(origin), vcsOrigin(a.Repository)) {
+		return fmt.Errorf("circleci oidc token was issued for repository %v, but CIRCLE_REPOSITORY_URL is %v", origin, a.Repository)
+	}
+
+	if ref, ok := claims[claimVCSRef]; ok {
+		expected := "refs/heads/" + a.Branch
+		if a.Tag != "" {
+			expected = "refs/tags/" + a.Tag
+		}
+
+		if fmt.Sprint(ref) != expected {
+			return fmt.Errorf("circleci oidc token was issued for %v, but the job built %v", ref, expected)
+		}
+	}
+
+	return nil
+}
+
+// unverifiedClaims decodes the claims of token without verifying it, to find the organization whose keys verify it.
+func unverifiedClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token is not a jwt")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// vcsOrigin returns a repository url in the host/owner/repository form of the vcs-origin claim. CircleCI checks out
+// over SSH, so CIRCLE_REPOSITORY_URL is usually git@<host>:<owner>/<repository>.git.
+func vcsOrigin(repository string) string {
+	origin := strings.TrimSuffix(repository, ".git")
+	if u, err := url.Parse(origin); err == nil && u.Host != "" {
+		return u.Host + u.Path
+	}
+
+	if i := strings.Index(origin, "@"); i >= 0 {
+		origin = origin[i+1:]
+	}
+
+	return strings.Replace(origin, ":", "/", 1)
+}
+
+// projectSlug returns the slug CircleCI's API identifies the project by: <vcs>/<owner>/<repository> for GitHub and
+// Bitbucket projects, read from the job's url, or circleci/<organization id>/<project id> for projects that aren't
+// connected through an OAuth app.
+func projectSlug(jobURL, repository, organizationID, projectID string) string {
+	if u, err := url.Parse(jobURL); err == nil {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) >= 3 {
+			if vcs, ok := vcsTypes[parts[0]]; ok {
+				return strings.Join([]string{vcs, parts[1], parts[2]}, "/")
+			}
+		}
+	}
+
+	origin := strings.Split(vcsOrigin(repository), "/")
+	if len(origin) == 3 {
+		switch strings.ToLower(origin[0]) {
+		case "github.com":
+			return strings.Join([]string{"gh", origin[1], origin[2]}, "/")
+		case "bitbucket.org":
+			return strings.Join([]string{"bb", origin[1], origin[2]}, "/")
+		}
+	}
+
+	if organizationID != "" && projectID != "" {
+		return strings.Join([]string{"circleci", organizationID, projectID}, "/")
+	}
+
+	return ""
+}
+
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	return a.subjects
+}
+
+func (a *Attestor) BackRefs() map[string]cryptoutil.DigestSet {
+	backRefs := make(map[string]cryptoutil.DigestSet)
+	workflowUrl := fmt.Sprintf("workflowurl:%v", a.WorkflowUrl)
+	if digestSet, ok := a.subjects[workflowUrl]; ok {
+		backRefs[workflowUrl] = digestSet
+	}
+
+	return backRefs
+}
@@ -0,0 +1,233 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package circleci
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+)
+
+const (
+	orgID      = "6b1c2d3e-0000-4000-8000-00000000000a"
+	projectID  = "7c2d3e4f-0000-4000-8000-00000000000b"
+	workflowID = "8d3e4f50-0000-4000-8000-00000000000c"
+)
+
+// fakeCircleCI serves the keys of an organization's issuer and signs job tokens with its key.
+type fakeCircleCI struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newFakeCircleCI(t *testing.T) *fakeCircleCI {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	f := &fakeCircleCI{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/org/"+orgID+"/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]string{"issuer": f.issuer(), "jwks_uri": f.issuer() + "/.well-known/jwks-pub.json"}))
+	})
+
+	mux.HandleFunc("/org/"+orgID+"/.well-known/jwks-pub.json", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "circleci",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}}))
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeCircleCI) issuer() string {
+	return f.URL + "/org/" + orgID
+}
+
+func (f *fakeCircleCI) token(t *testing.T, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "circleci", "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (f *fakeCircleCI) claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":          f.issuer(),
+		"aud":          orgID,
+		"sub":          "org/" + orgID + "/project/" + projectID + "/user/9e4f5061",
+		"exp":          time.Now().Add(time.Hour).Unix(),
+		claimProjectID: projectID,
+		claimVCSOrigin: "github.com/acme/app",
+		claimVCSRef:    "refs/heads/main",
+	}
+}
+
+// claimsWith returns the claims of a token for the job with claim replaced by value.
+func (f *fakeCircleCI) claimsWith(claim string, value interface{}) map[string]interface{} {
+	claims := f.claims()
+	claims[claim] = value
+	return claims
+}
+
+func setJobEnv(t *testing.T) {
+	for env, value := range map[string]string{
+		"CIRCLECI":               "true",
+		"CIRCLE_ORGANIZATION_ID": "",
+		"CIRCLE_PROJECT_ID":      projectID,
+		"CIRCLE_PIPELINE_ID":     "a05f6172",
+		"CIRCLE_WORKFLOW_ID":     workflowID,
+		"CIRCLE_JOB":             "build",
+		"CIRCLE_BUILD_NUM":       "42",
+		"CIRCLE_BUILD_URL":       "https://circleci.com/gh/acme/app/42",
+		"CIRCLE_REPOSITORY_URL":  "git@github.com:acme/app.git",
+		"CIRCLE_BRANCH":          "main",
+		"CIRCLE_TAG":             "",
+		"CIRCLE_SHA1":            "abc123",
+		"CIRCLE_OIDC_TOKEN":      "",
+		"CIRCLE_OIDC_TOKEN_V2":   "",
+	} {
+		t.Setenv(env, value)
+	}
+}
+
+func attest(t *testing.T, a *Attestor) error {
+	ctx, err := attestation.NewContext([]attestation.Attestor{a})
+	require.NoError(t, err)
+	return ctx.RunAttestors()
+}
+
+func TestAttest(t *testing.T) {
+	circle := newFakeCircleCI(t)
+	setJobEnv(t)
+	t.Setenv(DefaultTokenEnv, circle.token(t, circle.claims()))
+
+	a := New(WithIssuerURL(circle.URL))
+	require.NoError(t, attest(t, a))
+	require.Equal(t, orgID, a.OrganizationID)
+	require.Equal(t, projectID, a.ProjectID)
+	require.Equal(t, "gh/acme/app", a.ProjectSlug)
+	require.Equal(t, "a05f6172", a.PipelineID)
+	require.Equal(t, "42", a.JobNumber)
+	require.Equal(t, circle.issuer()+"/.well-known/jwks-pub.json", a.JWT.VerifiedBy.JWKSUrl)
+	require.Contains(t, a.Subjects(), "projectslug:gh/acme/app")
+	require.Contains(t, a.Subjects(), "joburl:https://circleci.com/gh/acme/app/42")
+	require.Contains(t, a.BackRefs(), "workflowurl:https://app.circleci.com/pipelines/workflows/"+workflowID)
+
+	// the original token is used without a v2 token, and the organization is pinned
+	t.Setenv(DefaultTokenEnv, "")
+	t.Setenv("CIRCLE_OIDC_TOKEN", circle.token(t, circle.claims()))
+	a = New(WithIssuerURL(circle.URL), WithOrganizationID(orgID))
+	require.NoError(t, attest(t, a))
+	require.NotNil(t, a.JWT)
+
+	// without a token the job is recorded unverified
+	t.Setenv("CIRCLE_OIDC_TOKEN", "")
+	a = New(WithIssuerURL(circle.URL))
+	require.NoError(t, attest(t, a))
+	require.Nil(t, a.JWT)
+	require.Equal(t, "build", a.JobName)
+}
+
+func TestAttestRejectsTokens(t *testing.T) {
+	circle := newFakeCircleCI(t)
+	setJobEnv(t)
+	other := newFakeCircleCI(t)
+
+	for name, test := range map[string]struct {
+		token   string
+		opts    []Option
+		message string
+	}{
+		"another project": {
+			token:   circle.token(t, circle.claimsWith(claimProjectID, "other")),
+			message: "issued for project other, but CIRCLE_PROJECT_ID is " + projectID,
+		},
+		"another repository": {
+			token:   circle.token(t, circle.claimsWith(claimVCSOrigin, "github.com/acme/other")),
+			message: "issued for repository github.com/acme/other",
+		},
+		"another branch": {
+			token:   circle.token(t, circle.claimsWith(claimVCSRef, "refs/heads/feature")),
+			message: "issued for refs/heads/feature, but the job built refs/heads/main",
+		},
+		"expired": {
+			token:   circle.token(t, circle.claimsWith("exp", time.Now().Add(-time.Hour).Unix())),
+			message: "expired",
+		},
+		"another issuer": {
+			token:   circle.token(t, circle.claimsWith("iss", "https://oidc.circleci.com/org/"+orgID)),
+			message: "issued by https://oidc.circleci.com/org/" + orgID,
+		},
+		"another organization's key": {
+			token:   other.token(t, circle.claims()),
+			message: "failed to verify circleci oidc token",
+		},
+		"another organization": {
+			token:   circle.token(t, circle.claims()),
+			opts:    []Option{WithOrganizationID("other")},
+			message: "failed to discover keys",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(DefaultTokenEnv, test.token)
+			require.ErrorContains(t, attest(t, New(append([]Option{WithIssuerURL(circle.URL)}, test.opts...)...)), test.message)
+		})
+	}
+
+	t.Run("job in another organization", func(t *testing.T) {
+		t.Setenv(DefaultTokenEnv, circle.token(t, circle.claims()))
+		t.Setenv("CIRCLE_ORGANIZATION_ID", "other")
+		require.ErrorContains(t, attest(t, New(WithIssuerURL(circle.URL), WithOrganizationID(orgID))), "but the job is in other")
+	})
+}
+
+func TestProjectSlug(t *testing.T) {
+	require.Equal(t, "gh/acme/app", projectSlug("https://circleci.com/gh/acme/app/42", "", "", ""))
+	require.Equal(t, "bb/acme/app", projectSlug("", "git@bitbucket.org:acme/app.git", "", ""))
+	require.Equal(t, "gh/acme/app", projectSlug("", "https://github.com/acme/app", "", ""))
+	require.Equal(t, "circleci/"+orgID+"/"+projectID, projectSlug("", "https://gitlab.com/acme/app", orgID, projectID))
+	require.Empty(t, projectSlug("", "", "", ""))
+}
+
+func TestRegistered(t *testing.T) {
+	for _, nameOrType := range []string{Name, Type} {
+		attestors, err := attestation.Attestors([]string{nameOrType})
+		require.NoError(t, err)
+		require.IsType(t, &Attestor{}, attestors[0])
+		require.Equal(t, DefaultTokenEnv, attestors[0].(*Attestor).tokenEnv)
+	}
+}
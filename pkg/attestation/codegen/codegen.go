@@ -0,0 +1,368 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/attestation/recorded"
+	"github.com/testifysec/witness/pkg/schedule"
+)
+
+const (
+	Name    = "codegen"
+	Type    = "https://witness.dev/attestations/codegen/v0.1"
+	RunType = attestation.PostProductRunType
+
+	GeneratorProtoc     = "protoc"
+	GeneratorOpenAPI    = "openapi-generator"
+	GeneratorGoGenerate = "go generate"
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor = &Attestor{}
+)
+
+func init() {
+	schedule.RegisterDependencies(Name, commandrun.Name)
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Generation is a run of a code generator during the step.
+type Generation struct {
+	Generator     string               `json:"generator"`
+	Program       string               `json:"program"`
+	ProgramDigest cryptoutil.DigestSet `json:"programdigest,omitempty"`
+	// Flags are the generator's arguments other than its input files, such as protoc's plugin options.
+	Flags []string `json:"flags,omitempty"`
+	// Directives are the //go:generate directives go generate ran, prefixed with the file they were found in.
+	Directives []string `json:"directives,omitempty"`
+	// Tools are programs the generator ran, such as protoc plugins, found in the command's trace.
+	Tools map[string]cryptoutil.DigestSet `json:"tools,omitempty"`
+	// Inputs are the files the generator read, keyed by path relative to the working directory. Inputs fetched
+	// from a URL are recorded without a digest.
+	Inputs map[string]cryptoutil.DigestSet `json:"inputs"`
+	// Outputs are the products the generator wrote, keyed by path relative to the working directory.
+	Outputs map[string]cryptoutil.DigestSet `json:"outputs"`
+}
+
+type Option func(*Attestor)
+
+// Attestor records the runs of code generators in the step, linking each generator's binary, flags, and input files
+// to the files it generated, so policies can require that generated code was produced from approved sources by an
+// approved generator. protoc, openapi-generator, and go generate are recognized when they are the command witness
+// runs, or anywhere in the command's process tree when it is traced.
+type Attestor struct {
+	Generations []Generation `json:"generations"`
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		Generations: []Generation{},
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	run := recorded.CommandRun(ctx)
+	if run == nil || len(run.Cmd) == 0 {
+		log.Debugf("(attestation/codegen) no command was run")
+		return nil
+	}
+
+	seen := make(map[string]struct{})
+	if inv, ok := parseCommand(run.Cmd); ok {
+		program, digest, err := a.resolveProgram(ctx, inv.program)
+		if err != nil {
+			log.Debugf("(attestation/codegen) could not digest %v: %v", inv.program, err)
+		}
+
+		a.record(ctx, inv, program, digest, tools(inv.generator, run.Processes, -1))
+		seen[strings.Join(run.Cmd, " ")] = struct{}{}
+	}
+
+	for _, proc := range run.Processes {
+		args := strings.Fields(proc.Cmdline)
+		if len(args) == 0 {
+			continue
+		}
+
+		if _, ok := seen[strings.Join(args, " ")]; ok {
+			continue
+		}
+
+		inv, ok := parseCommand(args)
+		if !ok {
+			continue
+		}
+
+		seen[strings.Join(args, " ")] = struct{}{}
+		program, digest := proc.Program, proc.ProgramDigest
+		if inv.generator == GeneratorOpenAPI && inv.program != args[0] {
+			// the generator is a jar run by java, so digest the jar rather than the java binary
+			var err error
+			if program, digest, err = a.resolveProgram(ctx, inv.program); err != nil {
+				log.Debugf("(attestation/codegen) could not digest %v: %v", inv.program, err)
+			}
+		}
+
+		a.record(ctx, inv, program, digest, tools(inv.generator, run.Processes, proc.ProcessID))
+	}
+
+	if len(a.Generations) == 0 {
+		log.Debugf("(attestation/codegen) no code generators found in %v", run.Cmd)
+	}
+
+	return nil
+}
+
+func (a *Attestor) record(ctx *attestation.AttestationContext, inv invocation, program string, digest cryptoutil.DigestSet, tools map[string]cryptoutil.DigestSet) {
+	gen := Generation{
+		Generator:     inv.generator,
+		Program:       program,
+		ProgramDigest: digest,
+		Flags:         inv.flags,
+		Tools:         tools,
+		Inputs:        make(map[string]cryptoutil.DigestSet),
+		Outputs:       make(map[string]cryptoutil.DigestSet),
+	}
+
+	if len(gen.Tools) == 0 {
+		gen.Tools = nil
+	}
+
+	inputs := inv.inputs
+	if inv.generator == GeneratorGoGenerate {
+		files, directives, err := goGenerateFiles(ctx.WorkingDir(), inv.packages)
+		if err != nil {
+			log.Debugf("(attestation/codegen) failed to find go:generate directives: %v", err)
+		}
+
+		inputs = append(inputs, files...)
+		gen.Directives = directives
+	}
+
+	materials := ctx.Materials()
+	for _, input := range inputs {
+		if strings.Contains(input, "://") {
+			gen.Inputs[input] = nil
+			continue
+		}
+
+		path, ok := resolveInput(ctx.WorkingDir(), input, inv.searchPaths)
+		if !ok {
+			log.Debugf("(attestation/codegen) could not find input %v", input)
+			continue
+		}
+
+		rel := relativePath(ctx.WorkingDir(), path)
+		if digest, ok := materials[rel]; ok {
+			gen.Inputs[rel] = digest
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			// directories such as openapi-generator's template directory are recorded through their files
+			for material, digest := range materials {
+				if underDir(material, rel) {
+					gen.Inputs[material] = digest
+				}
+			}
+
+			continue
+		}
+
+		digest, err := cryptoutil.CalculateDigestSetFromFile(path, ctx.Hashes())
+		if err != nil {
+			log.Debugf("(attestation/codegen) failed to digest input %v: %v", path, err)
+			continue
+		}
+
+		gen.Inputs[rel] = digest
+	}
+
+	outputDirs := make([]string, 0, len(inv.outputs))
+	for _, output := range inv.outputs {
+		if !filepath.IsAbs(output) {
+			output = filepath.Join(ctx.WorkingDir(), output)
+		}
+
+		outputDirs = append(outputDirs, relativePath(ctx.WorkingDir(), output))
+	}
+
+	for path, product := range ctx.Products() {
+		if _, ok := gen.Inputs[path]; ok {
+			continue
+		}
+
+		if inv.generator != GeneratorGoGenerate && !underAny(path, outputDirs) {
+			continue
+		}
+
+		gen.Outputs[path] = product.Digest
+	}
+
+	a.Generations = append(a.Generations, gen)
+}
+
+// resolveProgram finds the generator's binary the way the command was resolved, from the PATH or relative to the
+// working directory, and digests it.
+func (a *Attestor) resolveProgram(ctx *attestation.AttestationContext, program string) (string, cryptoutil.DigestSet, error) {
+	path := program
+	if strings.ContainsRune(program, filepath.Separator) {
+		if !filepath.IsAbs(program) {
+			path = filepath.Join(ctx.WorkingDir(), program)
+		}
+	} else if strings.HasSuffix(program, ".jar") {
+		path = filepath.Join(ctx.WorkingDir(), program)
+	} else {
+		var err error
+		if path, err = exec.LookPath(program); err != nil {
+			return program, nil, err
+		}
+	}
+
+	digest, err := cryptoutil.CalculateDigestSetFromFile(path, ctx.Hashes())
+	return path, digest, err
+}
+
+// tools returns the programs a generator ran, from the traced processes descended from pid, or from every traced
+// process other than the first when the generator is the command itself and pid is -1.
+func tools(generator string, processes []commandrun.ProcessInfo, pid int) map[string]cryptoutil.DigestSet {
+	found := make(map[string]cryptoutil.DigestSet)
+	parents := make(map[int]int, len(processes))
+	for _, proc := range processes {
+		parents[proc.ProcessID] = proc.ParentPID
+	}
+
+	for i, proc := range processes {
+		if proc.Program == "" || len(proc.ProgramDigest) == 0 {
+			continue
+		}
+
+		if pid == -1 && i == 0 || pid == proc.ProcessID {
+			continue
+		}
+
+		if pid != -1 && !descendsFrom(parents, proc.ProcessID, pid) {
+			continue
+		}
+
+		if generator == GeneratorProtoc && !strings.HasPrefix(filepath.Base(proc.Program), "protoc-gen-") {
+			continue
+		}
+
+		if generator == GeneratorOpenAPI {
+			continue
+		}
+
+		found[proc.Program] = proc.ProgramDigest
+	}
+
+	return found
+}
+
+func descendsFrom(parents map[int]int, pid, ancestor int) bool {
+	for depth := 0; depth < len(parents); depth++ {
+		parent, ok := parents[pid]
+		if !ok {
+			return false
+		}
+
+		if parent == ancestor {
+			return true
+		}
+
+		pid = parent
+	}
+
+	return false
+}
+
+// resolveInput finds input relative to the working directory, then relative to each of searchPaths, as protoc
+// does with its include paths.
+func resolveInput(workingDir, input string, searchPaths []string) (string, bool) {
+	candidates := []string{input}
+	if !filepath.IsAbs(input) {
+		candidates = []string{filepath.Join(workingDir, input)}
+		for _, dir := range searchPaths {
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(workingDir, dir)
+			}
+
+			candidates = append(candidates, filepath.Join(dir, input))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, true
+		}
+	}
+
+	return "", false
+}
+
+// relativePath returns path relative to the working directory in the form materials and products are keyed by,
+// or path itself if it is outside the working directory.
+func relativePath(workingDir, path string) string {
+	rel, err := filepath.Rel(workingDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+func underDir(path, dir string) bool {
+	return dir == "." || path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+func underAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if underDir(path, dir) {
+			return true
+		}
+	}
+
+	return false
+}
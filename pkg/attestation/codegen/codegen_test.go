@@ -0,0 +1,135 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"crypto"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/attestation/material"
+	"github.com/testifysec/go-witness/attestation/product"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+// fakeGenerator puts a script named name on the PATH that runs script, standing in for a real generator.
+func fakeGenerator(t *testing.T, name, script string) string {
+	bin := t.TempDir()
+	path := filepath.Join(bin, name)
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return path
+}
+
+func writeFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func runAttestors(t *testing.T, dir string, cmd []string) (*Attestor, *attestation.AttestationContext) {
+	codegenAttestor := New()
+	ctx, err := attestation.NewContext([]attestation.Attestor{material.New(), commandrun.New(commandrun.WithCommand(cmd)), product.New(), codegenAttestor}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	for _, completed := range ctx.CompletedAttestors() {
+		require.NoError(t, completed.Error)
+	}
+
+	return codegenAttestor, ctx
+}
+
+func digestFile(t *testing.T, path string) cryptoutil.DigestSet {
+	digest, err := cryptoutil.CalculateDigestSetFromFile(path, []crypto.Hash{crypto.SHA256})
+	require.NoError(t, err)
+	return digest
+}
+
+func TestProtoc(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "proto", "api", "v1", "service.proto"), "syntax = \"proto3\";\n")
+	writeFile(t, filepath.Join(dir, "README.md"), "docs\n")
+	program := fakeGenerator(t, "protoc", "mkdir -p gen/api/v1 && echo generated > gen/api/v1/service.pb.go && echo unrelated > build.log")
+
+	a, ctx := runAttestors(t, dir, []string{"protoc", "-Iproto", "--go_out=paths=source_relative:gen", "--go_opt=module=example.com", "api/v1/service.proto"})
+	require.Len(t, a.Generations, 1)
+	gen := a.Generations[0]
+	require.Equal(t, GeneratorProtoc, gen.Generator)
+	require.Equal(t, program, gen.Program)
+	require.Equal(t, digestFile(t, program), gen.ProgramDigest)
+	require.Equal(t, []string{"-Iproto", "--go_out=paths=source_relative:gen", "--go_opt=module=example.com"}, gen.Flags)
+	require.Equal(t, map[string]cryptoutil.DigestSet{"proto/api/v1/service.proto": ctx.Materials()["proto/api/v1/service.proto"]}, gen.Inputs)
+	require.Equal(t, map[string]cryptoutil.DigestSet{"gen/api/v1/service.pb.go": ctx.Products()["gen/api/v1/service.pb.go"].Digest}, gen.Outputs)
+}
+
+func TestOpenAPIGenerator(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "openapi.yaml"), "openapi: 3.0.0\n")
+	writeFile(t, filepath.Join(dir, "templates", "model.mustache"), "{{model}}\n")
+	fakeGenerator(t, "openapi-generator-cli", "mkdir -p client && echo generated > client/api.go")
+
+	a, ctx := runAttestors(t, dir, []string{"openapi-generator-cli", "generate", "-i", "openapi.yaml", "-g", "go", "-o", "client", "--template-dir=templates"})
+	require.Len(t, a.Generations, 1)
+	gen := a.Generations[0]
+	require.Equal(t, GeneratorOpenAPI, gen.Generator)
+	require.Equal(t, []string{"-i", "openapi.yaml", "-g", "go", "-o", "client", "--template-dir=templates"}, gen.Flags)
+	require.Equal(t, map[string]cryptoutil.DigestSet{
+		"openapi.yaml":             ctx.Materials()["openapi.yaml"],
+		"templates/model.mustache": ctx.Materials()["templates/model.mustache"],
+	}, gen.Inputs)
+	require.Equal(t, map[string]cryptoutil.DigestSet{"client/api.go": ctx.Products()["client/api.go"].Digest}, gen.Outputs)
+}
+
+func TestGoGenerate(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "api", "api.go"), "package api\n\n//go:generate stringer -type=Kind\n")
+	writeFile(t, filepath.Join(dir, "api", "kind.go"), "package api\n\ntype Kind int\n")
+	writeFile(t, filepath.Join(dir, "vendor", "dep", "dep.go"), "package dep\n\n//go:generate ignored\n")
+	fakeGenerator(t, "go", "echo generated > api/kind_string.go")
+
+	a, ctx := runAttestors(t, dir, []string{"go", "generate", "-x", "./..."})
+	require.Len(t, a.Generations, 1)
+	gen := a.Generations[0]
+	require.Equal(t, GeneratorGoGenerate, gen.Generator)
+	require.Equal(t, []string{"-x"}, gen.Flags)
+	require.Equal(t, []string{"api/api.go: stringer -type=Kind"}, gen.Directives)
+	require.Equal(t, map[string]cryptoutil.DigestSet{"api/api.go": ctx.Materials()["api/api.go"]}, gen.Inputs)
+	require.Equal(t, map[string]cryptoutil.DigestSet{"api/kind_string.go": ctx.Products()["api/kind_string.go"].Digest}, gen.Outputs)
+}
+
+func TestNotAGenerator(t *testing.T) {
+	a, _ := runAttestors(t, t.TempDir(), []string{"true"})
+	require.Empty(t, a.Generations)
+
+	_, ok := parseCommand([]string{"openapi-generator-cli", "version"})
+	require.False(t, ok)
+}
+
+func TestTracedGenerators(t *testing.T) {
+	digest := cryptoutil.DigestSet{cryptoutil.DigestValue{Hash: crypto.SHA256}: "abc"}
+	processes := []commandrun.ProcessInfo{
+		{Program: "/usr/bin/make", ProcessID: 1, ProgramDigest: digest},
+		{Program: "/usr/bin/protoc", ProcessID: 2, ParentPID: 1, ProgramDigest: digest, Cmdline: "protoc --go_out=gen api.proto"},
+		{Program: "/go/bin/protoc-gen-go", ProcessID: 3, ParentPID: 2, ProgramDigest: digest},
+		{Program: "/usr/bin/cc", ProcessID: 4, ParentPID: 1, ProgramDigest: digest},
+	}
+
+	require.Equal(t, map[string]cryptoutil.DigestSet{"/go/bin/protoc-gen-go": digest}, tools(GeneratorProtoc, processes, 2))
+	require.Equal(t, map[string]cryptoutil.DigestSet{"/go/bin/protoc-gen-go": digest}, tools(GeneratorProtoc, processes, -1))
+	require.Empty(t, tools(GeneratorProtoc, processes, 4))
+}
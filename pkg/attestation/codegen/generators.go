@@ -0,0 +1,280 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codegen
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const goGeneratePrefix = "//go:generate "
+
+// invocation is what a generator's command line says it reads and writes.
+type invocation struct {
+	generator string
+	program   string
+	flags     []string
+	inputs    []string
+	// searchPaths are directories inputs are looked up in after the working directory, such as protoc's -I.
+	searchPaths []string
+	// outputs are the directories or files the generator writes to.
+	outputs []string
+	// packages are the package patterns go generate was run on.
+	packages []string
+}
+
+// parseCommand recognizes a generator's command line, returning false for any other command.
+func parseCommand(args []string) (invocation, bool) {
+	if len(args) == 0 {
+		return invocation{}, false
+	}
+
+	base := filepath.Base(args[0])
+	switch {
+	case base == "protoc":
+		return parseProtoc(args[0], args[1:]), true
+	case strings.HasPrefix(base, "openapi-generator"):
+		return parseOpenAPI(args[0], args[1:])
+	case base == "java":
+		for i := 1; i < len(args)-1; i++ {
+			if args[i] == "-jar" && strings.HasPrefix(filepath.Base(args[i+1]), "openapi-generator") {
+				return parseOpenAPI(args[i+1], args[i+2:])
+			}
+		}
+	case base == "go" && len(args) > 1 && args[1] == "generate":
+		return parseGoGenerate(args[0], args[2:]), true
+	}
+
+	return invocation{}, false
+}
+
+// parseProtoc reads the .proto files, include paths, and output directories from protoc's arguments. Options to
+// plugins given with --<plugin>_out=<options>:<dir> are kept in the flags.
+func parseProtoc(program string, args []string) invocation {
+	inv := invocation{generator: GeneratorProtoc, program: program}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			inv.inputs = append(inv.inputs, arg)
+			continue
+		}
+
+		inv.flags = append(inv.flags, arg)
+		switch {
+		case arg == "-I" || arg == "--proto_path" || arg == "-o":
+			if i+1 < len(args) {
+				i++
+				inv.flags = append(inv.flags, args[i])
+				if arg == "-o" {
+					inv.outputs = append(inv.outputs, args[i])
+				} else {
+					inv.searchPaths = append(inv.searchPaths, args[i])
+				}
+			}
+		case strings.HasPrefix(arg, "-I"):
+			inv.searchPaths = append(inv.searchPaths, arg[2:])
+		case strings.HasPrefix(arg, "--proto_path="):
+			inv.searchPaths = append(inv.searchPaths, strings.TrimPrefix(arg, "--proto_path="))
+		case strings.HasPrefix(arg, "--descriptor_set_in="):
+			inv.inputs = append(inv.inputs, filepath.SplitList(strings.TrimPrefix(arg, "--descriptor_set_in="))...)
+		case strings.HasPrefix(arg, "--descriptor_set_out="):
+			inv.outputs = append(inv.outputs, strings.TrimPrefix(arg, "--descriptor_set_out="))
+		case strings.HasPrefix(arg, "-o"):
+			inv.outputs = append(inv.outputs, arg[2:])
+		case strings.HasPrefix(arg, "--") && strings.Contains(arg, "_out="):
+			dir := arg[strings.Index(arg, "_out=")+len("_out="):]
+			if colon := strings.LastIndex(dir, ":"); colon >= 0 {
+				dir = dir[colon+1:]
+			}
+
+			inv.outputs = append(inv.outputs, dir)
+		}
+	}
+
+	return inv
+}
+
+// parseOpenAPI reads the input spec, configuration, templates, and output directory from the arguments of
+// openapi-generator generate. Other subcommands don't generate code and aren't recognized.
+func parseOpenAPI(program string, args []string) (invocation, bool) {
+	inv := invocation{generator: GeneratorOpenAPI, program: program}
+	generate := false
+	output := "."
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			if arg == "generate" && !generate {
+				generate = true
+			} else {
+				inv.flags = append(inv.flags, arg)
+			}
+
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		inv.flags = append(inv.flags, arg)
+		switch name {
+		case "-i", "--input-spec", "-c", "--config", "-t", "--template-dir", "--ignore-file-override", "-o", "--output":
+			if !hasValue && i+1 < len(args) {
+				i++
+				value = args[i]
+				inv.flags = append(inv.flags, value)
+			}
+
+			if name == "-o" || name == "--output" {
+				output = value
+			} else if value != "" {
+				inv.inputs = append(inv.inputs, value)
+			}
+		}
+	}
+
+	inv.outputs = []string{output}
+	return inv, generate
+}
+
+// parseGoGenerate reads the flags and package patterns of go generate, which runs the directives of the package in
+// the working directory when no packages are given.
+func parseGoGenerate(program string, args []string) invocation {
+	inv := invocation{generator: GeneratorGoGenerate, program: program}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			inv.packages = append(inv.packages, args[i:]...)
+			break
+		}
+
+		inv.flags = append(inv.flags, arg)
+		if (arg == "-run" || arg == "-skip") && i+1 < len(args) {
+			i++
+			inv.flags = append(inv.flags, args[i])
+		}
+	}
+
+	if len(inv.packages) == 0 {
+		inv.packages = []string{"."}
+	}
+
+	return inv
+}
+
+// goGenerateFiles returns the Go files of packages that contain //go:generate directives, along with the directives.
+// Only package patterns that are paths, such as ./... or ./api, are resolved.
+func goGenerateFiles(workingDir string, packages []string) ([]string, []string, error) {
+	dirs := make(map[string]struct{})
+	for _, pattern := range packages {
+		if !filepath.IsAbs(pattern) && pattern != "." && pattern != ".." && !strings.HasPrefix(pattern, "./") && !strings.HasPrefix(pattern, "../") {
+			continue
+		}
+
+		root := pattern
+		recursive := false
+		if pattern == "..." || strings.HasSuffix(pattern, "/...") {
+			root, recursive = strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/"), true
+		}
+
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(workingDir, root)
+		}
+
+		if !recursive {
+			dirs[root] = struct{}{}
+			continue
+		}
+
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !d.IsDir() {
+				return nil
+			}
+
+			// the go command skips these directories when matching ./...
+			if path != root && (d.Name() == "vendor" || d.Name() == "testdata" || strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "_")) {
+				return filepath.SkipDir
+			}
+
+			dirs[path] = struct{}{}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+
+	sort.Strings(sorted)
+	files := []string{}
+	directives := []string{}
+	for _, dir := range sorted {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+				continue
+			}
+
+			path := filepath.Join(dir, entry.Name())
+			found, err := readDirectives(path)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if len(found) == 0 {
+				continue
+			}
+
+			files = append(files, path)
+			rel := relativePath(workingDir, path)
+			for _, directive := range found {
+				directives = append(directives, rel+": "+directive)
+			}
+		}
+	}
+
+	return files, directives, nil
+}
+
+func readDirectives(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	directives := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, goGeneratePrefix) {
+			directives = append(directives, strings.TrimSpace(strings.TrimPrefix(line, goGeneratePrefix)))
+		}
+	}
+
+	return directives, scanner.Err()
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+const (
+	Name    = "deployment"
+	Type    = "https://witness.dev/attestations/deployment/v0.1"
+	RunType = attestation.ExecuteRunType
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor  = &Attestor{}
+	_ attestation.Subjecter = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Attestor records that an artifact was deployed to an environment, and where in it, along with the verified evidence
+// that allowed it. Together with policies that limit steps to environments, it binds each deployment to the
+// requirements of the environment it was deployed to.
+type Attestor struct {
+	Environment  string                     `json:"environment"`
+	Cluster      string                     `json:"cluster,omitempty"`
+	Namespace    string                     `json:"namespace,omitempty"`
+	DeployedAt   time.Time                  `json:"deployedat"`
+	Deployer     verify.Signer              `json:"deployer"`
+	Artifacts    []cryptoutil.DigestSet     `json:"artifacts"`
+	PolicyDigest cryptoutil.DigestSet       `json:"policydigest"`
+	Evidence     []verify.EvidenceReference `json:"evidence"`
+
+	signer   cryptoutil.Signer
+	policy   dsse.Envelope
+	verified map[string][]source.VerifiedCollection
+}
+
+type Option func(*Attestor)
+
+// WithEnvironment sets the environment the artifact is deployed to, such as production.
+func WithEnvironment(environment string) Option {
+	return func(a *Attestor) {
+		a.Environment = environment
+	}
+}
+
+// WithCluster sets the cluster the artifact is deployed to.
+func WithCluster(cluster string) Option {
+	return func(a *Attestor) {
+		a.Cluster = cluster
+	}
+}
+
+// WithNamespace sets the namespace of the cluster the artifact is deployed to.
+func WithNamespace(namespace string) Option {
+	return func(a *Attestor) {
+		a.Namespace = namespace
+	}
+}
+
+// WithSigner records the identity of the signer that signs the deployment as the deployer.
+func WithSigner(signer cryptoutil.Signer) Option {
+	return func(a *Attestor) {
+		a.signer = signer
+	}
+}
+
+// WithArtifacts sets the digests of the deployed artifact. They are the subjects of the attestation.
+func WithArtifacts(artifacts []cryptoutil.DigestSet) Option {
+	return func(a *Attestor) {
+		a.Artifacts = artifacts
+	}
+}
+
+// WithVerification records the policy the artifact was verified against and the evidence that satisfied it.
+func WithVerification(policy dsse.Envelope, verified map[string][]source.VerifiedCollection) Option {
+	return func(a *Attestor) {
+		a.policy = policy
+		a.verified = verified
+	}
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	if a.Environment == "" {
+		return errors.New("a deployment requires an environment")
+	}
+
+	if len(a.Artifacts) == 0 {
+		return errors.New("a deployment requires the digests of the deployed artifact")
+	}
+
+	if a.signer == nil {
+		return errors.New("a deployment requires the signer of the deployer")
+	}
+
+	deployer, err := verify.SignerOf(a.signer)
+	if err != nil {
+		return fmt.Errorf("failed to identify the deployer: %w", err)
+	}
+
+	a.Deployer = deployer
+	if a.PolicyDigest, err = cryptoutil.CalculateDigestSetFromBytes(a.policy.Payload, ctx.Hashes()); err != nil {
+		return fmt.Errorf("failed to digest policy: %w", err)
+	}
+
+	a.Evidence = verify.EvidenceReferences(a.verified)
+	if len(a.Evidence) == 0 {
+		return errors.New("a deployment requires verified evidence of the artifact")
+	}
+
+	a.DeployedAt = time.Now().UTC()
+	return nil
+}
+
+// Subjects returns the digests of the deployed artifact, so the deployment is found when it is verified.
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for _, artifact := range a.Artifacts {
+		for digestValue, digest := range artifact {
+			subjects[fmt.Sprintf("artifact:%v", digest)] = cryptoutil.DigestSet{digestValue: digest}
+		}
+	}
+
+	return subjects
+}
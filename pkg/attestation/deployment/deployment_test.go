@@ -0,0 +1,85 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+func testSigner(t *testing.T) cryptoutil.Signer {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return cryptoutil.NewECDSASigner(priv, crypto.SHA256)
+}
+
+func TestAttest(t *testing.T) {
+	signer := testSigner(t)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	artifact := cryptoutil.DigestSet{cryptoutil.DigestValue{Hash: crypto.SHA256}: "abcd"}
+	verified := map[string][]source.VerifiedCollection{
+		"approve": {{Verifiers: []cryptoutil.Verifier{verifier}, CollectionEnvelope: source.CollectionEnvelope{Reference: "approve.json"}}},
+		"build":   {{Verifiers: []cryptoutil.Verifier{verifier}, CollectionEnvelope: source.CollectionEnvelope{Reference: "build.json"}}},
+	}
+
+	a := New(
+		WithEnvironment("production"),
+		WithCluster("prod-us-east-1"),
+		WithNamespace("payments"),
+		WithSigner(signer),
+		WithArtifacts([]cryptoutil.DigestSet{artifact}),
+		WithVerification(dsse.Envelope{Payload: []byte("{}")}, verified),
+	)
+
+	ctx, err := attestation.NewContext([]attestation.Attestor{a})
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	keyID, err := signer.KeyID()
+	require.NoError(t, err)
+	require.Equal(t, verify.Signer{KeyID: keyID}, a.Deployer)
+	require.Equal(t, []verify.EvidenceReference{{Step: "approve", Reference: "approve.json", Signers: []string{keyID}}, {Step: "build", Reference: "build.json", Signers: []string{keyID}}}, a.Evidence)
+	require.Equal(t, "prod-us-east-1", a.Cluster)
+	require.Equal(t, "payments", a.Namespace)
+	require.False(t, a.DeployedAt.IsZero())
+	require.NotEmpty(t, a.PolicyDigest)
+	require.Equal(t, map[string]cryptoutil.DigestSet{"artifact:abcd": artifact}, a.Subjects())
+}
+
+func TestAttestIncomplete(t *testing.T) {
+	signer := testSigner(t)
+	artifacts := []cryptoutil.DigestSet{{cryptoutil.DigestValue{Hash: crypto.SHA256}: "abcd"}}
+	for name, a := range map[string]*Attestor{
+		"no environment": New(WithSigner(signer), WithArtifacts(artifacts)),
+		"no artifacts":   New(WithEnvironment("production"), WithSigner(signer)),
+		"no signer":      New(WithEnvironment("production"), WithArtifacts(artifacts)),
+		"no evidence":    New(WithEnvironment("production"), WithSigner(signer), WithArtifacts(artifacts)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Error(t, a.Attest(&attestation.AttestationContext{}))
+		})
+	}
+}
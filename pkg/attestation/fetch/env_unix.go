@@ -0,0 +1,63 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package fetch
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// environmentScript is run by sh with the file of variables as $0 and the command as its arguments. The variables are
+// read from a file in dir rather than passed as arguments, since the arguments of a process can be read by every user
+// on the machine and the proxy URL carries the proxy's credential.
+const environmentScript = `set -a && . "$0" && set +a && exec "$@"`
+
+// withEnvironment returns cmd started through sh with variables added to the environment it inherits, so only the
+// command sees them. Variables with empty values are unset.
+func withEnvironment(cmd []string, variables map[string]string, dir string) ([]string, bool, error) {
+	shell, err := exec.LookPath("sh")
+	if err != nil || len(cmd) == 0 {
+		return nil, false, nil
+	}
+
+	keys := make([]string, 0, len(variables))
+	for key := range variables {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	script := &strings.Builder{}
+	for _, key := range keys {
+		if variables[key] == "" {
+			fmt.Fprintf(script, "unset %v\n", key)
+			continue
+		}
+
+		fmt.Fprintf(script, "%v='%v'\n", key, strings.ReplaceAll(variables[key], "'", `'\''`))
+	}
+
+	path := filepath.Join(dir, "environment")
+	if err := os.WriteFile(path, []byte(script.String()), 0600); err != nil {
+		return nil, false, err
+	}
+
+	return append([]string{shell, "-c", environmentScript, path}, cmd...), true, nil
+}
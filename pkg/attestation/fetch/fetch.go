@@ -0,0 +1,372 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/wrap"
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	Name    = "fetch"
+	Type    = "https://witness.dev/attestations/fetch/v0.1"
+	RunType = attestation.PostProductRunType
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor   = &Attestor{}
+	_ attestation.Attestor   = &capturedAttestor{}
+	_ attestation.Subjecter  = &capturedAttestor{}
+	_ attestation.BackReffer = &capturedAttestor{}
+)
+
+// proxyVariables point commands at the capture proxy. Lowercase variants are set too, since curl and wget only read
+// http_proxy in lowercase.
+var proxyVariables = []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"}
+
+// bypassVariables are cleared while capturing so requests to internal hosts are recorded too. The proxy still
+// reaches those hosts directly, since it honors the bypass list it was started with.
+var bypassVariables = []string{"NO_PROXY", "no_proxy"}
+
+// caVariables point the TLS clients of common tools at a bundle that trusts the capture proxy.
+var caVariables = []string{"SSL_CERT_FILE", "CURL_CA_BUNDLE", "REQUESTS_CA_BUNDLE", "NODE_EXTRA_CA_CERTS", "GIT_SSL_CAINFO"}
+
+// systemBundles are the locations of the system certificate bundle on common distributions, as searched by Go's
+// crypto/x509.
+var systemBundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() },
+		attestation.StringSliceConfigOption(
+			"allowedHosts",
+			"Hosts the command may fetch from, such as an internal registry mirror. Requests to other hosts are blocked and recorded. Patterns may start with *. to match subdomains and end with :port to match a single port, which is 80 for http and 443 for https requests that don't name one. When empty every host is allowed.",
+			[]string{},
+			func(a attestation.Attestor, hosts []string) (attestation.Attestor, error) {
+				fetchAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a fetch attestor", a)
+				}
+
+				WithAllowedHosts(hosts)(fetchAttestor)
+				return fetchAttestor, nil
+			},
+		),
+	)
+}
+
+// Fetch is a request the command made over HTTP or HTTPS.
+type Fetch struct {
+	URL        string `json:"url"`
+	Method     string `json:"method"`
+	StatusCode int    `json:"statuscode,omitempty"`
+	// Size is the number of bytes of the response body passed on to the command.
+	Size   int64                `json:"size"`
+	Digest cryptoutil.DigestSet `json:"digest,omitempty"`
+	Error  string               `json:"error,omitempty"`
+	// Blocked is set for requests to hosts outside the allowlist, which were refused without being sent.
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+type Option func(*Attestor)
+
+// WithAllowedHosts restricts the command to fetching from hosts, blocking requests to every other host.
+func WithAllowedHosts(hosts []string) Option {
+	return func(a *Attestor) {
+		a.AllowedHosts = hosts
+	}
+}
+
+// WithRootCAs sets the certificate authorities trusted for upstream servers, which default to the system roots.
+func WithRootCAs(roots *x509.CertPool) Option {
+	return func(a *Attestor) {
+		a.roots = roots
+	}
+}
+
+// Attestor records the URLs the command fetched and the digests of what they returned, including downloads made
+// with curl, wget, or scripts that no package manager attestor sees. The command's HTTP and HTTPS requests are routed
+// through a proxy witness runs for the duration of the command, and HTTPS is intercepted with a certificate authority
+// that only exists for that run, so downloads by tools that ignore the proxy variables or pin certificates aren't
+// recorded.
+//
+// When an allowlist is set, requests to other hosts are refused with 403 Forbidden, so builds that are meant to only
+// download through a mirror fail rather than quietly reaching the internet. Requests that bypass the proxy can only be
+// blocked by the network the command runs in.
+type Attestor struct {
+	AllowedHosts []string `json:"allowedhosts,omitempty"`
+	Fetches      []Fetch  `json:"fetches"`
+
+	roots *x509.CertPool
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		Fetches: []Fetch{},
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+// Attest records nothing itself, since the fetches were captured while the command ran.
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	return nil
+}
+
+// Apply captures the fetches made while the execute attestors in attestors run, which is while the command runs.
+func (a *Attestor) Apply(attestors []attestation.Attestor) []attestation.Attestor {
+	applied := make([]attestation.Attestor, 0, len(attestors))
+	for _, attestor := range attestors {
+		if attestor.RunType() == attestation.ExecuteRunType {
+			attestor = &capturedAttestor{Forwarder: wrap.Forwarder{Attestor: attestor}, fetch: a}
+		}
+
+		applied = append(applied, attestor)
+	}
+
+	return applied
+}
+
+// capture starts the proxy, returning the variables that point a command at it, a private directory the command's
+// files can be written to, and a function that stops the proxy and removes the directory.
+func (a *Attestor) capture(ctx *attestation.AttestationContext) (map[string]string, string, func(), error) {
+	upstream := httpproxy.FromEnvironment().ProxyFunc()
+	roots := a.roots
+	if roots == nil {
+		var err error
+		if roots, err = x509.SystemCertPool(); err != nil {
+			return nil, "", nil, fmt.Errorf("failed to load system certificate authorities: %w", err)
+		}
+	}
+
+	var allow func(string) bool
+	if len(a.AllowedHosts) > 0 {
+		allow = func(host string) bool {
+			return hostAllowed(a.AllowedHosts, host)
+		}
+	}
+
+	p, err := newProxy(ctx.Hashes(), upstream, roots, allow)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to start capture proxy: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "witness-fetch")
+	if err != nil {
+		p.Close()
+		return nil, "", nil, err
+	}
+
+	bundle := filepath.Join(dir, "ca-bundle.pem")
+	if err := os.WriteFile(bundle, caBundle(p.caPEM), 0600); err != nil {
+		p.Close()
+		os.RemoveAll(dir)
+		return nil, "", nil, err
+	}
+
+	return captureVariables(p.URL(), bundle), dir, func() {
+		a.Fetches = append(a.Fetches, p.Close()...)
+		if err := os.RemoveAll(dir); err != nil {
+			log.Debugf("(attestation/fetch) failed to remove %v: %v", dir, err)
+		}
+	}, nil
+}
+
+// hostAllowed reports whether host, which may include a port, matches one of patterns. A pattern of *.example.com
+// matches the subdomains of example.com but not example.com itself, and a pattern without a port matches every port.
+// The proxy passes hosts with the default port of their scheme filled in, so example.com:443 matches HTTPS requests
+// to example.com whether or not they name the port.
+func hostAllowed(patterns []string, host string) bool {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name = host
+	}
+
+	name = normalizeHostName(name)
+	for _, pattern := range patterns {
+		patternName, patternPort, err := net.SplitHostPort(pattern)
+		if err != nil {
+			patternName, patternPort = pattern, ""
+		}
+
+		if patternPort != "" && patternPort != port {
+			continue
+		}
+
+		patternName = normalizeHostName(patternName)
+		if strings.HasPrefix(patternName, "*.") {
+			if strings.HasSuffix(name, patternName[1:]) {
+				return true
+			}
+
+			continue
+		}
+
+		if name == patternName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeHostName lowercases a host name and removes the brackets of IPv6 addresses and the trailing dot of fully
+// qualified names, so the same host is always spelled the same way.
+func normalizeHostName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.Trim(name, "[]"), "."))
+}
+
+// caBundle returns the system certificate bundle with the capture proxy's certificate authority appended, since
+// SSL_CERT_FILE and the like replace the system bundle rather than add to it.
+func caBundle(caPEM []byte) []byte {
+	paths := systemBundles
+	if existing := os.Getenv("SSL_CERT_FILE"); existing != "" {
+		paths = append([]string{existing}, paths...)
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+
+		return append(data, caPEM...)
+	}
+
+	return caPEM
+}
+
+// captureVariables are the variables that point a command at the capture proxy and bundle. The bypass variables are
+// empty, which clears them.
+func captureVariables(proxyURL, bundle string) map[string]string {
+	variables := make(map[string]string)
+	for _, key := range proxyVariables {
+		variables[key] = proxyURL
+	}
+
+	for _, key := range bypassVariables {
+		variables[key] = ""
+	}
+
+	for _, key := range caVariables {
+		variables[key] = bundle
+	}
+
+	return variables
+}
+
+// setEnv sets variables in witness's own environment, returning a function that restores it.
+func setEnv(variables map[string]string) func() {
+	previous := make(map[string]*string)
+	for key, value := range variables {
+		if old, ok := os.LookupEnv(key); ok {
+			previous[key] = &old
+		} else {
+			previous[key] = nil
+		}
+
+		if value == "" {
+			os.Unsetenv(key)
+		} else {
+			os.Setenv(key, value)
+		}
+	}
+
+	return func() {
+		for key, value := range previous {
+			if value == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *value)
+			}
+		}
+	}
+}
+
+// capturedAttestor captures the fetches made while the wrapped attestor runs.
+type capturedAttestor struct {
+	wrap.Forwarder
+	fetch *Attestor
+}
+
+// Attest runs the wrapped attestor with the command pointed at the capture proxy. The command run attestor starts
+// the command with witness's own environment, so the command is started through a shell that adds the capture
+// variables, and is recorded as it was given. On Windows, and for other attestors, the variables are set for the
+// whole witness process while the attestor runs, so callers that record steps concurrently must not start other
+// commands until it finishes.
+func (a *capturedAttestor) Attest(ctx *attestation.AttestationContext) error {
+	variables, dir, stop, err := a.fetch.capture(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer stop()
+	if run, ok := wrap.Unwrap(a.Attestor).(*commandrun.CommandRun); ok {
+		cmd, ok, err := withEnvironment(run.Cmd, variables, dir)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			original := run.Cmd
+			run.Cmd = cmd
+			defer func() { run.Cmd = original }()
+			return a.Attestor.Attest(ctx)
+		}
+	}
+
+	restore := setEnv(variables)
+	defer restore()
+	return a.Attestor.Attest(ctx)
+}
@@ -0,0 +1,488 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+)
+
+// hopHeaders apply to a single connection and aren't forwarded by the proxy.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// proxyUser is the user name of the credential commands authenticate to the proxy with.
+const proxyUser = "witness"
+
+// proxy is a forward proxy that records every request made through it. HTTPS requests are intercepted with
+// certificates issued by a certificate authority that only exists for the lifetime of the proxy, so the content of
+// downloads can be hashed. Requests must carry a credential generated for the proxy, so other processes on the
+// machine can't send requests through it.
+type proxy struct {
+	listener   net.Listener
+	credential string
+	server     *http.Server
+	transport  *http.Transport
+	hashes     []crypto.Hash
+	// allow reports whether requests to a host, which always includes a port, may be sent. Every host is allowed
+	// when it is nil.
+	allow func(host string) bool
+
+	ca    *x509.Certificate
+	caKey *ecdsa.PrivateKey
+	// caPEM is the certificate commands must trust for intercepted connections to succeed.
+	caPEM []byte
+
+	mu      sync.Mutex
+	certs   map[string]*tls.Certificate
+	fetches []Fetch
+}
+
+func newProxy(hashes []crypto.Hash, upstream func(*url.URL) (*url.URL, error), roots *x509.CertPool, allow func(string) bool) (*proxy, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "witness fetch capture"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	credential := make([]byte, 16)
+	if _, err := rand.Read(credential); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &proxy{
+		listener:   listener,
+		credential: hex.EncodeToString(credential),
+		transport: &http.Transport{
+			Proxy: func(r *http.Request) (*url.URL, error) {
+				return upstream(r.URL)
+			},
+			TLSClientConfig:       &tls.Config{RootCAs: roots},
+			DisableCompression:    true,
+			MaxIdleConns:          16,
+			IdleConnTimeout:       30 * time.Second,
+			TLSHandshakeTimeout:   30 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		hashes: hashes,
+		allow:  allow,
+		ca:     ca,
+		caKey:  caKey,
+		caPEM:  caPEM,
+		certs:  make(map[string]*tls.Certificate),
+	}
+
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: 30 * time.Second}
+	go func() {
+		if err := p.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Warnf("(attestation/fetch) capture proxy stopped: %v", err)
+		}
+	}()
+
+	return p, nil
+}
+
+// URL is the address commands are pointed at through HTTP_PROXY and HTTPS_PROXY, including the proxy's credential.
+func (p *proxy) URL() string {
+	u := url.URL{Scheme: "http", User: url.UserPassword(proxyUser, p.credential), Host: p.listener.Addr().String()}
+	return u.String()
+}
+
+// authorized reports whether r carries the proxy's credential. Requests sent through an intercepted connection are
+// authorized by the CONNECT request that opened it.
+func (p *proxy) authorized(r *http.Request) bool {
+	scheme, encoded, ok := strings.Cut(r.Header.Get("Proxy-Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(decoded, []byte(proxyUser+":"+p.credential)) == 1
+}
+
+// Close stops the proxy and returns the fetches made through it. Intercepted HTTPS connections are hijacked, so they
+// aren't tracked by the server and are closed when the command that opened them exits.
+func (p *proxy) Close() []Fetch {
+	if err := p.server.Close(); err != nil {
+		log.Debugf("(attestation/fetch) failed to close capture proxy: %v", err)
+	}
+
+	p.transport.CloseIdleConnections()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fetches := p.fetches
+	p.fetches = nil
+	return fetches
+}
+
+// defaultPorts are the ports requests are sent to when their host doesn't name one.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// requestHost returns the host a proxy request is sent to, with the default port of its scheme if it doesn't name
+// one. CONNECT requests always name a port and plain HTTP requests rarely do, so both are matched against the allowlist
+// in the same form.
+func requestHost(r *http.Request) string {
+	if _, _, err := net.SplitHostPort(r.Host); err == nil {
+		return r.Host
+	}
+
+	scheme := r.URL.Scheme
+	if r.Method == http.MethodConnect {
+		scheme = "https"
+	}
+
+	port, ok := defaultPorts[strings.ToLower(scheme)]
+	if !ok {
+		return r.Host
+	}
+
+	return net.JoinHostPort(strings.Trim(r.Host, "[]"), port)
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect && !r.URL.IsAbs() {
+		http.Error(w, "witness fetch capture only serves proxy requests", http.StatusBadRequest)
+		return
+	}
+
+	// requests from other processes aren't the command's, so they are refused without being recorded
+	if !p.authorized(r) {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="witness fetch capture"`)
+		http.Error(w, "witness fetch capture requires the credential given to the command", http.StatusProxyAuthRequired)
+		return
+	}
+
+	// HTTPS requests are blocked when the tunnel is asked for, since every request sent through it goes to the
+	// same host
+	if p.allow != nil && !p.allow(requestHost(r)) {
+		u := &url.URL{Scheme: r.URL.Scheme, Host: r.Host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+		if r.Method == http.MethodConnect {
+			u = &url.URL{Scheme: "https", Host: r.Host}
+		}
+
+		p.record(Fetch{URL: redactURL(u), Method: r.Method, StatusCode: http.StatusForbidden, Blocked: true})
+		log.Warnf("(attestation/fetch) blocked request to %v, which isn't an allowed host", r.Host)
+		http.Error(w, fmt.Sprintf("witness blocked the request to %v, which isn't an allowed host", r.Host), http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.intercept(w, r)
+		return
+	}
+
+	resp, err := p.roundTrip(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	defer resp.Body.Close()
+	removeHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	body := p.hashBody(r, resp)
+	_, err = io.Copy(w, body)
+	body.finish(err)
+}
+
+// intercept terminates the TLS connection a CONNECT request asks for and forwards each request sent over it.
+func (p *proxy) intercept(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection can't be intercepted", http.StatusInternalServerError)
+		return
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		log.Debugf("(attestation/fetch) failed to hijack connection to %v: %v", r.Host, err)
+		return
+	}
+
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+
+	host := r.Host
+	tlsConn := tls.Server(conn, &tls.Config{
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name, _, _ = net.SplitHostPort(host)
+			}
+
+			return p.certificate(name)
+		},
+	})
+
+	defer tlsConn.Close()
+	reader := bufio.NewReader(tlsConn)
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Debugf("(attestation/fetch) failed to read request sent to %v: %v", host, err)
+			}
+
+			return
+		}
+
+		req.URL.Scheme = "https"
+		req.URL.Host = host
+		if !p.forward(tlsConn, req) || req.Close {
+			return
+		}
+	}
+}
+
+// forward sends a request read from an intercepted connection upstream and writes the response back to it,
+// returning whether the connection can be reused.
+func (p *proxy) forward(conn net.Conn, r *http.Request) bool {
+	resp, err := p.roundTrip(r)
+	if err != nil {
+		resp = &http.Response{
+			StatusCode: http.StatusBadGateway,
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+			Body:       io.NopCloser(strings.NewReader(err.Error())),
+			Close:      true,
+		}
+
+		_ = resp.Write(conn)
+		return false
+	}
+
+	defer resp.Body.Close()
+	removeHopHeaders(resp.Header)
+	body := p.hashBody(r, resp)
+	resp.Body = body
+	err = resp.Write(conn)
+	body.finish(err)
+	return err == nil && !resp.Close
+}
+
+func (p *proxy) roundTrip(r *http.Request) (*http.Response, error) {
+	outbound := r.Clone(r.Context())
+	outbound.RequestURI = ""
+	outbound.Close = false
+	removeHopHeaders(outbound.Header)
+	resp, err := p.transport.RoundTrip(outbound)
+	if err != nil {
+		p.record(Fetch{URL: redactURL(r.URL), Method: r.Method, Error: err.Error()})
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (p *proxy) record(fetch Fetch) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fetches = append(p.fetches, fetch)
+}
+
+// hashBody wraps the body of a response so its digest is recorded once it has been passed on.
+func (p *proxy) hashBody(r *http.Request, resp *http.Response) *hashingBody {
+	pr, pw := io.Pipe()
+	body := &hashingBody{
+		ReadCloser: resp.Body,
+		proxy:      p,
+		fetch:      Fetch{URL: redactURL(r.URL), Method: r.Method, StatusCode: resp.StatusCode},
+		pipe:       pw,
+		digest:     make(chan digestResult, 1),
+	}
+
+	go func() {
+		digest, err := cryptoutil.CalculateDigestSet(pr, p.hashes)
+		_ = pr.CloseWithError(err)
+		body.digest <- digestResult{digest, err}
+	}()
+
+	return body
+}
+
+type digestResult struct {
+	digest cryptoutil.DigestSet
+	err    error
+}
+
+type hashingBody struct {
+	io.ReadCloser
+	proxy  *proxy
+	fetch  Fetch
+	pipe   *io.PipeWriter
+	digest chan digestResult
+}
+
+func (b *hashingBody) Read(data []byte) (int, error) {
+	n, err := b.ReadCloser.Read(data)
+	if n > 0 {
+		b.fetch.Size += int64(n)
+		if _, werr := b.pipe.Write(data[:n]); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
+
+// finish records the fetch. A download that wasn't passed on in full is recorded with the error instead of a digest,
+// since the command didn't receive the content the digest would describe.
+func (b *hashingBody) finish(err error) {
+	_ = b.pipe.Close()
+	result := <-b.digest
+	switch {
+	case err != nil:
+		b.fetch.Error = err.Error()
+	case result.err != nil:
+		b.fetch.Error = result.err.Error()
+	default:
+		b.fetch.Digest = result.digest
+	}
+
+	b.proxy.record(b.fetch)
+}
+
+// certificate returns a certificate for host issued by the proxy's certificate authority.
+func (p *proxy) certificate(host string) (*tls.Certificate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cert, ok := p.certs[host]; ok {
+		return cert, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue certificate for %v: %w", host, err)
+	}
+
+	cert := &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	p.certs[host] = cert
+	return cert, nil
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, connectionHeader := range header.Values("Connection") {
+		for _, name := range strings.Split(connectionHeader, ",") {
+			header.Del(strings.TrimSpace(name))
+		}
+	}
+
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// redactURL removes credentials from a URL, since tokens are commonly embedded in the URLs used to download from
+// private servers.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	return redacted.String()
+}
@@ -0,0 +1,238 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firmware
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+)
+
+const (
+	Name    = "firmware"
+	Type    = "https://witness.dev/attestations/firmware/v0.1"
+	RunType = attestation.PostProductRunType
+
+	// only the beginning of an image is scanned for version strings to bound the cost on large rootfs images
+	versionScanLimit = 16 << 20
+	maxVersions      = 32
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor  = &Attestor{}
+	_ attestation.Subjecter = &Attestor{}
+
+	versionPattern = regexp.MustCompile(`(?i)(version|ver|rev|u-boot|bios)[ :=_-]*v?\d+(\.\d+)+[\w.+-]*`)
+
+	// detectors are run in order against every product, and an image may match several of them, such as a
+	// capsule that carries firmware volumes or a disk image holding a squashfs root filesystem.
+	detectors = []struct {
+		format string
+		detect detector
+	}{
+		{"uefi-capsule", detectCapsule},
+		{"uefi-fv", detectFirmwareVolumes},
+		{"gpt", detectGPT},
+		{"mbr", detectMBR},
+		{"squashfs", detectSquashfs},
+		{"ext", detectExt},
+	}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+type Image struct {
+	Digest   cryptoutil.DigestSet `json:"digest"`
+	Formats  []string             `json:"formats"`
+	Sections []Section            `json:"sections,omitempty"`
+	Versions []string             `json:"versions,omitempty"`
+}
+
+// Section is a region of a firmware image, such as a partition, firmware volume, or capsule payload.
+type Section struct {
+	Name     string               `json:"name"`
+	Type     string               `json:"type"`
+	Offset   int64                `json:"offset"`
+	Size     int64                `json:"size"`
+	Digest   cryptoutil.DigestSet `json:"digest"`
+	Metadata map[string]string    `json:"metadata,omitempty"`
+}
+
+// detector recognizes a single image format and returns the sections it describes. A false return value
+// indicates the format was not found in the image.
+type detector func(r io.ReaderAt, size int64) ([]Section, bool)
+
+type Attestor struct {
+	images map[string]Image
+	hashes []crypto.Hash
+}
+
+func New() *Attestor {
+	return &Attestor{
+		images: make(map[string]Image),
+	}
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	a.hashes = ctx.Hashes()
+	for path, product := range ctx.Products() {
+		image, err := a.inspectFile(filepath.Join(ctx.WorkingDir(), path))
+		if err != nil {
+			log.Debugf("(attestation/firmware) could not inspect product %v: %v", path, err)
+			continue
+		}
+
+		if image == nil {
+			continue
+		}
+
+		image.Digest = product.Digest
+		a.images[path] = *image
+	}
+
+	return nil
+}
+
+func (a *Attestor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.images)
+}
+
+func (a *Attestor) UnmarshalJSON(data []byte) error {
+	images := make(map[string]Image)
+	if err := json.Unmarshal(data, &images); err != nil {
+		return err
+	}
+
+	a.images = images
+	return nil
+}
+
+func (a *Attestor) Images() map[string]Image {
+	return a.images
+}
+
+// Subjects returns the digest of every section so evidence can be found by the digest of a single partition
+// or firmware volume that was extracted from, or later flashed into, a larger image.
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for imagePath, image := range a.images {
+		for _, section := range image.Sections {
+			subjects[fmt.Sprintf("file:%v!/%v", imagePath, section.Name)] = section.Digest
+		}
+	}
+
+	return subjects
+}
+
+func (a *Attestor) inspectFile(path string) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if !stat.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	return a.inspect(f, stat.Size())
+}
+
+func (a *Attestor) inspect(r io.ReaderAt, size int64) (*Image, error) {
+	image := &Image{}
+	for _, d := range detectors {
+		sections, ok := d.detect(r, size)
+		if !ok {
+			continue
+		}
+
+		image.Formats = append(image.Formats, d.format)
+		for _, section := range sections {
+			digest, err := cryptoutil.CalculateDigestSet(io.NewSectionReader(r, section.Offset, section.Size), a.hashes)
+			if err != nil {
+				return nil, err
+			}
+
+			section.Digest = digest
+			image.Sections = append(image.Sections, section)
+		}
+	}
+
+	if len(image.Formats) == 0 {
+		return nil, nil
+	}
+
+	versions, err := scanVersions(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	image.Versions = versions
+	return image, nil
+}
+
+// scanVersions looks for printable strings that look like embedded version identifiers.
+func scanVersions(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, versionScanLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	versions := make([]string, 0)
+	for _, match := range versionPattern.FindAll(data, -1) {
+		version := string(match)
+		if _, ok := seen[version]; ok {
+			continue
+		}
+
+		seen[version] = struct{}{}
+		versions = append(versions, version)
+		if len(versions) >= maxVersions {
+			break
+		}
+	}
+
+	return versions, nil
+}
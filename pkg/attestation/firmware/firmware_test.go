@@ -0,0 +1,97 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firmware
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func firmwareVolume(length int) []byte {
+	fv := make([]byte, length)
+	binary.LittleEndian.PutUint64(fv[32:], uint64(length))
+	copy(fv[40:], fvSignature)
+	binary.LittleEndian.PutUint16(fv[48:], fvHeaderSize)
+	fv[55] = 2
+	binary.LittleEndian.PutUint16(fv[50:], -checksum16(fv[:fvHeaderSize]))
+	copy(fv[fvHeaderSize:], "U-Boot 2023.01-rc2")
+	return fv
+}
+
+func TestInspectCapsule(t *testing.T) {
+	payload := append(firmwareVolume(256), firmwareVolume(128)...)
+	capsule := make([]byte, capsuleHeaderSize)
+	binary.LittleEndian.PutUint32(capsule[16:], capsuleHeaderSize)
+	binary.LittleEndian.PutUint32(capsule[24:], uint32(capsuleHeaderSize+len(payload)))
+	capsule = append(capsule, payload...)
+
+	a := New()
+	a.hashes = []crypto.Hash{crypto.SHA256}
+	image, err := a.inspect(bytes.NewReader(capsule), int64(len(capsule)))
+	require.NoError(t, err)
+	require.NotNil(t, image)
+	require.Equal(t, []string{"uefi-capsule", "uefi-fv"}, image.Formats)
+	require.Len(t, image.Sections, 3)
+	require.Equal(t, int64(len(payload)), image.Sections[0].Size)
+	require.Equal(t, "fv@0x1c", image.Sections[1].Name)
+	require.Equal(t, int64(256), image.Sections[1].Size)
+	require.Equal(t, "fv@0x11c", image.Sections[2].Name)
+	require.Equal(t, []string{"U-Boot 2023.01-rc2"}, image.Versions)
+}
+
+func TestInspectCorruptFirmwareVolume(t *testing.T) {
+	fv := firmwareVolume(256)
+	fv[50]++
+	image, err := New().inspect(bytes.NewReader(fv), int64(len(fv)))
+	require.NoError(t, err)
+	require.Nil(t, image)
+}
+
+func TestInspectMBR(t *testing.T) {
+	disk := make([]byte, 4096)
+	entry := disk[mbrPartitionOffset:]
+	entry[0] = 0x80
+	entry[4] = 0x83
+	binary.LittleEndian.PutUint32(entry[8:], 2)
+	binary.LittleEndian.PutUint32(entry[12:], 4)
+	disk[510], disk[511] = 0x55, 0xaa
+
+	a := New()
+	a.hashes = []crypto.Hash{crypto.SHA256}
+	image, err := a.inspect(bytes.NewReader(disk), int64(len(disk)))
+	require.NoError(t, err)
+	require.Equal(t, []string{"mbr"}, image.Formats)
+	require.Len(t, image.Sections, 1)
+	require.Equal(t, "mbr/1", image.Sections[0].Name)
+	require.Equal(t, int64(1024), image.Sections[0].Offset)
+	require.Equal(t, int64(2048), image.Sections[0].Size)
+	require.Equal(t, "true", image.Sections[0].Metadata["bootable"])
+}
+
+func TestInspectUnrecognized(t *testing.T) {
+	data := []byte("just some text with version 1.2.3 in it")
+	image, err := New().inspect(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	require.Nil(t, image)
+}
+
+func TestFormatGUID(t *testing.T) {
+	guid := []byte{0x28, 0x73, 0x2a, 0xc1, 0x1f, 0xf8, 0xd2, 0x11, 0xba, 0x4b, 0x00, 0xa0, 0xc9, 0x3e, 0xc9, 0x3b}
+	require.Equal(t, "c12a7328-f81f-11d2-ba4b-00a0c93ec93b", formatGUID(guid))
+}
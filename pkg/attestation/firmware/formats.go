@@ -0,0 +1,361 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firmware
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	capsuleHeaderSize    = 28
+	fvHeaderSize         = 56
+	fvSignatureOffset    = 40
+	gptHeaderSize        = 92
+	maxGPTEntries        = 1024
+	mbrPartitionOffset   = 446
+	mbrProtectiveType    = 0xee
+	extSuperblockOffset  = 1024
+	extMagic             = 0xef53
+	ext64BitFeature      = 0x80
+	fvScanChunkSize      = 1 << 20
+	maxCapsuleHeaderSize = 4096
+)
+
+var (
+	fvSignature       = []byte("_FVH")
+	gptSignature      = []byte("EFI PART")
+	squashfsMagic     = []byte("hsqs")
+	squashCompression = map[uint16]string{1: "gzip", 2: "lzma", 3: "lzo", 4: "xz", 5: "lz4", 6: "zstd"}
+)
+
+// detectCapsule recognizes a UEFI capsule by its EFI_CAPSULE_HEADER. Capsule GUIDs are vendor defined, so the
+// header is only accepted when its recorded image size matches the size of the file.
+func detectCapsule(r io.ReaderAt, size int64) ([]Section, bool) {
+	header, ok := readAt(r, 0, capsuleHeaderSize)
+	if !ok {
+		return nil, false
+	}
+
+	headerSize := int64(binary.LittleEndian.Uint32(header[16:]))
+	flags := binary.LittleEndian.Uint32(header[20:])
+	imageSize := int64(binary.LittleEndian.Uint32(header[24:]))
+	if imageSize != size || headerSize < capsuleHeaderSize || headerSize > maxCapsuleHeaderSize || headerSize >= imageSize {
+		return nil, false
+	}
+
+	return []Section{{
+		Name:   "capsule",
+		Type:   "capsule-payload",
+		Offset: headerSize,
+		Size:   imageSize - headerSize,
+		Metadata: map[string]string{
+			"guid":  formatGUID(header[:16]),
+			"flags": fmt.Sprintf("0x%08x", flags),
+		},
+	}}, true
+}
+
+// detectFirmwareVolumes searches the image for UEFI firmware volume headers. Flash images and capsule payloads
+// usually contain several volumes, and each one is only accepted if its header checksum is valid.
+func detectFirmwareVolumes(r io.ReaderAt, size int64) ([]Section, bool) {
+	sections := make([]Section, 0)
+	for pos := int64(0); pos < size; {
+		sigOffset, ok := find(r, pos, size, fvSignature)
+		if !ok {
+			break
+		}
+
+		start := sigOffset - fvSignatureOffset
+		pos = sigOffset + 1
+		if start < 0 {
+			continue
+		}
+
+		header, ok := readAt(r, start, fvHeaderSize)
+		if !ok {
+			break
+		}
+
+		fvLength := int64(binary.LittleEndian.Uint64(header[32:]))
+		headerLength := int64(binary.LittleEndian.Uint16(header[48:]))
+		if headerLength < fvHeaderSize || headerLength%2 != 0 || fvLength < headerLength || start+fvLength > size {
+			continue
+		}
+
+		fullHeader, ok := readAt(r, start, headerLength)
+		if !ok || checksum16(fullHeader) != 0 {
+			continue
+		}
+
+		sections = append(sections, Section{
+			Name:   fmt.Sprintf("fv@0x%x", start),
+			Type:   "firmware-volume",
+			Offset: start,
+			Size:   fvLength,
+			Metadata: map[string]string{
+				"filesystem": formatGUID(header[16:32]),
+				"revision":   fmt.Sprintf("%d", header[55]),
+			},
+		})
+
+		pos = start + fvLength
+	}
+
+	return sections, len(sections) > 0
+}
+
+// detectGPT parses a GUID partition table, trying both 512 byte and 4096 byte logical sectors.
+func detectGPT(r io.ReaderAt, size int64) ([]Section, bool) {
+	for _, sectorSize := range []int64{512, 4096} {
+		header, ok := readAt(r, sectorSize, gptHeaderSize)
+		if !ok || !bytes.Equal(header[:8], gptSignature) {
+			continue
+		}
+
+		entriesLBA := int64(binary.LittleEndian.Uint64(header[72:]))
+		entryCount := int64(binary.LittleEndian.Uint32(header[80:]))
+		entrySize := int64(binary.LittleEndian.Uint32(header[84:]))
+		if entryCount > maxGPTEntries || entrySize < 128 || entrySize > sectorSize {
+			continue
+		}
+
+		entries, ok := readAt(r, entriesLBA*sectorSize, entryCount*entrySize)
+		if !ok {
+			continue
+		}
+
+		sections := make([]Section, 0)
+		for i := int64(0); i < entryCount; i++ {
+			entry := entries[i*entrySize : (i+1)*entrySize]
+			if isZero(entry[:16]) {
+				continue
+			}
+
+			firstLBA := int64(binary.LittleEndian.Uint64(entry[32:]))
+			lastLBA := int64(binary.LittleEndian.Uint64(entry[40:]))
+			offset, length := firstLBA*sectorSize, (lastLBA-firstLBA+1)*sectorSize
+			if lastLBA < firstLBA || offset+length > size {
+				continue
+			}
+
+			sections = append(sections, Section{
+				Name:   fmt.Sprintf("gpt/%d", i+1),
+				Type:   "partition",
+				Offset: offset,
+				Size:   length,
+				Metadata: map[string]string{
+					"type":  formatGUID(entry[:16]),
+					"guid":  formatGUID(entry[16:32]),
+					"label": decodeUTF16(entry[56:128]),
+				},
+			})
+		}
+
+		return sections, true
+	}
+
+	return nil, false
+}
+
+// detectMBR parses a legacy master boot record. Protective MBRs in front of a GPT are left to detectGPT.
+func detectMBR(r io.ReaderAt, size int64) ([]Section, bool) {
+	table, ok := readAt(r, mbrPartitionOffset, 66)
+	if !ok || table[64] != 0x55 || table[65] != 0xaa {
+		return nil, false
+	}
+
+	sections := make([]Section, 0)
+	for i := 0; i < 4; i++ {
+		entry := table[i*16 : (i+1)*16]
+		status, partType := entry[0], entry[4]
+		// boot sectors of unpartitioned filesystems also end in 0x55aa, but won't have valid status bytes here
+		if status != 0x00 && status != 0x80 {
+			return nil, false
+		}
+
+		if partType == mbrProtectiveType {
+			return nil, false
+		}
+
+		offset := int64(binary.LittleEndian.Uint32(entry[8:])) * 512
+		length := int64(binary.LittleEndian.Uint32(entry[12:])) * 512
+		if partType == 0 || length == 0 || offset+length > size {
+			continue
+		}
+
+		sections = append(sections, Section{
+			Name:   fmt.Sprintf("mbr/%d", i+1),
+			Type:   "partition",
+			Offset: offset,
+			Size:   length,
+			Metadata: map[string]string{
+				"type":     fmt.Sprintf("0x%02x", partType),
+				"bootable": fmt.Sprintf("%v", status == 0x80),
+			},
+		})
+	}
+
+	return sections, len(sections) > 0
+}
+
+func detectSquashfs(r io.ReaderAt, size int64) ([]Section, bool) {
+	superblock, ok := readAt(r, 0, 96)
+	if !ok || !bytes.Equal(superblock[:4], squashfsMagic) {
+		return nil, false
+	}
+
+	compression := binary.LittleEndian.Uint16(superblock[20:])
+	major := binary.LittleEndian.Uint16(superblock[28:])
+	minor := binary.LittleEndian.Uint16(superblock[30:])
+	bytesUsed := int64(binary.LittleEndian.Uint64(superblock[40:]))
+	if bytesUsed <= 0 || bytesUsed > size {
+		bytesUsed = size
+	}
+
+	compressionName, ok := squashCompression[compression]
+	if !ok {
+		compressionName = fmt.Sprintf("unknown(%d)", compression)
+	}
+
+	return []Section{{
+		Name:   "squashfs",
+		Type:   "filesystem",
+		Offset: 0,
+		Size:   bytesUsed,
+		Metadata: map[string]string{
+			"version":     fmt.Sprintf("%d.%d", major, minor),
+			"compression": compressionName,
+		},
+	}}, true
+}
+
+func detectExt(r io.ReaderAt, size int64) ([]Section, bool) {
+	superblock, ok := readAt(r, extSuperblockOffset, 1024)
+	if !ok || binary.LittleEndian.Uint16(superblock[56:]) != extMagic {
+		return nil, false
+	}
+
+	blocks := int64(binary.LittleEndian.Uint32(superblock[4:]))
+	if binary.LittleEndian.Uint32(superblock[96:])&ext64BitFeature != 0 {
+		blocks |= int64(binary.LittleEndian.Uint32(superblock[0x150:])) << 32
+	}
+
+	logBlockSize := binary.LittleEndian.Uint32(superblock[24:])
+	if logBlockSize > 6 {
+		return nil, false
+	}
+
+	length := blocks * (1024 << logBlockSize)
+	if length <= 0 || length > size {
+		length = size
+	}
+
+	uuid := superblock[104:120]
+	return []Section{{
+		Name:   "ext",
+		Type:   "filesystem",
+		Offset: 0,
+		Size:   length,
+		Metadata: map[string]string{
+			"uuid":  fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16]),
+			"label": strings.TrimRight(string(superblock[120:136]), "\x00"),
+		},
+	}}, true
+}
+
+func readAt(r io.ReaderAt, offset, n int64) ([]byte, bool) {
+	if offset < 0 || n < 0 {
+		return nil, false
+	}
+
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, offset); err != nil {
+		return nil, false
+	}
+
+	return buf, true
+}
+
+// find returns the offset of the first occurrence of pattern at or after start, reading the image in chunks
+// so large images don't need to be held in memory.
+func find(r io.ReaderAt, start, size int64, pattern []byte) (int64, bool) {
+	overlap := int64(len(pattern) - 1)
+	buf := make([]byte, fvScanChunkSize)
+	for pos := start; pos < size; pos += fvScanChunkSize - overlap {
+		n, err := r.ReadAt(buf, pos)
+		if err != nil && err != io.EOF {
+			return 0, false
+		}
+
+		if idx := bytes.Index(buf[:n], pattern); idx >= 0 {
+			return pos + int64(idx), true
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return 0, false
+}
+
+func checksum16(data []byte) uint16 {
+	var sum uint16
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += binary.LittleEndian.Uint16(data[i:])
+	}
+
+	return sum
+}
+
+// formatGUID formats a GUID in the mixed endian layout used by UEFI, where the first three fields are little endian.
+func formatGUID(b []byte) string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10],
+		b[10:16],
+	)
+}
+
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		unit := binary.LittleEndian.Uint16(b[i:])
+		if unit == 0 {
+			break
+		}
+
+		units = append(units, unit)
+	}
+
+	return string(utf16.Decode(units))
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+
+	return true
+}
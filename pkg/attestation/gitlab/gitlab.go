@@ -0,0 +1,329 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gitlab records the GitLab CI/CD job a step ran in. The job's ID token is verified against the JWKS of the
+// GitLab instance the operator configured, and the project, pipeline, job, and runner it claims are checked against
+// the job's environment. The other fields are read from the environment as they are, so policies that need to trust
+// where a step ran should check the token's claims.
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	basegitlab "github.com/testifysec/go-witness/attestation/gitlab"
+	"github.com/testifysec/go-witness/attestation/jwt"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/oidc"
+)
+
+const (
+	Name    = basegitlab.Name
+	Type    = basegitlab.Type
+	RunType = basegitlab.RunType
+
+	// DefaultTokenEnv is the variable the job's ID token is read from when none is configured. Jobs declare it with
+	// id_tokens in .gitlab-ci.yml.
+	DefaultTokenEnv = "WITNESS_ID_TOKEN"
+
+	// DefaultServerURL is the GitLab instance job tokens must be issued by when none is configured.
+	DefaultServerURL = "https://gitlab.com"
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor   = &Attestor{}
+	_ attestation.Subjecter  = &Attestor{}
+	_ attestation.BackReffer = &Attestor{}
+)
+
+// legacyTokenEnvs hold the job JWTs of GitLab versions before ID tokens, which are tried when the configured
+// variable isn't set.
+var legacyTokenEnvs = []string{"CI_JOB_JWT_V2", "CI_JOB_JWT"}
+
+// claimEnvs are the token claims checked against the variables of the job's environment.
+var claimEnvs = []struct {
+	claim string
+	env   string
+}{
+	{"project_path", "CI_PROJECT_PATH"},
+	{"pipeline_id", "CI_PIPELINE_ID"},
+	{"job_id", "CI_JOB_ID"},
+	{"runner_id", "CI_RUNNER_ID"},
+}
+
+// init replaces the go-witness gitlab attestor in the registry, which is initialized first since it is imported
+// here. Attestations keep its type and fields, so existing policies still apply.
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() },
+		attestation.StringConfigOption(
+			"tokenEnv",
+			"Variable holding the job's ID token, declared with id_tokens in .gitlab-ci.yml. CI_JOB_JWT_V2 and CI_JOB_JWT are used when it isn't set",
+			DefaultTokenEnv,
+			func(a attestation.Attestor, tokenEnv string) (attestation.Attestor, error) {
+				gitlabAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a gitlab attestor", a)
+				}
+
+				WithTokenEnv(tokenEnv)(gitlabAttestor)
+				return gitlabAttestor, nil
+			},
+		),
+		attestation.StringConfigOption(
+			"audience",
+			"Audience the job's ID token must be issued for. Any audience is accepted if empty",
+			"",
+			func(a attestation.Attestor, audience string) (attestation.Attestor, error) {
+				gitlabAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a gitlab attestor", a)
+				}
+
+				WithAudience(audience)(gitlabAttestor)
+				return gitlabAttestor, nil
+			},
+		),
+		attestation.StringConfigOption(
+			"serverUrl",
+			"URL of the GitLab instance that must have issued the job's ID token, whose JWKS the token is verified with. Set it for self-managed instances",
+			DefaultServerURL,
+			func(a attestation.Attestor, serverURL string) (attestation.Attestor, error) {
+				gitlabAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a gitlab attestor", a)
+				}
+
+				WithServerURL(serverURL)(gitlabAttestor)
+				return gitlabAttestor, nil
+			},
+		),
+	)
+}
+
+type Option func(*Attestor)
+
+// WithTokenEnv reads the job's ID token from the variable tokenEnv.
+func WithTokenEnv(tokenEnv string) Option {
+	return func(a *Attestor) {
+		a.tokenEnv = tokenEnv
+	}
+}
+
+// WithAudience requires the job's ID token to be issued for audience.
+func WithAudience(audience string) Option {
+	return func(a *Attestor) {
+		a.audience = audience
+	}
+}
+
+// WithServerURL requires the job's ID token to be issued by the GitLab instance at serverURL, and verifies it with the
+// instance's JWKS. CI_SERVER_URL is set by the job and is never trusted for either.
+func WithServerURL(serverURL string) Option {
+	return func(a *Attestor) {
+		a.serverURL = strings.TrimSuffix(serverURL, "/")
+	}
+}
+
+type Attestor struct {
+	JWT               *jwt.Attestor `json:"jwt,omitempty"`
+	CIConfigPath      string        `json:"ciconfigpath"`
+	JobID             string        `json:"jobid"`
+	JobImage          string        `json:"jobimage"`
+	JobName           string        `json:"jobname"`
+	JobStage          string        `json:"jobstage"`
+	JobUrl            string        `json:"joburl"`
+	PipelineID        string        `json:"pipelineid"`
+	PipelineUrl       string        `json:"pipelineurl"`
+	PipelineSource    string        `json:"pipelinesource,omitempty"`
+	ProjectID         string        `json:"projectid"`
+	ProjectUrl        string        `json:"projecturl"`
+	ProjectPath       string        `json:"projectpath,omitempty"`
+	RunnerID          string        `json:"runnerid"`
+	RunnerDescription string        `json:"runnerdescription,omitempty"`
+	RunnerTags        []string      `json:"runnertags,omitempty"`
+	RunnerVersion     string        `json:"runnerversion,omitempty"`
+	RunnerArch        string        `json:"runnerarch,omitempty"`
+	CIHost            string        `json:"cihost"`
+	CIServerUrl       string        `json:"ciserverurl"`
+
+	tokenEnv  string
+	audience  string
+	serverURL string
+	subjects  map[string]cryptoutil.DigestSet
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		tokenEnv:  DefaultTokenEnv,
+		serverURL: DefaultServerURL,
+		subjects:  make(map[string]cryptoutil.DigestSet),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	if os.Getenv("GITLAB_CI") != "true" {
+		return basegitlab.ErrNotGitlab{}
+	}
+
+	if serverURL := strings.TrimSuffix(os.Getenv("CI_SERVER_URL"), "/"); serverURL != a.serverURL {
+		return fmt.Errorf("job ran on gitlab instance %v, not %v. Set --gitlab-serverUrl for self-managed instances", serverURL, a.serverURL)
+	}
+
+	a.CIServerUrl = a.serverURL
+	a.CIConfigPath = os.Getenv("CI_CONFIG_PATH")
+	a.JobID = os.Getenv("CI_JOB_ID")
+	a.JobImage = os.Getenv("CI_JOB_IMAGE")
+	a.JobName = os.Getenv("CI_JOB_NAME")
+	a.JobStage = os.Getenv("CI_JOB_STAGE")
+	a.JobUrl = os.Getenv("CI_JOB_URL")
+	a.PipelineID = os.Getenv("CI_PIPELINE_ID")
+	a.PipelineUrl = os.Getenv("CI_PIPELINE_URL")
+	a.PipelineSource = os.Getenv("CI_PIPELINE_SOURCE")
+	a.ProjectID = os.Getenv("CI_PROJECT_ID")
+	a.ProjectUrl = os.Getenv("CI_PROJECT_URL")
+	a.ProjectPath = os.Getenv("CI_PROJECT_PATH")
+	a.RunnerID = os.Getenv("CI_RUNNER_ID")
+	a.RunnerDescription = os.Getenv("CI_RUNNER_DESCRIPTION")
+	a.RunnerTags = parseRunnerTags(os.Getenv("CI_RUNNER_TAGS"))
+	a.RunnerVersion = os.Getenv("CI_RUNNER_VERSION")
+	a.RunnerArch = os.Getenv("CI_RUNNER_EXECUTABLE_ARCH")
+	a.CIHost = os.Getenv("CI_SERVER_HOST")
+
+	if token := a.token(); token != "" {
+		a.JWT = jwt.New(jwt.WithToken(token), jwt.WithJWKSUrl(fmt.Sprintf("%s/-/jwks", a.serverURL)))
+		if err := a.JWT.Attest(ctx); err != nil {
+			return fmt.Errorf("failed to verify gitlab job token: %w", err)
+		}
+
+		if err := a.checkClaims(); err != nil {
+			return err
+		}
+	} else {
+		log.Warnf("No gitlab job token is set in %v, the job can't be verified. Declare it with id_tokens in .gitlab-ci.yml", a.tokenEnv)
+	}
+
+	subjects := []struct{ kind, value string }{
+		{"pipelineurl", a.PipelineUrl},
+		{"joburl", a.JobUrl},
+		{"projecturl", a.ProjectUrl},
+	}
+
+	if a.ProjectPath != "" {
+		subjects = append(subjects, struct{ kind, value string }{"projectpath", a.ProjectPath})
+	}
+
+	for _, subject := range subjects {
+		digestSet, err := cryptoutil.CalculateDigestSetFromBytes([]byte(subject.value), ctx.Hashes())
+		if err != nil {
+			return err
+		}
+
+		a.subjects[fmt.Sprintf("%v:%v", subject.kind, subject.value)] = digestSet
+	}
+
+	return nil
+}
+
+// token returns the job's ID token, or its legacy JWT.
+func (a *Attestor) token() string {
+	for _, env := range append([]string{a.tokenEnv}, legacyTokenEnvs...) {
+		if env == "" {
+			continue
+		}
+
+		if token := os.Getenv(env); token != "" {
+			return token
+		}
+	}
+
+	return ""
+}
+
+// checkClaims checks that the verified token was issued by the configured instance, for this job, and hasn't
+// expired. The job's variables are only trusted if they match the claims.
+func (a *Attestor) checkClaims() error {
+	if err := oidc.CheckClaims(a.JWT, "gitlab job token", a.serverURL, a.audience); err != nil {
+		return err
+	}
+
+	claims := a.JWT.Claims
+	for _, c := range claimEnvs {
+		value, ok := claims[c.claim]
+		if !ok {
+			continue
+		}
+
+		if claim, env := fmt.Sprint(value), os.Getenv(c.env); claim != env {
+			return fmt.Errorf("gitlab job token claims %v %v, but %v is %v", c.claim, claim, c.env, env)
+		}
+	}
+
+	return nil
+}
+
+// parseRunnerTags parses CI_RUNNER_TAGS, which is a JSON array in current versions of GitLab and comma separated in
+// older ones.
+func parseRunnerTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+
+	parsed := []string{}
+	if err := json.Unmarshal([]byte(tags), &parsed); err == nil {
+		return parsed
+	}
+
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			parsed = append(parsed, tag)
+		}
+	}
+
+	return parsed
+}
+
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	return a.subjects
+}
+
+func (a *Attestor) BackRefs() map[string]cryptoutil.DigestSet {
+	backRefs := make(map[string]cryptoutil.DigestSet)
+	pipelineUrl := fmt.Sprintf("pipelineurl:%v", a.PipelineUrl)
+	backRefs[pipelineUrl] = a.subjects[pipelineUrl]
+	return backRefs
+}
@@ -0,0 +1,218 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitlab
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+)
+
+// fakeGitLab serves the JWKS of an instance and signs job tokens with its key.
+type fakeGitLab struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newFakeGitLab(t *testing.T) *fakeGitLab {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	f := &fakeGitLab{key: key}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/-/jwks" {
+			http.NotFound(w, r)
+			return
+		}
+
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "gitlab",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}}))
+	}))
+
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeGitLab) token(t *testing.T, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "gitlab", "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (f *fakeGitLab) claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":          f.URL,
+		"aud":          "witness",
+		"exp":          time.Now().Add(time.Hour).Unix(),
+		"project_path": "group/app",
+		"pipeline_id":  "1001",
+		"job_id":       "2002",
+		"runner_id":    3003,
+	}
+}
+
+// claimsWith returns the claims of a token for the job with claim replaced by value.
+func (f *fakeGitLab) claimsWith(claim string, value interface{}) map[string]interface{} {
+	claims := f.claims()
+	claims[claim] = value
+	return claims
+}
+
+func setJobEnv(t *testing.T, serverURL string) {
+	for env, value := range map[string]string{
+		"GITLAB_CI":                 "true",
+		"CI_SERVER_URL":             serverURL,
+		"CI_PROJECT_PATH":           "group/app",
+		"CI_PROJECT_URL":            serverURL + "/group/app",
+		"CI_PIPELINE_ID":            "1001",
+		"CI_PIPELINE_URL":           serverURL + "/group/app/-/pipelines/1001",
+		"CI_JOB_ID":                 "2002",
+		"CI_JOB_URL":                serverURL + "/group/app/-/jobs/2002",
+		"CI_RUNNER_ID":              "3003",
+		"CI_RUNNER_DESCRIPTION":     "shared-runner-1",
+		"CI_RUNNER_TAGS":            `["docker", "linux"]`,
+		"CI_RUNNER_VERSION":         "16.5.0",
+		"CI_RUNNER_EXECUTABLE_ARCH": "linux/amd64",
+		"CI_JOB_JWT_V2":             "",
+		"CI_JOB_JWT":                "",
+	} {
+		t.Setenv(env, value)
+	}
+}
+
+func attest(t *testing.T, a *Attestor) error {
+	ctx, err := attestation.NewContext([]attestation.Attestor{a})
+	require.NoError(t, err)
+	return ctx.RunAttestors()
+}
+
+func TestAttest(t *testing.T) {
+	gitlab := newFakeGitLab(t)
+	setJobEnv(t, gitlab.URL)
+	t.Setenv(DefaultTokenEnv, gitlab.token(t, gitlab.claims()))
+
+	a := New(WithAudience("witness"), WithServerURL(gitlab.URL+"/"))
+	require.NoError(t, attest(t, a))
+	require.Equal(t, gitlab.URL, a.CIServerUrl)
+	require.Equal(t, "group/app", a.ProjectPath)
+	require.Equal(t, "1001", a.PipelineID)
+	require.Equal(t, "2002", a.JobID)
+	require.Equal(t, "shared-runner-1", a.RunnerDescription)
+	require.Equal(t, []string{"docker", "linux"}, a.RunnerTags)
+	require.Equal(t, "16.5.0", a.RunnerVersion)
+	require.Equal(t, gitlab.URL+"/-/jwks", a.JWT.VerifiedBy.JWKSUrl)
+	require.Equal(t, "group/app", a.JWT.Claims["project_path"])
+	require.Contains(t, a.Subjects(), "projectpath:group/app")
+	require.Contains(t, a.BackRefs(), "pipelineurl:"+gitlab.URL+"/group/app/-/pipelines/1001")
+
+	// the legacy job JWT is used without an ID token
+	t.Setenv(DefaultTokenEnv, "")
+	t.Setenv("CI_JOB_JWT_V2", gitlab.token(t, gitlab.claims()))
+	a = New(WithServerURL(gitlab.URL))
+	require.NoError(t, attest(t, a))
+	require.NotNil(t, a.JWT)
+}
+
+func TestAttestPinsServer(t *testing.T) {
+	gitlab := newFakeGitLab(t)
+	attacker := newFakeGitLab(t)
+
+	// a job that points CI_SERVER_URL at another server can't have its tokens verified with that server's keys
+	setJobEnv(t, attacker.URL)
+	t.Setenv(DefaultTokenEnv, attacker.token(t, attacker.claims()))
+	require.ErrorContains(t, attest(t, New(WithServerURL(gitlab.URL))), "not "+gitlab.URL)
+
+	// tokens must be issued by gitlab.com unless another instance is configured
+	require.ErrorContains(t, attest(t, New()), "not "+DefaultServerURL)
+
+	setJobEnv(t, gitlab.URL)
+	t.Setenv(DefaultTokenEnv, attacker.token(t, attacker.claims()))
+	require.ErrorContains(t, attest(t, New(WithServerURL(gitlab.URL))), "failed to verify gitlab job token")
+}
+
+func TestAttestRejectsTokens(t *testing.T) {
+	gitlab := newFakeGitLab(t)
+	setJobEnv(t, gitlab.URL)
+	other := newFakeGitLab(t)
+
+	for name, test := range map[string]struct {
+		token   string
+		message string
+	}{
+		"another project": {
+			token:   gitlab.token(t, gitlab.claimsWith("project_path", "group/other")),
+			message: "claims project_path group/other, but CI_PROJECT_PATH is group/app",
+		},
+		"expired": {
+			token:   gitlab.token(t, gitlab.claimsWith("exp", time.Now().Add(-time.Hour).Unix())),
+			message: "expired",
+		},
+		"another audience": {
+			token:   gitlab.token(t, gitlab.claimsWith("aud", "sigstore")),
+			message: "not issued for audience witness",
+		},
+		"another issuer": {
+			token:   gitlab.token(t, gitlab.claimsWith("iss", "https://gitlab.example.com")),
+			message: "issued by https://gitlab.example.com",
+		},
+		"another instance's key": {
+			token:   other.token(t, gitlab.claims()),
+			message: "failed to verify gitlab job token",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(DefaultTokenEnv, test.token)
+			require.ErrorContains(t, attest(t, New(WithAudience("witness"), WithServerURL(gitlab.URL))), test.message)
+		})
+	}
+}
+
+func TestRegistered(t *testing.T) {
+	for _, nameOrType := range []string{Name, Type} {
+		attestors, err := attestation.Attestors([]string{nameOrType})
+		require.NoError(t, err)
+		require.IsType(t, &Attestor{}, attestors[0])
+		require.Equal(t, DefaultTokenEnv, attestors[0].(*Attestor).tokenEnv)
+		require.Equal(t, DefaultServerURL, attestors[0].(*Attestor).serverURL)
+	}
+}
+
+func TestParseRunnerTags(t *testing.T) {
+	require.Equal(t, []string{"docker", "linux"}, parseRunnerTags(`["docker", "linux"]`))
+	require.Equal(t, []string{"docker", "linux"}, parseRunnerTags("docker, linux"))
+	require.Nil(t, parseRunnerTags(""))
+}
@@ -0,0 +1,339 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobuild
+
+import (
+	"bufio"
+	"debug/buildinfo"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/git"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/schedule"
+)
+
+const (
+	Name    = "gobuild"
+	Type    = "https://witness.dev/attestations/gobuild/v0.1"
+	RunType = attestation.PostProductRunType
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor = &Attestor{}
+)
+
+func init() {
+	schedule.RegisterDependencies(Name, git.Name)
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Module is a module a binary was built from, as recorded in its buildinfo.
+type Module struct {
+	Path    string  `json:"path"`
+	Version string  `json:"version,omitempty"`
+	Sum     string  `json:"sum,omitempty"`
+	Replace *Module `json:"replace,omitempty"`
+}
+
+// VCS is the revision of the repository the binary was built from, as stamped by the go command.
+type VCS struct {
+	System   string `json:"system"`
+	Revision string `json:"revision,omitempty"`
+	Time     string `json:"time,omitempty"`
+	Modified bool   `json:"modified"`
+}
+
+// Binary is the buildinfo of a Go binary the step produced.
+type Binary struct {
+	Digest    cryptoutil.DigestSet `json:"digest"`
+	GoVersion string               `json:"goversion"`
+	// Package is the path of the main package.
+	Package  string            `json:"package"`
+	Main     Module            `json:"main"`
+	Deps     []Module          `json:"deps,omitempty"`
+	Settings map[string]string `json:"settings,omitempty"`
+	VCS      *VCS              `json:"vcs,omitempty"`
+	// Mismatches are differences between the buildinfo and the git attestation or the go.mod and go.sum of the
+	// working directory, such as a binary built from a different commit than the one attested.
+	Mismatches []string `json:"mismatches,omitempty"`
+}
+
+type Option func(*Attestor)
+
+// Attestor records the buildinfo the go command embeds in the Go binaries a step produces: the module versions and
+// checksums the binary was built from, the build settings, and the VCS revision. The buildinfo is cross-checked
+// against the commit recorded by the git attestor and against the go.mod and go.sum in the working directory, and
+// any differences are recorded with the binary, so policies can reject binaries that weren't built from the attested
+// sources.
+type Attestor struct {
+	binaries map[string]Binary
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		binaries: make(map[string]Binary),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	commit := gitCommit(ctx)
+	mod, err := readModule(ctx.WorkingDir())
+	if err != nil {
+		return fmt.Errorf("failed to read go module: %w", err)
+	}
+
+	for productPath, product := range ctx.Products() {
+		info, err := buildinfo.ReadFile(filepath.Join(ctx.WorkingDir(), productPath))
+		if err != nil {
+			continue
+		}
+
+		binary := NewBinary(info)
+		binary.Digest = product.Digest
+		if commit != nil {
+			binary.Mismatches = append(binary.Mismatches, binary.CheckCommit(commit.hash, commit.dirty)...)
+		}
+
+		if mod != nil {
+			binary.Mismatches = append(binary.Mismatches, mod.check(binary)...)
+		}
+
+		a.binaries[productPath] = binary
+	}
+
+	if len(a.binaries) == 0 {
+		log.Debugf("(attestation/gobuild) no go binaries found in products")
+	}
+
+	return nil
+}
+
+func (a *Attestor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.binaries)
+}
+
+func (a *Attestor) UnmarshalJSON(data []byte) error {
+	binaries := make(map[string]Binary)
+	if err := json.Unmarshal(data, &binaries); err != nil {
+		return err
+	}
+
+	a.binaries = binaries
+	return nil
+}
+
+// Binaries returns the buildinfo of each Go binary, keyed by its path relative to the working directory.
+func (a *Attestor) Binaries() map[string]Binary {
+	return a.binaries
+}
+
+// NewBinary returns the buildinfo of a Go binary as it is recorded, without a digest or mismatches.
+func NewBinary(info *debug.BuildInfo) Binary {
+	binary := Binary{
+		GoVersion: info.GoVersion,
+		Package:   info.Path,
+		Main:      newModule(&info.Main),
+	}
+
+	for _, dep := range info.Deps {
+		binary.Deps = append(binary.Deps, newModule(dep))
+	}
+
+	settings := make(map[string]string, len(info.Settings))
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+
+	if system, ok := settings["vcs"]; ok {
+		binary.VCS = &VCS{
+			System:   system,
+			Revision: settings["vcs.revision"],
+			Time:     settings["vcs.time"],
+			Modified: settings["vcs.modified"] == "true",
+		}
+	}
+
+	if len(settings) > 0 {
+		binary.Settings = settings
+	}
+
+	return binary
+}
+
+func newModule(mod *debug.Module) Module {
+	m := Module{Path: mod.Path, Version: mod.Version, Sum: mod.Sum}
+	if mod.Replace != nil {
+		replace := newModule(mod.Replace)
+		m.Replace = &replace
+	}
+
+	return m
+}
+
+// commit is what the git attestor recorded about the working directory's repository.
+type commit struct {
+	hash  string
+	dirty bool
+}
+
+// gitCommit returns the commit the git attestor recorded, if it ran. It is read through the attestor's JSON since
+// the attestor may be wrapped.
+func gitCommit(ctx *attestation.AttestationContext) *commit {
+	for _, completed := range ctx.CompletedAttestors() {
+		if completed.Attestor.Name() != git.Name || completed.Error != nil {
+			continue
+		}
+
+		data, err := json.Marshal(completed.Attestor)
+		if err != nil {
+			return nil
+		}
+
+		recorded := struct {
+			CommitHash string                     `json:"commithash"`
+			Status     map[string]json.RawMessage `json:"status"`
+		}{}
+
+		if err := json.Unmarshal(data, &recorded); err != nil || recorded.CommitHash == "" {
+			return nil
+		}
+
+		return &commit{hash: recorded.CommitHash, dirty: len(recorded.Status) > 0}
+	}
+
+	return nil
+}
+
+// CheckCommit compares the VCS revision the binary was stamped with against a commit recorded by the git attestor,
+// and whether the worktree was modified against whether the git attestor recorded uncommitted changes. It returns a
+// description of each difference.
+func (binary Binary) CheckCommit(hash string, dirty bool) []string {
+	if binary.VCS == nil || binary.VCS.System != "git" {
+		return []string{fmt.Sprintf("binary has no git revision, but the git attestor recorded commit %v", hash)}
+	}
+
+	mismatches := []string{}
+	if binary.VCS.Revision != hash {
+		mismatches = append(mismatches, fmt.Sprintf("binary was built from revision %v, but the git attestor recorded commit %v", binary.VCS.Revision, hash))
+	}
+
+	if binary.VCS.Modified && !dirty {
+		mismatches = append(mismatches, "binary was built from a modified worktree, but the git attestor recorded a clean worktree")
+	} else if !binary.VCS.Modified && dirty {
+		mismatches = append(mismatches, "binary was built from a clean worktree, but the git attestor recorded uncommitted changes")
+	}
+
+	return mismatches
+}
+
+// module is the go.mod and go.sum of the working directory.
+type module struct {
+	path string
+	sums map[string]struct{}
+}
+
+// readModule reads the module path from go.mod and the checksums of go.sum in dir. It returns nil if dir isn't the
+// root of a module.
+func readModule(dir string) (*module, error) {
+	goMod, err := os.Open(filepath.Join(dir, "go.mod"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer goMod.Close()
+	mod := &module{sums: make(map[string]struct{})}
+	scanner := bufio.NewScanner(goMod)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			mod.path = strings.Trim(fields[1], `"`)
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	goSum, err := os.ReadFile(filepath.Join(dir, "go.sum"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(goSum), "\n") {
+		if fields := strings.Fields(line); len(fields) == 3 {
+			mod.sums[strings.Join(fields, " ")] = struct{}{}
+		}
+	}
+
+	return mod, nil
+}
+
+// check compares the dependencies of binary against go.sum. Binaries of other modules, such as tools installed
+// during the step, aren't checked.
+func (m module) check(binary Binary) []string {
+	if binary.Main.Path != m.path {
+		log.Debugf("(attestation/gobuild) skipping go.sum check of %v: it isn't built from module %v", binary.Package, m.path)
+		return nil
+	}
+
+	mismatches := []string{}
+	for _, dep := range binary.Deps {
+		if dep.Replace != nil {
+			dep = *dep.Replace
+		}
+
+		// local replacements and vendored builds have no checksum to compare
+		if dep.Version == "" || dep.Sum == "" {
+			continue
+		}
+
+		if _, ok := m.sums[dep.Path+" "+dep.Version+" "+dep.Sum]; !ok {
+			mismatches = append(mismatches, fmt.Sprintf("dependency %v@%v with checksum %v is not in go.sum", dep.Path, dep.Version, dep.Sum))
+		}
+	}
+
+	return mismatches
+}
@@ -0,0 +1,137 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobuild
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/attestation/material"
+	"github.com/testifysec/go-witness/attestation/product"
+)
+
+// runAttestors copies the test binary, which is a Go binary built from this repository's module, into dir as a
+// product of the step.
+func runAttestors(t *testing.T, dir string) *Attestor {
+	testBinary, err := os.Executable()
+	require.NoError(t, err)
+	goBuildAttestor := New()
+	ctx, err := attestation.NewContext([]attestation.Attestor{
+		material.New(),
+		commandrun.New(commandrun.WithCommand([]string{"cp", testBinary, "app"})),
+		product.New(),
+		goBuildAttestor,
+	}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	for _, completed := range ctx.CompletedAttestors() {
+		require.NoError(t, completed.Error)
+	}
+
+	return goBuildAttestor
+}
+
+func copyModule(t *testing.T, dir string) {
+	for _, name := range []string{"go.mod", "go.sum"} {
+		data, err := os.ReadFile(filepath.Join("..", "..", "..", name))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+	}
+}
+
+func TestGoBuild(t *testing.T) {
+	dir := t.TempDir()
+	copyModule(t, dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a binary\n"), 0644))
+	a := runAttestors(t, dir)
+
+	require.Len(t, a.Binaries(), 1)
+	binary, ok := a.Binaries()["app"]
+	require.True(t, ok)
+	require.NotEmpty(t, binary.Digest)
+	require.Equal(t, "github.com/testifysec/witness", binary.Main.Path)
+	require.Equal(t, "github.com/testifysec/witness/pkg/attestation/gobuild.test", binary.Package)
+	require.NotEmpty(t, binary.GoVersion)
+	require.Contains(t, binary.Settings, "GOOS")
+	require.Empty(t, binary.Mismatches)
+
+	found := false
+	for _, dep := range binary.Deps {
+		if dep.Path == "github.com/stretchr/testify" {
+			found = true
+			require.NotEmpty(t, dep.Sum)
+		}
+	}
+
+	require.True(t, found)
+
+	data, err := json.Marshal(a)
+	require.NoError(t, err)
+	unmarshaled := New()
+	require.NoError(t, json.Unmarshal(data, unmarshaled))
+	require.Equal(t, a.Binaries(), unmarshaled.Binaries())
+}
+
+func TestGoBuildSumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	copyModule(t, dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.sum"), nil, 0644))
+	a := runAttestors(t, dir)
+
+	binary := a.Binaries()["app"]
+	require.NotEmpty(t, binary.Mismatches)
+	require.Contains(t, binary.Mismatches[0], "is not in go.sum")
+}
+
+func TestGitMismatches(t *testing.T) {
+	binary := NewBinary(&debug.BuildInfo{
+		Path: "example.com/app",
+		Main: debug.Module{Path: "example.com/app", Version: "(devel)"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs", Value: "git"},
+			{Key: "vcs.revision", Value: "1111111111111111111111111111111111111111"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	})
+
+	require.Equal(t, &VCS{System: "git", Revision: "1111111111111111111111111111111111111111", Modified: true}, binary.VCS)
+	require.Empty(t, binary.CheckCommit("1111111111111111111111111111111111111111", true))
+	require.Equal(t, []string{
+		"binary was built from revision 1111111111111111111111111111111111111111, but the git attestor recorded commit 2222222222222222222222222222222222222222",
+		"binary was built from a modified worktree, but the git attestor recorded a clean worktree",
+	}, binary.CheckCommit("2222222222222222222222222222222222222222", false))
+
+	unstamped := NewBinary(&debug.BuildInfo{Path: "example.com/app", Main: debug.Module{Path: "example.com/app"}})
+	require.Nil(t, unstamped.VCS)
+	require.Len(t, unstamped.CheckCommit("2222222222222222222222222222222222222222", false), 1)
+}
+
+func TestModuleChecksOnlyItsOwnBinaries(t *testing.T) {
+	mod := module{path: "example.com/app", sums: map[string]struct{}{"example.com/dep v1.0.0 h1:abc=": {}}}
+	deps := []Module{
+		{Path: "example.com/dep", Version: "v1.0.0", Sum: "h1:abc="},
+		{Path: "example.com/local", Version: "v1.0.0", Sum: "h1:old=", Replace: &Module{Path: "../local"}},
+		{Path: "example.com/other", Version: "v2.0.0", Sum: "h1:def="},
+	}
+
+	require.Equal(t, []string{"dependency example.com/other@v2.0.0 with checksum h1:def= is not in go.sum"}, mod.check(Binary{Main: Module{Path: "example.com/app"}, Deps: deps}))
+	require.Empty(t, mod.check(Binary{Main: Module{Path: "golang.org/x/tools"}, Deps: deps}))
+}
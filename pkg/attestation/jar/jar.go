@@ -0,0 +1,394 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+)
+
+const (
+	Name    = "jar"
+	Type    = "https://witness.dev/attestations/jar/v0.1"
+	RunType = attestation.PostProductRunType
+
+	manifestPath = "META-INF/MANIFEST.MF"
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor  = &Attestor{}
+	_ attestation.Subjecter = &Attestor{}
+
+	jarExtensions = map[string]struct{}{".jar": {}, ".war": {}, ".ear": {}}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+type Jar struct {
+	Digest       cryptoutil.DigestSet `json:"digest"`
+	Manifest     map[string]string    `json:"manifest,omitempty"`
+	ModuleName   string               `json:"modulename,omitempty"`
+	Dependencies []Dependency         `json:"dependencies,omitempty"`
+	Signatures   []Signature          `json:"signatures,omitempty"`
+}
+
+// Dependency describes a library packaged inside of a jar, either as a nested jar (war files, spring boot jars)
+// or shaded into the jar's own classes, in which case only its maven coordinates are known.
+type Dependency struct {
+	Path       string               `json:"path"`
+	GroupID    string               `json:"groupid,omitempty"`
+	ArtifactID string               `json:"artifactid,omitempty"`
+	Version    string               `json:"version,omitempty"`
+	Digest     cryptoutil.DigestSet `json:"digest,omitempty"`
+}
+
+// Signature describes a jarsigner signature found in the jar's META-INF directory.
+type Signature struct {
+	Name                   string        `json:"name"`
+	Verified               bool          `json:"verified"`
+	ManifestDigestVerified bool          `json:"manifestdigestverified"`
+	Certificates           []Certificate `json:"certificates,omitempty"`
+	Error                  string        `json:"error,omitempty"`
+}
+
+type Certificate struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	Serial      string    `json:"serial"`
+	NotBefore   time.Time `json:"notbefore"`
+	NotAfter    time.Time `json:"notafter"`
+	Fingerprint string    `json:"fingerprint"`
+}
+
+type Attestor struct {
+	jars   map[string]Jar
+	hashes []crypto.Hash
+}
+
+func New() *Attestor {
+	return &Attestor{
+		jars: make(map[string]Jar),
+	}
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	a.hashes = ctx.Hashes()
+	for productPath, product := range ctx.Products() {
+		if _, ok := jarExtensions[strings.ToLower(filepath.Ext(productPath))]; !ok {
+			continue
+		}
+
+		zipReader, err := zip.OpenReader(filepath.Join(ctx.WorkingDir(), productPath))
+		if err != nil {
+			log.Debugf("(attestation/jar) could not open %v as a jar: %v", productPath, err)
+			continue
+		}
+
+		jar, err := a.inspect(&zipReader.Reader)
+		zipReader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to inspect jar %v: %w", productPath, err)
+		}
+
+		jar.Digest = product.Digest
+		a.jars[productPath] = jar
+	}
+
+	return nil
+}
+
+func (a *Attestor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.jars)
+}
+
+func (a *Attestor) UnmarshalJSON(data []byte) error {
+	jars := make(map[string]Jar)
+	if err := json.Unmarshal(data, &jars); err != nil {
+		return err
+	}
+
+	a.jars = jars
+	return nil
+}
+
+func (a *Attestor) Jars() map[string]Jar {
+	return a.jars
+}
+
+// Subjects returns the digests of nested jars so attestations can be found by the libraries bundled into an application.
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for jarPath, jar := range a.jars {
+		for _, dep := range jar.Dependencies {
+			if len(dep.Digest) > 0 {
+				subjects[fmt.Sprintf("file:%v!/%v", jarPath, dep.Path)] = dep.Digest
+			}
+		}
+	}
+
+	return subjects
+}
+
+func (a *Attestor) inspect(zipReader *zip.Reader) (Jar, error) {
+	jar := Jar{}
+	files := make(map[string]*zip.File)
+	for _, f := range zipReader.File {
+		files[f.Name] = f
+	}
+
+	manifestBytes, err := readZipFile(files[manifestPath])
+	if err != nil {
+		return jar, err
+	}
+
+	if manifestBytes != nil {
+		jar.Manifest = parseManifest(manifestBytes)
+		jar.ModuleName = jar.Manifest["Automatic-Module-Name"]
+	}
+
+	// a module declared by module-info.class takes the place of an automatic module named in the manifest. Multi-release
+	// jars may only declare it under META-INF/versions, and the one at the root wins if there are both.
+	declared := false
+	for _, f := range zipReader.File {
+		name := f.Name
+		switch {
+		case name == "module-info.class" || (strings.HasPrefix(name, "META-INF/versions/") && path.Base(name) == "module-info.class"):
+			if declared && name != "module-info.class" {
+				continue
+			}
+
+			data, err := readZipFile(f)
+			if err != nil {
+				return jar, err
+			}
+
+			module, err := parseModuleName(data)
+			if err != nil {
+				log.Debugf("(attestation/jar) failed to read module name from %v: %v", name, err)
+				continue
+			}
+
+			jar.ModuleName = module
+			declared = true
+
+		case strings.HasSuffix(name, ".jar"):
+			data, err := readZipFile(f)
+			if err != nil {
+				return jar, err
+			}
+
+			digest, err := cryptoutil.CalculateDigestSetFromBytes(data, a.hashes)
+			if err != nil {
+				return jar, err
+			}
+
+			dep := Dependency{Path: name, Digest: digest}
+			if nested, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err == nil {
+				for _, nestedFile := range nested.File {
+					if isPomProperties(nestedFile.Name) {
+						if props, err := readZipFile(nestedFile); err == nil {
+							dep.GroupID, dep.ArtifactID, dep.Version = parseCoordinates(props)
+						}
+
+						break
+					}
+				}
+			}
+
+			jar.Dependencies = append(jar.Dependencies, dep)
+
+		case isPomProperties(name):
+			props, err := readZipFile(f)
+			if err != nil {
+				return jar, err
+			}
+
+			dep := Dependency{Path: name}
+			dep.GroupID, dep.ArtifactID, dep.Version = parseCoordinates(props)
+			jar.Dependencies = append(jar.Dependencies, dep)
+
+		case path.Dir(name) == "META-INF" && strings.HasSuffix(name, ".SF"):
+			jar.Signatures = append(jar.Signatures, verifySignature(files, name, manifestBytes))
+		}
+	}
+
+	return jar, nil
+}
+
+// verifySignature checks the signature block that accompanies a jarsigner signature file, and that the signature
+// file covers the jar's current manifest.
+func verifySignature(files map[string]*zip.File, sfName string, manifest []byte) Signature {
+	base := strings.TrimSuffix(sfName, ".SF")
+	sig := Signature{Name: path.Base(base)}
+	sfBytes, err := readZipFile(files[sfName])
+	if err != nil {
+		sig.Error = err.Error()
+		return sig
+	}
+
+	var blockBytes []byte
+	for _, ext := range []string{".RSA", ".DSA", ".EC"} {
+		if f, ok := files[base+ext]; ok {
+			if blockBytes, err = readZipFile(f); err != nil {
+				sig.Error = err.Error()
+				return sig
+			}
+
+			break
+		}
+	}
+
+	if blockBytes == nil {
+		sig.Error = "signature block not found"
+		return sig
+	}
+
+	p7, err := pkcs7.Parse(blockBytes)
+	if err != nil {
+		sig.Error = fmt.Sprintf("could not parse signature block: %v", err)
+		return sig
+	}
+
+	for _, cert := range p7.Certificates {
+		sig.Certificates = append(sig.Certificates, newCertificate(cert))
+	}
+
+	// jarsigner produces detached signatures over the signature file
+	p7.Content = sfBytes
+	if err := p7.Verify(); err != nil {
+		sig.Error = fmt.Sprintf("signature block did not verify: %v", err)
+	} else {
+		sig.Verified = true
+	}
+
+	sfAttributes := parseManifest(sfBytes)
+	if expected, ok := sfAttributes["SHA-256-Digest-Manifest"]; ok && manifest != nil {
+		actual := sha256.Sum256(manifest)
+		sig.ManifestDigestVerified = expected == base64.StdEncoding.EncodeToString(actual[:])
+	}
+
+	return sig
+}
+
+func newCertificate(cert *x509.Certificate) Certificate {
+	fingerprint := sha256.Sum256(cert.Raw)
+	return Certificate{
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		Serial:      cert.SerialNumber.String(),
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+		Fingerprint: hex.EncodeToString(fingerprint[:]),
+	}
+}
+
+// parseManifest parses the main section of a jar manifest or signature file. Lines longer than 72 bytes are
+// continued on the next line, which begins with a single space.
+func parseManifest(data []byte) map[string]string {
+	attributes := make(map[string]string)
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	lastKey := ""
+	for _, line := range lines {
+		if line == "" {
+			break
+		}
+
+		if strings.HasPrefix(line, " ") && lastKey != "" {
+			attributes[lastKey] += line[1:]
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		lastKey = key
+		attributes[key] = strings.TrimSpace(value)
+	}
+
+	return attributes
+}
+
+func isPomProperties(name string) bool {
+	return strings.HasPrefix(name, "META-INF/maven/") && strings.HasSuffix(name, "/pom.properties")
+}
+
+func parseCoordinates(props []byte) (groupID, artifactID, version string) {
+	for _, line := range strings.Split(string(props), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "groupId":
+			groupID = value
+		case "artifactId":
+			artifactID = value
+		case "version":
+			version = value
+		}
+	}
+
+	return groupID, artifactID, version
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+	return io.ReadAll(r)
+}
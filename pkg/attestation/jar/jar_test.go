@@ -0,0 +1,169 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseManifest(t *testing.T) {
+	manifest := "Manifest-Version: 1.0\r\nImplementation-Title: a-very-long-title-that-jarsigner-would-have-wrap\r\n ped\r\nAutomatic-Module-Name: dev.witness.app\r\n\r\nName: com/example/App.class\r\nSHA-256-Digest: abc\r\n"
+	attributes := parseManifest([]byte(manifest))
+	require.Equal(t, "1.0", attributes["Manifest-Version"])
+	require.Equal(t, "a-very-long-title-that-jarsigner-would-have-wrapped", attributes["Implementation-Title"])
+	require.Equal(t, "dev.witness.app", attributes["Automatic-Module-Name"])
+	require.NotContains(t, attributes, "Name")
+}
+
+func TestInspectSignedJar(t *testing.T) {
+	manifest := []byte("Manifest-Version: 1.0\r\nAutomatic-Module-Name: dev.witness.app\r\n\r\n")
+	manifestDigest := sha256.Sum256(manifest)
+	sf := []byte(fmt.Sprintf("Signature-Version: 1.0\r\nSHA-256-Digest-Manifest: %v\r\n\r\n", base64.StdEncoding.EncodeToString(manifestDigest[:])))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "Witness Testing Jar Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(certBytes)
+	require.NoError(t, err)
+
+	signedData, err := pkcs7.NewSignedData(sf)
+	require.NoError(t, err)
+	require.NoError(t, signedData.AddSigner(cert, key, pkcs7.SignerInfoConfig{}))
+	signedData.Detach()
+	block, err := signedData.Finish()
+	require.NoError(t, err)
+
+	nested := &bytes.Buffer{}
+	nestedWriter := zip.NewWriter(nested)
+	writeZipEntry(t, nestedWriter, "META-INF/maven/dev.witness/lib/pom.properties", []byte("groupId=dev.witness\nartifactId=lib\nversion=1.2.3\n"))
+	require.NoError(t, nestedWriter.Close())
+
+	jarBuf := &bytes.Buffer{}
+	jarWriter := zip.NewWriter(jarBuf)
+	writeZipEntry(t, jarWriter, manifestPath, manifest)
+	writeZipEntry(t, jarWriter, "META-INF/SIGNER.SF", sf)
+	writeZipEntry(t, jarWriter, "META-INF/SIGNER.RSA", block)
+	writeZipEntry(t, jarWriter, "BOOT-INF/lib/lib-1.2.3.jar", nested.Bytes())
+	require.NoError(t, jarWriter.Close())
+
+	zipReader, err := zip.NewReader(bytes.NewReader(jarBuf.Bytes()), int64(jarBuf.Len()))
+	require.NoError(t, err)
+	a := New()
+	a.hashes = []crypto.Hash{crypto.SHA256}
+	jar, err := a.inspect(zipReader)
+	require.NoError(t, err)
+
+	require.Equal(t, "dev.witness.app", jar.ModuleName)
+	require.Len(t, jar.Dependencies, 1)
+	require.Equal(t, "dev.witness", jar.Dependencies[0].GroupID)
+	require.Equal(t, "1.2.3", jar.Dependencies[0].Version)
+	require.NotEmpty(t, jar.Dependencies[0].Digest)
+
+	require.Len(t, jar.Signatures, 1)
+	require.Equal(t, "SIGNER", jar.Signatures[0].Name)
+	require.True(t, jar.Signatures[0].Verified, jar.Signatures[0].Error)
+	require.True(t, jar.Signatures[0].ManifestDigestVerified)
+	require.Len(t, jar.Signatures[0].Certificates, 1)
+}
+
+func writeZipEntry(t *testing.T, w *zip.Writer, name string, data []byte) {
+	f, err := w.Create(name)
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+}
+
+// moduleInfoClass returns a module-info.class declaring module, with a long constant so the pool has an entry that
+// takes up two slots.
+func moduleInfoClass(module string) []byte {
+	buf := &bytes.Buffer{}
+	write := func(values ...interface{}) {
+		for _, v := range values {
+			_ = binary.Write(buf, binary.BigEndian, v)
+		}
+	}
+
+	utf8 := func(s string) {
+		write(uint8(constantUtf8), uint16(len(s)))
+		buf.WriteString(s)
+	}
+
+	write(uint32(classMagic), uint16(0), uint16(53), uint16(9))
+	utf8("module-info")                     // 1
+	write(uint8(constantClass), uint16(1))  // 2
+	write(uint8(constantLong), uint64(42))  // 3 and 4
+	utf8(module)                            // 5
+	write(uint8(constantModule), uint16(5)) // 6
+	utf8("Module")                          // 7
+	utf8("SourceFile")                      // 8
+	write(uint16(0x8000), uint16(2), uint16(0), uint16(0), uint16(0), uint16(0))
+	write(uint16(2))
+	write(uint16(8), uint32(2), uint16(1))
+	write(uint16(7), uint32(16), uint16(6), uint16(0), uint16(0), uint16(0), uint16(0), uint16(0), uint16(0), uint16(0))
+	return buf.Bytes()
+}
+
+func TestParseModuleName(t *testing.T) {
+	module, err := parseModuleName(moduleInfoClass("dev.witness.app"))
+	require.NoError(t, err)
+	require.Equal(t, "dev.witness.app", module)
+
+	class := moduleInfoClass("dev.witness.app")
+	_, err = parseModuleName(class[:len(class)-4])
+	require.Error(t, err)
+
+	_, err = parseModuleName([]byte("PK\x03\x04"))
+	require.Error(t, err)
+}
+
+func TestInspectModuleInfo(t *testing.T) {
+	jarBuf := &bytes.Buffer{}
+	jarWriter := zip.NewWriter(jarBuf)
+	writeZipEntry(t, jarWriter, manifestPath, []byte("Manifest-Version: 1.0\r\nAutomatic-Module-Name: dev.witness.automatic\r\n\r\n"))
+	writeZipEntry(t, jarWriter, "META-INF/versions/11/module-info.class", moduleInfoClass("dev.witness.versioned"))
+	writeZipEntry(t, jarWriter, "module-info.class", moduleInfoClass("dev.witness.app"))
+	require.NoError(t, jarWriter.Close())
+
+	zipReader, err := zip.NewReader(bytes.NewReader(jarBuf.Bytes()), int64(jarBuf.Len()))
+	require.NoError(t, err)
+	jar, err := New().inspect(zipReader)
+	require.NoError(t, err)
+	require.Equal(t, "dev.witness.app", jar.ModuleName)
+}
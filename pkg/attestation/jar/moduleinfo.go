@@ -0,0 +1,170 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jar
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	classMagic = 0xCAFEBABE
+
+	// constant pool tags of the class file format, from chapter 4.4 of the Java Virtual Machine Specification
+	constantUtf8               = 1
+	constantInteger            = 3
+	constantFloat              = 4
+	constantLong               = 5
+	constantDouble             = 6
+	constantClass              = 7
+	constantString             = 8
+	constantFieldref           = 9
+	constantMethodref          = 10
+	constantInterfaceMethodref = 11
+	constantNameAndType        = 12
+	constantMethodHandle       = 15
+	constantMethodType         = 16
+	constantDynamic            = 17
+	constantInvokeDynamic      = 18
+	constantModule             = 19
+	constantPackage            = 20
+)
+
+var errTruncatedClass = errors.New("class file is truncated")
+
+// classReader reads the big-endian fields of a class file.
+type classReader struct {
+	data []byte
+	err  error
+}
+
+func (r *classReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if n < 0 || n > len(r.data) {
+		r.err = errTruncatedClass
+		return nil
+	}
+
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *classReader) u1() uint8 {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+
+	return 0
+}
+
+func (r *classReader) u2() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+
+	return 0
+}
+
+func (r *classReader) u4() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+
+	return 0
+}
+
+// skipMembers skips the fields or methods of a class, which module-info.class doesn't have but may be given.
+func (r *classReader) skipMembers() {
+	for count := r.u2(); count > 0 && r.err == nil; count-- {
+		r.next(6)
+		r.skipAttributes()
+	}
+}
+
+func (r *classReader) skipAttributes() {
+	for count := r.u2(); count > 0 && r.err == nil; count-- {
+		r.u2()
+		r.next(int(r.u4()))
+	}
+}
+
+// parseModuleName returns the name of the module module-info.class declares, which is held by its Module attribute.
+func parseModuleName(data []byte) (string, error) {
+	r := &classReader{data: data}
+	if r.u4() != classMagic {
+		return "", fmt.Errorf("not a class file")
+	}
+
+	r.next(4)
+	count := int(r.u2())
+	utf8 := make(map[uint16]string)
+	modules := make(map[uint16]uint16)
+	for i := 1; i < count && r.err == nil; i++ {
+		switch tag := r.u1(); tag {
+		case constantUtf8:
+			utf8[uint16(i)] = string(r.next(int(r.u2())))
+		case constantModule:
+			modules[uint16(i)] = r.u2()
+		case constantClass, constantString, constantMethodType, constantPackage:
+			r.next(2)
+		case constantMethodHandle:
+			r.next(3)
+		case constantInteger, constantFloat, constantFieldref, constantMethodref, constantInterfaceMethodref,
+			constantNameAndType, constantDynamic, constantInvokeDynamic:
+			r.next(4)
+		case constantLong, constantDouble:
+			// 8 byte constants take up two entries of the pool
+			r.next(8)
+			i++
+		default:
+			return "", fmt.Errorf("unknown constant pool tag %v", tag)
+		}
+	}
+
+	// access flags, this class, and super class
+	r.next(6)
+	r.next(2 * int(r.u2()))
+	r.skipMembers()
+	r.skipMembers()
+	for count := r.u2(); count > 0 && r.err == nil; count-- {
+		name := utf8[r.u2()]
+		attribute := &classReader{data: r.next(int(r.u4()))}
+		if r.err != nil || name != "Module" {
+			continue
+		}
+
+		nameIndex, ok := modules[attribute.u2()]
+		if attribute.err != nil || !ok {
+			return "", fmt.Errorf("module attribute doesn't refer to a module")
+		}
+
+		if module, ok := utf8[nameIndex]; ok {
+			return module, nil
+		}
+
+		return "", fmt.Errorf("module name isn't in the constant pool")
+	}
+
+	if r.err != nil {
+		return "", r.err
+	}
+
+	return "", fmt.Errorf("class file has no module attribute")
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package material
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/testifysec/go-witness/attestation"
+	basematerial "github.com/testifysec/go-witness/attestation/material"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/witness/pkg/digest"
+)
+
+const (
+	Name    = basematerial.Name
+	Type    = basematerial.Type
+	RunType = basematerial.RunType
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor   = &Attestor{}
+	_ attestation.Materialer = &Attestor{}
+)
+
+// init replaces the go-witness material attestor in the registry, which is initialized first since it is imported
+// here.
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Attestor records the digests of every file in the working directory before the command runs. It records the same
+// attestation as the go-witness material attestor, hashing files with witness's digest package.
+type Attestor struct {
+	materials    map[string]cryptoutil.DigestSet
+	contentTable bool
+	digestOpts   []digest.Option
+}
+
+type Option func(*Attestor)
+
+// WithContentTable serializes the attestation with a content table, so files that share content refer to one copy
+// of its digests. Only witness reads attestations serialized this way.
+func WithContentTable(contentTable bool) Option {
+	return func(a *Attestor) {
+		a.contentTable = contentTable
+	}
+}
+
+// WithDigestOptions tunes how files are hashed, such as how many are hashed at once and where progress is reported.
+func WithDigestOptions(opts ...digest.Option) Option {
+	return func(a *Attestor) {
+		a.digestOpts = append(a.digestOpts, opts...)
+	}
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+type tabledMaterials struct {
+	digest.Table
+	Files map[string]int `json:"files"`
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	artifacts, err := digest.Dir(ctx.WorkingDir(), nil, ctx.Hashes(), a.digestOpts...)
+	if err != nil {
+		return err
+	}
+
+	a.materials = make(map[string]cryptoutil.DigestSet, len(artifacts))
+	for path, artifact := range artifacts {
+		a.materials[path] = artifact.Digest
+	}
+
+	return nil
+}
+
+func (a *Attestor) MarshalJSON() ([]byte, error) {
+	if !a.contentTable {
+		return json.Marshal(a.materials)
+	}
+
+	table, files, err := digest.NewTable(a.materials)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(tabledMaterials{Table: table, Files: files})
+}
+
+// UnmarshalJSON reads attestations keyed by path and ones serialized with a content table. Either way the attestor
+// marshals back to the attestation keyed by path, which is what policies are evaluated against.
+func (a *Attestor) UnmarshalJSON(data []byte) error {
+	if !digest.IsTabled(data) {
+		materials := make(map[string]cryptoutil.DigestSet)
+		if err := json.Unmarshal(data, &materials); err != nil {
+			return err
+		}
+
+		a.materials = materials
+		return nil
+	}
+
+	tabled := tabledMaterials{}
+	if err := json.Unmarshal(data, &tabled); err != nil {
+		return err
+	}
+
+	a.materials = make(map[string]cryptoutil.DigestSet, len(tabled.Files))
+	for path, index := range tabled.Files {
+		ds, err := tabled.Lookup(index)
+		if err != nil {
+			return fmt.Errorf("material %v: %w", path, err)
+		}
+
+		a.materials[path] = ds
+	}
+
+	return nil
+}
+
+func (a *Attestor) Materials() map[string]cryptoutil.DigestSet {
+	return a.materials
+}
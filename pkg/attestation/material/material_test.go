@@ -0,0 +1,82 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package material
+
+import (
+	"crypto"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+func TestAttest(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "src"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main"), 0644))
+
+	a := New()
+	ctx, err := attestation.NewContext([]attestation.Attestor{a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	expected, err := cryptoutil.CalculateDigestSetFromBytes([]byte("package main"), []crypto.Hash{crypto.SHA256})
+	require.NoError(t, err)
+	materials := a.Materials()
+	require.Len(t, materials, 1)
+	require.True(t, materials[filepath.Join("src", "main.go")].Equal(expected))
+	require.Equal(t, materials, ctx.Materials())
+
+	data, err := json.Marshal(a)
+	require.NoError(t, err)
+	decoded := New()
+	require.NoError(t, json.Unmarshal(data, decoded))
+	require.Equal(t, materials, decoded.Materials())
+}
+
+func TestContentTable(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "vendor", name), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "vendor", name, "LICENSE"), []byte("Apache-2.0"), 0644))
+	}
+
+	a := New(WithContentTable(true))
+	ctx, err := attestation.NewContext([]attestation.Attestor{a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	data, err := json.Marshal(a)
+	require.NoError(t, err)
+	tabled := tabledMaterials{}
+	require.NoError(t, json.Unmarshal(data, &tabled))
+	require.Len(t, tabled.Contents, 1)
+	require.Len(t, tabled.Files, 3)
+
+	decoded := New()
+	require.NoError(t, json.Unmarshal(data, decoded))
+	require.Equal(t, a.Materials(), decoded.Materials())
+
+	// decoded attestations marshal keyed by path, which is what policies see
+	expanded, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	materials := make(map[string]cryptoutil.DigestSet)
+	require.NoError(t, json.Unmarshal(expanded, &materials))
+	require.Equal(t, a.Materials(), materials)
+}
@@ -0,0 +1,354 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nix
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+)
+
+const (
+	Name    = "nix"
+	Type    = "https://witness.dev/attestations/nix/v0.1"
+	RunType = attestation.PostProductRunType
+
+	storeDir      = "/nix/store/"
+	subjectPrefix = "nix:"
+	defaultTool   = "nix"
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor  = &Attestor{}
+	_ attestation.Subjecter = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// FlakeInput is a locked input of the flake, as pinned in flake.lock.
+type FlakeInput struct {
+	Type         string `json:"type"`
+	URL          string `json:"url,omitempty"`
+	Owner        string `json:"owner,omitempty"`
+	Repo         string `json:"repo,omitempty"`
+	Ref          string `json:"ref,omitempty"`
+	Rev          string `json:"rev,omitempty"`
+	NarHash      string `json:"narhash"`
+	LastModified int64  `json:"lastmodified,omitempty"`
+}
+
+// StorePath is a path the build realized in the Nix store, along with the derivation that produced it.
+type StorePath struct {
+	Path       string   `json:"path"`
+	Deriver    string   `json:"deriver,omitempty"`
+	NarHash    string   `json:"narhash"`
+	NarSize    int64    `json:"narsize,omitempty"`
+	References []string `json:"references,omitempty"`
+}
+
+type Option func(*Attestor)
+
+// WithTool sets the path to the nix command.
+func WithTool(tool string) Option {
+	return func(a *Attestor) {
+		a.tool = tool
+	}
+}
+
+// Attestor records the locked inputs of the flake in the working directory and the store paths the build realized,
+// found through the result links nix build and nix-build leave in the working directory. Store paths are queried
+// with nix path-info, so the Nix store they were built into must be available to witness.
+type Attestor struct {
+	FlakeInputs map[string]FlakeInput `json:"flakeinputs,omitempty"`
+	// Outputs are the realized store paths, keyed by the path of the result link relative to the working directory.
+	Outputs map[string]StorePath `json:"outputs,omitempty"`
+
+	tool string
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		tool: defaultTool,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	inputs, err := readFlakeLock(filepath.Join(ctx.WorkingDir(), "flake.lock"))
+	if err != nil {
+		return fmt.Errorf("failed to read flake.lock: %w", err)
+	}
+
+	a.FlakeInputs = inputs
+	links, err := resultLinks(ctx.WorkingDir())
+	if err != nil {
+		return err
+	}
+
+	if len(links) == 0 {
+		log.Debugf("(attestation/nix) no result links found in %v", ctx.WorkingDir())
+		return nil
+	}
+
+	paths := make([]string, 0, len(links))
+	for _, storePath := range links {
+		paths = append(paths, storePath)
+	}
+
+	info, err := a.pathInfo(paths)
+	if err != nil {
+		return fmt.Errorf("failed to query realized store paths: %w", err)
+	}
+
+	a.Outputs = make(map[string]StorePath, len(links))
+	for link, storePath := range links {
+		sp, ok := info[storePath]
+		if !ok {
+			return fmt.Errorf("nix path-info returned no information for %v", storePath)
+		}
+
+		a.Outputs[link] = sp
+	}
+
+	return nil
+}
+
+// Subjects returns every realized store path with the digest of its NAR serialization, so attestations can be found
+// by the store paths a deployment or binary cache refers to.
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for _, sp := range a.Outputs {
+		digest, err := narDigest(sp.NarHash)
+		if err != nil {
+			log.Debugf("(attestation/nix) could not decode nar hash of %v: %v", sp.Path, err)
+			continue
+		}
+
+		subjects[subjectPrefix+sp.Path] = digest
+	}
+
+	return subjects
+}
+
+type flakeLock struct {
+	Nodes map[string]struct {
+		Inputs map[string]json.RawMessage `json:"inputs"`
+		Locked *struct {
+			Type         string `json:"type"`
+			URL          string `json:"url"`
+			Owner        string `json:"owner"`
+			Repo         string `json:"repo"`
+			Ref          string `json:"ref"`
+			Rev          string `json:"rev"`
+			NarHash      string `json:"narHash"`
+			LastModified int64  `json:"lastModified"`
+		} `json:"locked"`
+	} `json:"nodes"`
+	Root string `json:"root"`
+}
+
+// readFlakeLock returns every locked node of flake.lock, keyed by node name, including the transitive inputs of
+// the flake's inputs. It returns nil if there is no flake.lock.
+func readFlakeLock(path string) (map[string]FlakeInput, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	lock := flakeLock{}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+
+	inputs := make(map[string]FlakeInput)
+	for name, node := range lock.Nodes {
+		if name == lock.Root || node.Locked == nil {
+			continue
+		}
+
+		inputs[name] = FlakeInput{
+			Type:         node.Locked.Type,
+			URL:          node.Locked.URL,
+			Owner:        node.Locked.Owner,
+			Repo:         node.Locked.Repo,
+			Ref:          node.Locked.Ref,
+			Rev:          node.Locked.Rev,
+			NarHash:      node.Locked.NarHash,
+			LastModified: node.Locked.LastModified,
+		}
+	}
+
+	return inputs, nil
+}
+
+// resultLinks returns the store paths the result links in dir point to, such as result and result-dev for a
+// derivation with several outputs.
+func resultLinks(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make(map[string]string)
+	for _, entry := range entries {
+		if entry.Type()&os.ModeSymlink == 0 || (entry.Name() != "result" && !strings.HasPrefix(entry.Name(), "result-")) {
+			continue
+		}
+
+		target, err := os.Readlink(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(target, storeDir) {
+			links[entry.Name()] = target
+		}
+	}
+
+	return links, nil
+}
+
+type pathInfoEntry struct {
+	Path       string   `json:"path"`
+	Deriver    string   `json:"deriver"`
+	NarHash    string   `json:"narHash"`
+	NarSize    int64    `json:"narSize"`
+	References []string `json:"references"`
+}
+
+// pathInfo queries the store paths with nix path-info. Nix 2.19 and later return an object keyed by store path,
+// while earlier versions return an array of entries that include the path.
+func (a *Attestor) pathInfo(paths []string) (map[string]StorePath, error) {
+	sort.Strings(paths)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.Command(a.tool, append([]string{"--extra-experimental-features", "nix-command", "path-info", "--json"}, paths...)...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	entries := []pathInfoEntry{}
+	if err := json.Unmarshal(stdout.Bytes(), &entries); err != nil {
+		byPath := map[string]pathInfoEntry{}
+		if err := json.Unmarshal(stdout.Bytes(), &byPath); err != nil {
+			return nil, fmt.Errorf("failed to parse nix path-info output: %w", err)
+		}
+
+		for path, entry := range byPath {
+			entry.Path = path
+			entries = append(entries, entry)
+		}
+	}
+
+	info := make(map[string]StorePath, len(entries))
+	for _, entry := range entries {
+		sort.Strings(entry.References)
+		info[entry.Path] = StorePath(entry)
+	}
+
+	return info, nil
+}
+
+// nix32Alphabet is the alphabet of Nix's base32 encoding, which omits e, o, t, and u.
+const nix32Alphabet = "0123456789abcdfghijklmnpqrsvwxyz"
+
+// narDigest decodes a NAR hash in SRI form, sha256-<base64>, or in the sha256:<base32> form of older versions of Nix.
+func narDigest(narHash string) (cryptoutil.DigestSet, error) {
+	var raw []byte
+	switch {
+	case strings.HasPrefix(narHash, "sha256-"):
+		var err error
+		if raw, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(narHash, "sha256-")); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(narHash, "sha256:"):
+		var err error
+		if raw, err = decodeNix32(strings.TrimPrefix(narHash, "sha256:"), sha256.Size); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported nar hash %v", narHash)
+	}
+
+	if len(raw) != sha256.Size {
+		return nil, fmt.Errorf("nar hash %v is not a sha256 digest", narHash)
+	}
+
+	return cryptoutil.DigestSet{cryptoutil.DigestValue{Hash: crypto.SHA256}: hex.EncodeToString(raw)}, nil
+}
+
+// decodeNix32 decodes Nix's base32 encoding, which encodes the bytes from the last character to the first.
+func decodeNix32(encoded string, size int) ([]byte, error) {
+	if len(encoded) != (size*8+4)/5 {
+		return nil, fmt.Errorf("invalid length %v for a %v byte hash", len(encoded), size)
+	}
+
+	raw := make([]byte, size)
+	for n := 0; n < len(encoded); n++ {
+		digit := strings.IndexByte(nix32Alphabet, encoded[len(encoded)-n-1])
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid character %q", encoded[len(encoded)-n-1])
+		}
+
+		b := n * 5
+		i, j := b/8, uint(b%8)
+		raw[i] |= byte(digit << j)
+		if carry := byte(digit >> (8 - j)); i+1 < size {
+			raw[i+1] |= carry
+		} else if carry != 0 {
+			return nil, errors.New("invalid trailing bits")
+		}
+	}
+
+	return raw, nil
+}
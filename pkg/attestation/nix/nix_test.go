@@ -0,0 +1,147 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nix
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+const (
+	helloPath = "/nix/store/0c5ld8zxb4cfr9pk2mbjm4b9s8jsb1k3-hello-2.12.1"
+	helloDrv  = "/nix/store/5f6jrvbnqz3j8z6a5gbnbs0yawv1sk3w-hello-2.12.1.drv"
+	glibcPath = "/nix/store/ld03l52xq2ssn4x0g5asypsxqls40497-glibc-2.37-8"
+
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	testFlakeLock = `{
+  "nodes": {
+    "flake-utils": {
+      "inputs": {"systems": "systems"},
+      "locked": {"lastModified": 1694529238, "narHash": "sha256-zsNZZGTGnMOf9YpHKJqMSsa0dXbfmxeoJ7xHlrt+xmY=", "owner": "numtide", "repo": "flake-utils", "rev": "ff7b65b44d01cf9ba6a71320833626af21126384", "type": "github"},
+      "original": {"owner": "numtide", "repo": "flake-utils", "type": "github"}
+    },
+    "nixpkgs": {
+      "locked": {"lastModified": 1697059129, "narHash": "sha256-9NJcFF9CEYPvHJ5ckE8kvINvI84SZZ87PvqMbH6pro0=", "owner": "NixOS", "repo": "nixpkgs", "rev": "5e4c2ada4fcd54b99d56d7bd62f384511a7e2593", "type": "github"},
+      "original": {"owner": "NixOS", "ref": "nixos-unstable", "repo": "nixpkgs", "type": "github"}
+    },
+    "root": {"inputs": {"flake-utils": "flake-utils", "nixpkgs": "nixpkgs"}},
+    "systems": {
+      "locked": {"lastModified": 1681028828, "narHash": "sha256-Vy1rq5AaRuLzOxct8nz4T6wlgyUR7zLU309k9mBC768=", "owner": "nix-systems", "repo": "default", "rev": "da67096a3b9bf56a91d16901293e51ba5b49a27e", "type": "github"}
+    }
+  },
+  "root": "root",
+  "version": 7
+}`
+)
+
+// TestHelperProcess stands in for nix when run through the script written by fakeNix. NIX_TEST_FORMAT selects the
+// output of nix path-info before or after Nix 2.19.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("NIX_TEST_HELPER") != "1" {
+		return
+	}
+
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+
+	if strings.Join(args[1:5], " ") != "--extra-experimental-features nix-command path-info --json" || len(args) != 6 || args[5] != helloPath {
+		fmt.Fprintf(os.Stderr, "error: unexpected arguments %v\n", args[1:])
+		os.Exit(1)
+	}
+
+	switch os.Getenv("NIX_TEST_FORMAT") {
+	case "array":
+		fmt.Printf(`[{"path":%q,"deriver":%q,"narHash":"sha256:0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73","narSize":226560,"references":[%q,%q],"valid":true}]`, helloPath, helloDrv, helloPath, glibcPath)
+	default:
+		fmt.Printf(`{%q:{"deriver":%q,"narHash":"sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=","narSize":226560,"references":[%q,%q]}}`, helloPath, helloDrv, glibcPath, helloPath)
+	}
+
+	os.Exit(0)
+}
+
+func fakeNix(t *testing.T, format string) string {
+	t.Setenv("NIX_TEST_HELPER", "1")
+	t.Setenv("NIX_TEST_FORMAT", format)
+	tool := filepath.Join(t.TempDir(), "nix")
+	script := fmt.Sprintf("#!/bin/sh\nexec %q -test.run=TestHelperProcess -- \"$@\"\n", os.Args[0])
+	require.NoError(t, os.WriteFile(tool, []byte(script), 0700))
+	return tool
+}
+
+func TestAttest(t *testing.T) {
+	for _, format := range []string{"object", "array"} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "flake.lock"), []byte(testFlakeLock), 0644))
+			require.NoError(t, os.Symlink(helloPath, filepath.Join(dir, "result")))
+			// links outside the store and files named like result links are ignored
+			require.NoError(t, os.Symlink(dir, filepath.Join(dir, "result-local")))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "result-notes"), []byte("notes"), 0644))
+
+			a := New(WithTool(fakeNix(t, format)))
+			ctx, err := attestation.NewContext([]attestation.Attestor{a}, attestation.WithWorkingDir(dir))
+			require.NoError(t, err)
+			require.NoError(t, ctx.RunAttestors())
+			require.NoError(t, ctx.CompletedAttestors()[0].Error)
+
+			require.Len(t, a.FlakeInputs, 3)
+			require.Equal(t, FlakeInput{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "5e4c2ada4fcd54b99d56d7bd62f384511a7e2593", NarHash: "sha256-9NJcFF9CEYPvHJ5ckE8kvINvI84SZZ87PvqMbH6pro0=", LastModified: 1697059129}, a.FlakeInputs["nixpkgs"])
+			require.Contains(t, a.FlakeInputs, "systems")
+
+			require.Len(t, a.Outputs, 1)
+			hello := a.Outputs["result"]
+			require.Equal(t, helloPath, hello.Path)
+			require.Equal(t, helloDrv, hello.Deriver)
+			require.Equal(t, []string{helloPath, glibcPath}, hello.References)
+			require.Equal(t, map[string]cryptoutil.DigestSet{
+				subjectPrefix + helloPath: {cryptoutil.DigestValue{Hash: crypto.SHA256}: emptySHA256},
+			}, a.Subjects())
+		})
+	}
+}
+
+func TestAttestWithoutNix(t *testing.T) {
+	a := New(WithTool(filepath.Join(t.TempDir(), "nix")))
+	ctx, err := attestation.NewContext([]attestation.Attestor{a}, attestation.WithWorkingDir(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	require.NoError(t, ctx.CompletedAttestors()[0].Error)
+	require.Empty(t, a.FlakeInputs)
+	require.Empty(t, a.Outputs)
+}
+
+func TestNarDigest(t *testing.T) {
+	for _, narHash := range []string{"sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", "sha256:0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73"} {
+		digest, err := narDigest(narHash)
+		require.NoError(t, err)
+		require.Equal(t, emptySHA256, digest[cryptoutil.DigestValue{Hash: crypto.SHA256}])
+	}
+
+	for _, narHash := range []string{"md5-1B2M2Y8AsgTpgAmY7PhCfg==", "sha256:0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c7e", "sha256:0mdq"} {
+		_, err := narDigest(narHash)
+		require.Error(t, err, narHash)
+	}
+}
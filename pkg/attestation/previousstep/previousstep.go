@@ -0,0 +1,212 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package previousstep
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/witness/pkg/bundle"
+)
+
+const (
+	Name    = "previousstep"
+	Type    = "https://witness.dev/attestations/previousstep/v0.1"
+	RunType = attestation.PreMaterialRunType
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor   = &Attestor{}
+	_ attestation.Subjecter  = &Attestor{}
+	_ attestation.BackReffer = &Attestor{}
+
+	gitoidSHA256 = cryptoutil.DigestValue{Hash: crypto.SHA256, GitOID: true}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// PreviousStep identifies the signed envelope of a step that ran before the current one.
+type PreviousStep struct {
+	Step string `json:"step"`
+	// EnvelopeDigest includes the gitoid Archivista stores the envelope under
+	EnvelopeDigest cryptoutil.DigestSet `json:"envelopedigest"`
+	// PayloadDigest is the digest of the signed statement, which doesn't change if the envelope is re-serialized
+	PayloadDigest cryptoutil.DigestSet            `json:"payloaddigest"`
+	Subjects      map[string]cryptoutil.DigestSet `json:"subjects,omitempty"`
+}
+
+type Attestor struct {
+	paths    []string
+	previous []PreviousStep
+}
+
+type Option func(*Attestor)
+
+// WithEnvelopePaths sets the paths of the signed envelopes produced by previous steps
+func WithEnvelopePaths(paths []string) Option {
+	return func(a *Attestor) {
+		a.paths = paths
+	}
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	for _, path := range a.paths {
+		previous, err := loadPreviousStep(path, ctx.Hashes())
+		if err != nil {
+			return fmt.Errorf("failed to load previous step envelope %v: %w", path, err)
+		}
+
+		a.previous = append(a.previous, previous)
+	}
+
+	return nil
+}
+
+func (a *Attestor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.previous)
+}
+
+func (a *Attestor) UnmarshalJSON(data []byte) error {
+	previous := make([]PreviousStep, 0)
+	if err := json.Unmarshal(data, &previous); err != nil {
+		return err
+	}
+
+	a.previous = previous
+	return nil
+}
+
+func (a *Attestor) PreviousSteps() []PreviousStep {
+	return a.previous
+}
+
+// Subjects allows a step to be found by the envelope gitoid of any step it follows.
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for _, previous := range a.previous {
+		if gitoid, ok := previous.EnvelopeDigest[gitoidSHA256]; ok {
+			subjects[fmt.Sprintf("envelope:%v", gitoid)] = previous.EnvelopeDigest
+		}
+	}
+
+	return subjects
+}
+
+// BackRefs returns the subjects of the previous steps, so verification can search from this step back to the
+// steps that came before it.
+func (a *Attestor) BackRefs() map[string]cryptoutil.DigestSet {
+	backRefs := make(map[string]cryptoutil.DigestSet)
+	for _, previous := range a.previous {
+		for name, digest := range previous.Subjects {
+			backRefs[fmt.Sprintf("%v/%v", previous.Step, name)] = digest
+		}
+	}
+
+	return backRefs
+}
+
+func loadPreviousStep(path string, hashes []crypto.Hash) (PreviousStep, error) {
+	envelopeBytes, err := os.ReadFile(path)
+	if err != nil {
+		return PreviousStep{}, err
+	}
+
+	env, err := bundle.Decode(envelopeBytes)
+	if err != nil {
+		return PreviousStep{}, fmt.Errorf("could not parse envelope: %w", err)
+	}
+
+	statement := intoto.Statement{}
+	if err := json.Unmarshal(env.Payload, &statement); err != nil {
+		return PreviousStep{}, fmt.Errorf("could not parse statement: %w", err)
+	}
+
+	// only the collection's name is needed, so the attestations aren't parsed
+	collection := struct {
+		Name string `json:"name"`
+	}{}
+
+	if err := json.Unmarshal(statement.Predicate, &collection); err != nil {
+		return PreviousStep{}, fmt.Errorf("could not parse attestation collection: %w", err)
+	}
+
+	envelopeDigest, err := cryptoutil.CalculateDigestSetFromBytes(envelopeBytes, hashes)
+	if err != nil {
+		return PreviousStep{}, err
+	}
+
+	envelopeDigest[gitoidSHA256] = GitOID(envelopeBytes)
+	payloadDigest, err := cryptoutil.CalculateDigestSetFromBytes(env.Payload, hashes)
+	if err != nil {
+		return PreviousStep{}, err
+	}
+
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for _, subject := range statement.Subject {
+		ds, err := cryptoutil.NewDigestSet(subject.Digest)
+		if err != nil {
+			continue
+		}
+
+		subjects[subject.Name] = ds
+	}
+
+	return PreviousStep{
+		Step:           collection.Name,
+		EnvelopeDigest: envelopeDigest,
+		PayloadDigest:  payloadDigest,
+		Subjects:       subjects,
+	}, nil
+}
+
+// GitOID returns the sha256 gitoid of data, which is the digest git would give data if it were stored as a blob.
+func GitOID(data []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "blob %d\x00", len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package previousstep
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+)
+
+func TestAttest(t *testing.T) {
+	payload := []byte(`{"_type":"https://in-toto.io/Statement/v0.1","subject":[{"name":"file:app.tar.gz","digest":{"sha256":"abcd"}}],"predicateType":"https://witness.testifysec.com/attestation-collection/v0.1","predicate":{"name":"build","attestations":[]}}`)
+	envelopeBytes, err := json.Marshal(dsse.Envelope{Payload: payload, PayloadType: "application/vnd.in-toto+json"})
+	require.NoError(t, err)
+	envelopePath := filepath.Join(t.TempDir(), "build.json")
+	require.NoError(t, os.WriteFile(envelopePath, envelopeBytes, 0644))
+
+	a := New(WithEnvelopePaths([]string{envelopePath}))
+	ctx, err := attestation.NewContext([]attestation.Attestor{a})
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	require.Len(t, a.PreviousSteps(), 1)
+	previous := a.PreviousSteps()[0]
+	require.Equal(t, "build", previous.Step)
+	payloadDigest := sha256.Sum256(payload)
+	require.Equal(t, hex.EncodeToString(payloadDigest[:]), previous.PayloadDigest[cryptoutil.DigestValue{Hash: crypto.SHA256}])
+	require.Contains(t, a.Subjects(), "envelope:"+GitOID(envelopeBytes))
+	require.Contains(t, a.BackRefs(), "build/file:app.tar.gz")
+
+	data, err := json.Marshal(a)
+	require.NoError(t, err)
+	roundTrip := New()
+	require.NoError(t, json.Unmarshal(data, roundTrip))
+	require.Equal(t, a.PreviousSteps(), roundTrip.PreviousSteps())
+}
+
+func TestAttestInvalidEnvelope(t *testing.T) {
+	envelopePath := filepath.Join(t.TempDir(), "build.json")
+	require.NoError(t, os.WriteFile(envelopePath, []byte("not an envelope"), 0644))
+	ctx, err := attestation.NewContext([]attestation.Attestor{New(WithEnvelopePaths([]string{envelopePath}))})
+	require.NoError(t, err)
+	require.ErrorContains(t, ctx.RunAttestors(), "could not parse envelope")
+}
+
+func TestGitOID(t *testing.T) {
+	require.Equal(t, "473a0f4c3be8a93681a267e3b1e9a7dcda1185436fe141f7749120a303721813", GitOID([]byte{}))
+}
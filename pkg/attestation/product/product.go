@@ -0,0 +1,298 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package product
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gobwas/glob"
+	"github.com/testifysec/go-witness/attestation"
+	baseproduct "github.com/testifysec/go-witness/attestation/product"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/witness/pkg/digest"
+)
+
+const (
+	Name    = baseproduct.Name
+	Type    = baseproduct.Type
+	RunType = baseproduct.RunType
+
+	defaultIncludeGlob = "*"
+	defaultExcludeGlob = ""
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor  = &Attestor{}
+	_ attestation.Subjecter = &Attestor{}
+	_ attestation.Producer  = &Attestor{}
+)
+
+// init replaces the go-witness product attestor in the registry, which is initialized first since it is imported
+// here. The options keep their names so existing flags and configs still apply.
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() },
+		attestation.StringConfigOption(
+			"includeGlob",
+			"Pattern to use when recording products. Files that match this pattern will be included as subjects on the attestation.",
+			defaultIncludeGlob,
+			func(a attestation.Attestor, includeGlob string) (attestation.Attestor, error) {
+				prodAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a product attestor", a)
+				}
+
+				WithIncludeGlob(includeGlob)(prodAttestor)
+				return prodAttestor, nil
+			},
+		),
+		attestation.StringConfigOption(
+			"excludeGlob",
+			"Pattern to use when recording products. Files that match this pattern will be excluded as subjects on the attestation.",
+			defaultExcludeGlob,
+			func(a attestation.Attestor, excludeGlob string) (attestation.Attestor, error) {
+				prodAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a product attestor", a)
+				}
+
+				WithExcludeGlob(excludeGlob)(prodAttestor)
+				return prodAttestor, nil
+			},
+		),
+	)
+}
+
+type Option func(*Attestor)
+
+func WithIncludeGlob(glob string) Option {
+	return func(a *Attestor) {
+		a.includeGlob = glob
+	}
+}
+
+func WithExcludeGlob(glob string) Option {
+	return func(a *Attestor) {
+		a.excludeGlob = glob
+	}
+}
+
+// WithContentTable serializes the attestation with a content table, so files that share content refer to one copy
+// of its digests. Only witness reads attestations serialized this way.
+func WithContentTable(contentTable bool) Option {
+	return func(a *Attestor) {
+		a.contentTable = contentTable
+	}
+}
+
+// WithDigestOptions tunes how files are hashed, such as how many are hashed at once and where progress is reported.
+func WithDigestOptions(opts ...digest.Option) Option {
+	return func(a *Attestor) {
+		a.digestOpts = append(a.digestOpts, opts...)
+	}
+}
+
+// WithUnchanged records every file in the working directory as a product, including those unchanged since the
+// materials were recorded. witness attest uses it to attest to artifacts that were produced elsewhere.
+func WithUnchanged(unchanged bool) Option {
+	return func(a *Attestor) {
+		a.unchanged = unchanged
+	}
+}
+
+// Attestor records the digests and content types of the files the command created or changed in the working
+// directory. It records the same attestation as the go-witness product attestor, hashing files with witness's digest
+// package.
+type Attestor struct {
+	products            map[string]attestation.Product
+	includeGlob         string
+	compiledIncludeGlob glob.Glob
+	excludeGlob         string
+	compiledExcludeGlob glob.Glob
+	contentTable        bool
+	unchanged           bool
+	digestOpts          []digest.Option
+}
+
+type tabledProducts struct {
+	digest.Table
+	Files map[string]tabledProduct `json:"files"`
+}
+
+type tabledProduct struct {
+	MimeType string `json:"mime_type"`
+	Content  int    `json:"content"`
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		includeGlob: defaultIncludeGlob,
+		excludeGlob: defaultExcludeGlob,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	var err error
+	if a.compiledIncludeGlob, err = glob.Compile(a.includeGlob); err != nil {
+		return err
+	}
+
+	if a.compiledExcludeGlob, err = glob.Compile(a.excludeGlob); err != nil {
+		return err
+	}
+
+	baseArtifacts := ctx.Materials()
+	if a.unchanged {
+		baseArtifacts = nil
+	}
+
+	artifacts, err := digest.Dir(ctx.WorkingDir(), baseArtifacts, ctx.Hashes(), a.digestOpts...)
+	if err != nil {
+		return err
+	}
+
+	a.products = make(map[string]attestation.Product, len(artifacts))
+	for path, artifact := range artifacts {
+		a.products[path] = attestation.Product{
+			MimeType: contentType(path, artifact.Head),
+			Digest:   artifact.Digest,
+		}
+	}
+
+	return nil
+}
+
+func (a *Attestor) MarshalJSON() ([]byte, error) {
+	if !a.contentTable {
+		return json.Marshal(a.products)
+	}
+
+	digests := make(map[string]cryptoutil.DigestSet, len(a.products))
+	for path, product := range a.products {
+		digests[path] = product.Digest
+	}
+
+	table, indexes, err := digest.NewTable(digests)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]tabledProduct, len(a.products))
+	for path, product := range a.products {
+		files[path] = tabledProduct{MimeType: product.MimeType, Content: indexes[path]}
+	}
+
+	return json.Marshal(tabledProducts{Table: table, Files: files})
+}
+
+// UnmarshalJSON reads attestations keyed by path and ones serialized with a content table. Either way the attestor
+// marshals back to the attestation keyed by path, which is what policies are evaluated against.
+func (a *Attestor) UnmarshalJSON(data []byte) error {
+	if !digest.IsTabled(data) {
+		products := make(map[string]attestation.Product)
+		if err := json.Unmarshal(data, &products); err != nil {
+			return err
+		}
+
+		a.products = products
+		return nil
+	}
+
+	tabled := tabledProducts{}
+	if err := json.Unmarshal(data, &tabled); err != nil {
+		return err
+	}
+
+	a.products = make(map[string]attestation.Product, len(tabled.Files))
+	for path, file := range tabled.Files {
+		ds, err := tabled.Lookup(file.Content)
+		if err != nil {
+			return fmt.Errorf("product %v: %w", path, err)
+		}
+
+		a.products[path] = attestation.Product{MimeType: file.MimeType, Digest: ds}
+	}
+
+	return nil
+}
+
+func (a *Attestor) Products() map[string]attestation.Product {
+	return a.products
+}
+
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for productName, product := range a.products {
+		if a.compiledExcludeGlob != nil && a.compiledExcludeGlob.Match(productName) {
+			continue
+		}
+
+		if a.compiledIncludeGlob != nil && !a.compiledIncludeGlob.Match(productName) {
+			continue
+		}
+
+		subjects[fmt.Sprintf("file:%v", productName)] = product.Digest
+	}
+
+	return subjects
+}
+
+// contentType detects the content type of a file from its first bytes the same way go-witness does, falling back to
+// known file signatures and then the file's extension.
+func contentType(path string, head []byte) string {
+	buffer := make([]byte, 512)
+	copy(buffer, head)
+	contentType := http.DetectContentType(buffer)
+	if contentType != "application/octet-stream" {
+		return contentType
+	}
+
+	switch {
+	// https://en.wikipedia.org/wiki/List_of_file_signatures
+	case string(buffer[257:262]) == "ustar":
+		return "application/x-tar"
+	case string(buffer[0:5]) == "%PDF-":
+		return "application/pdf"
+	}
+
+	if extension := filepath.Ext(path); extension != "" {
+		return mime.TypeByExtension(extension)
+	}
+
+	return contentType
+}
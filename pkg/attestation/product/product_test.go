@@ -0,0 +1,130 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package product
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	baseproduct "github.com/testifysec/go-witness/attestation/product"
+	"github.com/testifysec/witness/pkg/attestation/material"
+)
+
+func TestAttest(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "unchanged.txt"), []byte("unchanged"), 0644))
+	makeProducts := &writeAttestor{dir: dir, files: map[string]string{
+		"app.pdf":   "%PDF-1.7 document",
+		"page.html": "<html><body>products</body></html>",
+		"notes.md":  "notes",
+	}}
+
+	a := New(WithExcludeGlob("*.md"))
+	ctx, err := attestation.NewContext([]attestation.Attestor{material.New(), makeProducts, a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	products := a.Products()
+	require.Len(t, products, 3)
+	require.Equal(t, "application/pdf", products["app.pdf"].MimeType)
+	require.Equal(t, "text/html; charset=utf-8", products["page.html"].MimeType)
+	require.Contains(t, a.Subjects(), "file:app.pdf")
+	require.NotContains(t, a.Subjects(), "file:notes.md")
+
+	// the attestation can be read back by the go-witness product attestor
+	data, err := json.Marshal(a)
+	require.NoError(t, err)
+	base := baseproduct.New()
+	require.NoError(t, json.Unmarshal(data, base))
+	require.Equal(t, products, base.Products())
+
+	factory, ok := attestation.FactoryByType(Type)
+	require.True(t, ok)
+	require.IsType(t, &Attestor{}, factory())
+}
+
+func TestContentTable(t *testing.T) {
+	dir := t.TempDir()
+	makeProducts := &writeAttestor{dir: dir, files: map[string]string{
+		"a.html": "<html><body>same</body></html>",
+		"b.html": "<html><body>same</body></html>",
+		"c.txt":  "different",
+	}}
+
+	a := New(WithContentTable(true))
+	ctx, err := attestation.NewContext([]attestation.Attestor{material.New(), makeProducts, a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	data, err := json.Marshal(a)
+	require.NoError(t, err)
+	tabled := tabledProducts{}
+	require.NoError(t, json.Unmarshal(data, &tabled))
+	require.Len(t, tabled.Contents, 2)
+	require.Equal(t, tabled.Files["a.html"], tabled.Files["b.html"])
+	require.Equal(t, "text/html; charset=utf-8", tabled.Files["a.html"].MimeType)
+
+	decoded := New()
+	require.NoError(t, json.Unmarshal(data, decoded))
+	require.Equal(t, a.Products(), decoded.Products())
+
+	// decoded attestations marshal keyed by path, which is what policies see
+	expanded, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	base := baseproduct.New()
+	require.NoError(t, json.Unmarshal(expanded, base))
+	require.Equal(t, a.Products(), base.Products())
+}
+
+// writeAttestor stands in for a command that writes files into the working directory.
+type writeAttestor struct {
+	dir   string
+	files map[string]string
+}
+
+func (w *writeAttestor) Name() string                 { return "write" }
+func (w *writeAttestor) Type() string                 { return "https://witness.dev/attestations/write/v0.1" }
+func (w *writeAttestor) RunType() attestation.RunType { return attestation.ExecuteRunType }
+func (w *writeAttestor) Attest(ctx *attestation.AttestationContext) error {
+	for name, contents := range w.files {
+		if err := os.WriteFile(filepath.Join(w.dir, name), []byte(contents), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.tar.gz"), []byte("built elsewhere"), 0644))
+	a := New(WithUnchanged(true))
+	ctx, err := attestation.NewContext([]attestation.Attestor{material.New(), a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	require.Contains(t, a.Products(), "app.tar.gz")
+	require.Contains(t, a.Subjects(), "file:app.tar.gz")
+
+	// without it, files that were already there are materials only
+	a = New()
+	ctx, err = attestation.NewContext([]attestation.Attestor{material.New(), a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	require.Empty(t, a.Products())
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promotion
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+const (
+	Name    = "promotion"
+	Type    = "https://witness.dev/attestations/promotion/v0.1"
+	RunType = attestation.ExecuteRunType
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor  = &Attestor{}
+	_ attestation.Subjecter = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Attestor records the promotion of an artifact from one environment or registry to another, along with the
+// verified evidence that allowed it. Policies can require a promotion step before accepting an artifact for
+// production.
+type Attestor struct {
+	Source       string                     `json:"source"`
+	Destination  string                     `json:"destination"`
+	Promoter     verify.Signer              `json:"promoter"`
+	Artifacts    []cryptoutil.DigestSet     `json:"artifacts"`
+	PolicyDigest cryptoutil.DigestSet       `json:"policydigest"`
+	Evidence     []verify.EvidenceReference `json:"evidence"`
+
+	signer   cryptoutil.Signer
+	policy   dsse.Envelope
+	verified map[string][]source.VerifiedCollection
+}
+
+type Option func(*Attestor)
+
+// WithSource sets the reference the artifact is promoted from, such as a staging registry.
+func WithSource(source string) Option {
+	return func(a *Attestor) {
+		a.Source = source
+	}
+}
+
+// WithDestination sets the reference the artifact is promoted to.
+func WithDestination(destination string) Option {
+	return func(a *Attestor) {
+		a.Destination = destination
+	}
+}
+
+// WithSigner records the identity of the signer that signs the promotion as the promoter.
+func WithSigner(signer cryptoutil.Signer) Option {
+	return func(a *Attestor) {
+		a.signer = signer
+	}
+}
+
+// WithArtifacts sets the digests of the promoted artifact. They are the subjects of the attestation.
+func WithArtifacts(artifacts []cryptoutil.DigestSet) Option {
+	return func(a *Attestor) {
+		a.Artifacts = artifacts
+	}
+}
+
+// WithVerification records the policy the artifact was verified against and the evidence that satisfied it.
+func WithVerification(policy dsse.Envelope, verified map[string][]source.VerifiedCollection) Option {
+	return func(a *Attestor) {
+		a.policy = policy
+		a.verified = verified
+	}
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	if a.Source == "" || a.Destination == "" {
+		return errors.New("a promotion requires a source and a destination")
+	}
+
+	if len(a.Artifacts) == 0 {
+		return errors.New("a promotion requires the digests of the promoted artifact")
+	}
+
+	if a.signer == nil {
+		return errors.New("a promotion requires the signer of the promoter")
+	}
+
+	promoter, err := verify.SignerOf(a.signer)
+	if err != nil {
+		return fmt.Errorf("failed to identify the promoter: %w", err)
+	}
+
+	a.Promoter = promoter
+	if a.PolicyDigest, err = cryptoutil.CalculateDigestSetFromBytes(a.policy.Payload, ctx.Hashes()); err != nil {
+		return fmt.Errorf("failed to digest policy: %w", err)
+	}
+
+	a.Evidence = verify.EvidenceReferences(a.verified)
+	if len(a.Evidence) == 0 {
+		return errors.New("a promotion requires verified evidence of the artifact")
+	}
+
+	return nil
+}
+
+// Subjects returns the digests of the promoted artifact, so the promotion is found when it is verified.
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for _, artifact := range a.Artifacts {
+		for digestValue, digest := range artifact {
+			subjects[fmt.Sprintf("artifact:%v", digest)] = cryptoutil.DigestSet{digestValue: digest}
+		}
+	}
+
+	return subjects
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promotion
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+func testSigner(t *testing.T) *cryptoutil.X509Signer {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	uri, err := url.Parse("https://github.com/example/app/.github/workflows/release.yml@refs/heads/main")
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: "release-bot"},
+		EmailAddresses: []string{"release@example.com"},
+		URIs:           []*url.URL{uri},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	signer, err := cryptoutil.NewX509Signer(cryptoutil.NewECDSASigner(priv, crypto.SHA256), cert, nil, nil)
+	require.NoError(t, err)
+	return signer
+}
+
+func TestAttest(t *testing.T) {
+	signer := testSigner(t)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	artifact := cryptoutil.DigestSet{cryptoutil.DigestValue{Hash: crypto.SHA256}: "abcd"}
+	verified := map[string][]source.VerifiedCollection{
+		"test":  {{Verifiers: []cryptoutil.Verifier{verifier}, CollectionEnvelope: source.CollectionEnvelope{Reference: "test.json"}}},
+		"build": {{Verifiers: []cryptoutil.Verifier{verifier}, CollectionEnvelope: source.CollectionEnvelope{Reference: "build.json"}}},
+	}
+
+	a := New(
+		WithSource("staging/app:v1"),
+		WithDestination("production/app:v1"),
+		WithSigner(signer),
+		WithArtifacts([]cryptoutil.DigestSet{artifact}),
+		WithVerification(dsse.Envelope{Payload: []byte("{}")}, verified),
+	)
+
+	ctx, err := attestation.NewContext([]attestation.Attestor{a})
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	keyID, err := signer.KeyID()
+	require.NoError(t, err)
+	require.Equal(t, verify.Signer{
+		KeyID:      keyID,
+		CommonName: "release-bot",
+		Emails:     []string{"release@example.com"},
+		URIs:       []string{"https://github.com/example/app/.github/workflows/release.yml@refs/heads/main"},
+	}, a.Promoter)
+	require.Equal(t, []verify.EvidenceReference{{Step: "build", Reference: "build.json", Signers: []string{keyID}}, {Step: "test", Reference: "test.json", Signers: []string{keyID}}}, a.Evidence)
+	require.NotEmpty(t, a.PolicyDigest)
+	require.Equal(t, map[string]cryptoutil.DigestSet{"artifact:abcd": artifact}, a.Subjects())
+}
+
+func TestAttestIncomplete(t *testing.T) {
+	signer := testSigner(t)
+	artifacts := []cryptoutil.DigestSet{{cryptoutil.DigestValue{Hash: crypto.SHA256}: "abcd"}}
+	for name, a := range map[string]*Attestor{
+		"no destination": New(WithSource("staging/app:v1"), WithSigner(signer), WithArtifacts(artifacts)),
+		"no artifacts":   New(WithSource("staging/app:v1"), WithDestination("production/app:v1"), WithSigner(signer)),
+		"no evidence":    New(WithSource("staging/app:v1"), WithDestination("production/app:v1"), WithSigner(signer), WithArtifacts(artifacts)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Error(t, a.Attest(&attestation.AttestationContext{}))
+		})
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/attestation/recorded"
+	"github.com/testifysec/witness/pkg/guard"
+	"github.com/testifysec/witness/pkg/registry"
+	"github.com/testifysec/witness/pkg/schedule"
+)
+
+const (
+	Name    = "publish"
+	Type    = "https://witness.dev/attestations/publish/v0.1"
+	RunType = attestation.PostProductRunType
+
+	ToolNpm   = "npm"
+	ToolTwine = "twine"
+	ToolMaven = "maven"
+	ToolCrane = "crane"
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor  = &Attestor{}
+	_ attestation.Subjecter = &Attestor{}
+)
+
+func init() {
+	schedule.RegisterDependencies(Name, commandrun.Name)
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Publication is an artifact the step uploaded to a package registry.
+type Publication struct {
+	Tool string `json:"tool"`
+	// Registry is the URL or host of the registry the artifact was uploaded to, without credentials.
+	Registry string `json:"registry"`
+	Package  string `json:"package"`
+	Version  string `json:"version,omitempty"`
+	// Artifact is the uploaded file, or the repository and tag of an image, as it is named in the registry.
+	Artifact string `json:"artifact"`
+	// ReportedDigest is the digest of the artifact as the tool reported the registry received it.
+	ReportedDigest cryptoutil.DigestSet `json:"reporteddigest,omitempty"`
+	// LocalDigest is the digest of the local file that was uploaded.
+	LocalDigest cryptoutil.DigestSet `json:"localdigest,omitempty"`
+}
+
+// Digest returns the digest the registry reported for the artifact, or the digest of the uploaded file if the tool
+// doesn't report one.
+func (p Publication) Digest() cryptoutil.DigestSet {
+	if len(p.ReportedDigest) > 0 {
+		return p.ReportedDigest
+	}
+
+	return p.LocalDigest
+}
+
+type Option func(*Attestor)
+
+// WithRegistry sets the client the digests of pushed images are resolved with.
+func WithRegistry(client *registry.Client) Option {
+	return func(a *Attestor) {
+		a.registry = client
+	}
+}
+
+// Attestor records what a publish step uploaded and where: the registry, the package coordinates and version, and
+// the digest the registry reports for each artifact, so the chain binds a build's products to what consumers
+// download. npm publish, twine upload, mvn deploy, and crane push are recognized when they are the command witness
+// runs. The attestor is only added when asked for, so any other command fails the run rather than recording
+// nothing.
+type Attestor struct {
+	Publications []Publication `json:"publications"`
+
+	registry *registry.Client
+
+	guard.Cancellation
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		Publications: []Publication{},
+		registry:     registry.New(),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	run := recorded.CommandRun(ctx)
+	if run == nil || len(run.Cmd) == 0 {
+		return fmt.Errorf("no command was run, the publish attestor records what a publish command uploaded")
+	}
+
+	tool, args := publishCommand(run.Cmd)
+	var publications []Publication
+	var err error
+	switch tool {
+	case ToolNpm:
+		if hasFlag(args, "--dry-run") {
+			log.Debugf("(attestation/publish) npm publish --dry-run publishes nothing")
+			return nil
+		}
+
+		publications = npmPublications(ctx, args, run)
+	case ToolTwine:
+		publications = twinePublications(ctx, args, run)
+	case ToolMaven:
+		publications = mavenPublications(ctx, args, run)
+	case ToolCrane:
+		if publications, err = cranePublications(a.Context(ctx), a.registry, args, run); err != nil {
+			return err
+		}
+	default:
+		// wrappers such as sh -c or make hide the publish command, so what they upload can't be recorded
+		return fmt.Errorf("%v is not a recognized publish command, run npm publish, twine upload, mvn deploy, or crane push directly", strings.Join(run.Cmd, " "))
+	}
+
+	for _, publication := range publications {
+		if !consistent(publication.ReportedDigest, publication.LocalDigest) {
+			return fmt.Errorf("%v reported %v was published with digest %v, but the uploaded file's digest is %v",
+				publication.Tool, publication.Artifact, publication.ReportedDigest, publication.LocalDigest)
+		}
+	}
+
+	if len(publications) == 0 {
+		log.Warnf("(attestation/publish) found nothing %v published in its output", tool)
+		return nil
+	}
+
+	a.Publications = publications
+	return nil
+}
+
+// Subjects returns the digest of each published artifact, named by the registry and artifact, so what was published
+// where can be looked up by the digest consumers download.
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for _, publication := range a.Publications {
+		digest := publication.Digest()
+		if len(digest) == 0 {
+			continue
+		}
+
+		subjects[fmt.Sprintf("published:%v/%v", strings.TrimSuffix(publication.Registry, "/"), publication.Artifact)] = digest
+	}
+
+	return subjects
+}
+
+// publishCommand recognizes a publish command, returning the tool and its arguments, which start with the tool
+// itself. An empty tool is returned for any other command.
+func publishCommand(cmd []string) (string, []string) {
+	base := filepath.Base(cmd[0])
+	if strings.HasPrefix(base, "python") && len(cmd) > 2 && cmd[1] == "-m" {
+		cmd, base = cmd[2:], cmd[2]
+	}
+
+	switch strings.TrimSuffix(strings.TrimSuffix(base, ".exe"), ".cmd") {
+	case "npm":
+		if subcommand(cmd) == "publish" {
+			return ToolNpm, cmd
+		}
+	case "twine":
+		if subcommand(cmd) == "upload" {
+			return ToolTwine, cmd
+		}
+	case "mvn", "mvnw":
+		for _, arg := range cmd[1:] {
+			if arg == "deploy" || strings.HasPrefix(arg, "deploy:") || strings.Contains(arg, "maven-deploy-plugin") {
+				return ToolMaven, cmd
+			}
+		}
+	case "crane":
+		if subcommand(cmd) == "push" {
+			return ToolCrane, cmd
+		}
+	}
+
+	return "", nil
+}
+
+// subcommand returns the first argument after the tool that isn't a flag.
+func subcommand(cmd []string) string {
+	for _, arg := range cmd[1:] {
+		if !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+	}
+
+	return ""
+}
+
+func hasFlag(cmd []string, flag string) bool {
+	for _, arg := range cmd[1:] {
+		if arg == flag || strings.HasPrefix(arg, flag+"=") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flagValue returns the value of a flag given as --flag value or --flag=value.
+func flagValue(cmd []string, names ...string) string {
+	for i, arg := range cmd {
+		for _, name := range names {
+			if arg == name && i+1 < len(cmd) {
+				return cmd[i+1]
+			}
+
+			if value, ok := cutPrefix(arg, name+"="); ok {
+				return value
+			}
+		}
+	}
+
+	return ""
+}
+
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+
+	return s[len(prefix):], true
+}
+
+// consistent reports whether two digests of an artifact agree on every hash they both have.
+func consistent(reported, local cryptoutil.DigestSet) bool {
+	for hash, digest := range reported {
+		if localDigest, ok := local[hash]; ok && localDigest != digest {
+			return false
+		}
+	}
+
+	return true
+}
+
+// redactURL removes credentials from a registry URL, which are commonly embedded in the user info or query.
+func redactURL(registry string) string {
+	u, err := url.Parse(registry)
+	if err != nil || u.Host == "" {
+		return registry
+	}
+
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
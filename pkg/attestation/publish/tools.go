@@ -0,0 +1,516 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/registry"
+)
+
+const (
+	defaultNpmRegistry  = "https://registry.npmjs.org/"
+	defaultPyPIRegistry = "https://upload.pypi.org/legacy/"
+	dockerHub           = "index.docker.io"
+)
+
+var (
+	npmNotice       = regexp.MustCompile(`(?m)^npm notice (name|version|filename|shasum):\s+(\S+)\s*$`)
+	npmPublishing   = regexp.MustCompile(`Publishing to (\S+)`)
+	sha1Hex         = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	twineRepository = regexp.MustCompile(`Uploading distributions to (\S+)`)
+	twineUploading  = regexp.MustCompile(`(?m)^Uploading (\S+)\s*$`)
+	mavenUploaded   = regexp.MustCompile(`Uploaded(?: to [^:\s]+)?: (\S+)`)
+	mavenSnapshot   = regexp.MustCompile(`-\d{8}\.\d{6}-\d+`)
+	craneDigest     = regexp.MustCompile(`(?m)^(\S+)@sha256:([0-9a-f]{64})\s*$`)
+
+	// craneValueFlags are the flags of crane push that take a value, which may be given as a separate argument.
+	craneValueFlags = []string{"--platform", "--image-refs"}
+
+	// distributionSuffixes are the files twine uploads. Signatures uploaded alongside them aren't recorded.
+	distributionSuffixes = []string{".whl", ".tar.gz", ".zip", ".egg"}
+	// mavenSidecars are the files Maven uploads next to each artifact, which aren't artifacts themselves.
+	mavenSidecars = []string{".md5", ".sha1", ".sha256", ".sha512", ".asc", "maven-metadata.xml"}
+)
+
+// npmPublications reads the published package from the output of npm publish, which prints the tarball's name,
+// version, and shasum as notices, or as JSON with --json. The shasum is the sha1 digest the registry stores for the
+// tarball.
+func npmPublications(ctx *attestation.AttestationContext, args []string, run *commandrun.CommandRun) []Publication {
+	details := struct {
+		Name     string `json:"name"`
+		Version  string `json:"version"`
+		Filename string `json:"filename"`
+		Shasum   string `json:"shasum"`
+	}{}
+
+	if err := json.Unmarshal([]byte(strings.TrimSpace(run.Stdout)), &details); err != nil || details.Shasum == "" {
+		for _, match := range npmNotice.FindAllStringSubmatch(run.Stdout+"\n"+run.Stderr, -1) {
+			switch match[1] {
+			case "name":
+				details.Name = match[2]
+			case "version":
+				details.Version = match[2]
+			case "filename":
+				details.Filename = match[2]
+			case "shasum":
+				details.Shasum = match[2]
+			}
+		}
+	}
+
+	if details.Name == "" || !sha1Hex.MatchString(details.Shasum) {
+		log.Debugf("(attestation/publish) no package found in the output of npm publish")
+		return nil
+	}
+
+	if details.Filename == "" {
+		details.Filename = fmt.Sprintf("%v-%v.tgz", strings.Replace(strings.TrimPrefix(details.Name, "@"), "/", "-", 1), details.Version)
+	}
+
+	publication := Publication{
+		Tool:           ToolNpm,
+		Registry:       npmRegistry(args, run),
+		Package:        details.Name,
+		Version:        details.Version,
+		Artifact:       details.Filename,
+		ReportedDigest: cryptoutil.DigestSet{{Hash: crypto.SHA1}: details.Shasum},
+	}
+
+	if tarball := npmTarball(args); tarball != "" {
+		digest, err := cryptoutil.CalculateDigestSetFromFile(resolve(ctx, tarball), ctx.Hashes())
+		if err != nil {
+			log.Debugf("(attestation/publish) failed to digest %v: %v", tarball, err)
+		} else {
+			publication.LocalDigest = digest
+		}
+	}
+
+	return []Publication{publication}
+}
+
+// npmRegistry returns the registry npm reported publishing to, or the registry it was configured with.
+func npmRegistry(args []string, run *commandrun.CommandRun) string {
+	if match := npmPublishing.FindStringSubmatch(run.Stdout + "\n" + run.Stderr); match != nil {
+		return redactURL(match[1])
+	}
+
+	if registry := flagValue(args, "--registry"); registry != "" {
+		return redactURL(registry)
+	}
+
+	for _, env := range []string{"npm_config_registry", "NPM_CONFIG_REGISTRY"} {
+		if registry := os.Getenv(env); registry != "" {
+			return redactURL(registry)
+		}
+	}
+
+	return defaultNpmRegistry
+}
+
+// npmTarball returns the packed tarball npm publish was given, if it wasn't run on a package directory.
+func npmTarball(args []string) string {
+	for _, arg := range args[1:] {
+		if !strings.HasPrefix(arg, "-") && (strings.HasSuffix(arg, ".tgz") || strings.HasSuffix(arg, ".tar.gz")) {
+			return arg
+		}
+	}
+
+	return ""
+}
+
+// twinePublications records the distributions twine uploaded. Each is digested from the file, since twine sends its
+// sha256 digest with the upload but doesn't print what the registry received. When twine reports which files it
+// uploaded, files it skipped because they already exist aren't recorded.
+func twinePublications(ctx *attestation.AttestationContext, args []string, run *commandrun.CommandRun) []Publication {
+	output := run.Stdout + "\n" + run.Stderr
+	uploaded := make(map[string]struct{})
+	for _, match := range twineUploading.FindAllStringSubmatch(output, -1) {
+		uploaded[match[1]] = struct{}{}
+	}
+
+	registry := twineRegistry(args, output)
+	publications := []Publication{}
+	for _, file := range twineDistributions(ctx, args) {
+		name := filepath.Base(file)
+		if _, ok := uploaded[name]; len(uploaded) > 0 && !ok {
+			continue
+		}
+
+		digest, err := cryptoutil.CalculateDigestSetFromFile(file, ctx.Hashes())
+		if err != nil {
+			log.Debugf("(attestation/publish) failed to digest %v: %v", file, err)
+			continue
+		}
+
+		pkg, version := distributionName(name)
+		publications = append(publications, Publication{
+			Tool:        ToolTwine,
+			Registry:    registry,
+			Package:     pkg,
+			Version:     version,
+			Artifact:    name,
+			LocalDigest: digest,
+		})
+	}
+
+	return publications
+}
+
+func twineRegistry(args []string, output string) string {
+	if match := twineRepository.FindStringSubmatch(output); match != nil {
+		return redactURL(match[1])
+	}
+
+	if registry := flagValue(args, "--repository-url"); registry != "" {
+		return redactURL(registry)
+	}
+
+	if registry := os.Getenv("TWINE_REPOSITORY_URL"); registry != "" {
+		return redactURL(registry)
+	}
+
+	// a repository named in .pypirc is recorded by its name
+	if repository := flagValue(args, "-r", "--repository"); repository != "" {
+		return repository
+	}
+
+	return defaultPyPIRegistry
+}
+
+// twineDistributions expands the files and patterns given to twine upload, relative to the working directory.
+func twineDistributions(ctx *attestation.AttestationContext, args []string) []string {
+	files := []string{}
+	seen := make(map[string]struct{})
+	for _, arg := range args[1:] {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		matches, err := filepath.Glob(resolve(ctx, arg))
+		if err != nil {
+			continue
+		}
+
+		for _, match := range matches {
+			if _, ok := seen[match]; ok || !hasSuffix(match, distributionSuffixes) {
+				continue
+			}
+
+			seen[match] = struct{}{}
+			files = append(files, match)
+		}
+	}
+
+	sort.Strings(files)
+	return files
+}
+
+// distributionName reads the project and version from the file name of a wheel or source distribution.
+func distributionName(file string) (string, string) {
+	if strings.HasSuffix(file, ".whl") {
+		parts := strings.Split(strings.TrimSuffix(file, ".whl"), "-")
+		if len(parts) < 5 {
+			return file, ""
+		}
+
+		return parts[0], parts[1]
+	}
+
+	for _, suffix := range distributionSuffixes {
+		file = strings.TrimSuffix(file, suffix)
+	}
+
+	i := strings.LastIndex(file, "-")
+	if i < 0 {
+		return file, ""
+	}
+
+	return file[:i], file[i+1:]
+}
+
+// mavenPublications reads the artifacts mvn deploy uploaded from its output, which logs the URL of each. The
+// registry is the repository the URL is under, found from -DaltDeploymentRepository or the groupId of the project's
+// POM. Maven doesn't print the digests of what it uploaded, so artifacts are digested from the products of the step.
+func mavenPublications(ctx *attestation.AttestationContext, args []string, run *commandrun.CommandRun) []Publication {
+	groupID := mavenGroupID(ctx, args)
+	repository := ""
+	if alt := flagValue(args, "-DaltDeploymentRepository"); alt != "" {
+		parts := strings.Split(alt, "::")
+		repository = strings.TrimSuffix(parts[len(parts)-1], "/")
+	}
+
+	publications := []Publication{}
+	seen := make(map[string]struct{})
+	for _, match := range mavenUploaded.FindAllStringSubmatch(run.Stdout+"\n"+run.Stderr, -1) {
+		artifactURL := match[1]
+		if _, ok := seen[artifactURL]; ok || hasSuffix(artifactURL, mavenSidecars) {
+			continue
+		}
+
+		seen[artifactURL] = struct{}{}
+		publication, ok := mavenPublication(redactURL(artifactURL), repository, groupID)
+		if !ok {
+			log.Debugf("(attestation/publish) %v is not in a maven repository layout", artifactURL)
+			continue
+		}
+
+		publication.LocalDigest = mavenLocalDigest(ctx, publication)
+		publications = append(publications, publication)
+	}
+
+	return publications
+}
+
+// mavenPublication splits the URL of an uploaded artifact, laid out as <repository>/<group>/<artifact>/<version>/
+// <file>, into its coordinates. The group can only be told apart from the repository when the repository or the
+// groupId is known. Otherwise the group's path is left in the registry.
+func mavenPublication(artifactURL, repository, groupID string) (Publication, bool) {
+	parts := strings.Split(artifactURL, "/")
+	if len(parts) < 4 {
+		return Publication{}, false
+	}
+
+	file, version, artifactID := parts[len(parts)-1], parts[len(parts)-2], parts[len(parts)-3]
+	if !strings.HasPrefix(file, artifactID+"-") {
+		return Publication{}, false
+	}
+
+	registry, rest := "", ""
+	coordinates := "/" + strings.Join(parts[len(parts)-3:len(parts)-1], "/") + "/"
+	if repository != "" && strings.HasPrefix(artifactURL, repository+"/") {
+		registry, rest = repository, strings.TrimPrefix(artifactURL, repository+"/")
+		groupID = strings.ReplaceAll(strings.TrimSuffix(rest, coordinates[1:]+file), "/", ".")
+		groupID = strings.TrimSuffix(groupID, ".")
+	} else if i := strings.Index(artifactURL, "/"+strings.ReplaceAll(groupID, ".", "/")+coordinates); groupID != "" && i >= 0 {
+		registry, rest = artifactURL[:i], artifactURL[i+1:]
+	} else {
+		i := strings.LastIndex(artifactURL, coordinates)
+		registry, rest, groupID = artifactURL[:i], artifactURL[i+1:], ""
+	}
+
+	pkg := artifactID
+	if groupID != "" {
+		pkg = groupID + ":" + artifactID
+	}
+
+	return Publication{
+		Tool:     ToolMaven,
+		Registry: registry,
+		Package:  pkg,
+		Version:  version,
+		Artifact: rest,
+	}, true
+}
+
+// mavenLocalDigest returns the digest of the product that was uploaded as the artifact. Snapshots are uploaded with
+// a timestamp in place of SNAPSHOT, so they are matched by the name Maven built them with.
+func mavenLocalDigest(ctx *attestation.AttestationContext, publication Publication) cryptoutil.DigestSet {
+	names := map[string]struct{}{path.Base(publication.Artifact): {}}
+	if strings.HasSuffix(publication.Version, "-SNAPSHOT") {
+		names[mavenSnapshot.ReplaceAllString(path.Base(publication.Artifact), "-SNAPSHOT")] = struct{}{}
+	}
+
+	paths := []string{}
+	products := ctx.Products()
+	for productPath := range products {
+		if _, ok := names[path.Base(productPath)]; ok {
+			paths = append(paths, productPath)
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil
+	}
+
+	sort.Strings(paths)
+	return products[paths[0]].Digest
+}
+
+// mavenGroupID reads the groupId of the project's POM, which is inherited from its parent if it doesn't set one.
+func mavenGroupID(ctx *attestation.AttestationContext, args []string) string {
+	pomPath := flagValue(args, "-f", "--file")
+	if pomPath == "" {
+		pomPath = "pom.xml"
+	}
+
+	data, err := os.ReadFile(resolve(ctx, pomPath))
+	if err != nil {
+		return ""
+	}
+
+	pom := struct {
+		GroupID string `xml:"groupId"`
+		Parent  struct {
+			GroupID string `xml:"groupId"`
+		} `xml:"parent"`
+	}{}
+
+	if err := xml.Unmarshal(data, &pom); err != nil {
+		log.Debugf("(attestation/publish) failed to parse %v: %v", pomPath, err)
+		return ""
+	}
+
+	if pom.GroupID != "" {
+		return strings.TrimSpace(pom.GroupID)
+	}
+
+	return strings.TrimSpace(pom.Parent.GroupID)
+}
+
+// cranePublications records the image crane push uploaded. The digest is resolved from the registry by the
+// reference the image was pushed to, so it is the manifest digest the registry serves the image by rather than what
+// crane printed, which must agree with it.
+func cranePublications(ctx context.Context, client *registry.Client, args []string, run *commandrun.CommandRun) ([]Publication, error) {
+	printed := craneDigest.FindStringSubmatch(run.Stdout)
+	// crane push <path> <image>
+	image := ""
+	if positional := positionalArgs(args, craneValueFlags); len(positional) >= 3 {
+		image = positional[2]
+	} else if printed != nil {
+		image = printed[1] + "@sha256:" + printed[2]
+	} else {
+		log.Warnf("(attestation/publish) no image found in %v", args)
+		return nil, nil
+	}
+
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return nil, err
+	}
+
+	desc, err := client.Resolve(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve pushed image %v: %w", image, err)
+	}
+
+	digest := strings.TrimPrefix(desc.Digest, "sha256:")
+	if printed != nil && printed[2] != digest {
+		return nil, fmt.Errorf("crane reported pushing %v@sha256:%v, but %v resolves to %v", printed[1], printed[2], image, desc.Digest)
+	}
+
+	name, _, pinned := strings.Cut(image, "@")
+	tag := imageTag(name)
+	if tag != "" {
+		name = strings.TrimSuffix(name, ":"+tag)
+	}
+
+	// an image pushed by digest is recorded by it, even if the reference also has a tag
+	if pinned {
+		tag = ""
+	}
+
+	registryHost, repository := splitRepository(name)
+	artifact := repository + "@" + desc.Digest
+	if tag != "" {
+		artifact = repository + ":" + tag
+	}
+
+	return []Publication{{
+		Tool:           ToolCrane,
+		Registry:       registryHost,
+		Package:        repository,
+		Version:        tag,
+		Artifact:       artifact,
+		ReportedDigest: cryptoutil.DigestSet{{Hash: crypto.SHA256}: digest},
+	}}, nil
+}
+
+// positionalArgs returns the arguments after the tool that aren't flags or the values of valueFlags.
+func positionalArgs(args []string, valueFlags []string) []string {
+	positional := []string{}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(positional, args[i+1:]...)
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			positional = append(positional, arg)
+			continue
+		}
+
+		for _, flag := range valueFlags {
+			if arg == flag {
+				i++
+				break
+			}
+		}
+	}
+
+	return positional
+}
+
+// splitRepository splits an image repository into its registry and path. Repositories without a registry are on
+// Docker Hub.
+func splitRepository(repository string) (string, string) {
+	i := strings.Index(repository, "/")
+	if i < 0 {
+		return dockerHub, "library/" + repository
+	}
+
+	host := repository[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return dockerHub, repository
+	}
+
+	return host, repository[i+1:]
+}
+
+// imageTag returns the tag of an image reference, if it has one.
+func imageTag(image string) string {
+	if strings.Contains(image, "@") {
+		return ""
+	}
+
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return ""
+	}
+
+	return image[i+1:]
+}
+
+func hasSuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func resolve(ctx *attestation.AttestationContext, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+
+	return filepath.Join(ctx.WorkingDir(), file)
+}
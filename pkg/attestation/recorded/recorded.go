@@ -0,0 +1,47 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recorded reads what attestors that already ran recorded, for attestors that build on it.
+package recorded
+
+import (
+	"encoding/json"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+)
+
+// CommandRun returns what the commandrun attestor recorded, if it ran. It is read through the attestor's JSON since
+// the attestor may be wrapped, and so any redaction of its output by the capture profile applies here too.
+func CommandRun(ctx *attestation.AttestationContext) *commandrun.CommandRun {
+	for _, completed := range ctx.CompletedAttestors() {
+		if completed.Attestor.Name() != commandrun.Name || completed.Error != nil {
+			continue
+		}
+
+		data, err := json.Marshal(completed.Attestor)
+		if err != nil {
+			return nil
+		}
+
+		run := &commandrun.CommandRun{}
+		if err := json.Unmarshal(data, run); err != nil {
+			return nil
+		}
+
+		return run
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorded
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/attestation/material"
+)
+
+func TestCommandRun(t *testing.T) {
+	ctx, err := attestation.NewContext([]attestation.Attestor{commandrun.New(commandrun.WithCommand([]string{"true"}), commandrun.WithSilent(true))}, attestation.WithWorkingDir(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	run := CommandRun(ctx)
+	require.NotNil(t, run)
+	require.Equal(t, []string{"true"}, run.Cmd)
+
+	// without the commandrun attestor there is nothing to read
+	ctx, err = attestation.NewContext([]attestation.Attestor{material.New()}, attestation.WithWorkingDir(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	require.Nil(t, CommandRun(ctx))
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtimeout
+
+import (
+	"time"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/witness/pkg/supervise"
+)
+
+const (
+	Name    = "runtimeout"
+	Type    = "https://witness.dev/attestations/runtimeout/v0.1"
+	RunType = attestation.PostProductRunType
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Attestor records the deadline a step's command ran under and, if the command ran past it, how it was stopped.
+// A policy can use it to tell evidence of a step that was cut short apart from evidence of a step that finished.
+type Attestor struct {
+	MaxDuration string             `json:"maxduration"`
+	TimedOut    bool               `json:"timedout"`
+	Signals     []supervise.Signal `json:"signals,omitempty"`
+	Abandoned   bool               `json:"abandoned,omitempty"`
+
+	supervisor *supervise.Supervisor
+}
+
+type Option func(*Attestor)
+
+// WithMaxDuration records the maximum duration of the run.
+func WithMaxDuration(d time.Duration) Option {
+	return func(a *Attestor) {
+		a.MaxDuration = d.String()
+	}
+}
+
+// WithSupervisor records how the supervisor of the step's command stopped it at the deadline.
+func WithSupervisor(s *supervise.Supervisor) Option {
+	return func(a *Attestor) {
+		a.supervisor = s
+	}
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	if a.supervisor == nil {
+		return nil
+	}
+
+	termination := a.supervisor.Termination()
+	if termination == nil || termination.Reason != supervise.ReasonTimeout {
+		return nil
+	}
+
+	a.TimedOut = true
+	a.Signals = termination.Signals
+	a.Abandoned = termination.Abandoned
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtimeout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/witness/pkg/supervise"
+)
+
+func TestAttest(t *testing.T) {
+	command := []string{"bash", "-c", "sleep 30; echo done"}
+	s := supervise.New(supervise.WithCommand(command), supervise.WithDeadline(time.Now().Add(200*time.Millisecond)))
+	a := New(WithMaxDuration(200*time.Millisecond), WithSupervisor(s))
+	attestors := append(s.Apply([]attestation.Attestor{commandrun.New(commandrun.WithCommand(command), commandrun.WithSilent(true))}), a)
+	ctx, err := attestation.NewContext(attestors, attestation.WithWorkingDir(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	require.Equal(t, "200ms", a.MaxDuration)
+	require.True(t, a.TimedOut)
+	require.Len(t, a.Signals, 1)
+	require.False(t, a.Abandoned)
+}
+
+func TestAttestFinished(t *testing.T) {
+	s := supervise.New(supervise.WithCommand([]string{"true"}), supervise.WithDeadline(time.Now().Add(time.Minute)))
+	a := New(WithMaxDuration(time.Minute), WithSupervisor(s))
+	attestors := append(s.Apply([]attestation.Attestor{commandrun.New(commandrun.WithCommand([]string{"true"}), commandrun.WithSilent(true))}), a)
+	ctx, err := attestation.NewContext(attestors, attestation.WithWorkingDir(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	require.False(t, a.TimedOut)
+	require.Empty(t, a.Signals)
+}
@@ -0,0 +1,437 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/guard"
+)
+
+const (
+	Name    = "sbom"
+	Type    = "https://witness.dev/attestations/sbom/v0.1"
+	RunType = attestation.PostProductRunType
+
+	FormatSPDX      = "spdx"
+	FormatCycloneDX = "cyclonedx"
+
+	// maxDocumentSize bounds how much of a product is read when looking for SBOMs.
+	maxDocumentSize = 64 << 20
+
+	// GeneratedPath is the key the SBOM generated for the working directory is recorded under. It can't collide
+	// with a product, which are keyed by relative paths.
+	GeneratedPath = "syft:dir:."
+	defaultTool   = "syft"
+
+	// generateNone turns off generating an SBOM when the attestor is selected with -a sbom.
+	generateNone = "none"
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() },
+		attestation.StringConfigOption(
+			"generate",
+			"Format of an SBOM to generate for the working directory with syft after the command runs, one of spdx or cyclonedx, or none to only record the SBOMs the command produced.",
+			FormatSPDX,
+			func(a attestation.Attestor, format string) (attestation.Attestor, error) {
+				sbomAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a sbom attestor", a)
+				}
+
+				switch format {
+				case FormatSPDX, FormatCycloneDX:
+				case generateNone, "":
+					format = ""
+				default:
+					return a, fmt.Errorf("unknown sbom format %v, expected %v, %v or %v", format, FormatSPDX, FormatCycloneDX, generateNone)
+				}
+
+				WithGenerate(format)(sbomAttestor)
+				return sbomAttestor, nil
+			},
+		),
+		attestation.StringConfigOption(
+			"syftPath",
+			"Path to the syft command used to generate SBOMs.",
+			defaultTool,
+			func(a attestation.Attestor, tool string) (attestation.Attestor, error) {
+				sbomAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a sbom attestor", a)
+				}
+
+				WithTool(tool)(sbomAttestor)
+				return sbomAttestor, nil
+			},
+		),
+	)
+}
+
+// Document is an SBOM produced by the step. The document is recorded as is so it can be inspected with the tools of
+// its format.
+type Document struct {
+	Format string               `json:"format"`
+	Digest cryptoutil.DigestSet `json:"digest"`
+	// Generated is set on the SBOM the attestor generated itself rather than one the step produced.
+	Generated bool            `json:"generated,omitempty"`
+	Document  json.RawMessage `json:"document"`
+}
+
+// Component is a package described by an SBOM, normalized across formats.
+type Component struct {
+	Name    string
+	Version string
+	PURL    string
+	// License is an SPDX license expression, empty if the SBOM doesn't declare one.
+	License string
+	// Digests are the checksums of the component keyed by algorithm, such as SHA256.
+	Digests map[string]string
+}
+
+type Option func(*Attestor)
+
+// WithGenerate generates an SBOM of the working directory in format, spdx or cyclonedx, in addition to recording the
+// SBOMs the step produced.
+func WithGenerate(format string) Option {
+	return func(a *Attestor) {
+		a.generate = format
+	}
+}
+
+// WithTool sets the path to the syft command.
+func WithTool(tool string) Option {
+	return func(a *Attestor) {
+		a.tool = tool
+	}
+}
+
+// Attestor records the SBOMs a step produced, and can generate one of the working directory with syft after the
+// command runs so a single run records both the provenance and the SBOM of what it built.
+type Attestor struct {
+	documents map[string]Document
+	generate  string
+	tool      string
+
+	guard.Cancellation
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		documents: make(map[string]Document),
+		tool:      defaultTool,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	for productPath, product := range ctx.Products() {
+		if !strings.EqualFold(filepath.Ext(productPath), ".json") {
+			continue
+		}
+
+		contents, err := readProduct(filepath.Join(ctx.WorkingDir(), productPath))
+		if err != nil {
+			return fmt.Errorf("failed to read %v: %w", productPath, err)
+		}
+
+		format := detectFormat(contents)
+		if format == "" {
+			log.Debugf("(attestation/sbom) %v is not an SPDX or CycloneDX document", productPath)
+			continue
+		}
+
+		a.documents[productPath] = Document{Format: format, Digest: product.Digest, Document: contents}
+	}
+
+	if a.generate != "" {
+		document, err := a.generateDocument(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to generate %v sbom: %w", a.generate, err)
+		}
+
+		a.documents[GeneratedPath] = document
+	}
+
+	if len(a.documents) == 0 {
+		return fmt.Errorf("no SPDX or CycloneDX documents were produced")
+	}
+
+	return nil
+}
+
+// generateDocument catalogs the packages of the working directory, including the products the command left in it,
+// with syft.
+func (a *Attestor) generateDocument(ctx *attestation.AttestationContext) (Document, error) {
+	output := "spdx-json"
+	if a.generate == FormatCycloneDX {
+		output = "cyclonedx-json"
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(a.Context(ctx), a.tool, "dir:.", "--output", output, "--quiet")
+	cmd.Dir = ctx.WorkingDir()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return Document{}, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	contents := bytes.TrimSpace(stdout.Bytes())
+	if format := detectFormat(contents); format != a.generate {
+		return Document{}, fmt.Errorf("%v didn't output a %v document", a.tool, a.generate)
+	}
+
+	digest, err := cryptoutil.CalculateDigestSetFromBytes(contents, ctx.Hashes())
+	if err != nil {
+		return Document{}, err
+	}
+
+	return Document{Format: a.generate, Digest: digest, Generated: true, Document: contents}, nil
+}
+
+func readProduct(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	contents, err := io.ReadAll(io.LimitReader(f, maxDocumentSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(contents) > maxDocumentSize {
+		return nil, fmt.Errorf("larger than %v bytes", maxDocumentSize)
+	}
+
+	return contents, nil
+}
+
+func detectFormat(contents []byte) string {
+	header := struct {
+		SPDXVersion string `json:"spdxVersion"`
+		BOMFormat   string `json:"bomFormat"`
+	}{}
+
+	if err := json.Unmarshal(contents, &header); err != nil {
+		return ""
+	}
+
+	switch {
+	case header.SPDXVersion != "":
+		return FormatSPDX
+	case header.BOMFormat == "CycloneDX":
+		return FormatCycloneDX
+	default:
+		return ""
+	}
+}
+
+func (a *Attestor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.documents)
+}
+
+func (a *Attestor) UnmarshalJSON(data []byte) error {
+	documents := make(map[string]Document)
+	if err := json.Unmarshal(data, &documents); err != nil {
+		return err
+	}
+
+	a.documents = documents
+	return nil
+}
+
+// Documents returns the recorded SBOMs keyed by the path of the product.
+func (a *Attestor) Documents() map[string]Document {
+	return a.documents
+}
+
+// FromCollection returns the SBOMs recorded in a collection keyed by the path of the product.
+func FromCollection(collection attestation.Collection) map[string]Document {
+	documents := make(map[string]Document)
+	for _, collectionAttestation := range collection.Attestations {
+		a, ok := collectionAttestation.Attestation.(*Attestor)
+		if !ok {
+			continue
+		}
+
+		for path, document := range a.documents {
+			documents[path] = document
+		}
+	}
+
+	return documents
+}
+
+// Components returns every package the document describes.
+func (d Document) Components() ([]Component, error) {
+	switch d.Format {
+	case FormatSPDX:
+		return spdxComponents(d.Document)
+	case FormatCycloneDX:
+		return cycloneDXComponents(d.Document)
+	default:
+		return nil, fmt.Errorf("unknown sbom format %v", d.Format)
+	}
+}
+
+type spdxDocument struct {
+	Packages []struct {
+		Name             string `json:"name"`
+		VersionInfo      string `json:"versionInfo"`
+		LicenseConcluded string `json:"licenseConcluded"`
+		LicenseDeclared  string `json:"licenseDeclared"`
+		Checksums        []struct {
+			Algorithm     string `json:"algorithm"`
+			ChecksumValue string `json:"checksumValue"`
+		} `json:"checksums"`
+		ExternalRefs []struct {
+			ReferenceType    string `json:"referenceType"`
+			ReferenceLocator string `json:"referenceLocator"`
+		} `json:"externalRefs"`
+	} `json:"packages"`
+}
+
+func spdxComponents(contents []byte) ([]Component, error) {
+	doc := spdxDocument{}
+	if err := json.Unmarshal(contents, &doc); err != nil {
+		return nil, err
+	}
+
+	components := make([]Component, 0, len(doc.Packages))
+	for _, pkg := range doc.Packages {
+		component := Component{Name: pkg.Name, Version: pkg.VersionInfo, Digests: make(map[string]string)}
+		for _, license := range []string{pkg.LicenseConcluded, pkg.LicenseDeclared} {
+			if license != "" && license != "NOASSERTION" && license != "NONE" {
+				component.License = license
+				break
+			}
+		}
+
+		for _, checksum := range pkg.Checksums {
+			component.Digests[strings.ToUpper(checksum.Algorithm)] = strings.ToLower(checksum.ChecksumValue)
+		}
+
+		for _, ref := range pkg.ExternalRefs {
+			if ref.ReferenceType == "purl" {
+				component.PURL = ref.ReferenceLocator
+			}
+		}
+
+		components = append(components, component)
+	}
+
+	return components, nil
+}
+
+type cycloneDXComponent struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	PURL     string `json:"purl"`
+	Licenses []struct {
+		License struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"license"`
+		Expression string `json:"expression"`
+	} `json:"licenses"`
+	Hashes []struct {
+		Alg     string `json:"alg"`
+		Content string `json:"content"`
+	} `json:"hashes"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+func cycloneDXComponents(contents []byte) ([]Component, error) {
+	doc := struct {
+		Components []cycloneDXComponent `json:"components"`
+	}{}
+
+	if err := json.Unmarshal(contents, &doc); err != nil {
+		return nil, err
+	}
+
+	components := []Component{}
+	var walk func([]cycloneDXComponent)
+	walk = func(cdxComponents []cycloneDXComponent) {
+		for _, cdx := range cdxComponents {
+			component := Component{Name: cdx.Name, Version: cdx.Version, PURL: cdx.PURL, Digests: make(map[string]string)}
+			licenses := []string{}
+			for _, license := range cdx.Licenses {
+				switch {
+				case license.Expression != "":
+					licenses = append(licenses, license.Expression)
+				case license.License.ID != "":
+					licenses = append(licenses, license.License.ID)
+				case license.License.Name != "":
+					licenses = append(licenses, license.License.Name)
+				}
+			}
+
+			// multiple licenses on a component all apply to it
+			if len(licenses) == 1 {
+				component.License = licenses[0]
+			} else if len(licenses) > 1 {
+				component.License = "(" + strings.Join(licenses, ") AND (") + ")"
+			}
+
+			for _, hash := range cdx.Hashes {
+				component.Digests[strings.ReplaceAll(strings.ToUpper(hash.Alg), "-", "")] = strings.ToLower(hash.Content)
+			}
+
+			components = append(components, component)
+			walk(cdx.Components)
+		}
+	}
+
+	walk(doc.Components)
+	return components, nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/product"
+)
+
+const (
+	spdxDocumentJSON = `{
+  "spdxVersion": "SPDX-2.3",
+  "packages": [{
+    "name": "log4j-core",
+    "versionInfo": "2.14.1",
+    "licenseConcluded": "NOASSERTION",
+    "licenseDeclared": "Apache-2.0",
+    "checksums": [{"algorithm": "SHA256", "checksumValue": "ABCD"}],
+    "externalRefs": [{"referenceType": "purl", "referenceLocator": "pkg:maven/org.apache.logging.log4j/log4j-core@2.14.1"}]
+  }]
+}`
+
+	cycloneDXDocumentJSON = `{
+  "bomFormat": "CycloneDX",
+  "components": [{
+    "name": "express",
+    "version": "4.18.2",
+    "purl": "pkg:npm/express@4.18.2",
+    "licenses": [{"license": {"id": "MIT"}}, {"expression": "ISC OR 0BSD"}],
+    "hashes": [{"alg": "SHA-256", "content": "ef01"}],
+    "components": [{"name": "bundled", "version": "1.0.0"}]
+  }]
+}`
+)
+
+func TestAttest(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sbom.spdx.json"), []byte(spdxDocumentJSON), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bom.json"), []byte(cycloneDXDocumentJSON), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"name": "app"}`), 0644))
+
+	a := New()
+	ctx, err := attestation.NewContext([]attestation.Attestor{product.New(), a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	documents := a.Documents()
+	require.Len(t, documents, 2)
+	require.Equal(t, FormatSPDX, documents["sbom.spdx.json"].Format)
+	require.Equal(t, FormatCycloneDX, documents["bom.json"].Format)
+	require.NotEmpty(t, documents["bom.json"].Digest)
+
+	data, err := json.Marshal(a)
+	require.NoError(t, err)
+	roundTrip := New()
+	require.NoError(t, json.Unmarshal(data, roundTrip))
+	collection := attestation.Collection{Attestations: []attestation.CollectionAttestation{{Type: Type, Attestation: roundTrip}}}
+	require.Len(t, FromCollection(collection), 2)
+}
+
+func TestAttestNoSBOM(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"name": "app"}`), 0644))
+	ctx, err := attestation.NewContext([]attestation.Attestor{product.New(), New()}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.ErrorContains(t, ctx.RunAttestors(), "no SPDX or CycloneDX documents")
+}
+
+func TestGenerateByDefault(t *testing.T) {
+	attestors, err := attestation.Attestors([]string{Name})
+	require.NoError(t, err)
+	require.Equal(t, FormatSPDX, attestors[0].(*Attestor).generate)
+
+	for _, opt := range attestation.AttestorOptions(Name) {
+		if option, ok := opt.(attestation.ConfigOption[string]); ok && option.Name() == "generate" {
+			a, err := option.Setter()(New(), "none")
+			require.NoError(t, err)
+			require.Empty(t, a.(*Attestor).generate)
+
+			_, err = option.Setter()(New(), "swid")
+			require.ErrorContains(t, err, "unknown sbom format swid")
+		}
+	}
+}
+
+func TestComponents(t *testing.T) {
+	components, err := Document{Format: FormatSPDX, Document: []byte(spdxDocumentJSON)}.Components()
+	require.NoError(t, err)
+	require.Equal(t, []Component{{
+		Name:    "log4j-core",
+		Version: "2.14.1",
+		PURL:    "pkg:maven/org.apache.logging.log4j/log4j-core@2.14.1",
+		License: "Apache-2.0",
+		Digests: map[string]string{"SHA256": "abcd"},
+	}}, components)
+
+	components, err = Document{Format: FormatCycloneDX, Document: []byte(cycloneDXDocumentJSON)}.Components()
+	require.NoError(t, err)
+	require.Len(t, components, 2)
+	require.Equal(t, "(MIT) AND (ISC OR 0BSD)", components[0].License)
+	require.Equal(t, map[string]string{"SHA256": "ef01"}, components[0].Digests)
+	require.Equal(t, "bundled", components[1].Name)
+	require.Empty(t, components[1].Digests)
+}
+
+// fakeSyft stands in for syft, describing the directory it scans with a package per file.
+const fakeSyft = `#!/bin/sh
+[ "$1" = "dir:." ] && [ "$2" = "--output" ] || exit 2
+if [ "$3" = "cyclonedx-json" ]; then
+	printf '{"bomFormat": "CycloneDX", "components": ['
+	sep=""
+	for f in *; do printf '%s{"name": "%s", "version": "1.0.0"}' "$sep" "$f"; sep=","; done
+	printf ']}\n'
+else
+	echo '{"spdxVersion": "SPDX-2.3", "packages": []}'
+fi
+`
+
+func TestAttestGenerate(t *testing.T) {
+	syft := filepath.Join(t.TempDir(), "syft")
+	require.NoError(t, os.WriteFile(syft, []byte(fakeSyft), 0755))
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app"), []byte("binary"), 0644))
+
+	a := New(WithGenerate(FormatCycloneDX), WithTool(syft))
+	ctx, err := attestation.NewContext([]attestation.Attestor{product.New(), a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	documents := a.Documents()
+	require.Len(t, documents, 1)
+	generated := documents[GeneratedPath]
+	require.True(t, generated.Generated)
+	require.Equal(t, FormatCycloneDX, generated.Format)
+	require.NotEmpty(t, generated.Digest)
+	components, err := generated.Components()
+	require.NoError(t, err)
+	require.Equal(t, []Component{{Name: "app", Version: "1.0.0", Digests: map[string]string{}}}, components)
+
+	// SBOMs the step produced are still recorded alongside the generated one
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sbom.spdx.json"), []byte(spdxDocumentJSON), 0644))
+	a = New(WithGenerate(FormatSPDX), WithTool(syft))
+	ctx, err = attestation.NewContext([]attestation.Attestor{product.New(), a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	require.Len(t, a.Documents(), 2)
+	require.Equal(t, FormatSPDX, a.Documents()[GeneratedPath].Format)
+	require.False(t, a.Documents()["sbom.spdx.json"].Generated)
+
+	a = New(WithGenerate(FormatSPDX), WithTool(filepath.Join(t.TempDir(), "missing-syft")))
+	ctx, err = attestation.NewContext([]attestation.Attestor{product.New(), a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.ErrorContains(t, ctx.RunAttestors(), "failed to generate spdx sbom")
+}
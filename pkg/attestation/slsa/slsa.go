@@ -0,0 +1,325 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slsa
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/attestation/git"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/witness/pkg/attestation/cicontext"
+	"github.com/testifysec/witness/pkg/schedule"
+	"github.com/testifysec/witness/pkg/statement"
+)
+
+const (
+	Name    = "slsa"
+	Type    = "https://slsa.dev/provenance/v1"
+	RunType = attestation.PostProductRunType
+
+	// BuildType describes how the external parameters of provenance recorded by witness are interpreted: the
+	// command is the step's command, run in the working directory the resolved dependencies were hashed in.
+	BuildType = "https://witness.dev/slsa/build-types/witness-run/v0.1"
+	// DefaultBuilderID identifies witness as the builder when no builder ID is configured.
+	DefaultBuilderID = "https://witness.dev/builders/witness-run"
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor = &Attestor{}
+)
+
+func init() {
+	schedule.RegisterDependencies(Name, commandrun.Name, git.Name, cicontext.Name)
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() },
+		attestation.StringConfigOption(
+			"builderId",
+			"ID of the builder recorded in the SLSA provenance, such as the URI of the CI system's runner. Verifiers match it against the builders they trust.",
+			DefaultBuilderID,
+			func(a attestation.Attestor, builderID string) (attestation.Attestor, error) {
+				slsaAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a slsa attestor", a)
+				}
+
+				WithBuilderID(builderID)(slsaAttestor)
+				return slsaAttestor, nil
+			},
+		),
+	)
+}
+
+// ResourceDescriptor is an artifact the build used or produced, as described by the in-toto resource descriptor.
+type ResourceDescriptor struct {
+	URI    string            `json:"uri,omitempty"`
+	Name   string            `json:"name,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+type BuildDefinition struct {
+	BuildType            string                 `json:"buildType"`
+	ExternalParameters   map[string]interface{} `json:"externalParameters"`
+	InternalParameters   map[string]interface{} `json:"internalParameters,omitempty"`
+	ResolvedDependencies []ResourceDescriptor   `json:"resolvedDependencies,omitempty"`
+}
+
+type Builder struct {
+	ID string `json:"id"`
+}
+
+type BuildMetadata struct {
+	InvocationID string     `json:"invocationId,omitempty"`
+	StartedOn    *time.Time `json:"startedOn,omitempty"`
+	FinishedOn   *time.Time `json:"finishedOn,omitempty"`
+}
+
+type RunDetails struct {
+	Builder  Builder        `json:"builder"`
+	Metadata *BuildMetadata `json:"metadata,omitempty"`
+}
+
+// Provenance is a SLSA Provenance v1.0 predicate.
+type Provenance struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+type Option func(*Attestor)
+
+// WithBuilderID sets the ID of the builder recorded in the provenance.
+func WithBuilderID(builderID string) Option {
+	return func(a *Attestor) {
+		if builderID != "" {
+			a.builderID = builderID
+		}
+	}
+}
+
+// WithEpoch records the build as starting and finishing at epoch, so when a run happened doesn't change its
+// provenance.
+func WithEpoch(epoch time.Time) Option {
+	return func(a *Attestor) {
+		a.epoch = epoch
+	}
+}
+
+// Attestor assembles a SLSA Provenance v1.0 predicate from what the other attestors of the step recorded: the
+// command from the commandrun attestor, the materials as resolved dependencies, the commit from the git attestor,
+// and the CI run from the cicontext attestor. Verifiers that only understand SLSA can read the predicate without
+// knowing about witness collections, and witness run --slsa-outfile signs it as a statement of its own with the
+// products as subjects.
+type Attestor struct {
+	Provenance
+
+	builderID string
+	epoch     time.Time
+	products  map[string]cryptoutil.DigestSet
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		builderID: DefaultBuilderID,
+		products:  make(map[string]cryptoutil.DigestSet),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	definition := BuildDefinition{
+		BuildType:          BuildType,
+		ExternalParameters: make(map[string]interface{}),
+		InternalParameters: make(map[string]interface{}),
+	}
+
+	metadata := &BuildMetadata{}
+	for _, completed := range ctx.CompletedAttestors() {
+		if completed.Error != nil {
+			continue
+		}
+
+		if metadata.StartedOn == nil || completed.StartTime.Before(*metadata.StartedOn) {
+			started := completed.StartTime.UTC()
+			metadata.StartedOn = &started
+		}
+
+		switch completed.Attestor.Name() {
+		case commandrun.Name:
+			recorded := struct {
+				Cmd []string `json:"cmd"`
+			}{}
+
+			if err := readAttestor(completed.Attestor, &recorded); err != nil {
+				return err
+			}
+
+			definition.ExternalParameters["command"] = recorded.Cmd
+		case git.Name:
+			recorded := struct {
+				CommitHash string `json:"commithash"`
+			}{}
+
+			if err := readAttestor(completed.Attestor, &recorded); err != nil {
+				return err
+			}
+
+			if recorded.CommitHash != "" {
+				definition.ResolvedDependencies = append(definition.ResolvedDependencies, ResourceDescriptor{
+					Name:   "git",
+					Digest: map[string]string{"gitCommit": recorded.CommitHash},
+				})
+			}
+		case cicontext.Name:
+			recorded := cicontext.Attestor{}
+			if err := readAttestor(completed.Attestor, &recorded); err != nil {
+				return err
+			}
+
+			metadata.InvocationID = recorded.PipelineURL
+			if metadata.InvocationID == "" {
+				metadata.InvocationID = recorded.RunID
+			}
+
+			if recorded.Repository != "" {
+				definition.ExternalParameters["repository"] = recorded.Repository
+			}
+
+			if recorded.Ref != "" {
+				definition.ExternalParameters["ref"] = recorded.Ref
+			}
+
+			definition.InternalParameters["ci"] = recorded
+		}
+	}
+
+	materials, err := resourceDescriptors(ctx.Materials())
+	if err != nil {
+		return fmt.Errorf("failed to describe materials: %w", err)
+	}
+
+	definition.ResolvedDependencies = append(definition.ResolvedDependencies, materials...)
+	for path, product := range ctx.Products() {
+		a.products[path] = product.Digest
+	}
+
+	if len(definition.InternalParameters) == 0 {
+		definition.InternalParameters = nil
+	}
+
+	finished := time.Now().UTC()
+	metadata.FinishedOn = &finished
+	if !a.epoch.IsZero() {
+		epoch := a.epoch.UTC()
+		metadata.StartedOn, metadata.FinishedOn = &epoch, &epoch
+	}
+
+	a.BuildDefinition = definition
+	a.RunDetails = RunDetails{Builder: Builder{ID: a.builderID}, Metadata: metadata}
+	return nil
+}
+
+// Statement returns an in-toto statement with the provenance as its predicate and the products of the step as its
+// subjects, for verifiers that read SLSA provenance rather than witness collections.
+func (a *Attestor) Statement() (intoto.Statement, error) {
+	predicate, err := json.Marshal(&a.Provenance)
+	if err != nil {
+		return intoto.Statement{}, err
+	}
+
+	if predicate, err = statement.Canonicalize(predicate); err != nil {
+		return intoto.Statement{}, err
+	}
+
+	paths := make([]string, 0, len(a.products))
+	for path := range a.products {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+	st := intoto.Statement{
+		Type:          intoto.StatementType,
+		PredicateType: Type,
+		Subject:       make([]intoto.Subject, 0, len(paths)),
+		Predicate:     predicate,
+	}
+
+	for _, path := range paths {
+		subject, err := intoto.DigestSetToSubject(path, a.products[path])
+		if err != nil {
+			return intoto.Statement{}, err
+		}
+
+		st.Subject = append(st.Subject, subject)
+	}
+
+	return st, nil
+}
+
+// readAttestor reads what another attestor recorded through its JSON, since the attestor may be wrapped.
+func readAttestor(attestor attestation.Attestor, v interface{}) error {
+	data, err := json.Marshal(attestor)
+	if err != nil {
+		return fmt.Errorf("failed to read %v attestor: %w", attestor.Name(), err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to read %v attestor: %w", attestor.Name(), err)
+	}
+
+	return nil
+}
+
+func resourceDescriptors(digests map[string]cryptoutil.DigestSet) ([]ResourceDescriptor, error) {
+	paths := make([]string, 0, len(digests))
+	for path := range digests {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+	descriptors := make([]ResourceDescriptor, 0, len(paths))
+	for _, path := range paths {
+		digest, err := digests[path].ToNameMap()
+		if err != nil {
+			return nil, err
+		}
+
+		descriptors = append(descriptors, ResourceDescriptor{Name: path, Digest: digest})
+	}
+
+	return descriptors, nil
+}
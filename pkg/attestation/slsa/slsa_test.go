@@ -0,0 +1,73 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slsa
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/attestation/material"
+	"github.com/testifysec/go-witness/attestation/product"
+)
+
+func TestAttest(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.c"), []byte("int main() { return 0; }"), 0644))
+
+	a := New(WithBuilderID("https://ci.example.com/runners/1"))
+	ctx, err := attestation.NewContext([]attestation.Attestor{
+		material.New(),
+		commandrun.New(commandrun.WithCommand([]string{"bash", "-c", "echo built > app"})),
+		product.New(),
+		a,
+	}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	require.Equal(t, BuildType, a.BuildDefinition.BuildType)
+	require.Equal(t, []string{"bash", "-c", "echo built > app"}, a.BuildDefinition.ExternalParameters["command"])
+	require.Len(t, a.BuildDefinition.ResolvedDependencies, 1)
+	require.Equal(t, "main.c", a.BuildDefinition.ResolvedDependencies[0].Name)
+	require.NotEmpty(t, a.BuildDefinition.ResolvedDependencies[0].Digest["sha256"])
+	require.Equal(t, "https://ci.example.com/runners/1", a.RunDetails.Builder.ID)
+	require.False(t, a.RunDetails.Metadata.StartedOn.After(*a.RunDetails.Metadata.FinishedOn))
+
+	st, err := a.Statement()
+	require.NoError(t, err)
+	require.Equal(t, Type, st.PredicateType)
+	require.Len(t, st.Subject, 1)
+	require.Equal(t, "app", st.Subject[0].Name)
+
+	provenance := Provenance{}
+	require.NoError(t, json.Unmarshal(st.Predicate, &provenance))
+	require.Equal(t, a.Provenance.BuildDefinition.ResolvedDependencies, provenance.BuildDefinition.ResolvedDependencies)
+}
+
+func TestAttestEpoch(t *testing.T) {
+	epoch := time.Unix(1700000000, 0).UTC()
+	a := New(WithEpoch(epoch))
+	ctx, err := attestation.NewContext([]attestation.Attestor{a}, attestation.WithWorkingDir(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	require.Equal(t, epoch, *a.RunDetails.Metadata.StartedOn)
+	require.Equal(t, epoch, *a.RunDetails.Metadata.FinishedOn)
+	require.Equal(t, DefaultBuilderID, a.RunDetails.Builder.ID)
+}
@@ -0,0 +1,162 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subjectname
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+const (
+	Name    = "subjectname"
+	Type    = "https://witness.dev/attestations/subjectname/v0.1"
+	RunType = attestation.PostProductRunType
+
+	subjectPrefix = "name:"
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor  = &Attestor{}
+	_ attestation.Subjecter = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// NamedSubject is an artifact of the step that was given a human readable name.
+type NamedSubject struct {
+	Path   string               `json:"path"`
+	Digest cryptoutil.DigestSet `json:"digest"`
+}
+
+type Attestor struct {
+	// paths maps the path of an artifact to the name it should be recorded under
+	paths    map[string]string
+	subjects map[string]NamedSubject
+}
+
+type Option func(*Attestor)
+
+// WithNames sets the names to record, keyed by the path of the product or material, relative to the working directory.
+func WithNames(names map[string]string) Option {
+	return func(a *Attestor) {
+		a.paths = names
+	}
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		paths:    make(map[string]string),
+		subjects: make(map[string]NamedSubject),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	products := ctx.Products()
+	materials := ctx.Materials()
+	for path, name := range a.paths {
+		if name == "" {
+			return fmt.Errorf("subject name for %v must not be empty", path)
+		}
+
+		if existing, ok := a.subjects[name]; ok {
+			return fmt.Errorf("subject name %v is used for both %v and %v", name, existing.Path, path)
+		}
+
+		cleanPath := filepath.ToSlash(filepath.Clean(path))
+		var digest cryptoutil.DigestSet
+		if product, ok := products[cleanPath]; ok {
+			digest = product.Digest
+		} else if material, ok := materials[cleanPath]; ok {
+			digest = material
+		} else {
+			return fmt.Errorf("cannot name %v as %v: it is not a product or material of the step", path, name)
+		}
+
+		a.subjects[name] = NamedSubject{Path: cleanPath, Digest: digest}
+	}
+
+	return nil
+}
+
+func (a *Attestor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.subjects)
+}
+
+func (a *Attestor) UnmarshalJSON(data []byte) error {
+	subjects := make(map[string]NamedSubject)
+	if err := json.Unmarshal(data, &subjects); err != nil {
+		return err
+	}
+
+	a.subjects = subjects
+	return nil
+}
+
+// Names returns the recorded subjects keyed by their name.
+func (a *Attestor) Names() map[string]NamedSubject {
+	return a.subjects
+}
+
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for name, subject := range a.subjects {
+		subjects[subjectPrefix+name] = subject.Digest
+	}
+
+	return subjects
+}
+
+// FromCollection returns the named subjects recorded in a collection, keyed by name.
+func FromCollection(collection attestation.Collection) map[string]NamedSubject {
+	names := make(map[string]NamedSubject)
+	for _, collectionAttestation := range collection.Attestations {
+		a, ok := collectionAttestation.Attestation.(*Attestor)
+		if !ok {
+			continue
+		}
+
+		for name, subject := range a.subjects {
+			names[name] = subject
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,57 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subjectname
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/product"
+)
+
+func TestAttest(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.tar.gz"), []byte("release"), 0644))
+
+	a := New(WithNames(map[string]string{"./app.tar.gz": "release-artifact"}))
+	ctx, err := attestation.NewContext([]attestation.Attestor{product.New(), a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	require.Contains(t, a.Names(), "release-artifact")
+	require.Equal(t, "app.tar.gz", a.Names()["release-artifact"].Path)
+	subjects := a.Subjects()
+	require.Contains(t, subjects, "name:release-artifact")
+
+	data, err := json.Marshal(a)
+	require.NoError(t, err)
+	collection := attestation.Collection{Attestations: []attestation.CollectionAttestation{{Type: Type, Attestation: a}}}
+	require.Equal(t, a.Names(), FromCollection(collection))
+
+	roundTrip := New()
+	require.NoError(t, json.Unmarshal(data, roundTrip))
+	require.Equal(t, a.Names(), roundTrip.Names())
+}
+
+func TestAttestMissingArtifact(t *testing.T) {
+	a := New(WithNames(map[string]string{"missing.bin": "release-artifact"}))
+	ctx, err := attestation.NewContext([]attestation.Attestor{product.New(), a}, attestation.WithWorkingDir(t.TempDir()))
+	require.NoError(t, err)
+	require.ErrorContains(t, ctx.RunAttestors(), "not a product or material")
+}
@@ -0,0 +1,260 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package subjectsource adds subjects to the statement that aren't products of the step, such as an image a build
+// tool pushed straight to a registry. Subjects are read as name=digest pairs from files or from the output of
+// commands.
+package subjectsource
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/witness/pkg/guard"
+)
+
+const (
+	Name    = "subjectsource"
+	Type    = "https://witness.dev/attestations/subjectsource/v0.1"
+	RunType = attestation.PostProductRunType
+
+	subjectPrefix = "external:"
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor  = &Attestor{}
+	_ attestation.Subjecter = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Source is where subjects were read from. Exactly one of File and Command is set, and Digest is the digest of the
+// file's contents.
+type Source struct {
+	File     string                          `json:"file,omitempty"`
+	Digest   cryptoutil.DigestSet            `json:"digest,omitempty"`
+	Command  string                          `json:"command,omitempty"`
+	Subjects map[string]cryptoutil.DigestSet `json:"subjects"`
+}
+
+func (s Source) String() string {
+	if s.File != "" {
+		return s.File
+	}
+
+	return fmt.Sprintf("output of %q", s.Command)
+}
+
+type Attestor struct {
+	Sources []Source `json:"sources"`
+
+	files    []string
+	commands []string
+
+	guard.Cancellation
+}
+
+type Option func(*Attestor)
+
+// WithFiles reads subjects from the files at paths, which are relative to the working directory.
+func WithFiles(paths []string) Option {
+	return func(a *Attestor) {
+		a.files = paths
+	}
+}
+
+// WithCommands reads subjects from the output of commands, which are run by the shell in the working directory
+// after the step's command.
+func WithCommands(commands []string) Option {
+	return func(a *Attestor) {
+		a.commands = commands
+	}
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	a.Sources = []Source{}
+	for _, path := range a.files {
+		source := Source{File: path}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(ctx.WorkingDir(), path)
+		}
+
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read subjects: %w", err)
+		}
+
+		if source.Digest, err = cryptoutil.CalculateDigestSetFromBytes(contents, ctx.Hashes()); err != nil {
+			return fmt.Errorf("failed to hash %v: %w", source, err)
+		}
+
+		if source.Subjects, err = Parse(bytes.NewReader(contents)); err != nil {
+			return fmt.Errorf("failed to read subjects from %v: %w", source, err)
+		}
+
+		a.Sources = append(a.Sources, source)
+	}
+
+	for _, command := range a.commands {
+		source := Source{Command: command}
+		output, err := a.runCommand(ctx, command)
+		if err != nil {
+			return fmt.Errorf("failed to read subjects from %v: %w", source, err)
+		}
+
+		if source.Subjects, err = Parse(bytes.NewReader(output)); err != nil {
+			return fmt.Errorf("failed to read subjects from %v: %w", source, err)
+		}
+
+		a.Sources = append(a.Sources, source)
+	}
+
+	names := map[string]Source{}
+	for _, source := range a.Sources {
+		for name := range source.Subjects {
+			if other, ok := names[name]; ok {
+				return fmt.Errorf("subject %v is read from both %v and %v", name, other, source)
+			}
+
+			names[name] = source
+		}
+	}
+
+	return nil
+}
+
+// runCommand runs command with the shell in the working directory and returns what it writes to stdout.
+func (a *Attestor) runCommand(ctx *attestation.AttestationContext, command string) ([]byte, error) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+
+	cmd := exec.CommandContext(a.Context(ctx), shell, flag, command)
+	cmd.Dir = ctx.WorkingDir()
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return output, nil
+}
+
+// Parse reads subjects from lines of name=digest pairs. Digests are algorithm:hex, such as sha256:abc..., or a
+// bare sha256 hex digest. A name given several digests, one per line, is recorded with all of them. Blank lines and
+// lines starting with # are skipped.
+func Parse(r io.Reader) (map[string]cryptoutil.DigestSet, error) {
+	subjects := map[string]cryptoutil.DigestSet{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		i := strings.LastIndex(text, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %v: expected name=digest, got %q", line, text)
+		}
+
+		name, digest := strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+		value, hexDigest, err := parseDigest(digest)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", line, err)
+		}
+
+		if _, ok := subjects[name]; !ok {
+			subjects[name] = cryptoutil.DigestSet{}
+		}
+
+		if existing, ok := subjects[name][value]; ok && existing != hexDigest {
+			return nil, fmt.Errorf("line %v: %v is given two different %v digests", line, name, value.Hash)
+		}
+
+		subjects[name][value] = hexDigest
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return subjects, nil
+}
+
+func parseDigest(digest string) (cryptoutil.DigestValue, string, error) {
+	algorithm, hexDigest := "sha256", digest
+	if i := strings.Index(digest, ":"); i >= 0 {
+		algorithm, hexDigest = digest[:i], digest[i+1:]
+	}
+
+	hash, err := cryptoutil.HashFromString(strings.ToLower(algorithm))
+	if err != nil {
+		return cryptoutil.DigestValue{}, "", fmt.Errorf("unsupported digest algorithm %v", algorithm)
+	}
+
+	hexDigest = strings.ToLower(hexDigest)
+	if decoded, err := hex.DecodeString(hexDigest); err != nil || len(decoded) != hash.Size() {
+		return cryptoutil.DigestValue{}, "", fmt.Errorf("%v is not a %v digest", digest, algorithm)
+	}
+
+	return cryptoutil.DigestValue{Hash: hash}, hexDigest, nil
+}
+
+func (a *Attestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for _, source := range a.Sources {
+		for name, digest := range source.Subjects {
+			subjects[subjectPrefix+name] = digest
+		}
+	}
+
+	return subjects
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subjectsource
+
+import (
+	"crypto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+var (
+	sha256Digest = strings.Repeat("ab", 32)
+	sha1Digest   = strings.Repeat("cd", 20)
+)
+
+func TestParse(t *testing.T) {
+	subjects, err := Parse(strings.NewReader("# images\n\nghcr.io/org/app=sha256:" + strings.ToUpper(sha256Digest) + "\nghcr.io/org/app = sha1:" + sha1Digest + "\nrelease.tar.gz=" + sha256Digest + "\n"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]cryptoutil.DigestSet{
+		"ghcr.io/org/app": {{Hash: crypto.SHA256}: sha256Digest, {Hash: crypto.SHA1}: sha1Digest},
+		"release.tar.gz":  {{Hash: crypto.SHA256}: sha256Digest},
+	}, subjects)
+
+	for input, message := range map[string]string{
+		"app":                      "expected name=digest",
+		"app=md5:" + sha1Digest:    "unsupported digest algorithm md5",
+		"app=sha256:" + sha1Digest: "is not a sha256 digest",
+		"app=sha256:zz":            "is not a sha256 digest",
+		"app=" + sha256Digest + "\napp=sha256:" + strings.Repeat("0", 64): "app is given two different SHA-256 digests",
+	} {
+		_, err := Parse(strings.NewReader(input))
+		require.ErrorContains(t, err, message, input)
+	}
+}
+
+func TestAttest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "subjects.txt")
+	require.NoError(t, os.WriteFile(path, []byte("app="+sha256Digest+"\n"), 0644))
+	ctx, err := attestation.NewContext([]attestation.Attestor{}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+
+	a := New(WithFiles([]string{"subjects.txt"}), WithCommands([]string{"echo lib=sha1:" + sha1Digest}))
+	require.NoError(t, a.Attest(ctx))
+	require.Len(t, a.Sources, 2)
+	require.Equal(t, "subjects.txt", a.Sources[0].File)
+	fileDigest, err := cryptoutil.CalculateDigestSetFromFile(path, ctx.Hashes())
+	require.NoError(t, err)
+	require.Equal(t, fileDigest, a.Sources[0].Digest)
+	require.Equal(t, "echo lib=sha1:"+sha1Digest, a.Sources[1].Command)
+	require.Equal(t, map[string]cryptoutil.DigestSet{
+		"external:app": {{Hash: crypto.SHA256}: sha256Digest},
+		"external:lib": {{Hash: crypto.SHA1}: sha1Digest},
+	}, a.Subjects())
+
+	a = New(WithFiles([]string{path}), WithCommands([]string{"echo app=" + sha256Digest}))
+	require.ErrorContains(t, a.Attest(ctx), "subject app is read from both "+path+" and output of")
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracestatus
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	capSysPtrace = 19
+	// ptrace_scope 2 limits ptrace to processes with CAP_SYS_PTRACE, and 3 disables it entirely
+	ptraceScopeAdmin    = 2
+	ptraceScopeDisabled = 3
+	seccompFilter       = "2"
+)
+
+// Detect checks whether the host can trace commands by tracing a child process the same way commandrun does, and
+// explains any failure from the process's capabilities, the Yama ptrace scope, and seccomp.
+func Detect() Capability {
+	err := probe()
+	if err == nil {
+		return Capability{Available: true}
+	}
+
+	return Capability{Missing: append([]string{fmt.Sprintf("ptrace failed: %v", err)}, diagnose()...)}
+}
+
+// probe starts this executable as a traced child, sets the options commandrun uses, and kills it before it runs.
+func probe() error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// ptrace requests must come from the thread that started the tracee
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	proc, err := os.StartProcess(self, []string{self}, &os.ProcAttr{Sys: &syscall.SysProcAttr{Ptrace: true}})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = proc.Kill()
+		_, _ = proc.Wait()
+	}()
+
+	status := syscall.WaitStatus(0)
+	if _, err := syscall.Wait4(proc.Pid, &status, 0, nil); err != nil {
+		return err
+	}
+
+	if !status.Stopped() {
+		return fmt.Errorf("traced child did not stop")
+	}
+
+	return syscall.PtraceSetOptions(proc.Pid, syscall.PTRACE_O_TRACESYSGOOD|syscall.PTRACE_O_TRACEEXEC|syscall.PTRACE_O_TRACEEXIT|syscall.PTRACE_O_TRACEFORK|syscall.PTRACE_O_TRACECLONE)
+}
+
+func diagnose() []string {
+	missing := []string{}
+	hasCap := hasCapability(capSysPtrace)
+	if scope, err := os.ReadFile("/proc/sys/kernel/yama/ptrace_scope"); err == nil {
+		level, err := strconv.Atoi(strings.TrimSpace(string(scope)))
+		switch {
+		case err != nil:
+		case level >= ptraceScopeDisabled:
+			missing = append(missing, fmt.Sprintf("kernel.yama.ptrace_scope is %v, which disables ptrace", level))
+		case level >= ptraceScopeAdmin && !hasCap:
+			missing = append(missing, fmt.Sprintf("kernel.yama.ptrace_scope is %v, which requires CAP_SYS_PTRACE", level))
+		}
+	}
+
+	if !hasCap {
+		missing = append(missing, "the process does not have CAP_SYS_PTRACE")
+	}
+
+	if procStatus("Seccomp") == seccompFilter {
+		missing = append(missing, "a seccomp filter is active and may block ptrace")
+	}
+
+	if tracer := procStatus("TracerPid"); tracer != "" && tracer != "0" {
+		missing = append(missing, fmt.Sprintf("witness is already being traced by process %v", tracer))
+	}
+
+	return missing
+}
+
+func hasCapability(capability uint) bool {
+	effective, err := strconv.ParseUint(procStatus("CapEff"), 16, 64)
+	return err == nil && effective&(1<<capability) != 0
+}
+
+func procStatus(field string) string {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return ""
+	}
+
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, field+":") {
+			return strings.TrimSpace(strings.TrimPrefix(line, field+":"))
+		}
+	}
+
+	return ""
+}
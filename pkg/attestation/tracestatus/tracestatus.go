@@ -0,0 +1,104 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracestatus
+
+import (
+	"github.com/testifysec/go-witness/attestation"
+)
+
+const (
+	Name    = "tracestatus"
+	Type    = "https://witness.dev/attestations/tracestatus/v0.1"
+	RunType = attestation.PreMaterialRunType
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Capability describes whether the host can trace commands, and if it can't, everything found to be missing.
+type Capability struct {
+	Available bool     `json:"available"`
+	Missing   []string `json:"missing,omitempty"`
+}
+
+// Unprobed is the capability of a host that wasn't probed for tracing, since probing runs a traced process and is
+// only worth it when a step asks to be traced.
+var Unprobed = Capability{Missing: []string{"the host wasn't probed, since tracing wasn't requested"}}
+
+// Attestor records whether tracing was requested for a step and whether it actually ran, so a policy can tell
+// evidence recorded in degraded mode apart from evidence with a full process trace.
+type Attestor struct {
+	Requested  bool       `json:"requested"`
+	Enabled    bool       `json:"enabled"`
+	Degraded   bool       `json:"degraded"`
+	Capability Capability `json:"capability"`
+
+	detect func() Capability
+}
+
+type Option func(*Attestor)
+
+// WithRequested records whether tracing was requested for the step. Tracing isn't assumed to be requested, so an
+// attestor added with -a trace-status records a step that wasn't traced rather than a degraded one.
+func WithRequested(requested bool) Option {
+	return func(a *Attestor) {
+		a.Requested = requested
+	}
+}
+
+// WithCapability records a capability that was already detected instead of detecting it again.
+func WithCapability(capability Capability) Option {
+	return func(a *Attestor) {
+		a.detect = func() Capability { return capability }
+	}
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		detect: Detect,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	a.Capability = a.detect()
+	a.Enabled = a.Requested && a.Capability.Available
+	a.Degraded = a.Requested && !a.Capability.Available
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracestatus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+)
+
+func TestAttestDegraded(t *testing.T) {
+	ctx, err := attestation.NewContext([]attestation.Attestor{})
+	require.NoError(t, err)
+	unavailable := Capability{Missing: []string{"the process does not have CAP_SYS_PTRACE"}}
+	a := New(WithRequested(true), WithCapability(unavailable))
+	require.NoError(t, a.Attest(ctx))
+	require.True(t, a.Requested)
+	require.False(t, a.Enabled)
+	require.True(t, a.Degraded)
+	require.Equal(t, unavailable, a.Capability)
+
+	a = New(WithRequested(true), WithCapability(Capability{Available: true}))
+	require.NoError(t, a.Attest(ctx))
+	require.True(t, a.Enabled)
+	require.False(t, a.Degraded)
+
+	a = New(WithCapability(unavailable))
+	require.NoError(t, a.Attest(ctx))
+	require.False(t, a.Requested)
+	require.False(t, a.Enabled)
+	require.False(t, a.Degraded)
+}
+
+func TestDetect(t *testing.T) {
+	capability := Detect()
+	if capability.Available {
+		require.Empty(t, capability.Missing)
+	} else {
+		require.NotEmpty(t, capability.Missing)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upstream
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/product"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+)
+
+const (
+	Name    = "upstream"
+	Type    = "https://witness.dev/attestations/upstream/v0.1"
+	RunType = attestation.PreMaterialRunType
+
+	productFilePrefix = product.Type + "/file:"
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor   = &Attestor{}
+	_ attestation.Materialer = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Input is a signed attestation of an upstream step whose signature has already been verified.
+type Input struct {
+	Reference string
+	Envelope  dsse.Envelope
+	Signers   []string
+}
+
+// Upstream records an upstream attestation whose subjects were consumed by the step.
+type Upstream struct {
+	Reference     string                          `json:"reference"`
+	Step          string                          `json:"step"`
+	Signers       []string                        `json:"signers"`
+	PayloadDigest cryptoutil.DigestSet            `json:"payloaddigest"`
+	Subjects      map[string]cryptoutil.DigestSet `json:"subjects"`
+}
+
+type Attestor struct {
+	inputs   []Input
+	upstream []Upstream
+}
+
+type Option func(*Attestor)
+
+// WithInputs sets the verified upstream attestations to record
+func WithInputs(inputs []Input) Option {
+	return func(a *Attestor) {
+		a.inputs = inputs
+	}
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+// Attest records each upstream attestation. Subjects that are files produced upstream and that exist in the
+// working directory must still have the digest the upstream attestation recorded.
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	for _, input := range a.inputs {
+		upstream, err := newUpstream(input, ctx.Hashes())
+		if err != nil {
+			return fmt.Errorf("failed to record upstream attestation %v: %w", input.Reference, err)
+		}
+
+		for name, digest := range upstream.Subjects {
+			path, ok := productPath(name)
+			if !ok {
+				continue
+			}
+
+			if err := checkFile(ctx.WorkingDir(), path, digest, ctx.Hashes()); err != nil {
+				return fmt.Errorf("upstream attestation %v: %w", input.Reference, err)
+			}
+		}
+
+		a.upstream = append(a.upstream, upstream)
+	}
+
+	return nil
+}
+
+func (a *Attestor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.upstream)
+}
+
+func (a *Attestor) UnmarshalJSON(data []byte) error {
+	upstream := make([]Upstream, 0)
+	if err := json.Unmarshal(data, &upstream); err != nil {
+		return err
+	}
+
+	a.upstream = upstream
+	return nil
+}
+
+func (a *Attestor) Upstream() []Upstream {
+	return a.upstream
+}
+
+// Materials returns the subjects of the upstream attestations. Files produced upstream are keyed by their path,
+// like the files the material attestor records, and other subjects by their name.
+func (a *Attestor) Materials() map[string]cryptoutil.DigestSet {
+	materials := make(map[string]cryptoutil.DigestSet)
+	for _, upstream := range a.upstream {
+		for name, digest := range upstream.Subjects {
+			if path, ok := productPath(name); ok {
+				name = path
+			}
+
+			materials[name] = digest
+		}
+	}
+
+	return materials
+}
+
+func newUpstream(input Input, hashes []crypto.Hash) (Upstream, error) {
+	statement := intoto.Statement{}
+	if err := json.Unmarshal(input.Envelope.Payload, &statement); err != nil {
+		return Upstream{}, fmt.Errorf("could not parse statement: %w", err)
+	}
+
+	// only the collection's name is needed, so the attestations aren't parsed
+	collection := struct {
+		Name string `json:"name"`
+	}{}
+
+	if err := json.Unmarshal(statement.Predicate, &collection); err != nil {
+		return Upstream{}, fmt.Errorf("could not parse attestation collection: %w", err)
+	}
+
+	payloadDigest, err := cryptoutil.CalculateDigestSetFromBytes(input.Envelope.Payload, hashes)
+	if err != nil {
+		return Upstream{}, err
+	}
+
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for _, subject := range statement.Subject {
+		ds, err := cryptoutil.NewDigestSet(subject.Digest)
+		if err != nil {
+			continue
+		}
+
+		subjects[subject.Name] = ds
+	}
+
+	if len(subjects) == 0 {
+		return Upstream{}, errors.New("attestation has no subjects")
+	}
+
+	signers := append([]string{}, input.Signers...)
+	sort.Strings(signers)
+	return Upstream{
+		Reference:     input.Reference,
+		Step:          collection.Name,
+		Signers:       signers,
+		PayloadDigest: payloadDigest,
+		Subjects:      subjects,
+	}, nil
+}
+
+// productPath returns the path of a file subject recorded by the product attestor.
+func productPath(subjectName string) (string, bool) {
+	if !strings.HasPrefix(subjectName, productFilePrefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(subjectName, productFilePrefix), true
+}
+
+// checkFile checks that the file at path, if it exists, has the digest recorded upstream.
+func checkFile(workingDir, path string, expected cryptoutil.DigestSet, hashes []crypto.Hash) error {
+	fullPath := filepath.Join(workingDir, filepath.FromSlash(path))
+	if _, err := os.Stat(fullPath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	actual, err := cryptoutil.CalculateDigestSetFromFile(fullPath, hashes)
+	if err != nil {
+		return err
+	}
+
+	if !actual.Equal(expected) {
+		return fmt.Errorf("%v does not match the digest recorded upstream", path)
+	}
+
+	return nil
+}
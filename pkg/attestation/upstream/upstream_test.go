@@ -0,0 +1,82 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upstream
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+)
+
+func upstreamInput(digest string) Input {
+	payload := []byte(fmt.Sprintf(`{"_type":"https://in-toto.io/Statement/v0.1","subject":[{"name":"https://witness.dev/attestations/product/v0.1/file:app.tar.gz","digest":{"sha256":"%v"}},{"name":"https://witness.dev/attestations/git/v0.1/commithash:abcd","digest":{"sha1":"abcd"}}],"predicateType":"https://witness.testifysec.com/attestation-collection/v0.1","predicate":{"name":"build","attestations":[]}}`, digest))
+	return Input{
+		Reference: "build.json",
+		Envelope:  dsse.Envelope{Payload: payload, PayloadType: "application/vnd.in-toto+json"},
+		Signers:   []string{"key"},
+	}
+}
+
+func TestAttest(t *testing.T) {
+	workingDir := t.TempDir()
+	contents := []byte("release")
+	require.NoError(t, os.WriteFile(filepath.Join(workingDir, "app.tar.gz"), contents, 0644))
+	digest := sha256.Sum256(contents)
+
+	a := New(WithInputs([]Input{upstreamInput(hex.EncodeToString(digest[:]))}))
+	ctx, err := attestation.NewContext([]attestation.Attestor{a}, attestation.WithWorkingDir(workingDir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	require.Len(t, a.Upstream(), 1)
+	require.Equal(t, "build", a.Upstream()[0].Step)
+	require.Equal(t, []string{"key"}, a.Upstream()[0].Signers)
+	materials := a.Materials()
+	require.Contains(t, materials, "app.tar.gz")
+	require.Contains(t, materials, "https://witness.dev/attestations/git/v0.1/commithash:abcd")
+	require.True(t, materials["app.tar.gz"].Equal(cryptoutil.DigestSet{cryptoutil.DigestValue{Hash: crypto.SHA256}: hex.EncodeToString(digest[:])}))
+
+	data, err := json.Marshal(a)
+	require.NoError(t, err)
+	roundTrip := New()
+	require.NoError(t, json.Unmarshal(data, roundTrip))
+	require.Equal(t, a.Upstream(), roundTrip.Upstream())
+}
+
+func TestAttestMismatchedFile(t *testing.T) {
+	workingDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workingDir, "app.tar.gz"), []byte("tampered"), 0644))
+	digest := sha256.Sum256([]byte("release"))
+
+	ctx, err := attestation.NewContext([]attestation.Attestor{New(WithInputs([]Input{upstreamInput(hex.EncodeToString(digest[:]))}))}, attestation.WithWorkingDir(workingDir))
+	require.NoError(t, err)
+	require.ErrorContains(t, ctx.RunAttestors(), "does not match the digest recorded upstream")
+}
+
+func TestAttestMissingFile(t *testing.T) {
+	ctx, err := attestation.NewContext([]attestation.Attestor{New(WithInputs([]Input{upstreamInput("abcd")}))}, attestation.WithWorkingDir(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+}
@@ -0,0 +1,462 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vuln
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/witness/pkg/guard"
+)
+
+const (
+	Name    = "vuln"
+	Type    = "https://witness.dev/attestations/vuln/v0.1"
+	RunType = attestation.PostProductRunType
+
+	ScannerGrype = "grype"
+	ScannerTrivy = "trivy"
+
+	// maxReportSize bounds how much of a report is read.
+	maxReportSize = 64 << 20
+)
+
+// Severities are the severities findings are recorded with, from least to most severe. Scanners' own ratings, such
+// as grype's negligible, are mapped onto them.
+var Severities = []string{"none", "low", "medium", "high", "critical"}
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() },
+		attestation.StringConfigOption(
+			"scanner",
+			"Scanner to run after the command, one of grype or trivy.",
+			ScannerGrype,
+			func(a attestation.Attestor, scanner string) (attestation.Attestor, error) {
+				vulnAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a vuln attestor", a)
+				}
+
+				if scanner != ScannerGrype && scanner != ScannerTrivy {
+					return a, fmt.Errorf("unknown scanner %v, expected %v or %v", scanner, ScannerGrype, ScannerTrivy)
+				}
+
+				WithScanner(scanner)(vulnAttestor)
+				return vulnAttestor, nil
+			},
+		),
+		attestation.StringConfigOption(
+			"scannerPath",
+			"Path to the scanner command. Defaults to the scanner's name.",
+			"",
+			func(a attestation.Attestor, tool string) (attestation.Attestor, error) {
+				vulnAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a vuln attestor", a)
+				}
+
+				WithTool(tool)(vulnAttestor)
+				return vulnAttestor, nil
+			},
+		),
+		attestation.StringConfigOption(
+			"target",
+			"Product to scan, such as an image tarball, relative to the working directory. Defaults to the whole working directory.",
+			".",
+			func(a attestation.Attestor, target string) (attestation.Attestor, error) {
+				vulnAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a vuln attestor", a)
+				}
+
+				WithTarget(target)(vulnAttestor)
+				return vulnAttestor, nil
+			},
+		),
+		attestation.StringConfigOption(
+			"report",
+			"Product holding a grype or trivy JSON report the command wrote, to record instead of running a scanner.",
+			"",
+			func(a attestation.Attestor, report string) (attestation.Attestor, error) {
+				vulnAttestor, ok := a.(*Attestor)
+				if !ok {
+					return a, fmt.Errorf("unexpected attestor type: %T is not a vuln attestor", a)
+				}
+
+				WithReport(report)(vulnAttestor)
+				return vulnAttestor, nil
+			},
+		),
+	)
+}
+
+// Finding is a vulnerability found in a package.
+type Finding struct {
+	ID       string `json:"id"`
+	Severity string `json:"severity"`
+	Package  string `json:"package,omitempty"`
+	Version  string `json:"version,omitempty"`
+	// FixedIn are the versions of the package the vulnerability is fixed in, empty if there is no fix.
+	FixedIn []string `json:"fixedin,omitempty"`
+	// Location is where the scanner found the package, such as a lock file or a path in an image.
+	Location string `json:"location,omitempty"`
+}
+
+type Option func(*Attestor)
+
+// WithScanner sets the scanner to run, grype or trivy.
+func WithScanner(scanner string) Option {
+	return func(a *Attestor) {
+		a.Scanner = scanner
+	}
+}
+
+// WithTool sets the path to the scanner command.
+func WithTool(tool string) Option {
+	return func(a *Attestor) {
+		a.tool = tool
+	}
+}
+
+// WithTarget sets the product to scan, relative to the working directory.
+func WithTarget(target string) Option {
+	return func(a *Attestor) {
+		if target != "" {
+			a.Target = target
+		}
+	}
+}
+
+// WithReport records the grype or trivy JSON report at path, a product of the step, instead of running a scanner.
+func WithReport(path string) Option {
+	return func(a *Attestor) {
+		a.report = path
+	}
+}
+
+// Attestor scans what the step built for vulnerabilities with grype or trivy after the command runs, or records a
+// report the command wrote with either, so policies can fail builds with vulnerabilities above a severity. Findings
+// are normalized across scanners and sorted from most to least severe.
+type Attestor struct {
+	Scanner        string `json:"scanner"`
+	ScannerVersion string `json:"scannerversion,omitempty"`
+	Target         string `json:"target"`
+	// ReportDigest is the digest of the report product that was recorded, when the scanner wasn't run.
+	ReportDigest cryptoutil.DigestSet `json:"reportdigest,omitempty"`
+	Findings     []Finding            `json:"findings"`
+	// Summary counts the findings of each severity.
+	Summary map[string]int `json:"summary"`
+
+	tool   string
+	report string
+
+	guard.Cancellation
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		Scanner:  ScannerGrype,
+		Target:   ".",
+		Findings: []Finding{},
+		Summary:  map[string]int{},
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	var report []byte
+	if a.report != "" {
+		product, ok := ctx.Products()[a.report]
+		if !ok {
+			return fmt.Errorf("vulnerability report %v is not a product of the step", a.report)
+		}
+
+		contents, err := readReport(filepath.Join(ctx.WorkingDir(), a.report))
+		if err != nil {
+			return fmt.Errorf("failed to read %v: %w", a.report, err)
+		}
+
+		report, a.ReportDigest = contents, product.Digest
+	} else {
+		if a.Target != "." {
+			if _, ok := ctx.Products()[a.Target]; !ok {
+				return fmt.Errorf("scan target %v is not a product of the step", a.Target)
+			}
+		}
+
+		contents, err := a.scan(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to scan %v with %v: %w", a.Target, a.Scanner, err)
+		}
+
+		report = contents
+	}
+
+	scanner, version, findings, err := parseReport(report)
+	if err != nil {
+		return err
+	}
+
+	if a.report == "" && scanner != a.Scanner {
+		return fmt.Errorf("the scanner didn't output a %v report", a.Scanner)
+	}
+
+	a.Scanner, a.ScannerVersion = scanner, version
+	a.Findings = sortFindings(findings)
+	a.Summary = map[string]int{}
+	for _, f := range a.Findings {
+		a.Summary[f.Severity]++
+	}
+
+	return nil
+}
+
+// scan runs the scanner on the target and returns its JSON report. Targets ending in .tar are scanned as image
+// tarballs.
+func (a *Attestor) scan(ctx *attestation.AttestationContext) ([]byte, error) {
+	tool := a.tool
+	if tool == "" {
+		tool = a.Scanner
+	}
+
+	var args []string
+	switch {
+	case a.Scanner == ScannerTrivy && strings.HasSuffix(a.Target, ".tar"):
+		args = []string{"image", "--input", a.Target, "--format", "json", "--quiet"}
+	case a.Scanner == ScannerTrivy:
+		args = []string{"fs", "--format", "json", "--quiet", a.Target}
+	case a.Target == ".":
+		args = []string{"dir:.", "--output", "json", "--quiet"}
+	default:
+		args = []string{a.Target, "--output", "json", "--quiet"}
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(a.Context(ctx), tool, args...)
+	cmd.Dir = ctx.WorkingDir()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// grypeReport is the part of grype's JSON output findings are read from.
+type grypeReport struct {
+	Matches []struct {
+		Vulnerability struct {
+			ID       string `json:"id"`
+			Severity string `json:"severity"`
+			Fix      struct {
+				Versions []string `json:"versions"`
+			} `json:"fix"`
+		} `json:"vulnerability"`
+		Artifact struct {
+			Name      string `json:"name"`
+			Version   string `json:"version"`
+			Locations []struct {
+				Path string `json:"path"`
+			} `json:"locations"`
+		} `json:"artifact"`
+	} `json:"matches"`
+	Descriptor struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"descriptor"`
+}
+
+// trivyReport is the part of trivy's JSON output findings are read from.
+type trivyReport struct {
+	SchemaVersion int `json:"SchemaVersion"`
+	Trivy         struct {
+		Version string `json:"Version"`
+	} `json:"Trivy"`
+	Results []struct {
+		Target          string `json:"Target"`
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			PkgPath          string `json:"PkgPath"`
+			InstalledVersion string `json:"InstalledVersion"`
+			FixedVersion     string `json:"FixedVersion"`
+			Severity         string `json:"Severity"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+// parseReport reads the findings of a grype or trivy JSON report, returning which scanner wrote it and its version
+// if the report records it.
+func parseReport(report []byte) (string, string, []Finding, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(report, &fields); err != nil {
+		return "", "", nil, fmt.Errorf("failed to parse vulnerability report: %w", err)
+	}
+
+	findings := []Finding{}
+	switch {
+	case fields["matches"] != nil:
+		parsed := grypeReport{}
+		if err := json.Unmarshal(report, &parsed); err != nil {
+			return "", "", nil, fmt.Errorf("failed to parse grype report: %w", err)
+		}
+
+		for _, match := range parsed.Matches {
+			f := Finding{
+				ID:       match.Vulnerability.ID,
+				Severity: normalizeSeverity(match.Vulnerability.Severity),
+				Package:  match.Artifact.Name,
+				Version:  match.Artifact.Version,
+			}
+
+			if len(match.Vulnerability.Fix.Versions) > 0 {
+				f.FixedIn = match.Vulnerability.Fix.Versions
+			}
+
+			if len(match.Artifact.Locations) > 0 {
+				f.Location = match.Artifact.Locations[0].Path
+			}
+
+			findings = append(findings, f)
+		}
+
+		return ScannerGrype, parsed.Descriptor.Version, findings, nil
+	case fields["SchemaVersion"] != nil:
+		parsed := trivyReport{}
+		if err := json.Unmarshal(report, &parsed); err != nil {
+			return "", "", nil, fmt.Errorf("failed to parse trivy report: %w", err)
+		}
+
+		for _, result := range parsed.Results {
+			for _, vulnerability := range result.Vulnerabilities {
+				f := Finding{
+					ID:       vulnerability.VulnerabilityID,
+					Severity: normalizeSeverity(vulnerability.Severity),
+					Package:  vulnerability.PkgName,
+					Version:  vulnerability.InstalledVersion,
+					Location: vulnerability.PkgPath,
+				}
+
+				if f.Location == "" {
+					f.Location = result.Target
+				}
+
+				if vulnerability.FixedVersion != "" {
+					f.FixedIn = strings.Split(vulnerability.FixedVersion, ", ")
+				}
+
+				findings = append(findings, f)
+			}
+		}
+
+		return ScannerTrivy, parsed.Trivy.Version, findings, nil
+	default:
+		return "", "", nil, fmt.Errorf("vulnerability report is not a grype or trivy JSON report")
+	}
+}
+
+// SeverityRank returns the position of severity in Severities, or -1 if it isn't one of them.
+func SeverityRank(severity string) int {
+	for rank, s := range Severities {
+		if strings.EqualFold(s, severity) {
+			return rank
+		}
+	}
+
+	return -1
+}
+
+func normalizeSeverity(severity string) string {
+	if strings.EqualFold(severity, "negligible") {
+		return "low"
+	}
+
+	if rank := SeverityRank(severity); rank >= 0 {
+		return Severities[rank]
+	}
+
+	return "none"
+}
+
+// sortFindings orders findings from most to least severe, then by ID and package, so the same scan is always
+// recorded the same way.
+func sortFindings(findings []Finding) []Finding {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Severity != b.Severity {
+			return SeverityRank(a.Severity) > SeverityRank(b.Severity)
+		}
+
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+
+		return a.Package < b.Package
+	})
+
+	return findings
+}
+
+func readReport(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	contents, err := io.ReadAll(io.LimitReader(f, maxReportSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(contents) > maxReportSize {
+		return nil, fmt.Errorf("report is larger than %v bytes", maxReportSize)
+	}
+
+	return contents, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vuln
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/product"
+)
+
+const (
+	grypeReportJSON = `{
+  "matches": [
+    {
+      "vulnerability": {"id": "CVE-2023-0002", "severity": "Negligible", "fix": {"versions": [], "state": "not-fixed"}},
+      "artifact": {"name": "zlib", "version": "1.2.13", "locations": [{"path": "/lib/libz.so.1"}]}
+    },
+    {
+      "vulnerability": {"id": "CVE-2021-44228", "severity": "Critical", "fix": {"versions": ["2.15.0"], "state": "fixed"}},
+      "artifact": {"name": "log4j-core", "version": "2.14.1", "locations": [{"path": "/app/lib/log4j-core-2.14.1.jar"}]}
+    }
+  ],
+  "descriptor": {"name": "grype", "version": "0.74.0"}
+}`
+
+	trivyReportJSON = `{
+  "SchemaVersion": 2,
+  "Results": [
+    {
+      "Target": "go.sum",
+      "Vulnerabilities": [
+        {"VulnerabilityID": "CVE-2023-39325", "PkgName": "golang.org/x/net", "InstalledVersion": "0.15.0", "FixedVersion": "0.17.0", "Severity": "HIGH"},
+        {"VulnerabilityID": "CVE-2023-0001", "PkgName": "example.com/lib", "InstalledVersion": "1.0.0", "Severity": "UNKNOWN"}
+      ]
+    },
+    {"Target": "package-lock.json"}
+  ]
+}`
+
+	fakeGrype = `#!/bin/sh
+cat <<'EOF'
+` + grypeReportJSON + `
+EOF
+`
+)
+
+func TestAttestScan(t *testing.T) {
+	grype := filepath.Join(t.TempDir(), "grype")
+	require.NoError(t, os.WriteFile(grype, []byte(fakeGrype), 0755))
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.jar"), []byte("jar"), 0644))
+
+	a := New(WithTool(grype))
+	ctx, err := attestation.NewContext([]attestation.Attestor{product.New(), a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	require.Equal(t, ScannerGrype, a.Scanner)
+	require.Equal(t, "0.74.0", a.ScannerVersion)
+	require.Equal(t, []Finding{
+		{ID: "CVE-2021-44228", Severity: "critical", Package: "log4j-core", Version: "2.14.1", FixedIn: []string{"2.15.0"}, Location: "/app/lib/log4j-core-2.14.1.jar"},
+		{ID: "CVE-2023-0002", Severity: "low", Package: "zlib", Version: "1.2.13", Location: "/lib/libz.so.1"},
+	}, a.Findings)
+	require.Equal(t, map[string]int{"critical": 1, "low": 1}, a.Summary)
+
+	data, err := json.Marshal(a)
+	require.NoError(t, err)
+	roundTrip := New()
+	require.NoError(t, json.Unmarshal(data, roundTrip))
+	require.Equal(t, a.Findings, roundTrip.Findings)
+
+	// trivy can't have written a grype report
+	a = New(WithScanner(ScannerTrivy), WithTool(grype))
+	ctx, err = attestation.NewContext([]attestation.Attestor{product.New(), a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.ErrorContains(t, ctx.RunAttestors(), "didn't output a trivy report")
+
+	a = New(WithTool(grype), WithTarget("missing.tar"))
+	ctx, err = attestation.NewContext([]attestation.Attestor{product.New(), a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.ErrorContains(t, ctx.RunAttestors(), "is not a product of the step")
+}
+
+func TestAttestReport(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "trivy.json"), []byte(trivyReportJSON), 0644))
+
+	a := New(WithReport("trivy.json"))
+	ctx, err := attestation.NewContext([]attestation.Attestor{product.New(), a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	require.Equal(t, ScannerTrivy, a.Scanner)
+	require.NotEmpty(t, a.ReportDigest)
+	require.Equal(t, []Finding{
+		{ID: "CVE-2023-39325", Severity: "high", Package: "golang.org/x/net", Version: "0.15.0", FixedIn: []string{"0.17.0"}, Location: "go.sum"},
+		{ID: "CVE-2023-0001", Severity: "none", Package: "example.com/lib", Version: "1.0.0", Location: "go.sum"},
+	}, a.Findings)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.json"), []byte(`{"results": []}`), 0644))
+	a = New(WithReport("other.json"))
+	ctx, err = attestation.NewContext([]attestation.Attestor{product.New(), a}, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	require.ErrorContains(t, ctx.RunAttestors(), "not a grype or trivy JSON report")
+}
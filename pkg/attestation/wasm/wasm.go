@@ -0,0 +1,480 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+)
+
+const (
+	Name    = "wasm"
+	Type    = "https://witness.dev/attestations/wasm/v0.1"
+	RunType = attestation.PostProductRunType
+
+	sectionCustom = 0
+	sectionImport = 2
+	sectionExport = 7
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor = &Attestor{}
+
+	wasmMagic = []byte{0x00, 0x61, 0x73, 0x6d}
+	kindNames = map[byte]string{0: "func", 1: "table", 2: "memory", 3: "global", 4: "tag"}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+type Module struct {
+	Digest         cryptoutil.DigestSet `json:"digest"`
+	Version        uint32               `json:"version"`
+	Imports        []Import             `json:"imports,omitempty"`
+	Exports        []Export             `json:"exports,omitempty"`
+	CustomSections []CustomSection      `json:"customsections,omitempty"`
+	Producers      map[string][]string  `json:"producers,omitempty"`
+}
+
+type Import struct {
+	Module string `json:"module"`
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+}
+
+type Export struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Index uint64 `json:"index"`
+}
+
+type CustomSection struct {
+	Name   string               `json:"name"`
+	Size   int                  `json:"size"`
+	Digest cryptoutil.DigestSet `json:"digest"`
+}
+
+type Attestor struct {
+	modules map[string]Module
+	hashes  []crypto.Hash
+}
+
+func New() *Attestor {
+	return &Attestor{
+		modules: make(map[string]Module),
+	}
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	a.hashes = ctx.Hashes()
+	for path, product := range ctx.Products() {
+		data, err := readModule(filepath.Join(ctx.WorkingDir(), path))
+		if err != nil {
+			log.Debugf("(attestation/wasm) could not read product %v: %v", path, err)
+			continue
+		}
+
+		if data == nil {
+			continue
+		}
+
+		module, err := a.parse(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse wasm module %v: %w", path, err)
+		}
+
+		module.Digest = product.Digest
+		a.modules[path] = module
+	}
+
+	return nil
+}
+
+func (a *Attestor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.modules)
+}
+
+func (a *Attestor) UnmarshalJSON(data []byte) error {
+	modules := make(map[string]Module)
+	if err := json.Unmarshal(data, &modules); err != nil {
+		return err
+	}
+
+	a.modules = modules
+	return nil
+}
+
+func (a *Attestor) Modules() map[string]Module {
+	return a.modules
+}
+
+// readModule returns the contents of the file at path if it begins with the wasm magic number, or nil otherwise.
+func readModule(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	magic := make([]byte, len(wasmMagic))
+	if _, err := io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, wasmMagic) {
+		return nil, nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(f)
+}
+
+func (a *Attestor) parse(data []byte) (Module, error) {
+	module := Module{}
+	r := &reader{data: data}
+	magic, err := r.bytes(4)
+	if err != nil || !bytes.Equal(magic, wasmMagic) {
+		return module, fmt.Errorf("missing wasm magic number")
+	}
+
+	versionBytes, err := r.bytes(4)
+	if err != nil {
+		return module, err
+	}
+
+	module.Version = uint32(versionBytes[0]) | uint32(versionBytes[1])<<8 | uint32(versionBytes[2])<<16 | uint32(versionBytes[3])<<24
+	for !r.done() {
+		id, err := r.byte()
+		if err != nil {
+			return module, err
+		}
+
+		size, err := r.uleb()
+		if err != nil {
+			return module, err
+		}
+
+		contents, err := r.bytes(size)
+		if err != nil {
+			return module, fmt.Errorf("section %v is truncated: %w", id, err)
+		}
+
+		section := &reader{data: contents}
+		switch id {
+		case sectionCustom:
+			if err := a.parseCustomSection(section, &module); err != nil {
+				return module, err
+			}
+		case sectionImport:
+			if module.Imports, err = parseImports(section); err != nil {
+				return module, fmt.Errorf("failed to parse import section: %w", err)
+			}
+		case sectionExport:
+			if module.Exports, err = parseExports(section); err != nil {
+				return module, fmt.Errorf("failed to parse export section: %w", err)
+			}
+		}
+	}
+
+	return module, nil
+}
+
+func (a *Attestor) parseCustomSection(r *reader, module *Module) error {
+	name, err := r.name()
+	if err != nil {
+		return fmt.Errorf("failed to parse custom section name: %w", err)
+	}
+
+	contents := r.data[r.pos:]
+	digest, err := cryptoutil.CalculateDigestSetFromBytes(contents, a.hashes)
+	if err != nil {
+		return err
+	}
+
+	module.CustomSections = append(module.CustomSections, CustomSection{
+		Name:   name,
+		Size:   len(contents),
+		Digest: digest,
+	})
+
+	if name == "producers" {
+		producers, err := parseProducers(r)
+		if err != nil {
+			log.Debugf("(attestation/wasm) could not parse producers section: %v", err)
+			return nil
+		}
+
+		module.Producers = producers
+	}
+
+	return nil
+}
+
+func parseImports(r *reader) ([]Import, error) {
+	count, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+
+	imports := make([]Import, 0, count)
+	for i := uint64(0); i < count; i++ {
+		imp := Import{}
+		if imp.Module, err = r.name(); err != nil {
+			return nil, err
+		}
+
+		if imp.Name, err = r.name(); err != nil {
+			return nil, err
+		}
+
+		kind, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+
+		imp.Kind = kindName(kind)
+		if err := r.skipImportDesc(kind); err != nil {
+			return nil, err
+		}
+
+		imports = append(imports, imp)
+	}
+
+	return imports, nil
+}
+
+func parseExports(r *reader) ([]Export, error) {
+	count, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+
+	exports := make([]Export, 0, count)
+	for i := uint64(0); i < count; i++ {
+		exp := Export{}
+		if exp.Name, err = r.name(); err != nil {
+			return nil, err
+		}
+
+		kind, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+
+		exp.Kind = kindName(kind)
+		if exp.Index, err = r.uleb(); err != nil {
+			return nil, err
+		}
+
+		exports = append(exports, exp)
+	}
+
+	return exports, nil
+}
+
+// parseProducers parses the tool-conventions producers section, which lists the languages, tools, and
+// sdks that were used to produce the module.
+func parseProducers(r *reader) (map[string][]string, error) {
+	producers := make(map[string][]string)
+	fieldCount, err := r.count()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := uint64(0); i < fieldCount; i++ {
+		field, err := r.name()
+		if err != nil {
+			return nil, err
+		}
+
+		valueCount, err := r.count()
+		if err != nil {
+			return nil, err
+		}
+
+		for j := uint64(0); j < valueCount; j++ {
+			name, err := r.name()
+			if err != nil {
+				return nil, err
+			}
+
+			version, err := r.name()
+			if err != nil {
+				return nil, err
+			}
+
+			producers[field] = append(producers[field], fmt.Sprintf("%v %v", name, version))
+		}
+	}
+
+	return producers, nil
+}
+
+func kindName(kind byte) string {
+	if name, ok := kindNames[kind]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("unknown(%d)", kind)
+}
+
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) done() bool {
+	return r.pos >= len(r.data)
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.done() {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+// bytes returns the next n bytes. n comes from the module, so it is compared with the bytes remaining rather than
+// added to the position, which could overflow.
+func (r *reader) bytes(n uint64) ([]byte, error) {
+	if n > uint64(r.remaining()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *reader) remaining() int {
+	return len(r.data) - r.pos
+}
+
+// count reads the number of items in a vector. Every item takes at least a byte, so a count larger than the bytes
+// remaining is rejected before anything is allocated for it.
+func (r *reader) count() (uint64, error) {
+	n, err := r.uleb()
+	if err != nil {
+		return 0, err
+	}
+
+	if n > uint64(r.remaining()) {
+		return 0, fmt.Errorf("vector of %v items is longer than the %v bytes remaining", n, r.remaining())
+	}
+
+	return n, nil
+}
+
+func (r *reader) uleb() (uint64, error) {
+	var result uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+
+		result |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return result, nil
+		}
+	}
+
+	return 0, fmt.Errorf("leb128 value overflows 64 bits")
+}
+
+func (r *reader) name() (string, error) {
+	length, err := r.uleb()
+	if err != nil {
+		return "", err
+	}
+
+	b, err := r.bytes(length)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func (r *reader) limits() error {
+	flags, err := r.byte()
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.uleb(); err != nil {
+		return err
+	}
+
+	if flags&0x01 != 0 {
+		_, err = r.uleb()
+	}
+
+	return err
+}
+
+func (r *reader) skipImportDesc(kind byte) error {
+	switch kind {
+	case 0:
+		_, err := r.uleb()
+		return err
+	case 1:
+		if _, err := r.byte(); err != nil {
+			return err
+		}
+
+		return r.limits()
+	case 2:
+		return r.limits()
+	case 3:
+		_, err := r.bytes(2)
+		return err
+	case 4:
+		if _, err := r.byte(); err != nil {
+			return err
+		}
+
+		_, err := r.uleb()
+		return err
+	default:
+		return fmt.Errorf("unknown import kind %d", kind)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func section(id byte, contents []byte) []byte {
+	return append([]byte{id, byte(len(contents))}, contents...)
+}
+
+func name(s string) []byte {
+	return append([]byte{byte(len(s))}, []byte(s)...)
+}
+
+// testModule returns a module that imports, exports, and records its producers.
+func testModule() []byte {
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+	imports := []byte{0x02}
+	imports = append(imports, name("env")...)
+	imports = append(imports, name("log")...)
+	imports = append(imports, 0x00, 0x00)
+	imports = append(imports, name("env")...)
+	imports = append(imports, name("memory")...)
+	imports = append(imports, 0x02, 0x01, 0x01, 0x10)
+	module = append(module, section(sectionImport, imports)...)
+
+	exports := []byte{0x01}
+	exports = append(exports, name("run")...)
+	exports = append(exports, 0x00, 0x01)
+	module = append(module, section(sectionExport, exports)...)
+
+	producers := name("producers")
+	producers = append(producers, 0x01)
+	producers = append(producers, name("language")...)
+	producers = append(producers, 0x01)
+	producers = append(producers, name("Rust")...)
+	producers = append(producers, name("1.70")...)
+	module = append(module, section(sectionCustom, producers)...)
+
+	return module
+}
+
+func TestParse(t *testing.T) {
+	module := testModule()
+	a := New()
+	a.hashes = []crypto.Hash{crypto.SHA256}
+	parsed, err := a.parse(module)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), parsed.Version)
+	require.Equal(t, []Import{{Module: "env", Name: "log", Kind: "func"}, {Module: "env", Name: "memory", Kind: "memory"}}, parsed.Imports)
+	require.Equal(t, []Export{{Name: "run", Kind: "func", Index: 1}}, parsed.Exports)
+	require.Len(t, parsed.CustomSections, 1)
+	require.Equal(t, "producers", parsed.CustomSections[0].Name)
+	require.Equal(t, []string{"Rust 1.70"}, parsed.Producers["language"])
+}
+
+func TestParseTruncated(t *testing.T) {
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, sectionExport, 0x10, 0x01}
+	_, err := New().parse(module)
+	require.Error(t, err)
+
+	// every prefix of a valid module fails to parse or parses, without panicking
+	valid := testModule()
+	for i := range valid {
+		_, _ = New().parse(valid[:i])
+	}
+}
+
+func TestParseOversizedLengths(t *testing.T) {
+	header := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	maxUleb := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+	for name, module := range map[string][]byte{
+		// a section size that wraps the position around when added to it
+		"section size": append(append(append([]byte{}, header...), sectionCustom), maxUleb...),
+		"import count": append(append([]byte{}, header...), section(sectionImport, maxUleb)...),
+		"export count": append(append([]byte{}, header...), section(sectionExport, []byte{0xff, 0xff, 0xff, 0xff, 0x0f})...),
+		"name length":  append(append([]byte{}, header...), section(sectionExport, append([]byte{0x01}, maxUleb...))...),
+		"producers":    append(append([]byte{}, header...), section(sectionCustom, append(name("producers"), maxUleb...))...),
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.NotPanics(t, func() {
+				_, _ = New().parse(module)
+			})
+		})
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add(testModule())
+	f.Add([]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, sectionCustom, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+	f.Fuzz(func(t *testing.T, module []byte) {
+		_, _ = New().parse(module)
+	})
+}
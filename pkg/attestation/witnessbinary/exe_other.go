@@ -0,0 +1,25 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package witnessbinary
+
+import "os"
+
+// openExecutable opens the binary at path. Only linux can open the binary witness is running without a path, so
+// replacing the file at path while witness runs isn't detected.
+func openExecutable(path string) (*os.File, error) {
+	return os.Open(path)
+}
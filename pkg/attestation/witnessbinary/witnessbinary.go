@@ -0,0 +1,127 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package witnessbinary
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+const (
+	Name    = "witness"
+	Type    = "https://witness.dev/attestations/witness/v0.1"
+	RunType = attestation.PreMaterialRunType
+)
+
+// This is a hacky way to create a compile time error in case the attestor
+// doesn't implement the expected interfaces.
+var (
+	_ attestation.Attestor = &Attestor{}
+)
+
+func init() {
+	attestation.RegisterAttestation(Name, Type, RunType, func() attestation.Attestor { return New() })
+}
+
+// Attestor records which witness binary produced a collection, so policies can require a minimum version or a
+// binary released by the project and tampered attestation tooling can be detected.
+type Attestor struct {
+	Version   string               `json:"version"`
+	Commit    string               `json:"commit,omitempty"`
+	GoVersion string               `json:"goversion"`
+	Path      string               `json:"path"`
+	Digest    cryptoutil.DigestSet `json:"digest"`
+
+	executable func() (string, error)
+	open       func(path string) (*os.File, error)
+}
+
+type Option func(*Attestor)
+
+// WithVersion sets the version of witness, which is otherwise taken from the module version in the binary's build
+// information.
+func WithVersion(version string) Option {
+	return func(a *Attestor) {
+		a.Version = version
+	}
+}
+
+func New(opts ...Option) *Attestor {
+	a := &Attestor{
+		executable: os.Executable,
+		open:       openExecutable,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
+}
+
+func (a *Attestor) Name() string {
+	return Name
+}
+
+func (a *Attestor) Type() string {
+	return Type
+}
+
+func (a *Attestor) RunType() attestation.RunType {
+	return RunType
+}
+
+func (a *Attestor) Attest(ctx *attestation.AttestationContext) error {
+	a.GoVersion = runtime.Version()
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if a.Version == "" {
+			a.Version = info.Main.Version
+		}
+
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				a.Commit = setting.Value
+			}
+		}
+	}
+
+	path, err := a.executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the witness binary: %w", err)
+	}
+
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return fmt.Errorf("failed to resolve the witness binary: %w", err)
+	}
+
+	a.Path = path
+	f, err := a.open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open the witness binary: %w", err)
+	}
+
+	defer f.Close()
+	if a.Digest, err = cryptoutil.CalculateDigestSet(f, ctx.Hashes()); err != nil {
+		return fmt.Errorf("failed to hash the witness binary: %w", err)
+	}
+
+	return nil
+}
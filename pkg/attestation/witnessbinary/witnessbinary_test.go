@@ -0,0 +1,64 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package witnessbinary
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+func TestAttest(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "witness")
+	require.NoError(t, os.WriteFile(binary, []byte("witness binary"), 0755))
+	link := filepath.Join(t.TempDir(), "witness-link")
+	require.NoError(t, os.Symlink(binary, link))
+
+	a := New(WithVersion("v0.1.14"))
+	a.executable = func() (string, error) { return link, nil }
+	a.open = os.Open
+	ctx, err := attestation.NewContext([]attestation.Attestor{a})
+	require.NoError(t, err)
+	require.NoError(t, a.Attest(ctx))
+
+	digest := sha256.Sum256([]byte("witness binary"))
+	resolved, err := filepath.EvalSymlinks(binary)
+	require.NoError(t, err)
+	require.Equal(t, "v0.1.14", a.Version)
+	require.Equal(t, resolved, a.Path)
+	require.NotEmpty(t, a.GoVersion)
+	require.Equal(t, hex.EncodeToString(digest[:]), a.Digest[cryptoutil.DigestValue{Hash: crypto.SHA256}])
+}
+
+func TestAttestRunningBinary(t *testing.T) {
+	a := New()
+	ctx, err := attestation.NewContext([]attestation.Attestor{a})
+	require.NoError(t, err)
+	require.NoError(t, a.Attest(ctx))
+
+	path, err := os.Executable()
+	require.NoError(t, err)
+	binary, err := os.ReadFile(path)
+	require.NoError(t, err)
+	digest := sha256.Sum256(binary)
+	require.Equal(t, hex.EncodeToString(digest[:]), a.Digest[cryptoutil.DigestValue{Hash: crypto.SHA256}])
+}
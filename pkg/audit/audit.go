@@ -0,0 +1,290 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit assembles verified evidence into a self-contained package that can be handed to auditors who
+// don't run witness themselves.
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/subjectname"
+)
+
+const (
+	ReportFileName   = "report.json"
+	SummaryFileName  = "summary.html"
+	ManifestFileName = "manifest.json"
+	EvidenceDir      = "evidence"
+)
+
+// Report is the machine readable verification report included in every audit package.
+type Report struct {
+	Serial       string              `json:"serial"`
+	GeneratedAt  time.Time           `json:"generatedat"`
+	Subjects     []string            `json:"subjects"`
+	PolicyDigest string              `json:"policydigest"`
+	Passed       bool                `json:"passed"`
+	Error        string              `json:"error,omitempty"`
+	Steps        map[string][]string `json:"steps"`
+}
+
+// Evidence is a normalized view of a single verified attestation collection. The original envelope is kept
+// so the signature can be checked again independently of this package.
+type Evidence struct {
+	Serial        string            `json:"serial"`
+	Step          string            `json:"step"`
+	Reference     string            `json:"reference"`
+	Signers       []string          `json:"signers"`
+	SubjectNames  map[string]string `json:"subjectnames,omitempty"`
+	PayloadType   string            `json:"payloadtype"`
+	PayloadDigest string            `json:"payloaddigest"`
+	Statement     json.RawMessage   `json:"statement"`
+	Envelope      dsse.Envelope     `json:"envelope"`
+}
+
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type Manifest struct {
+	Serial string          `json:"serial"`
+	Files  []ManifestEntry `json:"files"`
+}
+
+type Package struct {
+	Report   Report
+	Evidence []Evidence
+}
+
+type Option func(*Package)
+
+func WithGeneratedAt(t time.Time) Option {
+	return func(p *Package) {
+		p.Report.GeneratedAt = t
+	}
+}
+
+// New builds an audit package for the verification of subjects against policyEnvelope. verifyErr is the result
+// of verification, and a package is still produced when it is not nil so the failure itself can be audited.
+func New(serial string, policyEnvelope dsse.Envelope, subjects []cryptoutil.DigestSet, verifiedEvidence map[string][]source.VerifiedCollection, verifyErr error, opts ...Option) (*Package, error) {
+	policyDigest := sha256.Sum256(policyEnvelope.Payload)
+	p := &Package{
+		Report: Report{
+			Serial:       serial,
+			GeneratedAt:  time.Now().UTC(),
+			PolicyDigest: hex.EncodeToString(policyDigest[:]),
+			Passed:       verifyErr == nil,
+			Steps:        make(map[string][]string),
+		},
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if verifyErr != nil {
+		p.Report.Error = verifyErr.Error()
+	}
+
+	for _, subject := range subjects {
+		for digestValue, digest := range subject {
+			name, err := cryptoutil.HashToString(digestValue.Hash)
+			if err != nil {
+				return nil, err
+			}
+
+			if digestValue.GitOID {
+				name = "gitoid:" + name
+			}
+
+			p.Report.Subjects = append(p.Report.Subjects, fmt.Sprintf("%v:%v", name, digest))
+		}
+	}
+
+	sort.Strings(p.Report.Subjects)
+	steps := make([]string, 0, len(verifiedEvidence))
+	for step := range verifiedEvidence {
+		steps = append(steps, step)
+	}
+
+	sort.Strings(steps)
+	for _, step := range steps {
+		for _, collection := range verifiedEvidence[step] {
+			evidence, err := newEvidence(fmt.Sprintf("%04d", len(p.Evidence)+1), step, collection)
+			if err != nil {
+				return nil, fmt.Errorf("failed to normalize evidence %v: %w", collection.Reference, err)
+			}
+
+			p.Evidence = append(p.Evidence, evidence)
+			p.Report.Steps[step] = append(p.Report.Steps[step], evidenceFileName(evidence))
+		}
+	}
+
+	return p, nil
+}
+
+func newEvidence(serial, step string, collection source.VerifiedCollection) (Evidence, error) {
+	signers := make([]string, 0, len(collection.Verifiers))
+	for _, verifier := range collection.Verifiers {
+		keyID, err := verifier.KeyID()
+		if err != nil {
+			return Evidence{}, err
+		}
+
+		signers = append(signers, keyID)
+	}
+
+	statement := &bytes.Buffer{}
+	if err := json.Indent(statement, collection.Envelope.Payload, "", "  "); err != nil {
+		return Evidence{}, err
+	}
+
+	subjectNames := make(map[string]string)
+	for name, subject := range subjectname.FromCollection(collection.Collection) {
+		subjectNames[name] = subject.Path
+	}
+
+	payloadDigest := sha256.Sum256(collection.Envelope.Payload)
+	return Evidence{
+		Serial:        serial,
+		Step:          step,
+		Reference:     collection.Reference,
+		Signers:       signers,
+		SubjectNames:  subjectNames,
+		PayloadType:   collection.Envelope.PayloadType,
+		PayloadDigest: hex.EncodeToString(payloadDigest[:]),
+		Statement:     statement.Bytes(),
+		Envelope:      collection.Envelope,
+	}, nil
+}
+
+func evidenceFileName(e Evidence) string {
+	step := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+
+		return '_'
+	}, e.Step)
+
+	return fmt.Sprintf("%v/%v-%v.json", EvidenceDir, e.Serial, step)
+}
+
+// Write writes the package into dir, which must not exist or be empty. If maxSize is greater than zero and the
+// package would be larger than maxSize bytes, nothing is written.
+func (p *Package) Write(dir string, maxSize int64) error {
+	files, err := p.files()
+	if err != nil {
+		return err
+	}
+
+	manifest := Manifest{Serial: p.Report.Serial}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+	total := int64(0)
+	for _, path := range paths {
+		digest := sha256.Sum256(files[path])
+		manifest.Files = append(manifest.Files, ManifestEntry{Path: path, Size: int64(len(files[path])), SHA256: hex.EncodeToString(digest[:])})
+		total += int64(len(files[path]))
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	files[ManifestFileName] = manifestBytes
+	total += int64(len(manifestBytes))
+	if maxSize > 0 && total > maxSize {
+		return fmt.Errorf("audit package would be %v bytes, which exceeds the maximum of %v bytes", total, maxSize)
+	}
+
+	if err := ensureEmptyDir(dir); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, EvidenceDir), 0755); err != nil {
+		return err
+	}
+
+	for path, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(path)), contents, 0644); err != nil {
+			return fmt.Errorf("failed to write %v: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *Package) files() (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, evidence := range p.Evidence {
+		evidenceBytes, err := json.MarshalIndent(evidence, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		files[evidenceFileName(evidence)] = evidenceBytes
+	}
+
+	reportBytes, err := json.MarshalIndent(p.Report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	files[ReportFileName] = reportBytes
+	summary := &bytes.Buffer{}
+	if err := summaryTemplate.Execute(summary, p); err != nil {
+		return nil, fmt.Errorf("failed to render summary: %w", err)
+	}
+
+	files[SummaryFileName] = summary.Bytes()
+	return files, nil
+}
+
+func ensureEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if len(entries) > 0 {
+		return fmt.Errorf("output directory %v is not empty", dir)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/source"
+)
+
+func testPackage(t *testing.T, verifyErr error) *Package {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := cryptoutil.NewSigner(key)
+	require.NoError(t, err)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+
+	evidence := map[string][]source.VerifiedCollection{
+		"build/linux": {{
+			Verifiers: []cryptoutil.Verifier{verifier},
+			CollectionEnvelope: source.CollectionEnvelope{
+				Reference: "build.json",
+				Envelope:  dsse.Envelope{Payload: []byte(`{"_type":"https://in-toto.io/Statement/v0.1","predicate":{"name":"build"}}`), PayloadType: "application/vnd.in-toto+json"},
+			},
+		}},
+	}
+
+	subjects := []cryptoutil.DigestSet{{cryptoutil.DigestValue{Hash: crypto.SHA256}: "abcd"}}
+	pkg, err := New("0042", dsse.Envelope{Payload: []byte("{}")}, subjects, evidence, verifyErr, WithGeneratedAt(time.Unix(0, 0).UTC()))
+	require.NoError(t, err)
+	return pkg
+}
+
+func TestWrite(t *testing.T) {
+	pkg := testPackage(t, nil)
+	require.True(t, pkg.Report.Passed)
+	require.Equal(t, []string{"sha256:abcd"}, pkg.Report.Subjects)
+	require.Equal(t, []string{"evidence/0001-build_linux.json"}, pkg.Report.Steps["build/linux"])
+
+	dir := filepath.Join(t.TempDir(), "audit")
+	require.NoError(t, pkg.Write(dir, 0))
+
+	manifestBytes, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	require.NoError(t, err)
+	manifest := Manifest{}
+	require.NoError(t, json.Unmarshal(manifestBytes, &manifest))
+	require.Equal(t, "0042", manifest.Serial)
+	require.Len(t, manifest.Files, 3)
+	for _, entry := range manifest.Files {
+		contents, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(entry.Path)))
+		require.NoError(t, err)
+		digest := sha256.Sum256(contents)
+		require.Equal(t, hex.EncodeToString(digest[:]), entry.SHA256)
+	}
+
+	require.ErrorContains(t, pkg.Write(dir, 0), "not empty")
+}
+
+func TestWriteMaxSize(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "audit")
+	require.ErrorContains(t, testPackage(t, nil).Write(dir, 512), "exceeds the maximum")
+	_, err := os.Stat(dir)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestFailedVerification(t *testing.T) {
+	pkg := testPackage(t, errors.New("policy expired"))
+	require.False(t, pkg.Report.Passed)
+	require.Equal(t, "policy expired", pkg.Report.Error)
+
+	dir := t.TempDir()
+	require.NoError(t, pkg.Write(dir, 0))
+	summary, err := os.ReadFile(filepath.Join(dir, SummaryFileName))
+	require.NoError(t, err)
+	require.Contains(t, string(summary), "Verification failed")
+	require.Contains(t, string(summary), "policy expired")
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import "html/template"
+
+// summaryTemplate renders a standalone, printable page so auditors can produce a PDF from any browser
+var summaryTemplate = template.Must(template.New("summary").Funcs(template.FuncMap{
+	"fileName": evidenceFileName,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Witness audit package {{ .Report.Serial }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #999; padding: 0.4em; text-align: left; font-size: 0.9em; }
+code { word-break: break-all; }
+.passed { color: #1a7f37; }
+.failed { color: #cf222e; }
+</style>
+</head>
+<body>
+<h1>Witness audit package {{ .Report.Serial }}</h1>
+<table>
+<tr><th>Generated</th><td>{{ .Report.GeneratedAt.Format "2006-01-02T15:04:05Z07:00" }}</td></tr>
+<tr><th>Result</th><td>{{ if .Report.Passed }}<span class="passed">Verification passed</span>{{ else }}<span class="failed">Verification failed</span>{{ end }}</td></tr>
+{{- if .Report.Error }}
+<tr><th>Error</th><td><code>{{ .Report.Error }}</code></td></tr>
+{{- end }}
+<tr><th>Policy digest (sha256)</th><td><code>{{ .Report.PolicyDigest }}</code></td></tr>
+<tr><th>Subjects</th><td>{{ range .Report.Subjects }}<code>{{ . }}</code><br>{{ end }}</td></tr>
+</table>
+<h2>Evidence</h2>
+{{- if .Evidence }}
+<table>
+<tr><th>Serial</th><th>Step</th><th>Reference</th><th>Named subjects</th><th>Signers</th><th>Payload digest (sha256)</th><th>File</th></tr>
+{{- range .Evidence }}
+<tr><td>{{ .Serial }}</td><td>{{ .Step }}</td><td><code>{{ .Reference }}</code></td><td>{{ range $name, $path := .SubjectNames }}{{ $name }} ({{ $path }})<br>{{ end }}</td><td>{{ range .Signers }}<code>{{ . }}</code><br>{{ end }}</td><td><code>{{ .PayloadDigest }}</code></td><td>{{ fileName . }}</td></tr>
+{{- end }}
+</table>
+{{- else }}
+<p>No evidence satisfied the policy.</p>
+{{- end }}
+<p>The digest of every file in this package is recorded in manifest.json.</p>
+</body>
+</html>
+`))
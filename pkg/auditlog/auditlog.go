@@ -0,0 +1,273 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auditlog records verification decisions in an append-only log. Each record carries the hash of the
+// record before it and is optionally signed, so removing, reordering, or editing a decision breaks the chain and
+// verification activity itself is tamper-evident.
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+)
+
+const (
+	ResultAllowed = "allowed"
+	ResultDenied  = "denied"
+)
+
+// Decision is the outcome of verifying subjects against a policy.
+type Decision struct {
+	Time time.Time `json:"time"`
+	// Source is the command that made the decision, such as verify or k8s-webhook.
+	Source       string   `json:"source"`
+	Subjects     []string `json:"subjects"`
+	PolicyDigest string   `json:"policydigest,omitempty"`
+	Result       string   `json:"result"`
+	// Category is the category of the error that denied the subjects, as witness's exit codes report it.
+	Category string   `json:"category,omitempty"`
+	Reasons  []string `json:"reasons,omitempty"`
+	// Context describes what was verified in terms of the source, such as the image and namespace of a Pod.
+	Context map[string]string `json:"context,omitempty"`
+}
+
+// Record is a line of the audit log.
+type Record struct {
+	Seq uint64 `json:"seq"`
+	Decision
+	// Dropped is the number of decisions the rate limit kept out of the log since the previous record.
+	Dropped  uint64 `json:"dropped,omitempty"`
+	PrevHash string `json:"prevhash"`
+	// Hash is the sha256 digest of the record without its hash and signature.
+	Hash      string `json:"hash"`
+	KeyID     string `json:"keyid,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// digest returns the hash of r, which covers every field but the hash and signature.
+func (r Record) digest() (string, error) {
+	r.Hash, r.KeyID, r.Signature = "", "", nil
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// sink is where records are appended. append is given the record to write once the previous record is known.
+type sink interface {
+	append(ctx context.Context, next func(prev *Record) (Record, error)) error
+	Close() error
+}
+
+type Option func(*Log)
+
+// WithSigner signs the hash of each record with signer.
+func WithSigner(signer cryptoutil.Signer) Option {
+	return func(l *Log) {
+		l.signer = signer
+	}
+}
+
+// WithRateLimit records at most perSecond decisions a second on average, with bursts of up to burst decisions.
+// Decisions over the limit are dropped and counted in the next record, so the log shows that decisions are missing
+// rather than growing without bound when a server is flooded. 0 doesn't limit decisions.
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(l *Log) {
+		l.limiter = newLimiter(perSecond, burst)
+	}
+}
+
+// WithBackground writes records from a background goroutine rather than while Record is called, so callers that
+// answer requests, such as the admission webhook, never wait on the log. Up to queue decisions wait to be written.
+// Decisions beyond that are dropped and counted in the next record, like those over the rate limit, and decisions
+// that fail to be written are logged.
+func WithBackground(queue int) Option {
+	return func(l *Log) {
+		l.queue = make(chan Decision, queue)
+	}
+}
+
+// Log appends decisions to an audit log. A nil Log discards decisions, so callers don't need to check whether an
+// audit log was requested.
+type Log struct {
+	// mu guards the limiter and dropped, and writeMu the sink, so deciding whether to record a decision never waits
+	// on a write.
+	mu      sync.Mutex
+	writeMu sync.Mutex
+	sink    sink
+	signer  cryptoutil.Signer
+	limiter *limiter
+	dropped uint64
+	queue   chan Decision
+	written chan struct{}
+}
+
+// Open opens the audit log at target, which is a file that records are appended to, or an http:// or https:// URL
+// that each record is POSTed to. It returns a nil Log if target is empty.
+func Open(target string, opts ...Option) (*Log, error) {
+	if target == "" {
+		return nil, nil
+	}
+
+	l := &Log{}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		l.sink = newHTTPSink(target)
+	} else {
+		s, err := openFileSink(target)
+		if err != nil {
+			return nil, err
+		}
+
+		l.sink = s
+	}
+
+	if l.queue != nil {
+		l.written = make(chan struct{})
+		go l.writeQueued()
+	}
+
+	return l, nil
+}
+
+// Record appends d to the log, unless the rate limit drops it.
+func (l *Log) Record(ctx context.Context, d Decision) error {
+	if l == nil {
+		return nil
+	}
+
+	if d.Time.IsZero() {
+		d.Time = time.Now().UTC()
+	}
+
+	l.mu.Lock()
+	if !l.limiter.allow() {
+		l.drop("Audit log rate limit exceeded, dropping decisions until it recovers")
+		l.mu.Unlock()
+		return nil
+	}
+
+	if l.queue != nil {
+		select {
+		case l.queue <- d:
+		default:
+			l.drop("Audit log is falling behind, dropping decisions until it catches up")
+		}
+
+		l.mu.Unlock()
+		return nil
+	}
+
+	l.mu.Unlock()
+	return l.write(ctx, d)
+}
+
+// drop counts a decision that isn't recorded, warning when decisions start being dropped. l.mu must be held.
+func (l *Log) drop(reason string) {
+	if l.dropped == 0 {
+		log.Warnf("%v", reason)
+	}
+
+	l.dropped++
+}
+
+// write appends d to the sink, counting the decisions dropped since the previous record in it.
+func (l *Log) write(ctx context.Context, d Decision) error {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+	var dropped uint64
+	err := l.sink.append(ctx, func(prev *Record) (Record, error) {
+		l.mu.Lock()
+		dropped, l.dropped = l.dropped, 0
+		l.mu.Unlock()
+		r := Record{Decision: d, Dropped: dropped}
+		if prev != nil {
+			r.Seq, r.PrevHash = prev.Seq+1, prev.Hash
+		}
+
+		return l.seal(r)
+	})
+	if err != nil {
+		// the dropped decisions weren't recorded, so the next record counts them
+		l.mu.Lock()
+		l.dropped += dropped
+		l.mu.Unlock()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	return nil
+}
+
+// writeQueued writes the decisions queued by Record until the log is closed.
+func (l *Log) writeQueued() {
+	defer close(l.written)
+	for d := range l.queue {
+		if err := l.write(context.Background(), d); err != nil {
+			log.Errorf("%v", err)
+		}
+	}
+}
+
+// seal sets the hash of r and signs it.
+func (l *Log) seal(r Record) (Record, error) {
+	hash, err := r.digest()
+	if err != nil {
+		return Record{}, err
+	}
+
+	r.Hash = hash
+	if l.signer == nil {
+		return r, nil
+	}
+
+	if r.KeyID, err = l.signer.KeyID(); err != nil {
+		return Record{}, fmt.Errorf("failed to get id of audit log key: %w", err)
+	}
+
+	if r.Signature, err = l.signer.Sign(bytes.NewReader([]byte(r.Hash))); err != nil {
+		return Record{}, fmt.Errorf("failed to sign audit log record: %w", err)
+	}
+
+	return r, nil
+}
+
+// Close writes the decisions still queued and closes the log. Decisions must not be recorded once it is called.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	if l.queue != nil {
+		close(l.queue)
+		<-l.written
+	}
+
+	return l.sink.Close()
+}
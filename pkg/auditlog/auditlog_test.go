@@ -0,0 +1,231 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+func newKey(t *testing.T) (cryptoutil.Signer, cryptoutil.Verifier) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return cryptoutil.NewECDSASigner(priv, crypto.SHA256), cryptoutil.NewECDSAVerifier(&priv.PublicKey, crypto.SHA256)
+}
+
+func decision(subject, result string) Decision {
+	return Decision{Source: "verify", Subjects: []string{subject}, PolicyDigest: "abc", Result: result}
+}
+
+func TestRecordChainsAcrossOpens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	signer, verifier := newKey(t)
+	for _, subject := range []string{"a", "b"} {
+		l, err := Open(path, WithSigner(signer))
+		require.NoError(t, err)
+		require.NoError(t, l.Record(context.Background(), decision(subject, ResultAllowed)))
+		require.NoError(t, l.Close())
+	}
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	records, err := Verify(f, verifier)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, uint64(1), records[1].Seq)
+	require.Equal(t, records[0].Hash, records[1].PrevHash)
+	require.Equal(t, []string{"b"}, records[1].Subjects)
+	require.False(t, records[0].Time.IsZero())
+}
+
+func TestRecordConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		l, err := Open(path)
+		require.NoError(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				require.NoError(t, l.Record(context.Background(), decision("a", ResultAllowed)))
+			}
+		}()
+	}
+
+	wg.Wait()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	records, err := Verify(f)
+	require.NoError(t, err)
+	require.Len(t, records, 20)
+}
+
+func TestLockReleasedWhenWriterExits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows falls back to a lock file that is only broken once it is stale")
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	require.NoError(t, err)
+
+	// a witness that crashed while appending closed the log without unlocking it
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	require.NoError(t, err)
+	_, err = lockFile(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	start := time.Now()
+	require.NoError(t, l.Record(context.Background(), decision("a", ResultAllowed)))
+	require.Less(t, time.Since(start), lockTimeout)
+}
+
+func TestBackground(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, WithBackground(1))
+	require.NoError(t, err)
+
+	// another writer holds the log, so records queue up rather than making Record wait
+	l.writeMu.Lock()
+	require.NoError(t, l.Record(context.Background(), decision("a", ResultAllowed)))
+	require.Eventually(t, func() bool { return len(l.queue) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, l.Record(context.Background(), decision("b", ResultAllowed)))
+	require.NoError(t, l.Record(context.Background(), decision("c", ResultAllowed)))
+	require.NoError(t, l.Record(context.Background(), decision("d", ResultAllowed)))
+	l.writeMu.Unlock()
+	require.NoError(t, l.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	records, err := Verify(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, []string{"b"}, records[1].Subjects)
+	// the queued decisions were written once c and d were dropped, so either may count them
+	require.Equal(t, uint64(2), records[0].Dropped+records[1].Dropped)
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	signer, verifier := newKey(t)
+	_, otherVerifier := newKey(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, WithSigner(signer))
+	require.NoError(t, err)
+	for _, result := range []string{ResultDenied, ResultAllowed, ResultAllowed} {
+		require.NoError(t, l.Record(context.Background(), decision("a", result)))
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(strings.TrimSpace(string(data)), "\n")
+
+	for name, test := range map[string]struct {
+		log       string
+		verifiers []cryptoutil.Verifier
+		message   string
+	}{
+		"edited": {
+			log:       strings.Replace(string(data), ResultDenied, ResultAllowed, 1),
+			verifiers: []cryptoutil.Verifier{verifier},
+			message:   "record 0 doesn't match its hash",
+		},
+		"removed": {
+			log:     lines[0] + lines[2],
+			message: "record 2 is out of sequence",
+		},
+		"untrusted key": {
+			log:       string(data),
+			verifiers: []cryptoutil.Verifier{otherVerifier},
+			message:   "record 0 is not signed by a trusted key",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Verify(strings.NewReader(test.log), test.verifiers...)
+			require.ErrorContains(t, err, test.message)
+		})
+	}
+}
+
+func TestRateLimitCountsDroppedDecisions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, WithRateLimit(1, 2))
+	require.NoError(t, err)
+	now := time.Now()
+	l.limiter.now = func() time.Time { return now }
+	for i := 0; i < 5; i++ {
+		require.NoError(t, l.Record(context.Background(), decision("a", ResultAllowed)))
+	}
+
+	now = now.Add(time.Second)
+	require.NoError(t, l.Record(context.Background(), decision("b", ResultAllowed)))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	records, err := Verify(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, uint64(3), records[2].Dropped)
+}
+
+func TestHTTPSink(t *testing.T) {
+	received := []Record{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := Record{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&rec))
+		received = append(received, rec)
+		if rec.Result == ResultDenied {
+			http.Error(w, "full", http.StatusInsufficientStorage)
+		}
+	}))
+	defer server.Close()
+
+	l, err := Open(server.URL)
+	require.NoError(t, err)
+	require.NoError(t, l.Record(context.Background(), decision("a", ResultAllowed)))
+	require.ErrorContains(t, l.Record(context.Background(), decision("b", ResultDenied)), "full")
+	require.NoError(t, l.Record(context.Background(), decision("c", ResultAllowed)))
+	require.Len(t, received, 3)
+	require.Equal(t, received[0].Hash, received[2].PrevHash)
+	require.Equal(t, uint64(1), received[2].Seq)
+}
+
+func TestNilLog(t *testing.T) {
+	l, err := Open("")
+	require.NoError(t, err)
+	require.Nil(t, l)
+	require.NoError(t, l.Record(context.Background(), decision("a", ResultAllowed)))
+	require.NoError(t, l.Close())
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditlog
+
+import (
+	"time"
+)
+
+// limiter is a token bucket. Unlike the archivista limiter it never waits, since a decision shouldn't be held up by
+// its audit record; decisions over the limit are dropped instead.
+type limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// newLimiter returns a limiter allowing perSecond decisions a second in bursts of up to burst, or nil if perSecond
+// isn't positive. A nil limiter doesn't limit anything.
+func newLimiter(perSecond float64, burst int) *limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &limiter{rate: perSecond, burst: float64(burst), tokens: float64(burst), now: time.Now}
+}
+
+// allow takes a token from the bucket if there is one. Callers serialize calls to allow.
+func (l *limiter) allow() bool {
+	if l == nil {
+		return true
+	}
+
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+
+	l.tokens--
+	return true
+}
@@ -0,0 +1,179 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	lockTimeout = 10 * time.Second
+	// lockPollInterval is how often a lock held by another witness process is retried.
+	lockPollInterval = 50 * time.Millisecond
+	// tailChunkSize is how much of the end of the log is read at a time to find the last record.
+	tailChunkSize = 4096
+)
+
+// fileSink appends records to a file of JSON lines. The file is locked while a record is appended and the previous
+// record is read from the file itself, so witness processes sharing a log extend one chain.
+type fileSink struct {
+	path string
+}
+
+func openFileSink(path string) (*fileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return &fileSink{path: path}, f.Close()
+}
+
+func (s *fileSink) append(_ context.Context, next func(prev *Record) (Record, error)) error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	unlock, err := lockFile(f)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+	prev, err := lastRecord(f)
+	if err != nil {
+		return err
+	}
+
+	r, err := next(prev)
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+func (s *fileSink) Close() error {
+	return nil
+}
+
+// lastRecord returns the last record of the log f, or nil if it is empty.
+func lastRecord(f *os.File) (*Record, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	end := info.Size()
+	tail := []byte{}
+	for offset := end; offset > 0; {
+		size := int64(tailChunkSize)
+		if offset < size {
+			size = offset
+		}
+
+		offset -= size
+		chunk := make([]byte, size)
+		if _, err := f.ReadAt(chunk, offset); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		tail = append(chunk, tail...)
+		if i := bytes.LastIndexByte(bytes.TrimRight(tail, "\n"), '\n'); i >= 0 {
+			tail = tail[i+1:]
+			break
+		}
+	}
+
+	tail = bytes.TrimSpace(tail)
+	if len(tail) == 0 {
+		return nil, nil
+	}
+
+	r := &Record{}
+	if err := json.Unmarshal(tail, r); err != nil {
+		return nil, fmt.Errorf("failed to parse last record of audit log: %w", err)
+	}
+
+	return r, nil
+}
+
+// httpSink POSTs each record to a remote audit service. The chain is kept in memory, so each witness process starts
+// a new chain at sequence 0 that the service can tell apart from the others.
+type httpSink struct {
+	url    string
+	client *http.Client
+	prev   *Record
+}
+
+func newHTTPSink(url string) *httpSink {
+	return &httpSink{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *httpSink) append(ctx context.Context, next func(prev *Record) (Record, error)) error {
+	r, err := next(s.prev)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("audit log service returned %v: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	s.prev = &r
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+// maxRecordSize bounds the lines Verify reads, so a corrupt log can't exhaust memory.
+const maxRecordSize = 1 << 20
+
+// Verify checks that the records of the audit log read from r form an unbroken chain, and that each is signed by
+// one of verifiers if any are given. It returns the records checked, up to and excluding the first that fails.
+func Verify(r io.Reader, verifiers ...cryptoutil.Verifier) ([]Record, error) {
+	records := []Record{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, tailChunkSize), maxRecordSize)
+	var prev *Record
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		rec := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return records, fmt.Errorf("line %v: failed to parse record: %w", line, err)
+		}
+
+		if err := verifyRecord(rec, prev, verifiers); err != nil {
+			return records, fmt.Errorf("line %v: record %v %w", line, rec.Seq, err)
+		}
+
+		records = append(records, rec)
+		prev = &records[len(records)-1]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	return records, nil
+}
+
+func verifyRecord(rec Record, prev *Record, verifiers []cryptoutil.Verifier) error {
+	seq, prevHash := uint64(0), ""
+	if prev != nil {
+		seq, prevHash = prev.Seq+1, prev.Hash
+	}
+
+	if rec.Seq != seq {
+		return fmt.Errorf("is out of sequence, expected record %v", seq)
+	}
+
+	if rec.PrevHash != prevHash {
+		return fmt.Errorf("doesn't follow the hash of the record before it")
+	}
+
+	digest, err := rec.digest()
+	if err != nil {
+		return err
+	}
+
+	if rec.Hash != digest {
+		return fmt.Errorf("doesn't match its hash, it was modified")
+	}
+
+	if len(verifiers) == 0 {
+		return nil
+	}
+
+	if len(rec.Signature) == 0 {
+		return fmt.Errorf("is not signed")
+	}
+
+	for _, verifier := range verifiers {
+		if err := verifier.Verify(bytes.NewReader([]byte(rec.Hash)), rec.Signature); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("is not signed by a trusted key")
+}
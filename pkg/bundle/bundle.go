@@ -0,0 +1,307 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bundle converts signed envelopes to and from Sigstore bundles, which carry the signature, the signing
+// certificate, transparency log entries, and timestamps in a single object that any Sigstore verifier understands,
+// and encodes envelopes in CBOR and protobuf for consumers that can't afford JSON.
+package bundle
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/testifysec/go-witness/dsse"
+)
+
+const (
+	MediaTypeV03 = "application/vnd.dev.sigstore.bundle.v0.3+json"
+	// MediaTypeV02 is used when the signing certificate has intermediates, since v0.3 bundles only carry the leaf
+	MediaTypeV02 = "application/vnd.dev.sigstore.bundle+json;version=0.2"
+
+	mediaTypePrefix = "application/vnd.dev.sigstore.bundle"
+
+	FormatDSSE           = "dsse"
+	FormatSigstoreBundle = "sigstore-bundle"
+	// FormatDSSECBOR and FormatDSSEProtobuf encode the dsse envelope deterministically in CBOR and as the DSSE
+	// Envelope protobuf message. The payload and signatures are stored as raw bytes rather than base64, which makes
+	// envelopes about a quarter smaller. The payload itself, the statement that was signed, is unchanged.
+	FormatDSSECBOR     = "dsse-cbor"
+	FormatDSSEProtobuf = "dsse-protobuf"
+)
+
+// Formats are the formats signed envelopes can be written in.
+var Formats = []string{FormatDSSE, FormatSigstoreBundle, FormatDSSECBOR, FormatDSSEProtobuf}
+
+var errNotEnvelope = errors.New("data is not a json, cbor, or protobuf encoded envelope")
+
+// Bundle is the JSON encoding of the Sigstore bundle protobuf message.
+type Bundle struct {
+	MediaType            string               `json:"mediaType"`
+	VerificationMaterial VerificationMaterial `json:"verificationMaterial"`
+	DSSEEnvelope         *Envelope            `json:"dsseEnvelope,omitempty"`
+}
+
+type VerificationMaterial struct {
+	PublicKey                 *PublicKeyIdentifier       `json:"publicKey,omitempty"`
+	Certificate               *Certificate               `json:"certificate,omitempty"`
+	X509CertificateChain      *CertificateChain          `json:"x509CertificateChain,omitempty"`
+	TlogEntries               []json.RawMessage          `json:"tlogEntries,omitempty"`
+	TimestampVerificationData *TimestampVerificationData `json:"timestampVerificationData,omitempty"`
+}
+
+type PublicKeyIdentifier struct {
+	Hint string `json:"hint,omitempty"`
+}
+
+type Certificate struct {
+	RawBytes []byte `json:"rawBytes"`
+}
+
+type CertificateChain struct {
+	Certificates []Certificate `json:"certificates"`
+}
+
+type TimestampVerificationData struct {
+	RFC3161Timestamps []RFC3161Timestamp `json:"rfc3161Timestamps,omitempty"`
+}
+
+type RFC3161Timestamp struct {
+	SignedTimestamp []byte `json:"signedTimestamp"`
+}
+
+type Envelope struct {
+	Payload     []byte      `json:"payload"`
+	PayloadType string      `json:"payloadType"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+type Signature struct {
+	Sig   []byte `json:"sig"`
+	KeyID string `json:"keyid,omitempty"`
+}
+
+// FromEnvelope converts a signed envelope into a bundle. Bundles carry exactly one signature.
+func FromEnvelope(env dsse.Envelope) (Bundle, error) {
+	if len(env.Signatures) != 1 {
+		return Bundle{}, fmt.Errorf("sigstore bundles carry exactly one signature, the envelope has %v", len(env.Signatures))
+	}
+
+	sig := env.Signatures[0]
+	b := Bundle{
+		MediaType: MediaTypeV03,
+		DSSEEnvelope: &Envelope{
+			Payload:     env.Payload,
+			PayloadType: env.PayloadType,
+			Signatures:  []Signature{{Sig: sig.Signature, KeyID: sig.KeyID}},
+		},
+	}
+
+	switch {
+	case len(sig.Certificate) == 0:
+		b.VerificationMaterial.PublicKey = &PublicKeyIdentifier{Hint: sig.KeyID}
+	case len(sig.Intermediates) == 0:
+		leaf, err := certificateDER(sig.Certificate)
+		if err != nil {
+			return Bundle{}, err
+		}
+
+		b.VerificationMaterial.Certificate = &Certificate{RawBytes: leaf}
+	default:
+		b.MediaType = MediaTypeV02
+		chain := &CertificateChain{}
+		for _, certPEM := range append([][]byte{sig.Certificate}, sig.Intermediates...) {
+			der, err := certificateDER(certPEM)
+			if err != nil {
+				return Bundle{}, err
+			}
+
+			chain.Certificates = append(chain.Certificates, Certificate{RawBytes: der})
+		}
+
+		b.VerificationMaterial.X509CertificateChain = chain
+	}
+
+	for _, ts := range sig.Timestamps {
+		if ts.Type != dsse.TimestampRFC3161 {
+			continue
+		}
+
+		if b.VerificationMaterial.TimestampVerificationData == nil {
+			b.VerificationMaterial.TimestampVerificationData = &TimestampVerificationData{}
+		}
+
+		tvd := b.VerificationMaterial.TimestampVerificationData
+		tvd.RFC3161Timestamps = append(tvd.RFC3161Timestamps, RFC3161Timestamp{SignedTimestamp: ts.Data})
+	}
+
+	return b, nil
+}
+
+// Envelope converts the bundle back into a signed envelope. Transparency log entries have no equivalent in an
+// envelope and are dropped.
+func (b Bundle) Envelope() (dsse.Envelope, error) {
+	if !strings.HasPrefix(b.MediaType, mediaTypePrefix) {
+		return dsse.Envelope{}, fmt.Errorf("unsupported bundle media type %v", b.MediaType)
+	}
+
+	if b.DSSEEnvelope == nil {
+		return dsse.Envelope{}, errors.New("bundle does not contain a dsse envelope")
+	}
+
+	if len(b.DSSEEnvelope.Signatures) != 1 {
+		return dsse.Envelope{}, fmt.Errorf("bundle has %v signatures, expected exactly one", len(b.DSSEEnvelope.Signatures))
+	}
+
+	bundleSig := b.DSSEEnvelope.Signatures[0]
+	sig := dsse.Signature{KeyID: bundleSig.KeyID, Signature: bundleSig.Sig}
+	vm := b.VerificationMaterial
+	certs := []Certificate{}
+	if vm.Certificate != nil {
+		certs = append(certs, *vm.Certificate)
+	} else if vm.X509CertificateChain != nil {
+		certs = vm.X509CertificateChain.Certificates
+	}
+
+	for i, cert := range certs {
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: dsse.PemTypeCertificate, Bytes: cert.RawBytes})
+		if i == 0 {
+			sig.Certificate = certPEM
+		} else {
+			sig.Intermediates = append(sig.Intermediates, certPEM)
+		}
+	}
+
+	if vm.TimestampVerificationData != nil {
+		for _, ts := range vm.TimestampVerificationData.RFC3161Timestamps {
+			sig.Timestamps = append(sig.Timestamps, dsse.SignatureTimestamp{Type: dsse.TimestampRFC3161, Data: ts.SignedTimestamp})
+		}
+	}
+
+	return dsse.Envelope{
+		Payload:     b.DSSEEnvelope.Payload,
+		PayloadType: b.DSSEEnvelope.PayloadType,
+		Signatures:  []dsse.Signature{sig},
+	}, nil
+}
+
+// Encode encodes a signed envelope in format, one of Formats. Sigstore bundles carry tlogEntries, the envelope's
+// entries in transparency logs, which dsse envelopes have no place for.
+func Encode(env dsse.Envelope, format string, tlogEntries ...json.RawMessage) ([]byte, error) {
+	switch format {
+	case FormatDSSE, "":
+		return json.Marshal(&env)
+	case FormatSigstoreBundle:
+		b, err := FromEnvelope(env)
+		if err != nil {
+			return nil, err
+		}
+
+		b.VerificationMaterial.TlogEntries = tlogEntries
+		return json.Marshal(&b)
+	case FormatDSSECBOR:
+		return encodeCBOR(env), nil
+	case FormatDSSEProtobuf:
+		return encodeProtobuf(env), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %v, expected one of %v", format, strings.Join(Formats, ", "))
+	}
+}
+
+// Decode decodes a signed envelope written in any of Formats. Data that isn't JSON is a CBOR envelope if it starts
+// with a CBOR map, and a protobuf envelope otherwise.
+func Decode(data []byte) (dsse.Envelope, error) {
+	if !json.Valid(data) {
+		return decodeBinary(data)
+	}
+
+	probe := struct {
+		MediaType string `json:"mediaType"`
+	}{}
+
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return dsse.Envelope{}, err
+	}
+
+	if probe.MediaType == "" {
+		env := dsse.Envelope{}
+		if err := json.Unmarshal(data, &env); err != nil {
+			return dsse.Envelope{}, err
+		}
+
+		return env, nil
+	}
+
+	b := Bundle{}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return dsse.Envelope{}, err
+	}
+
+	return b.Envelope()
+}
+
+// TlogEntries returns the transparency log entries of a Sigstore bundle. Envelopes in the other formats have none.
+func TlogEntries(data []byte) ([]json.RawMessage, error) {
+	if !json.Valid(data) {
+		return nil, nil
+	}
+
+	b := Bundle{}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(b.MediaType, mediaTypePrefix) {
+		return nil, nil
+	}
+
+	return b.VerificationMaterial.TlogEntries, nil
+}
+
+func decodeBinary(data []byte) (dsse.Envelope, error) {
+	if len(data) == 0 {
+		return dsse.Envelope{}, errNotEnvelope
+	}
+
+	if data[0]>>5 == cborMap {
+		env, err := decodeCBOR(data)
+		if err != nil {
+			return dsse.Envelope{}, fmt.Errorf("%w: %v", errNotEnvelope, err)
+		}
+
+		return env, nil
+	}
+
+	env, err := decodeProtobuf(data)
+	if err != nil {
+		return dsse.Envelope{}, fmt.Errorf("%w: %v", errNotEnvelope, err)
+	}
+
+	if env.PayloadType == "" || len(env.Signatures) == 0 {
+		return dsse.Envelope{}, errNotEnvelope
+	}
+
+	return env, nil
+}
+
+func certificateDER(certPEM []byte) ([]byte, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != dsse.PemTypeCertificate {
+		return nil, errors.New("signature certificate is not a pem encoded certificate")
+	}
+
+	return block.Bytes, nil
+}
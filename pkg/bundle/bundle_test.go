@@ -0,0 +1,186 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/dsse"
+)
+
+func certPEM(der string) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: dsse.PemTypeCertificate, Bytes: []byte(der)})
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		sig       dsse.Signature
+		mediaType string
+	}{
+		{
+			name:      "public key",
+			sig:       dsse.Signature{KeyID: "key", Signature: []byte("sig")},
+			mediaType: MediaTypeV03,
+		},
+		{
+			name: "certificate with timestamp",
+			sig: dsse.Signature{
+				KeyID:       "key",
+				Signature:   []byte("sig"),
+				Certificate: certPEM("leaf"),
+				Timestamps:  []dsse.SignatureTimestamp{{Type: dsse.TimestampRFC3161, Data: []byte("token")}},
+			},
+			mediaType: MediaTypeV03,
+		},
+		{
+			name: "certificate chain",
+			sig: dsse.Signature{
+				KeyID:         "key",
+				Signature:     []byte("sig"),
+				Certificate:   certPEM("leaf"),
+				Intermediates: [][]byte{certPEM("intermediate")},
+			},
+			mediaType: MediaTypeV02,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := dsse.Envelope{Payload: []byte("{}"), PayloadType: "application/vnd.in-toto+json", Signatures: []dsse.Signature{test.sig}}
+			encoded, err := Encode(env, FormatSigstoreBundle)
+			require.NoError(t, err)
+
+			b := Bundle{}
+			require.NoError(t, json.Unmarshal(encoded, &b))
+			require.Equal(t, test.mediaType, b.MediaType)
+
+			decoded, err := Decode(encoded)
+			require.NoError(t, err)
+			require.Equal(t, env, decoded)
+		})
+	}
+}
+
+func TestBundleFields(t *testing.T) {
+	env := dsse.Envelope{Payload: []byte("{}"), PayloadType: "application/vnd.in-toto+json", Signatures: []dsse.Signature{{
+		KeyID:       "key",
+		Signature:   []byte("sig"),
+		Certificate: certPEM("leaf"),
+		Timestamps:  []dsse.SignatureTimestamp{{Type: dsse.TimestampRFC3161, Data: []byte("token")}},
+	}}}
+
+	encoded, err := Encode(env, FormatSigstoreBundle)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": {
+			"certificate": {"rawBytes": "bGVhZg=="},
+			"timestampVerificationData": {"rfc3161Timestamps": [{"signedTimestamp": "dG9rZW4="}]}
+		},
+		"dsseEnvelope": {
+			"payload": "e30=",
+			"payloadType": "application/vnd.in-toto+json",
+			"signatures": [{"sig": "c2ln", "keyid": "key"}]
+		}
+	}`, string(encoded))
+}
+
+func TestEncodeTlogEntries(t *testing.T) {
+	env := dsse.Envelope{Payload: []byte("{}"), PayloadType: "application/vnd.in-toto+json", Signatures: []dsse.Signature{{Signature: []byte("sig")}}}
+	entry := json.RawMessage(`{"logIndex":"7"}`)
+	encoded, err := Encode(env, FormatSigstoreBundle, entry)
+	require.NoError(t, err)
+	b := Bundle{}
+	require.NoError(t, json.Unmarshal(encoded, &b))
+	require.Equal(t, []json.RawMessage{entry}, b.VerificationMaterial.TlogEntries)
+	entries, err := TlogEntries(encoded)
+	require.NoError(t, err)
+	require.Equal(t, []json.RawMessage{entry}, entries)
+
+	// dsse envelopes have no place for entries
+	encoded, err = Encode(env, FormatDSSE, entry)
+	require.NoError(t, err)
+	require.NotContains(t, string(encoded), "logIndex")
+	entries, err = TlogEntries(encoded)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestEncodeErrors(t *testing.T) {
+	env := dsse.Envelope{Payload: []byte("{}"), PayloadType: "application/vnd.in-toto+json", Signatures: []dsse.Signature{{Signature: []byte("a")}, {Signature: []byte("b")}}}
+	_, err := Encode(env, FormatSigstoreBundle)
+	require.Error(t, err)
+
+	_, err = Encode(env, "cbor")
+	require.Error(t, err)
+
+	encoded, err := Encode(env, FormatDSSE)
+	require.NoError(t, err)
+	decoded, err := Decode(encoded)
+	require.NoError(t, err)
+	require.Equal(t, env, decoded)
+}
+
+func TestDecodeUnknownMediaType(t *testing.T) {
+	_, err := Decode([]byte(`{"mediaType": "application/json"}`))
+	require.Error(t, err)
+}
+
+func TestBinaryFormats(t *testing.T) {
+	env := dsse.Envelope{Payload: []byte(`{"_type":"https://in-toto.io/Statement/v0.1"}`), PayloadType: "application/vnd.in-toto+json", Signatures: []dsse.Signature{
+		{
+			KeyID:         "key",
+			Signature:     []byte("sig"),
+			Certificate:   certPEM("leaf"),
+			Intermediates: [][]byte{certPEM("intermediate")},
+			Timestamps:    []dsse.SignatureTimestamp{{Type: dsse.TimestampRFC3161, Data: []byte("token")}},
+		},
+		{Signature: []byte("countersig")},
+	}}
+
+	jsonEncoded, err := Encode(env, FormatDSSE)
+	require.NoError(t, err)
+	for _, format := range []string{FormatDSSECBOR, FormatDSSEProtobuf} {
+		t.Run(format, func(t *testing.T) {
+			encoded, err := Encode(env, format)
+			require.NoError(t, err)
+			again, err := Encode(env, format)
+			require.NoError(t, err)
+			require.Equal(t, encoded, again)
+			require.Less(t, len(encoded), len(jsonEncoded))
+
+			decoded, err := Decode(encoded)
+			require.NoError(t, err)
+			require.Equal(t, env, decoded)
+
+			_, err = Decode(encoded[:len(encoded)-1])
+			require.ErrorIs(t, err, errNotEnvelope)
+		})
+	}
+
+	// core deterministic CBOR sorts map keys by their encoding, which puts shorter keys first:
+	// {"payload": h'01', "signatures": [{"sig": h'02'}], "payloadType": "t"}
+	encoded, err := Encode(dsse.Envelope{Payload: []byte{1}, PayloadType: "t", Signatures: []dsse.Signature{{Signature: []byte{2}}}}, FormatDSSECBOR)
+	require.NoError(t, err)
+	require.Equal(t, "a3677061796c6f616441016a7369676e61747572657381a16373696741026b7061796c6f6164547970656174", hex.EncodeToString(encoded))
+
+	_, err = Decode([]byte("not an envelope"))
+	require.ErrorIs(t, err, errNotEnvelope)
+}
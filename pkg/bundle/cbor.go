@@ -0,0 +1,376 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/testifysec/go-witness/dsse"
+)
+
+// CBOR major types used by envelopes. Envelopes only hold byte strings, text strings, arrays, and maps.
+const (
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+	cborMap   = 5
+)
+
+// cborValue is a decoded CBOR data item: a []byte, a string, a []cborValue, or a map[string]cborValue.
+type cborValue interface{}
+
+// encodeCBOR encodes a signed envelope as a CBOR map with the keys of the envelope's JSON encoding, using the core
+// deterministic encoding of RFC 8949: definite lengths in their shortest form and map keys sorted by their encoding.
+// Empty fields are left out, as in the JSON encoding.
+func encodeCBOR(env dsse.Envelope) []byte {
+	signatures := make([]cborValue, 0, len(env.Signatures))
+	for _, sig := range env.Signatures {
+		m := map[string]cborValue{"sig": sig.Signature}
+		if sig.KeyID != "" {
+			m["keyid"] = sig.KeyID
+		}
+
+		if len(sig.Certificate) > 0 {
+			m["certificate"] = sig.Certificate
+		}
+
+		if len(sig.Intermediates) > 0 {
+			intermediates := make([]cborValue, 0, len(sig.Intermediates))
+			for _, intermediate := range sig.Intermediates {
+				intermediates = append(intermediates, intermediate)
+			}
+
+			m["intermediates"] = intermediates
+		}
+
+		if len(sig.Timestamps) > 0 {
+			timestamps := make([]cborValue, 0, len(sig.Timestamps))
+			for _, ts := range sig.Timestamps {
+				timestamps = append(timestamps, map[string]cborValue{"type": string(ts.Type), "data": ts.Data})
+			}
+
+			m["timestamps"] = timestamps
+		}
+
+		signatures = append(signatures, m)
+	}
+
+	buf := &bytes.Buffer{}
+	writeCBOR(buf, map[string]cborValue{"payload": env.Payload, "payloadType": env.PayloadType, "signatures": signatures})
+	return buf.Bytes()
+}
+
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= 0xff:
+		buf.Write([]byte{major<<5 | 24, byte(n)})
+	case n <= 0xffff:
+		buf.WriteByte(major<<5 | 25)
+		_ = binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= 0xffffffff:
+		buf.WriteByte(major<<5 | 26)
+		_ = binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		_ = binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+func writeCBOR(buf *bytes.Buffer, v cborValue) {
+	switch v := v.(type) {
+	case []byte:
+		writeCBORHead(buf, cborBytes, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeCBORHead(buf, cborText, uint64(len(v)))
+		buf.WriteString(v)
+	case []cborValue:
+		writeCBORHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			writeCBOR(buf, item)
+		}
+	case map[string]cborValue:
+		keys := make([][]byte, 0, len(v))
+		byKey := make(map[string]string, len(v))
+		for key := range v {
+			encodedKey := &bytes.Buffer{}
+			writeCBOR(encodedKey, key)
+			keys = append(keys, encodedKey.Bytes())
+			byKey[encodedKey.String()] = key
+		}
+
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+		writeCBORHead(buf, cborMap, uint64(len(v)))
+		for _, key := range keys {
+			buf.Write(key)
+			writeCBOR(buf, v[byKey[string(key)]])
+		}
+	}
+}
+
+// decodeCBOR decodes a signed envelope encoded by encodeCBOR. Keys the envelope doesn't have are ignored.
+func decodeCBOR(data []byte) (dsse.Envelope, error) {
+	d := cborDecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return dsse.Envelope{}, err
+	}
+
+	if d.pos != len(data) {
+		return dsse.Envelope{}, errors.New("unexpected data after cbor envelope")
+	}
+
+	m, ok := v.(map[string]cborValue)
+	if !ok {
+		return dsse.Envelope{}, errors.New("cbor envelope is not a map")
+	}
+
+	env := dsse.Envelope{}
+	if env.Payload, err = cborBytesField(m, "payload"); err != nil {
+		return dsse.Envelope{}, err
+	}
+
+	if env.PayloadType, err = cborTextField(m, "payloadType"); err != nil {
+		return dsse.Envelope{}, err
+	}
+
+	signatures, err := cborArrayField(m, "signatures")
+	if err != nil {
+		return dsse.Envelope{}, err
+	}
+
+	for _, s := range signatures {
+		sigMap, ok := s.(map[string]cborValue)
+		if !ok {
+			return dsse.Envelope{}, errors.New("cbor envelope signature is not a map")
+		}
+
+		sig := dsse.Signature{}
+		if sig.Signature, err = cborBytesField(sigMap, "sig"); err != nil {
+			return dsse.Envelope{}, err
+		}
+
+		if sig.KeyID, err = cborTextField(sigMap, "keyid"); err != nil {
+			return dsse.Envelope{}, err
+		}
+
+		if sig.Certificate, err = cborBytesField(sigMap, "certificate"); err != nil {
+			return dsse.Envelope{}, err
+		}
+
+		intermediates, err := cborArrayField(sigMap, "intermediates")
+		if err != nil {
+			return dsse.Envelope{}, err
+		}
+
+		for _, intermediate := range intermediates {
+			der, ok := intermediate.([]byte)
+			if !ok {
+				return dsse.Envelope{}, errors.New("cbor envelope intermediate is not a byte string")
+			}
+
+			sig.Intermediates = append(sig.Intermediates, der)
+		}
+
+		timestamps, err := cborArrayField(sigMap, "timestamps")
+		if err != nil {
+			return dsse.Envelope{}, err
+		}
+
+		for _, t := range timestamps {
+			tsMap, ok := t.(map[string]cborValue)
+			if !ok {
+				return dsse.Envelope{}, errors.New("cbor envelope timestamp is not a map")
+			}
+
+			tsType, err := cborTextField(tsMap, "type")
+			if err != nil {
+				return dsse.Envelope{}, err
+			}
+
+			tsData, err := cborBytesField(tsMap, "data")
+			if err != nil {
+				return dsse.Envelope{}, err
+			}
+
+			sig.Timestamps = append(sig.Timestamps, dsse.SignatureTimestamp{Type: dsse.SignatureTimestampType(tsType), Data: tsData})
+		}
+
+		env.Signatures = append(env.Signatures, sig)
+	}
+
+	return env, nil
+}
+
+// cborBytesField returns the byte string at key in m, or nil if m doesn't have key.
+func cborBytesField(m map[string]cborValue, key string) ([]byte, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("cbor envelope field %v is not a byte string", key)
+	}
+
+	return b, nil
+}
+
+// cborTextField returns the text string at key in m, or "" if m doesn't have key.
+func cborTextField(m map[string]cborValue, key string) (string, error) {
+	v, ok := m[key]
+	if !ok {
+		return "", nil
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("cbor envelope field %v is not a text string", key)
+	}
+
+	return s, nil
+}
+
+// cborArrayField returns the array at key in m, or nil if m doesn't have key.
+func cborArrayField(m map[string]cborValue, key string) ([]cborValue, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+
+	items, ok := v.([]cborValue)
+	if !ok {
+		return nil, fmt.Errorf("cbor envelope field %v is not an array", key)
+	}
+
+	return items, nil
+}
+
+// maxCBORDepth bounds how deeply decoded items nest. Envelopes nest three deep.
+const maxCBORDepth = 16
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, errors.New("unexpected end of cbor data")
+	}
+
+	initial := d.data[d.pos]
+	d.pos++
+	major, info := initial>>5, initial&0x1f
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+
+	if info > 27 {
+		return 0, 0, errors.New("indefinite length cbor items are not supported")
+	}
+
+	size := 1 << (info - 24)
+	if len(d.data)-d.pos < size {
+		return 0, 0, errors.New("unexpected end of cbor data")
+	}
+
+	n := uint64(0)
+	for _, b := range d.data[d.pos : d.pos+size] {
+		n = n<<8 | uint64(b)
+	}
+
+	d.pos += size
+	return major, n, nil
+}
+
+func (d *cborDecoder) value(depth int) (cborValue, error) {
+	if depth > maxCBORDepth {
+		return nil, errors.New("cbor data nests too deeply")
+	}
+
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborBytes, cborText:
+		if uint64(len(d.data)-d.pos) < n {
+			return nil, errors.New("unexpected end of cbor data")
+		}
+
+		raw := d.data[d.pos : d.pos+int(n)]
+		d.pos += int(n)
+		if major == cborText {
+			return string(raw), nil
+		}
+
+		return append([]byte{}, raw...), nil
+	case cborArray:
+		// every item takes at least a byte, which bounds what a forged length can allocate
+		if uint64(len(d.data)-d.pos) < n {
+			return nil, errors.New("unexpected end of cbor data")
+		}
+
+		items := make([]cborValue, 0, n)
+		for i := uint64(0); i < n; i++ {
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, item)
+		}
+
+		return items, nil
+	case cborMap:
+		if uint64(len(d.data)-d.pos) < n {
+			return nil, errors.New("unexpected end of cbor data")
+		}
+
+		m := make(map[string]cborValue, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, errors.New("cbor map key is not a text string")
+			}
+
+			if _, ok := m[keyString]; ok {
+				return nil, fmt.Errorf("cbor map has duplicate key %v", keyString)
+			}
+
+			if m[keyString], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unsupported cbor major type %v", major)
+	}
+}
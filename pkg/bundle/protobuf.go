@@ -0,0 +1,175 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"fmt"
+
+	"github.com/testifysec/go-witness/dsse"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the DSSE Envelope and Signature protobuf messages. Witness adds the signing certificate, its
+// intermediates, and timestamps to Signature as fields 3 to 5, which other DSSE consumers skip as unknown fields.
+const (
+	envelopePayloadField     protowire.Number = 1
+	envelopePayloadTypeField protowire.Number = 2
+	envelopeSignaturesField  protowire.Number = 3
+
+	signatureSigField           protowire.Number = 1
+	signatureKeyIDField         protowire.Number = 2
+	signatureCertificateField   protowire.Number = 3
+	signatureIntermediatesField protowire.Number = 4
+	signatureTimestampsField    protowire.Number = 5
+
+	timestampTypeField protowire.Number = 1
+	timestampDataField protowire.Number = 2
+)
+
+// encodeProtobuf encodes a signed envelope as the DSSE Envelope protobuf message. Fields are written in field number
+// order and empty fields are left out, so an envelope always encodes to the same bytes.
+func encodeProtobuf(env dsse.Envelope) []byte {
+	b := appendProtobufBytes(nil, envelopePayloadField, env.Payload)
+	b = appendProtobufBytes(b, envelopePayloadTypeField, []byte(env.PayloadType))
+	for _, sig := range env.Signatures {
+		sigBytes := appendProtobufBytes(nil, signatureSigField, sig.Signature)
+		sigBytes = appendProtobufBytes(sigBytes, signatureKeyIDField, []byte(sig.KeyID))
+		sigBytes = appendProtobufBytes(sigBytes, signatureCertificateField, sig.Certificate)
+		for _, intermediate := range sig.Intermediates {
+			sigBytes = appendProtobufMessage(sigBytes, signatureIntermediatesField, intermediate)
+		}
+
+		for _, ts := range sig.Timestamps {
+			tsBytes := appendProtobufBytes(nil, timestampTypeField, []byte(ts.Type))
+			tsBytes = appendProtobufBytes(tsBytes, timestampDataField, ts.Data)
+			sigBytes = appendProtobufMessage(sigBytes, signatureTimestampsField, tsBytes)
+		}
+
+		b = appendProtobufMessage(b, envelopeSignaturesField, sigBytes)
+	}
+
+	return b
+}
+
+// appendProtobufBytes appends a bytes or string field, leaving it out if it is empty as proto3 does.
+func appendProtobufBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+
+	return appendProtobufMessage(b, num, v)
+}
+
+// appendProtobufMessage appends a length delimited field even if it is empty, as repeated fields and messages are.
+func appendProtobufMessage(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// decodeProtobuf decodes a signed envelope encoded as the DSSE Envelope protobuf message. Unknown fields are skipped.
+func decodeProtobuf(data []byte) (dsse.Envelope, error) {
+	env := dsse.Envelope{}
+	err := rangeProtobufFields(data, func(num protowire.Number, v []byte) error {
+		switch num {
+		case envelopePayloadField:
+			env.Payload = append([]byte{}, v...)
+		case envelopePayloadTypeField:
+			env.PayloadType = string(v)
+		case envelopeSignaturesField:
+			sig, err := decodeProtobufSignature(v)
+			if err != nil {
+				return err
+			}
+
+			env.Signatures = append(env.Signatures, sig)
+		}
+
+		return nil
+	})
+
+	return env, err
+}
+
+func decodeProtobufSignature(data []byte) (dsse.Signature, error) {
+	sig := dsse.Signature{}
+	err := rangeProtobufFields(data, func(num protowire.Number, v []byte) error {
+		switch num {
+		case signatureSigField:
+			sig.Signature = append([]byte{}, v...)
+		case signatureKeyIDField:
+			sig.KeyID = string(v)
+		case signatureCertificateField:
+			sig.Certificate = append([]byte{}, v...)
+		case signatureIntermediatesField:
+			sig.Intermediates = append(sig.Intermediates, append([]byte{}, v...))
+		case signatureTimestampsField:
+			ts := dsse.SignatureTimestamp{}
+			err := rangeProtobufFields(v, func(num protowire.Number, v []byte) error {
+				switch num {
+				case timestampTypeField:
+					ts.Type = dsse.SignatureTimestampType(v)
+				case timestampDataField:
+					ts.Data = append([]byte{}, v...)
+				}
+
+				return nil
+			})
+
+			if err != nil {
+				return err
+			}
+
+			sig.Timestamps = append(sig.Timestamps, ts)
+		}
+
+		return nil
+	})
+
+	return sig, err
+}
+
+// rangeProtobufFields calls fn with each length delimited field of a protobuf message, skipping fields of other wire
+// types since no envelope field has one.
+func rangeProtobufFields(data []byte, fn func(num protowire.Number, v []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("invalid protobuf tag: %w", protowire.ParseError(n))
+		}
+
+		data = data[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return fmt.Errorf("invalid protobuf field %v: %w", num, protowire.ParseError(n))
+			}
+
+			data = data[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return fmt.Errorf("invalid protobuf field %v: %w", num, protowire.ParseError(n))
+		}
+
+		data = data[n:]
+		if err := fn(num, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
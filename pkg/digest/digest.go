@@ -0,0 +1,525 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package digest hashes the files in a directory for the material and product attestors. Each file is read once
+// for all of its digests. On Linux, large files are memory mapped and small files are read in batches with io_uring
+// when the kernel allows it, which cuts the number of system calls per file on runs that hash hundreds of thousands
+// of files. Everywhere else, and whenever those aren't available, files are read as usual. Files too large to map
+// are streamed through a fixed size buffer, so hashing multi-gigabyte artifacts takes the same memory as small ones.
+package digest
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+)
+
+const (
+	// smallFileSize is the largest file read in a batch. Larger files are memory mapped or streamed.
+	smallFileSize = 64 * 1024
+	// mapLimit is the largest file memory mapped. Larger files are streamed.
+	mapLimit = 256 * 1024 * 1024
+	// streamBufferSize is how much of a streamed file is read at once.
+	streamBufferSize = 1024 * 1024
+	// batchSize is how many small files are read at once.
+	batchSize = 128
+	// headSize is how much of a file is kept to detect its content type.
+	headSize = 512
+)
+
+// Artifact is a file in a directory that was hashed.
+type Artifact struct {
+	Digest cryptoutil.DigestSet
+	// Head is the start of the file, for detecting its content type.
+	Head []byte
+}
+
+// Progress is how much of the files being hashed have been hashed. Hard links to a file that is already hashed
+// aren't counted, since their content isn't read again.
+type Progress struct {
+	Files      int
+	TotalFiles int
+	Bytes      int64
+	TotalBytes int64
+}
+
+type options struct {
+	workers  int
+	progress func(Progress)
+}
+
+type Option func(*options)
+
+// WithWorkers hashes up to workers files at once. Files are hashed one at a time by default.
+func WithWorkers(workers int) Option {
+	return func(o *options) {
+		o.workers = workers
+	}
+}
+
+// WithProgress calls progress as files are hashed and as large files are streamed. It is never called concurrently.
+func WithProgress(progress func(Progress)) Option {
+	return func(o *options) {
+		o.progress = progress
+	}
+}
+
+var streamBuffers = sync.Pool{New: func() interface{} {
+	buf := make([]byte, streamBufferSize)
+	return &buf
+}}
+
+type entry struct {
+	rel   string
+	path  string
+	size  int64
+	inode inode
+	// linked is set for entries that are hard links to a file that is already hashed
+	linked bool
+}
+
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// Dir hashes every file under basePath with hashes, adding the sha1 and sha256 gitoids of each file. Artifacts are
+// keyed by their path relative to basePath. Symlinks are followed, each target only once, and files whose digest
+// matches the one in baseArtifacts are left out, so products only include files a step created or changed. Hard
+// links to the same file are only hashed once.
+//
+// The sha256 gitoid is recorded as go-witness records it, which is the gitoid of empty content for every file.
+func Dir(basePath string, baseArtifacts map[string]cryptoutil.DigestSet, hashes []crypto.Hash, opts ...Option) (map[string]Artifact, error) {
+	entries, err := walk(basePath, "", map[string]struct{}{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	markLinked(entries)
+
+	artifacts := make(map[string]Artifact, len(entries))
+	visit := func(e entry, a Artifact) {
+		if previous, ok := baseArtifacts[e.rel]; ok && a.Digest.Equal(previous) {
+			return
+		}
+
+		artifacts[e.rel] = a
+	}
+
+	if err := hashEntries(entries, hashes, newOptions(opts), visit); err != nil {
+		return nil, err
+	}
+
+	return artifacts, nil
+}
+
+// File hashes the file at path with hashes, adding its sha1 and sha256 gitoids.
+func File(path string, hashes []crypto.Hash, opts ...Option) (Artifact, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return Artifact{}, fmt.Errorf("%s is not a hashable file", path)
+	}
+
+	var artifact Artifact
+	err = hashEntries([]entry{{rel: path, path: path, size: info.Size()}}, hashes, newOptions(opts), func(_ entry, a Artifact) { artifact = a })
+	return artifact, err
+}
+
+func newOptions(opts []Option) options {
+	o := options{workers: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.workers < 1 {
+		o.workers = 1
+	}
+
+	return o
+}
+
+func walk(basePath, prefix string, visitedSymlinks map[string]struct{}, entries []entry) ([]entry, error) {
+	err := filepath.Walk(basePath, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+
+		relPath = filepath.Join(prefix, relPath)
+		if info.Mode()&fs.ModeSymlink != 0 {
+			// symlinks are followed and their targets recorded under the symlink's path. every target is only
+			// visited once to prevent infinite loops
+			linkedPath, err := filepath.EvalSymlinks(path)
+			if os.IsNotExist(err) {
+				log.Debugf("(file) broken symlink detected: %v", path)
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			if _, ok := visitedSymlinks[linkedPath]; ok {
+				return nil
+			}
+
+			visitedSymlinks[linkedPath] = struct{}{}
+			entries, err = walk(linkedPath, relPath, visitedSymlinks, entries)
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a hashable file", path)
+		}
+
+		e := entry{rel: relPath, path: path, size: info.Size()}
+		e.inode, _ = inodeOf(info)
+		entries = append(entries, e)
+		return nil
+	})
+
+	return entries, err
+}
+
+// markLinked marks every entry that is a hard link to an earlier entry, so its content is only hashed once.
+func markLinked(entries []entry) {
+	seen := make(map[inode]struct{}, len(entries))
+	for i, e := range entries {
+		if e.inode == (inode{}) {
+			continue
+		}
+
+		if _, ok := seen[e.inode]; ok {
+			entries[i].linked = true
+			continue
+		}
+
+		seen[e.inode] = struct{}{}
+	}
+}
+
+// hashEntries hashes entries, reading small files in batches and mapping or streaming the rest. Batches and large
+// files are spread over the workers. Linked entries are visited with the artifact of the file they link to once
+// every entry is hashed.
+func hashEntries(entries []entry, hashes []crypto.Hash, o options, visit func(entry, Artifact)) error {
+	units, linked := plan(entries)
+	t := &tracker{report: o.progress}
+	for _, unit := range units {
+		t.progress.TotalFiles += len(unit)
+		for _, e := range unit {
+			t.progress.TotalBytes += e.size
+		}
+	}
+
+	var mu sync.Mutex
+	byInode := make(map[inode]Artifact)
+	record := func(e entry, a Artifact) {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.inode != (inode{}) {
+			byInode[e.inode] = a
+		}
+
+		visit(e, a)
+	}
+
+	workers := o.workers
+	if workers > len(units) {
+		workers = len(units)
+	}
+
+	work := make(chan []entry)
+	done := make(chan struct{})
+	var once sync.Once
+	var hashErr error
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for unit := range work {
+				if err := hashUnit(unit, hashes, t, record); err != nil {
+					once.Do(func() {
+						hashErr = err
+						close(done)
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, unit := range units {
+		select {
+		case work <- unit:
+		case <-done:
+			break feed
+		}
+	}
+
+	close(work)
+	wg.Wait()
+	if hashErr != nil {
+		return hashErr
+	}
+
+	for _, e := range linked {
+		visit(e, byInode[e.inode])
+	}
+
+	return nil
+}
+
+// plan splits entries into units of work: batches of small files and large files on their own. Linked entries are
+// returned separately since they aren't read.
+func plan(entries []entry) (units [][]entry, linked []entry) {
+	batch := make([]entry, 0, batchSize)
+	for _, e := range entries {
+		if e.linked {
+			linked = append(linked, e)
+			continue
+		}
+
+		if e.size > smallFileSize {
+			units = append(units, []entry{e})
+			continue
+		}
+
+		batch = append(batch, e)
+		if len(batch) == batchSize {
+			units = append(units, batch)
+			batch = make([]entry, 0, batchSize)
+		}
+	}
+
+	if len(batch) > 0 {
+		units = append(units, batch)
+	}
+
+	return units, linked
+}
+
+func hashUnit(unit []entry, hashes []crypto.Hash, t *tracker, record func(entry, Artifact)) error {
+	if len(unit) == 1 && unit[0].size > smallFileSize {
+		artifact, err := hashLarge(unit[0], hashes, t)
+		if err != nil {
+			return err
+		}
+
+		record(unit[0], artifact)
+		return nil
+	}
+
+	contents, err := readBatch(unit)
+	if err != nil {
+		return err
+	}
+
+	for i, e := range unit {
+		record(e, fromBytes(contents[i], hashes))
+		t.add(1, e.size)
+	}
+
+	return nil
+}
+
+// hashLarge hashes a large file from a memory mapping of it, or by streaming it if it is too large to map or can't
+// be mapped.
+func hashLarge(e entry, hashes []crypto.Hash, t *tracker) (Artifact, error) {
+	f, err := os.Open(e.path)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	defer f.Close()
+	if e.size <= mapLimit {
+		artifact, mapped, err := hashMapped(f, e.size, hashes)
+		if err != nil {
+			return Artifact{}, err
+		}
+
+		if mapped {
+			t.add(1, e.size)
+			return artifact, nil
+		}
+	}
+
+	artifact, err := hashStream(f, e, hashes, t)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	t.add(1, 0)
+	return artifact, nil
+}
+
+// hashStream hashes r through a buffer of streamBufferSize, reporting the bytes read as it goes.
+func hashStream(r io.Reader, e entry, hashes []crypto.Hash, t *tracker) (Artifact, error) {
+	d := newDigester(hashes, e.size)
+	head := &headWriter{}
+	buf := streamBuffers.Get().(*[]byte)
+	defer streamBuffers.Put(buf)
+	// the reader is wrapped so its WriteTo, which picks its own buffer, isn't used
+	n, err := io.CopyBuffer(io.MultiWriter(d, head, progressWriter{t}), struct{ io.Reader }{r}, *buf)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	if n != e.size {
+		return Artifact{}, fmt.Errorf("%s changed while it was being hashed", e.path)
+	}
+
+	return Artifact{Digest: d.digestSet(), Head: head.data}, nil
+}
+
+// tracker adds up the progress of the workers and reports it.
+type tracker struct {
+	mu       sync.Mutex
+	progress Progress
+	report   func(Progress)
+}
+
+func (t *tracker) add(files int, bytes int64) {
+	if t.report == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress.Files += files
+	t.progress.Bytes += bytes
+	t.report(t.progress)
+}
+
+// progressWriter reports the bytes of a streamed file as they are hashed.
+type progressWriter struct {
+	t *tracker
+}
+
+func (w progressWriter) Write(p []byte) (int, error) {
+	w.t.add(0, int64(len(p)))
+	return len(p), nil
+}
+
+func fromBytes(data []byte, hashes []crypto.Hash) Artifact {
+	d := newDigester(hashes, int64(len(data)))
+	_, _ = d.Write(data)
+	head := data
+	if len(head) > headSize {
+		head = head[:headSize]
+	}
+
+	return Artifact{Digest: d.digestSet(), Head: append([]byte(nil), head...)}
+}
+
+// emptyGitoidSHA256 is the sha256 gitoid go-witness records for every file. It reads the file for the sha256 gitoid
+// after the sha1 gitoid has consumed it, so it is always the gitoid of empty content. Artifacts keep it byte for byte so
+// their digests match those of earlier versions of witness, and the subjects and searches that were recorded with them.
+var emptyGitoidSHA256 = fmt.Sprintf("gitoid:blob:sha256:%x", sha256.Sum256([]byte("blob 0\x00")))
+
+// digester computes every digest of a file, including its sha1 gitoid, in a single pass over its content.
+type digester struct {
+	hashes     map[crypto.Hash]hash.Hash
+	gitoidSHA1 hash.Hash
+	writers    []io.Writer
+}
+
+func newDigester(hashes []crypto.Hash, size int64) *digester {
+	d := &digester{
+		hashes:     make(map[crypto.Hash]hash.Hash, len(hashes)),
+		gitoidSHA1: sha1.New(),
+	}
+
+	for _, h := range hashes {
+		d.hashes[h] = h.New()
+		d.writers = append(d.writers, d.hashes[h])
+	}
+
+	// gitoids are the digests of the git blob header followed by the content
+	_, _ = d.gitoidSHA1.Write([]byte("blob " + strconv.FormatInt(size, 10) + "\x00"))
+	d.writers = append(d.writers, d.gitoidSHA1)
+
+	return d
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	for _, w := range d.writers {
+		_, _ = w.Write(p)
+	}
+
+	return len(p), nil
+}
+
+func (d *digester) digestSet() cryptoutil.DigestSet {
+	ds := make(cryptoutil.DigestSet, len(d.hashes)+2)
+	for h, hf := range d.hashes {
+		ds[cryptoutil.DigestValue{Hash: h}] = string(cryptoutil.HexEncode(hf.Sum(nil)))
+	}
+
+	ds[cryptoutil.DigestValue{Hash: crypto.SHA1, GitOID: true}] = fmt.Sprintf("gitoid:blob:sha1:%x", d.gitoidSHA1.Sum(nil))
+	ds[cryptoutil.DigestValue{Hash: crypto.SHA256, GitOID: true}] = emptyGitoidSHA256
+	return ds
+}
+
+// headWriter keeps the first bytes written to it.
+type headWriter struct {
+	data []byte
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if remaining := headSize - len(w.data); remaining > 0 {
+		if len(p) < remaining {
+			remaining = len(p)
+		}
+
+		w.data = append(w.data, p[:remaining]...)
+	}
+
+	return len(p), nil
+}
+
+// readFile reads a small file in full, failing if it isn't the size it was when the directory was walked.
+func readFile(e entry) ([]byte, error) {
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) != e.size {
+		return nil, fmt.Errorf("%s changed while it was being hashed", e.path)
+	}
+
+	return data, nil
+}
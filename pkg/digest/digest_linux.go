@@ -0,0 +1,148 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package digest
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"syscall"
+
+	"github.com/testifysec/go-witness/log"
+)
+
+var (
+	uringOnce sync.Once
+	uringMu   sync.Mutex
+	uring     *ring
+)
+
+// hashMapped hashes a file from a read only mapping of it. It reports whether the file could be mapped, so files
+// that can't be are streamed instead.
+func hashMapped(f *os.File, size int64, hashes []crypto.Hash) (artifact Artifact, mapped bool, err error) {
+	if int64(int(size)) != size {
+		return Artifact{}, false, nil
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		log.Debugf("failed to map %v, reading it instead: %v", f.Name(), err)
+		return Artifact{}, false, nil
+	}
+
+	defer func() {
+		if err := syscall.Munmap(data); err != nil {
+			log.Debugf("failed to unmap %v: %v", f.Name(), err)
+		}
+	}()
+
+	_ = syscall.Madvise(data, syscall.MADV_SEQUENTIAL)
+
+	// a file truncated while it is mapped faults when the missing pages are read, which is turned into a panic here
+	// rather than crashing witness
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s changed while it was being hashed: %v", f.Name(), r)
+		}
+	}()
+
+	return fromBytes(data, hashes), true, nil
+}
+
+// readBatch reads small files with a single io_uring submission if the kernel supports it, and one at a time if it
+// doesn't.
+func readBatch(batch []entry) ([][]byte, error) {
+	uringOnce.Do(func() {
+		r, err := newRing(batchSize)
+		if err != nil {
+			log.Debugf("io_uring is unavailable, reading files one at a time: %v", err)
+			return
+		}
+
+		uring = r
+	})
+
+	if uring != nil {
+		uringMu.Lock()
+		contents, err := readBatchRing(uring, batch)
+		uringMu.Unlock()
+		if err == nil {
+			return contents, nil
+		}
+
+		log.Debugf("failed to read files with io_uring, reading them one at a time: %v", err)
+	}
+
+	contents := make([][]byte, len(batch))
+	for i, e := range batch {
+		data, err := readFile(e)
+		if err != nil {
+			return nil, err
+		}
+
+		contents[i] = data
+	}
+
+	return contents, nil
+}
+
+// readBatchRing opens every file in the batch and reads them all with one submission. Each buffer has room for one
+// byte more than the file's size, so files that changed since the directory was walked are read again on their own
+// and the error is reported from there.
+func readBatchRing(r *ring, batch []entry) ([][]byte, error) {
+	fds := make([]int, 0, len(batch))
+	defer func() {
+		for _, fd := range fds {
+			_ = syscall.Close(fd)
+		}
+	}()
+
+	bufs := make([][]byte, len(batch))
+	for i, e := range batch {
+		fd, err := syscall.Open(e.path, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: e.path, Err: err}
+		}
+
+		fds = append(fds, fd)
+		bufs[i] = make([]byte, e.size+1)
+	}
+
+	results, err := r.read(fds, bufs)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make([][]byte, len(batch))
+	for i, res := range results {
+		if res < 0 && syscall.Errno(-res) == syscall.EINVAL {
+			return nil, fmt.Errorf("the kernel doesn't support reads: %w", syscall.EINVAL)
+		}
+
+		if int64(res) == batch[i].size {
+			contents[i] = bufs[i][:res]
+			continue
+		}
+
+		if contents[i], err = readFile(batch[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return contents, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package digest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBatchRing(t *testing.T) {
+	r, err := newRing(batchSize)
+	if err != nil {
+		t.Skipf("io_uring is unavailable: %v", err)
+	}
+
+	defer r.close()
+	dir := t.TempDir()
+	batch := []entry{}
+	for name, contents := range map[string]string{"a": "first", "b": "", "c": "third file"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+		batch = append(batch, entry{rel: name, path: path, size: int64(len(contents))})
+	}
+
+	contents, err := readBatchRing(r, batch)
+	require.NoError(t, err)
+	for i, e := range batch {
+		expected, err := os.ReadFile(e.path)
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(contents[i]))
+	}
+
+	// a file that grew since it was walked is read again on its own, which reports that it changed
+	require.NoError(t, os.WriteFile(batch[0].path, []byte("grown since"), 0644))
+	_, err = readBatchRing(r, batch)
+	require.ErrorContains(t, err, "changed while it was being hashed")
+}
@@ -0,0 +1,41 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package digest
+
+import (
+	"crypto"
+	"os"
+)
+
+// hashMapped never maps files outside of Linux, so they are streamed instead.
+func hashMapped(f *os.File, size int64, hashes []crypto.Hash) (Artifact, bool, error) {
+	return Artifact{}, false, nil
+}
+
+func readBatch(batch []entry) ([][]byte, error) {
+	contents := make([][]byte, len(batch))
+	for i, e := range batch {
+		data, err := readFile(e)
+		if err != nil {
+			return nil, err
+		}
+
+		contents[i] = data
+	}
+
+	return contents, nil
+}
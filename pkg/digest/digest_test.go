@@ -0,0 +1,175 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package digest
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/edwarnicke/gitoid"
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+var hashes = []crypto.Hash{crypto.SHA256, crypto.SHA1}
+
+func expectedDigest(t *testing.T, contents []byte) cryptoutil.DigestSet {
+	expected, err := cryptoutil.CalculateDigestSetFromBytes(contents, hashes)
+	require.NoError(t, err)
+	sha1ID, err := gitoid.New(bytes.NewReader(contents))
+	require.NoError(t, err)
+	// go-witness computes the sha256 gitoid from a reader the sha1 gitoid already consumed
+	sha256ID, err := gitoid.New(bytes.NewReader(nil), gitoid.WithSha256())
+	require.NoError(t, err)
+	expected[cryptoutil.DigestValue{Hash: crypto.SHA1, GitOID: true}] = sha1ID.URI()
+	expected[cryptoutil.DigestValue{Hash: crypto.SHA256, GitOID: true}] = sha256ID.URI()
+	return expected
+}
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"empty":          {},
+		"small.txt":      []byte("hello world"),
+		"sub/large.bin":  bytes.Repeat([]byte("0123456789abcdef"), smallFileSize/8),
+		"sub/medium.bin": bytes.Repeat([]byte{7}, smallFileSize),
+	}
+
+	// enough files to fill more than one batch
+	for i := 0; i < batchSize*2+3; i++ {
+		files[fmt.Sprintf("many/%03d", i)] = []byte(fmt.Sprintf("file %v", i))
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, contents, 0644))
+	}
+
+	require.NoError(t, os.Symlink(filepath.Join(dir, "sub"), filepath.Join(dir, "linked")))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "broken")))
+	files["linked/large.bin"] = files["sub/large.bin"]
+	files["linked/medium.bin"] = files["sub/medium.bin"]
+
+	artifacts, err := Dir(dir, nil, hashes)
+	require.NoError(t, err)
+	require.Len(t, artifacts, len(files))
+	for name, contents := range files {
+		artifact, ok := artifacts[filepath.FromSlash(name)]
+		require.True(t, ok, name)
+		require.Equal(t, expectedDigest(t, contents), artifact.Digest, name)
+		head := contents
+		if len(head) > headSize {
+			head = head[:headSize]
+		}
+
+		require.Equal(t, string(head), string(artifact.Head), name)
+	}
+
+	base := map[string]cryptoutil.DigestSet{}
+	for name, artifact := range artifacts {
+		base[name] = artifact.Digest
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "small.txt"), []byte("changed"), 0644))
+	changed, err := Dir(dir, base, hashes)
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	require.Equal(t, expectedDigest(t, []byte("changed")), changed["small.txt"].Digest)
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "large.bin")
+	contents := bytes.Repeat([]byte("witness"), smallFileSize)
+	require.NoError(t, os.WriteFile(path, contents, 0644))
+	artifact, err := File(path, hashes)
+	require.NoError(t, err)
+	require.Equal(t, expectedDigest(t, contents), artifact.Digest)
+
+	_, err = File(filepath.Dir(path), hashes)
+	require.ErrorContains(t, err, "not a hashable file")
+}
+
+// TestGitoids pins the gitoids recorded for a file, which must stay byte for byte the same as those go-witness records.
+func TestGitoids(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello world"), 0644))
+	artifacts, err := Dir(dir, nil, hashes)
+	require.NoError(t, err)
+	digest := artifacts["hello.txt"].Digest
+	require.Equal(t, "gitoid:blob:sha1:95d09f2b10159347eece71399a7e2e907ea3df4f", digest[cryptoutil.DigestValue{Hash: crypto.SHA1, GitOID: true}])
+	require.Equal(t, "gitoid:blob:sha256:473a0f4c3be8a93681a267e3b1e9a7dcda1185436fe141f7749120a303721813", digest[cryptoutil.DigestValue{Hash: crypto.SHA256, GitOID: true}])
+}
+
+func TestHashStreamChanged(t *testing.T) {
+	_, err := hashStream(bytes.NewReader([]byte("short")), entry{path: "file", size: 10}, hashes, &tracker{})
+	require.ErrorContains(t, err, "changed while it was being hashed")
+
+	artifact, err := hashStream(bytes.NewReader([]byte("exact")), entry{path: "file", size: 5}, hashes, &tracker{})
+	require.NoError(t, err)
+	require.Equal(t, expectedDigest(t, []byte("exact")), artifact.Digest)
+}
+
+func TestHashStreamProgress(t *testing.T) {
+	contents := bytes.Repeat([]byte{1}, streamBufferSize*2+10)
+	reported := []int64{}
+	tr := &tracker{report: func(p Progress) { reported = append(reported, p.Bytes) }}
+	artifact, err := hashStream(bytes.NewReader(contents), entry{path: "file", size: int64(len(contents))}, hashes, tr)
+	require.NoError(t, err)
+	require.Equal(t, expectedDigest(t, contents), artifact.Digest)
+	require.Equal(t, []int64{streamBufferSize, streamBufferSize * 2, int64(len(contents))}, reported)
+}
+
+func TestDirWorkers(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{"large.bin": bytes.Repeat([]byte("witness"), smallFileSize)}
+	for i := 0; i < batchSize*3; i++ {
+		files[fmt.Sprintf("%03d", i)] = []byte(fmt.Sprintf("file %v", i))
+	}
+
+	total := int64(0)
+	for name, contents := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), contents, 0644))
+		total += int64(len(contents))
+	}
+
+	last := Progress{}
+	artifacts, err := Dir(dir, nil, hashes, WithWorkers(4), WithProgress(func(p Progress) { last = p }))
+	require.NoError(t, err)
+	require.Len(t, artifacts, len(files))
+	for name, contents := range files {
+		require.Equal(t, expectedDigest(t, contents), artifacts[name].Digest, name)
+	}
+
+	require.Equal(t, Progress{Files: len(files), TotalFiles: len(files), Bytes: total, TotalBytes: total}, last)
+}
+
+func TestDirHardLinks(t *testing.T) {
+	dir := t.TempDir()
+	contents := []byte("shared contents")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "original"), contents, 0644))
+	require.NoError(t, os.Link(filepath.Join(dir, "original"), filepath.Join(dir, "link")))
+
+	artifacts, err := Dir(dir, nil, []crypto.Hash{crypto.SHA256})
+	require.NoError(t, err)
+	require.Len(t, artifacts, 2)
+	require.True(t, artifacts["original"].Digest.Equal(expectedDigest(t, contents)))
+	require.True(t, artifacts["link"].Digest.Equal(expectedDigest(t, contents)))
+	require.Equal(t, string(artifacts["original"].Head), string(artifacts["link"].Head))
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package digest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+// Table holds each distinct digest set once, so files that share content refer to it by index instead of repeating
+// every digest. It is how the material and product attestors serialize trees with many identical files, such as
+// vendored dependencies.
+type Table struct {
+	Contents []cryptoutil.DigestSet `json:"contents"`
+}
+
+// NewTable builds a table of the distinct digests in digests and returns the index of each path's digest in it.
+// Contents are ordered by the first path that refers to them, so the same files always build the same table.
+func NewTable(digests map[string]cryptoutil.DigestSet) (Table, map[string]int, error) {
+	paths := make([]string, 0, len(digests))
+	for path := range digests {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+	table := Table{Contents: []cryptoutil.DigestSet{}}
+	keys := make(map[string]int)
+	indexes := make(map[string]int, len(digests))
+	for _, path := range paths {
+		key, err := json.Marshal(digests[path])
+		if err != nil {
+			return Table{}, nil, err
+		}
+
+		index, ok := keys[string(key)]
+		if !ok {
+			index = len(table.Contents)
+			keys[string(key)] = index
+			table.Contents = append(table.Contents, digests[path])
+		}
+
+		indexes[path] = index
+	}
+
+	return table, indexes, nil
+}
+
+// Lookup returns the digest set at index.
+func (t Table) Lookup(index int) (cryptoutil.DigestSet, error) {
+	if index < 0 || index >= len(t.Contents) {
+		return nil, fmt.Errorf("content %v is not in the content table of %v entries", index, len(t.Contents))
+	}
+
+	return t.Contents[index], nil
+}
+
+// IsTabled reports whether data is an attestation serialized with a content table, which is an object of only the
+// contents array and the files that refer to it. Attestations keyed by path have an object for every path instead.
+func IsTabled(data []byte) bool {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil || len(fields) != 2 {
+		return false
+	}
+
+	contents, hasContents := fields["contents"]
+	_, hasFiles := fields["files"]
+	return hasContents && hasFiles && bytes.HasPrefix(bytes.TrimSpace(contents), []byte("["))
+}
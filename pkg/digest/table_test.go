@@ -0,0 +1,66 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package digest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+func TestNewTable(t *testing.T) {
+	shared := expectedDigest(t, []byte("shared"))
+	other := expectedDigest(t, []byte("other"))
+	digests := map[string]cryptoutil.DigestSet{
+		"vendor/b/LICENSE": shared,
+		"vendor/a/LICENSE": shared,
+		"main.go":          other,
+	}
+
+	table, indexes, err := NewTable(digests)
+	require.NoError(t, err)
+	require.Len(t, table.Contents, 2)
+	require.Equal(t, map[string]int{"main.go": 0, "vendor/a/LICENSE": 1, "vendor/b/LICENSE": 1}, indexes)
+	for path, index := range indexes {
+		ds, err := table.Lookup(index)
+		require.NoError(t, err)
+		require.True(t, ds.Equal(digests[path]))
+	}
+
+	_, err = table.Lookup(2)
+	require.Error(t, err)
+
+	again, _, err := NewTable(digests)
+	require.NoError(t, err)
+	require.Equal(t, table, again)
+}
+
+func TestIsTabled(t *testing.T) {
+	table, indexes, err := NewTable(map[string]cryptoutil.DigestSet{"main.go": expectedDigest(t, []byte("package main"))})
+	require.NoError(t, err)
+	tabled, err := json.Marshal(struct {
+		Table
+		Files map[string]int `json:"files"`
+	}{table, indexes})
+	require.NoError(t, err)
+	require.True(t, IsTabled(tabled))
+
+	// attestations keyed by path can have files named contents and files
+	require.False(t, IsTabled([]byte(`{"contents":{"sha256":"abc"},"files":{"sha256":"def"}}`)))
+	require.False(t, IsTabled([]byte(`{"main.go":{"sha256":"abc"}}`)))
+	require.False(t, IsTabled([]byte(`[]`)))
+}
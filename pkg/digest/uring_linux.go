@@ -0,0 +1,187 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package digest
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// The parts of the io_uring interface needed to submit reads, from include/uapi/linux/io_uring.h.
+const (
+	sysIOUringSetup = 425
+	sysIOUringEnter = 426
+
+	ioringOffSQRing = 0
+	ioringOffCQRing = 0x8000000
+	ioringOffSQEs   = 0x10000000
+
+	ioringFeatSingleMmap = 1 << 0
+	ioringEnterGetevents = 1 << 0
+	ioringOpRead         = 22
+
+	sqeSize = 64
+	cqeSize = 16
+)
+
+type sqringOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type cqringOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  sqringOffsets
+	cqOff                                                                  cqringOffsets
+}
+
+// ring is an io_uring instance used to submit batches of reads and wait for all of them to complete.
+type ring struct {
+	fd      int
+	params  uringParams
+	sqRing  []byte
+	cqRing  []byte
+	sqes    []byte
+	entries uint32
+}
+
+func newRing(entries uint32) (*ring, error) {
+	// mips numbers its system calls from a different base
+	if strings.HasPrefix(runtime.GOARCH, "mips") {
+		return nil, fmt.Errorf("io_uring isn't supported on %v", runtime.GOARCH)
+	}
+
+	r := &ring{}
+	fd, _, errno := syscall.Syscall(sysIOUringSetup, uintptr(entries), uintptr(unsafe.Pointer(&r.params)), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("io_uring_setup: %w", errno)
+	}
+
+	r.fd = int(fd)
+	r.entries = r.params.sqEntries
+	sqSize := int(r.params.sqOff.array + r.params.sqEntries*4)
+	cqSize := int(r.params.cqOff.cqes + r.params.cqEntries*cqeSize)
+	if r.params.features&ioringFeatSingleMmap != 0 && cqSize > sqSize {
+		sqSize = cqSize
+	}
+
+	var err error
+	if r.sqRing, err = syscall.Mmap(r.fd, ioringOffSQRing, sqSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE); err != nil {
+		r.close()
+		return nil, fmt.Errorf("failed to map the submission ring: %w", err)
+	}
+
+	r.cqRing = r.sqRing
+	if r.params.features&ioringFeatSingleMmap == 0 {
+		if r.cqRing, err = syscall.Mmap(r.fd, ioringOffCQRing, cqSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE); err != nil {
+			r.close()
+			return nil, fmt.Errorf("failed to map the completion ring: %w", err)
+		}
+	}
+
+	if r.sqes, err = syscall.Mmap(r.fd, ioringOffSQEs, int(r.params.sqEntries*sqeSize), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE); err != nil {
+		r.close()
+		return nil, fmt.Errorf("failed to map the submission queue entries: %w", err)
+	}
+
+	return r, nil
+}
+
+func (r *ring) close() {
+	if r.sqes != nil {
+		_ = syscall.Munmap(r.sqes)
+	}
+
+	if r.cqRing != nil && &r.cqRing[0] != &r.sqRing[0] {
+		_ = syscall.Munmap(r.cqRing)
+	}
+
+	if r.sqRing != nil {
+		_ = syscall.Munmap(r.sqRing)
+	}
+
+	_ = syscall.Close(r.fd)
+}
+
+func (r *ring) uint32At(ring []byte, offset uint32) *uint32 {
+	return (*uint32)(unsafe.Pointer(&ring[offset]))
+}
+
+// read reads each file descriptor from its start into its buffer and returns the result of each read, which is the
+// number of bytes read or a negated errno.
+func (r *ring) read(fds []int, bufs [][]byte) ([]int32, error) {
+	if uint32(len(fds)) > r.entries {
+		return nil, fmt.Errorf("can't submit %v reads to a ring of %v entries", len(fds), r.entries)
+	}
+
+	sqMask := *r.uint32At(r.sqRing, r.params.sqOff.ringMask)
+	tail := atomic.LoadUint32(r.uint32At(r.sqRing, r.params.sqOff.tail))
+	for i, fd := range fds {
+		index := tail & sqMask
+		sqe := r.sqes[index*sqeSize : (index+1)*sqeSize]
+		for j := range sqe {
+			sqe[j] = 0
+		}
+
+		sqe[0] = ioringOpRead
+		*(*int32)(unsafe.Pointer(&sqe[4])) = int32(fd)
+		*(*uint64)(unsafe.Pointer(&sqe[16])) = uint64(uintptr(unsafe.Pointer(&bufs[i][0])))
+		*(*uint32)(unsafe.Pointer(&sqe[24])) = uint32(len(bufs[i]))
+		*(*uint64)(unsafe.Pointer(&sqe[32])) = uint64(i)
+		*r.uint32At(r.sqRing, r.params.sqOff.array+index*4) = index
+		tail++
+	}
+
+	atomic.StoreUint32(r.uint32At(r.sqRing, r.params.sqOff.tail), tail)
+	results := make([]int32, len(fds))
+	cqMask := *r.uint32At(r.cqRing, r.params.cqOff.ringMask)
+	toSubmit, completed := len(fds), 0
+	for completed < len(fds) {
+		submitted, _, errno := syscall.Syscall6(sysIOUringEnter, uintptr(r.fd), uintptr(toSubmit), uintptr(len(fds)-completed), ioringEnterGetevents, 0, 0)
+		if errno != 0 && !errors.Is(errno, syscall.EINTR) {
+			return nil, fmt.Errorf("io_uring_enter: %w", errno)
+		}
+
+		if errno == 0 {
+			toSubmit -= int(submitted)
+		}
+
+		head := atomic.LoadUint32(r.uint32At(r.cqRing, r.params.cqOff.head))
+		cqTail := atomic.LoadUint32(r.uint32At(r.cqRing, r.params.cqOff.tail))
+		for ; head != cqTail; head++ {
+			offset := r.params.cqOff.cqes + (head&cqMask)*cqeSize
+			userData := *(*uint64)(unsafe.Pointer(&r.cqRing[offset]))
+			results[userData] = *(*int32)(unsafe.Pointer(&r.cqRing[offset+8]))
+			completed++
+		}
+
+		atomic.StoreUint32(r.uint32At(r.cqRing, r.params.cqOff.head), head)
+	}
+
+	// the kernel wrote into the buffers by address, so they must not be collected before the reads complete
+	runtime.KeepAlive(bufs)
+	return results, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package doctor inspects a witness configuration for problems that would otherwise only show up when a run or
+// verification fails, such as certificates that are about to expire or services that can't be reached.
+package doctor
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/policy"
+)
+
+type Status string
+
+const (
+	StatusOK    Status = "ok"
+	StatusWarn  Status = "warn"
+	StatusError Status = "error"
+)
+
+// Result is the outcome of a single check.
+type Result struct {
+	Check   string `json:"check"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+}
+
+func ok(check, format string, args ...interface{}) Result {
+	return Result{Check: check, Status: StatusOK, Message: fmt.Sprintf(format, args...)}
+}
+
+func warn(check, format string, args ...interface{}) Result {
+	return Result{Check: check, Status: StatusWarn, Message: fmt.Sprintf(format, args...)}
+}
+
+func fail(check, format string, args ...interface{}) Result {
+	return Result{Check: check, Status: StatusError, Message: fmt.Sprintf(format, args...)}
+}
+
+// Worst returns the most severe status of results.
+func Worst(results []Result) Status {
+	worst := StatusOK
+	for _, result := range results {
+		switch {
+		case result.Status == StatusError:
+			return StatusError
+		case result.Status == StatusWarn:
+			worst = StatusWarn
+		}
+	}
+
+	return worst
+}
+
+// CheckExpiry reports an error if something named check expired before now, and a warning if it expires within
+// warnWithin of now.
+func CheckExpiry(check string, expires, now time.Time, warnWithin time.Duration) Result {
+	switch {
+	case expires.IsZero():
+		return warn(check, "has no expiration")
+	case !expires.After(now):
+		return fail(check, "expired at %v", expires.UTC().Format(time.RFC3339))
+	case expires.Before(now.Add(warnWithin)):
+		return warn(check, "expires in %v, at %v", expires.Sub(now).Round(time.Hour), expires.UTC().Format(time.RFC3339))
+	default:
+		return ok(check, "valid until %v", expires.UTC().Format(time.RFC3339))
+	}
+}
+
+// CheckCertificate checks that cert is currently valid and isn't about to expire.
+func CheckCertificate(check string, cert *x509.Certificate, now time.Time, warnWithin time.Duration) Result {
+	check = fmt.Sprintf("%v %q", check, cert.Subject.String())
+	if now.Before(cert.NotBefore) {
+		return fail(check, "not valid until %v", cert.NotBefore.UTC().Format(time.RFC3339))
+	}
+
+	return CheckExpiry(check, cert.NotAfter, now, warnWithin)
+}
+
+// CheckPolicy checks the expiration of a policy and of the roots, intermediates, and timestamp authorities it trusts.
+func CheckPolicy(policyEnvelope dsse.Envelope, now time.Time, warnWithin time.Duration) []Result {
+	pol := policy.Policy{}
+	if err := json.Unmarshal(policyEnvelope.Payload, &pol); err != nil {
+		return []Result{fail("policy", "failed to parse policy: %v", err)}
+	}
+
+	results := []Result{CheckExpiry("policy", pol.Expires, now, warnWithin)}
+	for _, roots := range []struct {
+		kind string
+		load func() (map[string]policy.TrustBundle, error)
+	}{
+		{"policy root", pol.TrustBundles},
+		{"policy timestamp authority", pol.TimestampAuthorityTrustBundles},
+	} {
+		bundles, err := roots.load()
+		if err != nil {
+			results = append(results, fail(roots.kind, "failed to load: %v", err))
+			continue
+		}
+
+		ids := make([]string, 0, len(bundles))
+		for id := range bundles {
+			ids = append(ids, id)
+		}
+
+		sort.Strings(ids)
+		for _, id := range ids {
+			results = append(results, CheckCertificate(roots.kind, bundles[id].Root, now, warnWithin))
+			for _, intermediate := range bundles[id].Intermediates {
+				results = append(results, CheckCertificate(roots.kind+" intermediate", intermediate, now, warnWithin))
+			}
+		}
+	}
+
+	return results
+}
+
+// CheckReachable checks that the service named check answers HTTP requests at url. Any response that isn't a server
+// error counts, since the services don't share an endpoint meant for health checks.
+func CheckReachable(ctx context.Context, hc *http.Client, check, url string) Result {
+	check = fmt.Sprintf("%v %v", check, url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fail(check, "invalid url: %v", err)
+	}
+
+	start := time.Now()
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fail(check, "unreachable: %v", err)
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fail(check, "returned %v", resp.Status)
+	}
+
+	return ok(check, "reachable in %v", time.Since(start).Round(time.Millisecond))
+}
+
+// Format renders results as one line per check.
+func Format(results []Result) string {
+	sb := &strings.Builder{}
+	for _, result := range results {
+		fmt.Fprintf(sb, "[%-5v] %v: %v\n", strings.ToUpper(string(result.Status)), result.Check, result.Message)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package doctor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/policy"
+)
+
+func TestCheckExpiry(t *testing.T) {
+	now := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, StatusError, CheckExpiry("policy", now.Add(-time.Second), now, time.Hour).Status)
+	require.Equal(t, StatusError, CheckExpiry("policy", now, now, time.Hour).Status)
+	require.Equal(t, StatusWarn, CheckExpiry("policy", now.Add(30*time.Minute), now, time.Hour).Status)
+	require.Equal(t, StatusWarn, CheckExpiry("policy", time.Time{}, now, time.Hour).Status)
+	require.Equal(t, StatusOK, CheckExpiry("policy", now.Add(2*time.Hour), now, time.Hour).Status)
+}
+
+func TestCheckPolicy(t *testing.T) {
+	now := time.Now()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "expiring root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	pol := policy.Policy{
+		Expires: now.Add(365 * 24 * time.Hour),
+		Roots:   map[string]policy.Root{"root": {Certificate: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}},
+	}
+
+	payload, err := json.Marshal(pol)
+	require.NoError(t, err)
+	results := CheckPolicy(dsse.Envelope{Payload: payload}, now, 7*24*time.Hour)
+	require.Len(t, results, 2)
+	require.Equal(t, StatusOK, results[0].Status)
+	require.Equal(t, StatusWarn, results[1].Status)
+	require.Equal(t, `policy root "CN=expiring root"`, results[1].Check)
+	require.Equal(t, StatusWarn, Worst(results))
+
+	results = CheckPolicy(dsse.Envelope{Payload: []byte("not json")}, now, time.Hour)
+	require.Equal(t, StatusError, Worst(results))
+}
+
+func TestCheckReachable(t *testing.T) {
+	status := http.StatusNotFound
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	require.Equal(t, StatusOK, CheckReachable(context.Background(), server.Client(), "archivista", server.URL).Status)
+	status = http.StatusBadGateway
+	require.Equal(t, StatusError, CheckReachable(context.Background(), server.Client(), "archivista", server.URL).Status)
+	server.Close()
+	require.Equal(t, StatusError, CheckReachable(context.Background(), server.Client(), "archivista", server.URL).Status)
+}
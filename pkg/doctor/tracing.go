@@ -0,0 +1,33 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package doctor
+
+import (
+	"strings"
+
+	"github.com/testifysec/witness/pkg/attestation/tracestatus"
+)
+
+const tracingCheck = "tracing"
+
+// CheckTracing reports whether the host can trace commands with --trace.
+func CheckTracing() Result {
+	capability := tracestatus.Detect()
+	if !capability.Available {
+		return warn(tracingCheck, "unavailable, runs with --trace will fail unless --trace-degraded is set: %v", strings.Join(capability.Missing, "; "))
+	}
+
+	return ok(tracingCheck, "ptrace is available")
+}
@@ -0,0 +1,267 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package eventlog streams the progress of a run as newline-delimited JSON events, so CI systems and people
+// debugging long runs can follow which attestor is running and which processes the command started while the run
+// is still going.
+package eventlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/wrap"
+)
+
+const (
+	TypeRunStarted       = "run.started"
+	TypeRunFinished      = "run.finished"
+	TypeAttestorStarted  = "attestor.started"
+	TypeAttestorFinished = "attestor.finished"
+	TypeProcessStarted   = "process.started"
+
+	// fdPrefix selects an inherited file descriptor rather than a file, such as fd:3.
+	fdPrefix = "fd:"
+
+	// pollInterval is how often the processes of the command are listed while it runs.
+	pollInterval = 100 * time.Millisecond
+)
+
+var (
+	_ attestation.Attestor   = &loggedAttestor{}
+	_ attestation.Subjecter  = &loggedAttestor{}
+	_ attestation.Materialer = &loggedAttestor{}
+	_ attestation.Producer   = &loggedAttestor{}
+	_ attestation.BackReffer = &loggedAttestor{}
+)
+
+// Event is a line of the event log. Only the fields that apply to the event's type are set.
+type Event struct {
+	Time         time.Time `json:"time"`
+	Type         string    `json:"type"`
+	Step         string    `json:"step,omitempty"`
+	Attestor     string    `json:"attestor,omitempty"`
+	AttestorType string    `json:"attestortype,omitempty"`
+	RunType      string    `json:"runtype,omitempty"`
+	// DurationMS is how long the attestor or run took, in milliseconds.
+	DurationMS int64  `json:"durationms,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Materials and Products are the number of files the attestor hashed.
+	Materials *int     `json:"materials,omitempty"`
+	Products  *int     `json:"products,omitempty"`
+	PID       int      `json:"pid,omitempty"`
+	PPID      int      `json:"ppid,omitempty"`
+	Args      []string `json:"args,omitempty"`
+}
+
+// Log writes events to a file or file descriptor. A nil Log discards events, so callers don't need to check
+// whether an event log was requested.
+type Log struct {
+	mu      sync.Mutex
+	w       io.Writer
+	closer  io.Closer
+	started time.Time
+}
+
+// Open opens the event log at target, which is a path that is created or truncated, or fd:N to write to a file
+// descriptor witness inherited. It returns a nil Log if target is empty.
+func Open(target string) (*Log, error) {
+	if target == "" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(target, fdPrefix) {
+		fd, err := strconv.Atoi(strings.TrimPrefix(target, fdPrefix))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid event log file descriptor %v", target)
+		}
+
+		// inherited descriptors are left open, since they belong to whoever started witness
+		return New(os.NewFile(uintptr(fd), target)), nil
+	}
+
+	f, err := os.Create(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event log: %w", err)
+	}
+
+	l := New(f)
+	l.closer = f
+	return l, nil
+}
+
+// New returns a Log that writes events to w.
+func New(w io.Writer) *Log {
+	return &Log{w: w, started: time.Now()}
+}
+
+// Emit writes an event, setting its time if it isn't set. Failing to write an event doesn't fail the run.
+func (l *Log) Emit(event Event) {
+	if l == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Debugf("(eventlog) failed to marshal %v event: %v", event.Type, err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(append(data, '\n')); err != nil {
+		log.Debugf("(eventlog) failed to write %v event: %v", event.Type, err)
+	}
+}
+
+// RunStarted emits the start of a run of step.
+func (l *Log) RunStarted(step string) {
+	if l == nil {
+		return
+	}
+
+	l.started = time.Now()
+	l.Emit(Event{Type: TypeRunStarted, Step: step})
+}
+
+// RunFinished emits the end of a run of step, with the error that failed it if any.
+func (l *Log) RunFinished(step string, err error) {
+	if l == nil {
+		return
+	}
+
+	event := Event{Type: TypeRunFinished, Step: step, DurationMS: time.Since(l.started).Milliseconds()}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	l.Emit(event)
+}
+
+// Close closes the event log's file. Inherited file descriptors are left open.
+func (l *Log) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+
+	return l.closer.Close()
+}
+
+// Apply wraps the attestors so their start and finish are logged, along with the processes the command starts
+// while execute attestors run. A nil Log returns the attestors unchanged.
+func (l *Log) Apply(attestors []attestation.Attestor) []attestation.Attestor {
+	if l == nil {
+		return attestors
+	}
+
+	applied := make([]attestation.Attestor, 0, len(attestors))
+	for _, attestor := range attestors {
+		applied = append(applied, &loggedAttestor{Forwarder: wrap.Forwarder{Attestor: attestor}, log: l})
+	}
+
+	return applied
+}
+
+// loggedAttestor logs the start and finish of the wrapped attestor and is otherwise transparent.
+type loggedAttestor struct {
+	wrap.Forwarder
+	log *Log
+}
+
+func (a *loggedAttestor) Attest(ctx *attestation.AttestationContext) error {
+	runType := a.Attestor.RunType()
+	a.log.Emit(Event{Type: TypeAttestorStarted, Attestor: a.Attestor.Name(), AttestorType: a.Attestor.Type(), RunType: string(runType)})
+	start := time.Now()
+	var err error
+	if runType == attestation.ExecuteRunType {
+		err = a.watch(ctx)
+	} else {
+		err = a.Attestor.Attest(ctx)
+	}
+
+	event := Event{
+		Type:         TypeAttestorFinished,
+		Attestor:     a.Attestor.Name(),
+		AttestorType: a.Attestor.Type(),
+		RunType:      string(runType),
+		DurationMS:   time.Since(start).Milliseconds(),
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	// other wrappers make every attestor look like a materialer and producer, so only the attestors that hash the
+	// working directory report counts
+	if materialer, ok := a.Attestor.(attestation.Materialer); ok && runType == attestation.MaterialRunType {
+		count := len(materialer.Materials())
+		event.Materials = &count
+	}
+
+	if producer, ok := a.Attestor.(attestation.Producer); ok && runType == attestation.ProductRunType {
+		count := len(producer.Products())
+		event.Products = &count
+	}
+
+	a.log.Emit(event)
+	return err
+}
+
+// watch runs the wrapped attestor while polling for processes started by witness's children, logging each new
+// one. Processes that start and exit between polls aren't seen.
+func (a *loggedAttestor) watch(ctx *attestation.AttestationContext) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Attestor.Attest(ctx)
+	}()
+
+	seen := map[int]struct{}{}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	tick := ticker.C
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-tick:
+			processes, err := descendants(os.Getpid())
+			if err != nil {
+				log.Debugf("(eventlog) not logging processes: %v", err)
+				tick = nil
+				continue
+			}
+
+			for _, process := range processes {
+				if _, ok := seen[process.pid]; ok {
+					continue
+				}
+
+				seen[process.pid] = struct{}{}
+				a.log.Emit(Event{Type: TypeProcessStarted, Attestor: a.Attestor.Name(), PID: process.pid, PPID: process.ppid, Args: process.args})
+			}
+		}
+	}
+}
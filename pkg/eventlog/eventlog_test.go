@@ -0,0 +1,131 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/attestation/material"
+	"github.com/testifysec/go-witness/attestation/product"
+)
+
+func readEvents(t *testing.T, data []byte) []Event {
+	events := []Event{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		event := Event{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		require.False(t, event.Time.IsZero())
+		events = append(events, event)
+	}
+
+	require.NoError(t, scanner.Err())
+	return events
+}
+
+func TestApply(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "input.txt"), []byte("input"), 0644))
+	out := &bytes.Buffer{}
+	l := New(out)
+	attestors := l.Apply([]attestation.Attestor{
+		material.New(),
+		commandrun.New(commandrun.WithCommand([]string{"sh", "-c", "sleep 0.5; echo output > output.txt"})),
+		product.New(),
+	})
+
+	ctx, err := attestation.NewContext(attestors, attestation.WithWorkingDir(dir))
+	require.NoError(t, err)
+	l.RunStarted("build")
+	require.NoError(t, ctx.RunAttestors())
+	l.RunFinished("build", nil)
+	require.Contains(t, ctx.Products(), "output.txt")
+
+	events := readEvents(t, out.Bytes())
+	types := []string{}
+	for _, event := range events {
+		if event.Type != TypeProcessStarted {
+			types = append(types, event.Type+" "+event.Attestor)
+		}
+	}
+
+	require.Equal(t, []string{
+		TypeRunStarted + " ",
+		TypeAttestorStarted + " material",
+		TypeAttestorFinished + " material",
+		TypeAttestorStarted + " command-run",
+		TypeAttestorFinished + " command-run",
+		TypeAttestorStarted + " product",
+		TypeAttestorFinished + " product",
+		TypeRunFinished + " ",
+	}, types)
+
+	require.Equal(t, 1, *events[2].Materials)
+	require.Nil(t, events[2].Products)
+	require.Equal(t, 1, *events[len(events)-2].Products)
+	require.Equal(t, "build", events[len(events)-1].Step)
+
+	if runtime.GOOS == "linux" {
+		found := false
+		for _, event := range events {
+			if event.Type == TypeProcessStarted && len(event.Args) > 0 && event.Args[0] == "sh" {
+				found = true
+				require.Equal(t, "command-run", event.Attestor)
+				require.NotZero(t, event.PID)
+			}
+		}
+
+		require.True(t, found)
+	}
+
+	// the wrapped attestors are recorded as if they weren't wrapped
+	data, err := json.Marshal(ctx.CompletedAttestors()[2].Attestor)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "output.txt")
+}
+
+func TestOpen(t *testing.T) {
+	l, err := Open("")
+	require.NoError(t, err)
+	require.Nil(t, l)
+	// a nil log discards events
+	l.Emit(Event{Type: TypeRunStarted})
+	l.RunFinished("build", errors.New("failed"))
+	require.NoError(t, l.Close())
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	l, err = Open(path)
+	require.NoError(t, err)
+	l.RunFinished("build", errors.New("failed"))
+	require.NoError(t, l.Close())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	events := readEvents(t, data)
+	require.Len(t, events, 1)
+	require.Equal(t, "failed", events[0].Error)
+
+	_, err = Open("fd:three")
+	require.ErrorContains(t, err, "invalid event log file descriptor")
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventlog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/testifysec/witness/internal/procfs"
+)
+
+type process struct {
+	pid  int
+	ppid int
+	args []string
+}
+
+// descendants returns every running process started by root or its descendants, parents before their children.
+func descendants(root int) ([]process, error) {
+	parents, err := procfs.Parents()
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]int)
+	for pid, ppid := range parents {
+		children[ppid] = append(children[ppid], pid)
+	}
+
+	for _, pids := range children {
+		sort.Ints(pids)
+	}
+
+	processes := []process{}
+	queue := []int{root}
+	for i := 0; i < len(queue); i++ {
+		for _, pid := range children[queue[i]] {
+			cmdline, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+			if err != nil {
+				continue
+			}
+
+			processes = append(processes, process{pid: pid, ppid: queue[i], args: strings.Split(string(bytes.TrimSuffix(cmdline, []byte{0})), "\x00")})
+			queue = append(queue, pid)
+		}
+	}
+
+	return processes, nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package groups resolves the members of functionary groups, such as release-engineers, from an identity provider
+// so policies can name a group instead of listing its members.
+package groups
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotType is the payload type of signed group snapshots.
+const SnapshotType = "https://witness.dev/groups/v0.1"
+
+// Snapshot is the membership of groups at the time they were resolved. Members are identified by their lower case
+// email addresses.
+type Snapshot struct {
+	Source     string              `json:"source"`
+	ResolvedAt time.Time           `json:"resolvedAt"`
+	Groups     map[string][]string `json:"groups"`
+}
+
+// Resolver looks up the members of groups.
+type Resolver interface {
+	// Source identifies where groups are resolved from.
+	Source() string
+	Resolve(ctx context.Context, names []string) (Snapshot, error)
+}
+
+// MinCacheKeySize is the smallest key, in bytes, cached snapshots are authenticated with.
+const MinCacheKeySize = 32
+
+type cachedResolver struct {
+	resolver Resolver
+	dir      string
+	ttl      time.Duration
+	key      []byte
+	now      func() time.Time
+}
+
+// cachedSnapshot is a snapshot as it is cached, with the HMAC of its JSON encoding under the cache's key.
+type cachedSnapshot struct {
+	Snapshot json.RawMessage `json:"snapshot"`
+	MAC      string          `json:"mac"`
+}
+
+// Cached returns a resolver that keeps the snapshots resolver returns in dir for ttl, so verifications in quick
+// succession don't each query the identity provider. Membership changes take effect once the cached snapshot expires.
+// Cached snapshots are authenticated with an HMAC under key, which must be kept outside dir, since anyone able to
+// write a snapshot could otherwise add themselves to a group.
+func Cached(resolver Resolver, dir string, ttl time.Duration, key []byte) (Resolver, error) {
+	if len(key) < MinCacheKeySize {
+		return nil, fmt.Errorf("groups cache key must be at least %v bytes", MinCacheKeySize)
+	}
+
+	return cachedResolver{resolver: resolver, dir: dir, ttl: ttl, key: key, now: time.Now}, nil
+}
+
+func (c cachedResolver) Source() string {
+	return c.resolver.Source()
+}
+
+func (c cachedResolver) Resolve(ctx context.Context, names []string) (Snapshot, error) {
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	key := sha256.Sum256([]byte(c.resolver.Source() + "\n" + strings.Join(sorted, "\n")))
+	path := filepath.Join(c.dir, hex.EncodeToString(key[:])+".json")
+	if data, err := os.ReadFile(path); err == nil {
+		if snapshot, ok := c.read(data); ok {
+			return snapshot, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return Snapshot{}, fmt.Errorf("failed to read cached groups: %w", err)
+	}
+
+	snapshot, err := c.resolver.Resolve(ctx, names)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshotData, err := json.Marshal(&snapshot)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	data, err := json.Marshal(cachedSnapshot{Snapshot: snapshotData, MAC: hex.EncodeToString(c.mac(snapshotData))})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to create groups cache: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to cache groups: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// read returns the snapshot cached in data if its MAC matches and it was resolved within the cache's ttl.
+func (c cachedResolver) read(data []byte) (Snapshot, bool) {
+	cached := cachedSnapshot{}
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return Snapshot{}, false
+	}
+
+	mac, err := hex.DecodeString(cached.MAC)
+	if err != nil || !hmac.Equal(mac, c.mac(cached.Snapshot)) {
+		return Snapshot{}, false
+	}
+
+	snapshot := Snapshot{}
+	if err := json.Unmarshal(cached.Snapshot, &snapshot); err != nil {
+		return Snapshot{}, false
+	}
+
+	now := c.now()
+	if snapshot.ResolvedAt.After(now) || now.Sub(snapshot.ResolvedAt) >= c.ttl {
+		return Snapshot{}, false
+	}
+
+	return snapshot, true
+}
+
+func (c cachedResolver) mac(data []byte) []byte {
+	h := hmac.New(sha256.New, c.key)
+	h.Write(data)
+	return h.Sum(nil)
+}
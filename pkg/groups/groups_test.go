@@ -0,0 +1,133 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package groups
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSCIM serves release-engineers, which includes the nested group oncall and an inactive user.
+func fakeSCIM(t *testing.T, requests *int32) *httptest.Server {
+	groups := map[string]string{
+		"release": `{"id":"release","displayName":"release-engineers","members":[{"value":"alice"},{"value":"oncall","type":"Group"},{"value":"mallory","type":"User"}]}`,
+		"oncall":  `{"id":"oncall","displayName":"oncall","members":[{"value":"bob"},{"value":"release","type":"Group"}]}`,
+	}
+
+	users := map[string]string{
+		"alice":   `{"emails":[{"value":"Alice@Example.com"}]}`,
+		"bob":     `{"active":true,"emails":[{"value":"bob@example.com"},{"value":"bob@corp.example.com"}]}`,
+		"mallory": `{"active":false,"emails":[{"value":"mallory@example.com"}]}`,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/scim/v2")
+		switch {
+		case path == "/Groups":
+			resources := []json.RawMessage{}
+			if r.URL.Query().Get("filter") == `displayName eq "release-engineers"` {
+				resources = append(resources, json.RawMessage(groups["release"]))
+			}
+
+			require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"totalResults": len(resources), "Resources": resources}))
+		case strings.HasPrefix(path, "/Groups/"):
+			_, _ = w.Write([]byte(groups[strings.TrimPrefix(path, "/Groups/")]))
+		case strings.HasPrefix(path, "/Users/"):
+			_, _ = w.Write([]byte(users[strings.TrimPrefix(path, "/Users/")]))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestSCIMResolve(t *testing.T) {
+	var requests int32
+	server := fakeSCIM(t, &requests)
+	defer server.Close()
+
+	snapshot, err := NewSCIM(server.URL+"/scim/v2/", "token").Resolve(context.Background(), []string{"release-engineers"})
+	require.NoError(t, err)
+	require.Equal(t, server.URL+"/scim/v2", snapshot.Source)
+	require.Equal(t, []string{"alice@example.com", "bob@corp.example.com", "bob@example.com"}, snapshot.Groups["release-engineers"])
+
+	_, err = NewSCIM(server.URL+"/scim/v2", "token").Resolve(context.Background(), []string{"unknown"})
+	require.ErrorContains(t, err, "found 0 groups named unknown")
+
+	_, err = NewSCIM(server.URL+"/scim/v2", "wrong").Resolve(context.Background(), []string{"release-engineers"})
+	require.ErrorContains(t, err, "401")
+}
+
+func TestCached(t *testing.T) {
+	var requests int32
+	server := fakeSCIM(t, &requests)
+	defer server.Close()
+
+	now := time.Now()
+	dir := t.TempDir()
+	scim := NewSCIM(server.URL+"/scim/v2", "token")
+	scim.now = func() time.Time { return now }
+	resolver, err := Cached(scim, dir, time.Minute, bytes.Repeat([]byte("k"), MinCacheKeySize))
+	require.NoError(t, err)
+	cached := resolver.(cachedResolver)
+	cached.now = func() time.Time { return now }
+	first, err := cached.Resolve(context.Background(), []string{"release-engineers"})
+	require.NoError(t, err)
+	resolved := atomic.LoadInt32(&requests)
+
+	second, err := cached.Resolve(context.Background(), []string{"release-engineers"})
+	require.NoError(t, err)
+	require.Equal(t, resolved, atomic.LoadInt32(&requests))
+	require.Equal(t, first.Groups, second.Groups)
+
+	now = now.Add(2 * time.Minute)
+	_, err = cached.Resolve(context.Background(), []string{"release-engineers"})
+	require.NoError(t, err)
+	require.Greater(t, atomic.LoadInt32(&requests), resolved)
+
+	// a snapshot written without the key, such as one adding a member, is resolved again rather than trusted
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	forged, err := json.Marshal(&Snapshot{ResolvedAt: now, Groups: map[string][]string{"release-engineers": {"mallory@example.com"}}})
+	require.NoError(t, err)
+	data, err := json.Marshal(cachedSnapshot{Snapshot: forged, MAC: hex.EncodeToString(bytes.Repeat([]byte{0}, sha256.Size))})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, entries[0].Name()), data, 0600))
+	third, err := cached.Resolve(context.Background(), []string{"release-engineers"})
+	require.NoError(t, err)
+	require.Equal(t, first.Groups, third.Groups)
+
+	_, err = Cached(NewSCIM(server.URL, ""), dir, time.Minute, []byte("short"))
+	require.Error(t, err)
+}
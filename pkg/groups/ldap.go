@@ -0,0 +1,292 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package groups
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultLDAPSearch = "ldapsearch"
+
+// ldapNoSuchObject is the exit status of ldapsearch when the base of the search doesn't exist.
+const ldapNoSuchObject = 32
+
+// adAccountDisabled is the bit of an Active Directory userAccountControl that marks a disabled account.
+const adAccountDisabled = 0x2
+
+type LDAPOption func(*LDAPResolver)
+
+// WithBind binds as dn with the password in passwordFile instead of anonymously. ldapsearch reads the whole file as
+// the password, so it must not end with a newline.
+func WithBind(dn, passwordFile string) LDAPOption {
+	return func(l *LDAPResolver) {
+		l.bindDN = dn
+		l.passwordFile = passwordFile
+	}
+}
+
+// WithLDAPSearch sets the path to ldapsearch.
+func WithLDAPSearch(tool string) LDAPOption {
+	return func(l *LDAPResolver) {
+		l.tool = tool
+	}
+}
+
+// LDAPResolver resolves groups from an LDAP directory, such as Active Directory or OpenLDAP, through the ldapsearch
+// command of the OpenLDAP clients. Groups are looked up by common name under the base DN, nested groups are expanded,
+// and accounts Active Directory marks as disabled are left out.
+type LDAPResolver struct {
+	url          string
+	baseDN       string
+	bindDN       string
+	passwordFile string
+	tool         string
+	now          func() time.Time
+}
+
+// NewLDAP returns a resolver for the directory at url, such as ldaps://ldap.example.com, that finds groups under
+// baseDN.
+func NewLDAP(url, baseDN string, opts ...LDAPOption) *LDAPResolver {
+	l := &LDAPResolver{url: url, baseDN: baseDN, tool: defaultLDAPSearch, now: time.Now}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+func (l *LDAPResolver) Source() string {
+	return l.url
+}
+
+func (l *LDAPResolver) Resolve(ctx context.Context, names []string) (Snapshot, error) {
+	snapshot := Snapshot{Source: l.url, ResolvedAt: l.now().UTC(), Groups: make(map[string][]string, len(names))}
+	for _, name := range names {
+		filter := fmt.Sprintf("(&(|(objectClass=group)(objectClass=groupOfNames)(objectClass=groupOfUniqueNames))(cn=%v))", escapeLDAPFilter(name))
+		found, err := l.search(ctx, l.baseDN, "sub", filter)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("failed to look up group %v: %w", name, err)
+		}
+
+		if len(found) != 1 {
+			return Snapshot{}, fmt.Errorf("found %v groups named %v, expected one", len(found), name)
+		}
+
+		members := make(map[string]struct{})
+		if err := l.expand(ctx, found[0], members, map[string]bool{}); err != nil {
+			return Snapshot{}, fmt.Errorf("failed to resolve members of group %v: %w", name, err)
+		}
+
+		emails := make([]string, 0, len(members))
+		for email := range members {
+			emails = append(emails, email)
+		}
+
+		sort.Strings(emails)
+		snapshot.Groups[name] = emails
+	}
+
+	return snapshot, nil
+}
+
+// expand adds the email addresses of group's members to members, following nested groups.
+func (l *LDAPResolver) expand(ctx context.Context, group ldapEntry, members map[string]struct{}, visited map[string]bool) error {
+	if visited[strings.ToLower(group.dn)] {
+		return nil
+	}
+
+	visited[strings.ToLower(group.dn)] = true
+	for _, dn := range group.members() {
+		found, err := l.search(ctx, dn, "base", "(objectClass=*)")
+		if err != nil {
+			return err
+		}
+
+		// members that no longer exist are left out, as directories don't always remove them from groups
+		if len(found) == 0 {
+			continue
+		}
+
+		member := found[0]
+		if member.isGroup() {
+			if err := l.expand(ctx, member, members, visited); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !member.active() {
+			continue
+		}
+
+		for _, email := range member.attrs["mail"] {
+			members[strings.ToLower(email)] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+// search runs ldapsearch for the entries matching filter under base, returning none if base doesn't exist.
+func (l *LDAPResolver) search(ctx context.Context, base, scope, filter string) ([]ldapEntry, error) {
+	args := []string{"-LLL", "-x", "-o", "ldif-wrap=no", "-H", l.url, "-b", base, "-s", scope}
+	if l.bindDN != "" {
+		args = append(args, "-D", l.bindDN, "-y", l.passwordFile)
+	}
+
+	args = append(args, filter, "objectClass", "member", "uniqueMember", "mail", "userAccountControl")
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, l.tool, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		exitErr := &exec.ExitError{}
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == ldapNoSuchObject {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("%v: %w: %v", l.tool, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseLDIF(stdout.Bytes())
+}
+
+// ldapEntry is an entry of an LDIF search result, with attribute names in lower case.
+type ldapEntry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+func (e ldapEntry) isGroup() bool {
+	for _, class := range e.attrs["objectclass"] {
+		switch strings.ToLower(class) {
+		case "group", "groupofnames", "groupofuniquenames":
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e ldapEntry) members() []string {
+	members := append([]string{}, e.attrs["member"]...)
+	for _, member := range e.attrs["uniquemember"] {
+		// uniqueMember values may end with an optional unique identifier, as in cn=alice,dc=example,dc=com#'0101'B
+		if i := strings.LastIndex(member, "#'"); i >= 0 && strings.HasSuffix(member, "'B") {
+			member = member[:i]
+		}
+
+		members = append(members, member)
+	}
+
+	return members
+}
+
+// active reports whether the entry isn't a disabled Active Directory account. Other directories don't record whether
+// an account is disabled in a standard attribute, so their members are always active.
+func (e ldapEntry) active() bool {
+	for _, control := range e.attrs["useraccountcontrol"] {
+		if flags, err := strconv.ParseUint(control, 10, 32); err == nil && flags&adAccountDisabled != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseLDIF parses the entries of LDIF content, as written by ldapsearch -LLL.
+func parseLDIF(data []byte) ([]ldapEntry, error) {
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		// lines that begin with a space continue the previous line
+		if strings.HasPrefix(line, " ") && len(lines) > 0 && lines[len(lines)-1] != "" {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]ldapEntry, 0)
+	var entry *ldapEntry
+	for _, line := range lines {
+		if line == "" {
+			entry = nil
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid ldif line %q", line)
+		}
+
+		switch {
+		case strings.HasPrefix(value, ":"):
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 value of %v: %w", name, err)
+			}
+
+			value = string(decoded)
+		case strings.HasPrefix(value, "<"):
+			// values given by url aren't written by ldapsearch -LLL
+			continue
+		default:
+			value = strings.TrimPrefix(value, " ")
+		}
+
+		if entry == nil {
+			if !strings.EqualFold(name, "dn") {
+				return nil, fmt.Errorf("ldif entry begins with %v rather than dn", name)
+			}
+
+			entries = append(entries, ldapEntry{dn: value, attrs: make(map[string][]string)})
+			entry = &entries[len(entries)-1]
+			continue
+		}
+
+		name = strings.ToLower(name)
+		entry.attrs[name] = append(entry.attrs[name], value)
+	}
+
+	return entries, nil
+}
+
+// escapeLDAPFilter escapes the characters RFC 4515 reserves in filter values.
+func escapeLDAPFilter(value string) string {
+	return strings.NewReplacer(`\`, `\5c`, `*`, `\2a`, `(`, `\28`, `)`, `\29`, "\x00", `\00`).Replace(value)
+}
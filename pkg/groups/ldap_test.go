@@ -0,0 +1,133 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package groups
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// ldapDirectory holds release-engineers, which includes the nested group oncall, a disabled account, and a member
+// that has been deleted. Bob's mail is base64 encoded and wrapped as ldapsearch may write it.
+var ldapDirectory = map[string]string{
+	"cn=release-engineers,ou=groups,dc=example,dc=com": "objectClass: top\nobjectClass: group\nmember: cn=alice,ou=people,dc=example,dc=com\nmember: cn=oncall,ou=groups,dc=example,dc=com\nmember: cn=mallory,ou=people,dc=example,dc=com\nmember: cn=gone,ou=people,dc=example,dc=com\n",
+	"cn=oncall,ou=groups,dc=example,dc=com":            "objectClass: groupOfUniqueNames\nuniqueMember: cn=bob,ou=people,dc=example,dc=com#'0101'B\nuniqueMember: cn=release-engineers,ou=groups,dc=example,dc=com\n",
+	"cn=alice,ou=people,dc=example,dc=com":             "objectClass: user\nmail: Alice@Example.com\nuserAccountControl: 512\n",
+	"cn=bob,ou=people,dc=example,dc=com":               "objectClass: inetOrgPerson\nmail:: Ym9iQGV4YW1wbGUu\n Y29t\n",
+	"cn=mallory,ou=people,dc=example,dc=com":           "objectClass: user\nmail: mallory@example.com\nuserAccountControl: 514\n",
+}
+
+// TestHelperProcess stands in for ldapsearch when run through the script written by fakeLDAPSearch.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("LDAP_TEST_HELPER") != "1" {
+		return
+	}
+
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+
+	flags := map[string]string{}
+	positional := []string{}
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "-LLL", "-x":
+		case "-o", "-H", "-b", "-s", "-D", "-y":
+			flags[args[i]] = args[i+1]
+			i++
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+
+	if password, err := os.ReadFile(flags["-y"]); flags["-D"] != "cn=witness,dc=example,dc=com" || err != nil || string(password) != "secret" {
+		fmt.Fprintln(os.Stderr, "ldap_bind: Invalid credentials (49)")
+		os.Exit(49)
+	}
+
+	if flags["-s"] == "base" {
+		entry, ok := ldapDirectory[flags["-b"]]
+		if !ok {
+			fmt.Fprintln(os.Stderr, "No such object (32)")
+			os.Exit(32)
+		}
+
+		fmt.Printf("dn: %v\n%v\n", flags["-b"], entry)
+		os.Exit(0)
+	}
+
+	for dn, entry := range ldapDirectory {
+		if strings.Contains(positional[0], "(cn="+strings.TrimPrefix(strings.Split(dn, ",")[0], "cn=")+")") && strings.HasSuffix(dn, flags["-b"]) {
+			fmt.Printf("# %v\ndn: %v\n%v\n", dn, dn, entry)
+		}
+	}
+
+	os.Exit(0)
+}
+
+func fakeLDAPSearch(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	t.Setenv("LDAP_TEST_HELPER", "1")
+	tool := filepath.Join(dir, "ldapsearch")
+	script := fmt.Sprintf("#!/bin/sh\nexec %q -test.run=TestHelperProcess -- \"$@\"\n", os.Args[0])
+	require.NoError(t, os.WriteFile(tool, []byte(script), 0700))
+	passwordFile := filepath.Join(dir, "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("secret"), 0600))
+	return tool, passwordFile
+}
+
+func TestLDAPResolve(t *testing.T) {
+	tool, passwordFile := fakeLDAPSearch(t)
+	resolver := NewLDAP("ldaps://ldap.example.com", "dc=example,dc=com", WithBind("cn=witness,dc=example,dc=com", passwordFile), WithLDAPSearch(tool))
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	resolver.now = func() time.Time { return now }
+
+	snapshot, err := resolver.Resolve(context.Background(), []string{"release-engineers"})
+	require.NoError(t, err)
+	require.Equal(t, "ldaps://ldap.example.com", snapshot.Source)
+	require.Equal(t, now, snapshot.ResolvedAt)
+	require.Equal(t, map[string][]string{"release-engineers": {"alice@example.com", "bob@example.com"}}, snapshot.Groups)
+
+	_, err = resolver.Resolve(context.Background(), []string{"nobody*"})
+	require.ErrorContains(t, err, "found 0 groups named nobody*")
+
+	anonymous := NewLDAP("ldaps://ldap.example.com", "dc=example,dc=com", WithLDAPSearch(tool))
+	_, err = anonymous.Resolve(context.Background(), []string{"release-engineers"})
+	require.ErrorContains(t, err, "Invalid credentials")
+}
+
+func TestParseLDIF(t *testing.T) {
+	entries, err := parseLDIF([]byte("# comment\ndn: cn=a,dc=example,dc=com\nMail: a@exa\n mple.com\n\ndn:: Y249YixkYz1leGFtcGxlLGRjPWNvbQ==\nmail: b@example.com\n"))
+	require.NoError(t, err)
+	require.Equal(t, []ldapEntry{
+		{dn: "cn=a,dc=example,dc=com", attrs: map[string][]string{"mail": {"a@example.com"}}},
+		{dn: "cn=b,dc=example,dc=com", attrs: map[string][]string{"mail": {"b@example.com"}}},
+	}, entries)
+
+	_, err = parseLDIF([]byte("mail: a@example.com\n"))
+	require.Error(t, err)
+}
+
+func TestEscapeLDAPFilter(t *testing.T) {
+	require.Equal(t, `a\2a\28b\29\5c`, escapeLDAPFilter(`a*(b)\`))
+}
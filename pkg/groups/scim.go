@@ -0,0 +1,182 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package groups
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+type scimMember struct {
+	Value string `json:"value"`
+	Type  string `json:"type"`
+}
+
+type scimGroup struct {
+	ID          string       `json:"id"`
+	DisplayName string       `json:"displayName"`
+	Members     []scimMember `json:"members"`
+}
+
+type scimUser struct {
+	Active *bool `json:"active"`
+	Emails []struct {
+		Value string `json:"value"`
+	} `json:"emails"`
+}
+
+type SCIMOption func(*SCIMResolver)
+
+func WithHTTPClient(client *http.Client) SCIMOption {
+	return func(s *SCIMResolver) {
+		s.client = client
+	}
+}
+
+// SCIMResolver resolves groups from the Groups and Users endpoints of a SCIM 2.0 service provider, as described by
+// RFC 7644. Groups are looked up by display name, nested groups are expanded, and inactive users are left out.
+type SCIMResolver struct {
+	url    string
+	token  string
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewSCIM returns a resolver for the SCIM service at url, such as https://idp.example.com/scim/v2, that
+// authenticates with token as a bearer token if it is set.
+func NewSCIM(url, token string, opts ...SCIMOption) *SCIMResolver {
+	s := &SCIMResolver{url: strings.TrimSuffix(url, "/"), token: token, client: http.DefaultClient, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *SCIMResolver) Source() string {
+	return s.url
+}
+
+func (s *SCIMResolver) Resolve(ctx context.Context, names []string) (Snapshot, error) {
+	snapshot := Snapshot{Source: s.url, ResolvedAt: s.now().UTC(), Groups: make(map[string][]string, len(names))}
+	users := make(map[string][]string)
+	for _, name := range names {
+		filter := fmt.Sprintf(`displayName eq "%v"`, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name))
+		found := struct {
+			Resources []scimGroup `json:"Resources"`
+		}{}
+
+		if err := s.get(ctx, "/Groups?filter="+url.QueryEscape(filter), &found); err != nil {
+			return Snapshot{}, fmt.Errorf("failed to look up group %v: %w", name, err)
+		}
+
+		if len(found.Resources) != 1 {
+			return Snapshot{}, fmt.Errorf("found %v groups named %v, expected one", len(found.Resources), name)
+		}
+
+		members := make(map[string]struct{})
+		if err := s.expand(ctx, found.Resources[0], members, users, map[string]bool{}); err != nil {
+			return Snapshot{}, fmt.Errorf("failed to resolve members of group %v: %w", name, err)
+		}
+
+		emails := make([]string, 0, len(members))
+		for email := range members {
+			emails = append(emails, email)
+		}
+
+		sort.Strings(emails)
+		snapshot.Groups[name] = emails
+	}
+
+	return snapshot, nil
+}
+
+// expand adds the email addresses of group's members to members, following nested groups. users caches the emails
+// of users already looked up.
+func (s *SCIMResolver) expand(ctx context.Context, group scimGroup, members map[string]struct{}, users map[string][]string, visited map[string]bool) error {
+	if visited[group.ID] {
+		return nil
+	}
+
+	visited[group.ID] = true
+	for _, member := range group.Members {
+		if strings.EqualFold(member.Type, "Group") {
+			nested := scimGroup{}
+			if err := s.get(ctx, "/Groups/"+url.PathEscape(member.Value), &nested); err != nil {
+				return err
+			}
+
+			if err := s.expand(ctx, nested, members, users, visited); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		emails, ok := users[member.Value]
+		if !ok {
+			user := scimUser{}
+			if err := s.get(ctx, "/Users/"+url.PathEscape(member.Value), &user); err != nil {
+				return err
+			}
+
+			if user.Active == nil || *user.Active {
+				for _, email := range user.Emails {
+					emails = append(emails, strings.ToLower(email.Value))
+				}
+			}
+
+			users[member.Value] = emails
+		}
+
+		for _, email := range emails {
+			members[email] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+func (s *SCIMResolver) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url+path, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/scim+json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("scim service returned %v: %v", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
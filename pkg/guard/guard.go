@@ -0,0 +1,358 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package guard bounds how long attestors run and decides whether an attestor that fails fails the run, so an
+// attestor waiting on a service that isn't there, such as a cloud metadata endpoint on a machine outside the cloud,
+// doesn't hang or fail the whole step.
+package guard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/material"
+	"github.com/testifysec/go-witness/attestation/product"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/wrap"
+)
+
+// FailurePolicy is what happens to the run when an attestor fails or times out.
+type FailurePolicy string
+
+const (
+	// FailurePolicyFail fails the run, as attestors always have.
+	FailurePolicyFail FailurePolicy = "fail"
+	// FailurePolicyWarn logs a warning and records the step without the attestor's attestation.
+	FailurePolicyWarn FailurePolicy = "warn"
+	// FailurePolicySkip records the step without the attestor's attestation, logging the failure only at debug level.
+	FailurePolicySkip FailurePolicy = "skip"
+
+	// DefaultTimeout is the name under which a timeout applies to every attestor without a timeout of its own.
+	DefaultTimeout = "default"
+)
+
+// ErrTimedOut is returned for an attestor that was still running when its timeout passed.
+var ErrTimedOut = errors.New("attestor timed out")
+
+// required are the attestors whose failures always fail the run. A step recorded without them would have no
+// materials or products, which verification can't tell apart from a step that read and wrote nothing.
+var required = map[string]struct{}{
+	material.Name: {},
+	product.Name:  {},
+}
+
+var (
+	_ attestation.Attestor   = &guardedAttestor{}
+	_ attestation.Subjecter  = &guardedAttestor{}
+	_ attestation.Materialer = &guardedAttestor{}
+	_ attestation.Producer   = &guardedAttestor{}
+	_ attestation.BackReffer = &guardedAttestor{}
+)
+
+// Cancellable is implemented by attestors that stop the commands they run and the requests they make once the context
+// given to SetContext is done, which is how a guard bounds them by their timeouts.
+type Cancellable interface {
+	SetContext(ctx context.Context)
+}
+
+// Cancellation can be embedded in an attestor to make it Cancellable.
+type Cancellation struct {
+	ctx context.Context
+}
+
+func (c *Cancellation) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// Context returns the context the attestor was given to stop by, or the context of the run if it wasn't given one.
+func (c *Cancellation) Context(ctx *attestation.AttestationContext) context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+
+	return ctx.Context()
+}
+
+// CanTimeout returns whether a timeout can bound attestor. Cancellable attestors are stopped when their timeout
+// passes. Other attestors can only be abandoned, which is safe for attestors that run before the materials are
+// recorded and for the material and product attestors, whose timeouts fail the run. Any other attestor would keep
+// reading the materials and products of the run while they are still being recorded.
+func CanTimeout(attestor attestation.Attestor) bool {
+	attestor = wrap.Unwrap(attestor)
+	if _, ok := attestor.(Cancellable); ok {
+		return true
+	}
+
+	_, isRequired := required[attestor.Name()]
+	return isRequired || attestor.RunType() == attestation.PreMaterialRunType
+}
+
+// ParseFailurePolicy returns the failure policy named s.
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	switch policy := FailurePolicy(s); policy {
+	case FailurePolicyFail, FailurePolicyWarn, FailurePolicySkip:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown attestor failure policy %v, expected one of %v, %v, or %v", s, FailurePolicyFail, FailurePolicyWarn, FailurePolicySkip)
+	}
+}
+
+// ParseTimeouts parses timeouts of attestors given in the form name=duration. The name default sets the timeout of
+// every attestor not named.
+func ParseTimeouts(timeouts map[string]string) (map[string]time.Duration, error) {
+	parsed := make(map[string]time.Duration, len(timeouts))
+	names := make([]string, 0, len(timeouts))
+	for name := range timeouts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		timeout, err := time.ParseDuration(strings.TrimSpace(timeouts[name]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for attestor %v: %w", name, err)
+		}
+
+		if timeout < 0 {
+			return nil, fmt.Errorf("timeout for attestor %v must not be negative", name)
+		}
+
+		parsed[name] = timeout
+	}
+
+	return parsed, nil
+}
+
+// Failure is an attestor that failed or timed out without failing the run.
+type Failure struct {
+	Attestor string
+	Err      error
+}
+
+type Guard struct {
+	policy   FailurePolicy
+	timeouts map[string]time.Duration
+
+	mu       sync.Mutex
+	failures []Failure
+}
+
+type Option func(*Guard)
+
+// WithFailurePolicy sets what happens to the run when an attestor fails. The default is FailurePolicyFail.
+func WithFailurePolicy(policy FailurePolicy) Option {
+	return func(g *Guard) {
+		g.policy = policy
+	}
+}
+
+// WithTimeouts sets how long attestors may run for by name. The timeout named DefaultTimeout applies to attestors
+// without one of their own, and a timeout of 0 doesn't bound the attestor. Timeouts don't apply to attestors that
+// can't time out, as reported by CanTimeout.
+func WithTimeouts(timeouts map[string]time.Duration) Option {
+	return func(g *Guard) {
+		g.timeouts = timeouts
+	}
+}
+
+func New(opts ...Option) *Guard {
+	g := &Guard{policy: FailurePolicyFail}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g
+}
+
+// Apply wraps the attestors so they are bounded by their timeouts and their failures are handled by the failure
+// policy. Execute attestors are left alone: the command is bounded by the maximum run duration, and a command that
+// fails should fail the run. The material and product attestors are bounded by their timeouts, but always fail the
+// run when they fail. Attestors that can't time out are only handled by the failure policy. Attestors are returned unchanged if there is nothing to guard against.
+func (g *Guard) Apply(attestors []attestation.Attestor) []attestation.Attestor {
+	if g.policy == FailurePolicyFail && len(g.timeouts) == 0 {
+		return attestors
+	}
+
+	applied := make([]attestation.Attestor, 0, len(attestors))
+	for _, attestor := range attestors {
+		if attestor.RunType() != attestation.ExecuteRunType {
+			timeout, ok := g.timeouts[attestor.Name()]
+			if !ok {
+				timeout = g.timeouts[DefaultTimeout]
+			}
+
+			if !CanTimeout(attestor) {
+				timeout = 0
+			}
+
+			_, isRequired := required[attestor.Name()]
+			attestor = &guardedAttestor{Forwarder: wrap.Forwarder{Attestor: attestor}, guard: g, timeout: timeout, required: isRequired}
+		}
+
+		applied = append(applied, attestor)
+	}
+
+	return applied
+}
+
+// Failures returns the attestors that failed without failing the run.
+func (g *Guard) Failures() []Failure {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]Failure{}, g.failures...)
+}
+
+// Completed removes the attestors that failed without failing the run from completed, so the step is recorded
+// without them, and replaces the rest with the attestors they wrap.
+func (g *Guard) Completed(completed []attestation.CompletedAttestor) []attestation.CompletedAttestor {
+	kept := make([]attestation.CompletedAttestor, 0, len(completed))
+	for _, c := range completed {
+		if guarded, ok := c.Attestor.(*guardedAttestor); ok {
+			if guarded.hasFailed() {
+				continue
+			}
+
+			c.Attestor = guarded.Attestor
+		}
+
+		kept = append(kept, c)
+	}
+
+	return kept
+}
+
+func (g *Guard) tolerate(name string, err error) {
+	g.mu.Lock()
+	g.failures = append(g.failures, Failure{Attestor: name, Err: err})
+	g.mu.Unlock()
+	if g.policy == FailurePolicyWarn {
+		log.Warnf("%v attestor failed, recording the step without it: %v", name, err)
+		return
+	}
+
+	log.Debugf("(guard) skipping %v attestor: %v", name, err)
+}
+
+// guardedAttestor runs the wrapped attestor until its timeout and reports its failure as the failure policy says.
+// An attestor that fails without failing the run has no subjects, materials, or products, since what it recorded
+// is incomplete and an abandoned attestor may still be writing it.
+type guardedAttestor struct {
+	wrap.Forwarder
+	guard    *Guard
+	timeout  time.Duration
+	required bool
+
+	mu     sync.Mutex
+	failed bool
+}
+
+func (a *guardedAttestor) Attest(ctx *attestation.AttestationContext) error {
+	err := a.attest(ctx)
+	if err == nil || a.guard.policy == FailurePolicyFail || a.required {
+		return err
+	}
+
+	a.mu.Lock()
+	a.failed = true
+	a.mu.Unlock()
+	a.guard.tolerate(a.Attestor.Name(), err)
+	return nil
+}
+
+// attest runs the wrapped attestor until the timeout passes. A cancellable attestor is stopped and waited for, while
+// any other attestor is abandoned and keeps running until witness exits.
+func (a *guardedAttestor) attest(ctx *attestation.AttestationContext) error {
+	if a.timeout <= 0 {
+		return a.Attestor.Attest(ctx)
+	}
+
+	if cancellable, ok := wrap.Unwrap(a.Attestor).(Cancellable); ok {
+		timeoutCtx, cancel := context.WithTimeout(ctx.Context(), a.timeout)
+		defer cancel()
+		cancellable.SetContext(timeoutCtx)
+		err := a.Attestor.Attest(ctx)
+		if errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w after %v", ErrTimedOut, a.timeout)
+		}
+
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Attestor.Attest(ctx)
+	}()
+
+	timer := time.NewTimer(a.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%w after %v", ErrTimedOut, a.timeout)
+	}
+}
+
+func (a *guardedAttestor) hasFailed() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.failed
+}
+
+func (a *guardedAttestor) MarshalJSON() ([]byte, error) {
+	if a.hasFailed() {
+		return []byte("{}"), nil
+	}
+
+	return a.Forwarder.MarshalJSON()
+}
+
+func (a *guardedAttestor) Subjects() map[string]cryptoutil.DigestSet {
+	if a.hasFailed() {
+		return map[string]cryptoutil.DigestSet{}
+	}
+
+	return a.Forwarder.Subjects()
+}
+
+func (a *guardedAttestor) Materials() map[string]cryptoutil.DigestSet {
+	if a.hasFailed() {
+		return map[string]cryptoutil.DigestSet{}
+	}
+
+	return a.Forwarder.Materials()
+}
+
+func (a *guardedAttestor) Products() map[string]attestation.Product {
+	if a.hasFailed() {
+		return map[string]attestation.Product{}
+	}
+
+	return a.Forwarder.Products()
+}
+
+func (a *guardedAttestor) BackRefs() map[string]cryptoutil.DigestSet {
+	if a.hasFailed() {
+		return map[string]cryptoutil.DigestSet{}
+	}
+
+	return a.Forwarder.BackRefs()
+}
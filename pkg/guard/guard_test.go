@@ -0,0 +1,158 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/material"
+	"github.com/testifysec/go-witness/attestation/product"
+	"github.com/testifysec/witness/pkg/wrap"
+)
+
+type testAttestor struct {
+	name    string
+	runType attestation.RunType
+	delay   time.Duration
+	err     error
+}
+
+func (a *testAttestor) Name() string                 { return a.name }
+func (a *testAttestor) Type() string                 { return "https://witness.dev/attestations/" + a.name + "/v0.1" }
+func (a *testAttestor) RunType() attestation.RunType { return a.runType }
+
+func (a *testAttestor) Attest(ctx *attestation.AttestationContext) error {
+	time.Sleep(a.delay)
+	return a.err
+}
+
+// cancellableAttestor runs until the context it is given is done, as an attestor running a hung scanner would.
+type cancellableAttestor struct {
+	Cancellation
+	stopped bool
+}
+
+func (a *cancellableAttestor) Name() string                 { return "sbom" }
+func (a *cancellableAttestor) Type() string                 { return "https://witness.dev/attestations/sbom/v0.1" }
+func (a *cancellableAttestor) RunType() attestation.RunType { return attestation.PostProductRunType }
+
+func (a *cancellableAttestor) Attest(ctx *attestation.AttestationContext) error {
+	<-a.Context(ctx).Done()
+	a.stopped = true
+	return a.Context(ctx).Err()
+}
+
+func run(t *testing.T, g *Guard, attestors ...attestation.Attestor) ([]attestation.CompletedAttestor, error) {
+	ctx, err := attestation.NewContext(g.Apply(attestors), attestation.WithWorkingDir(t.TempDir()))
+	require.NoError(t, err)
+	err = ctx.RunAttestors()
+	return g.Completed(ctx.CompletedAttestors()), err
+}
+
+func TestGuard(t *testing.T) {
+	hung := &testAttestor{name: "aws", runType: attestation.PreMaterialRunType, delay: time.Second}
+	broken := &testAttestor{name: "gcp", runType: attestation.PreMaterialRunType, err: errors.New("metadata server unreachable")}
+	command := &testAttestor{name: "command-run", runType: attestation.ExecuteRunType, delay: 100 * time.Millisecond}
+	timeouts := map[string]time.Duration{"aws": 50 * time.Millisecond, DefaultTimeout: 50 * time.Millisecond}
+
+	// by default the attestor that times out fails the run
+	_, err := run(t, New(WithTimeouts(timeouts)), hung, material.New())
+	require.ErrorIs(t, err, ErrTimedOut)
+
+	g := New(WithTimeouts(timeouts), WithFailurePolicy(FailurePolicyWarn))
+	completed, err := run(t, g, hung, broken, material.New(), command)
+	require.NoError(t, err)
+	names := []string{}
+	for _, c := range completed {
+		names = append(names, c.Attestor.Name())
+	}
+
+	// execute attestors aren't bound by attestor timeouts
+	require.Equal(t, []string{"material", "command-run"}, names)
+	require.Len(t, g.Failures(), 2)
+	require.ErrorIs(t, g.Failures()[0].Err, ErrTimedOut)
+	require.Equal(t, "gcp", g.Failures()[1].Attestor)
+
+	failing := &testAttestor{name: "command-run", runType: attestation.ExecuteRunType, err: errors.New("exit status 1")}
+	_, err = run(t, New(WithFailurePolicy(FailurePolicySkip)), broken, failing)
+	require.ErrorContains(t, err, "exit status 1")
+
+	// the material and product attestors always fail the run, since the step would otherwise be recorded without
+	// materials or products
+	for _, name := range []string{material.Name, product.Name} {
+		broken := &testAttestor{name: name, runType: attestation.MaterialRunType, err: errors.New("permission denied")}
+		g := New(WithFailurePolicy(FailurePolicyWarn))
+		_, err = run(t, g, broken)
+		require.ErrorContains(t, err, "permission denied")
+		require.Empty(t, g.Failures())
+	}
+
+	attestors := []attestation.Attestor{material.New()}
+	require.Equal(t, attestors, New().Apply(attestors))
+}
+
+func TestCancellable(t *testing.T) {
+	cancellable := &cancellableAttestor{}
+	slow := &testAttestor{name: "slsa", runType: attestation.PostProductRunType, delay: 100 * time.Millisecond}
+	require.True(t, CanTimeout(wrap.Forwarder{Attestor: cancellable}))
+	require.True(t, CanTimeout(material.New()))
+	require.False(t, CanTimeout(slow))
+
+	// the cancellable attestor is stopped and waited for, even under a wrapper applied before the guard, while the
+	// default timeout doesn't apply to the attestor that can't be stopped
+	g := New(WithTimeouts(map[string]time.Duration{DefaultTimeout: 50 * time.Millisecond}), WithFailurePolicy(FailurePolicyWarn))
+	completed, err := run(t, g, wrap.Forwarder{Attestor: cancellable}, slow)
+	require.NoError(t, err)
+	require.True(t, cancellable.stopped)
+	require.Len(t, g.Failures(), 1)
+	require.Equal(t, "sbom", g.Failures()[0].Attestor)
+	require.ErrorIs(t, g.Failures()[0].Err, ErrTimedOut)
+	require.Len(t, completed, 1)
+	require.Equal(t, "slsa", completed[0].Attestor.Name())
+
+	// an attestor that isn't guarded runs with the context of the run
+	unguarded := &cancellableAttestor{}
+	ctx, err := attestation.NewContext([]attestation.Attestor{unguarded}, attestation.WithContext(canceled()))
+	require.NoError(t, err)
+	require.ErrorContains(t, ctx.RunAttestors(), context.Canceled.Error())
+	require.True(t, unguarded.stopped)
+}
+
+func canceled() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestParse(t *testing.T) {
+	policy, err := ParseFailurePolicy("skip")
+	require.NoError(t, err)
+	require.Equal(t, FailurePolicySkip, policy)
+	_, err = ParseFailurePolicy("ignore")
+	require.ErrorContains(t, err, "unknown attestor failure policy")
+
+	timeouts, err := ParseTimeouts(map[string]string{"aws": "5s", DefaultTimeout: " 1m"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{"aws": 5 * time.Second, DefaultTimeout: time.Minute}, timeouts)
+	_, err = ParseTimeouts(map[string]string{"aws": "soon"})
+	require.ErrorContains(t, err, "invalid timeout for attestor aws")
+	_, err = ParseTimeouts(map[string]string{"aws": "-1s"})
+	require.ErrorContains(t, err, "must not be negative")
+}
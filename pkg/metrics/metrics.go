@@ -0,0 +1,225 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics exports Prometheus metrics for the witness servers, so operators can alert on failing
+// verifications and runs, and see how well caches are working.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+const (
+	namespace = "witness"
+
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+
+	// Path is where the metrics are served.
+	Path = "/metrics"
+)
+
+// Metrics holds the metrics of a witness server. A nil Metrics records nothing, so servers don't need to check
+// whether metrics were enabled.
+type Metrics struct {
+	registry             *prometheus.Registry
+	verifications        *prometheus.CounterVec
+	verificationDuration *prometheus.HistogramVec
+	denials              *prometheus.CounterVec
+	runs                 *prometheus.CounterVec
+	runDuration          *prometheus.HistogramVec
+	cacheRequests        *prometheus.CounterVec
+	upstreamRequests     *prometheus.CounterVec
+	reloads              *prometheus.CounterVec
+	lastReload           prometheus.Gauge
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		verifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "verifications_total",
+			Help:      "Verifications by result, and by the category of the error for failures.",
+		}, []string{"result", "reason"}),
+		verificationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "verification_duration_seconds",
+			Help:      "Time taken to verify evidence against a policy.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"result"}),
+		denials: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "policy_denials_total",
+			Help:      "Rego denials of failed verifications by step and attestation type.",
+		}, []string{"step", "attestation"}),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "runs_total",
+			Help:      "Recorded runs by result, and by the category of the error for failures.",
+		}, []string{"result", "reason"}),
+		runDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "run_duration_seconds",
+			Help:      "Time taken to record and sign a run, including its command.",
+			Buckets:   []float64{0.1, 0.5, 1, 5, 15, 30, 60, 300, 900, 1800, 3600},
+		}, []string{"result"}),
+		cacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_requests_total",
+			Help:      "Cache lookups by cache and whether they were hits or misses.",
+		}, []string{"cache", "result"}),
+		upstreamRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "upstream_requests_total",
+			Help:      "Requests relayed to upstream services by service and HTTP status code.",
+		}, []string{"upstream", "code"}),
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "policy_reloads_total",
+			Help:      "Reloads of changed policies and trust roots by result, and by the category of the error for failures.",
+		}, []string{"result", "reason"}),
+		lastReload: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "policy_last_reload_timestamp_seconds",
+			Help:      "Time the policy being served was loaded, in seconds since the Unix epoch.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.verifications,
+		m.verificationDuration,
+		m.denials,
+		m.runs,
+		m.runDuration,
+		m.cacheRequests,
+		m.upstreamRequests,
+		m.reloads,
+		m.lastReload,
+	)
+
+	return m
+}
+
+// ObserveVerification records a verification that started at start and failed with err, or succeeded if err is
+// nil. The rego denials behind a failure are counted by step and attestation type.
+func (m *Metrics) ObserveVerification(start time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	outcome, reason := outcomeOf(err)
+	m.verifications.WithLabelValues(outcome, reason).Inc()
+	m.verificationDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+	denied := verify.ErrRegoDenied{}
+	if errors.As(err, &denied) {
+		for _, denial := range denied.Denials {
+			m.denials.WithLabelValues(denial.Step, denial.Attestation).Inc()
+		}
+	}
+}
+
+// ObserveRun records a run that started at start and failed with err, or succeeded if err is nil.
+func (m *Metrics) ObserveRun(start time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	outcome, reason := outcomeOf(err)
+	m.runs.WithLabelValues(outcome, reason).Inc()
+	m.runDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+}
+
+// ObserveCache records a lookup in the named cache.
+func (m *Metrics) ObserveCache(cache string, hit bool) {
+	if m == nil {
+		return
+	}
+
+	if hit {
+		m.cacheRequests.WithLabelValues(cache, "hit").Inc()
+	} else {
+		m.cacheRequests.WithLabelValues(cache, "miss").Inc()
+	}
+}
+
+// ObserveUpstream records a request relayed to an upstream service and the status code it responded with.
+func (m *Metrics) ObserveUpstream(upstream string, status int) {
+	if m == nil {
+		return
+	}
+
+	m.upstreamRequests.WithLabelValues(upstream, strconv.Itoa(status)).Inc()
+}
+
+// ObserveReload records a reload of a changed policy that failed with err, or succeeded if err is nil.
+func (m *Metrics) ObserveReload(err error) {
+	if m == nil {
+		return
+	}
+
+	outcome, reason := outcomeOf(err)
+	m.reloads.WithLabelValues(outcome, reason).Inc()
+	if err == nil {
+		m.lastReload.SetToCurrentTime()
+	}
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Serve serves the metrics at /metrics on listener until ctx is done.
+func (m *Metrics) Serve(ctx context.Context, listener net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, m.Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 30 * time.Second}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}
+
+// outcomeOf returns the result label of err, and the category of the error as its reason. Successes have no
+// reason.
+func outcomeOf(err error) (string, string) {
+	if err == nil {
+		return ResultSuccess, ""
+	}
+
+	return ResultFailure, string(result.CategoryOf(err))
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- m.Serve(ctx, listener)
+	}()
+
+	resp, err := http.Get(fmt.Sprintf("http://%v%v", listener.Addr(), Path))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	cancel()
+	require.NoError(t, <-served)
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	start := time.Now()
+	m.ObserveVerification(start, nil)
+	denied := verify.ErrRegoDenied{Denials: []verify.RegoDenial{{Step: "build", Attestation: "https://witness.dev/attestations/command-run/v0.1"}}}
+	m.ObserveVerification(start, result.Policy(fmt.Errorf("failed to verify policy: %w", denied)))
+	m.ObserveVerification(start, result.Storage(errors.New("archivista is unreachable")))
+	m.ObserveCache("verify", true)
+	m.ObserveCache("verify", false)
+	m.ObserveCache("verify", true)
+	m.ObserveUpstream("tsa", http.StatusOK)
+	m.ObserveReload(nil)
+	m.ObserveReload(result.Policy(errors.New("policy expired")))
+
+	body := scrape(t, m)
+	require.Contains(t, body, `witness_verifications_total{reason="",result="success"} 1`)
+	require.Contains(t, body, `witness_verifications_total{reason="policy",result="failure"} 1`)
+	require.Contains(t, body, `witness_verifications_total{reason="storage",result="failure"} 1`)
+	require.Contains(t, body, `witness_verification_duration_seconds_count{result="failure"} 2`)
+	require.Contains(t, body, `witness_policy_denials_total{attestation="https://witness.dev/attestations/command-run/v0.1",step="build"} 1`)
+	require.Contains(t, body, `witness_cache_requests_total{cache="verify",result="hit"} 2`)
+	require.Contains(t, body, `witness_cache_requests_total{cache="verify",result="miss"} 1`)
+	require.Contains(t, body, `witness_upstream_requests_total{code="200",upstream="tsa"} 1`)
+	require.Contains(t, body, `witness_policy_reloads_total{reason="policy",result="failure"} 1`)
+	require.NotContains(t, body, "witness_policy_last_reload_timestamp_seconds 0")
+	require.Contains(t, body, "go_goroutines")
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.ObserveVerification(time.Now(), nil)
+	m.ObserveRun(time.Now(), errors.New("failed"))
+	m.ObserveCache("relay", true)
+	m.ObserveUpstream("rekor", http.StatusBadGateway)
+	m.ObserveReload(nil)
+}
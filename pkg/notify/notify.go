@@ -0,0 +1,108 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notify posts the outcome of a release gate to webhooks, so the people who own a release hear about it
+// without watching the pipeline.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ResultPassed = "passed"
+	ResultFailed = "failed"
+)
+
+// Notification is the JSON body posted to each webhook. Text summarizes it in a line, which chat services such as
+// Slack and Mattermost display from incoming webhooks.
+type Notification struct {
+	Text     string   `json:"text"`
+	Result   string   `json:"result"`
+	Resource string   `json:"resource,omitempty"`
+	Subjects []string `json:"subjects"`
+	// PolicyDigest is the sha256 digest of the policy file the subjects were verified against.
+	PolicyDigest string `json:"policydigest,omitempty"`
+	// Category is the category of the error that failed the gate, as witness's exit codes report it.
+	Category string `json:"category,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	// VSADigest is the sha256 digest of the signed verification summary, which it is stored by.
+	VSADigest string `json:"vsadigest,omitempty"`
+}
+
+// Summarize sets the text of n from its other fields.
+func (n *Notification) Summarize() {
+	what := n.Resource
+	if what == "" {
+		what = strings.Join(n.Subjects, ", ")
+	}
+
+	if n.Result == ResultPassed {
+		n.Text = fmt.Sprintf("Release gate passed for %v", what)
+		return
+	}
+
+	n.Text = fmt.Sprintf("Release gate failed for %v: %v", what, n.Reason)
+}
+
+// Send posts n to each of urls. Every webhook is tried, and the failures are returned together.
+func Send(ctx context.Context, urls []string, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	defer client.CloseIdleConnections()
+	failures := []string{}
+	for _, url := range urls {
+		if err := post(ctx, client, url, body); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to send notifications: %v", strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+func post(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%v returned %v: %s", req.URL.Host, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSend(t *testing.T) {
+	received := []map[string]interface{}{}
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received = append(received, body)
+	}))
+
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+
+	defer failing.Close()
+	n := Notification{Result: ResultFailed, Subjects: []string{"sha256:abc"}, Reason: "step build is missing"}
+	n.Summarize()
+	require.Equal(t, "Release gate failed for sha256:abc: step build is missing", n.Text)
+
+	err := Send(context.Background(), []string{failing.URL, ok.URL}, n)
+	require.ErrorContains(t, err, "403 Forbidden: invalid_token")
+	require.Len(t, received, 1, "every webhook is tried")
+	require.Equal(t, n.Text, received[0]["text"])
+	require.Equal(t, ResultFailed, received[0]["result"])
+
+	n = Notification{Result: ResultPassed, Resource: "ghcr.io/acme/app:1.0"}
+	n.Summarize()
+	require.Equal(t, "Release gate passed for ghcr.io/acme/app:1.0", n.Text)
+	require.NoError(t, Send(context.Background(), []string{ok.URL}, n))
+}
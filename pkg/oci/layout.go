@@ -0,0 +1,485 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oci reads and writes OCI image layouts, attaching signed attestations to the images they describe as
+// referrer manifests so the attestations move with the images between registries and air-gapped environments.
+package oci
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	LayoutScheme = "oci-layout://"
+
+	MediaTypeImageIndex    = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeEmpty         = "application/vnd.oci.empty.v1+json"
+	MediaTypeDSSE          = "application/vnd.dsse.envelope.v1+json"
+	MediaTypeDockerList    = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeDockerImage   = "application/vnd.docker.distribution.manifest.v2+json"
+
+	AnnotationRefName = "org.opencontainers.image.ref.name"
+
+	layoutFileName = "oci-layout"
+	indexFileName  = "index.json"
+	layoutVersion  = "1.0.0"
+
+	// maxMetadataSize bounds the manifests and envelopes read from a layout. Layers are never read.
+	maxMetadataSize = 16 << 20
+)
+
+// emptyConfig is the config blob of artifact manifests, which have no configuration.
+var emptyConfig = []byte("{}")
+
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+type Index struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Manifests     []Descriptor      `json:"manifests"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Reference selects an image in a layout. A reference is oci-layout://<path>, optionally followed by :<tag> or
+// @<digest>. The path may be a layout directory or a tarball of one.
+type Reference struct {
+	Path   string
+	Tag    string
+	Digest string
+}
+
+// IsLayoutReference reports whether ref refers to an OCI layout.
+func IsLayoutReference(ref string) bool {
+	return strings.HasPrefix(ref, LayoutScheme)
+}
+
+func ParseReference(ref string) (Reference, error) {
+	if !IsLayoutReference(ref) {
+		return Reference{}, fmt.Errorf("unsupported image reference %v, expected %v<path>", ref, LayoutScheme)
+	}
+
+	r := Reference{Path: strings.TrimPrefix(ref, LayoutScheme)}
+	if i := strings.LastIndex(r.Path, "@"); i >= 0 {
+		r.Path, r.Digest = r.Path[:i], r.Path[i+1:]
+		if !strings.HasPrefix(r.Digest, "sha256:") {
+			return Reference{}, fmt.Errorf("unsupported digest %v in %v", r.Digest, ref)
+		}
+	} else if i := strings.LastIndex(r.Path, ":"); i > strings.LastIndex(r.Path, "/") {
+		r.Path, r.Tag = r.Path[:i], r.Path[i+1:]
+	}
+
+	if r.Path == "" {
+		return Reference{}, fmt.Errorf("image reference %v has no path", ref)
+	}
+
+	return r, nil
+}
+
+func (r Reference) String() string {
+	switch {
+	case r.Digest != "":
+		return LayoutScheme + r.Path + "@" + r.Digest
+	case r.Tag != "":
+		return LayoutScheme + r.Path + ":" + r.Tag
+	default:
+		return LayoutScheme + r.Path
+	}
+}
+
+// Layout is an OCI image layout. Layouts in directories can be read and written, while tarballs of layouts can
+// only be read.
+type Layout struct {
+	dir string
+	// files holds the index and metadata blobs of layouts read from tarballs, keyed by their path in the layout
+	files map[string][]byte
+}
+
+// Open opens the layout at path, which may be a directory or a tarball.
+func Open(path string) (*Layout, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Layout{dir: path}
+	if !info.IsDir() {
+		if l.files, err = readTarball(path); err != nil {
+			return nil, fmt.Errorf("failed to read layout tarball %v: %w", path, err)
+		}
+	}
+
+	layout := struct {
+		Version string `json:"imageLayoutVersion"`
+	}{}
+
+	data, err := l.readFile(layoutFileName)
+	if err != nil {
+		return nil, fmt.Errorf("%v is not an OCI image layout: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, &layout); err != nil || layout.Version == "" {
+		return nil, fmt.Errorf("%v is not an OCI image layout: invalid %v", path, layoutFileName)
+	}
+
+	return l, nil
+}
+
+// readTarball reads the files of a layout tarball that are small enough to be metadata. Layers are skipped.
+func readTarball(tarball string) (map[string][]byte, error) {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	files := make(map[string][]byte)
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg || header.Size > maxMetadataSize {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		files[path.Clean(strings.TrimPrefix(header.Name, "./"))] = data
+	}
+}
+
+func (l *Layout) readFile(name string) ([]byte, error) {
+	if l.files != nil {
+		data, ok := l.files[name]
+		if !ok {
+			return nil, fmt.Errorf("%v: %w", name, os.ErrNotExist)
+		}
+
+		return data, nil
+	}
+
+	f, err := os.Open(filepath.Join(l.dir, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxMetadataSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxMetadataSize {
+		return nil, fmt.Errorf("%v is larger than %v bytes", name, maxMetadataSize)
+	}
+
+	return data, nil
+}
+
+func blobPath(digest string) (string, error) {
+	algorithm, encoded, ok := strings.Cut(digest, ":")
+	if !ok || algorithm != "sha256" || len(encoded) != sha256.Size*2 {
+		return "", fmt.Errorf("unsupported digest %v", digest)
+	}
+
+	if _, err := hex.DecodeString(encoded); err != nil {
+		return "", fmt.Errorf("invalid digest %v", digest)
+	}
+
+	return path.Join("blobs", algorithm, encoded), nil
+}
+
+// ReadBlob reads a metadata blob, such as a manifest, and checks it against its digest.
+func (l *Layout) ReadBlob(digest string) ([]byte, error) {
+	name, err := blobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := l.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if Digest(data) != digest {
+		return nil, fmt.Errorf("blob %v does not match its digest", digest)
+	}
+
+	return data, nil
+}
+
+// Digest returns the OCI digest of data.
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (l *Layout) Index() (Index, error) {
+	data, err := l.readFile(indexFileName)
+	if err != nil {
+		return Index{}, err
+	}
+
+	index := Index{}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return Index{}, fmt.Errorf("failed to parse %v: %w", indexFileName, err)
+	}
+
+	return index, nil
+}
+
+// Resolve returns the descriptor of the image selected by ref. A reference without a tag or digest selects the
+// only image of the layout.
+func (l *Layout) Resolve(ref Reference) (Descriptor, error) {
+	index, err := l.Index()
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	candidates := []Descriptor{}
+	for _, desc := range index.Manifests {
+		// attached artifacts aren't images
+		if desc.ArtifactType != "" {
+			continue
+		}
+
+		switch {
+		case ref.Digest != "" && desc.Digest == ref.Digest:
+			return desc, nil
+		case ref.Tag != "" && desc.Annotations[AnnotationRefName] == ref.Tag:
+			return desc, nil
+		case ref.Digest == "" && ref.Tag == "":
+			candidates = append(candidates, desc)
+		}
+	}
+
+	if ref.Digest != "" || ref.Tag != "" {
+		return Descriptor{}, fmt.Errorf("no image %v in the layout", ref)
+	}
+
+	if len(candidates) != 1 {
+		return Descriptor{}, fmt.Errorf("layout %v has %v images, select one with :<tag> or @<digest>", ref.Path, len(candidates))
+	}
+
+	return candidates[0], nil
+}
+
+// SubjectDigests returns the sha256 digests an image is recorded under by attestors: the digest of its manifest
+// and, for single platform images, the digest of its config, which is the image id.
+func (l *Layout) SubjectDigests(image Descriptor) ([]string, error) {
+	digests := []string{strings.TrimPrefix(image.Digest, "sha256:")}
+	if image.MediaType != MediaTypeImageManifest && image.MediaType != MediaTypeDockerImage {
+		return digests, nil
+	}
+
+	data, err := l.ReadBlob(image.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := Manifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %v: %w", image.Digest, err)
+	}
+
+	if manifest.Config.Digest != "" {
+		digests = append(digests, strings.TrimPrefix(manifest.Config.Digest, "sha256:"))
+	}
+
+	return digests, nil
+}
+
+// Attestations returns the envelopes attached to image.
+func (l *Layout) Attestations(image Descriptor) ([][]byte, error) {
+	index, err := l.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	envelopes := [][]byte{}
+	for _, desc := range index.Manifests {
+		if desc.ArtifactType != MediaTypeDSSE {
+			continue
+		}
+
+		data, err := l.ReadBlob(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		manifest := Manifest{}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest %v: %w", desc.Digest, err)
+		}
+
+		if manifest.Subject == nil || manifest.Subject.Digest != image.Digest {
+			continue
+		}
+
+		for _, layer := range manifest.Layers {
+			if layer.MediaType != MediaTypeDSSE {
+				continue
+			}
+
+			envelope, err := l.ReadBlob(layer.Digest)
+			if err != nil {
+				return nil, err
+			}
+
+			envelopes = append(envelopes, envelope)
+		}
+	}
+
+	return envelopes, nil
+}
+
+// Attach attaches a signed envelope to image as a referrer manifest and adds the manifest to the layout's index.
+// Attaching the same envelope again has no effect.
+func (l *Layout) Attach(image Descriptor, envelope []byte) (Descriptor, error) {
+	if l.files != nil {
+		return Descriptor{}, fmt.Errorf("%v is a tarball, extract it to attach attestations", l.dir)
+	}
+
+	envelopeDesc, err := l.writeBlob(MediaTypeDSSE, envelope)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	configDesc, err := l.writeBlob(MediaTypeEmpty, emptyConfig)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	subject := Descriptor{MediaType: image.MediaType, Digest: image.Digest, Size: image.Size}
+	manifest, err := json.Marshal(Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageManifest,
+		ArtifactType:  MediaTypeDSSE,
+		Config:        configDesc,
+		Layers:        []Descriptor{envelopeDesc},
+		Subject:       &subject,
+	})
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	manifestDesc, err := l.writeBlob(MediaTypeImageManifest, manifest)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	manifestDesc.ArtifactType = MediaTypeDSSE
+	index, err := l.Index()
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	for _, desc := range index.Manifests {
+		if desc.Digest == manifestDesc.Digest {
+			return manifestDesc, nil
+		}
+	}
+
+	index.Manifests = append(index.Manifests, manifestDesc)
+	indexBytes, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	if err := writeFileAtomic(filepath.Join(l.dir, indexFileName), indexBytes); err != nil {
+		return Descriptor{}, fmt.Errorf("failed to update %v: %w", indexFileName, err)
+	}
+
+	return manifestDesc, nil
+}
+
+func (l *Layout) writeBlob(mediaType string, data []byte) (Descriptor, error) {
+	desc := Descriptor{MediaType: mediaType, Digest: Digest(data), Size: int64(len(data))}
+	name, err := blobPath(desc.Digest)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	dest := filepath.Join(l.dir, filepath.FromSlash(name))
+	if _, err := os.Stat(dest); err == nil {
+		return desc, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return Descriptor{}, err
+	}
+
+	if err := writeFileAtomic(dest, data); err != nil {
+		return Descriptor{}, err
+	}
+
+	return desc, nil
+}
+
+func writeFileAtomic(dest string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dest)
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestLayout writes a layout with a single image tagged v1 and returns its descriptor.
+func writeTestLayout(t *testing.T, dir string, config []byte) Descriptor {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, layoutFileName), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644))
+	l := &Layout{dir: dir}
+	configDesc, err := l.writeBlob("application/vnd.oci.image.config.v1+json", config)
+	require.NoError(t, err)
+	layerDesc, err := l.writeBlob("application/vnd.oci.image.layer.v1.tar", []byte("layer"))
+	require.NoError(t, err)
+	manifest, err := json.Marshal(Manifest{SchemaVersion: 2, MediaType: MediaTypeImageManifest, Config: configDesc, Layers: []Descriptor{layerDesc}})
+	require.NoError(t, err)
+	image, err := l.writeBlob(MediaTypeImageManifest, manifest)
+	require.NoError(t, err)
+
+	tagged := image
+	tagged.Annotations = map[string]string{AnnotationRefName: "v1"}
+	index, err := json.Marshal(Index{SchemaVersion: 2, MediaType: MediaTypeImageIndex, Manifests: []Descriptor{tagged}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, indexFileName), index, 0644))
+	return image
+}
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	tests := []struct {
+		ref     string
+		want    Reference
+		wantErr bool
+	}{
+		{ref: "oci-layout://image", want: Reference{Path: "image"}},
+		{ref: "oci-layout://./out/image:v1", want: Reference{Path: "./out/image", Tag: "v1"}},
+		{ref: "oci-layout:///tmp/image.tar@" + digest, want: Reference{Path: "/tmp/image.tar", Digest: digest}},
+		{ref: "oci-layout://host:1/image", want: Reference{Path: "host:1/image"}},
+		{ref: "oci-layout://image@md5:abc", wantErr: true},
+		{ref: "oci-layout://:v1", wantErr: true},
+		{ref: "registry.example.com/image:v1", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseReference(test.ref)
+		if test.wantErr {
+			require.Error(t, err, test.ref)
+			continue
+		}
+
+		require.NoError(t, err, test.ref)
+		require.Equal(t, test.want, got)
+		require.Equal(t, test.ref, got.String())
+	}
+}
+
+func TestAttach(t *testing.T) {
+	dir := t.TempDir()
+	image := writeTestLayout(t, dir, []byte(`{"architecture":"amd64"}`))
+	l, err := Open(dir)
+	require.NoError(t, err)
+
+	resolved, err := l.Resolve(Reference{Path: dir, Tag: "v1"})
+	require.NoError(t, err)
+	require.Equal(t, image.Digest, resolved.Digest)
+
+	envelope := []byte(`{"payload":"e30=","payloadType":"application/vnd.in-toto+json","signatures":[{"keyid":"a","sig":"b"}]}`)
+	desc, err := l.Attach(image, envelope)
+	require.NoError(t, err)
+	require.Equal(t, MediaTypeDSSE, desc.ArtifactType)
+
+	_, err = l.Attach(image, envelope)
+	require.NoError(t, err)
+	index, err := l.Index()
+	require.NoError(t, err)
+	require.Len(t, index.Manifests, 2)
+
+	// the attached artifact doesn't count as another image
+	resolved, err = l.Resolve(Reference{Path: dir})
+	require.NoError(t, err)
+	require.Equal(t, image.Digest, resolved.Digest)
+
+	envelopes, err := l.Attestations(image)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{envelope}, envelopes)
+
+	digests, err := l.SubjectDigests(image)
+	require.NoError(t, err)
+	require.Equal(t, []string{strings.TrimPrefix(image.Digest, "sha256:"), strings.TrimPrefix(Digest([]byte(`{"architecture":"amd64"}`)), "sha256:")}, digests)
+
+	_, err = l.Resolve(Reference{Path: dir, Tag: "v2"})
+	require.Error(t, err)
+}
+
+func TestTarball(t *testing.T) {
+	dir := t.TempDir()
+	image := writeTestLayout(t, dir, []byte(`{}`))
+	l, err := Open(dir)
+	require.NoError(t, err)
+	envelope := []byte(`{"payload":"e30=","payloadType":"application/vnd.in-toto+json","signatures":[]}`)
+	_, err = l.Attach(image, envelope)
+	require.NoError(t, err)
+
+	tarball := filepath.Join(t.TempDir(), "image.tar")
+	f, err := os.Create(tarball)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	require.NoError(t, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if err := tw.WriteHeader(&tar.Header{Name: "./" + filepath.ToSlash(name), Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+
+		_, err = tw.Write(data)
+		return err
+	}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	tl, err := Open(tarball)
+	require.NoError(t, err)
+	resolved, err := tl.Resolve(Reference{Path: tarball, Digest: image.Digest})
+	require.NoError(t, err)
+	envelopes, err := tl.Attestations(resolved)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{envelope}, envelopes)
+
+	_, err = tl.Attach(resolved, envelope)
+	require.Error(t, err)
+}
+
+func TestOpenNotLayout(t *testing.T) {
+	_, err := Open(t.TempDir())
+	require.Error(t, err)
+}
@@ -0,0 +1,114 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oidc holds the checks the CI attestors share for the OIDC tokens their platforms issue to jobs. Each
+// attestor verifies its token's signature with the go-witness jwt attestor, then checks the claims common to every
+// platform here before checking its own.
+package oidc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/testifysec/go-witness/attestation/jwt"
+)
+
+const requestTimeout = 30 * time.Second
+
+// CheckClaims checks that token was verified against a JWKS, was issued by issuer, hasn't expired, and, if audience
+// is set, was issued for audience. kind names the token in errors, such as "gitlab job token".
+func CheckClaims(token *jwt.Attestor, kind, issuer, audience string) error {
+	claims := token.Claims
+	if token.VerifiedBy.JWKSUrl == "" {
+		return fmt.Errorf("%v was not signed by a key of %v", kind, issuer)
+	}
+
+	if iss := fmt.Sprint(claims["iss"]); iss != issuer {
+		return fmt.Errorf("%v was issued by %v, not %v", kind, iss, issuer)
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("%v has no expiration", kind)
+	}
+
+	if time.Unix(int64(exp), 0).Before(time.Now()) {
+		return fmt.Errorf("%v expired at %v", kind, time.Unix(int64(exp), 0).UTC().Format(time.RFC3339))
+	}
+
+	if audience != "" && !HasAudience(claims["aud"], audience) {
+		return fmt.Errorf("%v was not issued for audience %v", kind, audience)
+	}
+
+	return nil
+}
+
+// HasAudience reports whether the aud claim, which may be a string or a list of them, includes audience.
+func HasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// DiscoverJWKS returns the JWKS url of issuer from its OpenID configuration.
+func DiscoverJWKS(issuer string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return "", err
+	}
+
+	config := struct {
+		JWKSURI string `json:"jwks_uri"`
+	}{}
+
+	if err := GetJSON(req, &config); err != nil {
+		return "", fmt.Errorf("failed to discover keys of %v: %w", issuer, err)
+	}
+
+	if config.JWKSURI == "" {
+		return "", fmt.Errorf("openid configuration of %v has no jwks_uri", issuer)
+	}
+
+	return config.JWKSURI, nil
+}
+
+// GetJSON sends req and decodes the JSON it responds with into v.
+func GetJSON(req *http.Request, v interface{}) error {
+	client := &http.Client{Timeout: requestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%v returned %v: %s", req.URL.Host, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
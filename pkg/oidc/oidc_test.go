@@ -0,0 +1,79 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation/jwt"
+)
+
+func TestCheckClaims(t *testing.T) {
+	token := jwt.New()
+	token.VerifiedBy.JWKSUrl = "https://issuer.example.com/keys"
+	token.Claims = map[string]interface{}{
+		"iss": "https://issuer.example.com",
+		"exp": float64(time.Now().Add(time.Hour).Unix()),
+		"aud": []interface{}{"witness", "sigstore"},
+	}
+
+	require.NoError(t, CheckClaims(token, "test token", "https://issuer.example.com", "witness"))
+	require.NoError(t, CheckClaims(token, "test token", "https://issuer.example.com", ""))
+	require.ErrorContains(t, CheckClaims(token, "test token", "https://issuer.example.com", "other"), "test token was not issued for audience other")
+	require.ErrorContains(t, CheckClaims(token, "test token", "https://other.example.com", "witness"), "issued by https://issuer.example.com, not https://other.example.com")
+
+	token.Claims["exp"] = float64(time.Now().Add(-time.Hour).Unix())
+	require.ErrorContains(t, CheckClaims(token, "test token", "https://issuer.example.com", "witness"), "test token expired")
+
+	delete(token.Claims, "exp")
+	require.ErrorContains(t, CheckClaims(token, "test token", "https://issuer.example.com", "witness"), "no expiration")
+
+	token.VerifiedBy.JWKSUrl = ""
+	require.ErrorContains(t, CheckClaims(token, "test token", "https://issuer.example.com", "witness"), "not signed by a key of")
+}
+
+func TestHasAudience(t *testing.T) {
+	require.True(t, HasAudience("witness", "witness"))
+	require.True(t, HasAudience([]interface{}{"sigstore", "witness"}, "witness"))
+	require.False(t, HasAudience("sigstore", "witness"))
+	require.False(t, HasAudience(nil, "witness"))
+}
+
+func TestDiscoverJWKS(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/good/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"issuer": %q, "jwks_uri": %q}`, server.URL+"/good", server.URL+"/good/keys")
+	})
+	mux.HandleFunc("/nokeys/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"issuer": %q}`, server.URL+"/nokeys")
+	})
+
+	jwksURL, err := DiscoverJWKS(server.URL + "/good")
+	require.NoError(t, err)
+	require.Equal(t, server.URL+"/good/keys", jwksURL)
+
+	_, err = DiscoverJWKS(server.URL + "/nokeys")
+	require.ErrorContains(t, err, "has no jwks_uri")
+
+	_, err = DiscoverJWKS(server.URL + "/missing")
+	require.ErrorContains(t, err, "404 Not Found")
+}
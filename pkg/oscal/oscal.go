@@ -0,0 +1,383 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oscal translates audit packages into OSCAL assessment results, so compliance platforms that consume OSCAL
+// can ingest witness evidence as observations and findings for the controls it supports.
+package oscal
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/testifysec/witness/pkg/audit"
+)
+
+const (
+	Version = "1.1.2"
+	// Namespace is the namespace of the properties witness adds to OSCAL documents.
+	Namespace = "https://witness.dev/ns/oscal"
+
+	StateSatisfied    = "satisfied"
+	StateNotSatisfied = "not-satisfied"
+)
+
+// uuidNamespace is the namespace witness derives name based uuids in, so exporting the same evidence twice
+// produces the same document.
+var uuidNamespace = []byte("https://witness.dev/oscal")
+
+type Document struct {
+	AssessmentResults AssessmentResults `json:"assessment-results"`
+}
+
+type AssessmentResults struct {
+	UUID       string     `json:"uuid"`
+	Metadata   Metadata   `json:"metadata"`
+	ImportAP   ImportAP   `json:"import-ap"`
+	Results    []Result   `json:"results"`
+	BackMatter BackMatter `json:"back-matter"`
+}
+
+type Metadata struct {
+	Title        string    `json:"title"`
+	LastModified time.Time `json:"last-modified"`
+	Version      string    `json:"version"`
+	OSCALVersion string    `json:"oscal-version"`
+}
+
+type ImportAP struct {
+	Href string `json:"href"`
+}
+
+type Property struct {
+	Name  string `json:"name"`
+	NS    string `json:"ns,omitempty"`
+	Value string `json:"value"`
+}
+
+type Result struct {
+	UUID             string           `json:"uuid"`
+	Title            string           `json:"title"`
+	Description      string           `json:"description"`
+	Start            time.Time        `json:"start"`
+	Props            []Property       `json:"props,omitempty"`
+	ReviewedControls ReviewedControls `json:"reviewed-controls"`
+	Observations     []Observation    `json:"observations,omitempty"`
+	Findings         []Finding        `json:"findings,omitempty"`
+}
+
+type ReviewedControls struct {
+	ControlSelections []ControlSelection `json:"control-selections"`
+}
+
+type ControlSelection struct {
+	IncludeAll      *struct{}           `json:"include-all,omitempty"`
+	IncludeControls []SelectControlByID `json:"include-controls,omitempty"`
+}
+
+type SelectControlByID struct {
+	ControlID string `json:"control-id"`
+}
+
+type Observation struct {
+	UUID             string             `json:"uuid"`
+	Title            string             `json:"title"`
+	Description      string             `json:"description"`
+	Props            []Property         `json:"props,omitempty"`
+	Methods          []string           `json:"methods"`
+	RelevantEvidence []RelevantEvidence `json:"relevant-evidence,omitempty"`
+	Collected        time.Time          `json:"collected"`
+}
+
+type RelevantEvidence struct {
+	Href        string `json:"href"`
+	Description string `json:"description"`
+}
+
+type Finding struct {
+	UUID                string               `json:"uuid"`
+	Title               string               `json:"title"`
+	Description         string               `json:"description"`
+	Target              Target               `json:"target"`
+	RelatedObservations []RelatedObservation `json:"related-observations,omitempty"`
+}
+
+type Target struct {
+	Type     string `json:"type"`
+	TargetID string `json:"target-id"`
+	Status   Status `json:"status"`
+}
+
+type Status struct {
+	State  string `json:"state"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type RelatedObservation struct {
+	ObservationUUID string `json:"observation-uuid"`
+}
+
+type BackMatter struct {
+	Resources []Resource `json:"resources"`
+}
+
+type Resource struct {
+	UUID   string  `json:"uuid"`
+	Title  string  `json:"title"`
+	Base64 *Base64 `json:"base64,omitempty"`
+}
+
+type Base64 struct {
+	Filename  string `json:"filename"`
+	MediaType string `json:"media-type"`
+	Value     string `json:"value"`
+}
+
+type Option func(*options)
+
+type options struct {
+	controls         map[string][]string
+	attestationTypes map[string]struct{}
+}
+
+// WithControls maps control ids, such as cm-3, to the steps whose evidence supports them. Each control becomes a
+// finding that is satisfied if verification passed and every step mapped to it has verified evidence.
+func WithControls(controls map[string][]string) Option {
+	return func(o *options) {
+		o.controls = controls
+	}
+}
+
+// WithAttestationTypes selects attestations that are attached to the document on their own, in addition to the
+// envelopes of their collections, so reviewers can read them without unpacking the signed statement.
+func WithAttestationTypes(types []string) Option {
+	return func(o *options) {
+		for _, t := range types {
+			o.attestationTypes[t] = struct{}{}
+		}
+	}
+}
+
+// New translates an audit package into OSCAL assessment results. Each verified collection becomes an observation
+// with its envelope attached as a back matter resource.
+func New(p *audit.Package, opts ...Option) (Document, error) {
+	o := options{controls: map[string][]string{}, attestationTypes: map[string]struct{}{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	serial := p.Report.Serial
+	controls := o.controls
+	policyResource := Resource{
+		UUID:  nameUUID(serial, "policy", p.Report.PolicyDigest),
+		Title: "Witness policy " + p.Report.PolicyDigest,
+	}
+
+	doc := Document{AssessmentResults: AssessmentResults{
+		UUID: nameUUID(serial, "assessment-results"),
+		Metadata: Metadata{
+			Title:        "Witness verification " + serial,
+			LastModified: p.Report.GeneratedAt,
+			Version:      serial,
+			OSCALVersion: Version,
+		},
+		ImportAP:   ImportAP{Href: "#" + policyResource.UUID},
+		BackMatter: BackMatter{Resources: []Resource{policyResource}},
+	}}
+
+	result := Result{
+		UUID:        nameUUID(serial, "result"),
+		Title:       "Witness policy verification",
+		Description: resultDescription(p.Report),
+		Start:       p.Report.GeneratedAt,
+		Props: []Property{
+			{Name: "policy-digest", NS: Namespace, Value: p.Report.PolicyDigest},
+			{Name: "passed", NS: Namespace, Value: fmt.Sprint(p.Report.Passed)},
+		},
+	}
+
+	for _, subject := range p.Report.Subjects {
+		result.Props = append(result.Props, Property{Name: "subject", NS: Namespace, Value: subject})
+	}
+
+	observationsByStep := make(map[string][]string)
+	for _, evidence := range p.Evidence {
+		envelope, err := json.Marshal(evidence.Envelope)
+		if err != nil {
+			return Document{}, err
+		}
+
+		resource := Resource{
+			UUID:  nameUUID(serial, "evidence", evidence.Serial, evidence.PayloadDigest),
+			Title: fmt.Sprintf("Signed attestation of step %v", evidence.Step),
+			Base64: &Base64{
+				Filename:  fmt.Sprintf("%v-%v.json", evidence.Serial, evidence.Step),
+				MediaType: "application/vnd.dsse.envelope.v1+json",
+				Value:     base64.StdEncoding.EncodeToString(envelope),
+			},
+		}
+
+		observation := Observation{
+			UUID:        nameUUID(serial, "observation", evidence.Serial, evidence.PayloadDigest),
+			Title:       fmt.Sprintf("Verified evidence for step %v", evidence.Step),
+			Description: fmt.Sprintf("Attestation %v of step %v passed policy verification, signed by %v.", evidence.Reference, evidence.Step, strings.Join(evidence.Signers, ", ")),
+			Props: []Property{
+				{Name: "step", NS: Namespace, Value: evidence.Step},
+				{Name: "payload-digest", NS: Namespace, Value: evidence.PayloadDigest},
+			},
+			Methods:          []string{"TEST"},
+			RelevantEvidence: []RelevantEvidence{{Href: "#" + resource.UUID, Description: "Signed DSSE envelope of the attestation collection"}},
+			Collected:        p.Report.GeneratedAt,
+		}
+
+		for _, signer := range evidence.Signers {
+			observation.Props = append(observation.Props, Property{Name: "signer", NS: Namespace, Value: signer})
+		}
+
+		doc.AssessmentResults.BackMatter.Resources = append(doc.AssessmentResults.BackMatter.Resources, resource)
+		for _, attestation := range attestations(evidence.Statement) {
+			observation.Props = append(observation.Props, Property{Name: "attestation-type", NS: Namespace, Value: attestation.Type})
+			if _, ok := o.attestationTypes[attestation.Type]; !ok {
+				continue
+			}
+
+			attestationResource := Resource{
+				UUID:  nameUUID(serial, "attestation", evidence.Serial, evidence.PayloadDigest, attestation.Type),
+				Title: fmt.Sprintf("%v attestation of step %v", attestation.Type, evidence.Step),
+				Base64: &Base64{
+					Filename:  fmt.Sprintf("%v-%v-%v.json", evidence.Serial, evidence.Step, path.Base(attestation.Type)),
+					MediaType: "application/json",
+					Value:     base64.StdEncoding.EncodeToString(attestation.Attestation),
+				},
+			}
+
+			doc.AssessmentResults.BackMatter.Resources = append(doc.AssessmentResults.BackMatter.Resources, attestationResource)
+			observation.RelevantEvidence = append(observation.RelevantEvidence, RelevantEvidence{Href: "#" + attestationResource.UUID, Description: attestation.Type + " attestation"})
+		}
+
+		result.Observations = append(result.Observations, observation)
+		observationsByStep[evidence.Step] = append(observationsByStep[evidence.Step], observation.UUID)
+	}
+
+	controlIDs := make([]string, 0, len(controls))
+	for id := range controls {
+		controlIDs = append(controlIDs, id)
+	}
+
+	sort.Strings(controlIDs)
+	selection := ControlSelection{}
+	if len(controlIDs) == 0 {
+		selection.IncludeAll = &struct{}{}
+	}
+
+	for _, id := range controlIDs {
+		selection.IncludeControls = append(selection.IncludeControls, SelectControlByID{ControlID: id})
+		result.Findings = append(result.Findings, finding(serial, id, controls[id], p.Report, observationsByStep))
+	}
+
+	result.ReviewedControls.ControlSelections = []ControlSelection{selection}
+	doc.AssessmentResults.Results = []Result{result}
+	return doc, nil
+}
+
+func finding(serial, controlID string, steps []string, report audit.Report, observationsByStep map[string][]string) Finding {
+	f := Finding{
+		UUID:        nameUUID(serial, "finding", controlID),
+		Title:       fmt.Sprintf("Witness evidence for %v", controlID),
+		Description: fmt.Sprintf("Control %v is supported by verified evidence of the steps %v.", controlID, strings.Join(steps, ", ")),
+		Target:      Target{Type: "statement-id", TargetID: controlID + "_smt", Status: Status{State: StateSatisfied}},
+	}
+
+	missing := []string{}
+	for _, step := range steps {
+		observations := observationsByStep[step]
+		if len(observations) == 0 {
+			missing = append(missing, step)
+		}
+
+		for _, observation := range observations {
+			f.RelatedObservations = append(f.RelatedObservations, RelatedObservation{ObservationUUID: observation})
+		}
+	}
+
+	switch {
+	case !report.Passed:
+		f.Target.Status = Status{State: StateNotSatisfied, Reason: "policy verification failed"}
+	case len(missing) > 0:
+		f.Target.Status = Status{State: StateNotSatisfied, Reason: fmt.Sprintf("no verified evidence for %v", strings.Join(missing, ", "))}
+	}
+
+	return f
+}
+
+func resultDescription(report audit.Report) string {
+	if report.Passed {
+		return "The subjects passed verification against the witness policy."
+	}
+
+	return fmt.Sprintf("The subjects failed verification against the witness policy: %v", report.Error)
+}
+
+type collectionAttestation struct {
+	Type        string          `json:"type"`
+	Attestation json.RawMessage `json:"attestation"`
+}
+
+// attestations returns the attestations in a collection's statement.
+func attestations(statement json.RawMessage) []collectionAttestation {
+	parsed := struct {
+		Predicate struct {
+			Attestations []collectionAttestation `json:"attestations"`
+		} `json:"predicate"`
+	}{}
+
+	if err := json.Unmarshal(statement, &parsed); err != nil {
+		return nil
+	}
+
+	return parsed.Predicate.Attestations
+}
+
+// ParseControls parses control mappings of the form control-id=step. A control may be mapped to several steps by
+// repeating it.
+func ParseControls(mappings []string) (map[string][]string, error) {
+	controls := make(map[string][]string)
+	for _, mapping := range mappings {
+		id, step, ok := strings.Cut(mapping, "=")
+		id, step = strings.TrimSpace(id), strings.TrimSpace(step)
+		if !ok || id == "" || step == "" {
+			return nil, fmt.Errorf("invalid control mapping %v, expected control-id=step", mapping)
+		}
+
+		controls[strings.ToLower(id)] = append(controls[strings.ToLower(id)], step)
+	}
+
+	return controls, nil
+}
+
+// nameUUID returns the RFC 4122 version 5 uuid of the joined names.
+func nameUUID(names ...string) string {
+	h := sha1.New()
+	h.Write(uuidNamespace)
+	h.Write([]byte(strings.Join(names, "\x00")))
+	sum := h.Sum(nil)
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
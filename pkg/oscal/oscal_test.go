@@ -0,0 +1,122 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oscal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/witness/pkg/audit"
+)
+
+func testPackage(passed bool) *audit.Package {
+	statement := json.RawMessage(`{"predicate":{"name":"build","attestations":[{"type":"https://witness.dev/attestations/git/v0.1","attestation":{"commithash":"abc"}},{"type":"https://witness.dev/attestations/command-run/v0.1","attestation":{"cmd":["make"]}}]}}`)
+	p := &audit.Package{
+		Report: audit.Report{
+			Serial:       "0042",
+			GeneratedAt:  time.Unix(0, 0).UTC(),
+			Subjects:     []string{"sha256:abcd"},
+			PolicyDigest: "1234",
+			Passed:       passed,
+		},
+		Evidence: []audit.Evidence{{
+			Serial:        "0001",
+			Step:          "build",
+			Reference:     "build.json",
+			Signers:       []string{"key1"},
+			PayloadDigest: "5678",
+			Statement:     statement,
+			Envelope:      dsse.Envelope{Payload: statement, PayloadType: "application/vnd.in-toto+json"},
+		}},
+	}
+
+	if !passed {
+		p.Report.Error = "no evidence for step review"
+	}
+
+	return p
+}
+
+func TestNew(t *testing.T) {
+	controls, err := ParseControls([]string{"SI-7=build", "cm-3=build", "cm-3=review"})
+	require.NoError(t, err)
+	doc, err := New(testPackage(true), WithControls(controls), WithAttestationTypes([]string{"https://witness.dev/attestations/git/v0.1"}))
+	require.NoError(t, err)
+
+	ar := doc.AssessmentResults
+	require.Equal(t, Version, ar.Metadata.OSCALVersion)
+	require.Len(t, ar.Results, 1)
+	result := ar.Results[0]
+	require.Equal(t, []SelectControlByID{{ControlID: "cm-3"}, {ControlID: "si-7"}}, result.ReviewedControls.ControlSelections[0].IncludeControls)
+
+	require.Len(t, result.Observations, 1)
+	observation := result.Observations[0]
+	require.Contains(t, observation.Props, Property{Name: "signer", NS: Namespace, Value: "key1"})
+	require.Contains(t, observation.Props, Property{Name: "attestation-type", NS: Namespace, Value: "https://witness.dev/attestations/command-run/v0.1"})
+	require.Len(t, observation.RelevantEvidence, 2)
+
+	// policy, envelope, and the selected git attestation
+	require.Len(t, ar.BackMatter.Resources, 3)
+	require.Equal(t, "#"+ar.BackMatter.Resources[0].UUID, ar.ImportAP.Href)
+	attestation, err := base64.StdEncoding.DecodeString(ar.BackMatter.Resources[2].Base64.Value)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"commithash":"abc"}`, string(attestation))
+
+	require.Len(t, result.Findings, 2)
+	require.Equal(t, "cm-3_smt", result.Findings[0].Target.TargetID)
+	require.Equal(t, StateNotSatisfied, result.Findings[0].Target.Status.State)
+	require.Contains(t, result.Findings[0].Target.Status.Reason, "review")
+	require.Equal(t, StateSatisfied, result.Findings[1].Target.Status.State)
+	require.Equal(t, []RelatedObservation{{ObservationUUID: observation.UUID}}, result.Findings[1].RelatedObservations)
+
+	again, err := New(testPackage(true), WithControls(controls), WithAttestationTypes([]string{"https://witness.dev/attestations/git/v0.1"}))
+	require.NoError(t, err)
+	require.Equal(t, doc, again)
+}
+
+func TestNewFailedVerification(t *testing.T) {
+	doc, err := New(testPackage(false), WithControls(map[string][]string{"si-7": {"build"}}))
+	require.NoError(t, err)
+	result := doc.AssessmentResults.Results[0]
+	require.Contains(t, result.Description, "no evidence for step review")
+	require.Equal(t, StateNotSatisfied, result.Findings[0].Target.Status.State)
+}
+
+func TestNewWithoutControls(t *testing.T) {
+	doc, err := New(testPackage(true))
+	require.NoError(t, err)
+	result := doc.AssessmentResults.Results[0]
+	require.NotNil(t, result.ReviewedControls.ControlSelections[0].IncludeAll)
+	require.Empty(t, result.Findings)
+	require.Len(t, doc.AssessmentResults.BackMatter.Resources, 2)
+}
+
+func TestParseControls(t *testing.T) {
+	_, err := ParseControls([]string{"cm-3"})
+	require.Error(t, err)
+	_, err = ParseControls([]string{"=build"})
+	require.Error(t, err)
+}
+
+func TestNameUUID(t *testing.T) {
+	id := nameUUID("a", "b")
+	require.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, id)
+	require.Equal(t, id, nameUUID("a", "b"))
+	require.NotEqual(t, id, nameUUID("ab"))
+}
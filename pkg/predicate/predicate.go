@@ -0,0 +1,220 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package predicate lets witness record built-in attestors under custom predicate types and read attestations with
+// predicate types it has no attestor for, so collections from other in-toto producers can be verified.
+package predicate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/witness/pkg/wrap"
+)
+
+var (
+	_ attestation.Attestor   = &aliasedAttestor{}
+	_ attestation.Subjecter  = &aliasedAttestor{}
+	_ attestation.Materialer = &aliasedAttestor{}
+	_ attestation.Producer   = &aliasedAttestor{}
+	_ attestation.BackReffer = &aliasedAttestor{}
+	_ attestation.Attestor   = &opaqueAttestor{}
+)
+
+var (
+	registeredMu sync.Mutex
+	// registered holds the predicate types registered by this package, so registering a type again replaces the
+	// earlier registration while types of built-in attestors can't be replaced.
+	registered = map[string]struct{}{}
+)
+
+// Alias records the attestations of the built-in attestor named Name under the predicate type Type.
+type Alias struct {
+	Name string
+	Type string
+}
+
+// ParseAliases validates aliases given as attestor names mapped to predicate type URIs.
+func ParseAliases(aliases map[string]string) ([]Alias, error) {
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	parsed := make([]Alias, 0, len(aliases))
+	for _, name := range names {
+		if _, ok := attestation.FactoryByName(name); !ok {
+			return nil, fmt.Errorf("cannot alias unknown attestor %v", name)
+		}
+
+		if err := validateType(aliases[name]); err != nil {
+			return nil, err
+		}
+
+		parsed = append(parsed, Alias{Name: name, Type: aliases[name]})
+	}
+
+	return parsed, nil
+}
+
+// Apply wraps the attestors that have an alias so they are recorded under the alias' predicate type.
+func Apply(attestors []attestation.Attestor, aliases []Alias) []attestation.Attestor {
+	types := make(map[string]string, len(aliases))
+	for _, alias := range aliases {
+		types[alias.Name] = alias.Type
+	}
+
+	applied := make([]attestation.Attestor, 0, len(attestors))
+	for _, attestor := range attestors {
+		predicateType, ok := types[attestor.Name()]
+		if !ok {
+			applied = append(applied, attestor)
+			continue
+		}
+
+		applied = append(applied, &aliasedAttestor{Forwarder: wrap.Forwarder{Attestor: attestor}, predicateType: predicateType})
+	}
+
+	return applied
+}
+
+// RegisterAlias registers the alias' predicate type so attestations recorded under it are read by the aliased
+// attestor during verification.
+func RegisterAlias(alias Alias) error {
+	factory, ok := attestation.FactoryByName(alias.Name)
+	if !ok {
+		return fmt.Errorf("cannot alias unknown attestor %v", alias.Name)
+	}
+
+	runType := factory().RunType()
+	return register(alias.Type, runType, func() attestation.Attestor {
+		return &aliasedAttestor{Forwarder: wrap.Forwarder{Attestor: factory()}, predicateType: alias.Type}
+	})
+}
+
+// RegisterOpaque registers a predicate type witness has no attestor for. Attestations of the type are kept as
+// opaque JSON that policies can still evaluate with rego, and are rejected if they don't match schema. A nil
+// schema accepts any JSON object.
+func RegisterOpaque(predicateType string, schema *Schema) error {
+	if err := validateType(predicateType); err != nil {
+		return err
+	}
+
+	return register(predicateType, attestation.PostProductRunType, func() attestation.Attestor {
+		return &opaqueAttestor{predicateType: predicateType, schema: schema}
+	})
+}
+
+// NewOpaque holds the JSON object raw as an attestation of predicateType, for predicates that arrive outside of a
+// collection.
+func NewOpaque(predicateType string, raw json.RawMessage) (attestation.Attestor, error) {
+	o := &opaqueAttestor{predicateType: predicateType}
+	if err := o.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+func register(predicateType string, runType attestation.RunType, factory attestation.AttestorFactory) error {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	if _, ok := registered[predicateType]; !ok {
+		if _, exists := attestation.FactoryByType(predicateType); exists {
+			return fmt.Errorf("predicate type %v is already registered", predicateType)
+		}
+	}
+
+	// registering under the type as the name keeps lookups of the built-in attestors by name intact
+	attestation.RegisterAttestation(predicateType, predicateType, runType, factory)
+	registered[predicateType] = struct{}{}
+	return nil
+}
+
+func validateType(predicateType string) error {
+	u, err := url.Parse(predicateType)
+	if err != nil || u.Scheme == "" {
+		return fmt.Errorf("predicate type %v is not an absolute URI", predicateType)
+	}
+
+	return nil
+}
+
+// aliasedAttestor runs the wrapped attestor as normal and reports the alias' predicate type, so the attestation is
+// recorded under it.
+type aliasedAttestor struct {
+	wrap.Forwarder
+	predicateType string
+}
+
+func (a *aliasedAttestor) Type() string {
+	return a.predicateType
+}
+
+// opaqueAttestor holds an attestation of a predicate type witness has no attestor for. It can only be read from
+// collections recorded by other producers.
+type opaqueAttestor struct {
+	predicateType string
+	schema        *Schema
+	raw           json.RawMessage
+}
+
+func (o *opaqueAttestor) Name() string {
+	return o.predicateType
+}
+
+func (o *opaqueAttestor) Type() string {
+	return o.predicateType
+}
+
+func (o *opaqueAttestor) RunType() attestation.RunType {
+	return attestation.PostProductRunType
+}
+
+func (o *opaqueAttestor) Attest(ctx *attestation.AttestationContext) error {
+	return fmt.Errorf("attestations of predicate type %v can't be recorded by witness", o.predicateType)
+}
+
+func (o *opaqueAttestor) MarshalJSON() ([]byte, error) {
+	if o.raw == nil {
+		return []byte("{}"), nil
+	}
+
+	return o.raw, nil
+}
+
+func (o *opaqueAttestor) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	if _, ok := value.(map[string]interface{}); !ok {
+		return fmt.Errorf("attestation of predicate type %v is not a JSON object", o.predicateType)
+	}
+
+	if o.schema != nil {
+		if err := o.schema.Validate(value); err != nil {
+			return fmt.Errorf("attestation of predicate type %v does not match its schema: %w", o.predicateType, err)
+		}
+	}
+
+	o.raw = append(json.RawMessage{}, data...)
+	return nil
+}
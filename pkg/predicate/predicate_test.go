@@ -0,0 +1,74 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/environment"
+	"github.com/testifysec/go-witness/attestation/material"
+)
+
+func TestAliases(t *testing.T) {
+	aliases, err := ParseAliases(map[string]string{environment.Name: "https://example.com/environment/v1"})
+	require.NoError(t, err)
+	_, err = ParseAliases(map[string]string{"unknown": "https://example.com/unknown/v1"})
+	require.Error(t, err)
+	_, err = ParseAliases(map[string]string{environment.Name: "environment-v1"})
+	require.Error(t, err)
+
+	attestors := Apply([]attestation.Attestor{environment.New(), material.New()}, aliases)
+	require.Equal(t, "https://example.com/environment/v1", attestors[0].Type())
+	require.Equal(t, environment.Name, attestors[0].Name())
+	require.Equal(t, material.Type, attestors[1].Type())
+
+	require.NoError(t, RegisterAlias(aliases[0]))
+	require.NoError(t, RegisterAlias(aliases[0]))
+	factory, ok := attestation.FactoryByType("https://example.com/environment/v1")
+	require.True(t, ok)
+	require.Equal(t, "https://example.com/environment/v1", factory().Type())
+
+	// the built-in attestor is still found by name
+	factory, ok = attestation.FactoryByName(environment.Name)
+	require.True(t, ok)
+	require.Equal(t, environment.Type, factory().Type())
+
+	require.Error(t, RegisterAlias(Alias{Name: environment.Name, Type: material.Type}))
+}
+
+func TestOpaque(t *testing.T) {
+	const predicateType = "https://slsa.dev/provenance/v1"
+	schema, err := ParseSchema([]byte(`{"type":"object","required":["buildDefinition"],"properties":{"buildDefinition":{"type":"object","required":["buildType"]}}}`))
+	require.NoError(t, err)
+	require.NoError(t, RegisterOpaque(predicateType, schema))
+	require.Error(t, RegisterOpaque(material.Type, nil))
+
+	collection := attestation.Collection{}
+	valid := `{"name":"build","attestations":[{"type":"` + predicateType + `","attestation":{"buildDefinition":{"buildType":"make"}}}]}`
+	require.NoError(t, json.Unmarshal([]byte(valid), &collection))
+	require.Equal(t, predicateType, collection.Attestations[0].Attestation.Type())
+
+	marshaled, err := json.Marshal(collection.Attestations[0].Attestation)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"buildDefinition":{"buildType":"make"}}`, string(marshaled))
+	require.Error(t, collection.Attestations[0].Attestation.Attest(nil))
+
+	invalid := `{"name":"build","attestations":[{"type":"` + predicateType + `","attestation":{"buildDefinition":{}}}]}`
+	err = json.Unmarshal([]byte(invalid), &collection)
+	require.ErrorContains(t, err, "/buildDefinition: missing required property buildType")
+}
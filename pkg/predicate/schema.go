@@ -0,0 +1,279 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is a JSON Schema that opaque attestations are validated against. The keywords type, properties, required,
+// additionalProperties, items, enum, const, pattern, minLength, and minItems are supported. Schemas using other
+// validation keywords, such as $ref, are rejected when loaded rather than silently accepting everything.
+type Schema struct {
+	Type                 schemaTypes        `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *additional        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Const                *interface{}       `json:"const,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// annotationKeywords are keywords that don't affect validation and are accepted without being understood.
+var annotationKeywords = map[string]struct{}{
+	"$schema": {}, "$id": {}, "$comment": {}, "title": {}, "description": {}, "examples": {}, "default": {},
+}
+
+// LoadSchema reads a JSON Schema from path.
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := ParseSchema(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema %v: %w", path, err)
+	}
+
+	return schema, nil
+}
+
+// ParseSchema parses a JSON Schema.
+func ParseSchema(data []byte) (*Schema, error) {
+	schema := &Schema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	keywords := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &keywords); err != nil {
+		return err
+	}
+
+	supported := map[string]struct{}{}
+	for _, field := range reflect.VisibleFields(reflect.TypeOf(Schema{})) {
+		if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+			supported[name] = struct{}{}
+		}
+	}
+
+	for keyword := range keywords {
+		_, ok := supported[keyword]
+		if _, annotation := annotationKeywords[keyword]; !ok && !annotation {
+			return fmt.Errorf("unsupported schema keyword %v", keyword)
+		}
+	}
+
+	type plain Schema
+	if err := json.Unmarshal(data, (*plain)(s)); err != nil {
+		return err
+	}
+
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %v: %w", s.Pattern, err)
+		}
+
+		s.pattern = pattern
+	}
+
+	return nil
+}
+
+// Validate checks a value decoded by encoding/json against the schema.
+func (s *Schema) Validate(value interface{}) error {
+	return s.validate("", value)
+}
+
+func (s *Schema) validate(pointer string, value interface{}) error {
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		return fmt.Errorf("%v: expected %v", location(pointer), strings.Join(s.Type, " or "))
+	}
+
+	if s.Const != nil && !reflect.DeepEqual(*s.Const, value) {
+		return fmt.Errorf("%v: expected %v", location(pointer), *s.Const)
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("%v: value is not one of the allowed values", location(pointer))
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if s.MinLength != nil && len([]rune(v)) < *s.MinLength {
+			return fmt.Errorf("%v: expected at least %v characters", location(pointer), *s.MinLength)
+		}
+
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return fmt.Errorf("%v: does not match %v", location(pointer), s.Pattern)
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fmt.Errorf("%v: expected at least %v items", location(pointer), *s.MinItems)
+		}
+
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(fmt.Sprintf("%v/%v", pointer, i), item); err != nil {
+					return err
+				}
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%v: missing required property %v", location(pointer), name)
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		for _, name := range names {
+			child := pointer + "/" + strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+			if property, ok := s.Properties[name]; ok {
+				if err := property.validate(child, v[name]); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if s.AdditionalProperties == nil {
+				continue
+			}
+
+			if s.AdditionalProperties.schema == nil && !s.AdditionalProperties.allowed {
+				return fmt.Errorf("%v: unexpected property %v", location(pointer), name)
+			}
+
+			if s.AdditionalProperties.schema != nil {
+				if err := s.AdditionalProperties.schema.validate(child, v[name]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func location(pointer string) string {
+	if pointer == "" {
+		return "/"
+	}
+
+	return pointer
+}
+
+// schemaTypes is the type keyword, which may be a single type or a list of types.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings")
+	}
+
+	*t = multiple
+	return nil
+}
+
+func (t schemaTypes) matches(value interface{}) bool {
+	for _, name := range t {
+		switch v := value.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case float64:
+			if name == "number" || (name == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// additional is the additionalProperties keyword, which may be a boolean or a schema.
+type additional struct {
+	allowed bool
+	schema  *Schema
+}
+
+func (a *additional) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.allowed); err == nil {
+		return nil
+	}
+
+	a.schema = &Schema{}
+	return json.Unmarshal(data, a.schema)
+}
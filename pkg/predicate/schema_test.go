@@ -0,0 +1,79 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predicate
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"required": ["name", "tags"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "pattern": "^[a-z]+$"},
+			"count": {"type": "integer"},
+			"kind": {"enum": ["build", "test"]},
+			"version": {"const": 1},
+			"tags": {"type": "array", "minItems": 1, "items": {"type": ["string", "null"]}}
+		}
+	}`))
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		value string
+		err   string
+	}{
+		{`{"name":"a","tags":["x",null],"count":2,"kind":"build","version":1}`, ""},
+		{`[]`, "/: expected object"},
+		{`{"tags":["x"]}`, "missing required property name"},
+		{`{"name":"A","tags":["x"]}`, "/name: does not match"},
+		{`{"name":"","tags":["x"]}`, "/name: expected at least 1 characters"},
+		{`{"name":"a","tags":[]}`, "/tags: expected at least 1 items"},
+		{`{"name":"a","tags":[1]}`, "/tags/0: expected string or null"},
+		{`{"name":"a","tags":["x"],"count":1.5}`, "/count: expected integer"},
+		{`{"name":"a","tags":["x"],"kind":"deploy"}`, "/kind: value is not one of the allowed values"},
+		{`{"name":"a","tags":["x"],"version":2}`, "/version: expected 1"},
+		{`{"name":"a","tags":["x"],"extra":true}`, "unexpected property extra"},
+	} {
+		var value interface{}
+		require.NoError(t, json.Unmarshal([]byte(tc.value), &value))
+		err := schema.Validate(value)
+		if tc.err == "" {
+			require.NoError(t, err, tc.value)
+		} else {
+			require.ErrorContains(t, err, tc.err, tc.value)
+		}
+	}
+}
+
+func TestSchemaAdditionalPropertiesSchema(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{"additionalProperties": {"type": "string"}}`))
+	require.NoError(t, err)
+	require.NoError(t, schema.Validate(map[string]interface{}{"a": "b"}))
+	require.ErrorContains(t, schema.Validate(map[string]interface{}{"a/b": 1.0}), "/a~1b: expected string")
+}
+
+func TestSchemaUnsupportedKeyword(t *testing.T) {
+	_, err := ParseSchema([]byte(`{"type":"object","properties":{"a":{"$ref":"#/$defs/a"}}}`))
+	require.ErrorContains(t, err, "unsupported schema keyword $ref")
+	_, err = ParseSchema([]byte(`{"pattern":"("}`))
+	require.Error(t, err)
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package profile defines named capture profiles that adjust how much data attestors record.
+package profile
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/attestation/environment"
+	"github.com/testifysec/go-witness/attestation/git"
+	"github.com/testifysec/witness/pkg/attestation/cicontext"
+	"github.com/testifysec/witness/pkg/wrap"
+)
+
+const (
+	Minimal  = "minimal"
+	Standard = "standard"
+	Forensic = "forensic"
+)
+
+// Redaction describes data that is removed from an attestor before it is signed.
+type Redaction struct {
+	// Fields are the top level JSON fields removed from the attestation
+	Fields []string
+	// SubjectPrefixes removes any subject whose name begins with one of the prefixes
+	SubjectPrefixes []string
+}
+
+type Profile struct {
+	Name string
+	// Tracing enables tracing of the command being run. Tracing can still be enabled with --trace when the
+	// profile doesn't enable it.
+	Tracing bool
+	// Redactions are keyed by attestor type
+	Redactions map[string]Redaction
+}
+
+var profiles = map[string]Profile{
+	Minimal: {
+		Name: Minimal,
+		Redactions: map[string]Redaction{
+			cicontext.Type: {
+				Fields: []string{"actor"},
+			},
+			commandrun.Type: {
+				Fields: []string{"stdout", "stderr"},
+			},
+			environment.Type: {
+				Fields: []string{"hostname", "username", "variables"},
+			},
+			git.Type: {
+				Fields:          []string{"author", "authoremail", "committername", "committeremail", "commitmessage", "tags"},
+				SubjectPrefixes: []string{"authoremail:", "committeremail:"},
+			},
+		},
+	},
+	Standard: {
+		Name: Standard,
+	},
+	Forensic: {
+		Name:    Forensic,
+		Tracing: true,
+	},
+}
+
+// Get returns the profile with the provided name. An empty name returns the standard profile.
+func Get(name string) (Profile, error) {
+	if name == "" {
+		name = Standard
+	}
+
+	p, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown capture profile %v, must be one of %v", name, Names())
+	}
+
+	return p, nil
+}
+
+func Names() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Apply wraps any attestors the profile redacts data from. Attestors that produce materials or products are
+// never wrapped, because the attestation context relies on their concrete types.
+func (p Profile) Apply(attestors []attestation.Attestor) []attestation.Attestor {
+	applied := make([]attestation.Attestor, 0, len(attestors))
+	for _, attestor := range attestors {
+		redaction, ok := p.Redactions[attestor.Type()]
+		_, isMaterialer := attestor.(attestation.Materialer)
+		_, isProducer := attestor.(attestation.Producer)
+		if !ok || isMaterialer || isProducer {
+			applied = append(applied, attestor)
+			continue
+		}
+
+		applied = append(applied, &redactedAttestor{Forwarder: wrap.Forwarder{Attestor: attestor}, redaction: redaction})
+	}
+
+	return applied
+}
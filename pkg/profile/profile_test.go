@@ -0,0 +1,76 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/git"
+	"github.com/testifysec/go-witness/attestation/product"
+)
+
+func TestGet(t *testing.T) {
+	p, err := Get("")
+	require.NoError(t, err)
+	require.Equal(t, Standard, p.Name)
+
+	_, err = Get("paranoid")
+	require.ErrorContains(t, err, "unknown capture profile")
+}
+
+func TestApplyMinimal(t *testing.T) {
+	p, err := Get(Minimal)
+	require.NoError(t, err)
+
+	g := git.New()
+	g.CommitHash = "abc123"
+	g.AuthorEmail = "dev@example.com"
+	g.CommitterEmail = "dev@example.com"
+	g.CommitMessage = "secret project codename"
+	prod := product.New()
+
+	applied := p.Apply([]attestation.Attestor{prod, g})
+	require.Same(t, prod, applied[0])
+	require.Equal(t, git.Type, applied[1].Type())
+
+	data, err := json.Marshal(applied[1])
+	require.NoError(t, err)
+	fields := make(map[string]json.RawMessage)
+	require.NoError(t, json.Unmarshal(data, &fields))
+	require.Contains(t, fields, "commithash")
+	require.NotContains(t, fields, "authoremail")
+	require.NotContains(t, fields, "commitmessage")
+
+	subjecter, ok := applied[1].(attestation.Subjecter)
+	require.True(t, ok)
+	subjects := subjecter.Subjects()
+	require.Contains(t, subjects, "commithash:abc123")
+	require.NotContains(t, subjects, "authoremail:dev@example.com")
+
+	roundTrip := git.New()
+	require.NoError(t, json.Unmarshal(data, roundTrip))
+	require.Equal(t, "abc123", roundTrip.CommitHash)
+}
+
+func TestApplyStandard(t *testing.T) {
+	p, err := Get(Standard)
+	require.NoError(t, err)
+	g := git.New()
+	applied := p.Apply([]attestation.Attestor{g})
+	require.Same(t, g, applied[0])
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/witness/pkg/wrap"
+)
+
+var (
+	_ attestation.Attestor   = &redactedAttestor{}
+	_ attestation.Subjecter  = &redactedAttestor{}
+	_ attestation.BackReffer = &redactedAttestor{}
+)
+
+// redactedAttestor runs the wrapped attestor as normal and removes redacted fields when it is marshaled into
+// the attestation collection. The attestation keeps the wrapped attestor's type so it can be read back by
+// the original attestor.
+type redactedAttestor struct {
+	wrap.Forwarder
+	redaction Redaction
+}
+
+func (r *redactedAttestor) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(r.Attestor)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for _, field := range r.redaction.Fields {
+		delete(fields, field)
+	}
+
+	return json.Marshal(fields)
+}
+
+func (r *redactedAttestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjecter, ok := r.Attestor.(attestation.Subjecter)
+	if !ok {
+		return map[string]cryptoutil.DigestSet{}
+	}
+
+	return r.filter(subjecter.Subjects())
+}
+
+func (r *redactedAttestor) BackRefs() map[string]cryptoutil.DigestSet {
+	backReffer, ok := r.Attestor.(attestation.BackReffer)
+	if !ok {
+		return map[string]cryptoutil.DigestSet{}
+	}
+
+	return r.filter(backReffer.BackRefs())
+}
+
+func (r *redactedAttestor) filter(subjects map[string]cryptoutil.DigestSet) map[string]cryptoutil.DigestSet {
+	filtered := make(map[string]cryptoutil.DigestSet)
+	for name, digest := range subjects {
+		redacted := false
+		for _, prefix := range r.redaction.SubjectPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				redacted = true
+				break
+			}
+		}
+
+		if !redacted {
+			filtered[name] = digest
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,580 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package registry attaches signed attestations to images in OCI registries as referrer artifacts, so the
+// attestations travel with the images they describe, and reads them back for verification. Registries that don't
+// support the referrers API are given the referrers tag the OCI distribution spec falls back to.
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/testifysec/witness/pkg/oci"
+)
+
+const (
+	dockerHub         = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+
+	// maxManifestSize bounds the manifests read from a registry.
+	maxManifestSize = 4 << 20
+	// maxBlobSize bounds the blobs read from a registry.
+	maxBlobSize = 32 << 20
+	// referrersTagAttempts bounds how often the referrers tag is read and written again when another writer changed
+	// it in between.
+	referrersTagAttempts = 5
+)
+
+// emptyConfig is the config blob of artifact manifests, which have no configuration.
+var emptyConfig = []byte("{}")
+
+var manifestMediaTypes = []string{oci.MediaTypeImageIndex, oci.MediaTypeImageManifest, oci.MediaTypeDockerList, oci.MediaTypeDockerImage}
+
+// Reference selects an image in a registry, such as ghcr.io/org/app:v1 or ghcr.io/org/app@sha256:<digest>.
+// References without a registry refer to Docker Hub, and references without a tag or digest to the latest tag.
+// References with both a tag and a digest select the image by its digest.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+func ParseReference(ref string) (Reference, error) {
+	r := Reference{}
+	name := ref
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name, r.Digest = name[:i], name[i+1:]
+		if !strings.HasPrefix(r.Digest, "sha256:") {
+			return Reference{}, fmt.Errorf("unsupported digest %v in %v", r.Digest, ref)
+		}
+	}
+
+	// a tag alongside a digest, as in app:v1@sha256:<digest>, is dropped since the digest selects the image
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		if r.Digest == "" {
+			r.Tag = name[i+1:]
+		}
+
+		name = name[:i]
+	}
+
+	r.Registry, r.Repository = dockerHub, name
+	if i := strings.Index(name, "/"); i >= 0 {
+		host := name[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			r.Registry, r.Repository = host, name[i+1:]
+		}
+	}
+
+	if r.Repository == "" {
+		return Reference{}, fmt.Errorf("image reference %v has no repository", ref)
+	}
+
+	if r.Registry == dockerHub && !strings.Contains(r.Repository, "/") {
+		r.Repository = "library/" + r.Repository
+	}
+
+	if r.Digest == "" && r.Tag == "" {
+		r.Tag = "latest"
+	}
+
+	return r, nil
+}
+
+func (r Reference) String() string {
+	name := r.Registry + "/" + r.Repository
+	if r.Digest != "" {
+		return name + "@" + r.Digest
+	}
+
+	return name + ":" + r.Tag
+}
+
+// identifier returns the digest or tag the image is looked up by.
+func (r Reference) identifier() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+
+	return r.Tag
+}
+
+type Option func(*Client)
+
+// WithPlainHTTP talks to registries over HTTP rather than HTTPS, for local test registries.
+func WithPlainHTTP(plainHTTP bool) Option {
+	return func(c *Client) {
+		c.plainHTTP = plainHTTP
+	}
+}
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+// Client talks to OCI registries. Credentials are read from the Docker config file, as written by docker login.
+type Client struct {
+	client    *http.Client
+	plainHTTP bool
+	// auth holds the Authorization header of each repository once a registry has challenged for it
+	auth map[string]string
+}
+
+func New(opts ...Option) *Client {
+	c := &Client{
+		client: http.DefaultClient,
+		auth:   make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Resolve returns the descriptor of the image ref refers to.
+func (c *Client) Resolve(ctx context.Context, ref Reference) (oci.Descriptor, error) {
+	data, mediaType, err := c.getManifest(ctx, ref, ref.identifier(), manifestMediaTypes)
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	desc := oci.Descriptor{MediaType: mediaType, Digest: oci.Digest(data), Size: int64(len(data))}
+	if ref.Digest != "" && desc.Digest != ref.Digest {
+		return oci.Descriptor{}, fmt.Errorf("manifest of %v does not match its digest", ref)
+	}
+
+	return desc, nil
+}
+
+// Attach attaches a signed envelope to the image ref refers to as a referrer artifact and returns the descriptor of
+// the artifact's manifest. The manifest is also added to the image's referrers tag if the registry doesn't support
+// the referrers API.
+func (c *Client) Attach(ctx context.Context, ref Reference, envelope []byte) (oci.Descriptor, error) {
+	image, err := c.Resolve(ctx, ref)
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	envelopeDesc, err := c.pushBlob(ctx, ref, oci.MediaTypeDSSE, envelope)
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	configDesc, err := c.pushBlob(ctx, ref, oci.MediaTypeEmpty, emptyConfig)
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	manifest, err := json.Marshal(oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeImageManifest,
+		ArtifactType:  oci.MediaTypeDSSE,
+		Config:        configDesc,
+		Layers:        []oci.Descriptor{envelopeDesc},
+		Subject:       &image,
+	})
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	manifestDesc := oci.Descriptor{
+		MediaType:    oci.MediaTypeImageManifest,
+		Digest:       oci.Digest(manifest),
+		Size:         int64(len(manifest)),
+		ArtifactType: oci.MediaTypeDSSE,
+	}
+
+	resp, err := c.putManifest(ctx, ref, manifestDesc.Digest, oci.MediaTypeImageManifest, manifest, nil)
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	// registries that index referrers acknowledge the subject, others need the referrers tag
+	if resp.Header.Get("OCI-Subject") == "" {
+		if err := c.addToReferrersTag(ctx, ref, image, manifestDesc); err != nil {
+			return oci.Descriptor{}, err
+		}
+	}
+
+	return manifestDesc, nil
+}
+
+// Fetch returns the content of the artifact ref refers to, which is the single layer of its manifest, such as a
+// signed policy pushed with oras push. The content is checked against the layer's digest.
+func (c *Client) Fetch(ctx context.Context, ref Reference) ([]byte, error) {
+	data, _, err := c.getManifest(ctx, ref, ref.identifier(), []string{oci.MediaTypeImageManifest})
+	if err != nil {
+		return nil, err
+	}
+
+	if ref.Digest != "" && oci.Digest(data) != ref.Digest {
+		return nil, fmt.Errorf("manifest of %v does not match its digest", ref)
+	}
+
+	manifest := oci.Manifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest of %v: %w", ref, err)
+	}
+
+	if len(manifest.Layers) != 1 {
+		return nil, fmt.Errorf("artifact %v has %v layers, expected 1", ref, len(manifest.Layers))
+	}
+
+	return c.getBlob(ctx, ref, manifest.Layers[0])
+}
+
+// SubjectDigests returns the sha256 digests the image ref refers to is recorded under by attestors: the digest of
+// its manifest and, for single platform images, the digest of its config, which is the image id. The descriptor of
+// the image's manifest is returned with them.
+func (c *Client) SubjectDigests(ctx context.Context, ref Reference) ([]string, oci.Descriptor, error) {
+	data, mediaType, err := c.getManifest(ctx, ref, ref.identifier(), manifestMediaTypes)
+	if err != nil {
+		return nil, oci.Descriptor{}, err
+	}
+
+	image := oci.Descriptor{MediaType: mediaType, Digest: oci.Digest(data), Size: int64(len(data))}
+	if ref.Digest != "" && image.Digest != ref.Digest {
+		return nil, oci.Descriptor{}, fmt.Errorf("manifest of %v does not match its digest", ref)
+	}
+
+	digests := []string{strings.TrimPrefix(image.Digest, "sha256:")}
+	if mediaType != oci.MediaTypeImageManifest && mediaType != oci.MediaTypeDockerImage {
+		return digests, image, nil
+	}
+
+	manifest := oci.Manifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, oci.Descriptor{}, fmt.Errorf("failed to parse manifest of %v: %w", ref, err)
+	}
+
+	if manifest.Config.Digest != "" {
+		digests = append(digests, strings.TrimPrefix(manifest.Config.Digest, "sha256:"))
+	}
+
+	return digests, image, nil
+}
+
+// Attestations returns the envelopes attached to image in the repository of ref, from the referrers API or, for
+// registries without it, the image's referrers tag.
+func (c *Client) Attestations(ctx context.Context, ref Reference, image oci.Descriptor) ([][]byte, error) {
+	index := oci.Index{}
+	resp, err := c.do(ctx, ref, http.MethodGet, c.url(ref, "referrers/"+image.Digest), http.Header{"Accept": []string{oci.MediaTypeImageIndex}}, nil, http.StatusOK)
+	if err == nil {
+		defer resp.Body.Close()
+		if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&index); err != nil {
+			return nil, fmt.Errorf("failed to parse referrers of %v: %w", image.Digest, err)
+		}
+	} else if isNotFound(err) {
+		data, _, err := c.getManifest(ctx, ref, strings.Replace(image.Digest, ":", "-", 1), []string{oci.MediaTypeImageIndex})
+		if isNotFound(err) {
+			return [][]byte{}, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(data, &index); err != nil {
+			return nil, fmt.Errorf("failed to parse referrers index of %v: %w", image.Digest, err)
+		}
+	} else {
+		return nil, err
+	}
+
+	envelopes := [][]byte{}
+	for _, desc := range index.Manifests {
+		if desc.ArtifactType != oci.MediaTypeDSSE {
+			continue
+		}
+
+		data, _, err := c.getManifest(ctx, ref, desc.Digest, []string{oci.MediaTypeImageManifest})
+		if err != nil {
+			return nil, err
+		}
+
+		manifest := oci.Manifest{}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest %v: %w", desc.Digest, err)
+		}
+
+		if manifest.Subject == nil || manifest.Subject.Digest != image.Digest {
+			continue
+		}
+
+		for _, layer := range manifest.Layers {
+			if layer.MediaType != oci.MediaTypeDSSE {
+				continue
+			}
+
+			envelope, err := c.getBlob(ctx, ref, layer)
+			if err != nil {
+				return nil, err
+			}
+
+			envelopes = append(envelopes, envelope)
+		}
+	}
+
+	return envelopes, nil
+}
+
+// addToReferrersTag adds desc to the index tagged with the digest of image, which registries without the referrers
+// API serve referrers from. The index is replaced only if it hasn't changed since it was read, so referrers attached
+// concurrently aren't lost, and is read again if it has.
+func (c *Client) addToReferrersTag(ctx context.Context, ref Reference, image, desc oci.Descriptor) error {
+	for attempt := 1; ; attempt++ {
+		err := c.updateReferrersTag(ctx, ref, image, desc)
+		if !hasStatus(err, http.StatusPreconditionFailed) || attempt == referrersTagAttempts {
+			return err
+		}
+	}
+}
+
+// updateReferrersTag reads the referrers tag of image and, unless it already lists desc, writes it with desc added
+// on the condition that it is unchanged. Registries tag manifests with their digest as the ETag.
+func (c *Client) updateReferrersTag(ctx context.Context, ref Reference, image, desc oci.Descriptor) error {
+	tag := strings.Replace(image.Digest, ":", "-", 1)
+	index := oci.Index{SchemaVersion: 2, MediaType: oci.MediaTypeImageIndex}
+	condition := http.Header{"If-None-Match": []string{"*"}}
+	data, _, err := c.getManifest(ctx, ref, tag, []string{oci.MediaTypeImageIndex})
+	if err == nil {
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("failed to parse referrers index %v: %w", tag, err)
+		}
+
+		condition = http.Header{"If-Match": []string{fmt.Sprintf("%q", oci.Digest(data))}}
+	} else if !isNotFound(err) {
+		return err
+	}
+
+	for _, existing := range index.Manifests {
+		if existing.Digest == desc.Digest {
+			return nil
+		}
+	}
+
+	index.Manifests = append(index.Manifests, desc)
+	if data, err = json.Marshal(index); err != nil {
+		return err
+	}
+
+	_, err = c.putManifest(ctx, ref, tag, oci.MediaTypeImageIndex, data, condition)
+	return err
+}
+
+func (c *Client) getManifest(ctx context.Context, ref Reference, identifier string, accept []string) ([]byte, string, error) {
+	header := http.Header{"Accept": []string{strings.Join(accept, ", ")}}
+	resp, err := c.do(ctx, ref, http.MethodGet, c.url(ref, "manifests/"+identifier), header, nil, http.StatusOK)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(data) > maxManifestSize {
+		return nil, "", fmt.Errorf("manifest %v of %v is larger than %v bytes", identifier, ref.Repository, maxManifestSize)
+	}
+
+	mediaType := resp.Header.Get("Content-Type")
+	if mediaType == "" {
+		manifest := struct {
+			MediaType string `json:"mediaType"`
+		}{}
+
+		if err := json.Unmarshal(data, &manifest); err == nil {
+			mediaType = manifest.MediaType
+		}
+	}
+
+	return data, mediaType, nil
+}
+
+// getBlob reads the blob desc describes, checking it against its digest.
+func (c *Client) getBlob(ctx context.Context, ref Reference, desc oci.Descriptor) ([]byte, error) {
+	if desc.Size > maxBlobSize {
+		return nil, fmt.Errorf("blob %v of %v is larger than %v bytes", desc.Digest, ref.Repository, maxBlobSize)
+	}
+
+	resp, err := c.do(ctx, ref, http.MethodGet, c.url(ref, "blobs/"+desc.Digest), nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	blob, err := io.ReadAll(io.LimitReader(resp.Body, maxBlobSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if oci.Digest(blob) != desc.Digest {
+		return nil, fmt.Errorf("blob %v of %v does not match its digest", desc.Digest, ref.Repository)
+	}
+
+	return blob, nil
+}
+
+// putManifest pushes a manifest under identifier. The headers of condition, such as If-Match, are sent with it.
+func (c *Client) putManifest(ctx context.Context, ref Reference, identifier, mediaType string, data []byte, condition http.Header) (*http.Response, error) {
+	header := http.Header{"Content-Type": []string{mediaType}}
+	for key, values := range condition {
+		header[key] = values
+	}
+
+	resp, err := c.do(ctx, ref, http.MethodPut, c.url(ref, "manifests/"+identifier), header, data, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body.Close()
+	return resp, nil
+}
+
+// pushBlob uploads data in a single request, unless the repository already has it.
+func (c *Client) pushBlob(ctx context.Context, ref Reference, mediaType string, data []byte) (oci.Descriptor, error) {
+	desc := oci.Descriptor{MediaType: mediaType, Digest: oci.Digest(data), Size: int64(len(data))}
+	if resp, err := c.do(ctx, ref, http.MethodHead, c.url(ref, "blobs/"+desc.Digest), nil, nil, http.StatusOK); err == nil {
+		resp.Body.Close()
+		return desc, nil
+	} else if !isNotFound(err) {
+		return oci.Descriptor{}, err
+	}
+
+	resp, err := c.do(ctx, ref, http.MethodPost, c.url(ref, "blobs/uploads/"), nil, nil, http.StatusAccepted)
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	resp.Body.Close()
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return oci.Descriptor{}, fmt.Errorf("invalid upload location: %w", err)
+	}
+
+	query := location.Query()
+	query.Set("digest", desc.Digest)
+	location.RawQuery = query.Encode()
+	header := http.Header{"Content-Type": []string{"application/octet-stream"}}
+	if resp, err = c.do(ctx, ref, http.MethodPut, location.String(), header, data, http.StatusCreated); err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	resp.Body.Close()
+	return desc, nil
+}
+
+func (c *Client) url(ref Reference, path string) string {
+	scheme := "https"
+	if c.plainHTTP {
+		scheme = "http"
+	}
+
+	host := ref.Registry
+	if host == dockerHub {
+		host = dockerHubRegistry
+	}
+
+	return fmt.Sprintf("%v://%v/v2/%v/%v", scheme, host, ref.Repository, path)
+}
+
+// statusError is returned for responses with an unexpected status.
+type statusError struct {
+	method string
+	url    string
+	status int
+	body   string
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("%v %v: unexpected status %v: %v", e.method, e.url, e.status, e.body)
+}
+
+func isNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+func hasStatus(err error, status int) bool {
+	statusErr, ok := err.(statusError)
+	return ok && statusErr.status == status
+}
+
+// do sends a request to the registry, authorizing and retrying it once if the registry challenges for credentials.
+// Responses other than expected are returned as a statusError.
+func (c *Client) do(ctx context.Context, ref Reference, method, rawURL string, header http.Header, body []byte, expected int) (*http.Response, error) {
+	scope := ref.Registry + "/" + ref.Repository
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		for key, values := range header {
+			req.Header[key] = values
+		}
+
+		if auth, ok := c.auth[scope]; ok {
+			req.Header.Set("Authorization", auth)
+		}
+
+		return c.client.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		if c.auth[scope], err = c.authorize(ctx, ref, resp.Header.Get("WWW-Authenticate")); err != nil {
+			return nil, fmt.Errorf("failed to authenticate to %v: %w", ref.Registry, err)
+		}
+
+		if resp, err = send(); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != expected {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, statusError{method: method, url: redact(rawURL), status: resp.StatusCode, body: strings.TrimSpace(string(data))}
+	}
+
+	return resp, nil
+}
+
+// redact removes the query of upload locations, which may carry upload state, from errors.
+func redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	u.RawQuery = ""
+	return u.String()
+}
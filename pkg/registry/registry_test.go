@@ -0,0 +1,306 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/witness/pkg/oci"
+)
+
+// fakeRegistry serves the parts of the OCI distribution API witness uses for a single repository.
+type fakeRegistry struct {
+	mu        sync.Mutex
+	referrers bool
+	token     string
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	types     map[string]string
+	// beforePut is called once, before the next manifest is pushed, to stand in for another writer
+	beforePut func(f *fakeRegistry)
+}
+
+func newFakeRegistry(referrers bool) *fakeRegistry {
+	return &fakeRegistry{referrers: referrers, blobs: map[string][]byte{}, manifests: map[string][]byte{}, types: map[string]string{}}
+}
+
+func (f *fakeRegistry) putImage(tag string) oci.Descriptor {
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{},"layers":[]}`)
+	desc := oci.Descriptor{MediaType: oci.MediaTypeImageManifest, Digest: oci.Digest(manifest), Size: int64(len(manifest))}
+	f.manifests[tag], f.manifests[desc.Digest] = manifest, manifest
+	f.types[tag], f.types[desc.Digest] = desc.MediaType, desc.MediaType
+	return desc
+}
+
+// putArtifact tags an artifact whose single layer is content, as oras push does.
+func (f *fakeRegistry) putArtifact(tag string, content []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	layer := oci.Descriptor{MediaType: oci.MediaTypeDSSE, Digest: oci.Digest(content), Size: int64(len(content))}
+	manifest, _ := json.Marshal(oci.Manifest{SchemaVersion: 2, MediaType: oci.MediaTypeImageManifest, Config: oci.Descriptor{MediaType: oci.MediaTypeEmpty}, Layers: []oci.Descriptor{layer}})
+	f.blobs[layer.Digest] = content
+	f.manifests[tag] = manifest
+	f.types[tag] = oci.MediaTypeImageManifest
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/token" {
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": f.token})
+		return
+	}
+
+	if f.token != "" && r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%v/token",service="fake"`, r.Host))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/app/")
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case strings.HasPrefix(path, "referrers/") && r.Method == http.MethodGet && f.referrers:
+		index := oci.Index{SchemaVersion: 2, MediaType: oci.MediaTypeImageIndex, Manifests: []oci.Descriptor{}}
+		for identifier, data := range f.manifests {
+			manifest := oci.Manifest{}
+			if identifier != oci.Digest(data) || json.Unmarshal(data, &manifest) != nil || manifest.Subject == nil {
+				continue
+			}
+
+			if manifest.Subject.Digest == strings.TrimPrefix(path, "referrers/") {
+				index.Manifests = append(index.Manifests, oci.Descriptor{MediaType: oci.MediaTypeImageManifest, Digest: identifier, Size: int64(len(data)), ArtifactType: manifest.ArtifactType})
+			}
+		}
+
+		w.Header().Set("Content-Type", oci.MediaTypeImageIndex)
+		_ = json.NewEncoder(w).Encode(index)
+	case strings.HasPrefix(path, "manifests/") && r.Method == http.MethodGet:
+		manifest, ok := f.manifests[strings.TrimPrefix(path, "manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", f.types[strings.TrimPrefix(path, "manifests/")])
+		_, _ = w.Write(manifest)
+	case strings.HasPrefix(path, "manifests/") && r.Method == http.MethodPut:
+		identifier := strings.TrimPrefix(path, "manifests/")
+		if beforePut := f.beforePut; beforePut != nil {
+			f.beforePut = nil
+			beforePut(f)
+		}
+
+		existing, ok := f.manifests[identifier]
+		if match := r.Header.Get("If-Match"); (match != "" && (!ok || match != fmt.Sprintf("%q", oci.Digest(existing)))) || (r.Header.Get("If-None-Match") == "*" && ok) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		f.manifests[identifier], f.manifests[oci.Digest(body)] = body, body
+		f.types[identifier], f.types[oci.Digest(body)] = r.Header.Get("Content-Type"), r.Header.Get("Content-Type")
+		manifest := oci.Manifest{}
+		if f.referrers && json.Unmarshal(body, &manifest) == nil && manifest.Subject != nil {
+			w.Header().Set("OCI-Subject", manifest.Subject.Digest)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, "blobs/uploads/") && r.Method == http.MethodPost:
+		w.Header().Set("Location", "/v2/app/blobs/uploads/session?state=1")
+		w.WriteHeader(http.StatusAccepted)
+	case strings.HasPrefix(path, "blobs/uploads/") && r.Method == http.MethodPut:
+		digest := r.URL.Query().Get("digest")
+		if digest != oci.Digest(body) || r.URL.Query().Get("state") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		f.blobs[digest] = body
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(path, "blobs/") && r.Method == http.MethodHead:
+		if _, ok := f.blobs[strings.TrimPrefix(path, "blobs/")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case strings.HasPrefix(path, "blobs/") && r.Method == http.MethodGet:
+		blob, ok := f.blobs[strings.TrimPrefix(path, "blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write(blob)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	ref, err := ParseReference("localhost:5000/org/app:v1")
+	require.NoError(t, err)
+	require.Equal(t, Reference{Registry: "localhost:5000", Repository: "org/app", Tag: "v1"}, ref)
+
+	ref, err = ParseReference("alpine")
+	require.NoError(t, err)
+	require.Equal(t, Reference{Registry: "docker.io", Repository: "library/alpine", Tag: "latest"}, ref)
+
+	ref, err = ParseReference("ghcr.io/org/app@sha256:abcd")
+	require.NoError(t, err)
+	require.Equal(t, "ghcr.io/org/app@sha256:abcd", ref.String())
+
+	ref, err = ParseReference("localhost:5000/org/app:v1@sha256:abcd")
+	require.NoError(t, err)
+	require.Equal(t, Reference{Registry: "localhost:5000", Repository: "org/app", Digest: "sha256:abcd"}, ref)
+
+	_, err = ParseReference("ghcr.io/org/app@md5:abcd")
+	require.Error(t, err)
+}
+
+func TestAttach(t *testing.T) {
+	for _, referrers := range []bool{true, false} {
+		t.Run(fmt.Sprintf("referrers=%v", referrers), func(t *testing.T) {
+			registry := newFakeRegistry(referrers)
+			registry.token = "secret"
+			image := registry.putImage("v1")
+			server := httptest.NewServer(registry)
+			defer server.Close()
+
+			ref, err := ParseReference(strings.TrimPrefix(server.URL, "http://") + "/app:v1")
+			require.NoError(t, err)
+			client := New(WithPlainHTTP(true))
+			envelope := []byte(`{"payloadType":"application/vnd.in-toto+json"}`)
+			desc, err := client.Attach(context.Background(), ref, envelope)
+			require.NoError(t, err)
+			require.Equal(t, oci.MediaTypeDSSE, desc.ArtifactType)
+			require.Equal(t, envelope, registry.blobs[oci.Digest(envelope)])
+
+			manifest := oci.Manifest{}
+			require.NoError(t, json.Unmarshal(registry.manifests[desc.Digest], &manifest))
+			require.Equal(t, image.Digest, manifest.Subject.Digest)
+
+			// attaching again doesn't list the artifact twice
+			_, err = client.Attach(context.Background(), ref, envelope)
+			require.NoError(t, err)
+			tagged, ok := registry.manifests[strings.Replace(image.Digest, ":", "-", 1)]
+			require.Equal(t, !referrers, ok)
+			if !referrers {
+				index := oci.Index{}
+				require.NoError(t, json.Unmarshal(tagged, &index))
+				require.Len(t, index.Manifests, 1)
+				require.Equal(t, desc.Digest, index.Manifests[0].Digest)
+			}
+		})
+	}
+}
+
+func TestAttachConcurrentReferrer(t *testing.T) {
+	registry := newFakeRegistry(false)
+	image := registry.putImage("v1")
+	tag := strings.Replace(image.Digest, ":", "-", 1)
+	other := oci.Descriptor{MediaType: oci.MediaTypeImageManifest, Digest: oci.Digest([]byte("other")), ArtifactType: oci.MediaTypeDSSE}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	ref, err := ParseReference(strings.TrimPrefix(server.URL, "http://") + "/app:v1")
+	require.NoError(t, err)
+	client := New(WithPlainHTTP(true))
+	envelope := []byte(`{"payloadType":"application/vnd.in-toto+json"}`)
+	// another writer creates the referrers tag after it is read and before it is written
+	registry.beforePut = func(f *fakeRegistry) {
+		f.beforePut = func(f *fakeRegistry) {
+			f.manifests[tag], _ = json.Marshal(oci.Index{SchemaVersion: 2, MediaType: oci.MediaTypeImageIndex, Manifests: []oci.Descriptor{other}})
+			f.types[tag] = oci.MediaTypeImageIndex
+		}
+	}
+
+	desc, err := client.Attach(context.Background(), ref, envelope)
+	require.NoError(t, err)
+	index := oci.Index{}
+	require.NoError(t, json.Unmarshal(registry.manifests[tag], &index))
+	require.Equal(t, []string{other.Digest, desc.Digest}, []string{index.Manifests[0].Digest, index.Manifests[1].Digest})
+}
+
+func TestAttachMissingImage(t *testing.T) {
+	server := httptest.NewServer(newFakeRegistry(true))
+	defer server.Close()
+	ref, err := ParseReference(strings.TrimPrefix(server.URL, "http://") + "/app:missing")
+	require.NoError(t, err)
+	_, err = New(WithPlainHTTP(true)).Attach(context.Background(), ref, []byte("{}"))
+	require.Error(t, err)
+}
+
+func TestFetch(t *testing.T) {
+	registry := newFakeRegistry(true)
+	registry.token = "secret"
+	registry.putArtifact("prod", []byte(`{"payloadType":"https://witness.testifysec.com/policy/v0.1"}`))
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	ref, err := ParseReference(strings.TrimPrefix(server.URL, "http://") + "/app:prod")
+	require.NoError(t, err)
+	client := New(WithPlainHTTP(true))
+	content, err := client.Fetch(context.Background(), ref)
+	require.NoError(t, err)
+	require.Equal(t, `{"payloadType":"https://witness.testifysec.com/policy/v0.1"}`, string(content))
+
+	// moving the tag changes what is fetched
+	registry.putArtifact("prod", []byte(`{}`))
+	content, err = client.Fetch(context.Background(), ref)
+	require.NoError(t, err)
+	require.Equal(t, `{}`, string(content))
+
+	registry.putImage("image")
+	ref.Tag = "image"
+	_, err = client.Fetch(context.Background(), ref)
+	require.ErrorContains(t, err, "has 0 layers")
+}
+
+func TestAttestations(t *testing.T) {
+	for _, referrers := range []bool{true, false} {
+		t.Run(fmt.Sprintf("referrers=%v", referrers), func(t *testing.T) {
+			registry := newFakeRegistry(referrers)
+			image := registry.putImage("v1")
+			server := httptest.NewServer(registry)
+			defer server.Close()
+
+			ref, err := ParseReference(strings.TrimPrefix(server.URL, "http://") + "/app:v1")
+			require.NoError(t, err)
+			client := New(WithPlainHTTP(true))
+			digests, desc, err := client.SubjectDigests(context.Background(), ref)
+			require.NoError(t, err)
+			require.Equal(t, image.Digest, desc.Digest)
+			require.Equal(t, []string{strings.TrimPrefix(image.Digest, "sha256:")}, digests)
+
+			attached, err := client.Attestations(context.Background(), ref, desc)
+			require.NoError(t, err)
+			require.Empty(t, attached)
+
+			envelope := []byte(`{"payloadType":"application/vnd.in-toto+json"}`)
+			_, err = client.Attach(context.Background(), ref, envelope)
+			require.NoError(t, err)
+			attached, err = client.Attestations(context.Background(), ref, desc)
+			require.NoError(t, err)
+			require.Equal(t, [][]byte{envelope}, attached)
+		})
+	}
+}
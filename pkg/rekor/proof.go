@@ -0,0 +1,271 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rekor
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/witness/pkg/bundle"
+)
+
+// Verify checks that the entry logs env and that the log with logKey promised to include it. The inclusion proof is
+// also checked if the entry has one.
+func (e Entry) Verify(env dsse.Envelope, logKey crypto.PublicKey) error {
+	if err := e.VerifyEnvelope(env); err != nil {
+		return err
+	}
+
+	logID, err := LogID(logKey)
+	if err != nil {
+		return err
+	}
+
+	if e.LogID != logID {
+		return fmt.Errorf("entry was logged by log %v, not %v", e.LogID, logID)
+	}
+
+	if err := e.VerifySignedEntryTimestamp(logKey); err != nil {
+		return err
+	}
+
+	if e.InclusionProof == nil {
+		return nil
+	}
+
+	return e.VerifyInclusion()
+}
+
+// VerifyLogged checks that the Sigstore bundle in data carries an entry that logs its envelope in the log with logKey.
+func VerifyLogged(data []byte, logKey crypto.PublicKey) error {
+	env, err := bundle.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	tlogEntries, err := bundle.TlogEntries(data)
+	if err != nil {
+		return err
+	}
+
+	if len(tlogEntries) == 0 {
+		return errors.New("envelope has no transparency log entry, it must be a sigstore bundle written by witness run --rekor-server")
+	}
+
+	errs := make([]string, 0, len(tlogEntries))
+	for _, tlogEntry := range tlogEntries {
+		entry, err := ParseTransparencyLogEntry(tlogEntry)
+		if err == nil {
+			err = entry.Verify(env, logKey)
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		errs = append(errs, err.Error())
+	}
+
+	return fmt.Errorf("no transparency log entry of the envelope verifies: %v", strings.Join(errs, "; "))
+}
+
+// VerifyEnvelope checks that the entry's body is a dsse entry of env: its payload hash is the hash of env's payload,
+// and it holds every signature of env.
+func (e Entry) VerifyEnvelope(env dsse.Envelope) error {
+	body := struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			PayloadHash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"payloadHash"`
+			Signatures []struct {
+				Signature string `json:"signature"`
+			} `json:"signatures"`
+		} `json:"spec"`
+	}{}
+
+	if err := json.Unmarshal(e.Body, &body); err != nil {
+		return fmt.Errorf("failed to parse entry body: %w", err)
+	}
+
+	if body.Kind != Kind {
+		return fmt.Errorf("entry is a %v entry, not %v", body.Kind, Kind)
+	}
+
+	payloadHash := sha256.Sum256(env.Payload)
+	if body.Spec.PayloadHash.Algorithm != "sha256" || body.Spec.PayloadHash.Value != hex.EncodeToString(payloadHash[:]) {
+		return errors.New("entry does not log the envelope's payload")
+	}
+
+	logged := make(map[string]bool, len(body.Spec.Signatures))
+	for _, sig := range body.Spec.Signatures {
+		logged[sig.Signature] = true
+	}
+
+	if len(env.Signatures) == 0 {
+		return errors.New("envelope has no signatures")
+	}
+
+	for _, sig := range env.Signatures {
+		if !logged[base64.StdEncoding.EncodeToString(sig.Signature)] {
+			return fmt.Errorf("entry does not log the envelope's signature by %v", sig.KeyID)
+		}
+	}
+
+	return nil
+}
+
+// LogID returns the id of the log whose key is logKey, the hex encoded SHA-256 hash of the key's DER encoding.
+func LogID(logKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(logKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode rekor key: %w", err)
+	}
+
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ParsePublicKey parses the PEM encoded public key of a log, as served by its /api/v1/log/publicKey endpoint.
+func ParsePublicKey(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("rekor key is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rekor key: %w", err)
+	}
+
+	if _, ok := key.(*ecdsa.PublicKey); !ok {
+		return nil, fmt.Errorf("unsupported rekor key type %T", key)
+	}
+
+	return key, nil
+}
+
+// VerifyInclusion checks that the entry's inclusion proof leads from the hash of its body to the proof's root hash,
+// as described by RFC 6962, and that its UUID is the hash of its body.
+func (e Entry) VerifyInclusion() error {
+	proof := e.InclusionProof
+	if proof == nil {
+		return errors.New("entry has no inclusion proof")
+	}
+
+	leaf := hashLeaf(e.Body)
+	// UUIDs of sharded logs are prefixed with the id of the tree the entry is in
+	if !strings.HasSuffix(e.UUID, hex.EncodeToString(leaf)) {
+		return fmt.Errorf("entry %v is not the hash of its body", e.UUID)
+	}
+
+	if proof.LogIndex < 0 || proof.LogIndex >= proof.TreeSize {
+		return fmt.Errorf("proof index %v is outside of a tree of size %v", proof.LogIndex, proof.TreeSize)
+	}
+
+	root, err := hex.DecodeString(proof.RootHash)
+	if err != nil {
+		return fmt.Errorf("invalid root hash: %w", err)
+	}
+
+	fn, sn := proof.LogIndex, proof.TreeSize-1
+	hash := leaf
+	for _, encoded := range proof.Hashes {
+		sibling, err := hex.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("invalid proof hash: %w", err)
+		}
+
+		if sn == 0 {
+			return errors.New("inclusion proof is longer than the tree is deep")
+		}
+
+		if fn%2 == 1 || fn == sn {
+			hash = hashChildren(sibling, hash)
+			for fn%2 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			hash = hashChildren(hash, sibling)
+		}
+
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(hash, root) {
+		return errors.New("inclusion proof does not lead to the root hash")
+	}
+
+	return nil
+}
+
+// VerifySignedEntryTimestamp checks the log's promise to include the entry, which is signed by the log's key over
+// the entry's body, integrated time, log id, and index.
+func (e Entry) VerifySignedEntryTimestamp(logKey crypto.PublicKey) error {
+	payload, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{base64.StdEncoding.EncodeToString(e.Body), e.IntegratedTime, e.LogID, e.LogIndex})
+	if err != nil {
+		return err
+	}
+
+	key, ok := logKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("unsupported rekor key type %T", logKey)
+	}
+
+	digest := sha256.Sum256(payload)
+	if !ecdsa.VerifyASN1(key, digest[:], e.SignedEntryTimestamp) {
+		return errors.New("signed entry timestamp does not verify")
+	}
+
+	return nil
+}
+
+func hashLeaf(data []byte) []byte {
+	sum := sha256.Sum256(append([]byte{0}, data...))
+	return sum[:]
+}
+
+func hashChildren(left, right []byte) []byte {
+	sum := sha256.Sum256(append(append([]byte{1}, left...), right...))
+	return sum[:]
+}
+
+func hexToBase64(encoded string) (string, error) {
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(decoded), nil
+}
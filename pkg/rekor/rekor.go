@@ -0,0 +1,324 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rekor uploads signed envelopes to a Rekor transparency log as dsse entries and checks the inclusion
+// proofs and signed entry timestamps the log returns, so anyone can later show an attestation was publicly logged.
+package rekor
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+)
+
+const (
+	entriesPath = "/api/v1/log/entries"
+
+	Kind    = "dsse"
+	Version = "0.0.1"
+
+	// maxResponseSize bounds the responses read from Rekor.
+	maxResponseSize = 4 << 20
+)
+
+// Entry is an entry of the transparency log.
+type Entry struct {
+	UUID           string
+	LogIndex       int64
+	LogID          string
+	IntegratedTime int64
+	// Body is the canonicalized entry the log hashed into its tree.
+	Body                 []byte
+	SignedEntryTimestamp []byte
+	InclusionProof       *InclusionProof
+}
+
+// InclusionProof shows an entry is in the log's Merkle tree at the time of the checkpoint. Hashes are hex encoded.
+type InclusionProof struct {
+	LogIndex   int64    `json:"logIndex"`
+	TreeSize   int64    `json:"treeSize"`
+	RootHash   string   `json:"rootHash"`
+	Hashes     []string `json:"hashes"`
+	Checkpoint string   `json:"checkpoint"`
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+type Client struct {
+	url    string
+	client *http.Client
+}
+
+// New returns a client for the Rekor instance at url, such as https://rekor.sigstore.dev.
+func New(url string, opts ...Option) *Client {
+	c := &Client{url: strings.TrimSuffix(url, "/"), client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Upload logs env as a dsse entry. verifiers are the public keys or certificates of the envelope's signers, which
+// Rekor checks the signatures against. An envelope that is already logged returns its existing entry.
+func (c *Client) Upload(ctx context.Context, env dsse.Envelope, verifiers []cryptoutil.Verifier) (Entry, error) {
+	envelope, err := json.Marshal(&env)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	encodedVerifiers := make([][]byte, 0, len(verifiers))
+	for _, verifier := range verifiers {
+		pemBytes, err := verifier.Bytes()
+		if err != nil {
+			return Entry{}, fmt.Errorf("failed to encode verifier: %w", err)
+		}
+
+		encodedVerifiers = append(encodedVerifiers, pemBytes)
+	}
+
+	proposed := map[string]interface{}{
+		"apiVersion": Version,
+		"kind":       Kind,
+		"spec": map[string]interface{}{
+			"proposedContent": map[string]interface{}{
+				"envelope":  string(envelope),
+				"verifiers": encodedVerifiers,
+			},
+		},
+	}
+
+	body, err := json.Marshal(proposed)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+entriesPath, bytes.NewReader(body))
+	if err != nil {
+		return Entry{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return readEntry(resp.Body)
+	case http.StatusConflict:
+		// the entry exists, and its location is where it can be read
+		location := resp.Header.Get("Location")
+		if location == "" {
+			return Entry{}, errors.New("rekor reported the entry exists without its location")
+		}
+
+		return c.get(ctx, location)
+	default:
+		return Entry{}, statusError(resp)
+	}
+}
+
+func (c *Client) get(ctx context.Context, location string) (Entry, error) {
+	if strings.HasPrefix(location, "/") {
+		location = c.url + location
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Entry{}, statusError(resp)
+	}
+
+	return readEntry(resp.Body)
+}
+
+func statusError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("rekor returned %v: %v", resp.Status, strings.TrimSpace(string(data)))
+}
+
+// readEntry reads the single entry of a response, which Rekor keys by the entry's UUID.
+func readEntry(r io.Reader) (Entry, error) {
+	entries := make(map[string]struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+		Verification   struct {
+			InclusionProof       *InclusionProof `json:"inclusionProof"`
+			SignedEntryTimestamp []byte          `json:"signedEntryTimestamp"`
+		} `json:"verification"`
+	})
+
+	if err := json.NewDecoder(io.LimitReader(r, maxResponseSize)).Decode(&entries); err != nil {
+		return Entry{}, fmt.Errorf("failed to parse rekor entry: %w", err)
+	}
+
+	if len(entries) != 1 {
+		return Entry{}, fmt.Errorf("rekor returned %v entries, expected one", len(entries))
+	}
+
+	for uuid, logged := range entries {
+		body, err := base64.StdEncoding.DecodeString(logged.Body)
+		if err != nil {
+			return Entry{}, fmt.Errorf("failed to decode entry body: %w", err)
+		}
+
+		return Entry{
+			UUID:                 uuid,
+			LogIndex:             logged.LogIndex,
+			LogID:                logged.LogID,
+			IntegratedTime:       logged.IntegratedTime,
+			Body:                 body,
+			SignedEntryTimestamp: logged.Verification.SignedEntryTimestamp,
+			InclusionProof:       logged.Verification.InclusionProof,
+		}, nil
+	}
+
+	return Entry{}, errors.New("unreachable")
+}
+
+// ParseTransparencyLogEntry parses an entry encoded as the TransparencyLogEntry of a Sigstore bundle.
+func ParseTransparencyLogEntry(data []byte) (Entry, error) {
+	encoded := struct {
+		LogIndex string `json:"logIndex"`
+		LogID    struct {
+			KeyID []byte `json:"keyId"`
+		} `json:"logId"`
+		IntegratedTime   string `json:"integratedTime"`
+		InclusionPromise struct {
+			SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+		} `json:"inclusionPromise"`
+		CanonicalizedBody []byte `json:"canonicalizedBody"`
+		InclusionProof    *struct {
+			LogIndex   string   `json:"logIndex"`
+			RootHash   []byte   `json:"rootHash"`
+			TreeSize   string   `json:"treeSize"`
+			Hashes     [][]byte `json:"hashes"`
+			Checkpoint struct {
+				Envelope string `json:"envelope"`
+			} `json:"checkpoint"`
+		} `json:"inclusionProof"`
+	}{}
+
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return Entry{}, fmt.Errorf("failed to parse transparency log entry: %w", err)
+	}
+
+	e := Entry{
+		UUID:                 hex.EncodeToString(hashLeaf(encoded.CanonicalizedBody)),
+		LogID:                hex.EncodeToString(encoded.LogID.KeyID),
+		Body:                 encoded.CanonicalizedBody,
+		SignedEntryTimestamp: encoded.InclusionPromise.SignedEntryTimestamp,
+	}
+
+	var err error
+	if e.LogIndex, err = strconv.ParseInt(encoded.LogIndex, 10, 64); err != nil {
+		return Entry{}, fmt.Errorf("invalid log index: %w", err)
+	}
+
+	if e.IntegratedTime, err = strconv.ParseInt(encoded.IntegratedTime, 10, 64); err != nil {
+		return Entry{}, fmt.Errorf("invalid integrated time: %w", err)
+	}
+
+	if proof := encoded.InclusionProof; proof != nil {
+		e.InclusionProof = &InclusionProof{RootHash: hex.EncodeToString(proof.RootHash), Checkpoint: proof.Checkpoint.Envelope}
+		if e.InclusionProof.LogIndex, err = strconv.ParseInt(proof.LogIndex, 10, 64); err != nil {
+			return Entry{}, fmt.Errorf("invalid proof log index: %w", err)
+		}
+
+		if e.InclusionProof.TreeSize, err = strconv.ParseInt(proof.TreeSize, 10, 64); err != nil {
+			return Entry{}, fmt.Errorf("invalid proof tree size: %w", err)
+		}
+
+		for _, hash := range proof.Hashes {
+			e.InclusionProof.Hashes = append(e.InclusionProof.Hashes, hex.EncodeToString(hash))
+		}
+	}
+
+	return e, nil
+}
+
+// TransparencyLogEntry encodes the entry as the TransparencyLogEntry of a Sigstore bundle.
+func (e Entry) TransparencyLogEntry() (json.RawMessage, error) {
+	logID, err := hexToBase64(e.LogID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log id: %w", err)
+	}
+
+	entry := map[string]interface{}{
+		"logIndex":          strconv.FormatInt(e.LogIndex, 10),
+		"logId":             map[string]string{"keyId": logID},
+		"kindVersion":       map[string]string{"kind": Kind, "version": Version},
+		"integratedTime":    strconv.FormatInt(e.IntegratedTime, 10),
+		"inclusionPromise":  map[string][]byte{"signedEntryTimestamp": e.SignedEntryTimestamp},
+		"canonicalizedBody": e.Body,
+	}
+
+	if e.InclusionProof != nil {
+		rootHash, err := hexToBase64(e.InclusionProof.RootHash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid root hash: %w", err)
+		}
+
+		hashes := make([]string, 0, len(e.InclusionProof.Hashes))
+		for _, hash := range e.InclusionProof.Hashes {
+			encoded, err := hexToBase64(hash)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proof hash: %w", err)
+			}
+
+			hashes = append(hashes, encoded)
+		}
+
+		entry["inclusionProof"] = map[string]interface{}{
+			"logIndex":   strconv.FormatInt(e.InclusionProof.LogIndex, 10),
+			"rootHash":   rootHash,
+			"treeSize":   strconv.FormatInt(e.InclusionProof.TreeSize, 10),
+			"hashes":     hashes,
+			"checkpoint": map[string]string{"envelope": e.InclusionProof.Checkpoint},
+		}
+	}
+
+	return json.Marshal(entry)
+}
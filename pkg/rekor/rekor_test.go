@@ -0,0 +1,399 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rekor
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/witness/pkg/bundle"
+)
+
+// fakeLog is a Rekor instance whose tree starts with some unrelated entries.
+type fakeLog struct {
+	t      *testing.T
+	mu     sync.Mutex
+	key    *ecdsa.PrivateKey
+	leaves [][]byte
+	uuids  map[string]int
+}
+
+func newFakeLog(t *testing.T) *fakeLog {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	f := &fakeLog{t: t, key: key, uuids: map[string]int{}}
+	for i := 0; i < 6; i++ {
+		f.leaves = append(f.leaves, []byte(fmt.Sprintf("entry %v", i)))
+	}
+
+	return f
+}
+
+// path is the RFC 6962 audit path of leaf m in leaves.
+func path(m int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+
+	k := 1
+	for k<<1 < len(leaves) {
+		k <<= 1
+	}
+
+	if m < k {
+		return append(path(m, leaves[:k]), root(leaves[k:]))
+	}
+
+	return append(path(m-k, leaves[k:]), root(leaves[:k]))
+}
+
+func root(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return hashLeaf(leaves[0])
+	}
+
+	k := 1
+	for k<<1 < len(leaves) {
+		k <<= 1
+	}
+
+	return hashChildren(root(leaves[:k]), root(leaves[k:]))
+}
+
+func (f *fakeLog) entry(index int) map[string]interface{} {
+	logID, err := LogID(&f.key.PublicKey)
+	require.NoError(f.t, err)
+	body := base64.StdEncoding.EncodeToString(f.leaves[index])
+	set, err := json.Marshal(map[string]interface{}{
+		"body":           body,
+		"integratedTime": 1700000000,
+		"logID":          logID,
+		"logIndex":       index,
+	})
+	require.NoError(f.t, err)
+	digest := sha256.Sum256(set)
+	sig, err := ecdsa.SignASN1(rand.Reader, f.key, digest[:])
+	require.NoError(f.t, err)
+
+	hashes := []string{}
+	for _, hash := range path(index, f.leaves) {
+		hashes = append(hashes, hex.EncodeToString(hash))
+	}
+
+	return map[string]interface{}{
+		hex.EncodeToString(hashLeaf(f.leaves[index])): map[string]interface{}{
+			"body":           body,
+			"integratedTime": 1700000000,
+			"logID":          logID,
+			"logIndex":       index,
+			"verification": map[string]interface{}{
+				"signedEntryTimestamp": sig,
+				"inclusionProof": map[string]interface{}{
+					"logIndex":   index,
+					"treeSize":   len(f.leaves),
+					"rootHash":   hex.EncodeToString(root(f.leaves)),
+					"hashes":     hashes,
+					"checkpoint": "rekor.fake - 1\n",
+				},
+			},
+		},
+	}
+}
+
+// body is the canonicalized dsse entry Rekor logs for an envelope and its verifiers.
+func (f *fakeLog) body(envelope string, verifiers [][]byte) []byte {
+	env := dsse.Envelope{}
+	require.NoError(f.t, json.Unmarshal([]byte(envelope), &env))
+	sigs := []map[string]string{}
+	for i, sig := range env.Signatures {
+		sigs = append(sigs, map[string]string{
+			"signature": base64.StdEncoding.EncodeToString(sig.Signature),
+			"verifier":  base64.StdEncoding.EncodeToString(verifiers[i%len(verifiers)]),
+		})
+	}
+
+	envelopeHash, payloadHash := sha256.Sum256([]byte(envelope)), sha256.Sum256(env.Payload)
+	body, err := json.Marshal(map[string]interface{}{
+		"apiVersion": Version,
+		"kind":       Kind,
+		"spec": map[string]interface{}{
+			"envelopeHash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(envelopeHash[:])},
+			"payloadHash":  map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(payloadHash[:])},
+			"signatures":   sigs,
+		},
+	})
+
+	require.NoError(f.t, err)
+	return body
+}
+
+func (f *fakeLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == entriesPath:
+		proposed := struct {
+			Kind string `json:"kind"`
+			Spec struct {
+				ProposedContent struct {
+					Envelope  string   `json:"envelope"`
+					Verifiers [][]byte `json:"verifiers"`
+				} `json:"proposedContent"`
+			} `json:"spec"`
+		}{}
+
+		data, _ := io.ReadAll(r.Body)
+		if json.Unmarshal(data, &proposed) != nil || proposed.Kind != Kind || len(proposed.Spec.ProposedContent.Verifiers) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		leaf := f.body(proposed.Spec.ProposedContent.Envelope, proposed.Spec.ProposedContent.Verifiers)
+		uuid := hex.EncodeToString(hashLeaf(leaf))
+		if _, ok := f.uuids[uuid]; ok {
+			w.Header().Set("Location", entriesPath+"/"+uuid)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		f.uuids[uuid] = len(f.leaves)
+		f.leaves = append(f.leaves, leaf)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(f.entry(f.uuids[uuid]))
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, entriesPath+"/"):
+		index, ok := f.uuids[strings.TrimPrefix(r.URL.Path, entriesPath+"/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(f.entry(index))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func signedEnvelope(t *testing.T) (dsse.Envelope, cryptoutil.Verifier) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := cryptoutil.NewECDSASigner(key, crypto.SHA256)
+	env, err := dsse.Sign("application/vnd.in-toto+json", strings.NewReader("{}"), dsse.SignWithSigners(signer))
+	require.NoError(t, err)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	return env, verifier
+}
+
+func TestUpload(t *testing.T) {
+	log := newFakeLog(t)
+	server := httptest.NewServer(log)
+	defer server.Close()
+
+	env, verifier := signedEnvelope(t)
+	client := New(server.URL + "/")
+	entry, err := client.Upload(context.Background(), env, []cryptoutil.Verifier{verifier})
+	require.NoError(t, err)
+	require.Equal(t, int64(6), entry.LogIndex)
+	require.NoError(t, entry.VerifyInclusion())
+	require.NoError(t, entry.VerifySignedEntryTimestamp(&log.key.PublicKey))
+
+	// entries later in the tree change the proof, which still verifies
+	for i := 0; i < 4; i++ {
+		other, verifier := signedEnvelope(t)
+		_, err := client.Upload(context.Background(), other, []cryptoutil.Verifier{verifier})
+		require.NoError(t, err)
+	}
+
+	existing, err := client.Upload(context.Background(), env, []cryptoutil.Verifier{verifier})
+	require.NoError(t, err)
+	require.Equal(t, entry.UUID, existing.UUID)
+	require.Equal(t, int64(11), existing.InclusionProof.TreeSize)
+	require.NoError(t, existing.VerifyInclusion())
+
+	tlogEntry, err := existing.TransparencyLogEntry()
+	require.NoError(t, err)
+	decoded := struct {
+		LogIndex       string `json:"logIndex"`
+		InclusionProof struct {
+			TreeSize string `json:"treeSize"`
+		} `json:"inclusionProof"`
+		CanonicalizedBody []byte `json:"canonicalizedBody"`
+	}{}
+
+	require.NoError(t, json.Unmarshal(tlogEntry, &decoded))
+	require.Equal(t, "6", decoded.LogIndex)
+	require.Equal(t, "11", decoded.InclusionProof.TreeSize)
+	require.Equal(t, entry.Body, decoded.CanonicalizedBody)
+}
+
+func TestVerifyInclusionTreeSizes(t *testing.T) {
+	leaves := [][]byte{}
+	for size := 1; size <= 17; size++ {
+		leaves = append(leaves, []byte(fmt.Sprintf("leaf %v", size)))
+		for index := range leaves {
+			hashes := []string{}
+			for _, hash := range path(index, leaves) {
+				hashes = append(hashes, hex.EncodeToString(hash))
+			}
+
+			entry := Entry{
+				UUID:           hex.EncodeToString(hashLeaf(leaves[index])),
+				Body:           leaves[index],
+				InclusionProof: &InclusionProof{LogIndex: int64(index), TreeSize: int64(size), RootHash: hex.EncodeToString(root(leaves)), Hashes: hashes},
+			}
+
+			require.NoError(t, entry.VerifyInclusion(), "index %v of %v", index, size)
+		}
+	}
+}
+
+func TestVerifyInclusionTampered(t *testing.T) {
+	log := newFakeLog(t)
+	server := httptest.NewServer(log)
+	defer server.Close()
+
+	env, verifier := signedEnvelope(t)
+	entry, err := New(server.URL).Upload(context.Background(), env, []cryptoutil.Verifier{verifier})
+	require.NoError(t, err)
+
+	tampered := entry
+	tampered.Body = []byte("other")
+	require.Error(t, tampered.VerifyInclusion())
+	require.Error(t, tampered.VerifySignedEntryTimestamp(&log.key.PublicKey))
+
+	proof := *entry.InclusionProof
+	proof.Hashes = append([]string{}, proof.Hashes...)
+	proof.Hashes[0] = hex.EncodeToString(make([]byte, sha256.Size))
+	tampered = entry
+	tampered.InclusionProof = &proof
+	require.Error(t, tampered.VerifyInclusion())
+
+	proof = *entry.InclusionProof
+	proof.TreeSize = proof.LogIndex
+	tampered.InclusionProof = &proof
+	require.Error(t, tampered.VerifyInclusion())
+}
+
+func TestVerify(t *testing.T) {
+	log := newFakeLog(t)
+	server := httptest.NewServer(log)
+	defer server.Close()
+
+	env, verifier := signedEnvelope(t)
+	entry, err := New(server.URL).Upload(context.Background(), env, []cryptoutil.Verifier{verifier})
+	require.NoError(t, err)
+	require.NoError(t, entry.Verify(env, &log.key.PublicKey))
+
+	// the entry survives a round trip through a sigstore bundle
+	tlogEntry, err := entry.TransparencyLogEntry()
+	require.NoError(t, err)
+	parsed, err := ParseTransparencyLogEntry(tlogEntry)
+	require.NoError(t, err)
+	require.Equal(t, entry, parsed)
+
+	other := env
+	other.Payload = []byte(`{"other":true}`)
+	require.ErrorContains(t, entry.Verify(other, &log.key.PublicKey), "does not log the envelope's payload")
+
+	// the same payload signed by another key isn't the logged envelope
+	resigned, _ := signedEnvelope(t)
+	require.ErrorContains(t, entry.Verify(resigned, &log.key.PublicKey), "does not log the envelope's signature")
+
+	otherLog := newFakeLog(t)
+	require.ErrorContains(t, entry.Verify(env, &otherLog.key.PublicKey), "not "+mustLogID(t, &otherLog.key.PublicKey))
+
+	// an entry claiming to be from the log must carry the log's promise
+	forged := entry
+	forged.SignedEntryTimestamp = append([]byte{}, entry.SignedEntryTimestamp...)
+	forged.SignedEntryTimestamp[len(forged.SignedEntryTimestamp)-1] ^= 1
+	require.Error(t, forged.Verify(env, &log.key.PublicKey))
+}
+
+func TestVerifyLogged(t *testing.T) {
+	log := newFakeLog(t)
+	server := httptest.NewServer(log)
+	defer server.Close()
+
+	env, verifier := signedEnvelope(t)
+	entry, err := New(server.URL).Upload(context.Background(), env, []cryptoutil.Verifier{verifier})
+	require.NoError(t, err)
+	tlogEntry, err := entry.TransparencyLogEntry()
+	require.NoError(t, err)
+
+	logged, err := bundle.Encode(env, bundle.FormatSigstoreBundle, tlogEntry)
+	require.NoError(t, err)
+	require.NoError(t, VerifyLogged(logged, &log.key.PublicKey))
+	require.Error(t, VerifyLogged(logged, &newFakeLog(t).key.PublicKey))
+
+	unlogged, err := bundle.Encode(env, bundle.FormatDSSE)
+	require.NoError(t, err)
+	require.ErrorContains(t, VerifyLogged(unlogged, &log.key.PublicKey), "no transparency log entry")
+
+	// an entry of another envelope doesn't vouch for this one
+	other, _ := signedEnvelope(t)
+	swapped, err := bundle.Encode(other, bundle.FormatSigstoreBundle, tlogEntry)
+	require.NoError(t, err)
+	require.ErrorContains(t, VerifyLogged(swapped, &log.key.PublicKey), "does not log the envelope's signature")
+}
+
+func mustLogID(t *testing.T, key crypto.PublicKey) string {
+	logID, err := LogID(key)
+	require.NoError(t, err)
+	return logID
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	parsed, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	require.NoError(t, err)
+	require.True(t, key.PublicKey.Equal(parsed))
+
+	_, err = ParsePublicKey([]byte("not a key"))
+	require.Error(t, err)
+}
+
+func TestUploadRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"message":"verifier does not match"}`))
+	}))
+	defer server.Close()
+
+	env, verifier := signedEnvelope(t)
+	_, err := New(server.URL).Upload(context.Background(), env, []cryptoutil.Verifier{verifier})
+	require.ErrorContains(t, err, "verifier does not match")
+}
@@ -0,0 +1,406 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package relay implements a caching relay for the timestamp authority, Fulcio, and Rekor traffic of build jobs,
+// so jobs only need to reach the relay and the relay is the single point of egress to those services.
+package relay
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/metrics"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	// TSAPath is where timestamp requests are accepted. Point --timestamp-servers at <relay>/tsa.
+	TSAPath = "/tsa"
+	// FulcioPath is where Fulcio's HTTP API is relayed. Fulcio's gRPC API, which witness uses, is relayed from the
+	// relay's root, so point --fulcio at the relay itself.
+	FulcioPath = "/fulcio"
+	// RekorPath is where Rekor's HTTP API is relayed.
+	RekorPath = "/rekor"
+
+	DefaultCacheTTL     = time.Hour
+	DefaultCacheEntries = 1024
+
+	// maxCachedBody bounds the size of responses that are cached
+	maxCachedBody = 1 << 20
+)
+
+type Relay struct {
+	tsa          *url.URL
+	fulcio       *url.URL
+	rekor        *url.URL
+	cacheTTL     time.Duration
+	cacheEntries int
+	transport    http.RoundTripper
+	metrics      *metrics.Metrics
+
+	cache *cache
+	mux   *http.ServeMux
+}
+
+type Option func(*Relay)
+
+// WithTSA relays timestamp requests to the timestamp authority at u.
+func WithTSA(u *url.URL) Option {
+	return func(r *Relay) {
+		r.tsa = u
+	}
+}
+
+// WithFulcio relays Fulcio's gRPC and HTTP APIs to the Fulcio instance at u.
+func WithFulcio(u *url.URL) Option {
+	return func(r *Relay) {
+		r.fulcio = u
+	}
+}
+
+// WithRekor relays Rekor's HTTP API to the Rekor instance at u.
+func WithRekor(u *url.URL) Option {
+	return func(r *Relay) {
+		r.rekor = u
+	}
+}
+
+// WithCache sets how long successful GET responses are cached and how many are kept. A ttl of 0 disables caching.
+func WithCache(ttl time.Duration, entries int) Option {
+	return func(r *Relay) {
+		r.cacheTTL = ttl
+		r.cacheEntries = entries
+	}
+}
+
+// WithMetrics records the relay's cache hits and the responses of the upstream services in m.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(r *Relay) {
+		r.metrics = m
+	}
+}
+
+// WithTransport sets the transport used for HTTP requests to the upstream services.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(r *Relay) {
+		r.transport = transport
+	}
+}
+
+func New(opts ...Option) (*Relay, error) {
+	r := &Relay{
+		cacheTTL:     DefaultCacheTTL,
+		cacheEntries: DefaultCacheEntries,
+		transport:    http.DefaultTransport,
+		mux:          http.NewServeMux(),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.tsa == nil && r.fulcio == nil && r.rekor == nil {
+		return nil, fmt.Errorf("at least one upstream service is required")
+	}
+
+	if r.cacheTTL > 0 && r.cacheEntries > 0 {
+		r.cache = newCache(r.cacheEntries)
+	}
+
+	for _, route := range []struct {
+		prefix   string
+		upstream *url.URL
+	}{{TSAPath, r.tsa}, {FulcioPath, r.fulcio}, {RekorPath, r.rekor}} {
+		if route.upstream == nil {
+			continue
+		}
+
+		handler := r.cached(route.prefix, r.proxy(route.prefix, route.upstream))
+		r.mux.Handle(route.prefix, handler)
+		r.mux.Handle(route.prefix+"/", handler)
+	}
+
+	return r, nil
+}
+
+// Handler returns the relay's handler. It accepts HTTP/2 without TLS so gRPC clients can connect to it directly.
+func (r *Relay) Handler() http.Handler {
+	var grpcHandler http.Handler
+	if r.fulcio != nil {
+		grpcHandler = r.grpcProxy(r.fulcio)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor == 2 && strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+			if grpcHandler == nil {
+				http.Error(w, "no fulcio upstream is configured", http.StatusNotFound)
+				return
+			}
+
+			grpcHandler.ServeHTTP(w, req)
+			return
+		}
+
+		r.mux.ServeHTTP(w, req)
+	})
+
+	return h2c.NewHandler(handler, &http2.Server{})
+}
+
+// proxy relays requests under prefix to upstream, with the prefix replaced by upstream's path.
+func (r *Relay) proxy(prefix string, upstream *url.URL) http.Handler {
+	return &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = upstream.Scheme
+			req.URL.Host = upstream.Host
+			req.URL.Path = joinPath(upstream.Path, strings.TrimPrefix(req.URL.Path, prefix))
+			req.URL.RawPath = ""
+			req.Host = upstream.Host
+			log.Debugf("(relay) %v %v", req.Method, req.URL)
+		},
+		Transport:      r.transport,
+		ModifyResponse: r.observe(strings.TrimPrefix(prefix, "/")),
+		ErrorHandler:   r.observeError(strings.TrimPrefix(prefix, "/")),
+	}
+}
+
+// observe records the status of responses from upstream.
+func (r *Relay) observe(upstream string) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		r.metrics.ObserveUpstream(upstream, resp.StatusCode)
+		return nil
+	}
+}
+
+// observeError records requests that upstream couldn't be reached for as bad gateway responses, which is what the
+// client is sent.
+func (r *Relay) observeError(upstream string) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, req *http.Request, err error) {
+		log.Warnf("(relay) failed to relay %v %v to %v: %v", req.Method, req.URL.Path, upstream, err)
+		r.metrics.ObserveUpstream(upstream, http.StatusBadGateway)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
+
+// grpcProxy relays gRPC requests to upstream over HTTP/2, using TLS when upstream is https.
+func (r *Relay) grpcProxy(upstream *url.URL) http.Handler {
+	transport := &http2.Transport{}
+	if upstream.Scheme == "http" {
+		transport.AllowHTTP = true
+		transport.DialTLS = func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		}
+	}
+
+	host := upstream.Host
+	if upstream.Port() == "" && upstream.Scheme == "https" {
+		host = net.JoinHostPort(upstream.Hostname(), "443")
+	}
+
+	return &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = upstream.Scheme
+			req.URL.Host = host
+			req.Host = upstream.Hostname()
+			log.Debugf("(relay) grpc %v", req.URL.Path)
+		},
+		Transport:      transport,
+		FlushInterval:  -1,
+		ModifyResponse: r.observe("fulcio"),
+		ErrorHandler:   r.observeError("fulcio"),
+	}
+}
+
+func joinPath(base, rest string) string {
+	switch {
+	case rest == "":
+		return base
+	case base == "":
+		return rest
+	default:
+		return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(rest, "/")
+	}
+}
+
+// cached serves successful GET responses from the cache. Other requests, such as timestamp and signing requests,
+// are always relayed because their responses are unique to the request.
+func (r *Relay) cached(prefix string, next http.Handler) http.Handler {
+	if r.cache == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet || req.Header.Get("Authorization") != "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		key := prefix + " " + req.URL.RequestURI()
+		cached, ok := r.cache.get(key, time.Now())
+		r.metrics.ObserveCache("relay", ok)
+		if ok {
+			cached.write(w)
+			return
+		}
+
+		recorder := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, req)
+		if recorder.status != http.StatusOK || recorder.overflow || strings.Contains(recorder.Header().Get("Cache-Control"), "no-store") {
+			return
+		}
+
+		r.cache.put(key, &entry{
+			header:  recorder.Header().Clone(),
+			body:    recorder.body.Bytes(),
+			expires: time.Now().Add(r.cacheTTL),
+		})
+	})
+}
+
+// ListenAndServe serves the relay on addr without TLS until ctx is done.
+func (r *Relay) ListenAndServe(ctx context.Context, addr string) error {
+	return r.serve(ctx, addr, func(server *http.Server) error { return server.ListenAndServe() })
+}
+
+// ListenAndServeTLS serves the relay on addr with the certificate and key in certFile and keyFile until ctx is done.
+func (r *Relay) ListenAndServeTLS(ctx context.Context, addr, certFile, keyFile string) error {
+	return r.serve(ctx, addr, func(server *http.Server) error { return server.ListenAndServeTLS(certFile, keyFile) })
+}
+
+func (r *Relay) serve(ctx context.Context, addr string, listen func(*http.Server) error) error {
+	server := &http.Server{Addr: addr, Handler: r.Handler(), ReadHeaderTimeout: 30 * time.Second}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- listen(server)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}
+
+// recorder copies the response it writes so it can be cached.
+type recorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(data []byte) (int, error) {
+	if !r.overflow {
+		if r.body.Len()+len(data) > maxCachedBody {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(data)
+		}
+	}
+
+	return r.ResponseWriter.Write(data)
+}
+
+type entry struct {
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+func (e *entry) write(w http.ResponseWriter) {
+	for name, values := range e.header {
+		w.Header()[name] = values
+	}
+
+	w.Header().Set("X-Witness-Relay-Cache", "hit")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, bytes.NewReader(e.body)); err != nil {
+		log.Debugf("(relay) failed to write cached response: %v", err)
+	}
+}
+
+// cache is a least recently used cache of responses.
+type cache struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheItem struct {
+	key   string
+	entry *entry
+}
+
+func newCache(max int) *cache {
+	return &cache{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *cache) get(key string, now time.Time) (*entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	item := elem.Value.(*cacheItem)
+	if now.After(item.entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return item.entry, true
+}
+
+func (c *cache) put(key string, e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheItem).entry = e
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheItem{key: key, entry: e})
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheItem).key)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/witness/pkg/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func newUpstream(t *testing.T, handler http.HandlerFunc) (*url.URL, *int32) {
+	hits := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		handler(w, r)
+	}))
+
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return u, hits
+}
+
+func get(t *testing.T, method, u string) (*http.Response, string) {
+	req, err := http.NewRequest(method, u, strings.NewReader("request"))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestRelayTSA(t *testing.T) {
+	upstream, hits := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.Path + " " + string(body)))
+	})
+
+	upstream.Path = "/tsr"
+	r, err := New(WithTSA(upstream))
+	require.NoError(t, err)
+	server := httptest.NewServer(r.Handler())
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, body := get(t, http.MethodPost, server.URL+TSAPath)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "POST /tsr request", body)
+	}
+
+	require.Equal(t, int32(2), atomic.LoadInt32(hits))
+
+	resp, _ := get(t, http.MethodGet, server.URL+RekorPath+"/api/v1/log")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestRelayCachesGets(t *testing.T) {
+	upstream, hits := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/missing" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write([]byte(r.URL.Path))
+	})
+
+	m := metrics.New()
+	r, err := New(WithRekor(upstream), WithMetrics(m))
+	require.NoError(t, err)
+	server := httptest.NewServer(r.Handler())
+	defer server.Close()
+
+	resp, body := get(t, http.MethodGet, server.URL+RekorPath+"/api/v1/log/publicKey")
+	require.Equal(t, "/api/v1/log/publicKey", body)
+	require.Empty(t, resp.Header.Get("X-Witness-Relay-Cache"))
+	resp, body = get(t, http.MethodGet, server.URL+RekorPath+"/api/v1/log/publicKey")
+	require.Equal(t, "/api/v1/log/publicKey", body)
+	require.Equal(t, "hit", resp.Header.Get("X-Witness-Relay-Cache"))
+	require.Equal(t, int32(1), atomic.LoadInt32(hits))
+
+	for i := 0; i < 2; i++ {
+		resp, _ = get(t, http.MethodGet, server.URL+RekorPath+"/api/v1/missing")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+
+	require.Equal(t, int32(3), atomic.LoadInt32(hits))
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, metrics.Path, nil))
+	require.Contains(t, recorder.Body.String(), `witness_cache_requests_total{cache="relay",result="hit"} 1`)
+	require.Contains(t, recorder.Body.String(), `witness_cache_requests_total{cache="relay",result="miss"} 3`)
+	require.Contains(t, recorder.Body.String(), `witness_upstream_requests_total{code="200",upstream="rekor"} 1`)
+	require.Contains(t, recorder.Body.String(), `witness_upstream_requests_total{code="404",upstream="rekor"} 2`)
+}
+
+func TestRelayCacheDisabled(t *testing.T) {
+	upstream, hits := newUpstream(t, func(w http.ResponseWriter, r *http.Request) {})
+	r, err := New(WithRekor(upstream), WithCache(0, DefaultCacheEntries))
+	require.NoError(t, err)
+	server := httptest.NewServer(r.Handler())
+	defer server.Close()
+
+	get(t, http.MethodGet, server.URL+RekorPath+"/api/v1/log")
+	get(t, http.MethodGet, server.URL+RekorPath+"/api/v1/log")
+	require.Equal(t, int32(2), atomic.LoadInt32(hits))
+}
+
+func TestCacheEviction(t *testing.T) {
+	now := time.Now()
+	c := newCache(2)
+	c.put("a", &entry{expires: now.Add(time.Minute)})
+	c.put("b", &entry{expires: now.Add(time.Minute)})
+	_, ok := c.get("a", now)
+	require.True(t, ok)
+	c.put("c", &entry{expires: now.Add(time.Minute)})
+
+	_, ok = c.get("b", now)
+	require.False(t, ok)
+	_, ok = c.get("a", now)
+	require.True(t, ok)
+	_, ok = c.get("c", now.Add(2*time.Minute))
+	require.False(t, ok)
+}
+
+func TestRelayGRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcServer := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("fulcio", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	go func() {
+		_ = grpcServer.Serve(listener)
+	}()
+
+	defer grpcServer.Stop()
+	r, err := New(WithFulcio(&url.URL{Scheme: "http", Host: listener.Addr().String()}))
+	require.NoError(t, err)
+	server := httptest.NewServer(r.Handler())
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, strings.TrimPrefix(server.URL, "http://"), grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "fulcio"})
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	require.Error(t, err)
+}
+
+func TestNewRequiresUpstream(t *testing.T) {
+	_, err := New()
+	require.Error(t, err)
+}
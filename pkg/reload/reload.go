@@ -0,0 +1,237 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reload keeps the policy and trust roots of witness servers current. Their sources are polled and a
+// changed policy is validated before it replaces the one being served, so policy updates roll out to running
+// servers without restarting them and a bad update leaves the last good policy in place.
+package reload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/witness/pkg/bundle"
+	"github.com/testifysec/witness/pkg/metrics"
+	"github.com/testifysec/witness/pkg/result"
+	"github.com/testifysec/witness/pkg/verify"
+)
+
+// DefaultInterval is how often sources are polled when no interval is set.
+const DefaultInterval = 30 * time.Second
+
+// Bundle is a signed policy and the keys trusted to sign it, as loaded at one time. A bundle is never modified
+// after it is loaded, so it can be used while a newer one replaces it.
+type Bundle struct {
+	PolicyEnvelope dsse.Envelope
+	Verifiers      []cryptoutil.Verifier
+	// PolicyDigest and TrustDigests are the sha256 digests of the policy and keys, as they were read.
+	PolicyDigest string
+	TrustDigests []string
+	// Expires is when the policy expires, which orders policies so an older one can't replace a newer one.
+	Expires  time.Time
+	LoadedAt time.Time
+}
+
+type Option func(*Watcher)
+
+// WithInterval sets how often the sources are polled. 0 disables polling, leaving reloads to Reload and the
+// triggers given to Run.
+func WithInterval(interval time.Duration) Option {
+	return func(w *Watcher) {
+		w.interval = interval
+	}
+}
+
+// WithMetrics records each reload in m.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(w *Watcher) {
+		w.metrics = m
+	}
+}
+
+// Watcher holds the current bundle loaded from a policy source and key sources, and replaces it when they change.
+type Watcher struct {
+	policy   Source
+	keys     []Source
+	interval time.Duration
+	metrics  *metrics.Metrics
+	current  atomic.Value
+	// mu serializes loads, and guards loaded
+	mu sync.Mutex
+	// loaded is the digest of the contents of the current bundle, so unchanged sources aren't validated again.
+	// Contents that failed to validate are validated again at every poll, so a failure that passes, such as a key
+	// that couldn't be read, doesn't keep the update out until the sources change again.
+	loaded string
+}
+
+func New(policy Source, keys []Source, opts ...Option) *Watcher {
+	w := &Watcher{
+		policy:   policy,
+		keys:     keys,
+		interval: DefaultInterval,
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	return w
+}
+
+// Bundle returns the current bundle, or nil if none has loaded.
+func (w *Watcher) Bundle() *Bundle {
+	b, _ := w.current.Load().(*Bundle)
+	return b
+}
+
+// Reload reads the sources and, if they changed since the current bundle was loaded, validates them and makes them
+// the current bundle. It returns whether the current bundle was replaced. An invalid bundle is returned as an error
+// and the current bundle is kept. A policy that expires before the current one is refused, since a source such as a
+// registry tag can be moved back to an older policy that is still validly signed.
+func (w *Watcher) Reload(ctx context.Context) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	policyBytes, err := w.policy.Load(ctx)
+	if err != nil {
+		return false, w.observe(fmt.Errorf("failed to load policy from %v: %w", w.policy, err))
+	}
+
+	keyBytes := make([][]byte, 0, len(w.keys))
+	for _, key := range w.keys {
+		data, err := key.Load(ctx)
+		if err != nil {
+			return false, w.observe(fmt.Errorf("failed to load key from %v: %w", key, err))
+		}
+
+		keyBytes = append(keyBytes, data)
+	}
+
+	b := &Bundle{PolicyDigest: digest(policyBytes), LoadedAt: time.Now()}
+	contents := sha256.New()
+	contents.Write([]byte(b.PolicyDigest))
+	for _, data := range keyBytes {
+		b.TrustDigests = append(b.TrustDigests, digest(data))
+		contents.Write([]byte(b.TrustDigests[len(b.TrustDigests)-1]))
+	}
+
+	loaded := hex.EncodeToString(contents.Sum(nil))
+	if loaded == w.loaded {
+		return false, nil
+	}
+
+	if err := w.validate(b, policyBytes, keyBytes); err != nil {
+		return false, w.observe(err)
+	}
+
+	if current := w.Bundle(); current != nil && b.Expires.Before(current.Expires) {
+		return false, w.observe(result.Policy(fmt.Errorf("policy %v from %v expires at %v, before the policy being served, which expires at %v, so it may be a rollback", b.PolicyDigest, w.policy, b.Expires.Format(time.RFC3339), current.Expires.Format(time.RFC3339))))
+	}
+
+	w.loaded = loaded
+	w.current.Store(b)
+	log.Infof("Loaded policy %v from %v", b.PolicyDigest, w.policy)
+	return true, w.observe(nil)
+}
+
+// validate fills in the policy envelope and verifiers of b, failing unless the policy is signed by one of the keys
+// and could be verified against now.
+func (w *Watcher) validate(b *Bundle, policyBytes []byte, keyBytes [][]byte) error {
+	if len(keyBytes) == 0 {
+		return result.Usage(fmt.Errorf("no keys are trusted to sign the policy"))
+	}
+
+	for i, data := range keyBytes {
+		verifier, err := verify.NewVerifierFromBytes(data)
+		if err != nil {
+			return result.Policy(fmt.Errorf("invalid key from %v: %w", w.keys[i], err))
+		}
+
+		b.Verifiers = append(b.Verifiers, verifier)
+	}
+
+	var err error
+	if b.PolicyEnvelope, err = bundle.Decode(policyBytes); err != nil {
+		return result.Policy(fmt.Errorf("could not unmarshal policy envelope from %v: %w", w.policy, err))
+	}
+
+	if _, err := b.PolicyEnvelope.Verify(dsse.VerifyWithVerifiers(b.Verifiers...)); err != nil {
+		return result.Policy(fmt.Errorf("could not verify policy from %v: %w", w.policy, err))
+	}
+
+	if err := verify.CheckPolicy(b.PolicyEnvelope.Payload, b.LoadedAt); err != nil {
+		return result.Policy(fmt.Errorf("invalid policy from %v: %w", w.policy, err))
+	}
+
+	pol := policy.Policy{}
+	if err := json.Unmarshal(b.PolicyEnvelope.Payload, &pol); err != nil {
+		return result.Policy(fmt.Errorf("invalid policy from %v: %w", w.policy, err))
+	}
+
+	b.Expires = pol.Expires
+	return nil
+}
+
+func (w *Watcher) observe(err error) error {
+	w.metrics.ObserveReload(err)
+	return err
+}
+
+// Run reloads the bundle at every interval and whenever a signal is received on triggers, such as SIGHUP, until
+// ctx is done. Failed reloads are logged and the current bundle is kept.
+func (w *Watcher) Run(ctx context.Context, triggers <-chan os.Signal) {
+	var tick <-chan time.Time
+	if w.interval > 0 {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case <-triggers:
+			log.Infof("Reloading policy from %v", w.policy)
+		}
+
+		if _, err := w.Reload(ctx); err != nil {
+			log.Errorf("failed to reload policy, still serving policy %v: %v", w.currentDigest(), err)
+		}
+	}
+}
+
+func (w *Watcher) currentDigest() string {
+	if b := w.Bundle(); b != nil {
+		return b.PolicyDigest
+	}
+
+	return "<none>"
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
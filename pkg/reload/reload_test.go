@@ -0,0 +1,191 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reload
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/witness/pkg/result"
+)
+
+// writePolicy writes a policy with a single step, signed by signer, that expires at expires.
+func writePolicy(t *testing.T, path, step string, expires time.Time, signer cryptoutil.Signer) {
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	keyID, err := verifier.KeyID()
+	require.NoError(t, err)
+	pub, err := verifier.Bytes()
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"expires":    expires.Format(time.RFC3339),
+		"steps":      map[string]interface{}{step: map[string]interface{}{"name": step, "functionaries": []map[string]string{{"type": "publickey", "publickeyid": keyID}}}},
+		"publickeys": map[string]interface{}{keyID: map[string]interface{}{"keyid": keyID, "key": pub}},
+	})
+	require.NoError(t, err)
+
+	env, err := dsse.Sign(policy.PolicyPredicate, bytes.NewReader(payload), dsse.SignWithSigners(signer))
+	require.NoError(t, err)
+	data, err := json.Marshal(&env)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0644))
+}
+
+func newSigner(t *testing.T) (cryptoutil.Signer, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := cryptoutil.NewECDSASigner(key, crypto.SHA256)
+	pub, err := cryptoutil.PublicPemBytes(key.Public())
+	require.NoError(t, err)
+	return signer, pub
+}
+
+func policySteps(t *testing.T, b *Bundle) []string {
+	pol := policy.Policy{}
+	require.NoError(t, json.Unmarshal(b.PolicyEnvelope.Payload, &pol))
+	steps := []string{}
+	for name := range pol.Steps {
+		steps = append(steps, name)
+	}
+
+	return steps
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	policyPath, keyPath := filepath.Join(dir, "policy.json"), filepath.Join(dir, "key.pem")
+	signer, pub := newSigner(t)
+	require.NoError(t, os.WriteFile(keyPath, pub, 0644))
+	writePolicy(t, policyPath, "build", time.Now().Add(time.Hour), signer)
+
+	w := New(File(policyPath), []Source{File(keyPath)}, WithInterval(0))
+	require.Nil(t, w.Bundle())
+	changed, err := w.Reload(context.Background())
+	require.NoError(t, err)
+	require.True(t, changed)
+	first := w.Bundle()
+	require.Equal(t, []string{"build"}, policySteps(t, first))
+
+	// unchanged sources keep the bundle
+	changed, err = w.Reload(context.Background())
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.Same(t, first, w.Bundle())
+
+	writePolicy(t, policyPath, "test", time.Now().Add(time.Hour), signer)
+	changed, err = w.Reload(context.Background())
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, []string{"test"}, policySteps(t, w.Bundle()))
+	require.NotEqual(t, first.PolicyDigest, w.Bundle().PolicyDigest)
+	// bundles already handed out are left as they were
+	require.Equal(t, []string{"build"}, policySteps(t, first))
+}
+
+func TestReloadKeepsLastGoodBundle(t *testing.T) {
+	dir := t.TempDir()
+	policyPath, keyPath := filepath.Join(dir, "policy.json"), filepath.Join(dir, "key.pem")
+	signer, pub := newSigner(t)
+	require.NoError(t, os.WriteFile(keyPath, pub, 0644))
+	writePolicy(t, policyPath, "build", time.Now().Add(time.Hour), signer)
+
+	w := New(File(policyPath), []Source{File(keyPath)}, WithInterval(0))
+	_, err := w.Reload(context.Background())
+	require.NoError(t, err)
+	good := w.Bundle()
+
+	untrusted, _ := newSigner(t)
+	writePolicy(t, policyPath, "test", time.Now().Add(time.Hour), untrusted)
+	_, err = w.Reload(context.Background())
+	require.ErrorContains(t, err, "could not verify policy")
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(err))
+	require.Same(t, good, w.Bundle())
+
+	// an invalid update is validated again at every reload, so a failure that passes doesn't keep it out
+	changed, err := w.Reload(context.Background())
+	require.ErrorContains(t, err, "could not verify policy")
+	require.False(t, changed)
+
+	writePolicy(t, policyPath, "test", time.Now().Add(-time.Hour), signer)
+	_, err = w.Reload(context.Background())
+	require.ErrorContains(t, err, "policy expired")
+	require.Same(t, good, w.Bundle())
+
+	require.NoError(t, os.Remove(policyPath))
+	_, err = w.Reload(context.Background())
+	require.ErrorContains(t, err, "failed to load policy")
+	require.Same(t, good, w.Bundle())
+
+	// rotating the key and re-signing the policy with it is picked up together
+	rotated, rotatedPub := newSigner(t)
+	require.NoError(t, os.WriteFile(keyPath, rotatedPub, 0644))
+	writePolicy(t, policyPath, "deploy", time.Now().Add(time.Hour), rotated)
+	changed, err = w.Reload(context.Background())
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, []string{"deploy"}, policySteps(t, w.Bundle()))
+	deployed := w.Bundle()
+
+	// a validly signed policy that expires before the one being served may be an old policy put back in place
+	writePolicy(t, policyPath, "build", time.Now().Add(30*time.Minute), rotated)
+	_, err = w.Reload(context.Background())
+	require.ErrorContains(t, err, "may be a rollback")
+	require.Equal(t, result.CategoryPolicy, result.CategoryOf(err))
+	require.Same(t, deployed, w.Bundle())
+}
+
+func TestRunReloadsOnTrigger(t *testing.T) {
+	dir := t.TempDir()
+	policyPath, keyPath := filepath.Join(dir, "policy.json"), filepath.Join(dir, "key.pem")
+	signer, pub := newSigner(t)
+	require.NoError(t, os.WriteFile(keyPath, pub, 0644))
+	writePolicy(t, policyPath, "build", time.Now().Add(time.Hour), signer)
+
+	w := New(File(policyPath), []Source{File(keyPath)}, WithInterval(0))
+	_, err := w.Reload(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	triggers := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx, triggers)
+		close(done)
+	}()
+
+	writePolicy(t, policyPath, "test", time.Now().Add(time.Hour), signer)
+	triggers <- syscall.SIGHUP
+	require.Eventually(t, func() bool {
+		return policySteps(t, w.Bundle())[0] == "test"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
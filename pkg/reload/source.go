@@ -0,0 +1,114 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/testifysec/witness/pkg/archivista"
+	"github.com/testifysec/witness/pkg/registry"
+	"github.com/testifysec/witness/pkg/result"
+)
+
+// Source is where a policy or key is loaded from.
+type Source interface {
+	// Load returns the current content of the source.
+	Load(ctx context.Context) ([]byte, error)
+	String() string
+}
+
+// File loads from a file, such as one mounted from a Kubernetes ConfigMap, which is updated in place.
+func File(path string) Source {
+	return fileSource(path)
+}
+
+type fileSource string
+
+func (s fileSource) Load(ctx context.Context) ([]byte, error) {
+	return os.ReadFile(string(s))
+}
+
+func (s fileSource) String() string {
+	return string(s)
+}
+
+// Registry loads the artifact tagged in an OCI registry, so moving the tag rolls out a new policy.
+func Registry(client *registry.Client, ref registry.Reference) Source {
+	return &registrySource{client: client, ref: ref}
+}
+
+type registrySource struct {
+	// mu guards the client, which isn't safe for concurrent use
+	mu     sync.Mutex
+	client *registry.Client
+	ref    registry.Reference
+}
+
+func (s *registrySource) Load(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.client.Fetch(ctx, s.ref)
+	if err != nil {
+		return nil, result.Storage(err)
+	}
+
+	return data, nil
+}
+
+func (s *registrySource) String() string {
+	return "oci://" + s.ref.String()
+}
+
+// Archivista loads the envelope stored in Archivista under gitoid. Envelopes in Archivista never change, so it is
+// downloaded once and a policy loaded from Archivista is only replaced by restarting with another gitoid.
+func Archivista(client *archivista.Client, gitoid string) Source {
+	return &archivistaSource{client: client, gitoid: gitoid}
+}
+
+type archivistaSource struct {
+	mu     sync.Mutex
+	client *archivista.Client
+	gitoid string
+	data   []byte
+}
+
+func (s *archivistaSource) Load(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data != nil {
+		return s.data, nil
+	}
+
+	env, err := s.client.Download(ctx, s.gitoid)
+	if err != nil {
+		return nil, result.Storage(err)
+	}
+
+	data, err := json.Marshal(&env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+
+	s.data = data
+	return data, nil
+}
+
+func (s *archivistaSource) String() string {
+	return "archivista:" + s.gitoid
+}
@@ -0,0 +1,147 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package result defines the stable categories witness sorts its errors into. Categories are reported as process
+// exit codes and in the JSON result written with --result-file, so wrappers can react to failures without parsing
+// log output.
+package result
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// Category is the kind of failure an error represents. Categories and their exit codes are stable across releases.
+type Category string
+
+const (
+	// CategoryInternal is any failure that isn't categorized.
+	CategoryInternal Category = "internal"
+	// CategoryUsage is an invalid command line or configuration.
+	CategoryUsage Category = "usage"
+	// CategorySigner is a failure loading a signer or signing.
+	CategorySigner Category = "signer"
+	// CategoryAttestor is a failure running an attestor, including the command being attested.
+	CategoryAttestor Category = "attestor"
+	// CategoryStorage is a failure storing or retrieving attestations, such as in Archivista or a local store.
+	CategoryStorage Category = "storage"
+	// CategoryPolicy is evidence that doesn't satisfy a policy, or a policy that can't be used.
+	CategoryPolicy Category = "policy"
+)
+
+var exitCodes = map[Category]int{
+	CategoryInternal: 1,
+	CategoryUsage:    2,
+	CategorySigner:   3,
+	CategoryAttestor: 4,
+	CategoryStorage:  5,
+	CategoryPolicy:   6,
+}
+
+// ExitCode returns the process exit code for the category.
+func (c Category) ExitCode() int {
+	if code, ok := exitCodes[c]; ok {
+		return code
+	}
+
+	return exitCodes[CategoryInternal]
+}
+
+// Error is an error sorted into a category.
+type Error struct {
+	Category Category
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap sorts err into category. The category of an error that is already categorized is kept, since it was
+// categorized closer to where it happened. Wrap returns nil if err is nil.
+func Wrap(category Category, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var categorized *Error
+	if errors.As(err, &categorized) {
+		return err
+	}
+
+	return &Error{Category: category, Err: err}
+}
+
+func Usage(err error) error    { return Wrap(CategoryUsage, err) }
+func Signer(err error) error   { return Wrap(CategorySigner, err) }
+func Attestor(err error) error { return Wrap(CategoryAttestor, err) }
+func Storage(err error) error  { return Wrap(CategoryStorage, err) }
+func Policy(err error) error   { return Wrap(CategoryPolicy, err) }
+
+// CategoryOf returns the category of err, which is CategoryInternal if err isn't categorized.
+func CategoryOf(err error) Category {
+	var categorized *Error
+	if errors.As(err, &categorized) {
+		return categorized.Category
+	}
+
+	return CategoryInternal
+}
+
+// ExitCode returns the process exit code for err, which is 0 if err is nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	return CategoryOf(err).ExitCode()
+}
+
+// Result is the outcome of a witness command.
+type Result struct {
+	Command  string     `json:"command"`
+	Success  bool       `json:"success"`
+	ExitCode int        `json:"exitcode"`
+	Error    *ErrorInfo `json:"error,omitempty"`
+}
+
+type ErrorInfo struct {
+	Category Category `json:"category"`
+	Message  string   `json:"message"`
+}
+
+// New returns the result of command finishing with err.
+func New(command string, err error) Result {
+	r := Result{Command: command, Success: err == nil, ExitCode: ExitCode(err)}
+	if err != nil {
+		r.Error = &ErrorInfo{Category: CategoryOf(err), Message: err.Error()}
+	}
+
+	return r
+}
+
+// Write writes the result to path as JSON.
+func (r Result) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
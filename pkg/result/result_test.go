@@ -0,0 +1,74 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package result
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrap(t *testing.T) {
+	require.NoError(t, Signer(nil))
+	require.Equal(t, 0, ExitCode(nil))
+
+	base := errors.New("no signers found")
+	err := Signer(base)
+	require.ErrorIs(t, err, base)
+	require.Equal(t, CategorySigner, CategoryOf(err))
+	require.Equal(t, 3, ExitCode(err))
+
+	err = Storage(fmt.Errorf("failed to publish: %w", err))
+	require.Equal(t, CategorySigner, CategoryOf(err))
+
+	require.Equal(t, CategoryInternal, CategoryOf(base))
+	require.Equal(t, 1, ExitCode(base))
+}
+
+func TestExitCodes(t *testing.T) {
+	seen := map[int]Category{}
+	for category, code := range exitCodes {
+		require.Equal(t, code, category.ExitCode())
+		_, ok := seen[code]
+		require.False(t, ok, "exit code %v is used by more than one category", code)
+		seen[code] = category
+	}
+
+	require.Equal(t, 1, Category("unknown").ExitCode())
+}
+
+func TestResultWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.json")
+	require.NoError(t, New("witness verify", Policy(errors.New("failed to verify policy"))).Write(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	r := Result{}
+	require.NoError(t, json.Unmarshal(data, &r))
+	require.Equal(t, Result{
+		Command:  "witness verify",
+		ExitCode: 6,
+		Error:    &ErrorInfo{Category: CategoryPolicy, Message: "failed to verify policy"},
+	}, r)
+
+	require.NoError(t, New("witness run", nil).Write(path))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"command":"witness run","success":true,"exitcode":0}`, string(data))
+}
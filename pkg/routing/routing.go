@@ -0,0 +1,190 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package routing selects the policy a verification server applies to a request, so one server can enforce the
+// supply chain rules of many teams. Routes select requests by namespace, image repository, and labels, and each
+// names its own policy and the keys trusted to sign it.
+//
+// Labels are set by whoever creates the Pod, so they can't be trusted to choose a policy on their own. Routes that
+// select by labels must also select namespaces, and a request in one of those namespaces only falls through to routes
+// that select its namespace too, so leaving a label off can't move a Pod to a route written for other namespaces.
+package routing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gobwas/glob"
+)
+
+// Config is a routing config. Routes are tried in order and the first that selects a request applies to it.
+// Requests no route selects are rejected, as are requests in the namespace of a route that selects by labels they
+// don't have, unless a later route that selects their namespace selects them.
+type Config struct {
+	Routes []Route `json:"routes"`
+}
+
+// Route selects requests and names the policy they are verified against. A route selects a request if every
+// selector it sets matches, so a route without selectors selects every request and can end the config as a default.
+type Route struct {
+	Name string `json:"name"`
+	// Namespaces are glob patterns of the namespaces selected, such as team-a-*.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Repositories are glob patterns of the image repositories selected, including the registry, such as
+	// ghcr.io/team-a/**. A * doesn't match across a /, while ** does. Docker Hub images are under docker.io.
+	Repositories []string `json:"repositories,omitempty"`
+	// Labels selects requests with all of these labels. Routes with labels must also have namespaces, since the
+	// labels of a Pod are chosen by whoever creates it.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Policy is the signed policy of the route: a file, an oci:// reference, or a gitoid to download from
+	// Archivista.
+	Policy string `json:"policy"`
+	// PublicKeys are paths to the keys trusted to sign the policy.
+	PublicKeys []string `json:"publickeys"`
+	// Environment is the environment requests are verified for. The server's environment is used if it isn't set.
+	Environment string `json:"environment,omitempty"`
+
+	namespaces   []glob.Glob
+	repositories []glob.Glob
+}
+
+// Request is what a route selects by.
+type Request struct {
+	Namespace string
+	// Repository is the repository of the image, including its registry.
+	Repository string
+	Labels     map[string]string
+}
+
+// Load reads and validates the routing config at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing config: %w", err)
+	}
+
+	return Parse(data)
+}
+
+// Parse parses and validates a routing config. Unknown fields are rejected, so a misspelled selector can't silently
+// select every request.
+func Parse(data []byte) (*Config, error) {
+	c := &Config{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return nil, fmt.Errorf("failed to parse routing config: %w", err)
+	}
+
+	if len(c.Routes) == 0 {
+		return nil, errors.New("routing config has no routes")
+	}
+
+	names := map[string]struct{}{}
+	for i := range c.Routes {
+		r := &c.Routes[i]
+		if r.Name == "" {
+			return nil, fmt.Errorf("route %v has no name", i)
+		}
+
+		if _, ok := names[r.Name]; ok {
+			return nil, fmt.Errorf("route %v is defined more than once", r.Name)
+		}
+
+		names[r.Name] = struct{}{}
+		if r.Policy == "" || len(r.PublicKeys) == 0 {
+			return nil, fmt.Errorf("route %v must have a policy and at least one public key", r.Name)
+		}
+
+		if len(r.Labels) > 0 && len(r.Namespaces) == 0 {
+			return nil, fmt.Errorf("route %v selects by labels, which whoever creates a Pod sets, so it must also select namespaces", r.Name)
+		}
+
+		for _, pattern := range r.Namespaces {
+			g, err := glob.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid namespace pattern %v of route %v: %w", pattern, r.Name, err)
+			}
+
+			r.namespaces = append(r.namespaces, g)
+		}
+
+		for _, pattern := range r.Repositories {
+			g, err := glob.Compile(pattern, '/')
+			if err != nil {
+				return nil, fmt.Errorf("invalid repository pattern %v of route %v: %w", pattern, r.Name, err)
+			}
+
+			r.repositories = append(r.repositories, g)
+		}
+	}
+
+	return c, nil
+}
+
+// Route returns the first route that selects req. Once a route that selects by labels selects req's namespace and
+// repository but not its labels, only routes that select its namespace are tried.
+func (c *Config) Route(req Request) (*Route, bool) {
+	namespaceScoped := false
+	for i := range c.Routes {
+		r := &c.Routes[i]
+		if namespaceScoped && len(r.namespaces) == 0 {
+			continue
+		}
+
+		if !r.selectsScope(req) {
+			continue
+		}
+
+		if r.selectsLabels(req) {
+			return r, true
+		}
+
+		namespaceScoped = true
+	}
+
+	return nil, false
+}
+
+// selectsScope reports whether the route selects the namespace and repository of req.
+func (r *Route) selectsScope(req Request) bool {
+	if len(r.namespaces) > 0 && !matchAny(r.namespaces, req.Namespace) {
+		return false
+	}
+
+	return len(r.repositories) == 0 || matchAny(r.repositories, req.Repository)
+}
+
+func (r *Route) selectsLabels(req Request) bool {
+	for key, value := range r.Labels {
+		if actual, ok := req.Labels[key]; !ok || actual != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchAny(globs []glob.Glob, s string) bool {
+	for _, g := range globs {
+		if g.Match(s) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const configJSON = `{
+  "routes": [
+    {"name": "payments", "namespaces": ["payments", "payments-*"], "labels": {"tier": "pci"}, "policy": "pci.json", "publickeys": ["pci.pem"], "environment": "pci"},
+    {"name": "payments-tools", "namespaces": ["payments-*"], "repositories": ["docker.io/**"], "policy": "tools.json", "publickeys": ["tools.pem"]},
+    {"name": "team-a", "repositories": ["ghcr.io/team-a/**"], "policy": "oci://ghcr.io/team-a/policy:current", "publickeys": ["team-a.pem"]},
+    {"name": "default", "policy": "default.json", "publickeys": ["default.pem"]}
+  ]
+}`
+
+func TestRoute(t *testing.T) {
+	c, err := Parse([]byte(configJSON))
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		req   Request
+		route string
+	}{
+		{Request{Namespace: "payments-eu", Repository: "ghcr.io/team-a/app", Labels: map[string]string{"tier": "pci"}}, "payments"},
+		// every selector of a route must match, and requests without the labels of a route of their namespace only
+		// fall through to other routes of their namespace
+		{Request{Namespace: "payments-eu", Repository: "docker.io/library/redis"}, "payments-tools"},
+		{Request{Namespace: "build", Repository: "ghcr.io/team-a/tools/builder"}, "team-a"},
+		{Request{Namespace: "build", Repository: "ghcr.io/team-b/app"}, "default"},
+	} {
+		route, ok := c.Route(test.req)
+		require.True(t, ok)
+		require.Equal(t, test.route, route.Name, "%+v", test.req)
+	}
+
+	// leaving off the label of the payments route doesn't reach the routes of other namespaces
+	for _, req := range []Request{
+		{Namespace: "payments-eu", Repository: "ghcr.io/team-a/app"},
+		{Namespace: "payments", Repository: "docker.io/library/redis", Labels: map[string]string{"tier": "web"}},
+	} {
+		_, ok := c.Route(req)
+		require.False(t, ok, "%+v", req)
+	}
+
+	c, err = Parse([]byte(`{"routes": [{"name": "team-a", "repositories": ["ghcr.io/team-a/*"], "policy": "a.json", "publickeys": ["a.pem"]}]}`))
+	require.NoError(t, err)
+	_, ok := c.Route(Request{Repository: "ghcr.io/team-a/tools/builder"})
+	require.False(t, ok)
+	_, ok = c.Route(Request{Repository: "ghcr.io/team-a/app"})
+	require.True(t, ok)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for config, message := range map[string]string{
+		`{"routes": []}`: "has no routes",
+		`{"routes": [{"policy": "a.json", "publickeys": ["a.pem"]}]}`:                                                                          "route 0 has no name",
+		`{"routes": [{"name": "a", "publickeys": ["a.pem"]}]}`:                                                                                 "must have a policy",
+		`{"routes": [{"name": "a", "policy": "a.json", "publickeys": ["a.pem"]}, {"name": "a", "policy": "b.json", "publickeys": ["b.pem"]}]}`: "defined more than once",
+		`{"routes": [{"name": "a", "namespace": ["a"], "policy": "a.json", "publickeys": ["a.pem"]}]}`:                                         "unknown field",
+		`{"routes": [{"name": "a", "namespaces": ["[a"], "policy": "a.json", "publickeys": ["a.pem"]}]}`:                                       "invalid namespace pattern",
+		`{"routes": [{"name": "a", "labels": {"tier": "pci"}, "policy": "a.json", "publickeys": ["a.pem"]}]}`:                                  "must also select namespaces",
+	} {
+		_, err := Parse([]byte(config))
+		require.ErrorContains(t, err, message, config)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package runner serves a gRPC API that other processes use to record attestations without running the witness
+// CLI and parsing its output. The API is described by runner.proto.
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/testifysec/go-witness/dsse"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	ServiceName = "witness.Runner"
+	RunMethod   = "/witness.Runner/Run"
+)
+
+// RunFunc records the attestations for a request and returns the signed envelope.
+type RunFunc func(ctx context.Context, req *RunRequest) (dsse.Envelope, error)
+
+// RunnerServer is the server side of the Runner service.
+type RunnerServer interface {
+	Run(ctx context.Context, req *RunRequest) (*RunResponse, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*RunnerServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Run",
+		Handler:    runHandler,
+	}},
+	Metadata: "runner.proto",
+}
+
+func runHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &RunRequest{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+
+	if interceptor == nil {
+		return srv.(RunnerServer).Run(ctx, req)
+	}
+
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: RunMethod}
+	return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RunnerServer).Run(ctx, req.(*RunRequest))
+	})
+}
+
+type server struct {
+	run RunFunc
+}
+
+func (s *server) Run(ctx context.Context, req *RunRequest) (*RunResponse, error) {
+	if req.Step == "" {
+		return nil, status.Error(codes.InvalidArgument, "a step name is required")
+	}
+
+	env, err := s.run(ctx, req)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	envelope, err := json.Marshal(env)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &RunResponse{Envelope: envelope}, nil
+}
+
+// NewServer returns a gRPC server with the Runner service registered, which records requests with run.
+func NewServer(run RunFunc, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(append([]grpc.ServerOption{grpc.ForceServerCodec(wireCodec{})}, opts...)...)
+	s.RegisterService(&serviceDesc, &server{run: run})
+	return s
+}
+
+// ListenUnix listens on a Unix socket at path that only the current user can connect to. A socket left behind by
+// a previous server is removed.
+func ListenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%v exists and is not a socket", path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// the socket is created in a directory only the current user can enter and moved into place once its
+	// permissions are restricted, so no one else can connect to it in between
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".witness-")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+	private := filepath.Join(dir, "s")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: private, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+
+	// the socket is removed from where it was moved to instead
+	listener.SetUnlinkOnClose(false)
+	if err := os.Chmod(private, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	if err := os.Rename(private, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return &socketListener{UnixListener: listener, path: path}, nil
+}
+
+// socketListener removes its socket when it is closed.
+type socketListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *socketListener) Close() error {
+	err := l.UnixListener.Close()
+	if removeErr := os.Remove(l.path); err == nil && removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+		err = removeErr
+	}
+
+	return err
+}
+
+// Client calls the Runner service.
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// Dial connects to a Runner service at target, such as unix:///run/witness.sock or localhost:8081. The service
+// is only served locally, so the connection is made without TLS.
+func Dial(target string) (*Client, error) {
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithDefaultCallOptions(grpc.ForceCodec(wireCodec{})))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{conn: conn}, nil
+}
+
+// Run asks the service to record the attestations for req and returns the signed envelope.
+func (c *Client) Run(ctx context.Context, req *RunRequest) (dsse.Envelope, error) {
+	resp := &RunResponse{}
+	if err := c.conn.Invoke(ctx, RunMethod, req, resp); err != nil {
+		return dsse.Envelope{}, err
+	}
+
+	env := dsse.Envelope{}
+	if err := json.Unmarshal(resp.Envelope, &env); err != nil {
+		return dsse.Envelope{}, fmt.Errorf("failed to parse envelope: %w", err)
+	}
+
+	return env, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
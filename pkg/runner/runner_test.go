@@ -0,0 +1,98 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/dsse"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWireRoundTrip(t *testing.T) {
+	req := &RunRequest{Step: "build", Command: []string{"bash", "-c", "", "make"}, WorkingDir: "services/foo", Attestations: []string{"git", "environment"}}
+	decoded := &RunRequest{}
+	require.NoError(t, decoded.unmarshal(req.marshal()))
+	require.Equal(t, req, decoded)
+
+	resp := &RunResponse{Envelope: []byte(`{"payload":""}`)}
+	decodedResp := &RunResponse{}
+	require.NoError(t, decodedResp.unmarshal(resp.marshal()))
+	require.Equal(t, resp, decodedResp)
+
+	require.Error(t, decoded.unmarshal([]byte{0x0a, 0x05, 'a'}))
+}
+
+func TestServer(t *testing.T) {
+	// unix socket paths are limited in length, so the socket can't be in the test's temp dir
+	dir, err := os.MkdirTemp("", "runner")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "witness.sock")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), nil, 0644))
+	_, err = ListenUnix(filepath.Join(dir, "file"))
+	require.Error(t, err)
+
+	listener, err := ListenUnix(socket)
+	require.NoError(t, err)
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	requests := make(chan *RunRequest, 1)
+	server := NewServer(func(ctx context.Context, req *RunRequest) (dsse.Envelope, error) {
+		if req.Step == "fail" {
+			return dsse.Envelope{}, errors.New("command failed")
+		}
+
+		requests <- req
+		return dsse.Envelope{PayloadType: "application/vnd.in-toto+json", Payload: []byte(req.Step)}, nil
+	})
+
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	client, err := Dial("unix://" + socket)
+	require.NoError(t, err)
+	defer client.Close()
+
+	env, err := client.Run(context.Background(), &RunRequest{Step: "build", Command: []string{"make"}})
+	require.NoError(t, err)
+	require.Equal(t, []byte("build"), env.Payload)
+	require.Equal(t, []string{"make"}, (<-requests).Command)
+
+	_, err = client.Run(context.Background(), &RunRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Run(context.Background(), &RunRequest{Step: "fail"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	require.Contains(t, err.Error(), "command failed")
+
+	// the socket can be listened on again once the server stops
+	server.Stop()
+	listener, err = ListenUnix(socket)
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+	require.NoFileExists(t, socket)
+}
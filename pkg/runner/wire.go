@@ -0,0 +1,150 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// wireMessage is implemented by the messages of the Runner service. They're small enough that encoding them by
+// hand is simpler than generating and vendoring code for them.
+type wireMessage interface {
+	marshal() []byte
+	unmarshal([]byte) error
+}
+
+// wireCodec encodes wireMessages in the protobuf wire format.
+type wireCodec struct{}
+
+func (wireCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T", v)
+	}
+
+	return m.marshal(), nil
+}
+
+func (wireCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T", v)
+	}
+
+	return m.unmarshal(data)
+}
+
+func (wireCodec) Name() string {
+	return "proto"
+}
+
+// RunRequest is witness.RunRequest.
+type RunRequest struct {
+	Step         string
+	Command      []string
+	WorkingDir   string
+	Attestations []string
+}
+
+func (r *RunRequest) marshal() []byte {
+	b := appendBytesField(nil, 1, []byte(r.Step))
+	for _, arg := range r.Command {
+		// repeated fields are written even when empty, so empty arguments aren't dropped from the command
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, arg)
+	}
+
+	b = appendBytesField(b, 3, []byte(r.WorkingDir))
+	for _, attestation := range r.Attestations {
+		b = appendBytesField(b, 4, []byte(attestation))
+	}
+
+	return b
+}
+
+func (r *RunRequest) unmarshal(data []byte) error {
+	return consumeBytesFields(data, func(num protowire.Number, value []byte) {
+		switch num {
+		case 1:
+			r.Step = string(value)
+		case 2:
+			r.Command = append(r.Command, string(value))
+		case 3:
+			r.WorkingDir = string(value)
+		case 4:
+			r.Attestations = append(r.Attestations, string(value))
+		}
+	})
+}
+
+// RunResponse is witness.RunResponse.
+type RunResponse struct {
+	Envelope []byte
+}
+
+func (r *RunResponse) marshal() []byte {
+	return appendBytesField(nil, 1, r.Envelope)
+}
+
+func (r *RunResponse) unmarshal(data []byte) error {
+	return consumeBytesFields(data, func(num protowire.Number, value []byte) {
+		if num == 1 {
+			r.Envelope = append([]byte{}, value...)
+		}
+	})
+}
+
+func appendBytesField(b []byte, num protowire.Number, value []byte) []byte {
+	if len(value) == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+// consumeBytesFields calls set with the number and value of every length delimited field, skipping any other
+// fields.
+func consumeBytesFields(data []byte, set func(protowire.Number, []byte)) error {
+	for len(data) > 0 {
+		fieldNum, fieldType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		data = data[n:]
+		if fieldType == protowire.BytesType {
+			value, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+
+			set(fieldNum, value)
+			data = data[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(fieldNum, fieldType, data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		data = data[n:]
+	}
+
+	return nil
+}
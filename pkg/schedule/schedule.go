@@ -0,0 +1,288 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schedule runs the attestors of a step concurrently where they don't depend on each other. go-witness runs
+// attestors one at a time in the order of their run types, so the scheduler splits the attestors of each run type
+// into waves of attestors that don't depend on each other and runs a whole wave when go-witness runs its first
+// attestor.
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/witness/pkg/wrap"
+)
+
+var (
+	_ attestation.Attestor   = &scheduledAttestor{}
+	_ attestation.Subjecter  = &scheduledAttestor{}
+	_ attestation.Materialer = &scheduledAttestor{}
+	_ attestation.Producer   = &scheduledAttestor{}
+	_ attestation.BackReffer = &scheduledAttestor{}
+)
+
+// runTypes are the run types in the order go-witness runs them.
+var runTypes = []attestation.RunType{
+	attestation.PreMaterialRunType,
+	attestation.MaterialRunType,
+	attestation.ExecuteRunType,
+	attestation.ProductRunType,
+	attestation.PostProductRunType,
+}
+
+var dependencies = map[string][]string{}
+
+// RegisterDependencies declares that the attestor named name reads what the attestors named dependsOn recorded, so
+// it must run after them. Attestors of earlier run types always finish first, so only dependencies on attestors of
+// the same run type change the schedule. It is meant to be called from the init function of the attestor's package.
+func RegisterDependencies(name string, dependsOn ...string) {
+	dependencies[name] = append(dependencies[name], dependsOn...)
+}
+
+// Order returns the attestors in the order go-witness runs them: by run type, keeping the order they were given in
+// within each run type. Attestors of unknown run types come last.
+func Order(attestors []attestation.Attestor) []attestation.Attestor {
+	position := map[attestation.RunType]int{}
+	for i, runType := range runTypes {
+		position[runType] = i
+	}
+
+	ordered := append([]attestation.Attestor{}, attestors...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		pi, ok := position[ordered[i].RunType()]
+		if !ok {
+			pi = len(runTypes)
+		}
+
+		pj, ok := position[ordered[j].RunType()]
+		if !ok {
+			pj = len(runTypes)
+		}
+
+		return pi < pj
+	})
+
+	return ordered
+}
+
+// Scheduler runs waves of attestors concurrently, at most maxConcurrency at once.
+type Scheduler struct {
+	maxConcurrency int
+}
+
+func New(maxConcurrency int) *Scheduler {
+	return &Scheduler{maxConcurrency: maxConcurrency}
+}
+
+// Apply orders the attestors of each run type after their dependencies and wraps them, so the first attestor of
+// each wave runs the whole wave and the rest return what they recorded. The context is only read while a wave runs,
+// since go-witness adds the materials and products of an attestor once it returns, so every attestor still sees
+// what the waves before it recorded. Execute attestors run one at a time, since they run the step's command. With a
+// concurrency of 1 or less the attestors are returned unchanged.
+func (s *Scheduler) Apply(attestors []attestation.Attestor) ([]attestation.Attestor, error) {
+	if s.maxConcurrency <= 1 {
+		return attestors, nil
+	}
+
+	position := map[attestation.RunType]int{}
+	for i, runType := range runTypes {
+		position[runType] = i
+	}
+
+	byRunType := map[attestation.RunType][]attestation.Attestor{}
+	order := map[string]int{}
+	for _, attestor := range attestors {
+		byRunType[attestor.RunType()] = append(byRunType[attestor.RunType()], attestor)
+		if i, ok := position[attestor.RunType()]; ok {
+			order[attestor.Name()] = i
+		}
+	}
+
+	applied := make([]attestation.Attestor, 0, len(attestors))
+	for i, runType := range runTypes {
+		for _, attestor := range byRunType[runType] {
+			for _, dependency := range dependencies[attestor.Name()] {
+				if dependencyOrder, ok := order[dependency]; ok && dependencyOrder > i {
+					return nil, fmt.Errorf("attestor %v depends on %v, which runs after it", attestor.Name(), dependency)
+				}
+			}
+		}
+
+		waves, err := s.waves(byRunType[runType])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, w := range waves {
+			for _, attestor := range w.attestors {
+				applied = append(applied, attestor)
+			}
+		}
+
+		delete(byRunType, runType)
+	}
+
+	// go-witness rejects attestors of unknown run types, so they are left for it to report
+	for _, attestor := range attestors {
+		if _, ok := byRunType[attestor.RunType()]; ok {
+			applied = append(applied, attestor)
+		}
+	}
+
+	return applied, nil
+}
+
+// waves groups attestors of a run type by how many of the others they transitively depend on, keeping the order
+// they were given in within each wave.
+func (s *Scheduler) waves(attestors []attestation.Attestor) ([]*wave, error) {
+	byName := map[string][]int{}
+	for i, attestor := range attestors {
+		byName[attestor.Name()] = append(byName[attestor.Name()], i)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(attestors))
+	levels := make([]int, len(attestors))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("attestor %v depends on itself", attestors[i].Name())
+		case visited:
+			return nil
+		}
+
+		state[i] = visiting
+		for _, dependency := range dependencies[attestors[i].Name()] {
+			for _, j := range byName[dependency] {
+				if err := visit(j); err != nil {
+					return err
+				}
+
+				if levels[j]+1 > levels[i] {
+					levels[i] = levels[j] + 1
+				}
+			}
+		}
+
+		state[i] = visited
+		return nil
+	}
+
+	waves := []*wave{}
+	for i := range attestors {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	sequential := len(attestors) > 0 && attestors[0].RunType() == attestation.ExecuteRunType
+	for level := 0; len(attestors) > 0; level++ {
+		var current *wave
+		remaining := false
+		for i, attestor := range attestors {
+			if levels[i] > level {
+				remaining = true
+			}
+
+			if levels[i] != level {
+				continue
+			}
+
+			if current == nil || sequential {
+				current = &wave{maxConcurrency: s.maxConcurrency}
+				waves = append(waves, current)
+			}
+
+			current.attestors = append(current.attestors, &scheduledAttestor{Forwarder: wrap.Forwarder{Attestor: attestor}, wave: current})
+		}
+
+		if !remaining {
+			break
+		}
+	}
+
+	return waves, nil
+}
+
+// wave is a set of attestors that don't depend on each other.
+type wave struct {
+	once           sync.Once
+	maxConcurrency int
+	attestors      []*scheduledAttestor
+}
+
+func (w *wave) run(ctx *attestation.AttestationContext) {
+	w.once.Do(func() {
+		slots := make(chan struct{}, w.maxConcurrency)
+		wg := sync.WaitGroup{}
+		for _, attestor := range w.attestors {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(a *scheduledAttestor) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+
+				a.startTime = time.Now()
+				a.err = a.Attestor.Attest(ctx)
+				a.endTime = time.Now()
+			}(attestor)
+		}
+
+		wg.Wait()
+	})
+}
+
+// scheduledAttestor runs its wave when go-witness runs it and returns the wrapped attestor's error. It is otherwise
+// transparent.
+type scheduledAttestor struct {
+	wrap.Forwarder
+	wave      *wave
+	startTime time.Time
+	endTime   time.Time
+	err       error
+}
+
+func (a *scheduledAttestor) Attest(ctx *attestation.AttestationContext) error {
+	a.wave.run(ctx)
+	return a.err
+}
+
+// Completed replaces the scheduled attestors in completed with the attestors they wrap and the times those ran,
+// since go-witness records how long it waited for each attestor rather than how long it ran.
+func Completed(completed []attestation.CompletedAttestor) []attestation.CompletedAttestor {
+	replaced := make([]attestation.CompletedAttestor, 0, len(completed))
+	for _, c := range completed {
+		if scheduled, ok := c.Attestor.(*scheduledAttestor); ok {
+			c.Attestor = scheduled.Attestor
+			c.StartTime = scheduled.startTime
+			c.EndTime = scheduled.endTime
+		}
+
+		replaced = append(replaced, c)
+	}
+
+	return replaced
+}
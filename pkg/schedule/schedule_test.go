@@ -0,0 +1,112 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+)
+
+// tracker records the order attestors finish in and how many ran at once.
+type tracker struct {
+	mu        sync.Mutex
+	active    int
+	maxActive int
+	finished  []string
+}
+
+type testAttestor struct {
+	name    string
+	runType attestation.RunType
+	tracker *tracker
+}
+
+func (a *testAttestor) Name() string                 { return a.name }
+func (a *testAttestor) Type() string                 { return "https://witness.dev/attestations/" + a.name + "/v0.1" }
+func (a *testAttestor) RunType() attestation.RunType { return a.runType }
+
+func (a *testAttestor) Attest(ctx *attestation.AttestationContext) error {
+	a.tracker.mu.Lock()
+	a.tracker.active++
+	if a.tracker.active > a.tracker.maxActive {
+		a.tracker.maxActive = a.tracker.active
+	}
+
+	a.tracker.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	a.tracker.mu.Lock()
+	a.tracker.active--
+	a.tracker.finished = append(a.tracker.finished, a.name)
+	a.tracker.mu.Unlock()
+	return nil
+}
+
+func TestApply(t *testing.T) {
+	RegisterDependencies("test-summary", "test-git", "test-run")
+	tr := &tracker{}
+	attestors := []attestation.Attestor{
+		&testAttestor{name: "test-summary", runType: attestation.PreMaterialRunType, tracker: tr},
+		&testAttestor{name: "test-run", runType: attestation.ExecuteRunType, tracker: tr},
+		&testAttestor{name: "test-git", runType: attestation.PreMaterialRunType, tracker: tr},
+		&testAttestor{name: "test-env", runType: attestation.PreMaterialRunType, tracker: tr},
+		&testAttestor{name: "test-aws", runType: attestation.PreMaterialRunType, tracker: tr},
+	}
+
+	// the summary depends on an attestor that runs after it
+	_, err := New(4).Apply(attestors)
+	require.ErrorContains(t, err, "depends on test-run, which runs after it")
+
+	attestors[1].(*testAttestor).runType = attestation.PreMaterialRunType
+	applied, err := New(2).Apply(attestors)
+	require.NoError(t, err)
+	ctx, err := attestation.NewContext(applied)
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	require.Equal(t, 2, tr.maxActive)
+	require.Equal(t, "test-summary", tr.finished[len(tr.finished)-1])
+
+	completed := Completed(ctx.CompletedAttestors())
+	require.Len(t, completed, len(attestors))
+	for _, c := range completed {
+		_, ok := c.Attestor.(*testAttestor)
+		require.True(t, ok)
+		require.False(t, c.StartTime.IsZero())
+		require.True(t, c.EndTime.Sub(c.StartTime) >= 50*time.Millisecond)
+	}
+
+	RegisterDependencies("test-git", "test-summary")
+	_, err = New(2).Apply(attestors)
+	require.ErrorContains(t, err, "depends on itself")
+
+	unchanged, err := New(1).Apply(attestors)
+	require.NoError(t, err)
+	require.Equal(t, attestors, unchanged)
+}
+
+func TestOrder(t *testing.T) {
+	product := &testAttestor{name: "test-product", runType: attestation.ProductRunType}
+	run := &testAttestor{name: "test-run", runType: attestation.ExecuteRunType}
+	git := &testAttestor{name: "test-git", runType: attestation.PreMaterialRunType}
+	env := &testAttestor{name: "test-env", runType: attestation.PreMaterialRunType}
+	unknown := &testAttestor{name: "test-unknown", runType: "later"}
+	attestors := []attestation.Attestor{unknown, product, run, git, env}
+	require.Equal(t, []attestation.Attestor{git, env, run, product, unknown}, Order(attestors))
+	require.Equal(t, unknown, attestors[0])
+}
@@ -0,0 +1,192 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scope restricts what attestors record to a subtree of the working directory, so a pipeline building
+// several targets of a monorepo can emit separate attestations for each target.
+package scope
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/git"
+	"github.com/testifysec/go-witness/attestation/material"
+	"github.com/testifysec/go-witness/attestation/product"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/witness/pkg/wrap"
+)
+
+var (
+	_ attestation.Attestor   = &scopedAttestor{}
+	_ attestation.Materialer = &scopedAttestor{}
+	_ attestation.Producer   = &scopedAttestor{}
+	_ attestation.Subjecter  = &scopedAttestor{}
+	_ attestation.BackReffer = &scopedAttestor{}
+)
+
+// Scope is a subtree of the working directory and the target it builds.
+type Scope struct {
+	Path   string
+	Target string
+}
+
+// New returns the scope for path, which must be relative to the working directory and inside it. The target
+// defaults to path with separators replaced by dashes, such as services-foo for services/foo.
+func New(scopePath, target string) (Scope, error) {
+	if filepath.IsAbs(scopePath) {
+		return Scope{}, fmt.Errorf("scope path %v must be relative to the working directory", scopePath)
+	}
+
+	cleaned := path.Clean(filepath.ToSlash(scopePath))
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return Scope{}, fmt.Errorf("scope path %v must be a subdirectory of the working directory", scopePath)
+	}
+
+	if target == "" {
+		target = strings.ReplaceAll(cleaned, "/", "-")
+	}
+
+	return Scope{Path: cleaned, Target: target}, nil
+}
+
+// StepName suffixes step with the scope's target.
+func (s Scope) StepName(step string) string {
+	return fmt.Sprintf("%v-%v", step, s.Target)
+}
+
+// Contains reports whether a slash separated path relative to the working directory is inside the scope.
+func (s Scope) Contains(p string) bool {
+	p = path.Clean(filepath.ToSlash(p))
+	return p == s.Path || strings.HasPrefix(p, s.Path+"/")
+}
+
+// Apply wraps the material, product, and git attestors so they only record files inside the scope. Other
+// attestors are returned unchanged.
+func (s Scope) Apply(attestors []attestation.Attestor) []attestation.Attestor {
+	applied := make([]attestation.Attestor, 0, len(attestors))
+	for _, attestor := range attestors {
+		switch attestor.Type() {
+		case material.Type, product.Type, git.Type:
+			applied = append(applied, &scopedAttestor{Forwarder: wrap.Forwarder{Attestor: attestor}, scope: s})
+		default:
+			applied = append(applied, attestor)
+		}
+	}
+
+	return applied
+}
+
+// scopedAttestor runs the wrapped attestor as normal and drops files outside the scope from what it reports and
+// from the attestation. The attestation keeps the wrapped attestor's type so it can be read back by the original
+// attestor.
+type scopedAttestor struct {
+	wrap.Forwarder
+	scope Scope
+}
+
+func (s *scopedAttestor) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(s.Attestor)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Type() != git.Type {
+		return s.filterJSON(data)
+	}
+
+	// git records the status of files in the repository under status, keyed by path
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	if status, ok := fields["status"]; ok {
+		if fields["status"], err = s.filterJSON(status); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+// filterJSON removes the paths outside the scope from a JSON object keyed by path.
+func (s *scopedAttestor) filterJSON(data []byte) ([]byte, error) {
+	byPath := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &byPath); err != nil {
+		return nil, err
+	}
+
+	for p := range byPath {
+		if !s.scope.Contains(p) {
+			delete(byPath, p)
+		}
+	}
+
+	return json.Marshal(byPath)
+}
+
+func (s *scopedAttestor) Materials() map[string]cryptoutil.DigestSet {
+	materials := make(map[string]cryptoutil.DigestSet)
+	materialer, ok := s.Attestor.(attestation.Materialer)
+	if !ok {
+		return materials
+	}
+
+	for p, digest := range materialer.Materials() {
+		if s.scope.Contains(p) {
+			materials[p] = digest
+		}
+	}
+
+	return materials
+}
+
+func (s *scopedAttestor) Products() map[string]attestation.Product {
+	products := make(map[string]attestation.Product)
+	producer, ok := s.Attestor.(attestation.Producer)
+	if !ok {
+		return products
+	}
+
+	for p, prod := range producer.Products() {
+		if s.scope.Contains(p) {
+			products[p] = prod
+		}
+	}
+
+	return products
+}
+
+// Subjects drops products outside the scope. Other subjects, such as the commit, don't name files and are kept.
+func (s *scopedAttestor) Subjects() map[string]cryptoutil.DigestSet {
+	subjects := make(map[string]cryptoutil.DigestSet)
+	subjecter, ok := s.Attestor.(attestation.Subjecter)
+	if !ok {
+		return subjects
+	}
+
+	for name, digest := range subjecter.Subjects() {
+		if strings.HasPrefix(name, "file:") && !s.scope.Contains(strings.TrimPrefix(name, "file:")) {
+			continue
+		}
+
+		subjects[name] = digest
+	}
+
+	return subjects
+}
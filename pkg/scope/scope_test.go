@@ -0,0 +1,111 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scope
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/attestation/git"
+	"github.com/testifysec/go-witness/attestation/material"
+	"github.com/testifysec/go-witness/attestation/product"
+)
+
+func TestNew(t *testing.T) {
+	s, err := New("./services/foo/", "")
+	require.NoError(t, err)
+	require.Equal(t, Scope{Path: "services/foo", Target: "services-foo"}, s)
+	require.Equal(t, "build-services-foo", s.StepName("build"))
+
+	s, err = New("services/foo", "foo")
+	require.NoError(t, err)
+	require.Equal(t, "build-foo", s.StepName("build"))
+
+	for _, invalid := range []string{".", "..", "../other", "services/../..", "/abs/path"} {
+		_, err := New(invalid, "")
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestContains(t *testing.T) {
+	s, err := New("services/foo", "")
+	require.NoError(t, err)
+	require.True(t, s.Contains("services/foo"))
+	require.True(t, s.Contains("services/foo/main.go"))
+	require.False(t, s.Contains("services/foobar/main.go"))
+	require.False(t, s.Contains("services/bar/main.go"))
+}
+
+func TestApply(t *testing.T) {
+	workingDir := t.TempDir()
+	for _, dir := range []string{"services/foo", "services/bar"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(workingDir, dir), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(workingDir, dir, "main.go"), []byte(dir), 0644))
+	}
+
+	s, err := New("services/foo", "")
+	require.NoError(t, err)
+	cmd := commandrun.New(commandrun.WithCommand([]string{"bash", "-c", "echo foo > services/foo/app && echo bar > services/bar/app"}))
+	attestors := s.Apply([]attestation.Attestor{material.New(), cmd, product.New()})
+	require.Same(t, cmd, attestors[1])
+
+	ctx, err := attestation.NewContext(attestors, attestation.WithWorkingDir(workingDir))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+
+	require.Contains(t, ctx.Materials(), "services/foo/main.go")
+	require.NotContains(t, ctx.Materials(), "services/bar/main.go")
+	require.Contains(t, ctx.Products(), "services/foo/app")
+	require.NotContains(t, ctx.Products(), "services/bar/app")
+
+	subjecter := attestors[2].(attestation.Subjecter)
+	require.Contains(t, subjecter.Subjects(), "file:services/foo/app")
+	require.NotContains(t, subjecter.Subjects(), "file:services/bar/app")
+
+	// the attestation can be read back by the original attestors
+	data, err := json.Marshal(attestors[0])
+	require.NoError(t, err)
+	materials := material.New()
+	require.NoError(t, json.Unmarshal(data, materials))
+	require.Contains(t, materials.Materials(), "services/foo/main.go")
+	require.NotContains(t, materials.Materials(), "services/bar/main.go")
+
+	data, err = json.Marshal(attestors[2])
+	require.NoError(t, err)
+	products := product.New()
+	require.NoError(t, json.Unmarshal(data, products))
+	require.Len(t, products.Products(), 1)
+}
+
+func TestGitStatus(t *testing.T) {
+	s, err := New("services/foo", "")
+	require.NoError(t, err)
+	g := git.New()
+	g.CommitHash = "abcd"
+	g.Status["services/foo/main.go"] = git.Status{Worktree: "modified"}
+	g.Status["README.md"] = git.Status{Worktree: "modified"}
+
+	data, err := json.Marshal(s.Apply([]attestation.Attestor{g})[0])
+	require.NoError(t, err)
+	roundTrip := git.New()
+	require.NoError(t, json.Unmarshal(data, roundTrip))
+	require.Equal(t, "abcd", roundTrip.CommitHash)
+	require.Equal(t, map[string]git.Status{"services/foo/main.go": {Worktree: "modified"}}, roundTrip.Status)
+}
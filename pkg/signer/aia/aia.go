@@ -0,0 +1,181 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package aia completes certificate chains by following the CA Issuers URLs of the Authority Information Access
+// extension, so signatures carry every intermediate a verifier needs even when the signer only has its leaf.
+package aia
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/digitorus/pkcs7"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+const (
+	// maxDepth bounds how many intermediates are fetched for a single leaf
+	maxDepth = 5
+	// maxCertSize bounds how much is read from a CA Issuers URL
+	maxCertSize = 1 << 20
+)
+
+// CompleteChain returns signer with its certificate chain completed from AIA when it has a certificate but no
+// intermediates. Any other signer is returned as is.
+func CompleteChain(ctx context.Context, hc *http.Client, signer cryptoutil.Signer) (cryptoutil.Signer, error) {
+	bundler, ok := signer.(cryptoutil.TrustBundler)
+	if !ok || bundler.Certificate() == nil || len(bundler.Intermediates()) > 0 {
+		return signer, nil
+	}
+
+	intermediates, err := FetchIntermediates(ctx, hc, bundler.Certificate())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(intermediates) == 0 {
+		return signer, nil
+	}
+
+	return &chainSigner{Signer: signer, cert: bundler.Certificate(), intermediates: intermediates, roots: bundler.Roots()}, nil
+}
+
+// FetchIntermediates follows the CA Issuers URLs starting at cert until it reaches a self-signed certificate or one
+// without any, and returns the intermediates found in order from the leaf. The self-signed root is not returned,
+// since it has to come from the policy to be trusted.
+func FetchIntermediates(ctx context.Context, hc *http.Client, cert *x509.Certificate) ([]*x509.Certificate, error) {
+	intermediates := []*x509.Certificate{}
+	current := cert
+	for len(current.IssuingCertificateURL) > 0 && !selfSigned(current) {
+		if len(intermediates) == maxDepth {
+			return nil, fmt.Errorf("certificate chain of %v is longer than %v intermediates", cert.Subject, maxDepth)
+		}
+
+		issuer, err := fetchIssuer(ctx, hc, current)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch issuer of %v: %w", current.Subject, err)
+		}
+
+		if selfSigned(issuer) {
+			break
+		}
+
+		intermediates = append(intermediates, issuer)
+		current = issuer
+	}
+
+	return intermediates, nil
+}
+
+func fetchIssuer(ctx context.Context, hc *http.Client, cert *x509.Certificate) (*x509.Certificate, error) {
+	var lastErr error
+	for _, issuerURL := range cert.IssuingCertificateURL {
+		candidates, err := fetchCertificates(ctx, hc, issuerURL)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		for _, candidate := range candidates {
+			if err := cert.CheckSignatureFrom(candidate); err == nil {
+				return candidate, nil
+			} else {
+				lastErr = fmt.Errorf("certificate from %v did not issue %v: %w", issuerURL, cert.Subject, err)
+			}
+		}
+	}
+
+	return nil, lastErr
+}
+
+// fetchCertificates downloads a DER or PEM certificate, or a PKCS #7 bundle as served with .p7c extensions.
+func fetchCertificates(ctx context.Context, hc *http.Client, issuerURL string) ([]*x509.Certificate, error) {
+	parsedURL, err := url.Parse(issuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported CA Issuers URL %v", issuerURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuerURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v returned %v", issuerURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCertSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) > maxCertSize {
+		return nil, fmt.Errorf("%v returned more than %v bytes", issuerURL, maxCertSize)
+	}
+
+	if cert, err := x509.ParseCertificate(body); err == nil {
+		return []*x509.Certificate{cert}, nil
+	}
+
+	if cert, err := cryptoutil.TryParseCertificate(body); err == nil {
+		return []*x509.Certificate{cert}, nil
+	}
+
+	if p7, err := pkcs7.Parse(body); err == nil && len(p7.Certificates) > 0 {
+		return p7.Certificates, nil
+	}
+
+	return nil, errors.New("response from " + issuerURL + " is not a certificate")
+}
+
+func selfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// chainSigner adds intermediates to a signer that already has a certificate. dsse embeds the chain of any signer
+// that is a cryptoutil.TrustBundler.
+type chainSigner struct {
+	cryptoutil.Signer
+	cert          *x509.Certificate
+	intermediates []*x509.Certificate
+	roots         []*x509.Certificate
+}
+
+func (s *chainSigner) Certificate() *x509.Certificate {
+	return s.cert
+}
+
+func (s *chainSigner) Intermediates() []*x509.Certificate {
+	return s.intermediates
+}
+
+func (s *chainSigner) Roots() []*x509.Certificate {
+	return s.roots
+}
@@ -0,0 +1,135 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aia
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitorus/pkcs7"
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCert(t *testing.T, name string, parent *testCert, isCA bool, issuerURL string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+
+	if issuerURL != "" {
+		template.IssuingCertificateURL = []string{issuerURL}
+	}
+
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+func TestCompleteChain(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	root := newCert(t, "root", nil, true, "")
+	intermediate := newCert(t, "intermediate", root, true, server.URL+"/root.cer")
+	issuing := newCert(t, "issuing", intermediate, true, server.URL+"/intermediate.p7c")
+	leaf := newCert(t, "leaf", issuing, false, server.URL+"/issuing.pem")
+	mux.HandleFunc("/root.cer", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(root.cert.Raw) })
+	mux.HandleFunc("/intermediate.p7c", func(w http.ResponseWriter, r *http.Request) {
+		bundle, err := pkcs7.DegenerateCertificate(intermediate.cert.Raw)
+		require.NoError(t, err)
+		_, _ = w.Write(bundle)
+	})
+	mux.HandleFunc("/issuing.pem", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuing.cert.Raw}))
+	})
+
+	x509Signer, err := cryptoutil.NewX509Signer(cryptoutil.NewECDSASigner(leaf.key, crypto.SHA256), leaf.cert, nil, nil)
+	require.NoError(t, err)
+	signer, err := CompleteChain(context.Background(), server.Client(), x509Signer)
+	require.NoError(t, err)
+	bundler, ok := signer.(cryptoutil.TrustBundler)
+	require.True(t, ok)
+	require.Equal(t, leaf.cert, bundler.Certificate())
+	require.Equal(t, []*x509.Certificate{issuing.cert, intermediate.cert}, bundler.Intermediates())
+
+	env, err := dsse.Sign("test", strings.NewReader("payload"), dsse.SignWithSigners(signer))
+	require.NoError(t, err)
+	require.Len(t, env.Signatures[0].Intermediates, 2)
+	_, err = env.Verify(dsse.VerifyWithRoots(root.cert))
+	require.NoError(t, err)
+}
+
+func TestCompleteChainKeepsExistingIntermediates(t *testing.T) {
+	root := newCert(t, "root", nil, true, "")
+	leaf := newCert(t, "leaf", root, false, "http://127.0.0.1:0/unreachable")
+	x509Signer, err := cryptoutil.NewX509Signer(cryptoutil.NewECDSASigner(leaf.key, crypto.SHA256), leaf.cert, []*x509.Certificate{root.cert}, nil)
+	require.NoError(t, err)
+	signer, err := CompleteChain(context.Background(), http.DefaultClient, x509Signer)
+	require.NoError(t, err)
+	require.Same(t, x509Signer, signer)
+
+	plain := cryptoutil.NewECDSASigner(leaf.key, crypto.SHA256)
+	signer, err = CompleteChain(context.Background(), http.DefaultClient, plain)
+	require.NoError(t, err)
+	require.Same(t, plain, signer)
+}
+
+func TestFetchIntermediatesRejectsWrongIssuer(t *testing.T) {
+	other := newCert(t, "other", nil, true, "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(other.cert.Raw) }))
+	defer server.Close()
+
+	root := newCert(t, "root", nil, true, "")
+	leaf := newCert(t, "leaf", root, false, server.URL)
+	_, err := FetchIntermediates(context.Background(), server.Client(), leaf.cert)
+	require.ErrorContains(t, err, "did not issue")
+}
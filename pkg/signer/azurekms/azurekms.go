@@ -0,0 +1,330 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package azurekms signs with keys stored in Azure Key Vault or Managed HSM, so private keys never leave the vault.
+// Witness hashes payloads itself and asks the vault to sign the digest, authenticating as the managed identity of the
+// host or as a service principal.
+//
+// EC keys on P-256 or P-384 sign with ECDSA, and RSA keys sign with RSA-PSS. The key is a bare public key that can be
+// used as a public key functionary.
+package azurekms
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+const apiVersion = "7.4"
+
+type jsonWebKey struct {
+	KID string `json:"kid"`
+	KTY string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type keyBundle struct {
+	Key jsonWebKey `json:"key"`
+}
+
+type signRequest struct {
+	Algorithm string `json:"alg"`
+	Value     string `json:"value"`
+}
+
+type signResult struct {
+	Value string `json:"value"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type AzureKMSSigner struct {
+	ctx        context.Context
+	hc         *http.Client
+	credential Credential
+	resource   string
+	kid        string
+	algorithm  string
+	hash       crypto.Hash
+	verifier   cryptoutil.Verifier
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+type Option func(*AzureKMSSigner)
+
+// WithHTTPClient sets the client used to reach Key Vault and the identity endpoints.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(s *AzureKMSSigner) {
+		s.hc = hc
+	}
+}
+
+// Signer returns a signer for the key at keyURL, such as https://myvault.vault.azure.net/keys/witness. A version may
+// be included in the URL to pin the key, and the current version is used otherwise.
+func Signer(ctx context.Context, keyURL string, credential Credential, opts ...Option) (cryptoutil.Signer, error) {
+	parsed, err := url.Parse(keyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key url %v: %w", keyURL, err)
+	}
+
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if parsed.Host == "" || len(segments) < 2 || len(segments) > 3 || segments[0] != "keys" {
+		return nil, fmt.Errorf("invalid key url %v, expected https://<vault>/keys/<name>[/<version>]", keyURL)
+	}
+
+	s := &AzureKMSSigner{ctx: ctx, hc: http.DefaultClient, credential: credential}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	// tokens are issued for the vault's cloud and service, such as https://vault.azure.net for
+	// myvault.vault.azure.net or https://managedhsm.azure.net for Managed HSM pools
+	if _, service, ok := strings.Cut(parsed.Hostname(), "."); ok {
+		s.resource = "https://" + service
+	} else {
+		s.resource = "https://" + parsed.Hostname()
+	}
+
+	bundle := keyBundle{}
+	if err := s.call(http.MethodGet, strings.TrimSuffix(keyURL, "/"), nil, &bundle); err != nil {
+		return nil, fmt.Errorf("failed to get key %v: %w", keyURL, err)
+	}
+
+	// signing with the versioned id keeps the signature and public key from different versions if the key rotates
+	s.kid = bundle.Key.KID
+	if s.kid == "" {
+		s.kid = keyURL
+	}
+
+	pub, err := publicKey(bundle.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %v: %w", keyURL, err)
+	}
+
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			s.algorithm, s.hash = "ES256", crypto.SHA256
+		case elliptic.P384():
+			s.algorithm, s.hash = "ES384", crypto.SHA384
+		default:
+			return nil, fmt.Errorf("key %v uses unsupported curve %v", keyURL, bundle.Key.Crv)
+		}
+
+		s.verifier = cryptoutil.NewECDSAVerifier(pub, s.hash)
+	case *rsa.PublicKey:
+		s.algorithm, s.hash = "PS256", crypto.SHA256
+		s.verifier = cryptoutil.NewRSAVerifier(pub, s.hash)
+	}
+
+	return s, nil
+}
+
+func publicKey(jwk jsonWebKey) (crypto.PublicKey, error) {
+	decode := func(field, value string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid %v", field)
+		}
+
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch jwk.KTY {
+	case "EC", "EC-HSM":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %v", jwk.Crv)
+		}
+
+		x, err := decode("x", jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decode("y", jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "RSA", "RSA-HSM":
+		n, err := decode("n", jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decode("e", jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid e")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	default:
+		return nil, fmt.Errorf("key type %v is not supported, only EC and RSA keys are", jwk.KTY)
+	}
+}
+
+func (s *AzureKMSSigner) KeyID() (string, error) {
+	return s.verifier.KeyID()
+}
+
+// Sign hashes the payload and has the vault sign the digest. The signature is verified before it is returned.
+func (s *AzureKMSSigner) Sign(r io.Reader) ([]byte, error) {
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := cryptoutil.DigestBytes(payload, s.hash)
+	if err != nil {
+		return nil, err
+	}
+
+	result := signResult{}
+	req := signRequest{Algorithm: s.algorithm, Value: base64.RawURLEncoding.EncodeToString(digest)}
+	if err := s.call(http.MethodPost, s.kid+"/sign", req, &result); err != nil {
+		return nil, fmt.Errorf("failed to sign with %v: %w", s.kid, err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(result.Value, "="))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signature from %v: %w", s.kid, err)
+	}
+
+	// key vault returns ECDSA signatures as the concatenation of r and s
+	if strings.HasPrefix(s.algorithm, "ES") {
+		half := len(sig) / 2
+		if sig, err = asn1.Marshal(struct{ R, S *big.Int }{new(big.Int).SetBytes(sig[:half]), new(big.Int).SetBytes(sig[half:])}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.verifier.Verify(bytes.NewReader(payload), sig); err != nil {
+		return nil, fmt.Errorf("key vault returned an invalid signature: %w", err)
+	}
+
+	return sig, nil
+}
+
+func (s *AzureKMSSigner) Verifier() (cryptoutil.Verifier, error) {
+	return s.verifier, nil
+}
+
+// accessToken returns a cached token until shortly before it expires, so long running commands such as witness serve
+// don't authenticate for every signature.
+func (s *AzureKMSSigner) accessToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Add(time.Minute).Before(s.expiresAt) {
+		return s.token, nil
+	}
+
+	token, expiresAt, err := s.credential.token(s.ctx, s.hc, s.resource)
+	if err != nil {
+		return "", err
+	}
+
+	s.token, s.expiresAt = token, expiresAt
+	return token, nil
+}
+
+func (s *AzureKMSSigner) call(method, endpoint string, body, result interface{}) error {
+	token, err := s.accessToken()
+	if err != nil {
+		return err
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reqBody = bytes.NewReader(bodyBytes)
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, method, endpoint+"?api-version="+apiVersion, reqBody)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.hc.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		errResp := errorResponse{}
+		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error.Code != "" {
+			return fmt.Errorf("%v: %v", errResp.Error.Code, errResp.Error.Message)
+		}
+
+		return fmt.Errorf("unexpected status %v: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	return json.Unmarshal(respBody, result)
+}
@@ -0,0 +1,192 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azurekms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault serves a single key of a vault, the IMDS token endpoint, and the Entra ID token endpoint of tenant
+// "contoso". Tokens issued through either endpoint are accepted by the vault.
+func fakeVault(t *testing.T, key crypto.Signer) (*httptest.Server, *int) {
+	tokenRequests := 0
+	b64 := base64.RawURLEncoding.EncodeToString
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metadata/identity/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("client_id") != "build-identity" {
+			http.Error(w, `{"error":"invalid_request","error_description":"identity not found"}`, http.StatusBadRequest)
+			return
+		}
+
+		tokenRequests++
+		_, _ = w.Write([]byte(`{"access_token":"mi-token","expires_in":"3599"}`))
+	})
+
+	mux.HandleFunc("/contoso/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.PostForm.Get("client_secret") != "secret" || r.PostForm.Get("grant_type") != "client_credentials" {
+			http.Error(w, `{"error":"invalid_client","error_description":"AADSTS7000215: Invalid client secret provided."}`, http.StatusUnauthorized)
+			return
+		}
+
+		tokenRequests++
+		_, _ = w.Write([]byte(`{"access_token":"sp-token","expires_in":3599}`))
+	})
+
+	var server *httptest.Server
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Query().Get("api-version") != apiVersion {
+			http.Error(w, "missing api-version", http.StatusBadRequest)
+			return false
+		}
+
+		auth := r.Header.Get("Authorization")
+		if auth != "Bearer mi-token" && auth != "Bearer sp-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"code":"Unauthorized","message":"AKV10000: Request is missing a Bearer or PoP token."}}`))
+			return false
+		}
+
+		return true
+	}
+
+	mux.HandleFunc("/keys/witness", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		jwk := jsonWebKey{KID: server.URL + "/keys/witness/v1"}
+		switch pub := key.Public().(type) {
+		case *ecdsa.PublicKey:
+			jwk.KTY, jwk.Crv = "EC-HSM", pub.Curve.Params().Name
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.X, jwk.Y = b64(pub.X.FillBytes(make([]byte, size))), b64(pub.Y.FillBytes(make([]byte, size)))
+		case *rsa.PublicKey:
+			jwk.KTY, jwk.N, jwk.E = "RSA", b64(pub.N.Bytes()), b64(big.NewInt(int64(pub.E)).Bytes())
+		}
+
+		require.NoError(t, json.NewEncoder(w).Encode(keyBundle{Key: jwk}))
+	})
+
+	mux.HandleFunc("/keys/witness/v1/sign", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		req := signRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		digest, err := base64.RawURLEncoding.DecodeString(req.Value)
+		require.NoError(t, err)
+		var sig []byte
+		switch key := key.(type) {
+		case *ecdsa.PrivateKey:
+			require.Equal(t, "ES256", req.Algorithm)
+			r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+			require.NoError(t, err)
+			sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		case *rsa.PrivateKey:
+			require.Equal(t, "PS256", req.Algorithm)
+			sig, err = rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, json.NewEncoder(w).Encode(signResult{Value: b64(sig)}))
+	})
+
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	original := imdsEndpoint
+	imdsEndpoint = server.URL + "/metadata/identity/oauth2/token"
+	t.Cleanup(func() { imdsEndpoint = original })
+	t.Setenv("AZURE_AUTHORITY_HOST", server.URL)
+	return server, &tokenRequests
+}
+
+func TestSigner(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	credentials := map[string]Credential{
+		"managed identity":  ManagedIdentity("build-identity"),
+		"service principal": ServicePrincipal("contoso", "witness", "secret"),
+	}
+
+	for keyName, key := range map[string]crypto.Signer{"ecdsa": ecKey, "rsa": rsaKey} {
+		for credentialName, credential := range credentials {
+			t.Run(keyName+" "+credentialName, func(t *testing.T) {
+				server, tokenRequests := fakeVault(t, key)
+				signer, err := Signer(context.Background(), server.URL+"/keys/witness", credential)
+				require.NoError(t, err)
+
+				verifier, err := signer.Verifier()
+				require.NoError(t, err)
+				for i := 0; i < 2; i++ {
+					sig, err := signer.Sign(strings.NewReader("payload"))
+					require.NoError(t, err)
+					require.NoError(t, verifier.Verify(strings.NewReader("payload"), sig))
+					require.Error(t, verifier.Verify(strings.NewReader("tampered"), sig))
+				}
+
+				// the token is reused until it expires
+				require.Equal(t, 1, *tokenRequests)
+			})
+		}
+	}
+}
+
+func TestSignerErrors(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	server, _ := fakeVault(t, key)
+
+	_, err = Signer(context.Background(), server.URL+"/keys/witness", ServicePrincipal("contoso", "witness", "wrong"))
+	require.ErrorContains(t, err, "Invalid client secret")
+
+	_, err = Signer(context.Background(), server.URL+"/keys/witness", ManagedIdentity("other-identity"))
+	require.ErrorContains(t, err, "identity not found")
+
+	_, err = Signer(context.Background(), server.URL+"/keys/missing", ManagedIdentity("build-identity"))
+	require.Error(t, err)
+
+	_, err = Signer(context.Background(), server.URL+"/secrets/witness", ManagedIdentity("build-identity"))
+	require.ErrorContains(t, err, "invalid key url")
+
+	_, err = Signer(context.Background(), server.URL+"/keys/witness", ServicePrincipal("", "witness", "secret"))
+	require.ErrorContains(t, err, "tenant id")
+}
+
+func TestPublicKeyValidation(t *testing.T) {
+	_, err := publicKey(jsonWebKey{KTY: "EC", Crv: "P-256", X: "AQ", Y: "AQ"})
+	require.ErrorContains(t, err, "not on the curve")
+
+	_, err = publicKey(jsonWebKey{KTY: "oct"})
+	require.ErrorContains(t, err, "not supported")
+}
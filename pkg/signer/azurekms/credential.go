@@ -0,0 +1,154 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azurekms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// imdsEndpoint is the token endpoint of the Azure Instance Metadata Service, which issues tokens to the managed
+	// identities of VMs, scale sets, and AKS nodes.
+	imdsEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	// defaultAuthorityHost is the Microsoft Entra ID host of the public cloud. AZURE_AUTHORITY_HOST overrides it for
+	// sovereign clouds.
+	defaultAuthorityHost = "https://login.microsoftonline.com"
+)
+
+// Credential gets access tokens for Key Vault.
+type Credential interface {
+	// token returns an access token for resource and when it expires.
+	token(ctx context.Context, hc *http.Client, resource string) (string, time.Time, error)
+}
+
+type managedIdentity struct {
+	clientID string
+}
+
+// ManagedIdentity authenticates as the managed identity of the host witness runs on. clientID selects a
+// user-assigned identity, and the system-assigned identity is used when it is empty.
+func ManagedIdentity(clientID string) Credential {
+	return managedIdentity{clientID: clientID}
+}
+
+func (m managedIdentity) token(ctx context.Context, hc *http.Client, resource string) (string, time.Time, error) {
+	query := url.Values{"api-version": {"2018-02-01"}, "resource": {resource}}
+	if m.clientID != "" {
+		query.Set("client_id", m.clientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imdsEndpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req.Header.Set("Metadata", "true")
+	token, expiresAt, err := doTokenRequest(hc, req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get managed identity token: %w", err)
+	}
+
+	return token, expiresAt, nil
+}
+
+type servicePrincipal struct {
+	tenantID     string
+	clientID     string
+	clientSecret string
+}
+
+// ServicePrincipal authenticates as an application registered in tenantID with a client secret.
+func ServicePrincipal(tenantID, clientID, clientSecret string) Credential {
+	return servicePrincipal{tenantID: tenantID, clientID: clientID, clientSecret: clientSecret}
+}
+
+func (s servicePrincipal) token(ctx context.Context, hc *http.Client, resource string) (string, time.Time, error) {
+	if s.tenantID == "" || s.clientID == "" || s.clientSecret == "" {
+		return "", time.Time{}, errors.New("a tenant id, client id, and client secret are required to authenticate as a service principal")
+	}
+
+	authority := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authority == "" {
+		authority = defaultAuthorityHost
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.clientID},
+		"client_secret": {s.clientSecret},
+		"scope":         {resource + "/.default"},
+	}
+
+	endpoint := strings.TrimSuffix(authority, "/") + "/" + url.PathEscape(s.tenantID) + "/oauth2/v2.0/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	token, expiresAt, err := doTokenRequest(hc, req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get service principal token: %w", err)
+	}
+
+	return token, expiresAt, nil
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	// ExpiresIn is a number from Entra ID and a string from IMDS.
+	ExpiresIn        json.Number `json:"expires_in"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+func doTokenRequest(hc *http.Client, req *http.Request) (string, time.Time, error) {
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	token := tokenResponse{}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", time.Time{}, fmt.Errorf("unexpected response with status %v: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("%v: %v", token.Error, token.ErrorDescription)
+	}
+
+	expiresIn, err := strconv.Atoi(token.ExpiresIn.String())
+	if err != nil {
+		expiresIn = 0
+	}
+
+	return token.AccessToken, time.Now().Add(time.Duration(expiresIn) * time.Second), nil
+}
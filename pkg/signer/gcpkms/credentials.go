@@ -0,0 +1,58 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpkms
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const scope = "https://www.googleapis.com/auth/cloudkms"
+
+// tokenSource returns the source of access tokens for Cloud KMS. Without a credentials file, Application Default
+// Credentials are found the way Google's client libraries find them: the file named by
+// GOOGLE_APPLICATION_CREDENTIALS, then the file written by gcloud auth application-default login, and then the
+// metadata server, which serves the attached service account on GCE, GKE with workload identity, and Cloud Build.
+// Credentials files may hold a service account key, user credentials, or an external_account configuration for
+// workload identity federation from other clouds and CI systems. Tokens are requested through hc.
+func tokenSource(ctx context.Context, hc *http.Client, path string) (oauth2.TokenSource, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, hc)
+	if path == "" {
+		creds, err := google.FindDefaultCredentials(ctx, scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find application default credentials: %w", err)
+		}
+
+		return creds.TokenSource, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	creds, err := google.CredentialsFromJSON(ctx, data, scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credentials file %v: %w", path, err)
+	}
+
+	// the token sources of credentials files aren't all cached, so tokens are reused until they expire
+	return oauth2.ReuseTokenSource(nil, creds.TokenSource), nil
+}
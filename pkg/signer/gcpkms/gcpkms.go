@@ -0,0 +1,229 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gcpkms signs with asymmetric signing keys in Google Cloud KMS, so private keys never leave KMS. It
+// authenticates with Application Default Credentials, so on GKE with workload identity and in Cloud Build witness
+// signs as the workload's service account without any key material on the machine.
+//
+// EC keys sign with ECDSA and RSA keys must use a PSS algorithm, since witness verifies RSA signatures with PSS. The
+// key is a bare public key that can be used as a public key functionary.
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"golang.org/x/oauth2"
+)
+
+const (
+	defaultEndpoint = "https://cloudkms.googleapis.com"
+
+	// referencePrefix may precede the resource name, as in the key references of cosign and sigstore
+	referencePrefix = "gcpkms://"
+)
+
+var keyVersionPattern = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+/cryptoKeyVersions/[^/]+$`)
+
+// algorithms are the Cloud KMS signing algorithms witness can verify, and the hash each signs digests of.
+var algorithms = map[string]crypto.Hash{
+	"EC_SIGN_P256_SHA256":      crypto.SHA256,
+	"EC_SIGN_P384_SHA384":      crypto.SHA384,
+	"RSA_SIGN_PSS_2048_SHA256": crypto.SHA256,
+	"RSA_SIGN_PSS_3072_SHA256": crypto.SHA256,
+	"RSA_SIGN_PSS_4096_SHA256": crypto.SHA256,
+	"RSA_SIGN_PSS_4096_SHA512": crypto.SHA512,
+}
+
+type publicKeyResponse struct {
+	PEM       string `json:"pem"`
+	Algorithm string `json:"algorithm"`
+}
+
+type signRequest struct {
+	Digest map[string][]byte `json:"digest"`
+}
+
+type signResponse struct {
+	Signature []byte `json:"signature"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+type GCPKMSSigner struct {
+	ctx             context.Context
+	hc              *http.Client
+	endpoint        string
+	credentialsFile string
+	tokenSource     oauth2.TokenSource
+	name            string
+	hash            crypto.Hash
+	verifier        cryptoutil.Verifier
+}
+
+type Option func(*GCPKMSSigner)
+
+// WithHTTPClient sets the client used to reach Cloud KMS and the token endpoints.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(s *GCPKMSSigner) {
+		s.hc = hc
+	}
+}
+
+// WithCredentialsFile authenticates with a service account key, user credentials, or external account file rather
+// than Application Default Credentials.
+func WithCredentialsFile(path string) Option {
+	return func(s *GCPKMSSigner) {
+		s.credentialsFile = path
+	}
+}
+
+// WithEndpoint sets the Cloud KMS endpoint, such as a regional or private service connect endpoint.
+func WithEndpoint(endpoint string) Option {
+	return func(s *GCPKMSSigner) {
+		s.endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+}
+
+// Signer returns a signer for the key version with resource name name, such as
+// projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1.
+func Signer(ctx context.Context, name string, opts ...Option) (cryptoutil.Signer, error) {
+	name = strings.TrimPrefix(name, referencePrefix)
+	if !keyVersionPattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid key version %v, expected projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>/cryptoKeyVersions/<version>", name)
+	}
+
+	s := &GCPKMSSigner{ctx: ctx, hc: http.DefaultClient, endpoint: defaultEndpoint, name: name}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	var err error
+	if s.tokenSource, err = tokenSource(ctx, s.hc, s.credentialsFile); err != nil {
+		return nil, err
+	}
+
+	key := publicKeyResponse{}
+	if err := s.call(http.MethodGet, "/publicKey", nil, &key); err != nil {
+		return nil, fmt.Errorf("failed to get public key of %v: %w", name, err)
+	}
+
+	hash, ok := algorithms[key.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("key %v uses algorithm %v, only ECDSA and RSA-PSS signing keys are supported", name, key.Algorithm)
+	}
+
+	s.hash = hash
+	if s.verifier, err = cryptoutil.NewVerifierFromReader(strings.NewReader(key.PEM), cryptoutil.VerifyWithHash(hash)); err != nil {
+		return nil, fmt.Errorf("failed to parse public key of %v: %w", name, err)
+	}
+
+	return s, nil
+}
+
+func (s *GCPKMSSigner) KeyID() (string, error) {
+	return s.verifier.KeyID()
+}
+
+// Sign hashes the payload and has Cloud KMS sign the digest. The signature is verified before it is returned.
+func (s *GCPKMSSigner) Sign(r io.Reader) ([]byte, error) {
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := cryptoutil.DigestBytes(payload, s.hash)
+	if err != nil {
+		return nil, err
+	}
+
+	hashName := strings.ToLower(strings.ReplaceAll(s.hash.String(), "-", ""))
+	resp := signResponse{}
+	if err := s.call(http.MethodPost, ":asymmetricSign", signRequest{Digest: map[string][]byte{hashName: digest}}, &resp); err != nil {
+		return nil, fmt.Errorf("failed to sign with %v: %w", s.name, err)
+	}
+
+	if err := s.verifier.Verify(bytes.NewReader(payload), resp.Signature); err != nil {
+		return nil, fmt.Errorf("cloud kms returned an invalid signature: %w", err)
+	}
+
+	return resp.Signature, nil
+}
+
+func (s *GCPKMSSigner) Verifier() (cryptoutil.Verifier, error) {
+	return s.verifier, nil
+}
+
+func (s *GCPKMSSigner) call(method, suffix string, body, result interface{}) error {
+	// tokens are cached until shortly before they expire, so long running commands such as witness serve don't
+	// authenticate for every signature
+	token, err := s.tokenSource.Token()
+	if err != nil {
+		return err
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reqBody = bytes.NewReader(bodyBytes)
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, method, s.endpoint+"/v1/"+s.name+suffix, reqBody)
+	if err != nil {
+		return err
+	}
+
+	token.SetAuthHeader(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.hc.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		errResp := errorResponse{}
+		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error.Message != "" {
+			return fmt.Errorf("%v: %v", errResp.Error.Status, errResp.Error.Message)
+		}
+
+		return errors.New(strings.TrimSpace(string(respBody)))
+	}
+
+	return json.Unmarshal(respBody, result)
+}
@@ -0,0 +1,248 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcpkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+const keyName = "projects/build/locations/global/keyRings/witness/cryptoKeys/attestations/cryptoKeyVersions/1"
+
+// fakeKMS serves a single key version, the metadata server's token endpoint, an OAuth token endpoint that accepts
+// JWTs signed by saKey, and a security token service that exchanges the subject token federated-token.
+func fakeKMS(t *testing.T, key crypto.Signer, algorithm string, saKey *rsa.PrivateKey) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/computeMetadata/v1/instance/service-accounts/default/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Query().Get("scopes") != scope {
+			http.Error(w, "missing metadata flavor", http.StatusForbidden)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"access_token":"workload-token","expires_in":3599,"token_type":"Bearer"}`))
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		require.Len(t, parts, 3)
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if rsa.VerifyPKCS1v15(&saKey.PublicKey, crypto.SHA256, digest[:], sig) != nil {
+			http.Error(w, `{"error":"invalid_grant","error_description":"Invalid JWT Signature."}`, http.StatusBadRequest)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"access_token":"sa-token","expires_in":3599,"token_type":"Bearer"}`))
+	})
+
+	mux.HandleFunc("/v1/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:token-exchange" || r.PostForm.Get("subject_token") != "federated-token" {
+			http.Error(w, `{"error":"invalid_grant","error_description":"The subject token is invalid."}`, http.StatusBadRequest)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"access_token":"sts-token","issued_token_type":"urn:ietf:params:oauth:token-type:access_token","token_type":"Bearer","expires_in":3599}`))
+	})
+
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		auth := r.Header.Get("Authorization")
+		if auth != "Bearer workload-token" && auth != "Bearer sa-token" && auth != "Bearer sts-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"code":401,"message":"Request had invalid authentication credentials.","status":"UNAUTHENTICATED"}}`))
+			return false
+		}
+
+		return true
+	}
+
+	mux.HandleFunc("/v1/"+keyName+"/publicKey", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		pub, err := cryptoutil.PublicPemBytes(key.Public())
+		require.NoError(t, err)
+		require.NoError(t, json.NewEncoder(w).Encode(publicKeyResponse{PEM: string(pub), Algorithm: algorithm}))
+	})
+
+	mux.HandleFunc("/v1/"+keyName+":asymmetricSign", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		req := signRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		digest := req.Digest["sha256"]
+		require.Len(t, digest, sha256.Size)
+		var sig []byte
+		var err error
+		switch key := key.(type) {
+		case *ecdsa.PrivateKey:
+			sig, err = ecdsa.SignASN1(rand.Reader, key, digest)
+		case *rsa.PrivateKey:
+			sig, err = rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+
+		require.NoError(t, err)
+		require.NoError(t, json.NewEncoder(w).Encode(signResponse{Signature: sig}))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	return server
+}
+
+func serviceAccountFile(t *testing.T, saKey *rsa.PrivateKey, tokenURI string) string {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(saKey)
+	require.NoError(t, err)
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "witness@build.iam.gserviceaccount.com",
+		"private_key_id": "abc123",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})),
+		"token_uri":      tokenURI,
+	})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "sa.json")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+// externalAccountFile writes a workload identity federation configuration that reads subjectToken from a file.
+func externalAccountFile(t *testing.T, subjectToken string) string {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenPath, []byte(subjectToken), 0600))
+	data, err := json.Marshal(map[string]interface{}{
+		"type":               "external_account",
+		"audience":           "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/ci/providers/github",
+		"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+		"token_url":          "https://sts.googleapis.com/v1/token",
+		"credential_source":  map[string]string{"file": tokenPath},
+	})
+	require.NoError(t, err)
+	path := filepath.Join(dir, "external.json")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+// redirect sends every request to server, so credentials that only allow Google's token endpoints reach the fake.
+type redirect struct {
+	server *httptest.Server
+}
+
+func (r redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, err := url.Parse(r.server.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host, req.Host = target.Scheme, target.Host, target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestSigner(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	saKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keys := map[string]struct {
+		key       crypto.Signer
+		algorithm string
+	}{
+		"ecdsa": {ecKey, "EC_SIGN_P256_SHA256"},
+		"rsa":   {rsaKey, "RSA_SIGN_PSS_2048_SHA256"},
+	}
+
+	for name, tc := range keys {
+		t.Run(name, func(t *testing.T) {
+			server := fakeKMS(t, tc.key, tc.algorithm, saKey)
+			credentialOpts := map[string][]Option{
+				"workload identity": nil,
+				"service account":   {WithCredentialsFile(serviceAccountFile(t, saKey, server.URL+"/token"))},
+				"external account":  {WithCredentialsFile(externalAccountFile(t, "federated-token")), WithHTTPClient(&http.Client{Transport: redirect{server}})},
+			}
+
+			for credentialName, opts := range credentialOpts {
+				signer, err := Signer(context.Background(), referencePrefix+keyName, append(opts, WithEndpoint(server.URL))...)
+				require.NoError(t, err, credentialName)
+				sig, err := signer.Sign(strings.NewReader("payload"))
+				require.NoError(t, err, credentialName)
+				verifier, err := signer.Verifier()
+				require.NoError(t, err)
+				require.NoError(t, verifier.Verify(strings.NewReader("payload"), sig))
+				require.Error(t, verifier.Verify(strings.NewReader("tampered"), sig))
+			}
+		})
+	}
+}
+
+func TestSignerErrors(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	saKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := fakeKMS(t, key, "RSA_SIGN_PKCS1_2048_SHA256", saKey)
+	_, err = Signer(context.Background(), keyName, WithEndpoint(server.URL))
+	require.ErrorContains(t, err, "only ECDSA and RSA-PSS")
+
+	_, err = Signer(context.Background(), keyName, WithEndpoint(server.URL), WithCredentialsFile(serviceAccountFile(t, otherKey, server.URL+"/token")))
+	require.ErrorContains(t, err, "Invalid JWT Signature")
+
+	_, err = Signer(context.Background(), "projects/build/locations/global/keyRings/witness/cryptoKeys/attestations", WithEndpoint(server.URL))
+	require.ErrorContains(t, err, "invalid key version")
+
+	client := &http.Client{Transport: redirect{server}}
+	_, err = Signer(context.Background(), keyName, WithEndpoint(server.URL), WithHTTPClient(client), WithCredentialsFile(externalAccountFile(t, "forged-token")))
+	require.ErrorContains(t, err, "The subject token is invalid")
+
+	unsupported := filepath.Join(t.TempDir(), "unsupported.json")
+	require.NoError(t, os.WriteFile(unsupported, []byte(`{"type":"gdch_service_account"}`), 0600))
+	_, err = Signer(context.Background(), keyName, WithEndpoint(server.URL), WithCredentialsFile(unsupported))
+	require.ErrorContains(t, err, "failed to load credentials file")
+}
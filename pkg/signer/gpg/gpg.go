@@ -0,0 +1,245 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gpg signs envelopes with OpenPGP keys and verifies OpenPGP signatures. Signatures are binary detached
+// OpenPGP signatures over the DSSE pre-authentication encoding, and keys are identified by the hex encoded
+// fingerprint of their primary key, so an OpenPGP functionary in a policy uses its fingerprint as its key id.
+package gpg
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+const publicKeyBlockType = "PGP PUBLIC KEY BLOCK"
+
+type KeySigner struct {
+	entity   *openpgp.Entity
+	verifier *Verifier
+}
+
+// Signer returns a signer for the OpenPGP private key at keyPath, which may be armored. If the key is
+// protected, passphrase is used to decrypt it.
+func Signer(keyPath string, passphrase []byte) (cryptoutil.Signer, error) {
+	keyFile, err := os.Open(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer keyFile.Close()
+	entities, err := readKeyRing(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entities) != 1 {
+		return nil, fmt.Errorf("expected 1 key in %v, found %v", keyPath, len(entities))
+	}
+
+	entity := entities[0]
+	if entity.PrivateKey == nil {
+		return nil, fmt.Errorf("%v does not contain a private key", keyPath)
+	}
+
+	if err := decrypt(entity, passphrase); err != nil {
+		return nil, err
+	}
+
+	publicKey := &bytes.Buffer{}
+	if err := entity.Serialize(publicKey); err != nil {
+		return nil, err
+	}
+
+	verifier, err := NewVerifier(publicKey.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeySigner{entity: entity, verifier: verifier}, nil
+}
+
+func decrypt(entity *openpgp.Entity, passphrase []byte) error {
+	if entity.PrivateKey.Encrypted {
+		if len(passphrase) == 0 {
+			return errors.New("key is protected by a passphrase, but none was provided")
+		}
+
+		if err := entity.PrivateKey.Decrypt(passphrase); err != nil {
+			return fmt.Errorf("failed to decrypt key: %w", err)
+		}
+	}
+
+	for _, subkey := range entity.Subkeys {
+		if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+			if err := subkey.PrivateKey.Decrypt(passphrase); err != nil {
+				return fmt.Errorf("failed to decrypt subkey: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *KeySigner) KeyID() (string, error) {
+	return s.verifier.KeyID()
+}
+
+func (s *KeySigner) Sign(r io.Reader) ([]byte, error) {
+	sig := &bytes.Buffer{}
+	if err := openpgp.DetachSign(sig, s.entity, r, nil); err != nil {
+		return nil, err
+	}
+
+	return sig.Bytes(), nil
+}
+
+func (s *KeySigner) Verifier() (cryptoutil.Verifier, error) {
+	return s.verifier, nil
+}
+
+// AgentSigner signs with the gpg binary, so keys held by gpg-agent, including keys on smartcards, can be used
+// without exporting them.
+type AgentSigner struct {
+	ctx      context.Context
+	gpgPath  string
+	keyID    string
+	verifier *Verifier
+}
+
+// NewAgentSigner returns a signer that asks gpg to sign with keyID, which can be anything gpg accepts for
+// --local-user, such as a fingerprint or email address.
+func NewAgentSigner(ctx context.Context, keyID string) (cryptoutil.Signer, error) {
+	gpgPath, err := exec.LookPath("gpg")
+	if err != nil {
+		return nil, fmt.Errorf("could not find gpg: %w", err)
+	}
+
+	s := &AgentSigner{ctx: ctx, gpgPath: gpgPath, keyID: keyID}
+	publicKey, err := s.gpg(nil, "--export", keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export public key: %w", err)
+	}
+
+	if len(publicKey) == 0 {
+		return nil, fmt.Errorf("gpg has no key for %v", keyID)
+	}
+
+	if s.verifier, err = NewVerifier(publicKey); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *AgentSigner) KeyID() (string, error) {
+	return s.verifier.KeyID()
+}
+
+func (s *AgentSigner) Sign(r io.Reader) ([]byte, error) {
+	return s.gpg(r, "--detach-sign", "--local-user", s.keyID, "--output", "-")
+}
+
+func (s *AgentSigner) Verifier() (cryptoutil.Verifier, error) {
+	return s.verifier, nil
+}
+
+func (s *AgentSigner) gpg(stdin io.Reader, args ...string) ([]byte, error) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(s.ctx, s.gpgPath, append([]string{"--batch", "--no-tty"}, args...)...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// Verifier verifies detached OpenPGP signatures made by a single key or any of its signing subkeys.
+type Verifier struct {
+	entity *openpgp.Entity
+}
+
+// NewVerifier returns a verifier for an OpenPGP public key, which may be armored.
+func NewVerifier(publicKey []byte) (*Verifier, error) {
+	entities, err := readKeyRing(bytes.NewReader(publicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entities) != 1 {
+		return nil, fmt.Errorf("expected 1 public key, found %v", len(entities))
+	}
+
+	return &Verifier{entity: entities[0]}, nil
+}
+
+// IsArmoredPublicKey returns true if data is an armored OpenPGP public key.
+func IsArmoredPublicKey(data []byte) bool {
+	block, err := armor.Decode(bytes.NewReader(data))
+	return err == nil && block.Type == publicKeyBlockType
+}
+
+func (v *Verifier) KeyID() (string, error) {
+	return hex.EncodeToString(v.entity.PrimaryKey.Fingerprint), nil
+}
+
+func (v *Verifier) Verify(body io.Reader, sig []byte) error {
+	_, err := openpgp.CheckDetachedSignature(openpgp.EntityList{v.entity}, body, bytes.NewReader(sig), nil)
+	return err
+}
+
+// Bytes returns the armored public key.
+func (v *Verifier) Bytes() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, publicKeyBlockType, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.entity.Serialize(w); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// readKeyRing reads armored or binary OpenPGP keys.
+func readKeyRing(r io.Reader) (openpgp.EntityList, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if block, err := armor.Decode(bytes.NewReader(data)); err == nil {
+		return openpgp.ReadKeyRing(block.Body)
+	}
+
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
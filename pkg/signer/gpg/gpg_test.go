@@ -0,0 +1,128 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gpg
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/stretchr/testify/require"
+)
+
+func writePrivateKey(t *testing.T, passphrase []byte) (string, *openpgp.Entity) {
+	entity, err := openpgp.NewEntity("witness", "", "witness@example.com", nil)
+	require.NoError(t, err)
+	if len(passphrase) > 0 {
+		require.NoError(t, entity.PrivateKey.Encrypt(passphrase))
+		for _, subkey := range entity.Subkeys {
+			require.NoError(t, subkey.PrivateKey.Encrypt(passphrase))
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PrivateKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.SerializePrivateWithoutSigning(w, nil))
+	require.NoError(t, w.Close())
+	keyPath := filepath.Join(t.TempDir(), "key.asc")
+	require.NoError(t, os.WriteFile(keyPath, buf.Bytes(), 0600))
+	return keyPath, entity
+}
+
+func TestSigner(t *testing.T) {
+	keyPath, entity := writePrivateKey(t, nil)
+	signer, err := Signer(keyPath, nil)
+	require.NoError(t, err)
+	keyID, err := signer.KeyID()
+	require.NoError(t, err)
+	require.Equal(t, hex.EncodeToString(entity.PrimaryKey.Fingerprint), keyID)
+
+	sig, err := signer.Sign(strings.NewReader("payload"))
+	require.NoError(t, err)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	require.NoError(t, verifier.Verify(strings.NewReader("payload"), sig))
+	require.Error(t, verifier.Verify(strings.NewReader("tampered"), sig))
+
+	publicKey, err := verifier.Bytes()
+	require.NoError(t, err)
+	require.True(t, IsArmoredPublicKey(publicKey))
+	parsed, err := NewVerifier(publicKey)
+	require.NoError(t, err)
+	parsedKeyID, err := parsed.KeyID()
+	require.NoError(t, err)
+	require.Equal(t, keyID, parsedKeyID)
+	require.NoError(t, parsed.Verify(strings.NewReader("payload"), sig))
+}
+
+func TestSignerPassphrase(t *testing.T) {
+	keyPath, _ := writePrivateKey(t, []byte("hunter2"))
+	_, err := Signer(keyPath, nil)
+	require.Error(t, err)
+	_, err = Signer(keyPath, []byte("wrong"))
+	require.Error(t, err)
+
+	signer, err := Signer(keyPath, []byte("hunter2"))
+	require.NoError(t, err)
+	sig, err := signer.Sign(strings.NewReader("payload"))
+	require.NoError(t, err)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	require.NoError(t, verifier.Verify(strings.NewReader("payload"), sig))
+}
+
+func TestIsArmoredPublicKey(t *testing.T) {
+	require.False(t, IsArmoredPublicKey([]byte("-----BEGIN PUBLIC KEY-----\nMAo=\n-----END PUBLIC KEY-----\n")))
+	require.False(t, IsArmoredPublicKey([]byte("not a key")))
+}
+
+func TestAgentSigner(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+
+	home, err := os.MkdirTemp("", "gnupg")
+	require.NoError(t, err)
+	defer os.RemoveAll(home)
+	t.Setenv("GNUPGHOME", home)
+	defer func() {
+		_ = exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+	}()
+
+	gen := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "witness-agent@example.com", "ed25519", "sign", "never")
+	if out, err := gen.CombinedOutput(); err != nil {
+		t.Skipf("failed to generate a gpg key: %v: %s", err, out)
+	}
+
+	signer, err := NewAgentSigner(context.Background(), "witness-agent@example.com")
+	require.NoError(t, err)
+	sig, err := signer.Sign(strings.NewReader("payload"))
+	require.NoError(t, err)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	require.NoError(t, verifier.Verify(strings.NewReader("payload"), sig))
+	require.Error(t, verifier.Verify(strings.NewReader("tampered"), sig))
+
+	_, err = NewAgentSigner(context.Background(), "nobody@example.com")
+	require.Error(t, err)
+}
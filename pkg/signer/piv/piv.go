@@ -0,0 +1,215 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package piv signs with keys held in the PIV applet of a hardware token such as a YubiKey. It talks to the applet
+// through yubico-piv-tool, which speaks PC/SC directly, so no PKCS#11 module has to be configured.
+//
+// Only ECC keys are supported, since PIV RSA keys produce PKCS #1 v1.5 signatures and witness verifies RSA signatures
+// with PSS. The certificate stored in the slot identifies the key. Self-signed certificates, as created by
+// `yubico-piv-tool -a selfsign-certificate`, are treated as bare public keys so they can be used as public key
+// functionaries, and any other certificate is included in signatures so it can be checked against a policy's roots.
+package piv
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/log"
+)
+
+const defaultTool = "yubico-piv-tool"
+
+type PIVSigner struct {
+	ctx       context.Context
+	tool      string
+	reader    string
+	slot      string
+	pin       string
+	algorithm string
+	hash      crypto.Hash
+	verifier  cryptoutil.Verifier
+}
+
+type Option func(*PIVSigner)
+
+// WithPIN verifies pin before each signature. The PIN is written to yubico-piv-tool's stdin with --stdin-input. Without
+// it yubico-piv-tool prompts for the PIN on the terminal.
+func WithPIN(pin string) Option {
+	return func(s *PIVSigner) {
+		s.pin = pin
+	}
+}
+
+// WithReader selects the token by a substring of its PC/SC reader name when more than one is connected.
+func WithReader(reader string) Option {
+	return func(s *PIVSigner) {
+		s.reader = reader
+	}
+}
+
+// WithTool sets the path to yubico-piv-tool.
+func WithTool(tool string) Option {
+	return func(s *PIVSigner) {
+		s.tool = tool
+	}
+}
+
+// Signer returns a signer for the key in slot, such as 9c, of the PIV applet.
+func Signer(ctx context.Context, slot string, opts ...Option) (cryptoutil.Signer, error) {
+	slot = strings.ToLower(slot)
+	if !validSlot(slot) {
+		return nil, fmt.Errorf("%v is not a PIV signing slot, expected one of 9a, 9c, 9d, 9e, or 82 through 95", slot)
+	}
+
+	s := &PIVSigner{ctx: ctx, tool: defaultTool, slot: slot}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	certPEM, err := s.run(nil, "-a", "read-certificate", "-s", slot, "-K", "PEM")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate from slot %v: %w", slot, err)
+	}
+
+	cert, err := cryptoutil.TryParseCertificate(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate from slot %v: %w", slot, err)
+	}
+
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("key in slot %v is a %T, only ECC keys are supported", slot, cert.PublicKey)
+	}
+
+	switch pub.Curve {
+	case elliptic.P256():
+		s.algorithm, s.hash = "ECCP256", crypto.SHA256
+	case elliptic.P384():
+		s.algorithm, s.hash = "ECCP384", crypto.SHA384
+	default:
+		return nil, fmt.Errorf("key in slot %v uses unsupported curve %v", slot, pub.Curve.Params().Name)
+	}
+
+	s.verifier = cryptoutil.NewECDSAVerifier(pub, s.hash)
+	if selfSigned(cert) {
+		return s, nil
+	}
+
+	return cryptoutil.NewX509Signer(s, cert, nil, nil)
+}
+
+func validSlot(slot string) bool {
+	switch slot {
+	case "9a", "9c", "9d", "9e":
+		return true
+	}
+
+	retired, err := strconv.ParseUint(slot, 16, 8)
+	return err == nil && len(slot) == 2 && retired >= 0x82 && retired <= 0x95
+}
+
+func selfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+func (s *PIVSigner) KeyID() (string, error) {
+	return s.verifier.KeyID()
+}
+
+// Sign asks the token to sign. Slot 9e doesn't require a PIN by default, so the PIN is only verified for it when one
+// was provided. Tokens with a touch policy block until they are touched.
+func (s *PIVSigner) Sign(r io.Reader) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "witness-piv")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+	// the payload and signature go through files so stdin stays free for the PIN prompt
+	inPath, outPath := filepath.Join(dir, "payload"), filepath.Join(dir, "signature")
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(inPath, payload, 0600); err != nil {
+		return nil, err
+	}
+
+	// the PIN is written to stdin rather than passed with -P, where any process could read it from the arguments
+	args := []string{}
+	var stdin io.Reader = os.Stdin
+	if s.slot != "9e" || s.pin != "" {
+		args = append(args, "-a", "verify-pin")
+		if s.pin != "" {
+			args = append(args, "--stdin-input")
+			stdin = strings.NewReader(s.pin + "\n")
+		}
+	}
+
+	args = append(args, "-a", "sign", "-s", s.slot, "-A", s.algorithm, "-H", strings.ReplaceAll(s.hash.String(), "-", ""), "-i", inPath, "-o", outPath)
+	log.Infof("Signing with PIV slot %v, touch the token if it flashes", s.slot)
+	if _, err := s.run(stdin, args...); err != nil {
+		return nil, fmt.Errorf("failed to sign with slot %v: %w", s.slot, err)
+	}
+
+	sig, err := os.ReadFile(outPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.verifier.Verify(bytes.NewReader(payload), sig); err != nil {
+		return nil, fmt.Errorf("token returned an invalid signature: %w", err)
+	}
+
+	return sig, nil
+}
+
+func (s *PIVSigner) Verifier() (cryptoutil.Verifier, error) {
+	return s.verifier, nil
+}
+
+func (s *PIVSigner) run(stdin io.Reader, args ...string) ([]byte, error) {
+	if s.reader != "" {
+		args = append([]string{"-r", s.reader}, args...)
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(s.ctx, s.tool, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("%v is required to use PIV tokens: %w", s.tool, err)
+		}
+
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return stdout.Bytes(), nil
+}
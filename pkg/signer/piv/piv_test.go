@@ -0,0 +1,174 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package piv
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+// TestHelperProcess stands in for yubico-piv-tool when run through the script written by fakeTool.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("PIV_TEST_HELPER") != "1" {
+		return
+	}
+
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+
+	flags := map[string]string{}
+	actions := []string{}
+	stdinInput := false
+	for i := 1; i < len(args); i++ {
+		switch {
+		case args[i] == "--stdin-input":
+			stdinInput = true
+		case i+1 == len(args):
+		case args[i] == "-a":
+			actions = append(actions, args[i+1])
+			i++
+		default:
+			flags[args[i]] = args[i+1]
+			i++
+		}
+	}
+
+	for _, action := range actions {
+		switch action {
+		case "read-certificate":
+			cert, _ := os.ReadFile(os.Getenv("PIV_TEST_CERT"))
+			fmt.Print(string(cert))
+		case "verify-pin":
+			// the PIN must never be passed in the arguments
+			pin := ""
+			if stdinInput {
+				line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				pin = strings.TrimSuffix(line, "\n")
+			}
+
+			if _, ok := flags["-P"]; ok || pin != os.Getenv("PIV_TEST_PIN") {
+				fmt.Fprintln(os.Stderr, "Pin verification failed")
+				os.Exit(1)
+			}
+		case "sign":
+			keyPEM, _ := os.ReadFile(os.Getenv("PIV_TEST_KEY"))
+			signer, err := cryptoutil.NewSignerFromReader(strings.NewReader(string(keyPEM)), cryptoutil.SignWithHash(crypto.SHA256))
+			if err != nil {
+				os.Exit(2)
+			}
+
+			in, _ := os.Open(flags["-i"])
+			sig, err := signer.Sign(in)
+			if err != nil {
+				os.Exit(2)
+			}
+
+			_ = os.WriteFile(flags["-o"], sig, 0600)
+		}
+	}
+
+	os.Exit(0)
+}
+
+func fakeTool(t *testing.T, selfSigned bool) string {
+	dir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "release-manager"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	parent, parentKey := template, key
+	if !selfSigned {
+		parentKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		parent = &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "ca"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign, NotBefore: template.NotBefore, NotAfter: template.NotAfter}
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cert.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600))
+
+	t.Setenv("PIV_TEST_HELPER", "1")
+	t.Setenv("PIV_TEST_KEY", filepath.Join(dir, "key.pem"))
+	t.Setenv("PIV_TEST_CERT", filepath.Join(dir, "cert.pem"))
+	t.Setenv("PIV_TEST_PIN", "123456")
+	tool := filepath.Join(dir, "yubico-piv-tool")
+	script := fmt.Sprintf("#!/bin/sh\nexec %q -test.run=TestHelperProcess -- \"$@\"\n", os.Args[0])
+	require.NoError(t, os.WriteFile(tool, []byte(script), 0700))
+	return tool
+}
+
+func TestSigner(t *testing.T) {
+	tool := fakeTool(t, true)
+	signer, err := Signer(context.Background(), "9C", WithTool(tool), WithPIN("123456"))
+	require.NoError(t, err)
+	require.IsType(t, &PIVSigner{}, signer)
+
+	sig, err := signer.Sign(strings.NewReader("payload"))
+	require.NoError(t, err)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	require.NoError(t, verifier.Verify(strings.NewReader("payload"), sig))
+	require.Error(t, verifier.Verify(strings.NewReader("tampered"), sig))
+
+	wrongPIN, err := Signer(context.Background(), "9c", WithTool(tool), WithPIN("000000"))
+	require.NoError(t, err)
+	_, err = wrongPIN.Sign(strings.NewReader("payload"))
+	require.ErrorContains(t, err, "Pin verification failed")
+}
+
+func TestSignerIncludesIssuedCertificate(t *testing.T) {
+	tool := fakeTool(t, false)
+	signer, err := Signer(context.Background(), "9a", WithTool(tool), WithPIN("123456"))
+	require.NoError(t, err)
+	require.IsType(t, &cryptoutil.X509Signer{}, signer)
+}
+
+func TestSignerInvalidSlot(t *testing.T) {
+	for _, slot := range []string{"9b", "81", "96", "", "zz", "082"} {
+		_, err := Signer(context.Background(), slot, WithTool("/nonexistent"))
+		require.ErrorContains(t, err, "not a PIV signing slot", slot)
+	}
+
+	_, err := Signer(context.Background(), "95", WithTool(filepath.Join(t.TempDir(), "missing")))
+	require.Error(t, err)
+}
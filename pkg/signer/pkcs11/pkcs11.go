@@ -0,0 +1,304 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pkcs11 signs with keys held in an HSM or token reached through its PKCS#11 module, such as a YubiHSM,
+// SoftHSM, or Luna HSM. It loads the module through OpenSC's pkcs11-tool, so witness itself doesn't link against
+// vendor libraries and the module is configured as it is for the rest of the host's PKCS#11 tooling.
+//
+// ECC keys on P-256 or P-384 sign with ECDSA, and RSA keys sign with RSA-PSS. Witness hashes payloads itself and asks
+// the token to sign the digest. Without a certificate the key is a bare public key that can be used as a public key
+// functionary. With one, such as the certificate an enterprise CA issued to the key, the certificate is included in
+// signatures so it can be checked against a policy's roots.
+package pkcs11
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+const defaultTool = "pkcs11-tool"
+
+// pinEnv is the environment variable pkcs11-tool reads the PIN from, so it never appears in the tool's arguments where
+// any process on the host could read it.
+const pinEnv = "WITNESS_PKCS11_PIN"
+
+type PKCS11Signer struct {
+	ctx       context.Context
+	tool      string
+	module    string
+	slot      string
+	pin       string
+	label     string
+	id        string
+	mechanism string
+	hash      crypto.Hash
+	verifier  cryptoutil.Verifier
+}
+
+type Option func(*PKCS11Signer)
+
+// WithSlot selects the token by the ID of the slot it is in. Without it pkcs11-tool uses the first slot with a token.
+func WithSlot(slot string) Option {
+	return func(s *PKCS11Signer) {
+		s.slot = slot
+	}
+}
+
+// WithPIN logs in to the token with pin before signing. The PIN is passed to pkcs11-tool in its environment, which
+// requires OpenSC 0.22 or later. Without it pkcs11-tool prompts for the PIN on the terminal.
+func WithPIN(pin string) Option {
+	return func(s *PKCS11Signer) {
+		s.pin = pin
+	}
+}
+
+// WithKeyLabel selects the key by the label of its objects.
+func WithKeyLabel(label string) Option {
+	return func(s *PKCS11Signer) {
+		s.label = label
+	}
+}
+
+// WithKeyID selects the key by the hex encoded ID of its objects, such as 01.
+func WithKeyID(id string) Option {
+	return func(s *PKCS11Signer) {
+		s.id = id
+	}
+}
+
+// WithTool sets the path to pkcs11-tool.
+func WithTool(tool string) Option {
+	return func(s *PKCS11Signer) {
+		s.tool = tool
+	}
+}
+
+// Signer returns a signer for a key of the token reached through module, the path to a PKCS#11 module such as
+// /usr/lib/softhsm/libsofthsm2.so. The key is selected by label, ID, or both. certificate is the PEM encoded
+// certificate of the key, if it has one.
+func Signer(ctx context.Context, module string, certificate []byte, opts ...Option) (cryptoutil.Signer, error) {
+	if module == "" {
+		return nil, errors.New("a pkcs11 module is required")
+	}
+
+	s := &PKCS11Signer{ctx: ctx, tool: defaultTool, module: module}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.label == "" && s.id == "" {
+		return nil, errors.New("a key label or key id is required")
+	}
+
+	dir, err := os.MkdirTemp("", "witness-pkcs11")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+	pubPath := filepath.Join(dir, "key.der")
+	if err := s.run(append(s.keyArgs(), "--read-object", "--type", "pubkey", "--output-file", pubPath)...); err != nil {
+		return nil, fmt.Errorf("failed to read public key of %v: %w", s, err)
+	}
+
+	pubDER, err := os.ReadFile(pubPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := parsePublicKey(pubDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key of %v: %w", s, err)
+	}
+
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			s.hash = crypto.SHA256
+		case elliptic.P384():
+			s.hash = crypto.SHA384
+		default:
+			return nil, fmt.Errorf("key %v uses unsupported curve %v", s, pub.Curve.Params().Name)
+		}
+
+		s.mechanism = "ECDSA"
+		s.verifier = cryptoutil.NewECDSAVerifier(pub, s.hash)
+	case *rsa.PublicKey:
+		s.mechanism, s.hash = "RSA-PKCS-PSS", crypto.SHA256
+		s.verifier = cryptoutil.NewRSAVerifier(pub, s.hash)
+	default:
+		return nil, fmt.Errorf("key %v is a %T, only ECC and RSA keys are supported", s, pub)
+	}
+
+	if len(certificate) == 0 {
+		return s, nil
+	}
+
+	cert, err := cryptoutil.TryParseCertificate(certificate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate of %v: %w", s, err)
+	}
+
+	certVerifier, err := cryptoutil.NewVerifier(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	certKeyID, err := certVerifier.KeyID()
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, err := s.verifier.KeyID()
+	if err != nil {
+		return nil, err
+	}
+
+	if certKeyID != keyID {
+		return nil, fmt.Errorf("certificate is not issued to key %v", s)
+	}
+
+	return cryptoutil.NewX509Signer(s, cert, nil, nil)
+}
+
+// parsePublicKey parses the DER public key pkcs11-tool writes, which is a PKIX public key for ECC keys and for RSA
+// keys with recent versions of OpenSC, and a PKCS #1 public key for RSA keys with older ones.
+func parsePublicKey(der []byte) (crypto.PublicKey, error) {
+	if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return pub, nil
+	}
+
+	return x509.ParsePKCS1PublicKey(der)
+}
+
+func (s *PKCS11Signer) String() string {
+	if s.label != "" {
+		return s.label
+	}
+
+	return "id " + s.id
+}
+
+func (s *PKCS11Signer) KeyID() (string, error) {
+	return s.verifier.KeyID()
+}
+
+// Sign hashes the payload, logs in to the token, and has it sign the digest.
+func (s *PKCS11Signer) Sign(r io.Reader) ([]byte, error) {
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := cryptoutil.DigestBytes(payload, s.hash)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "witness-pkcs11")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+	// the digest and signature go through files so stdin stays free for the PIN prompt
+	inPath, outPath := filepath.Join(dir, "digest"), filepath.Join(dir, "signature")
+	if err := os.WriteFile(inPath, digest, 0600); err != nil {
+		return nil, err
+	}
+
+	args := append(s.keyArgs(), "--login", "--sign", "--mechanism", s.mechanism, "--input-file", inPath, "--output-file", outPath)
+	if s.pin != "" {
+		args = append(args, "--pin", "env:"+pinEnv)
+	}
+
+	hashName := strings.ReplaceAll(s.hash.String(), "-", "")
+	if s.mechanism == "ECDSA" {
+		args = append(args, "--signature-format", "openssl")
+	} else {
+		args = append(args, "--hash-algorithm", hashName, "--mgf", "MGF1-"+hashName)
+	}
+
+	if err := s.run(args...); err != nil {
+		return nil, fmt.Errorf("failed to sign with %v: %w", s, err)
+	}
+
+	sig, err := os.ReadFile(outPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.verifier.Verify(bytes.NewReader(payload), sig); err != nil {
+		return nil, fmt.Errorf("token returned an invalid signature: %w", err)
+	}
+
+	return sig, nil
+}
+
+func (s *PKCS11Signer) Verifier() (cryptoutil.Verifier, error) {
+	return s.verifier, nil
+}
+
+func (s *PKCS11Signer) keyArgs() []string {
+	args := []string{}
+	if s.label != "" {
+		args = append(args, "--label", s.label)
+	}
+
+	if s.id != "" {
+		args = append(args, "--id", s.id)
+	}
+
+	return args
+}
+
+func (s *PKCS11Signer) run(args ...string) error {
+	args = append([]string{"--module", s.module}, args...)
+	if s.slot != "" {
+		args = append(args, "--slot", s.slot)
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(s.ctx, s.tool, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = stderr
+	if s.pin != "" {
+		cmd.Env = append(os.Environ(), pinEnv+"="+s.pin)
+	}
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%v is required to use pkcs11 tokens: %w", s.tool, err)
+		}
+
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkcs11
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+const testModule = "/usr/lib/softhsm/libsofthsm2.so"
+
+// TestHelperProcess stands in for pkcs11-tool when run through the script written by fakeTool.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("PKCS11_TEST_HELPER") != "1" {
+		return
+	}
+
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+
+	flags := map[string]string{}
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--read-object", "--sign", "--login":
+			flags[args[i]] = "true"
+		default:
+			if i+1 < len(args) {
+				flags[args[i]] = args[i+1]
+				i++
+			}
+		}
+	}
+
+	if flags["--module"] != testModule || flags["--slot"] != "1" || flags["--label"] != "witness" {
+		fmt.Fprintln(os.Stderr, "error: no matching key found")
+		os.Exit(1)
+	}
+
+	keyPEM, _ := os.ReadFile(os.Getenv("PKCS11_TEST_KEY"))
+	block, _ := pem.Decode(keyPEM)
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		os.Exit(2)
+	}
+
+	switch {
+	case flags["--read-object"] == "true":
+		pub, _ := x509.MarshalPKIXPublicKey(key.(crypto.Signer).Public())
+		_ = os.WriteFile(flags["--output-file"], pub, 0600)
+	case flags["--sign"] == "true":
+		if flags["--login"] != "true" || flags["--pin"] != "env:WITNESS_PKCS11_PIN" || os.Getenv("WITNESS_PKCS11_PIN") != "1234" {
+			fmt.Fprintln(os.Stderr, "error: PKCS11 function C_Login failed: rv = CKR_PIN_INCORRECT (0xa0)")
+			os.Exit(1)
+		}
+
+		digest, _ := os.ReadFile(flags["--input-file"])
+		var sig []byte
+		switch key := key.(type) {
+		case *ecdsa.PrivateKey:
+			if flags["--mechanism"] != "ECDSA" || flags["--signature-format"] != "openssl" {
+				os.Exit(3)
+			}
+
+			sig, _ = ecdsa.SignASN1(rand.Reader, key, digest)
+		case *rsa.PrivateKey:
+			if flags["--mechanism"] != "RSA-PKCS-PSS" || flags["--hash-algorithm"] != "SHA256" || flags["--mgf"] != "MGF1-SHA256" {
+				os.Exit(3)
+			}
+
+			sig, _ = rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+
+		_ = os.WriteFile(flags["--output-file"], sig, 0600)
+	}
+
+	os.Exit(0)
+}
+
+func fakeTool(t *testing.T, key crypto.Signer) string {
+	dir := t.TempDir()
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	t.Setenv("PKCS11_TEST_HELPER", "1")
+	t.Setenv("PKCS11_TEST_KEY", filepath.Join(dir, "key.pem"))
+	tool := filepath.Join(dir, "pkcs11-tool")
+	script := fmt.Sprintf("#!/bin/sh\nexec %q -test.run=TestHelperProcess -- \"$@\"\n", os.Args[0])
+	require.NoError(t, os.WriteFile(tool, []byte(script), 0700))
+	return tool
+}
+
+func TestSigner(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for name, key := range map[string]crypto.Signer{"ecdsa": ecKey, "rsa": rsaKey} {
+		t.Run(name, func(t *testing.T) {
+			tool := fakeTool(t, key)
+			signer, err := Signer(context.Background(), testModule, nil, WithTool(tool), WithSlot("1"), WithKeyLabel("witness"), WithPIN("1234"))
+			require.NoError(t, err)
+			require.IsType(t, &PKCS11Signer{}, signer)
+
+			sig, err := signer.Sign(strings.NewReader("payload"))
+			require.NoError(t, err)
+			verifier, err := signer.Verifier()
+			require.NoError(t, err)
+			require.NoError(t, verifier.Verify(strings.NewReader("payload"), sig))
+			require.Error(t, verifier.Verify(strings.NewReader("tampered"), sig))
+
+			wrongPIN, err := Signer(context.Background(), testModule, nil, WithTool(tool), WithSlot("1"), WithKeyLabel("witness"), WithPIN("0000"))
+			require.NoError(t, err)
+			_, err = wrongPIN.Sign(strings.NewReader("payload"))
+			require.ErrorContains(t, err, "CKR_PIN_INCORRECT")
+
+			_, err = Signer(context.Background(), testModule, nil, WithTool(tool), WithSlot("2"), WithKeyLabel("witness"))
+			require.ErrorContains(t, err, "no matching key found")
+		})
+	}
+}
+
+func TestSignerWithCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tool := fakeTool(t, key)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "ca"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	template := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "release"}, NotBefore: ca.NotBefore, NotAfter: ca.NotAfter}
+	issue := func(pub crypto.PublicKey) []byte {
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, pub, caKey)
+		require.NoError(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+
+	signer, err := Signer(context.Background(), testModule, issue(&key.PublicKey), WithTool(tool), WithSlot("1"), WithKeyLabel("witness"))
+	require.NoError(t, err)
+	require.IsType(t, &cryptoutil.X509Signer{}, signer)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = Signer(context.Background(), testModule, issue(&other.PublicKey), WithTool(tool), WithSlot("1"), WithKeyLabel("witness"))
+	require.ErrorContains(t, err, "not issued to key")
+}
+
+func TestSignerMissingTool(t *testing.T) {
+	_, err := Signer(context.Background(), testModule, nil, WithTool(filepath.Join(t.TempDir(), "pkcs11-tool")), WithKeyLabel("witness"))
+	require.ErrorContains(t, err, "is required to use pkcs11 tokens")
+
+	_, err = Signer(context.Background(), "", nil, WithKeyLabel("witness"))
+	require.Error(t, err)
+
+	_, err = Signer(context.Background(), testModule, nil)
+	require.ErrorContains(t, err, "key label or key id")
+}
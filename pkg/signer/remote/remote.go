@@ -0,0 +1,194 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote signs with a signing service, so private keys never have to be present where witness runs.
+//
+// The service must implement two endpoints:
+//
+//	GET  <url>/publickey?keyid=<keyid>
+//	  -> {"publickey": "<PEM>", "hash": "sha256", "certificate": "<PEM>", "intermediates": ["<PEM>"]}
+//	POST <url>/sign {"keyid": "<keyid>", "payload": "<base64>"}
+//	  -> {"signature": "<base64>"}
+//
+// The payload sent to the service is the DSSE pre-authentication encoding of the envelope being signed, and the
+// service must return a signature over it as the local key type would: RSA-PSS, ASN.1 encoded ECDSA, or ed25519.
+// hash, certificate, and intermediates are optional, and the key id is whatever the service uses to pick a key.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+type keyResponse struct {
+	PublicKey     string   `json:"publickey"`
+	Hash          string   `json:"hash,omitempty"`
+	Certificate   string   `json:"certificate,omitempty"`
+	Intermediates []string `json:"intermediates,omitempty"`
+}
+
+type signRequest struct {
+	KeyID   string `json:"keyid"`
+	Payload []byte `json:"payload"`
+}
+
+type signResponse struct {
+	Signature []byte `json:"signature"`
+}
+
+type RemoteSigner struct {
+	ctx      context.Context
+	hc       *http.Client
+	url      string
+	keyID    string
+	verifier cryptoutil.Verifier
+}
+
+// Signer returns a signer that signs with the key keyID of the signing service at serviceURL. hc should be
+// configured with the client certificate of witness and the roots trusted for the service when mTLS is required.
+// If the service returns a certificate for the key, the signer includes it and any intermediates in signatures.
+func Signer(ctx context.Context, hc *http.Client, serviceURL, keyID string) (cryptoutil.Signer, error) {
+	s := &RemoteSigner{
+		ctx:   ctx,
+		hc:    hc,
+		url:   serviceURL,
+		keyID: keyID,
+	}
+
+	key := keyResponse{}
+	if err := s.call(http.MethodGet, "publickey?keyid="+url.QueryEscape(keyID), nil, &key); err != nil {
+		return nil, fmt.Errorf("failed to get public key from signing service: %w", err)
+	}
+
+	hash := crypto.SHA256
+	if key.Hash != "" {
+		var err error
+		if hash, err = cryptoutil.HashFromString(strings.ToUpper(key.Hash)); err != nil {
+			return nil, err
+		}
+	}
+
+	verifier, err := cryptoutil.NewVerifierFromReader(strings.NewReader(key.PublicKey), cryptoutil.VerifyWithHash(hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key from signing service: %w", err)
+	}
+
+	s.verifier = verifier
+	if key.Certificate == "" {
+		return s, nil
+	}
+
+	cert, err := cryptoutil.TryParseCertificate([]byte(key.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate from signing service: %w", err)
+	}
+
+	intermediates := make([]*x509.Certificate, 0, len(key.Intermediates))
+	for _, intermediate := range key.Intermediates {
+		intermediateCert, err := cryptoutil.TryParseCertificate([]byte(intermediate))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse intermediate from signing service: %w", err)
+		}
+
+		intermediates = append(intermediates, intermediateCert)
+	}
+
+	return cryptoutil.NewX509Signer(s, cert, intermediates, nil)
+}
+
+func (s *RemoteSigner) KeyID() (string, error) {
+	return s.verifier.KeyID()
+}
+
+// Sign sends the payload to the signing service. The signature is verified before it is returned so a
+// misconfigured service can't produce envelopes that fail verification later.
+func (s *RemoteSigner) Sign(r io.Reader) ([]byte, error) {
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := signResponse{}
+	if err := s.call(http.MethodPost, "sign", signRequest{KeyID: s.keyID, Payload: payload}, &resp); err != nil {
+		return nil, fmt.Errorf("signing service failed to sign: %w", err)
+	}
+
+	if err := s.verifier.Verify(bytes.NewReader(payload), resp.Signature); err != nil {
+		return nil, fmt.Errorf("signing service returned an invalid signature: %w", err)
+	}
+
+	return resp.Signature, nil
+}
+
+func (s *RemoteSigner) Verifier() (cryptoutil.Verifier, error) {
+	return s.verifier, nil
+}
+
+func (s *RemoteSigner) call(method, path string, body, result interface{}) error {
+	endpoint, err := url.Parse(s.url)
+	if err != nil {
+		return err
+	}
+
+	ref, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+
+	endpoint = endpoint.JoinPath(ref.Path)
+	endpoint.RawQuery = ref.RawQuery
+	var reqBody io.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reqBody = bytes.NewReader(bodyBytes)
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, method, endpoint.String(), reqBody)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.hc.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(strings.TrimSpace(string(respBody)))
+	}
+
+	return json.Unmarshal(respBody, result)
+}
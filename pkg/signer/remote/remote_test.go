@@ -0,0 +1,152 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+)
+
+// signingService is a fake signing service that holds a single ECDSA key.
+func signingService(t *testing.T, corrupt bool) (*ecdsa.PrivateKey, http.Handler) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	pubPem, err := cryptoutil.PublicPemBytes(priv.Public())
+	require.NoError(t, err)
+	signer := cryptoutil.NewECDSASigner(priv, crypto.SHA256)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/publickey", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("keyid") != "build-key" {
+			http.Error(w, "unknown key", http.StatusNotFound)
+			return
+		}
+
+		require.NoError(t, json.NewEncoder(w).Encode(keyResponse{PublicKey: string(pubPem)}))
+	})
+
+	mux.HandleFunc("/sign", func(w http.ResponseWriter, r *http.Request) {
+		req := signRequest{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "build-key", req.KeyID)
+		if corrupt {
+			req.Payload = append(req.Payload, '!')
+		}
+
+		sig, err := signer.Sign(bytes.NewReader(req.Payload))
+		require.NoError(t, err)
+		require.NoError(t, json.NewEncoder(w).Encode(signResponse{Signature: sig}))
+	})
+
+	return priv, mux
+}
+
+func TestSigner(t *testing.T) {
+	priv, handler := signingService(t, false)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	s, err := Signer(context.Background(), server.Client(), server.URL, "build-key")
+	require.NoError(t, err)
+	expectedKeyID, err := cryptoutil.GeneratePublicKeyID(priv.Public(), crypto.SHA256)
+	require.NoError(t, err)
+	keyID, err := s.KeyID()
+	require.NoError(t, err)
+	require.Equal(t, expectedKeyID, keyID)
+
+	env, err := dsse.Sign("application/json", bytes.NewReader([]byte(`{}`)), dsse.SignWithSigners(s))
+	require.NoError(t, err)
+	verifier, err := s.Verifier()
+	require.NoError(t, err)
+	_, err = env.Verify(dsse.VerifyWithVerifiers(verifier))
+	require.NoError(t, err)
+
+	_, err = Signer(context.Background(), server.Client(), server.URL, "other-key")
+	require.ErrorContains(t, err, "unknown key")
+}
+
+func TestSignerRejectsInvalidSignature(t *testing.T) {
+	_, handler := signingService(t, true)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	s, err := Signer(context.Background(), server.Client(), server.URL, "build-key")
+	require.NoError(t, err)
+	_, err = s.Sign(bytes.NewReader([]byte("payload")))
+	require.ErrorContains(t, err, "invalid signature")
+}
+
+func TestSignerMutualTLS(t *testing.T) {
+	_, handler := signingService(t, false)
+	server := httptest.NewUnstartedServer(handler)
+	clientCert := selfSignedCert(t)
+	clientPool := x509.NewCertPool()
+	clientPool.AddCert(clientCert.Leaf)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientPool}
+	server.StartTLS()
+	defer server.Close()
+
+	_, err := Signer(context.Background(), server.Client(), server.URL, "build-key")
+	require.Error(t, err)
+
+	hc := server.Client()
+	hc.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{clientCert}
+	_, err = Signer(context.Background(), hc, server.URL, "build-key")
+	require.NoError(t, err)
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "witness"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(priv)
+	require.NoError(t, err)
+	cert, err := tls.X509KeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	)
+
+	require.NoError(t, err)
+	cert.Leaf, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
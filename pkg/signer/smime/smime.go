@@ -0,0 +1,140 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package smime signs with the S/MIME certificates an enterprise PKI issues to people, so human sign-offs such as
+// approvals are made with identities the organization already manages. Identities are read from PKCS #12 files, as
+// exported by browsers, mail clients, and the Windows certificate store. The certificate and any intermediates in
+// the file are included in signatures, so policies can trust the PKI's root and match approvers by email address.
+//
+// Only PKCS #12 files protected with the legacy SHA-1 and 3DES or RC2 algorithms can be read. Files exported by
+// OpenSSL 3 with its defaults can be converted with `openssl pkcs12 -export -legacy`.
+package smime
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// Signer returns a signer for the S/MIME identity in a PKCS #12 file. The certificate must be issued to an email
+// address and, if it limits its extended key usages, allow email protection.
+func Signer(pfxData []byte, password string) (*cryptoutil.X509Signer, error) {
+	blocks, err := pkcs12.ToPEM(pfxData, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pkcs12 file: %w", err)
+	}
+
+	var key crypto.PrivateKey
+	certs := make([]*x509.Certificate, 0)
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse certificate: %w", err)
+			}
+
+			certs = append(certs, cert)
+		case "PRIVATE KEY":
+			if key != nil {
+				return nil, errors.New("pkcs12 file has more than one private key")
+			}
+
+			if key, err = parsePrivateKey(block.Bytes); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if key == nil {
+		return nil, errors.New("pkcs12 file has no private key")
+	}
+
+	signer, err := cryptoutil.NewSigner(key)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, intermediates, err := splitChain(key, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSMIME(leaf); err != nil {
+		return nil, err
+	}
+
+	return cryptoutil.NewX509Signer(signer, leaf, intermediates, nil)
+}
+
+// parsePrivateKey parses the RSA or EC private keys pkcs12.ToPEM converts keys to.
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.New("unsupported private key in pkcs12 file")
+}
+
+// splitChain returns the certificate of key and the other certificates of the file, which are its intermediates.
+// Self-signed roots are left out, since they must come from the policy.
+func splitChain(key crypto.PrivateKey, certs []*x509.Certificate) (*x509.Certificate, []*x509.Certificate, error) {
+	public, ok := key.(interface{ Public() crypto.PublicKey })
+	if !ok {
+		return nil, nil, errors.New("unsupported private key in pkcs12 file")
+	}
+
+	var leaf *x509.Certificate
+	intermediates := make([]*x509.Certificate, 0)
+	for _, cert := range certs {
+		if keyEqual, ok := public.Public().(interface{ Equal(crypto.PublicKey) bool }); ok && keyEqual.Equal(cert.PublicKey) {
+			leaf = cert
+		} else if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			intermediates = append(intermediates, cert)
+		}
+	}
+
+	if leaf == nil {
+		return nil, nil, errors.New("pkcs12 file has no certificate for its private key")
+	}
+
+	return leaf, intermediates, nil
+}
+
+func checkSMIME(cert *x509.Certificate) error {
+	if len(cert.EmailAddresses) == 0 {
+		return fmt.Errorf("certificate %v has no email address, so it is not an S/MIME certificate", cert.Subject)
+	}
+
+	if len(cert.ExtKeyUsage) == 0 {
+		return nil
+	}
+
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageEmailProtection || usage == x509.ExtKeyUsageAny {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("certificate %v does not allow email protection, so it is not an S/MIME certificate", cert.Subject)
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package smime
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+func createCert(t *testing.T, template, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+// exportPKCS12 writes key and its certificates to a PKCS #12 file with openssl, as enterprise PKIs hand them out.
+func exportPKCS12(t *testing.T, key *ecdsa.PrivateKey, certs ...*x509.Certificate) []byte {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl is not installed")
+	}
+
+	dir := t.TempDir()
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+	certPEM := []byte{}
+	for _, cert := range certs {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "certs.pem"), certPEM, 0600))
+	out := filepath.Join(dir, "identity.p12")
+	cmd := exec.Command("openssl", "pkcs12", "-export", "-inkey", filepath.Join(dir, "key.pem"), "-in", filepath.Join(dir, "certs.pem"),
+		"-keypbe", "PBE-SHA1-3DES", "-certpbe", "PBE-SHA1-3DES", "-macalg", "sha1", "-passout", "pass:secret", "-out", out)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	return data
+}
+
+func TestSigner(t *testing.T) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Corp Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	root := createCert(t, rootTemplate, rootTemplate, rootKey, rootKey)
+
+	userKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	userTemplate := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		Subject:        pkix.Name{CommonName: "Alice"},
+		EmailAddresses: []string{"alice@example.com"},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	user := createCert(t, userTemplate, root, userKey, rootKey)
+
+	signer, err := Signer(exportPKCS12(t, userKey, user, root), "secret")
+	require.NoError(t, err)
+	require.Equal(t, []string{"alice@example.com"}, signer.Certificate().EmailAddresses)
+
+	sig, err := signer.Sign(bytes.NewReader([]byte("approved")))
+	require.NoError(t, err)
+	verifier, err := cryptoutil.NewX509Verifier(signer.Certificate(), nil, []*x509.Certificate{root}, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, verifier.Verify(bytes.NewReader([]byte("approved")), sig))
+
+	_, err = Signer(exportPKCS12(t, userKey, user), "wrong")
+	require.Error(t, err)
+
+	// certificates for other purposes aren't S/MIME identities
+	userTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	server := createCert(t, userTemplate, root, userKey, rootKey)
+	_, err = Signer(exportPKCS12(t, userKey, server), "secret")
+	require.Error(t, err)
+}
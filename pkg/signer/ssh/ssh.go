@@ -0,0 +1,282 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ssh signs envelopes with keys held by ssh-agent, including hardware backed FIDO sk- keys, and verifies
+// signatures made by SSH keys. Signatures use the SSHSIG format in the "witness" namespace, the same format git uses
+// for SSH commit signing, so they can also be checked with `ssh-keygen -Y verify -n witness` once armored. Keys are
+// identified by their SHA256 fingerprint as printed by `ssh-keygen -l`.
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"os"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	xssh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	Namespace     = "witness"
+	sigMagic      = "SSHSIG"
+	sigVersion    = 1
+	hashAlgorithm = "sha512"
+)
+
+type AgentSigner struct {
+	ctx        context.Context
+	socketPath string
+	publicKey  xssh.PublicKey
+	verifier   *Verifier
+}
+
+// Signer returns a signer for a key held by the ssh-agent listening on socketPath. key selects the key and may be
+// its SHA256 fingerprint, its comment, or the path to its public key file. If the agent holds a single key, key may
+// be empty.
+func Signer(ctx context.Context, socketPath, key string) (cryptoutil.Signer, error) {
+	if socketPath == "" {
+		socketPath = os.Getenv("SSH_AUTH_SOCK")
+	}
+
+	if socketPath == "" {
+		return nil, errors.New("no ssh-agent socket provided and SSH_AUTH_SOCK is not set")
+	}
+
+	s := &AgentSigner{ctx: ctx, socketPath: socketPath}
+	var keys []*agent.Key
+	if err := s.withAgent(func(a agent.ExtendedAgent) error {
+		var err error
+		keys, err = a.List()
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+
+	publicKey, err := selectKey(keys, key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publicKey = publicKey
+	s.verifier = &Verifier{publicKey: publicKey}
+	return s, nil
+}
+
+func selectKey(keys []*agent.Key, key string) (xssh.PublicKey, error) {
+	if key != "" {
+		if keyBytes, err := os.ReadFile(key); err == nil {
+			publicKey, _, _, _, err := xssh.ParseAuthorizedKey(keyBytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse public key %v: %w", key, err)
+			}
+
+			key = xssh.FingerprintSHA256(publicKey)
+		}
+	}
+
+	matches := make([]*agent.Key, 0, 1)
+	for _, k := range keys {
+		if key == "" || k.Comment == key || xssh.FingerprintSHA256(k) == key {
+			matches = append(matches, k)
+		}
+	}
+
+	switch {
+	case len(matches) == 0 && key == "":
+		return nil, errors.New("ssh-agent has no keys")
+	case len(matches) == 0:
+		return nil, fmt.Errorf("ssh-agent has no key matching %v", key)
+	case len(matches) > 1:
+		return nil, fmt.Errorf("ssh-agent has %v keys matching %q, select one by fingerprint", len(matches), key)
+	}
+
+	publicKey, err := xssh.ParsePublicKey(matches[0].Marshal())
+	if err != nil {
+		return nil, err
+	}
+
+	return publicKey, nil
+}
+
+func (s *AgentSigner) withAgent(f func(agent.ExtendedAgent) error) error {
+	conn, err := (&net.Dialer{}).DialContext(s.ctx, "unix", s.socketPath)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+	return f(agent.NewClient(conn))
+}
+
+func (s *AgentSigner) KeyID() (string, error) {
+	return s.verifier.KeyID()
+}
+
+func (s *AgentSigner) Sign(r io.Reader) ([]byte, error) {
+	signedData, err := signedData(r, hashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	// SSHSIG requires RSA keys to sign with SHA-512 rather than the legacy SHA-1 ssh-rsa algorithm
+	flags := agent.SignatureFlags(0)
+	if s.publicKey.Type() == xssh.KeyAlgoRSA {
+		flags = agent.SignatureFlagRsaSha512
+	}
+
+	var sig *xssh.Signature
+	if err := s.withAgent(func(a agent.ExtendedAgent) error {
+		sig, err = a.SignWithFlags(s.publicKey, signedData, flags)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("ssh-agent failed to sign: %w", err)
+	}
+
+	return sshSignature{
+		Version:       sigVersion,
+		PublicKey:     s.publicKey.Marshal(),
+		Namespace:     Namespace,
+		HashAlgorithm: hashAlgorithm,
+		Signature:     xssh.Marshal(sig),
+	}.marshal(), nil
+}
+
+func (s *AgentSigner) Verifier() (cryptoutil.Verifier, error) {
+	return s.verifier, nil
+}
+
+// sshSignature is an SSHSIG signature blob without the magic preamble.
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+func (s sshSignature) marshal() []byte {
+	return append([]byte(sigMagic), xssh.Marshal(s)...)
+}
+
+func parseSignature(sig []byte) (sshSignature, error) {
+	parsed := sshSignature{}
+	if !bytes.HasPrefix(sig, []byte(sigMagic)) {
+		return parsed, errors.New("not an SSHSIG signature")
+	}
+
+	if err := xssh.Unmarshal(sig[len(sigMagic):], &parsed); err != nil {
+		return parsed, fmt.Errorf("failed to parse signature: %w", err)
+	}
+
+	if parsed.Version != sigVersion {
+		return parsed, fmt.Errorf("unsupported signature version %v", parsed.Version)
+	}
+
+	return parsed, nil
+}
+
+// signedData returns the data SSHSIG signs, which covers the namespace and a hash of the message.
+func signedData(r io.Reader, hashAlgorithm string) ([]byte, error) {
+	var h hash.Hash
+	switch hashAlgorithm {
+	case "sha512":
+		h = sha512.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm %v", hashAlgorithm)
+	}
+
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+
+	return append([]byte(sigMagic), xssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{Namespace, "", hashAlgorithm, h.Sum(nil)})...), nil
+}
+
+// Verifier verifies SSHSIG signatures in the witness namespace made by a single SSH public key.
+type Verifier struct {
+	publicKey xssh.PublicKey
+}
+
+// NewVerifier returns a verifier for a public key in authorized_keys format, such as the contents of id_ed25519.pub.
+func NewVerifier(publicKey []byte) (*Verifier, error) {
+	parsed, _, _, _, err := xssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Verifier{publicKey: parsed}, nil
+}
+
+// IsPublicKey returns true if data is an SSH public key in authorized_keys format.
+func IsPublicKey(data []byte) bool {
+	_, _, _, _, err := xssh.ParseAuthorizedKey(data)
+	return err == nil
+}
+
+func (v *Verifier) KeyID() (string, error) {
+	return xssh.FingerprintSHA256(v.publicKey), nil
+}
+
+func (v *Verifier) Verify(body io.Reader, sig []byte) error {
+	parsed, err := parseSignature(sig)
+	if err != nil {
+		return err
+	}
+
+	if parsed.Namespace != Namespace {
+		return fmt.Errorf("signature is for namespace %q, expected %q", parsed.Namespace, Namespace)
+	}
+
+	if !bytes.Equal(parsed.PublicKey, v.publicKey.Marshal()) {
+		return errors.New("signature was made by a different key")
+	}
+
+	signature := &xssh.Signature{}
+	if err := xssh.Unmarshal(parsed.Signature, signature); err != nil {
+		return fmt.Errorf("failed to parse signature: %w", err)
+	}
+
+	// ssh-rsa signatures use SHA-1 and are not allowed by SSHSIG
+	if signature.Format == xssh.KeyAlgoRSA {
+		return errors.New("ssh-rsa signatures are not supported, sign with rsa-sha2-512")
+	}
+
+	data, err := signedData(body, parsed.HashAlgorithm)
+	if err != nil {
+		return err
+	}
+
+	return v.publicKey.Verify(data, signature)
+}
+
+// Bytes returns the public key in authorized_keys format.
+func (v *Verifier) Bytes() ([]byte, error) {
+	return bytes.TrimSpace(xssh.MarshalAuthorizedKey(v.publicKey)), nil
+}
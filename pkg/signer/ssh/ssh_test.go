@@ -0,0 +1,171 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	xssh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func startAgent(t *testing.T, keys map[string]crypto.PrivateKey) string {
+	keyring := agent.NewKeyring()
+	for comment, key := range keys {
+		require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: key, Comment: comment}))
+	}
+
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
+	return socketPath
+}
+
+func TestSigner(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	socketPath := startAgent(t, map[string]crypto.PrivateKey{"ed25519": edKey, "rsa": rsaKey, "ecdsa": ecKey})
+
+	for _, comment := range []string{"ed25519", "rsa", "ecdsa"} {
+		t.Run(comment, func(t *testing.T) {
+			signer, err := Signer(context.Background(), socketPath, comment)
+			require.NoError(t, err)
+			sig, err := signer.Sign(strings.NewReader("payload"))
+			require.NoError(t, err)
+
+			verifier, err := signer.Verifier()
+			require.NoError(t, err)
+			require.NoError(t, verifier.Verify(strings.NewReader("payload"), sig))
+			require.Error(t, verifier.Verify(strings.NewReader("tampered"), sig))
+
+			publicKey, err := verifier.Bytes()
+			require.NoError(t, err)
+			require.True(t, IsPublicKey(publicKey))
+			parsed, err := NewVerifier(publicKey)
+			require.NoError(t, err)
+			keyID, err := signer.KeyID()
+			require.NoError(t, err)
+			parsedKeyID, err := parsed.KeyID()
+			require.NoError(t, err)
+			require.Equal(t, keyID, parsedKeyID)
+			require.True(t, strings.HasPrefix(keyID, "SHA256:"))
+
+			signerByID, err := Signer(context.Background(), socketPath, keyID)
+			require.NoError(t, err)
+			otherKeyID, err := signerByID.KeyID()
+			require.NoError(t, err)
+			require.Equal(t, keyID, otherKeyID)
+		})
+	}
+
+	_, err = Signer(context.Background(), socketPath, "")
+	require.Error(t, err)
+	_, err = Signer(context.Background(), socketPath, "missing")
+	require.Error(t, err)
+}
+
+func TestVerifyRejectsOtherKeysAndNamespaces(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	socketPath := startAgent(t, map[string]crypto.PrivateKey{"key": key})
+	signer, err := Signer(context.Background(), socketPath, "")
+	require.NoError(t, err)
+	sig, err := signer.Sign(strings.NewReader("payload"))
+	require.NoError(t, err)
+
+	otherPublicKey, err := xssh.NewPublicKey(otherKey.Public())
+	require.NoError(t, err)
+	otherVerifier, err := NewVerifier(xssh.MarshalAuthorizedKey(otherPublicKey))
+	require.NoError(t, err)
+	require.Error(t, otherVerifier.Verify(strings.NewReader("payload"), sig))
+
+	parsed, err := parseSignature(sig)
+	require.NoError(t, err)
+	parsed.Namespace = "git"
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	require.ErrorContains(t, verifier.Verify(strings.NewReader("payload"), parsed.marshal()), "namespace")
+}
+
+func TestSignatureCompatibleWithSSHKeygen(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	socketPath := startAgent(t, map[string]crypto.PrivateKey{"key": key})
+	signer, err := Signer(context.Background(), socketPath, "key")
+	require.NoError(t, err)
+	sig, err := signer.Sign(strings.NewReader("payload"))
+	require.NoError(t, err)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	publicKey, err := verifier.Bytes()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	encoded := base64.StdEncoding.EncodeToString(sig)
+	armored := &strings.Builder{}
+	armored.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(encoded) > 70 {
+		armored.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+
+	armored.WriteString(encoded + "\n-----END SSH SIGNATURE-----\n")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "payload.sig"), []byte(armored.String()), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "allowed_signers"), []byte("witness@example.com "+string(publicKey)+"\n"), 0644))
+
+	cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", filepath.Join(dir, "allowed_signers"), "-I", "witness@example.com", "-n", Namespace, "-s", filepath.Join(dir, "payload.sig"))
+	cmd.Stdin = strings.NewReader("payload")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
@@ -0,0 +1,267 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tpm signs with keys that are bound to a TPM 2.0 and never leave it. It talks to the TPM through tpm2-tools,
+// so the TCTI that reaches the TPM, such as the kernel resource manager or a software TPM, is configured as it is for
+// the rest of the host's TPM tooling.
+//
+// The key must be an unrestricted signing key, since witness hashes payloads itself and asks the TPM to sign the
+// digest. ECC keys on P-256 or P-384 sign with ECDSA, and RSA keys sign with RSA-PSS. Without a certificate the key is
+// a bare public key that can be used as a public key functionary. With one, such as a certificate issued by an
+// enterprise CA after checking the key's attestation, the certificate is included in signatures so it can be checked
+// against a policy's roots.
+package tpm
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+const toolPrefix = "tpm2_"
+
+type TPMSigner struct {
+	ctx       context.Context
+	toolDir   string
+	tcti      string
+	key       string
+	authFile  string
+	scheme    string
+	hash      crypto.Hash
+	coordSize int
+	verifier  cryptoutil.Verifier
+}
+
+type Option func(*TPMSigner)
+
+// WithTCTI sets the TCTI tpm2-tools reaches the TPM through, such as device:/dev/tpmrm0 or swtpm:port=2321. Without
+// it tpm2-tools uses $TPM2TOOLS_TCTI or its default.
+func WithTCTI(tcti string) Option {
+	return func(s *TPMSigner) {
+		s.tcti = tcti
+	}
+}
+
+// WithAuthFile authorizes use of the key with the auth value in authFile.
+func WithAuthFile(authFile string) Option {
+	return func(s *TPMSigner) {
+		s.authFile = authFile
+	}
+}
+
+// WithToolDir looks for tpm2-tools in dir rather than on the PATH.
+func WithToolDir(dir string) Option {
+	return func(s *TPMSigner) {
+		s.toolDir = dir
+	}
+}
+
+// Signer returns a signer for key, a persistent handle such as 0x81010001 or a path to a context file saved by
+// tpm2_load. certificate is the PEM encoded certificate of the key, if it has one.
+func Signer(ctx context.Context, key string, certificate []byte, opts ...Option) (cryptoutil.Signer, error) {
+	if key == "" {
+		return nil, errors.New("a persistent handle or context file of the key is required")
+	}
+
+	s := &TPMSigner{ctx: ctx, key: key}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	dir, err := os.MkdirTemp("", "witness-tpm")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+	pubPath := filepath.Join(dir, "key.pem")
+	if _, err := s.run("readpublic", "-c", key, "-f", "pem", "-o", pubPath); err != nil {
+		return nil, fmt.Errorf("failed to read public key of %v: %w", key, err)
+	}
+
+	pubPEM, err := os.ReadFile(pubPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := cryptoutil.TryParseKeyFromReader(bytes.NewReader(pubPEM))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key of %v: %w", key, err)
+	}
+
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			s.hash = crypto.SHA256
+		case elliptic.P384():
+			s.hash = crypto.SHA384
+		default:
+			return nil, fmt.Errorf("key %v uses unsupported curve %v", key, pub.Curve.Params().Name)
+		}
+
+		s.scheme, s.coordSize = "ecdsa", (pub.Curve.Params().BitSize+7)/8
+		s.verifier = cryptoutil.NewECDSAVerifier(pub, s.hash)
+	case *rsa.PublicKey:
+		s.scheme, s.hash = "rsapss", crypto.SHA256
+		s.verifier = cryptoutil.NewRSAVerifier(pub, s.hash)
+	default:
+		return nil, fmt.Errorf("key %v is a %T, only ECC and RSA keys are supported", key, pub)
+	}
+
+	if len(certificate) == 0 {
+		return s, nil
+	}
+
+	cert, err := cryptoutil.TryParseCertificate(certificate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate of %v: %w", key, err)
+	}
+
+	certVerifier, err := cryptoutil.NewVerifier(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	certKeyID, err := certVerifier.KeyID()
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, err := s.verifier.KeyID()
+	if err != nil {
+		return nil, err
+	}
+
+	if certKeyID != keyID {
+		return nil, fmt.Errorf("certificate is not issued to key %v", key)
+	}
+
+	return cryptoutil.NewX509Signer(s, cert, nil, nil)
+}
+
+func (s *TPMSigner) KeyID() (string, error) {
+	return s.verifier.KeyID()
+}
+
+// Sign hashes the payload and has the TPM sign the digest.
+func (s *TPMSigner) Sign(r io.Reader) ([]byte, error) {
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := cryptoutil.DigestBytes(payload, s.hash)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "witness-tpm")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+	inPath, outPath := filepath.Join(dir, "digest"), filepath.Join(dir, "signature")
+	if err := os.WriteFile(inPath, digest, 0600); err != nil {
+		return nil, err
+	}
+
+	args := []string{"-c", s.key, "-g", strings.ToLower(strings.ReplaceAll(s.hash.String(), "-", "")), "-s", s.scheme, "-f", "plain", "-d", "-o", outPath}
+	if s.authFile != "" {
+		args = append(args, "-p", "file:"+s.authFile)
+	}
+
+	if _, err := s.run("sign", append(args, inPath)...); err != nil {
+		return nil, fmt.Errorf("failed to sign with %v: %w", s.key, err)
+	}
+
+	sig, err := os.ReadFile(outPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.scheme == "ecdsa" {
+		sig = s.derSignature(sig)
+	}
+
+	if err := s.verifier.Verify(bytes.NewReader(payload), sig); err != nil {
+		return nil, fmt.Errorf("tpm returned an invalid signature: %w", err)
+	}
+
+	return sig, nil
+}
+
+// derSignature returns an ECDSA signature in the DER encoding witness verifies. Older versions of tpm2-tools write
+// plain ECDSA signatures as the concatenation of r and s rather than in DER.
+func (s *TPMSigner) derSignature(sig []byte) []byte {
+	parsed := struct{ R, S *big.Int }{}
+	if rest, err := asn1.Unmarshal(sig, &parsed); err == nil && len(rest) == 0 {
+		return sig
+	}
+
+	if len(sig) != 2*s.coordSize {
+		return sig
+	}
+
+	der, err := asn1.Marshal(struct{ R, S *big.Int }{new(big.Int).SetBytes(sig[:s.coordSize]), new(big.Int).SetBytes(sig[s.coordSize:])})
+	if err != nil {
+		return sig
+	}
+
+	return der
+}
+
+func (s *TPMSigner) Verifier() (cryptoutil.Verifier, error) {
+	return s.verifier, nil
+}
+
+func (s *TPMSigner) run(tool string, args ...string) ([]byte, error) {
+	if s.tcti != "" {
+		args = append([]string{"-T", s.tcti}, args...)
+	}
+
+	path := toolPrefix + tool
+	if s.toolDir != "" {
+		path = filepath.Join(s.toolDir, path)
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(s.ctx, path, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("tpm2-tools is required to use TPM keys: %w", err)
+		}
+
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpm
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+// TestHelperProcess stands in for tpm2-tools when run through the scripts written by fakeTools.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("TPM_TEST_HELPER") != "1" {
+		return
+	}
+
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+
+	flags := map[string]string{}
+	positional := []string{}
+	for i := 2; i < len(args); i++ {
+		switch {
+		case args[i] == "-d":
+			flags["-d"] = "true"
+		case strings.HasPrefix(args[i], "-") && i+1 < len(args):
+			flags[args[i]] = args[i+1]
+			i++
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+
+	if flags["-c"] != "0x81010001" || flags["-T"] != "swtpm:port=2321" {
+		fmt.Fprintln(os.Stderr, "ERROR: unknown handle")
+		os.Exit(1)
+	}
+
+	keyPEM, _ := os.ReadFile(os.Getenv("TPM_TEST_KEY"))
+	block, _ := pem.Decode(keyPEM)
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		os.Exit(2)
+	}
+
+	switch args[1] {
+	case "readpublic":
+		pub, _ := cryptoutil.PublicPemBytes(key.(crypto.Signer).Public())
+		_ = os.WriteFile(flags["-o"], pub, 0600)
+	case "sign":
+		if flags["-p"] != "file:"+os.Getenv("TPM_TEST_AUTH") || flags["-d"] != "true" || flags["-f"] != "plain" {
+			fmt.Fprintln(os.Stderr, "ERROR: authorization failed")
+			os.Exit(1)
+		}
+
+		digest, _ := os.ReadFile(positional[0])
+		var sig []byte
+		switch key := key.(type) {
+		case *ecdsa.PrivateKey:
+			r, s, _ := ecdsa.Sign(rand.Reader, key, digest)
+			// older tpm2-tools write r and s concatenated
+			sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		case *rsa.PrivateKey:
+			sig, _ = rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+
+		_ = os.WriteFile(flags["-o"], sig, 0600)
+	}
+
+	os.Exit(0)
+}
+
+func fakeTools(t *testing.T, key crypto.Signer) string {
+	dir := t.TempDir()
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "auth"), []byte("secret"), 0600))
+
+	t.Setenv("TPM_TEST_HELPER", "1")
+	t.Setenv("TPM_TEST_KEY", filepath.Join(dir, "key.pem"))
+	t.Setenv("TPM_TEST_AUTH", filepath.Join(dir, "auth"))
+	for _, tool := range []string{"readpublic", "sign"} {
+		script := fmt.Sprintf("#!/bin/sh\nexec %q -test.run=TestHelperProcess -- %v \"$@\"\n", os.Args[0], tool)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, toolPrefix+tool), []byte(script), 0700))
+	}
+
+	return dir
+}
+
+func TestSigner(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for name, key := range map[string]crypto.Signer{"ecdsa": ecKey, "rsa": rsaKey} {
+		t.Run(name, func(t *testing.T) {
+			dir := fakeTools(t, key)
+			signer, err := Signer(context.Background(), "0x81010001", nil, WithToolDir(dir), WithTCTI("swtpm:port=2321"), WithAuthFile(filepath.Join(dir, "auth")))
+			require.NoError(t, err)
+			require.IsType(t, &TPMSigner{}, signer)
+
+			sig, err := signer.Sign(strings.NewReader("payload"))
+			require.NoError(t, err)
+			verifier, err := signer.Verifier()
+			require.NoError(t, err)
+			require.NoError(t, verifier.Verify(strings.NewReader("payload"), sig))
+			require.Error(t, verifier.Verify(strings.NewReader("tampered"), sig))
+
+			unauthorized, err := Signer(context.Background(), "0x81010001", nil, WithToolDir(dir), WithTCTI("swtpm:port=2321"))
+			require.NoError(t, err)
+			_, err = unauthorized.Sign(strings.NewReader("payload"))
+			require.ErrorContains(t, err, "authorization failed")
+		})
+	}
+}
+
+func TestSignerWithCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	dir := fakeTools(t, key)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "ca"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	template := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "build-01"}, NotBefore: ca.NotBefore, NotAfter: ca.NotAfter}
+	issue := func(pub crypto.PublicKey) []byte {
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, pub, caKey)
+		require.NoError(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+
+	signer, err := Signer(context.Background(), "0x81010001", issue(&key.PublicKey), WithToolDir(dir), WithTCTI("swtpm:port=2321"))
+	require.NoError(t, err)
+	require.IsType(t, &cryptoutil.X509Signer{}, signer)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = Signer(context.Background(), "0x81010001", issue(&other.PublicKey), WithToolDir(dir), WithTCTI("swtpm:port=2321"))
+	require.ErrorContains(t, err, "not issued to key")
+}
+
+func TestSignerMissingTools(t *testing.T) {
+	_, err := Signer(context.Background(), "0x81010001", nil, WithToolDir(t.TempDir()))
+	require.ErrorContains(t, err, "tpm2-tools is required")
+
+	_, err = Signer(context.Background(), "", nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,52 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statement
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/testifysec/go-witness/attestation"
+)
+
+// SourceDateEpochEnv is the environment variable reproducible builds set to the time their outputs record.
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// SourceDateEpoch returns the time in SOURCE_DATE_EPOCH, in seconds since the Unix epoch, or the Unix epoch itself
+// if it isn't set.
+func SourceDateEpoch() (time.Time, error) {
+	value := os.Getenv(SourceDateEpochEnv)
+	if value == "" {
+		return time.Unix(0, 0).UTC(), nil
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %v %q: %w", SourceDateEpochEnv, value, err)
+	}
+
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// SetTimes records every attestation of a collection as starting and ending at t, so when a run happened doesn't
+// change its statement. The zero time leaves the times out of the statement.
+func SetTimes(collection *attestation.Collection, t time.Time) {
+	for i := range collection.Attestations {
+		collection.Attestations[i].StartTime = t
+		collection.Attestations[i].EndTime = t
+	}
+}
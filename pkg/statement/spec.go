@@ -0,0 +1,185 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statement
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/testifysec/go-witness/intoto"
+)
+
+const (
+	// Version01 is version 0.1 of the in-toto statement (ITE-6), which go-witness writes and every release of
+	// witness verifies.
+	Version01 = "v0.1"
+	// Version1 is version 1 of the in-toto statement. Its subjects are resource descriptors (ITE-7), of which the
+	// name and digest witness records are a subset, so only the type of the statement changes.
+	Version1 = "v1"
+
+	// TypeV1 is the type of version 1 statements.
+	TypeV1 = "https://in-toto.io/Statement/v1"
+)
+
+var versionTypes = map[string]string{
+	Version01: intoto.StatementType,
+	Version1:  TypeV1,
+}
+
+// standardAlgorithms are the digest algorithms the in-toto attestation framework defines for digest sets. Strict
+// consumers reject any other, such as the gitoids witness records.
+var standardAlgorithms = map[string]bool{
+	"sha256": true, "sha224": true, "sha384": true, "sha512": true, "sha512_224": true, "sha512_256": true,
+	"sha3_224": true, "sha3_256": true, "sha3_384": true, "sha3_512": true, "shake128": true, "shake256": true,
+	"blake2b": true, "blake2s": true, "ripemd160": true, "sm3": true, "gost": true, "sha1": true, "md5": true,
+	"dirHash": true, "gitCommit": true, "gitTree": true, "gitBlob": true, "gitTag": true,
+}
+
+// Versions returns the versions of the in-toto statement witness can write.
+func Versions() []string {
+	versions := make([]string, 0, len(versionTypes))
+	for version := range versionTypes {
+		versions = append(versions, version)
+	}
+
+	sort.Strings(versions)
+	return versions
+}
+
+// TypeOfVersion returns the type of statements of version.
+func TypeOfVersion(version string) (string, error) {
+	statementType, ok := versionTypes[version]
+	if !ok {
+		return "", fmt.Errorf("unknown in-toto statement version %v, expected one of %v", version, strings.Join(Versions(), ", "))
+	}
+
+	return statementType, nil
+}
+
+// Format is the version of the in-toto statement witness writes and whether it strictly follows the specification.
+type Format struct {
+	Version string
+	Strict  bool
+}
+
+// Apply rewrites a statement into the format. An empty version keeps the statement's type. Strict statements only
+// keep subject digests of the algorithms the specification defines, and a statement that still violates the
+// specification is rejected rather than signed.
+func (f Format) Apply(st intoto.Statement) (intoto.Statement, error) {
+	if f.Version != "" {
+		statementType, err := TypeOfVersion(f.Version)
+		if err != nil {
+			return intoto.Statement{}, err
+		}
+
+		st.Type = statementType
+	}
+
+	if !f.Strict {
+		return st, nil
+	}
+
+	subjects := make([]intoto.Subject, 0, len(st.Subject))
+	for _, subject := range st.Subject {
+		digests := make(map[string]string, len(subject.Digest))
+		for algorithm, digest := range subject.Digest {
+			if standardAlgorithms[algorithm] {
+				digests[algorithm] = digest
+			}
+		}
+
+		subjects = append(subjects, intoto.Subject{Name: subject.Name, Digest: digests})
+	}
+
+	st.Subject = subjects
+	if err := Check(st); err != nil {
+		return intoto.Statement{}, err
+	}
+
+	return st, nil
+}
+
+// Check returns an error describing every way st violates the version of the in-toto statement specification it
+// claims to follow, or nil if it doesn't.
+func Check(st intoto.Statement) error {
+	violations := []string{}
+	version := ""
+	for v, statementType := range versionTypes {
+		if st.Type == statementType {
+			version = v
+		}
+	}
+
+	if version == "" {
+		violations = append(violations, fmt.Sprintf("unknown statement type %q", st.Type))
+	}
+
+	if len(st.Subject) == 0 {
+		violations = append(violations, "no subjects")
+	}
+
+	names := map[string]bool{}
+	for i, subject := range st.Subject {
+		if subject.Name == "" && version == Version01 {
+			violations = append(violations, fmt.Sprintf("subject %v has no name", i+1))
+		}
+
+		if names[subject.Name] && subject.Name != "" {
+			violations = append(violations, fmt.Sprintf("subject %v appears more than once", subject.Name))
+		}
+
+		names[subject.Name] = true
+		if len(subject.Digest) == 0 {
+			violations = append(violations, fmt.Sprintf("subject %q has no digests", subject.Name))
+		}
+
+		algorithms := make([]string, 0, len(subject.Digest))
+		for algorithm := range subject.Digest {
+			algorithms = append(algorithms, algorithm)
+		}
+
+		sort.Strings(algorithms)
+		for _, algorithm := range algorithms {
+			digest := subject.Digest[algorithm]
+			if !standardAlgorithms[algorithm] {
+				violations = append(violations, fmt.Sprintf("subject %q has a digest of unknown algorithm %v", subject.Name, algorithm))
+			} else if _, err := hex.DecodeString(digest); err != nil || digest == "" || strings.ToLower(digest) != digest {
+				violations = append(violations, fmt.Sprintf("subject %q has a %v digest that isn't lowercase hex", subject.Name, algorithm))
+			}
+		}
+	}
+
+	if u, err := url.Parse(st.PredicateType); err != nil || u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+		violations = append(violations, fmt.Sprintf("predicate type %q isn't an absolute URI", st.PredicateType))
+	}
+
+	if trimmed := bytes.TrimSpace(st.Predicate); len(trimmed) > 0 {
+		object := map[string]json.RawMessage{}
+		if err := json.Unmarshal(trimmed, &object); err != nil {
+			violations = append(violations, "predicate isn't a JSON object")
+		}
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("statement doesn't follow the in-toto specification: %v", strings.Join(violations, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statement
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/intoto"
+)
+
+const testDigest = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestFormat(t *testing.T) {
+	st := intoto.Statement{
+		Type:          intoto.StatementType,
+		PredicateType: attestation.CollectionType,
+		Subject: []intoto.Subject{{
+			Name:   "file:app",
+			Digest: map[string]string{"sha256": testDigest, "gitoid:sha256": "gitoid:blob:sha256:" + testDigest},
+		}},
+		Predicate: []byte(`{"name":"build"}`),
+	}
+
+	// witness's own statements use gitoids, which strict consumers reject
+	require.ErrorContains(t, Check(st), "unknown algorithm gitoid:sha256")
+
+	lenient, err := Format{Version: Version1}.Apply(st)
+	require.NoError(t, err)
+	require.Equal(t, TypeV1, lenient.Type)
+	require.Len(t, lenient.Subject[0].Digest, 2)
+
+	strict, err := Format{Version: Version1, Strict: true}.Apply(st)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"sha256": testDigest}, strict.Subject[0].Digest)
+	require.NoError(t, Check(strict))
+	require.Len(t, st.Subject[0].Digest, 2)
+
+	_, err = Format{Version: "v2"}.Apply(st)
+	require.ErrorContains(t, err, "unknown in-toto statement version v2")
+
+	kept, err := Format{}.Apply(st)
+	require.NoError(t, err)
+	require.Equal(t, intoto.StatementType, kept.Type)
+
+	onlyGitoids := st
+	onlyGitoids.Subject = []intoto.Subject{{Name: "file:app", Digest: map[string]string{"gitoid:sha1": "gitoid:blob:sha1:abc"}}}
+	_, err = Format{Strict: true}.Apply(onlyGitoids)
+	require.ErrorContains(t, err, `subject "file:app" has no digests`)
+}
+
+func TestCheck(t *testing.T) {
+	require.NoError(t, Check(intoto.Statement{
+		Type:          TypeV1,
+		PredicateType: "https://slsa.dev/provenance/v1",
+		Subject:       []intoto.Subject{{Digest: map[string]string{"sha256": testDigest}}},
+	}))
+
+	err := Check(intoto.Statement{
+		Type:          intoto.StatementType,
+		PredicateType: "collection",
+		Subject: []intoto.Subject{
+			{Digest: map[string]string{"sha256": "ABC"}},
+			{Name: "app", Digest: map[string]string{"sha256": testDigest}},
+			{Name: "app", Digest: map[string]string{"sha256": testDigest}},
+		},
+		Predicate: []byte(`["not", "an", "object"]`),
+	})
+
+	require.ErrorContains(t, err, "subject 1 has no name")
+	require.ErrorContains(t, err, `subject "" has a sha256 digest that isn't lowercase hex`)
+	require.ErrorContains(t, err, "subject app appears more than once")
+	require.ErrorContains(t, err, `predicate type "collection" isn't an absolute URI`)
+	require.ErrorContains(t, err, "predicate isn't a JSON object")
+
+	require.ErrorContains(t, Check(intoto.Statement{Type: "https://in-toto.io/Statement/v2"}), "unknown statement type")
+	require.ErrorContains(t, Check(intoto.Statement{Type: TypeV1}), "no subjects")
+}
@@ -0,0 +1,237 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statement builds the in-toto statements witness signs. Attestations, subjects, and object keys are
+// ordered so two runs that produce identical evidence yield byte identical statements, which lets stores
+// deduplicate them and verification results be cached by payload digest.
+package statement
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/go-witness/log"
+)
+
+// zeroTime is how a zero time.Time is encoded in JSON.
+var zeroTime = time.Time{}.Format(time.RFC3339Nano)
+
+// runOrder is the order attestors run in. Attestations are kept in this order so the collection still reads in
+// the order evidence was gathered.
+var runOrder = map[attestation.RunType]int{
+	attestation.PreMaterialRunType: 0,
+	attestation.MaterialRunType:    1,
+	attestation.ExecuteRunType:     2,
+	attestation.ProductRunType:     3,
+	attestation.PostProductRunType: 4,
+}
+
+// Sort orders the attestations of a collection by when their attestors run and then by type, so the order the
+// attestors were configured in doesn't change the collection.
+func Sort(collection *attestation.Collection) {
+	sort.SliceStable(collection.Attestations, func(i, j int) bool {
+		a, b := collection.Attestations[i], collection.Attestations[j]
+		if runOrder[a.Attestation.RunType()] != runOrder[b.Attestation.RunType()] {
+			return runOrder[a.Attestation.RunType()] < runOrder[b.Attestation.RunType()]
+		}
+
+		return a.Type < b.Type
+	})
+}
+
+// New returns the statement for a collection with its subjects sorted by name and the predicate in canonical
+// form. Start and end times that are zero are left out of the predicate.
+func New(collection attestation.Collection) (intoto.Statement, error) {
+	Sort(&collection)
+	predicate, err := json.Marshal(&collection)
+	if err != nil {
+		return intoto.Statement{}, err
+	}
+
+	if predicate, err = canonicalPredicate(predicate); err != nil {
+		return intoto.Statement{}, err
+	}
+
+	subjects := collection.Subjects()
+	names := make([]string, 0, len(subjects))
+	for name := range subjects {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	statement := intoto.Statement{
+		Type:          intoto.StatementType,
+		PredicateType: attestation.CollectionType,
+		Subject:       make([]intoto.Subject, 0, len(names)),
+		Predicate:     predicate,
+	}
+
+	for _, name := range names {
+		subject, err := intoto.DigestSetToSubject(name, subjects[name])
+		if err != nil {
+			return intoto.Statement{}, err
+		}
+
+		statement.Subject = append(statement.Subject, subject)
+	}
+
+	return statement, nil
+}
+
+// Marshal returns the canonical JSON of the statement for a collection.
+func Marshal(collection attestation.Collection) ([]byte, error) {
+	statement, err := New(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&statement)
+}
+
+// Sign signs the statement for a collection. The envelope has a signature from each of signers.
+func Sign(collection attestation.Collection, signers []cryptoutil.Signer, timestampers ...dsse.Timestamper) (dsse.Envelope, error) {
+	statement, err := New(collection)
+	if err != nil {
+		return dsse.Envelope{}, err
+	}
+
+	return SignStatement(statement, signers, timestampers...)
+}
+
+// SignStatement signs a statement built by New, for callers that rewrite the statement before it is signed.
+func SignStatement(statement intoto.Statement, signers []cryptoutil.Signer, timestampers ...dsse.Timestamper) (dsse.Envelope, error) {
+	data, err := json.Marshal(&statement)
+	if err != nil {
+		return dsse.Envelope{}, err
+	}
+
+	return dsse.Sign(intoto.PayloadType, bytes.NewReader(data), dsse.SignWithSigners(signers...), dsse.SignWithTimestampers(timestampers...))
+}
+
+// Canonicalize re-encodes JSON with the keys of every object sorted. Attestors that marshal themselves may write
+// keys in any order, and this makes their output independent of it. Numbers are kept as written.
+func Canonicalize(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(value)
+}
+
+// canonicalPredicate canonicalizes the JSON of a collection, dropping the start and end times of attestations that
+// have none.
+func canonicalPredicate(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	collection := map[string]interface{}{}
+	if err := decoder.Decode(&collection); err != nil {
+		return nil, err
+	}
+
+	attestations, _ := collection["attestations"].([]interface{})
+	for _, a := range attestations {
+		fields, ok := a.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		for _, key := range []string{"starttime", "endtime"} {
+			if fields[key] == zeroTime {
+				delete(fields, key)
+			}
+		}
+	}
+
+	return json.Marshal(collection)
+}
+
+// SignStatementThreshold signs a statement with each of signers separately and combines the signatures of those that
+// succeed, so a signer that is unavailable doesn't keep the rest from signing. It fails unless at least threshold of
+// signers signed.
+func SignStatementThreshold(statement intoto.Statement, signers []cryptoutil.Signer, threshold int, timestampers ...dsse.Timestamper) (dsse.Envelope, error) {
+	data, err := json.Marshal(&statement)
+	if err != nil {
+		return dsse.Envelope{}, err
+	}
+
+	envelope := dsse.Envelope{}
+	failures := []string{}
+	for _, signer := range signers {
+		signed, err := dsse.Sign(intoto.PayloadType, bytes.NewReader(data), dsse.SignWithSigners(signer), dsse.SignWithTimestampers(timestampers...))
+		if err != nil {
+			keyID, _ := signer.KeyID()
+			failures = append(failures, fmt.Sprintf("%v: %v", keyID, err))
+			continue
+		}
+
+		if len(envelope.Signatures) == 0 {
+			envelope = signed
+			continue
+		}
+
+		envelope.Signatures = append(envelope.Signatures, signed.Signatures...)
+	}
+
+	if len(envelope.Signatures) < threshold {
+		return dsse.Envelope{}, fmt.Errorf("%v of %v signers signed but %v are required: %v", len(envelope.Signatures), len(signers), threshold, strings.Join(failures, "; "))
+	}
+
+	for _, failure := range failures {
+		log.Warnf("signer failed to sign, the threshold was still met: %v", failure)
+	}
+
+	return envelope, nil
+}
+
+// Countersign adds a signature from each of signers to a signed envelope, keeping its payload and the signatures it
+// already has. It fails if a signer has already signed the envelope, since a second signature from the same key
+// endorses nothing new. The envelope's existing signatures aren't checked, so callers verify them first.
+func Countersign(env dsse.Envelope, signers []cryptoutil.Signer, timestampers ...dsse.Timestamper) (dsse.Envelope, error) {
+	signed := make(map[string]bool, len(env.Signatures))
+	for _, sig := range env.Signatures {
+		signed[sig.KeyID] = true
+	}
+
+	for _, signer := range signers {
+		keyID, err := signer.KeyID()
+		if err != nil {
+			return dsse.Envelope{}, err
+		}
+
+		if signed[keyID] {
+			return dsse.Envelope{}, fmt.Errorf("the envelope is already signed by %v", keyID)
+		}
+
+		signed[keyID] = true
+	}
+
+	countersigned, err := dsse.Sign(env.PayloadType, bytes.NewReader(env.Payload), dsse.SignWithSigners(signers...), dsse.SignWithTimestampers(timestampers...))
+	if err != nil {
+		return dsse.Envelope{}, err
+	}
+
+	countersigned.Signatures = append(append([]dsse.Signature{}, env.Signatures...), countersigned.Signatures...)
+	return countersigned, nil
+}
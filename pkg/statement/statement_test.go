@@ -0,0 +1,244 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statement
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+)
+
+type testAttestor struct {
+	name     string
+	runType  attestation.RunType
+	subjects map[string]cryptoutil.DigestSet
+	// fields are written in the order given, as an attestor with a hand written marshaler might
+	fields []string
+}
+
+func (a *testAttestor) Name() string                                     { return a.name }
+func (a *testAttestor) Type() string                                     { return "https://example.com/" + a.name }
+func (a *testAttestor) RunType() attestation.RunType                     { return a.runType }
+func (a *testAttestor) Attest(ctx *attestation.AttestationContext) error { return nil }
+func (a *testAttestor) Subjects() map[string]cryptoutil.DigestSet        { return a.subjects }
+
+func (a *testAttestor) MarshalJSON() ([]byte, error) {
+	data := "{"
+	for i, field := range a.fields {
+		if i > 0 {
+			data += ","
+		}
+
+		data += fmt.Sprintf("%q:1.50", field)
+	}
+
+	return []byte(data + "}"), nil
+}
+
+func testCollection(reverse bool) attestation.Collection {
+	subjects := map[string]cryptoutil.DigestSet{}
+	for i := 0; i < 20; i++ {
+		subjects[fmt.Sprintf("file:%02d", i)] = cryptoutil.DigestSet{cryptoutil.DigestValue{Hash: crypto.SHA256}: fmt.Sprint(i)}
+	}
+
+	fields := []string{"b", "a", "c"}
+	attestations := []attestation.CollectionAttestation{
+		{Type: "https://example.com/product", Attestation: &testAttestor{name: "product", runType: attestation.ProductRunType, subjects: subjects, fields: fields}},
+		{Type: "https://example.com/git", Attestation: &testAttestor{name: "git", runType: attestation.PreMaterialRunType, fields: fields}},
+		{Type: "https://example.com/environment", Attestation: &testAttestor{name: "environment", runType: attestation.PreMaterialRunType, fields: fields}},
+	}
+
+	if reverse {
+		sort.Strings(fields)
+		for i, j := 0, len(attestations)-1; i < j; i, j = i+1, j-1 {
+			attestations[i], attestations[j] = attestations[j], attestations[i]
+		}
+	}
+
+	return attestation.Collection{Name: "build", Attestations: attestations}
+}
+
+func TestMarshalIsDeterministic(t *testing.T) {
+	expected, err := Marshal(testCollection(false))
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		data, err := Marshal(testCollection(i%2 == 0))
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(data))
+	}
+}
+
+func TestNew(t *testing.T) {
+	statement, err := New(testCollection(false))
+	require.NoError(t, err)
+	require.Equal(t, intoto.StatementType, statement.Type)
+	require.Equal(t, attestation.CollectionType, statement.PredicateType)
+	require.Len(t, statement.Subject, 20)
+	require.True(t, sort.SliceIsSorted(statement.Subject, func(i, j int) bool { return statement.Subject[i].Name < statement.Subject[j].Name }))
+	require.Equal(t, "https://example.com/product/file:00", statement.Subject[0].Name)
+
+	predicate := struct {
+		Attestations []struct {
+			Type        string          `json:"type"`
+			Attestation json.RawMessage `json:"attestation"`
+		} `json:"attestations"`
+	}{}
+
+	require.NoError(t, json.Unmarshal(statement.Predicate, &predicate))
+	types := []string{}
+	for _, a := range predicate.Attestations {
+		types = append(types, a.Type)
+	}
+
+	require.Equal(t, []string{"https://example.com/environment", "https://example.com/git", "https://example.com/product"}, types)
+	require.Equal(t, `{"a":1.50,"b":1.50,"c":1.50}`, string(predicate.Attestations[0].Attestation))
+}
+
+func TestSign(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := cryptoutil.NewSigner(priv)
+	require.NoError(t, err)
+
+	first, err := Sign(testCollection(false), []cryptoutil.Signer{signer})
+	require.NoError(t, err)
+	second, err := Sign(testCollection(true), []cryptoutil.Signer{signer})
+	require.NoError(t, err)
+	require.Equal(t, first.Payload, second.Payload)
+	require.Equal(t, intoto.PayloadType, first.PayloadType)
+	require.Len(t, first.Signatures, 1)
+
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	other, err := cryptoutil.NewSigner(otherPriv)
+	require.NoError(t, err)
+	cosigned, err := Sign(testCollection(false), []cryptoutil.Signer{signer, other})
+	require.NoError(t, err)
+	require.Equal(t, first.Payload, cosigned.Payload)
+	require.Len(t, cosigned.Signatures, 2)
+}
+
+func TestSetTimes(t *testing.T) {
+	t.Setenv(SourceDateEpochEnv, "1700000000")
+	epoch, err := SourceDateEpoch()
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1700000000, 0).UTC(), epoch)
+
+	first, second := testCollection(false), testCollection(false)
+	for i := range first.Attestations {
+		first.Attestations[i].StartTime = time.Now()
+		second.Attestations[i].StartTime = time.Now().Add(time.Hour)
+	}
+
+	SetTimes(&first, epoch)
+	SetTimes(&second, epoch)
+	expected, err := Marshal(first)
+	require.NoError(t, err)
+	data, err := Marshal(second)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(data))
+
+	SetTimes(&first, time.Time{})
+	data, err = Marshal(first)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "starttime")
+	require.NotContains(t, string(data), "endtime")
+
+	t.Setenv(SourceDateEpochEnv, "yesterday")
+	_, err = SourceDateEpoch()
+	require.Error(t, err)
+}
+
+type failingSigner struct {
+	cryptoutil.Signer
+}
+
+func (s failingSigner) Sign(r io.Reader) ([]byte, error) {
+	return nil, errors.New("token not present")
+}
+
+func TestSignStatementThreshold(t *testing.T) {
+	signers := []cryptoutil.Signer{}
+	for i := 0; i < 3; i++ {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		signer, err := cryptoutil.NewSigner(priv)
+		require.NoError(t, err)
+		signers = append(signers, signer)
+	}
+
+	signers[1] = failingSigner{signers[1]}
+	statement, err := New(testCollection(false))
+	require.NoError(t, err)
+
+	env, err := SignStatementThreshold(statement, signers, 2)
+	require.NoError(t, err)
+	require.Len(t, env.Signatures, 2)
+	for _, i := range []int{0, 2} {
+		verifier, err := signers[i].Verifier()
+		require.NoError(t, err)
+		_, err = env.Verify(dsse.VerifyWithVerifiers(verifier))
+		require.NoError(t, err)
+	}
+
+	_, err = SignStatementThreshold(statement, signers, 3)
+	require.ErrorContains(t, err, "2 of 3 signers signed but 3 are required")
+}
+
+func TestCountersign(t *testing.T) {
+	signers := []cryptoutil.Signer{}
+	for i := 0; i < 2; i++ {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		signer, err := cryptoutil.NewSigner(priv)
+		require.NoError(t, err)
+		signers = append(signers, signer)
+	}
+
+	env, err := Sign(testCollection(false), signers[:1])
+	require.NoError(t, err)
+	countersigned, err := Countersign(env, signers[1:])
+	require.NoError(t, err)
+	require.Equal(t, env.Payload, countersigned.Payload)
+	require.Equal(t, env.PayloadType, countersigned.PayloadType)
+	require.Len(t, countersigned.Signatures, 2)
+	require.Equal(t, env.Signatures[0], countersigned.Signatures[0])
+
+	verifiers := []cryptoutil.Verifier{}
+	for _, signer := range signers {
+		verifier, err := signer.Verifier()
+		require.NoError(t, err)
+		verifiers = append(verifiers, verifier)
+	}
+
+	_, err = countersigned.Verify(dsse.VerifyWithVerifiers(verifiers...), dsse.VerifyWithThreshold(2))
+	require.NoError(t, err)
+
+	_, err = Countersign(countersigned, signers[:1])
+	require.ErrorContains(t, err, "already signed by")
+}
@@ -0,0 +1,276 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/testifysec/go-witness/source"
+)
+
+const (
+	IndexFileName = ".witness-index.json"
+
+	// ObjectsDir holds envelopes written by Put, named by their gitoid.
+	ObjectsDir = "objects"
+
+	indexLockFileName = ".witness-index.lock"
+	indexLockTimeout  = 10 * time.Second
+)
+
+// Index records the step, subjects, and time of every entry of a store so envelopes can be found without reading
+// the whole store. The index is rebuilt from the store's files when it is missing.
+type Index struct {
+	dir     string
+	entries map[string]Entry
+}
+
+// LoadIndex loads the index of the store at dir, building it from the store's files if there isn't one.
+func LoadIndex(dir string) (*Index, error) {
+	idx := &Index{dir: dir, entries: make(map[string]Entry)}
+	data, err := os.ReadFile(filepath.Join(dir, IndexFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, idx.rebuild()
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse store index: %w", err)
+	}
+
+	for _, entry := range entries {
+		idx.entries[entry.Path] = entry
+	}
+
+	return idx, nil
+}
+
+func (idx *Index) rebuild() error {
+	if _, err := os.Stat(idx.dir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	entries, err := Load(idx.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		idx.entries[entry.Path] = entry
+	}
+
+	return nil
+}
+
+// Entries returns every indexed entry sorted by path.
+func (idx *Index) Entries() []Entry {
+	entries := make([]Entry, 0, len(idx.entries))
+	for _, entry := range idx.entries {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// Find returns the entries of step that have any of subjectDigests and finished at or after since, sorted by path.
+// An empty step, no digests, or a zero since match every entry.
+func (idx *Index) Find(step string, subjectDigests []string, since time.Time) []Entry {
+	found := make([]Entry, 0)
+	for _, entry := range idx.Entries() {
+		if step != "" && entry.Step != step {
+			continue
+		}
+
+		if !since.IsZero() && entry.Time.Before(since) {
+			continue
+		}
+
+		if len(subjectDigests) > 0 && !entry.hasAnySubjectDigest(subjectDigests) {
+			continue
+		}
+
+		found = append(found, entry)
+	}
+
+	return found
+}
+
+func (e Entry) hasAnySubjectDigest(digests []string) bool {
+	for _, digest := range digests {
+		if e.HasSubjectDigest(digest) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (idx *Index) save() error {
+	data, err := json.MarshalIndent(idx.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(idx.dir, IndexFileName+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(idx.dir, IndexFileName))
+}
+
+// updateIndex applies update to the index of the store at dir while holding the store's index lock, so concurrent
+// runs writing to the same store don't lose each other's entries.
+func updateIndex(dir string, update func(*Index)) error {
+	unlock, err := lockIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+	idx, err := LoadIndex(dir)
+	if err != nil {
+		return err
+	}
+
+	update(idx)
+	return idx.save()
+}
+
+func lockIndex(dir string) (func(), error) {
+	lockPath := filepath.Join(dir, indexLockFileName)
+	deadline := time.Now().Add(indexLockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the store index lock, remove %v if no other witness is writing to the store", lockPath)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Put writes a signed attestation collection envelope into the store at dir and indexes it. Envelopes are named by
+// their gitoid, so putting the same envelope again doesn't duplicate it.
+func Put(dir string, envelope []byte) (Entry, error) {
+	entry, ok := parseEntry(envelope, time.Now())
+	if !ok {
+		return Entry{}, errors.New("only signed attestation collections can be stored")
+	}
+
+	entry.Path = path.Join(ObjectsDir, entry.GitOID[:2], entry.GitOID+".json")
+	dest := filepath.Join(dir, filepath.FromSlash(entry.Path))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return Entry{}, err
+	}
+
+	if _, err := os.Stat(dest); errors.Is(err, os.ErrNotExist) {
+		if err := os.WriteFile(dest, envelope, 0644); err != nil {
+			return Entry{}, fmt.Errorf("failed to write %v: %w", entry.Path, err)
+		}
+	} else if err != nil {
+		return Entry{}, err
+	}
+
+	if err := updateIndex(dir, func(idx *Index) { idx.entries[entry.Path] = entry }); err != nil {
+		return Entry{}, fmt.Errorf("failed to update store index: %w", err)
+	}
+
+	return entry, nil
+}
+
+// Source searches a store for collections during verification using its index.
+type Source struct {
+	dir    string
+	onRead func(data []byte) error
+}
+
+var _ source.Sourcer = &Source{}
+
+type SourceOption func(*Source)
+
+// WithOnRead calls onRead with the bytes of each envelope the source reads, as they are stored.
+func WithOnRead(onRead func(data []byte) error) SourceOption {
+	return func(s *Source) {
+		s.onRead = onRead
+	}
+}
+
+func NewSource(dir string, opts ...SourceOption) *Source {
+	s := &Source{dir: dir}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *Source) Search(ctx context.Context, collectionName string, subjectDigests, attestations []string) ([]source.CollectionEnvelope, error) {
+	idx, err := LoadIndex(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// the memory source checks the expected attestations, which the index doesn't record
+	found := source.NewMemorySource()
+	for _, entry := range idx.Find(collectionName, subjectDigests, time.Time{}) {
+		data, err := Read(s.dir, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := found.LoadBytes(entry.Path, data); err != nil {
+			return nil, fmt.Errorf("failed to load %v: %w", entry.Path, err)
+		}
+
+		if s.onRead != nil {
+			if err := s.onRead(data); err != nil {
+				return nil, fmt.Errorf("failed to load %v: %w", entry.Path, err)
+			}
+		}
+	}
+
+	return found.Search(ctx, collectionName, subjectDigests, attestations)
+}
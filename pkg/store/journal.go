@@ -0,0 +1,92 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const UploadJournalFileName = ".witness-uploads.json"
+
+// UploadJournal records which entries of a store have been uploaded to each server, so an interrupted upload
+// can be resumed without sending everything again. Entries are identified by their gitoid, so an entry that
+// changes is uploaded again.
+type UploadJournal struct {
+	path     string
+	uploaded map[string]map[string]struct{}
+}
+
+// LoadUploadJournal loads the upload journal of the store at dir, or returns an empty journal if there isn't one.
+func LoadUploadJournal(dir string) (*UploadJournal, error) {
+	j := &UploadJournal{
+		path:     filepath.Join(dir, UploadJournalFileName),
+		uploaded: make(map[string]map[string]struct{}),
+	}
+
+	data, err := os.ReadFile(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	uploaded := make(map[string][]string)
+	if err := json.Unmarshal(data, &uploaded); err != nil {
+		return nil, err
+	}
+
+	for server, gitoids := range uploaded {
+		for _, gitoid := range gitoids {
+			j.Add(server, gitoid)
+		}
+	}
+
+	return j, nil
+}
+
+func (j *UploadJournal) Has(server, gitoid string) bool {
+	_, ok := j.uploaded[server][gitoid]
+	return ok
+}
+
+func (j *UploadJournal) Add(server, gitoid string) {
+	if j.uploaded[server] == nil {
+		j.uploaded[server] = make(map[string]struct{})
+	}
+
+	j.uploaded[server][gitoid] = struct{}{}
+}
+
+func (j *UploadJournal) Save() error {
+	uploaded := make(map[string][]string, len(j.uploaded))
+	for server, gitoids := range j.uploaded {
+		for gitoid := range gitoids {
+			uploaded[server] = append(uploaded[server], gitoid)
+		}
+
+		sort.Strings(uploaded[server])
+	}
+
+	data, err := json.MarshalIndent(uploaded, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(j.path, data, 0644)
+}
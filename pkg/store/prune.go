@@ -0,0 +1,172 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const ExportManifestFileName = "pruned.json"
+
+// RetentionRules select which entries of a store are pruned. An entry is pruned only if it matches every rule
+// that is set and isn't retained by KeepSteps or KeepLatest.
+type RetentionRules struct {
+	// OlderThan prunes entries that finished more than this long before Now
+	OlderThan time.Duration
+	// Subjects prunes entries with a subject matching any of these digests
+	Subjects []string
+	// KeepSteps retains entries for these steps, usually the steps of a policy that is still in use
+	KeepSteps []string
+	// KeepLatest retains this many of the most recent entries of each step
+	KeepLatest int
+	Now        time.Time
+}
+
+// Select returns the entries that should be pruned according to the rules. At least one of OlderThan or Subjects
+// must be set so a store is never emptied by accident.
+func (r RetentionRules) Select(entries []Entry) ([]Entry, error) {
+	if r.OlderThan <= 0 && len(r.Subjects) == 0 {
+		return nil, errors.New("a maximum age or at least one subject is required to select entries to prune")
+	}
+
+	now := r.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	keepSteps := make(map[string]struct{}, len(r.KeepSteps))
+	for _, step := range r.KeepSteps {
+		keepSteps[step] = struct{}{}
+	}
+
+	latest := r.latest(entries)
+	selected := make([]Entry, 0)
+	for _, entry := range entries {
+		if _, ok := keepSteps[entry.Step]; ok {
+			continue
+		}
+
+		if _, ok := latest[entry.Path]; ok {
+			continue
+		}
+
+		if r.OlderThan > 0 && !entry.Time.Before(now.Add(-r.OlderThan)) {
+			continue
+		}
+
+		if len(r.Subjects) > 0 && !entry.hasAnySubject(r.Subjects) {
+			continue
+		}
+
+		selected = append(selected, entry)
+	}
+
+	return selected, nil
+}
+
+// latest returns the paths of the KeepLatest most recent entries of each step.
+func (r RetentionRules) latest(entries []Entry) map[string]struct{} {
+	latest := make(map[string]struct{})
+	if r.KeepLatest <= 0 {
+		return latest
+	}
+
+	byStep := make(map[string][]Entry)
+	for _, entry := range entries {
+		byStep[entry.Step] = append(byStep[entry.Step], entry)
+	}
+
+	for _, stepEntries := range byStep {
+		sort.SliceStable(stepEntries, func(i, j int) bool { return stepEntries[i].Time.After(stepEntries[j].Time) })
+		for i := 0; i < len(stepEntries) && i < r.KeepLatest; i++ {
+			latest[stepEntries[i].Path] = struct{}{}
+		}
+	}
+
+	return latest
+}
+
+func (e Entry) hasAnySubject(digests []string) bool {
+	for _, digest := range digests {
+		if e.HasSubjectDigest(digest) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Export copies entries from the store at dir into exportDir, keeping their paths, and writes a manifest of the
+// exported entries. exportDir must not exist or be empty.
+func Export(dir, exportDir string, entries []Entry) error {
+	existing, err := os.ReadDir(exportDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	} else if len(existing) > 0 {
+		return fmt.Errorf("export directory %v is not empty", exportDir)
+	}
+
+	for _, entry := range entries {
+		data, err := Read(dir, entry)
+		if err != nil {
+			return err
+		}
+
+		dest := filepath.Join(exportDir, filepath.FromSlash(entry.Path))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(dest, data, 0644); err != nil {
+			return fmt.Errorf("failed to export %v: %w", entry.Path, err)
+		}
+	}
+
+	manifest, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(exportDir, ExportManifestFileName), manifest, 0644)
+}
+
+// Remove deletes entries from the store at dir and from its index, if it has one.
+func Remove(dir string, entries []Entry) error {
+	for _, entry := range entries {
+		if err := os.Remove(filepath.Join(dir, filepath.FromSlash(entry.Path))); err != nil {
+			return fmt.Errorf("failed to remove %v: %w", entry.Path, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, IndexFileName)); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return updateIndex(dir, func(idx *Index) {
+		for _, entry := range entries {
+			delete(idx.entries, entry.Path)
+		}
+	})
+}
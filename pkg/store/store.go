@@ -0,0 +1,158 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package store manages directories of signed attestation envelopes kept outside of Archivista.
+package store
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/witness/pkg/attestation/previousstep"
+)
+
+// Entry is a signed attestation collection found in a store.
+type Entry struct {
+	// Path is relative to the root of the store
+	Path   string `json:"path"`
+	GitOID string `json:"gitoid"`
+	Step   string `json:"step"`
+	// Time is when the last attestor of the collection finished, or the modification time of the file if the
+	// collection doesn't record one
+	Time     time.Time           `json:"time"`
+	Subjects map[string][]string `json:"subjects"`
+	Size     int64               `json:"size"`
+}
+
+// Load returns every attestation collection envelope under dir, sorted by path. Files that aren't signed
+// attestation collections are skipped so stores can hold other files, like policies and keys.
+func Load(dir string) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		entry, ok := parseEntry(data, info.ModTime())
+		if !ok {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		entry.Path = filepath.ToSlash(rel)
+		entries = append(entries, entry)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+func parseEntry(data []byte, modTime time.Time) (Entry, bool) {
+	env := dsse.Envelope{}
+	if err := json.Unmarshal(data, &env); err != nil || len(env.Payload) == 0 || len(env.Signatures) == 0 {
+		return Entry{}, false
+	}
+
+	statement := intoto.Statement{}
+	if err := json.Unmarshal(env.Payload, &statement); err != nil {
+		return Entry{}, false
+	}
+
+	// attestations are left unparsed so collections with attestors this build doesn't know about are still found
+	collection := struct {
+		Name         string `json:"name"`
+		Attestations []struct {
+			EndTime time.Time `json:"endtime"`
+		} `json:"attestations"`
+	}{}
+
+	if err := json.Unmarshal(statement.Predicate, &collection); err != nil || collection.Name == "" {
+		return Entry{}, false
+	}
+
+	entry := Entry{
+		GitOID:   previousstep.GitOID(data),
+		Step:     collection.Name,
+		Subjects: make(map[string][]string),
+		Size:     int64(len(data)),
+	}
+
+	for _, attestation := range collection.Attestations {
+		if attestation.EndTime.After(entry.Time) {
+			entry.Time = attestation.EndTime
+		}
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = modTime
+	}
+
+	for _, subject := range statement.Subject {
+		for _, digest := range subject.Digest {
+			entry.Subjects[subject.Name] = append(entry.Subjects[subject.Name], digest)
+		}
+
+		sort.Strings(entry.Subjects[subject.Name])
+	}
+
+	return entry, true
+}
+
+// HasSubjectDigest returns true if any subject of the entry has the digest.
+func (e Entry) HasSubjectDigest(digest string) bool {
+	for _, digests := range e.Subjects {
+		for _, d := range digests {
+			if d == digest {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Read returns the contents of an entry in the store at dir.
+func Read(dir string, entry Entry) ([]byte, error) {
+	return os.ReadFile(filepath.Join(dir, filepath.FromSlash(entry.Path)))
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/dsse"
+)
+
+var now = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func writeEnvelope(t *testing.T, dir, name, step, digest string, endTime time.Time) {
+	payload := fmt.Sprintf(`{"_type":"https://in-toto.io/Statement/v0.1","subject":[{"name":"file:out","digest":{"sha256":%q}}],"predicateType":"https://witness.testifysec.com/attestation-collection/v0.1","predicate":{"name":%q,"attestations":[{"type":"https://witness.dev/attestations/product/v0.1","attestation":{},"starttime":%q,"endtime":%q}]}}`,
+		digest, step, endTime.Add(-time.Minute).Format(time.RFC3339), endTime.Format(time.RFC3339))
+	data, err := json.Marshal(dsse.Envelope{Payload: []byte(payload), PayloadType: "application/vnd.in-toto+json", Signatures: []dsse.Signature{{KeyID: "key", Signature: []byte("sig")}}})
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+}
+
+func testStore(t *testing.T) string {
+	dir := t.TempDir()
+	writeEnvelope(t, dir, "build/old.json", "build", "aaaa", now.Add(-90*24*time.Hour))
+	writeEnvelope(t, dir, "build/new.json", "build", "bbbb", now.Add(-time.Hour))
+	writeEnvelope(t, dir, "deploy/old.json", "deploy", "cccc", now.Add(-60*24*time.Hour))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "policy.json"), []byte(`{"payload":"e30=","payloadType":"https://witness.testifysec.com/policy/v0.1"}`), 0644))
+	return dir
+}
+
+func paths(entries []Entry) []string {
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry.Path)
+	}
+
+	return result
+}
+
+func TestLoad(t *testing.T) {
+	entries, err := Load(testStore(t))
+	require.NoError(t, err)
+	require.Equal(t, []string{"build/new.json", "build/old.json", "deploy/old.json"}, paths(entries))
+	require.Equal(t, "build", entries[0].Step)
+	require.True(t, entries[0].Time.Equal(now.Add(-time.Hour)))
+	require.True(t, entries[0].HasSubjectDigest("bbbb"))
+	require.Len(t, entries[0].GitOID, 64)
+}
+
+func TestSelect(t *testing.T) {
+	entries, err := Load(testStore(t))
+	require.NoError(t, err)
+
+	_, err = RetentionRules{Now: now}.Select(entries)
+	require.Error(t, err)
+
+	selected, err := RetentionRules{OlderThan: 30 * 24 * time.Hour, Now: now}.Select(entries)
+	require.NoError(t, err)
+	require.Equal(t, []string{"build/old.json", "deploy/old.json"}, paths(selected))
+
+	selected, err = RetentionRules{OlderThan: 30 * 24 * time.Hour, KeepSteps: []string{"deploy"}, Now: now}.Select(entries)
+	require.NoError(t, err)
+	require.Equal(t, []string{"build/old.json"}, paths(selected))
+
+	selected, err = RetentionRules{Subjects: []string{"aaaa", "bbbb"}, KeepLatest: 1, Now: now}.Select(entries)
+	require.NoError(t, err)
+	require.Equal(t, []string{"build/old.json"}, paths(selected))
+}
+
+func TestExportAndRemove(t *testing.T) {
+	dir := testStore(t)
+	entries, err := Load(dir)
+	require.NoError(t, err)
+	selected, err := RetentionRules{OlderThan: 30 * 24 * time.Hour, Now: now}.Select(entries)
+	require.NoError(t, err)
+
+	exportDir := filepath.Join(t.TempDir(), "export")
+	require.NoError(t, Export(dir, exportDir, selected))
+	require.FileExists(t, filepath.Join(exportDir, "build", "old.json"))
+	require.FileExists(t, filepath.Join(exportDir, ExportManifestFileName))
+	require.Error(t, Export(dir, exportDir, selected))
+
+	require.NoError(t, Remove(dir, selected))
+	remaining, err := Load(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"build/new.json"}, paths(remaining))
+}
+
+func TestUploadJournal(t *testing.T) {
+	dir := t.TempDir()
+	journal, err := LoadUploadJournal(dir)
+	require.NoError(t, err)
+	require.False(t, journal.Has("https://archivista", "abcd"))
+
+	journal.Add("https://archivista", "abcd")
+	require.NoError(t, journal.Save())
+	journal, err = LoadUploadJournal(dir)
+	require.NoError(t, err)
+	require.True(t, journal.Has("https://archivista", "abcd"))
+	require.False(t, journal.Has("https://other", "abcd"))
+
+	entries, err := Load(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestPutAndIndex(t *testing.T) {
+	source := t.TempDir()
+	writeEnvelope(t, source, "build.json", "build", "aaaa", now.Add(-time.Hour))
+	writeEnvelope(t, source, "deploy.json", "deploy", "bbbb", now)
+	dir := filepath.Join(t.TempDir(), "store")
+	for _, name := range []string{"build.json", "deploy.json", "build.json"} {
+		data, err := os.ReadFile(filepath.Join(source, name))
+		require.NoError(t, err)
+		entry, err := Put(dir, data)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("objects/%v/%v.json", entry.GitOID[:2], entry.GitOID), entry.Path)
+	}
+
+	_, err := Put(dir, []byte(`{"payload":"e30=","payloadType":"https://witness.testifysec.com/policy/v0.1"}`))
+	require.ErrorContains(t, err, "only signed attestation collections")
+
+	idx, err := LoadIndex(dir)
+	require.NoError(t, err)
+	require.Len(t, idx.Entries(), 2)
+	require.Len(t, idx.Find("build", nil, time.Time{}), 1)
+	require.Len(t, idx.Find("", []string{"bbbb", "cccc"}, time.Time{}), 1)
+	require.Len(t, idx.Find("", nil, now.Add(-time.Minute)), 1)
+	require.Empty(t, idx.Find("build", []string{"bbbb"}, time.Time{}))
+
+	entries, err := Load(dir)
+	require.NoError(t, err)
+	require.Equal(t, paths(idx.Entries()), paths(entries))
+
+	require.NoError(t, Remove(dir, idx.Find("build", nil, time.Time{})))
+	idx, err = LoadIndex(dir)
+	require.NoError(t, err)
+	require.Len(t, idx.Entries(), 1)
+	require.Equal(t, "deploy", idx.Entries()[0].Step)
+}
+
+func TestLoadIndexRebuilds(t *testing.T) {
+	idx, err := LoadIndex(testStore(t))
+	require.NoError(t, err)
+	require.Equal(t, []string{"build/new.json", "build/old.json", "deploy/old.json"}, paths(idx.Entries()))
+
+	idx, err = LoadIndex(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	require.Empty(t, idx.Entries())
+}
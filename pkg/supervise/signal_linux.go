@@ -0,0 +1,87 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package supervise
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/testifysec/witness/internal/procfs"
+)
+
+// signalCommand sends sig to the child of witness running command and to every process it started, so processes
+// holding the command's output open don't keep witness waiting. It returns the pids that were signaled.
+func signalCommand(command []string, sig syscall.Signal) ([]int, error) {
+	parents, err := procfs.Parents()
+	if err != nil {
+		return nil, err
+	}
+
+	root := 0
+	self := os.Getpid()
+	for pid, ppid := range parents {
+		if ppid == self && matchesCommand(pid, command) {
+			root = pid
+			break
+		}
+	}
+
+	if root == 0 {
+		return nil, fmt.Errorf("no process running %v was found", strings.Join(command, " "))
+	}
+
+	tree := []int{root}
+	for i := 0; i < len(tree); i++ {
+		for pid, ppid := range parents {
+			if ppid == tree[i] {
+				tree = append(tree, pid)
+			}
+		}
+	}
+
+	signaled := make([]int, 0, len(tree))
+	for _, pid := range tree {
+		if err := syscall.Kill(pid, sig); err != nil {
+			if errors.Is(err, syscall.ESRCH) {
+				continue
+			}
+
+			return signaled, fmt.Errorf("failed to signal process %v: %w", pid, err)
+		}
+
+		signaled = append(signaled, pid)
+	}
+
+	return signaled, nil
+}
+
+func matchesCommand(pid int, command []string) bool {
+	if len(command) == 0 {
+		return true
+	}
+
+	cmdline, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return false
+	}
+
+	return string(bytes.TrimSuffix(cmdline, []byte{0})) == strings.Join(command, "\x00")
+}
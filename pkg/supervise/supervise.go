@@ -0,0 +1,293 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package supervise stops the command of a step when the run passes its deadline or witness is asked to shut
+// down, so the step can still be recorded and signed instead of losing the evidence collected so far.
+package supervise
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/witness/pkg/wrap"
+)
+
+const (
+	// ReasonTimeout is the reason recorded for a command stopped at the run's deadline.
+	ReasonTimeout = "timeout"
+	// ReasonSignal is the reason recorded for a command stopped because witness received a signal.
+	ReasonSignal = "signal"
+
+	// DefaultGracePeriod is how long the command is given to exit after each signal before witness escalates.
+	DefaultGracePeriod = 10 * time.Second
+)
+
+var (
+	// ErrTimedOut is returned once a run that passed its deadline has been recorded.
+	ErrTimedOut = errors.New("the command exceeded the maximum run duration")
+	// ErrInterrupted is returned once a run that was interrupted by a signal has been recorded.
+	ErrInterrupted = errors.New("the command was interrupted")
+)
+
+var (
+	_ attestation.Attestor   = &supervisedAttestor{}
+	_ attestation.Subjecter  = &supervisedAttestor{}
+	_ attestation.BackReffer = &supervisedAttestor{}
+)
+
+// Signal is a signal sent to the processes of a command that was stopped.
+type Signal struct {
+	Signal string    `json:"signal"`
+	Pids   []int     `json:"pids,omitempty"`
+	SentAt time.Time `json:"sentat"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Termination describes why and how a command was stopped.
+type Termination struct {
+	Reason    string   `json:"reason"`
+	Received  string   `json:"received,omitempty"`
+	Signals   []Signal `json:"signals,omitempty"`
+	Abandoned bool     `json:"abandoned,omitempty"`
+}
+
+type Supervisor struct {
+	command     []string
+	deadline    time.Time
+	gracePeriod time.Duration
+	signals     []os.Signal
+	interrupts  <-chan os.Signal
+	termination *Termination
+}
+
+type Option func(*Supervisor)
+
+// WithCommand sets the command being run, which is used to find its process.
+func WithCommand(command []string) Option {
+	return func(s *Supervisor) {
+		s.command = command
+	}
+}
+
+// WithDeadline stops the command if it is still running at deadline.
+func WithDeadline(deadline time.Time) Option {
+	return func(s *Supervisor) {
+		s.deadline = deadline
+	}
+}
+
+// WithGracePeriod sets how long the command is given to exit after the first signal before it is sent SIGKILL,
+// and after SIGKILL before witness stops waiting for it. Durations that aren't positive leave the default.
+func WithGracePeriod(d time.Duration) Option {
+	return func(s *Supervisor) {
+		if d > 0 {
+			s.gracePeriod = d
+		}
+	}
+}
+
+// WithSignals forwards the first of signals that witness receives while the command runs to the command. A second
+// signal kills the command without waiting for the rest of the grace period. The signals are only caught while the
+// command runs, so before and after it they have their default effect on witness.
+func WithSignals(signals ...os.Signal) Option {
+	return func(s *Supervisor) {
+		s.signals = signals
+	}
+}
+
+// WithInterrupts takes signals from interrupts rather than those set with WithSignals, as when tests deliver signals
+// without sending them to the process. A nil channel leaves WithSignals in effect.
+func WithInterrupts(interrupts <-chan os.Signal) Option {
+	return func(s *Supervisor) {
+		s.interrupts = interrupts
+	}
+}
+
+func New(opts ...Option) *Supervisor {
+	s := &Supervisor{gracePeriod: DefaultGracePeriod}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Apply wraps the attestors that execute the step's command so they are supervised.
+func (s *Supervisor) Apply(attestors []attestation.Attestor) []attestation.Attestor {
+	applied := make([]attestation.Attestor, 0, len(attestors))
+	for _, attestor := range attestors {
+		if attestor.RunType() == attestation.ExecuteRunType {
+			attestor = &supervisedAttestor{Forwarder: wrap.Forwarder{Attestor: attestor}, supervisor: s}
+		}
+
+		applied = append(applied, attestor)
+	}
+
+	return applied
+}
+
+// Termination returns how the command was stopped, or nil if it wasn't.
+func (s *Supervisor) Termination() *Termination {
+	return s.termination
+}
+
+// Err returns ErrTimedOut or ErrInterrupted if the command was stopped, and nil otherwise.
+func (s *Supervisor) Err() error {
+	if s.termination == nil {
+		return nil
+	}
+
+	if s.termination.Reason == ReasonTimeout {
+		return ErrTimedOut
+	}
+
+	return fmt.Errorf("%w by %v", ErrInterrupted, s.termination.Received)
+}
+
+// notify returns the channel signals are received on while the command runs and a function that stops catching them.
+func (s *Supervisor) notify() (<-chan os.Signal, func()) {
+	if s.interrupts != nil || len(s.signals) == 0 {
+		return s.interrupts, func() {}
+	}
+
+	interrupts := make(chan os.Signal, 2)
+	signal.Notify(interrupts, s.signals...)
+	return interrupts, func() { signal.Stop(interrupts) }
+}
+
+// stop signals the command until the wrapped attestor finishes, escalating to SIGKILL after the grace period.
+func (s *Supervisor) stop(first syscall.Signal, done <-chan error, interrupts <-chan os.Signal) bool {
+	for _, sig := range []syscall.Signal{first, syscall.SIGKILL} {
+		sent := Signal{Signal: sig.String(), SentAt: time.Now().UTC()}
+		pids, err := signalCommand(s.command, sig)
+		sent.Pids = pids
+		if err != nil {
+			log.Warnf("failed to send %v to the command: %v", sig, err)
+			sent.Error = err.Error()
+		}
+
+		s.termination.Signals = append(s.termination.Signals, sent)
+		timer := time.NewTimer(s.gracePeriod)
+		select {
+		case err := <-done:
+			timer.Stop()
+			if err != nil {
+				log.Debugf("the command exited after %v: %v", sig, err)
+			}
+
+			return true
+		case <-timer.C:
+		case <-interrupts:
+			timer.Stop()
+		}
+	}
+
+	return false
+}
+
+// supervisedAttestor runs the wrapped attestor until the deadline or a signal, then stops the command. The wrapped
+// attestor's error is dropped once the command has been stopped, so the rest of the step is still recorded and
+// signed, and the termination is recorded with the wrapped attestor's attestation.
+type supervisedAttestor struct {
+	wrap.Forwarder
+	supervisor *Supervisor
+
+	mu        sync.Mutex
+	abandoned bool
+}
+
+func (a *supervisedAttestor) Attest(ctx *attestation.AttestationContext) error {
+	s := a.supervisor
+	interrupts, stopNotify := s.notify()
+	defer stopNotify()
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Attestor.Attest(ctx)
+	}()
+
+	var deadline <-chan time.Time
+	if !s.deadline.IsZero() {
+		timer := time.NewTimer(time.Until(s.deadline))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	first := syscall.SIGTERM
+	select {
+	case err := <-done:
+		return err
+	case <-deadline:
+		s.termination = &Termination{Reason: ReasonTimeout}
+		log.Warnf("the command exceeded the maximum run duration, stopping it")
+	case received := <-interrupts:
+		s.termination = &Termination{Reason: ReasonSignal, Received: received.String()}
+		if sig, ok := received.(syscall.Signal); ok {
+			first = sig
+		}
+
+		log.Warnf("received %v, stopping the command", received)
+	}
+
+	if s.stop(first, done, interrupts) {
+		return nil
+	}
+
+	log.Warnf("the command did not exit after being killed, no longer waiting for it")
+	s.termination.Abandoned = true
+	a.mu.Lock()
+	a.abandoned = true
+	a.mu.Unlock()
+	return nil
+}
+
+// MarshalJSON marshals the wrapped attestor with the termination of the command, if it was stopped. A wrapped
+// attestor that was abandoned while still running can't be read safely, so only the command and an exit code of -1
+// are recorded for it.
+func (a *supervisedAttestor) MarshalJSON() ([]byte, error) {
+	a.mu.Lock()
+	abandoned := a.abandoned
+	a.mu.Unlock()
+	termination := a.supervisor.termination
+	if abandoned {
+		return json.Marshal(struct {
+			Cmd         []string     `json:"cmd"`
+			ExitCode    int          `json:"exitcode"`
+			Termination *Termination `json:"termination"`
+		}{Cmd: a.supervisor.command, ExitCode: -1, Termination: termination})
+	}
+
+	data, err := json.Marshal(a.Attestor)
+	if err != nil || termination == nil {
+		return data, err
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	if fields["termination"], err = json.Marshal(termination); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(fields)
+}
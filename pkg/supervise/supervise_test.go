@@ -0,0 +1,111 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package supervise
+
+import (
+	"encoding/json"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+)
+
+type commandRun struct {
+	commandrun.CommandRun
+	Termination *Termination `json:"termination"`
+}
+
+func runSupervised(t *testing.T, command []string, opts ...Option) (*Supervisor, commandRun) {
+	s := New(append([]Option{WithCommand(command), WithGracePeriod(time.Second)}, opts...)...)
+	attestors := s.Apply([]attestation.Attestor{commandrun.New(commandrun.WithCommand(command), commandrun.WithSilent(true))})
+	ctx, err := attestation.NewContext(attestors, attestation.WithWorkingDir(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	completed := ctx.CompletedAttestors()
+	require.Len(t, completed, 1)
+	require.Equal(t, commandrun.Type, completed[0].Attestor.Type())
+	require.NoError(t, completed[0].Error)
+
+	data, err := json.Marshal(completed[0].Attestor)
+	require.NoError(t, err)
+	run := commandRun{}
+	require.NoError(t, json.Unmarshal(data, &run))
+	return s, run
+}
+
+func TestFinished(t *testing.T) {
+	s, run := runSupervised(t, []string{"bash", "-c", "echo done"}, WithDeadline(time.Now().Add(time.Minute)))
+	require.NoError(t, s.Err())
+	require.Nil(t, s.Termination())
+	require.Nil(t, run.Termination)
+	require.Equal(t, "done\n", run.Stdout)
+}
+
+func TestDeadline(t *testing.T) {
+	start := time.Now()
+	s, run := runSupervised(t, []string{"bash", "-c", "sleep 30; echo done"}, WithDeadline(time.Now().Add(200*time.Millisecond)))
+	require.Less(t, time.Since(start), 10*time.Second)
+	require.ErrorIs(t, s.Err(), ErrTimedOut)
+	termination := s.Termination()
+	require.Equal(t, ReasonTimeout, termination.Reason)
+	require.False(t, termination.Abandoned)
+	require.Len(t, termination.Signals, 1)
+	require.Equal(t, "terminated", termination.Signals[0].Signal)
+	require.Len(t, termination.Signals[0].Pids, 2)
+	require.Empty(t, termination.Signals[0].Error)
+	require.Equal(t, -1, run.ExitCode)
+	require.Equal(t, termination, run.Termination)
+}
+
+func TestDeadlineEscalates(t *testing.T) {
+	s, _ := runSupervised(t, []string{"bash", "-c", "trap '' TERM; while true; do sleep 0.1; done"}, WithDeadline(time.Now().Add(200*time.Millisecond)))
+	termination := s.Termination()
+	require.Len(t, termination.Signals, 2)
+	require.Equal(t, "terminated", termination.Signals[0].Signal)
+	require.Equal(t, "killed", termination.Signals[1].Signal)
+	require.False(t, termination.Abandoned)
+}
+
+func TestInterrupt(t *testing.T) {
+	interrupts := make(chan os.Signal, 1)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		interrupts <- syscall.SIGINT
+	}()
+
+	s, run := runSupervised(t, []string{"bash", "-c", "trap 'echo interrupted; exit 3' INT; while true; do sleep 0.1; done"}, WithInterrupts(interrupts))
+	require.ErrorIs(t, s.Err(), ErrInterrupted)
+	termination := s.Termination()
+	require.Equal(t, ReasonSignal, termination.Reason)
+	require.Equal(t, "interrupt", termination.Received)
+	require.Len(t, termination.Signals, 1)
+	require.Equal(t, "interrupt", termination.Signals[0].Signal)
+	require.Equal(t, 3, run.ExitCode)
+	require.Equal(t, "interrupted\n", run.Stdout)
+}
+
+func TestSignals(t *testing.T) {
+	// the command signals witness itself, so the signal can only arrive once witness is catching it
+	s, run := runSupervised(t, []string{"bash", "-c", "trap 'exit 3' USR1; kill -USR1 $PPID; while true; do sleep 0.1; done"}, WithSignals(syscall.SIGUSR1))
+	require.ErrorIs(t, s.Err(), ErrInterrupted)
+	termination := s.Termination()
+	require.Equal(t, "user defined signal 1", termination.Received)
+	require.Equal(t, "user defined signal 1", termination.Signals[0].Signal)
+	require.Equal(t, 3, run.ExitCode)
+}
@@ -0,0 +1,204 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tekton
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServiceAccountDir is where Kubernetes mounts the credentials of a pod's service account.
+const ServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// apiVersions are the Tekton API versions runs are read from, newest first.
+var apiVersions = []string{"v1", "v1beta1"}
+
+// Cluster reads runs from the Kubernetes API.
+type Cluster struct {
+	server string
+	token  string
+	client *http.Client
+}
+
+// NewCluster reads runs from the Kubernetes API server at server, authenticating with the bearer token.
+func NewCluster(server, token string, client *http.Client) *Cluster {
+	return &Cluster{server: strings.TrimSuffix(server, "/"), token: token, client: client}
+}
+
+// InCluster reads runs from the Kubernetes API with the credentials of the pod's service account, as Tekton Chains
+// does. The service account needs permission to get taskruns and pipelineruns.
+func InCluster() (*Cluster, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a kubernetes pod, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+
+	token, err := os.ReadFile(filepath.Join(ServiceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	ca, err := os.ReadFile(filepath.Join(ServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster ca: %w", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, errors.New("cluster ca contains no certificates")
+	}
+
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}},
+	}
+
+	return NewCluster("https://"+net.JoinHostPort(host, port), string(bytes.TrimSpace(token)), client), nil
+}
+
+// PodNamespace returns the namespace of the pod's service account.
+func PodNamespace() (string, error) {
+	namespace, err := os.ReadFile(filepath.Join(ServiceAccountDir, "namespace"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read pod namespace: %w", err)
+	}
+
+	return string(bytes.TrimSpace(namespace)), nil
+}
+
+// Get reads the TaskRun or PipelineRun named name in namespace.
+func (c *Cluster) Get(ctx context.Context, kind, namespace, name string) (Run, error) {
+	resource := ""
+	switch kind {
+	case KindTaskRun:
+		resource = "taskruns"
+	case KindPipelineRun:
+		resource = "pipelineruns"
+	default:
+		return Run{}, fmt.Errorf("%v is not a TaskRun or PipelineRun", kind)
+	}
+
+	for _, version := range apiVersions {
+		u := fmt.Sprintf("%v/apis/tekton.dev/%v/namespaces/%v/%v/%v", c.server, version, url.PathEscape(namespace), resource, url.PathEscape(name))
+		data, found, err := c.get(ctx, u)
+		if err != nil {
+			return Run{}, fmt.Errorf("failed to get %v %v/%v: %w", kind, namespace, name, err)
+		}
+
+		// clusters that don't serve the v1 api yet are asked for v1beta1
+		if found {
+			return Parse(data)
+		}
+	}
+
+	return Run{}, fmt.Errorf("%v %v/%v not found", kind, namespace, name)
+}
+
+// TaskRunOf reads the TaskRun that ran pipelineTask of the PipelineRun named pipelineRun in namespace.
+func (c *Cluster) TaskRunOf(ctx context.Context, namespace, pipelineRun, pipelineTask string) (Run, error) {
+	run, err := c.Get(ctx, KindPipelineRun, namespace, pipelineRun)
+	if err != nil {
+		return Run{}, err
+	}
+
+	for _, child := range run.Status.ChildReferences {
+		if child.Kind == KindTaskRun && child.PipelineTaskName == pipelineTask {
+			return c.Get(ctx, KindTaskRun, namespace, child.Name)
+		}
+	}
+
+	return Run{}, fmt.Errorf("PipelineRun %v/%v has no TaskRun for task %v", namespace, pipelineRun, pipelineTask)
+}
+
+func (c *Cluster) get(ctx context.Context, u string) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, false, fmt.Errorf("kubernetes api returned %v: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return data, true, nil
+}
+
+// PodLabels reads the labels of the pod from a file the downward API projects them to, which has a key="value"
+// line for each label.
+func PodLabels(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pod labels: %w", err)
+	}
+
+	defer f.Close()
+	labels := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		key, quoted, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("pod labels line %q is not key=\"value\"", line)
+		}
+
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("pod label %v has an invalid value: %w", key, err)
+		}
+
+		labels[key] = value
+	}
+
+	return labels, scanner.Err()
+}
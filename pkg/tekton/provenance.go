@@ -0,0 +1,398 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tekton
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/witness/pkg/statement"
+)
+
+const (
+	// ProvenanceType is the predicate type of the SLSA v0.2 provenance Tekton Chains produces in its slsa/v1 format.
+	ProvenanceType = "https://slsa.dev/provenance/v0.2"
+	// ChainsBuilderID is the builder Tekton Chains records.
+	ChainsBuilderID = "https://tekton.dev/chains/v2"
+
+	buildTypePrefix = "tekton.dev/"
+)
+
+// Provenance is the SLSA v0.2 predicate as Tekton Chains fills it in.
+type Provenance struct {
+	Builder     Builder     `json:"builder"`
+	BuildType   string      `json:"buildType"`
+	Invocation  Invocation  `json:"invocation"`
+	BuildConfig interface{} `json:"buildConfig,omitempty"`
+	Metadata    *Metadata   `json:"metadata,omitempty"`
+	Materials   []Material  `json:"materials,omitempty"`
+}
+
+type Builder struct {
+	ID string `json:"id"`
+}
+
+type Invocation struct {
+	ConfigSource ConfigSource           `json:"configSource"`
+	Parameters   map[string]interface{} `json:"parameters"`
+	Environment  map[string]interface{} `json:"environment,omitempty"`
+}
+
+type ConfigSource struct {
+	URI        string            `json:"uri,omitempty"`
+	Digest     map[string]string `json:"digest,omitempty"`
+	EntryPoint string            `json:"entryPoint,omitempty"`
+}
+
+type Metadata struct {
+	BuildStartedOn  *time.Time   `json:"buildStartedOn,omitempty"`
+	BuildFinishedOn *time.Time   `json:"buildFinishedOn,omitempty"`
+	Completeness    Completeness `json:"completeness"`
+	Reproducible    bool         `json:"reproducible"`
+}
+
+type Completeness struct {
+	Parameters  bool `json:"parameters"`
+	Environment bool `json:"environment"`
+	Materials   bool `json:"materials"`
+}
+
+type Material struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+// TaskRunConfig is the build config of a TaskRun: the steps it ran.
+type TaskRunConfig struct {
+	Steps []StepConfig `json:"steps"`
+}
+
+type StepConfig struct {
+	EntryPoint  string                 `json:"entryPoint"`
+	Arguments   []string               `json:"arguments"`
+	Environment map[string]interface{} `json:"environment"`
+	Annotations map[string]string      `json:"annotations"`
+}
+
+// PipelineRunConfig is the build config of a PipelineRun: the TaskRuns of its tasks.
+type PipelineRunConfig struct {
+	Tasks []TaskConfig `json:"tasks"`
+}
+
+type TaskConfig struct {
+	Name string `json:"name"`
+	// Ref names the TaskRun of the task, whose own provenance describes its steps.
+	Ref TaskRef `json:"ref"`
+}
+
+type TaskRef struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// NewProvenance describes run with provenance in the format Tekton Chains produces, naming builderID as the builder.
+// Its subjects are the artifacts the run's type hinted results name.
+func NewProvenance(run Run, builderID string) (intoto.Statement, error) {
+	p := Provenance{
+		Builder:   Builder{ID: builderID},
+		BuildType: fmt.Sprintf("%v%v/%v", buildTypePrefix, apiVersionOf(run), run.Kind),
+		Invocation: Invocation{
+			Parameters: make(map[string]interface{}),
+			Environment: map[string]interface{}{
+				"labels":      run.Metadata.Labels,
+				"annotations": run.Metadata.Annotations,
+			},
+		},
+		Metadata: &Metadata{
+			BuildStartedOn:  utc(run.Status.StartTime),
+			BuildFinishedOn: utc(run.Status.CompletionTime),
+		},
+	}
+
+	if source := run.refSource(); source != nil {
+		p.Invocation.ConfigSource = ConfigSource{URI: source.URI, Digest: source.Digest, EntryPoint: source.EntryPoint}
+	}
+
+	for _, param := range run.Spec.Params {
+		p.Invocation.Parameters[param.Name] = param.Value
+	}
+
+	switch run.Kind {
+	case KindTaskRun:
+		p.BuildConfig = taskRunConfig(run)
+	case KindPipelineRun:
+		config := PipelineRunConfig{Tasks: []TaskConfig{}}
+		for _, child := range run.Status.ChildReferences {
+			config.Tasks = append(config.Tasks, TaskConfig{Name: child.PipelineTaskName, Ref: TaskRef{Name: child.Name, Kind: child.Kind}})
+		}
+
+		p.BuildConfig = config
+	}
+
+	materials, err := runMaterials(run)
+	if err != nil {
+		return intoto.Statement{}, err
+	}
+
+	p.Materials = materials
+	predicate, err := json.Marshal(&p)
+	if err != nil {
+		return intoto.Statement{}, err
+	}
+
+	if predicate, err = statement.Canonicalize(predicate); err != nil {
+		return intoto.Statement{}, err
+	}
+
+	subjects, err := runSubjects(run)
+	if err != nil {
+		return intoto.Statement{}, err
+	}
+
+	return intoto.Statement{
+		Type:          intoto.StatementType,
+		PredicateType: ProvenanceType,
+		Subject:       subjects,
+		Predicate:     predicate,
+	}, nil
+}
+
+func taskRunConfig(run Run) TaskRunConfig {
+	config := TaskRunConfig{Steps: []StepConfig{}}
+	specs := map[string]Step{}
+	if run.Status.TaskSpec != nil {
+		for _, step := range run.Status.TaskSpec.Steps {
+			specs[step.Name] = step
+		}
+	}
+
+	for _, state := range run.Status.Steps {
+		spec := specs[state.Name]
+		entryPoint := spec.Script
+		if entryPoint == "" {
+			entryPoint = strings.Join(spec.Command, " ")
+		}
+
+		config.Steps = append(config.Steps, StepConfig{
+			EntryPoint:  entryPoint,
+			Arguments:   spec.Args,
+			Environment: map[string]interface{}{"container": state.Name, "image": state.ImageID},
+		})
+	}
+
+	return config
+}
+
+// runMaterials are the images of the run's steps, its definition, and the sources its CHAINS-GIT results name.
+func runMaterials(run Run) ([]Material, error) {
+	materials := []Material{}
+	seen := map[string]bool{}
+	add := func(m Material) {
+		hashes := make([]string, 0, len(m.Digest))
+		for hash := range m.Digest {
+			hashes = append(hashes, hash)
+		}
+
+		sort.Strings(hashes)
+		key := m.URI
+		for _, hash := range hashes {
+			key += "@" + hash + ":" + m.Digest[hash]
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			materials = append(materials, m)
+		}
+	}
+
+	for _, step := range run.Status.Steps {
+		repository, digest, ok := strings.Cut(strings.TrimPrefix(step.ImageID, "docker-pullable://"), "@")
+		if !ok {
+			continue
+		}
+
+		hash, value, ok := strings.Cut(digest, ":")
+		if !ok {
+			return nil, fmt.Errorf("step %v ran image %v, which doesn't have a digest", step.Name, step.ImageID)
+		}
+
+		add(Material{URI: "oci://" + repository, Digest: map[string]string{hash: value}})
+	}
+
+	if source := run.refSource(); source != nil && source.URI != "" {
+		add(Material{URI: source.URI, Digest: source.Digest})
+	}
+
+	results := resultValues(run)
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+
+	// the sources are added in the order of their results' names, so the materials are the same on every run
+	sort.Strings(names)
+	for _, name := range names {
+		url := results[name]
+		if !strings.HasSuffix(name, "CHAINS-GIT_URL") {
+			continue
+		}
+
+		commit := results[strings.TrimSuffix(name, "URL")+"COMMIT"]
+		if commit == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(url, "git+") {
+			url = "git+" + url
+		}
+
+		add(Material{URI: url, Digest: map[string]string{"sha1": commit}})
+	}
+
+	return materials, nil
+}
+
+// runSubjects are the artifacts the run's type hinted results name, as Tekton Chains reads them: IMAGE_URL and
+// IMAGE_DIGEST pairs, the IMAGES list, ARTIFACT_URI and ARTIFACT_DIGEST pairs, and ARTIFACT_OUTPUTS objects. Pairs
+// may share a prefix or suffix.
+func runSubjects(run Run) ([]intoto.Subject, error) {
+	subjects := map[string]cryptoutil.DigestSet{}
+	add := func(name, digest string) error {
+		if name == "" || digest == "" {
+			return nil
+		}
+
+		hash, value, ok := strings.Cut(digest, ":")
+		if !ok {
+			return fmt.Errorf("digest %v of %v is not algorithm:hex", digest, name)
+		}
+
+		digestValue, ok := digestValues[hash]
+		if !ok {
+			return fmt.Errorf("digest %v of %v uses an unsupported algorithm", digest, name)
+		}
+
+		if subjects[name] == nil {
+			subjects[name] = cryptoutil.DigestSet{}
+		}
+
+		subjects[name][digestValue] = value
+		return nil
+	}
+
+	results := resultValues(run)
+	for name, value := range results {
+		var err error
+		switch {
+		case strings.Contains(name, "IMAGE_URL"):
+			err = add(imageName(value), results[strings.Replace(name, "IMAGE_URL", "IMAGE_DIGEST", 1)])
+		case strings.Contains(name, "ARTIFACT_URI"):
+			err = add(value, results[strings.Replace(name, "ARTIFACT_URI", "ARTIFACT_DIGEST", 1)])
+		case name == "IMAGES":
+			for _, image := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+				repository, digest, _ := strings.Cut(strings.TrimSpace(image), "@")
+				if err = add(imageName(repository), digest); err != nil {
+					break
+				}
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, result := range run.Results() {
+		output, ok := result.Value.(map[string]interface{})
+		if !ok || !strings.HasSuffix(result.Name, "ARTIFACT_OUTPUTS") {
+			continue
+		}
+
+		uri, _ := output["uri"].(string)
+		digest, _ := output["digest"].(string)
+		if err := add(uri, digest); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(subjects))
+	for name := range subjects {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	statementSubjects := make([]intoto.Subject, 0, len(names))
+	for _, name := range names {
+		subject, err := intoto.DigestSetToSubject(name, subjects[name])
+		if err != nil {
+			return nil, err
+		}
+
+		statementSubjects = append(statementSubjects, subject)
+	}
+
+	return statementSubjects, nil
+}
+
+var digestValues = map[string]cryptoutil.DigestValue{
+	"sha256": {Hash: crypto.SHA256},
+	"sha1":   {Hash: crypto.SHA1},
+}
+
+// resultValues maps the names of the run's string results to their values.
+func resultValues(run Run) map[string]string {
+	values := map[string]string{}
+	for _, result := range run.Results() {
+		if value, ok := result.Value.(string); ok {
+			values[result.Name] = strings.TrimSpace(value)
+		}
+	}
+
+	return values
+}
+
+// imageName is the repository of an image reference without its tag or digest, as Chains names image subjects.
+func imageName(ref string) string {
+	ref, _, _ = strings.Cut(strings.TrimSpace(ref), "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+
+	return ref
+}
+
+func apiVersionOf(run Run) string {
+	version := strings.TrimPrefix(run.APIVersion, "tekton.dev/")
+	if version == "v1" {
+		return version
+	}
+
+	return "v1beta1"
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	u := t.UTC()
+	return &u
+}
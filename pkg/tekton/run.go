@@ -0,0 +1,163 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tekton reads the status of Tekton TaskRuns and PipelineRuns, describes them with provenance in the format
+// Tekton Chains produces, and lets provenance signed by Chains be verified against witness policies, so clusters
+// that build with both Tekton and witness can share one policy.
+package tekton
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	KindTaskRun     = "TaskRun"
+	KindPipelineRun = "PipelineRun"
+
+	LabelTask         = "tekton.dev/task"
+	LabelPipeline     = "tekton.dev/pipeline"
+	LabelPipelineTask = "tekton.dev/pipelineTask"
+	LabelTaskRun      = "tekton.dev/taskRun"
+	LabelPipelineRun  = "tekton.dev/pipelineRun"
+)
+
+// Run is a TaskRun or PipelineRun as the Kubernetes API returns it. Only what provenance is derived from is read,
+// from both the v1 and v1beta1 APIs.
+type Run struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   ObjectMeta `json:"metadata"`
+	Spec       RunSpec    `json:"spec"`
+	Status     RunStatus  `json:"status"`
+}
+
+type ObjectMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	UID         string            `json:"uid"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type RunSpec struct {
+	Params []Param `json:"params,omitempty"`
+}
+
+// Param is a parameter or result. Values are strings, arrays, or objects.
+type Param struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+type RunStatus struct {
+	StartTime      *time.Time `json:"startTime,omitempty"`
+	CompletionTime *time.Time `json:"completionTime,omitempty"`
+	// Results are the results of a v1 run. v1beta1 TaskRuns report TaskResults and PipelineRuns PipelineResults.
+	Results         []Param           `json:"results,omitempty"`
+	TaskResults     []Param           `json:"taskResults,omitempty"`
+	PipelineResults []Param           `json:"pipelineResults,omitempty"`
+	Steps           []StepState       `json:"steps,omitempty"`
+	TaskSpec        *TaskSpec         `json:"taskSpec,omitempty"`
+	ChildReferences []ChildReference  `json:"childReferences,omitempty"`
+	Provenance      *StatusProvenance `json:"provenance,omitempty"`
+}
+
+type StepState struct {
+	Name      string `json:"name"`
+	Container string `json:"container"`
+	ImageID   string `json:"imageID"`
+}
+
+type TaskSpec struct {
+	Steps []Step `json:"steps,omitempty"`
+}
+
+type Step struct {
+	Name    string   `json:"name"`
+	Image   string   `json:"image"`
+	Command []string `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Script  string   `json:"script,omitempty"`
+}
+
+type ChildReference struct {
+	Kind             string `json:"kind"`
+	Name             string `json:"name"`
+	PipelineTaskName string `json:"pipelineTaskName"`
+}
+
+// StatusProvenance is where Tekton resolved the definition of the task or pipeline from.
+type StatusProvenance struct {
+	RefSource *RefSource `json:"refSource,omitempty"`
+	// ConfigSource is the name of RefSource before Tekton v0.50.
+	ConfigSource *RefSource `json:"configSource,omitempty"`
+}
+
+type RefSource struct {
+	URI        string            `json:"uri"`
+	Digest     map[string]string `json:"digest"`
+	EntryPoint string            `json:"entryPoint"`
+}
+
+// Parse reads a TaskRun or PipelineRun from JSON, as kubectl get -o json prints it.
+func Parse(data []byte) (Run, error) {
+	run := Run{}
+	if err := json.Unmarshal(data, &run); err != nil {
+		return run, fmt.Errorf("failed to parse tekton run: %w", err)
+	}
+
+	if run.Kind != KindTaskRun && run.Kind != KindPipelineRun {
+		return run, fmt.Errorf("%v is not a TaskRun or PipelineRun", run.Kind)
+	}
+
+	if !strings.HasPrefix(run.APIVersion, "tekton.dev/") {
+		return run, fmt.Errorf("api version %v is not a tekton api", run.APIVersion)
+	}
+
+	return run, nil
+}
+
+// Results returns the results of the run from whichever API version it was read from.
+func (r Run) Results() []Param {
+	results := append([]Param{}, r.Status.Results...)
+	results = append(results, r.Status.TaskResults...)
+	return append(results, r.Status.PipelineResults...)
+}
+
+// StepName is the name a policy step refers to the run by: the name of its task in the pipeline, its task, or its
+// pipeline.
+func (r Run) StepName() string {
+	for _, label := range []string{LabelPipelineTask, LabelTask, LabelPipeline} {
+		if name := r.Metadata.Labels[label]; name != "" {
+			return name
+		}
+	}
+
+	return ""
+}
+
+func (r Run) refSource() *RefSource {
+	if r.Status.Provenance == nil {
+		return nil
+	}
+
+	if r.Status.Provenance.RefSource != nil {
+		return r.Status.Provenance.RefSource
+	}
+
+	return r.Status.Provenance.ConfigSource
+}
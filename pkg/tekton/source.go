@@ -0,0 +1,175 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tekton
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/predicate"
+)
+
+var _ source.Sourcer = &Source{}
+
+// Source presents signed Tekton provenance as attestation collections, so policies can verify it like evidence
+// recorded by witness. Each provenance is a collection named after the task or pipeline it describes, with the
+// provenance as its only attestation, so a policy step named after a Tekton task requires the
+// https://slsa.dev/provenance/v0.2 attestation type.
+type Source struct {
+	envelopes map[string]source.CollectionEnvelope
+	byName    map[string][]string
+}
+
+func NewSource() *Source {
+	return &Source{
+		envelopes: make(map[string]source.CollectionEnvelope),
+		byName:    make(map[string][]string),
+	}
+}
+
+// IsProvenance reports whether env is signed Tekton provenance rather than a witness collection.
+func IsProvenance(env dsse.Envelope) bool {
+	st := intoto.Statement{}
+	if err := json.Unmarshal(env.Payload, &st); err != nil || st.PredicateType != ProvenanceType {
+		return false
+	}
+
+	p := struct {
+		BuildType string `json:"buildType"`
+	}{}
+
+	return json.Unmarshal(st.Predicate, &p) == nil && strings.HasPrefix(p.BuildType, buildTypePrefix)
+}
+
+// Load adds the Tekton provenance env under reference. The signature is checked when the policy verifies it.
+func (s *Source) Load(reference string, env dsse.Envelope) error {
+	if _, ok := s.envelopes[reference]; ok {
+		return source.ErrDuplicateReference(reference)
+	}
+
+	st := intoto.Statement{}
+	if err := json.Unmarshal(env.Payload, &st); err != nil {
+		return fmt.Errorf("failed to parse tekton provenance %v: %w", reference, err)
+	}
+
+	p := Provenance{}
+	if err := json.Unmarshal(st.Predicate, &p); err != nil {
+		return fmt.Errorf("failed to parse tekton provenance %v: %w", reference, err)
+	}
+
+	name := stepName(p)
+	if name == "" {
+		return fmt.Errorf("tekton provenance %v doesn't label the task or pipeline it describes", reference)
+	}
+
+	opaque, err := predicate.NewOpaque(ProvenanceType, st.Predicate)
+	if err != nil {
+		return fmt.Errorf("failed to read tekton provenance %v: %w", reference, err)
+	}
+
+	started, finished := time.Time{}, time.Time{}
+	if p.Metadata != nil && p.Metadata.BuildStartedOn != nil {
+		started = *p.Metadata.BuildStartedOn
+	}
+
+	if p.Metadata != nil && p.Metadata.BuildFinishedOn != nil {
+		finished = *p.Metadata.BuildFinishedOn
+	}
+
+	// the policy only accepts statements of collections, while the envelope keeps the provenance as it was signed
+	view := st
+	view.PredicateType = attestation.CollectionType
+	s.envelopes[reference] = source.CollectionEnvelope{
+		Reference: reference,
+		Envelope:  env,
+		Statement: view,
+		Collection: attestation.Collection{
+			Name: name,
+			Attestations: []attestation.CollectionAttestation{{
+				Type:        ProvenanceType,
+				Attestation: opaque,
+				StartTime:   started,
+				EndTime:     finished,
+			}},
+		},
+	}
+
+	s.byName[name] = append(s.byName[name], reference)
+	return nil
+}
+
+func (s *Source) Search(ctx context.Context, collectionName string, subjectDigests, attestations []string) ([]source.CollectionEnvelope, error) {
+	digests := make(map[string]bool, len(subjectDigests))
+	for _, digest := range subjectDigests {
+		digests[digest] = true
+	}
+
+	matches := []source.CollectionEnvelope{}
+	for _, reference := range s.byName[collectionName] {
+		env := s.envelopes[reference]
+		if !hasSubject(env.Statement, digests) {
+			continue
+		}
+
+		// the provenance is the only attestation a Tekton collection has
+		matched := true
+		for _, attestationType := range attestations {
+			if attestationType != ProvenanceType {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			matches = append(matches, env)
+		}
+	}
+
+	return matches, nil
+}
+
+func hasSubject(st intoto.Statement, digests map[string]bool) bool {
+	for _, subject := range st.Subject {
+		for _, digest := range subject.Digest {
+			if digests[digest] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// stepName is the name of the task or pipeline the provenance describes, from the labels Chains records. The labels
+// are whatever the run's creator set, as the build config doesn't record a name for a TaskRun, so they only choose the
+// policy step to check the provenance against. Steps that must be a particular task pin its definition, recorded in
+// the signed invocation's configSource, in a rego policy.
+func stepName(p Provenance) string {
+	labels, _ := p.Invocation.Environment["labels"].(map[string]interface{})
+	for _, label := range []string{LabelPipelineTask, LabelTask, LabelPipeline} {
+		if name, _ := labels[label].(string); name != "" {
+			return name
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,222 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tekton
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+)
+
+const (
+	imageDigest = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	stepDigest  = "60e65a8e4030022260a4f84166814b2406e6a0e1e9a10b5cd9dbbcbc4e53e1d2"
+	commit      = "2fd4e1c67a2d28fced849ee1bb76e7391b93eb12"
+)
+
+const taskRunJSON = `{
+  "apiVersion": "tekton.dev/v1",
+  "kind": "TaskRun",
+  "metadata": {
+    "name": "release-build-x7k2p",
+    "namespace": "ci",
+    "labels": {"tekton.dev/task": "buildah", "tekton.dev/pipelineTask": "build", "tekton.dev/pipelineRun": "release"}
+  },
+  "spec": {"params": [{"name": "IMAGE", "value": "ghcr.io/acme/app:1.4"}, {"name": "EXTRA_ARGS", "value": ["--squash"]}]},
+  "status": {
+    "startTime": "2023-10-01T12:00:00Z",
+    "completionTime": "2023-10-01T12:05:00Z",
+    "results": [
+      {"name": "IMAGE_URL", "value": "ghcr.io/acme/app:1.4\n"},
+      {"name": "IMAGE_DIGEST", "value": "sha256:` + imageDigest + `"},
+      {"name": "CHAINS-GIT_URL", "value": "https://github.com/acme/app"},
+      {"name": "CHAINS-GIT_COMMIT", "value": "` + commit + `"},
+      {"name": "SBOM_ARTIFACT_OUTPUTS", "value": {"uri": "ghcr.io/acme/app.sbom", "digest": "sha256:` + stepDigest + `"}}
+    ],
+    "steps": [{"name": "build", "container": "step-build", "imageID": "docker-pullable://quay.io/buildah/stable@sha256:` + stepDigest + `"}],
+    "taskSpec": {"steps": [{"name": "build", "image": "quay.io/buildah/stable", "script": "buildah bud -t $(params.IMAGE) ."}]},
+    "provenance": {"refSource": {"uri": "git+https://github.com/acme/tasks", "digest": {"sha1": "` + commit + `"}, "entryPoint": "buildah.yaml"}}
+  }
+}`
+
+func TestNewProvenance(t *testing.T) {
+	run, err := Parse([]byte(taskRunJSON))
+	require.NoError(t, err)
+	require.Equal(t, "build", run.StepName())
+
+	st, err := NewProvenance(run, ChainsBuilderID)
+	require.NoError(t, err)
+	require.Equal(t, ProvenanceType, st.PredicateType)
+	require.Equal(t, []intoto.Subject{
+		{Name: "ghcr.io/acme/app", Digest: map[string]string{"sha256": imageDigest}},
+		{Name: "ghcr.io/acme/app.sbom", Digest: map[string]string{"sha256": stepDigest}},
+	}, st.Subject)
+
+	p := Provenance{}
+	require.NoError(t, json.Unmarshal(st.Predicate, &p))
+	require.Equal(t, ChainsBuilderID, p.Builder.ID)
+	require.Equal(t, "tekton.dev/v1/TaskRun", p.BuildType)
+	require.Equal(t, "buildah.yaml", p.Invocation.ConfigSource.EntryPoint)
+	require.Equal(t, "ghcr.io/acme/app:1.4", p.Invocation.Parameters["IMAGE"])
+	require.Equal(t, []Material{
+		{URI: "oci://quay.io/buildah/stable", Digest: map[string]string{"sha256": stepDigest}},
+		{URI: "git+https://github.com/acme/tasks", Digest: map[string]string{"sha1": commit}},
+		{URI: "git+https://github.com/acme/app", Digest: map[string]string{"sha1": commit}},
+	}, p.Materials)
+	require.Equal(t, "2023-10-01T12:05:00Z", p.Metadata.BuildFinishedOn.Format("2006-01-02T15:04:05Z07:00"))
+
+	config := TaskRunConfig{}
+	data, err := json.Marshal(p.BuildConfig)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &config))
+	require.Equal(t, "buildah bud -t $(params.IMAGE) .", config.Steps[0].EntryPoint)
+
+	_, err = Parse([]byte(`{"apiVersion": "v1", "kind": "Pod"}`))
+	require.ErrorContains(t, err, "not a TaskRun or PipelineRun")
+}
+
+func TestRunMaterials(t *testing.T) {
+	run := Run{Kind: KindPipelineRun, Status: RunStatus{PipelineResults: []Param{
+		{Name: "TOOLS_CHAINS-GIT_URL", Value: "https://github.com/acme/tools"},
+		{Name: "TOOLS_CHAINS-GIT_COMMIT", Value: commit},
+		{Name: "APP_CHAINS-GIT_URL", Value: "git+https://github.com/acme/app"},
+		{Name: "APP_CHAINS-GIT_COMMIT", Value: commit},
+		{Name: "DOCS_CHAINS-GIT_URL", Value: "https://github.com/acme/docs"},
+		{Name: "DOCS_CHAINS-GIT_COMMIT", Value: commit},
+	}}}
+
+	// the order of the materials doesn't depend on the order maps are ranged over
+	for i := 0; i < 10; i++ {
+		materials, err := runMaterials(run)
+		require.NoError(t, err)
+		require.Equal(t, []Material{
+			{URI: "git+https://github.com/acme/app", Digest: map[string]string{"sha1": commit}},
+			{URI: "git+https://github.com/acme/docs", Digest: map[string]string{"sha1": commit}},
+			{URI: "git+https://github.com/acme/tools", Digest: map[string]string{"sha1": commit}},
+		}, materials)
+	}
+}
+
+func TestRunSubjects(t *testing.T) {
+	run := Run{Kind: KindPipelineRun, Status: RunStatus{PipelineResults: []Param{
+		{Name: "IMAGES", Value: "ghcr.io/acme/a@sha256:" + imageDigest + ", ghcr.io/acme/b:2@sha256:" + stepDigest},
+		{Name: "APP_ARTIFACT_URI", Value: "https://example.com/app.tar.gz"},
+		{Name: "APP_ARTIFACT_DIGEST", Value: "sha256:" + imageDigest},
+		{Name: "OTHER_IMAGE_URL", Value: "ghcr.io/acme/other"},
+	}}}
+
+	subjects, err := runSubjects(run)
+	require.NoError(t, err)
+	names := []string{}
+	for _, subject := range subjects {
+		names = append(names, subject.Name)
+	}
+
+	require.Equal(t, []string{"ghcr.io/acme/a", "ghcr.io/acme/b", "https://example.com/app.tar.gz"}, names)
+
+	run.Status.PipelineResults = []Param{{Name: "IMAGE_URL", Value: "app"}, {Name: "IMAGE_DIGEST", Value: "md5:abc"}}
+	_, err = runSubjects(run)
+	require.ErrorContains(t, err, "unsupported algorithm")
+
+	require.Equal(t, "localhost:5000/app", imageName("localhost:5000/app:1.0"))
+	require.Equal(t, "localhost:5000/app", imageName("localhost:5000/app"))
+}
+
+func TestCluster(t *testing.T) {
+	pipelineRun := `{"apiVersion": "tekton.dev/v1beta1", "kind": "PipelineRun", "metadata": {"name": "release"},
+		"status": {"childReferences": [{"kind": "TaskRun", "name": "release-build-x7k2p", "pipelineTaskName": "build"}]}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/apis/tekton.dev/v1/namespaces/ci/taskruns/release-build-x7k2p":
+			w.Write([]byte(taskRunJSON))
+		case "/apis/tekton.dev/v1beta1/namespaces/ci/pipelineruns/release":
+			w.Write([]byte(pipelineRun))
+		case "/apis/tekton.dev/v1/namespaces/forbidden/taskruns/run":
+			http.Error(w, `taskruns.tekton.dev "run" is forbidden`, http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	defer server.Close()
+	cluster := NewCluster(server.URL, "token", server.Client())
+	run, err := cluster.TaskRunOf(context.Background(), "ci", "release", "build")
+	require.NoError(t, err)
+	require.Equal(t, "release-build-x7k2p", run.Metadata.Name)
+
+	_, err = cluster.TaskRunOf(context.Background(), "ci", "release", "test")
+	require.ErrorContains(t, err, "has no TaskRun for task test")
+	_, err = cluster.Get(context.Background(), KindTaskRun, "ci", "missing")
+	require.ErrorContains(t, err, "not found")
+	_, err = cluster.Get(context.Background(), KindTaskRun, "forbidden", "run")
+	require.ErrorContains(t, err, "is forbidden")
+}
+
+func TestPodLabels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "labels")
+	require.NoError(t, os.WriteFile(path, []byte("app.kubernetes.io/managed-by=\"tekton-pipelines\"\ntekton.dev/taskRun=\"release-build-x7k2p\"\n"), 0644))
+	labels, err := PodLabels(path)
+	require.NoError(t, err)
+	require.Equal(t, "release-build-x7k2p", labels[LabelTaskRun])
+
+	require.NoError(t, os.WriteFile(path, []byte("tekton.dev/taskRun=release\n"), 0644))
+	_, err = PodLabels(path)
+	require.ErrorContains(t, err, "invalid value")
+}
+
+func TestSource(t *testing.T) {
+	run, err := Parse([]byte(taskRunJSON))
+	require.NoError(t, err)
+	st, err := NewProvenance(run, ChainsBuilderID)
+	require.NoError(t, err)
+	payload, err := json.Marshal(&st)
+	require.NoError(t, err)
+	env := dsse.Envelope{PayloadType: intoto.PayloadType, Payload: payload}
+	require.True(t, IsProvenance(env))
+	require.False(t, IsProvenance(dsse.Envelope{Payload: []byte(`{"predicateType": "https://slsa.dev/provenance/v0.2", "predicate": {"buildType": "https://github.com/Attestations/GitHubActionsWorkflow@v1"}}`)}))
+
+	s := NewSource()
+	require.NoError(t, s.Load("build.json", env))
+	require.Error(t, s.Load("build.json", env))
+
+	found, err := s.Search(context.Background(), "build", []string{imageDigest}, []string{ProvenanceType})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "build", found[0].Collection.Name)
+	require.Equal(t, ProvenanceType, found[0].Collection.Attestations[0].Type)
+
+	found, err = s.Search(context.Background(), "build", []string{imageDigest}, []string{"https://witness.dev/attestations/command-run/v0.1"})
+	require.NoError(t, err)
+	require.Empty(t, found)
+	found, err = s.Search(context.Background(), "build", []string{commit}, nil)
+	require.NoError(t, err)
+	require.Empty(t, found)
+
+	run.Metadata.Labels = nil
+	st, err = NewProvenance(run, ChainsBuilderID)
+	require.NoError(t, err)
+	payload, err = json.Marshal(&st)
+	require.NoError(t, err)
+	require.ErrorContains(t, s.Load("unlabeled.json", dsse.Envelope{Payload: payload}), "doesn't label the task")
+}
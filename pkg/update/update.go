@@ -0,0 +1,320 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package update finds witness releases and replaces the running binary with one whose release attestation is
+// signed by a trusted key.
+package update
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/witness/pkg/verify"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	DefaultAPI        = "https://api.github.com"
+	DefaultRepository = "testifysec/witness"
+
+	// maxDownloadSize bounds release assets so a misbehaving server can't exhaust memory.
+	maxDownloadSize = 256 << 20
+)
+
+// commitSuffix matches the short commit release builds append to their version, such as v0.1.14-abc1234.
+var commitSuffix = regexp.MustCompile(`-[0-9a-f]{7,40}$`)
+
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	Assets []Asset `json:"assets"`
+}
+
+// ArchiveName is the name of the release archive goreleaser publishes for a platform.
+func (r Release) ArchiveName(goos, goarch string) string {
+	return fmt.Sprintf("witness_%v_%v_%v.tar.gz", strings.TrimPrefix(r.Tag, "v"), goos, goarch)
+}
+
+// AttestationName is the name of the release asset holding the signed attestation of the release build.
+func (r Release) AttestationName() string {
+	return fmt.Sprintf("witness_%v.attestation.json", strings.TrimPrefix(r.Tag, "v"))
+}
+
+func (r Release) asset(name string) (Asset, error) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset, nil
+		}
+	}
+
+	return Asset{}, fmt.Errorf("release %v has no asset %v", r.Tag, name)
+}
+
+type Client struct {
+	http       *http.Client
+	api        string
+	repository string
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+func WithAPI(api string) Option {
+	return func(c *Client) {
+		c.api = strings.TrimSuffix(api, "/")
+	}
+}
+
+func WithRepository(repository string) Option {
+	return func(c *Client) {
+		c.repository = repository
+	}
+}
+
+func New(opts ...Option) *Client {
+	c := &Client{
+		http:       http.DefaultClient,
+		api:        DefaultAPI,
+		repository: DefaultRepository,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Latest returns the newest release that isn't a prerelease.
+func (c *Client) Latest(ctx context.Context) (Release, error) {
+	return c.release(ctx, "latest")
+}
+
+// Tag returns the release with the tag, which may omit the v prefix.
+func (c *Client) Tag(ctx context.Context, tag string) (Release, error) {
+	if !strings.HasPrefix(tag, "v") {
+		tag = "v" + tag
+	}
+
+	return c.release(ctx, "tags/"+url.PathEscape(tag))
+}
+
+func (c *Client) release(ctx context.Context, path string) (Release, error) {
+	body, err := c.get(ctx, fmt.Sprintf("%v/repos/%v/releases/%v", c.api, c.repository, path))
+	if err != nil {
+		return Release{}, fmt.Errorf("failed to find release: %w", err)
+	}
+
+	release := Release{}
+	if err := json.Unmarshal(body, &release); err != nil {
+		return Release{}, fmt.Errorf("failed to parse release: %w", err)
+	}
+
+	return release, nil
+}
+
+func (c *Client) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v returned %v", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) > maxDownloadSize {
+		return nil, fmt.Errorf("%v is larger than %v bytes", url, maxDownloadSize)
+	}
+
+	return body, nil
+}
+
+// Download fetches the witness binary of the release for the running platform. The binary is only returned if its
+// digest is a subject of the release attestation and the attestation is signed by one of verifiers.
+func (c *Client) Download(ctx context.Context, release Release, verifiers []cryptoutil.Verifier) ([]byte, error) {
+	if len(verifiers) == 0 {
+		return nil, errors.New("at least one release key is required to verify the release")
+	}
+
+	attestationAsset, err := release.asset(release.AttestationName())
+	if err != nil {
+		return nil, err
+	}
+
+	archiveAsset, err := release.asset(release.ArchiveName(runtime.GOOS, runtime.GOARCH))
+	if err != nil {
+		return nil, err
+	}
+
+	attestationBytes, err := c.get(ctx, attestationAsset.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download release attestation: %w", err)
+	}
+
+	attestation := dsse.Envelope{}
+	if err := json.Unmarshal(attestationBytes, &attestation); err != nil {
+		return nil, fmt.Errorf("failed to parse release attestation: %w", err)
+	}
+
+	trusted, err := verify.ReleaseDigests([]dsse.Envelope{attestation}, verifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := c.get(ctx, archiveAsset.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download release archive: %w", err)
+	}
+
+	binary, err := extractBinary(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %v: %w", archiveAsset.Name, err)
+	}
+
+	digest := sha256.Sum256(binary)
+	if _, ok := trusted[hex.EncodeToString(digest[:])]; !ok {
+		return nil, fmt.Errorf("witness binary in %v is not a subject of the release attestation", archiveAsset.Name)
+	}
+
+	return binary, nil
+}
+
+// extractBinary returns the witness binary from a gzipped tarball.
+func extractBinary(archive []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("archive does not contain a witness binary")
+		} else if err != nil {
+			return nil, err
+		}
+
+		name := filepath.Base(header.Name)
+		if header.Typeflag != tar.TypeReg || (name != "witness" && name != "witness.exe") {
+			continue
+		}
+
+		return io.ReadAll(io.LimitReader(tr, maxDownloadSize))
+	}
+}
+
+// Newer reports whether the release is newer than the current version. Versions that aren't releases, such as dev
+// builds, are older than every release.
+func Newer(current string, release Release) bool {
+	current, latest := releaseVersion(current), releaseVersion(release.Tag)
+	if !semver.IsValid(current) {
+		return semver.IsValid(latest)
+	}
+
+	return semver.Compare(latest, current) > 0
+}
+
+// releaseVersion strips the commit release builds append to their tag and adds the v prefix semver expects.
+func releaseVersion(version string) string {
+	version = commitSuffix.ReplaceAllString(version, "")
+	if version != "" && !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+
+	return version
+}
+
+// Replace swaps the binary at path for binary. The new binary is written next to the old one and renamed over it so
+// an interrupted update never leaves a partial binary behind.
+func Replace(path string, binary []byte) error {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".witness-update-*")
+	if err != nil {
+		return fmt.Errorf("failed to create the new binary: %w", err)
+	}
+
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0111); err != nil {
+		return err
+	}
+
+	// windows won't replace a running executable, but it will rename one
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+)
+
+func archiveOf(t *testing.T, binary []byte) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, contents := range map[string][]byte{"README.md": []byte("readme"), "witness": binary} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(contents)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write(contents)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func releaseServer(t *testing.T, signer cryptoutil.Signer, attested, published []byte) *httptest.Server {
+	digest := sha256.Sum256(attested)
+	statement, err := json.Marshal(intoto.Statement{
+		Type:    intoto.StatementType,
+		Subject: []intoto.Subject{{Name: "witness", Digest: map[string]string{"sha256": hex.EncodeToString(digest[:])}}},
+	})
+	require.NoError(t, err)
+	envelope, err := dsse.Sign(intoto.PayloadType, bytes.NewReader(statement), dsse.SignWithSigners(signer))
+	require.NoError(t, err)
+	attestation, err := json.Marshal(envelope)
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	release := Release{Tag: "v0.2.0"}
+	release.Assets = []Asset{
+		{Name: release.AttestationName(), URL: server.URL + "/attestation"},
+		{Name: release.ArchiveName(runtime.GOOS, runtime.GOARCH), URL: server.URL + "/archive"},
+	}
+
+	mux.HandleFunc("/repos/testifysec/witness/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(release))
+	})
+	mux.HandleFunc("/attestation", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(attestation) })
+	mux.HandleFunc("/archive", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(archiveOf(t, published)) })
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newSigner(t *testing.T) (cryptoutil.Signer, cryptoutil.Verifier) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := cryptoutil.NewECDSASigner(key, crypto.SHA256)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	return signer, verifier
+}
+
+func TestDownload(t *testing.T) {
+	signer, verifier := newSigner(t)
+	binary := []byte("new witness")
+	server := releaseServer(t, signer, binary, binary)
+	client := New(WithAPI(server.URL))
+	release, err := client.Latest(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "v0.2.0", release.Tag)
+
+	downloaded, err := client.Download(context.Background(), release, []cryptoutil.Verifier{verifier})
+	require.NoError(t, err)
+	require.Equal(t, binary, downloaded)
+
+	_, otherVerifier := newSigner(t)
+	_, err = client.Download(context.Background(), release, []cryptoutil.Verifier{otherVerifier})
+	require.ErrorContains(t, err, "not signed by a release signer")
+
+	_, err = client.Download(context.Background(), release, nil)
+	require.ErrorContains(t, err, "release key is required")
+}
+
+func TestDownloadTampered(t *testing.T) {
+	signer, verifier := newSigner(t)
+	server := releaseServer(t, signer, []byte("new witness"), []byte("tampered witness"))
+	client := New(WithAPI(server.URL))
+	release, err := client.Latest(context.Background())
+	require.NoError(t, err)
+
+	_, err = client.Download(context.Background(), release, []cryptoutil.Verifier{verifier})
+	require.ErrorContains(t, err, "not a subject of the release attestation")
+}
+
+func TestNewer(t *testing.T) {
+	require.True(t, Newer("v0.1.14-abc1234", Release{Tag: "v0.2.0"}))
+	require.True(t, Newer("dev", Release{Tag: "v0.1.0"}))
+	require.False(t, Newer("v0.2.0-abc1234", Release{Tag: "v0.2.0"}))
+	require.False(t, Newer("0.2.1", Release{Tag: "v0.2.0"}))
+	require.True(t, Newer("v0.2.0-rc1-abc1234", Release{Tag: "v0.2.0"}))
+}
+
+func TestReplace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "witness")
+	require.NoError(t, os.WriteFile(path, []byte("old witness"), 0755))
+	link := filepath.Join(dir, "link")
+	require.NoError(t, os.Symlink(path, link))
+
+	require.NoError(t, Replace(link, []byte("new witness")))
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "new witness", string(contents))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
@@ -0,0 +1,151 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/go-witness/source"
+)
+
+// stepApprovers are who may approve a step. Patterns come from the policy, while members of its approver groups come
+// from an identity provider and are compared exactly, so a member whose email address looks like a pattern can't
+// approve for anyone it matches. Only certificates that meet the certificate constraint of one of the step's
+// functionaries count, so a certificate from a root the step doesn't trust can't approve it.
+type stepApprovers struct {
+	patterns      []string
+	members       []string
+	functionaries []policy.Functionary
+	trustBundles  map[string]policy.TrustBundle
+}
+
+// approvers returns the approvers of each step, with its approver groups resolved into members and the functionaries
+// the step has in pol, whose roots are looked up in trustBundles.
+func (pe policyExtensions) approvers(pol policy.Policy, trustBundles map[string]policy.TrustBundle, members map[string][]string) map[string]stepApprovers {
+	approvers := make(map[string]stepApprovers)
+	for key, step := range pe.Steps {
+		if len(step.Approvers) == 0 && len(step.ApproverGroups) == 0 {
+			continue
+		}
+
+		sa := stepApprovers{patterns: step.Approvers, functionaries: pol.Steps[key].Functionaries, trustBundles: trustBundles}
+		for _, group := range step.ApproverGroups {
+			sa.members = append(sa.members, members[group]...)
+		}
+
+		approvers[stepName(key, step)] = sa
+	}
+
+	return approvers
+}
+
+// approves reports whether email is one of the approvers. Email addresses are compared case insensitively, and * in
+// a pattern matches any characters, so *@example.com accepts anyone at example.com.
+func (sa stepApprovers) approves(email string) bool {
+	email = strings.ToLower(email)
+	for _, pattern := range sa.patterns {
+		if globMatch(strings.ToLower(pattern), email) {
+			return true
+		}
+	}
+
+	for _, member := range sa.members {
+		if strings.EqualFold(member, email) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// functionary reports whether the certificate of verifier meets the certificate constraint of one of the step's
+// functionaries.
+func (sa stepApprovers) functionary(verifier *cryptoutil.X509Verifier) bool {
+	for _, functionary := range sa.functionaries {
+		if len(functionary.CertConstraint.Roots) == 0 {
+			continue
+		}
+
+		if err := functionary.CertConstraint.Check(verifier, sa.trustBundles); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifyApprovers removes collections of steps with approvers that weren't signed by a certificate issued to one of
+// the approvers, such as an S/MIME certificate from a corporate PKI. Functionaries decide which roots are trusted,
+// while approvers narrow who may sign by the email addresses of their certificates.
+func verifyApprovers(accepted map[string][]source.VerifiedCollection, approvers map[string]stepApprovers) (map[string][]source.VerifiedCollection, error) {
+	result := make(map[string][]source.VerifiedCollection, len(accepted))
+	for step, collections := range accepted {
+		result[step] = collections
+	}
+
+	for step, sa := range approvers {
+		kept := make([]source.VerifiedCollection, 0, len(result[step]))
+		var lastErr error
+		for _, collection := range result[step] {
+			if err := checkApprovers(collection, sa); err != nil {
+				lastErr = fmt.Errorf("%v: %w", collection.Reference, err)
+				continue
+			}
+
+			kept = append(kept, collection)
+		}
+
+		if len(kept) == 0 {
+			if lastErr == nil {
+				lastErr = errors.New("no evidence")
+			}
+
+			return nil, fmt.Errorf("no evidence for step %v is signed by an approver: %w", step, lastErr)
+		}
+
+		result[step] = kept
+	}
+
+	return result, nil
+}
+
+// checkApprovers checks that a certificate that signed the collection as a functionary of the step has the email
+// address of one of the approvers.
+func checkApprovers(collection source.VerifiedCollection, sa stepApprovers) error {
+	emails := make([]string, 0)
+	for _, verifier := range collection.Verifiers {
+		x509Verifier, ok := verifier.(*cryptoutil.X509Verifier)
+		if !ok || !sa.functionary(x509Verifier) {
+			continue
+		}
+
+		for _, email := range x509Verifier.Certificate().EmailAddresses {
+			emails = append(emails, email)
+			if sa.approves(email) {
+				return nil
+			}
+		}
+	}
+
+	if len(emails) == 0 {
+		return errors.New("not signed by a functionary with a certificate issued to an email address")
+	}
+
+	return fmt.Errorf("signers %v are not approvers", emails)
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/go-witness/source"
+)
+
+// approverCA issues the certificates approvers sign with.
+type approverCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newApproverCA(t *testing.T) approverCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "corporate root"}, IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return approverCA{cert: cert, key: key}
+}
+
+func (ca approverCA) collection(t *testing.T, ref string, emails ...string) source.VerifiedCollection {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{SerialNumber: big.NewInt(2), EmailAddresses: emails, NotBefore: time.Now().Add(-time.Minute), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	verifier, err := cryptoutil.NewX509Verifier(cert, nil, nil, time.Now())
+	require.NoError(t, err)
+	return source.VerifiedCollection{
+		Verifiers:          []cryptoutil.Verifier{verifier},
+		CollectionEnvelope: source.CollectionEnvelope{Reference: ref},
+	}
+}
+
+// trusting makes the step's functionaries anyone with a certificate from the roots of cas.
+func trusting(sa stepApprovers, cas ...approverCA) stepApprovers {
+	sa.trustBundles = map[string]policy.TrustBundle{}
+	for i, ca := range cas {
+		id := fmt.Sprintf("root-%v", i)
+		sa.trustBundles[id] = policy.TrustBundle{Root: ca.cert}
+		sa.functionaries = append(sa.functionaries, policy.Functionary{Type: "root", CertConstraint: policy.CertConstraint{
+			CommonName: "*", DNSNames: []string{"*"}, Emails: []string{"*"}, Organizations: []string{"*"}, URIs: []string{"*"}, Roots: []string{id},
+		}})
+	}
+
+	return sa
+}
+
+func TestVerifyApprovers(t *testing.T) {
+	ca := newApproverCA(t)
+	alice := ca.collection(t, "alice", "Alice@Example.com")
+	mallory := ca.collection(t, "mallory", "mallory@example.net")
+	accepted := map[string][]source.VerifiedCollection{"approve": {alice, mallory}}
+
+	result, err := verifyApprovers(accepted, map[string]stepApprovers{"approve": trusting(stepApprovers{patterns: []string{"*@example.com"}}, ca)})
+	require.NoError(t, err)
+	require.Len(t, result["approve"], 1)
+	require.Equal(t, "alice", result["approve"][0].Reference)
+
+	_, err = verifyApprovers(accepted, map[string]stepApprovers{"approve": trusting(stepApprovers{patterns: []string{"bob@example.com"}}, ca)})
+	require.ErrorContains(t, err, "no evidence for step approve is signed by an approver")
+
+	_, err = verifyApprovers(map[string][]source.VerifiedCollection{"approve": {{}}}, map[string]stepApprovers{"approve": trusting(stepApprovers{patterns: []string{"*"}}, ca)})
+	require.ErrorContains(t, err, "not signed by a functionary with a certificate issued to an email address")
+}
+
+func TestVerifyApproversOnlyCountsFunctionaries(t *testing.T) {
+	corporate, other := newApproverCA(t), newApproverCA(t)
+	// a certificate for alice's address from a root the step doesn't trust, such as one a sub-policy added for
+	// another step, can't approve it
+	forged := other.collection(t, "forged", "alice@example.com")
+	_, err := verifyApprovers(map[string][]source.VerifiedCollection{"approve": {forged}}, map[string]stepApprovers{"approve": trusting(stepApprovers{patterns: []string{"alice@example.com"}}, corporate)})
+	require.ErrorContains(t, err, "not signed by a functionary")
+
+	// functionaries that only trust public keys don't make certificates count
+	sa := stepApprovers{patterns: []string{"alice@example.com"}, functionaries: []policy.Functionary{{Type: "publickey", PublicKeyID: "key"}}}
+	_, err = verifyApprovers(map[string][]source.VerifiedCollection{"approve": {corporate.collection(t, "alice", "alice@example.com")}}, map[string]stepApprovers{"approve": sa})
+	require.ErrorContains(t, err, "not signed by a functionary")
+
+	// constraints on the certificate apply too
+	constrained := trusting(stepApprovers{patterns: []string{"*@example.com"}}, corporate)
+	constrained.functionaries[0].CertConstraint.Emails = []string{"alice@example.com"}
+	result, err := verifyApprovers(map[string][]source.VerifiedCollection{"approve": {corporate.collection(t, "alice", "alice@example.com"), corporate.collection(t, "bob", "bob@example.com")}}, map[string]stepApprovers{"approve": constrained})
+	require.NoError(t, err)
+	require.Len(t, result["approve"], 1)
+	require.Equal(t, "alice", result["approve"][0].Reference)
+}
@@ -0,0 +1,183 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation/git"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/gobuild"
+)
+
+type recordedCommit struct {
+	reference string
+	hash      string
+	dirty     bool
+}
+
+type recordedBinary struct {
+	reference string
+	binary    gobuild.Binary
+}
+
+// CheckBuildInfo requires the buildinfo embedded in a Go binary to agree with the verified evidence, catching a
+// binary that was swapped for one built from other sources. The binary must be stamped with a commit recorded by a
+// verified git attestation, and when verified gobuild attestations recorded a binary of the same main package, its
+// module versions must match one of them.
+func CheckBuildInfo(info *debug.BuildInfo, verified map[string][]source.VerifiedCollection) error {
+	binary := gobuild.NewBinary(info)
+	commits, binaries := buildEvidence(verified, binary.Package)
+	if len(commits) == 0 {
+		return errors.New("verified evidence has no git attestation to check the binary's revision against")
+	}
+
+	mismatches := []string{}
+	matched := false
+	for _, commit := range commits {
+		found := binary.CheckCommit(commit.hash, commit.dirty)
+		if len(found) == 0 {
+			matched = true
+			break
+		}
+
+		for _, mismatch := range found {
+			mismatches = append(mismatches, fmt.Sprintf("%v: %v", commit.reference, mismatch))
+		}
+	}
+
+	if !matched {
+		return fmt.Errorf("buildinfo doesn't match the verified git attestations: %v", strings.Join(mismatches, "; "))
+	}
+
+	if len(binaries) == 0 {
+		log.Debugf("no verified gobuild attestation recorded %v, so its module versions aren't checked", binary.Package)
+		return nil
+	}
+
+	mismatches = []string{}
+	for _, recorded := range binaries {
+		found := moduleMismatches(binary, recorded.binary)
+		if len(found) == 0 {
+			return nil
+		}
+
+		for _, mismatch := range found {
+			mismatches = append(mismatches, fmt.Sprintf("%v: %v", recorded.reference, mismatch))
+		}
+	}
+
+	return fmt.Errorf("buildinfo doesn't match the verified gobuild attestations: %v", strings.Join(mismatches, "; "))
+}
+
+// buildEvidence returns the commits recorded by the git attestations of verified, and the binaries of pkg recorded
+// by its gobuild attestations.
+func buildEvidence(verified map[string][]source.VerifiedCollection, pkg string) ([]recordedCommit, []recordedBinary) {
+	steps := make([]string, 0, len(verified))
+	for step := range verified {
+		steps = append(steps, step)
+	}
+
+	sort.Strings(steps)
+	commits := []recordedCommit{}
+	binaries := []recordedBinary{}
+	for _, step := range steps {
+		for _, collection := range verified[step] {
+			for _, a := range collection.Collection.Attestations {
+				data, err := json.Marshal(a.Attestation)
+				if err != nil {
+					continue
+				}
+
+				switch a.Type {
+				case git.Type:
+					recorded := struct {
+						CommitHash string                     `json:"commithash"`
+						Status     map[string]json.RawMessage `json:"status"`
+					}{}
+
+					if err := json.Unmarshal(data, &recorded); err == nil && recorded.CommitHash != "" {
+						commits = append(commits, recordedCommit{reference: collection.Reference, hash: recorded.CommitHash, dirty: len(recorded.Status) > 0})
+					}
+				case gobuild.Type:
+					recorded := map[string]gobuild.Binary{}
+					if err := json.Unmarshal(data, &recorded); err != nil {
+						continue
+					}
+
+					for _, b := range recorded {
+						if b.Package == pkg {
+							binaries = append(binaries, recordedBinary{reference: collection.Reference, binary: b})
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return commits, binaries
+}
+
+// moduleMismatches compares the main module and dependency versions of binary against a recorded binary.
+func moduleMismatches(binary, recorded gobuild.Binary) []string {
+	mismatches := []string{}
+	if binary.Main.Path != recorded.Main.Path {
+		mismatches = append(mismatches, fmt.Sprintf("main module is %v in the binary but %v in the evidence", binary.Main.Path, recorded.Main.Path))
+	}
+
+	versions := make(map[string]string, len(recorded.Deps))
+	for _, dep := range recorded.Deps {
+		versions[dep.Path] = moduleVersion(dep)
+	}
+
+	seen := make(map[string]struct{}, len(binary.Deps))
+	for _, dep := range binary.Deps {
+		seen[dep.Path] = struct{}{}
+		version, ok := versions[dep.Path]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("module %v is in the binary but not in the evidence", dep.Path))
+		} else if version != moduleVersion(dep) {
+			mismatches = append(mismatches, fmt.Sprintf("module %v is %v in the binary but %v in the evidence", dep.Path, moduleVersion(dep), version))
+		}
+	}
+
+	for _, dep := range recorded.Deps {
+		if _, ok := seen[dep.Path]; !ok {
+			mismatches = append(mismatches, fmt.Sprintf("module %v is in the evidence but not in the binary", dep.Path))
+		}
+	}
+
+	return mismatches
+}
+
+// moduleVersion is the version of a module the binary was actually built with, which is the replacement's if the
+// module was replaced.
+func moduleVersion(mod gobuild.Module) string {
+	if mod.Replace == nil {
+		return mod.Version
+	}
+
+	if mod.Replace.Version == "" {
+		return mod.Replace.Path
+	}
+
+	return mod.Replace.Path + "@" + mod.Replace.Version
+}
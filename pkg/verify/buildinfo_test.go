@@ -0,0 +1,109 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"encoding/json"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/git"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/gobuild"
+)
+
+const (
+	builtRevision = "1111111111111111111111111111111111111111"
+	otherRevision = "2222222222222222222222222222222222222222"
+)
+
+func buildCollection(ref string, attestations ...attestation.CollectionAttestation) source.VerifiedCollection {
+	return source.VerifiedCollection{
+		CollectionEnvelope: source.CollectionEnvelope{
+			Reference:  ref,
+			Collection: attestation.Collection{Attestations: attestations},
+		},
+	}
+}
+
+func gitAttestation(revision string) attestation.CollectionAttestation {
+	return attestation.CollectionAttestation{
+		Type:        git.Type,
+		Attestation: &git.Attestor{CommitHash: revision},
+	}
+}
+
+func goBuildAttestation(t *testing.T, binary gobuild.Binary) attestation.CollectionAttestation {
+	data, err := json.Marshal(map[string]gobuild.Binary{"app": binary})
+	require.NoError(t, err)
+	attestor := gobuild.New()
+	require.NoError(t, json.Unmarshal(data, attestor))
+	return attestation.CollectionAttestation{
+		Type:        gobuild.Type,
+		Attestation: attestor,
+	}
+}
+
+func TestCheckBuildInfo(t *testing.T) {
+	info := &debug.BuildInfo{
+		Path: "example.com/app/cmd/app",
+		Main: debug.Module{Path: "example.com/app", Version: "(devel)"},
+		Deps: []*debug.Module{{Path: "example.com/dep", Version: "v1.0.0", Sum: "h1:abc="}},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs", Value: "git"},
+			{Key: "vcs.revision", Value: builtRevision},
+			{Key: "vcs.modified", Value: "false"},
+		},
+	}
+
+	recorded := gobuild.NewBinary(info)
+	verified := map[string][]source.VerifiedCollection{
+		"clone": {buildCollection("clone", gitAttestation(otherRevision)), buildCollection("reclone", gitAttestation(builtRevision))},
+		"build": {buildCollection("build", goBuildAttestation(t, recorded))},
+	}
+
+	require.NoError(t, CheckBuildInfo(info, verified))
+
+	// a binary of another package recorded in the evidence isn't compared
+	unrelated := gobuild.NewBinary(&debug.BuildInfo{Path: "example.com/tool", Main: debug.Module{Path: "example.com/tool"}})
+	require.NoError(t, CheckBuildInfo(info, map[string][]source.VerifiedCollection{
+		"build": {buildCollection("build", gitAttestation(builtRevision), goBuildAttestation(t, unrelated))},
+	}))
+
+	err := CheckBuildInfo(info, map[string][]source.VerifiedCollection{"clone": {buildCollection("clone", gitAttestation(otherRevision))}})
+	require.ErrorContains(t, err, "buildinfo doesn't match the verified git attestations: clone: binary was built from revision "+builtRevision+", but the git attestor recorded commit "+otherRevision)
+
+	err = CheckBuildInfo(info, map[string][]source.VerifiedCollection{"build": {buildCollection("build", goBuildAttestation(t, recorded))}})
+	require.ErrorContains(t, err, "verified evidence has no git attestation")
+
+	swapped := recorded
+	swapped.Deps = []gobuild.Module{
+		{Path: "example.com/dep", Version: "v1.0.1", Sum: "h1:def="},
+		{Path: "example.com/extra", Version: "v0.1.0"},
+	}
+
+	err = CheckBuildInfo(info, map[string][]source.VerifiedCollection{
+		"build": {buildCollection("build", gitAttestation(builtRevision), goBuildAttestation(t, swapped))},
+	})
+	require.ErrorContains(t, err, "buildinfo doesn't match the verified gobuild attestations: build: module example.com/dep is v1.0.0 in the binary but v1.0.1 in the evidence; build: module example.com/extra is in the evidence but not in the binary")
+}
+
+func TestModuleVersionFollowsReplacements(t *testing.T) {
+	require.Equal(t, "v1.0.0", moduleVersion(gobuild.Module{Path: "example.com/dep", Version: "v1.0.0"}))
+	require.Equal(t, "../dep", moduleVersion(gobuild.Module{Path: "example.com/dep", Version: "v1.0.0", Replace: &gobuild.Module{Path: "../dep"}}))
+	require.Equal(t, "example.com/fork@v1.0.1", moduleVersion(gobuild.Module{Path: "example.com/dep", Version: "v1.0.0", Replace: &gobuild.Module{Path: "example.com/fork", Version: "v1.0.1"}}))
+}
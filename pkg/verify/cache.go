@@ -0,0 +1,228 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/testifysec/go-witness/dsse"
+)
+
+// CacheKey is everything the outcome of a verification depends on. Changing the policy, the trusted keys or
+// certificates, the subjects, or the evidence produces a different key, so stale results are never returned.
+type CacheKey struct {
+	// Verifier identifies the version of witness doing the verification, since verification rules change between
+	// releases.
+	Verifier              string        `json:"verifier"`
+	PolicyDigest          string        `json:"policydigest"`
+	TrustDigests          []string      `json:"trustdigests"`
+	Subjects              []string      `json:"subjects"`
+	SubjectNames          []string      `json:"subjectnames"`
+	ClockSkew             time.Duration `json:"clockskew"`
+	EvidenceDigests       []string      `json:"evidencedigests"`
+	WitnessReleaseDigests []string      `json:"witnessreleasedigests"`
+	VEXDigests            []string      `json:"vexdigests"`
+	Environment           string        `json:"environment,omitempty"`
+	RevocationDigests     []string      `json:"revocationdigests,omitempty"`
+	GroupDigests          []string      `json:"groupdigests,omitempty"`
+	SubPolicyDigests      []string      `json:"subpolicydigests,omitempty"`
+	StatementVersions     []string      `json:"statementversions,omitempty"`
+	StrictStatements      bool          `json:"strictstatements,omitempty"`
+	CheckBuildInfo        bool          `json:"checkbuildinfo,omitempty"`
+	// PredicateTypes and OpaquePredicates hold the predicate types collections are parsed with, as attestor=uri and
+	// uri=schema digest, since they decide which attestations a collection is accepted with.
+	PredicateTypes   []string `json:"predicatetypes,omitempty"`
+	OpaquePredicates []string `json:"opaquepredicates,omitempty"`
+	// CUEDigest is the digest of the cue command CUE policies are evaluated with.
+	CUEDigest string `json:"cuedigest,omitempty"`
+}
+
+// Digest returns the digest of the key. Lists are treated as sets, so the order evidence was provided in doesn't
+// change the digest.
+func (k CacheKey) Digest() (string, error) {
+	for _, list := range []*[]string{&k.TrustDigests, &k.Subjects, &k.SubjectNames, &k.EvidenceDigests, &k.WitnessReleaseDigests, &k.VEXDigests, &k.RevocationDigests, &k.GroupDigests, &k.SubPolicyDigests, &k.StatementVersions, &k.PredicateTypes, &k.OpaquePredicates} {
+		sorted := append([]string{}, *list...)
+		sort.Strings(sorted)
+		*list = sorted
+	}
+
+	data, err := json.Marshal(k)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// EnvelopeDigest returns the digest of an envelope, including its signatures.
+func EnvelopeDigest(env dsse.Envelope) (string, error) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// CacheEntry records a successful verification.
+type CacheEntry struct {
+	Key        string    `json:"key"`
+	VerifiedAt time.Time `json:"verifiedat"`
+	ExpiresAt  time.Time `json:"expiresat"`
+	Evidence   []string  `json:"evidence"`
+	// MAC authenticates the rest of the entry under the cache's key, so an entry written by anyone without the key
+	// is never taken as a successful verification.
+	MAC string `json:"mac"`
+}
+
+// MinCacheKeySize is the smallest key, in bytes, cache entries are authenticated with.
+const MinCacheKeySize = 32
+
+// Cache stores successful verifications in a directory, one file per key. Only successes are cached so a
+// failure is always verified again. Entries are authenticated with an HMAC under a key kept outside the directory,
+// since anyone able to write an entry could otherwise pass any verification.
+type Cache struct {
+	dir    string
+	ttl    time.Duration
+	macKey []byte
+	now    func() time.Time
+}
+
+type CacheOption func(*Cache)
+
+// WithCacheClock sets the clock used to check and set expiration times.
+func WithCacheClock(now func() time.Time) CacheOption {
+	return func(c *Cache) {
+		c.now = now
+	}
+}
+
+// NewCache returns a cache in dir whose entries are valid for ttl and authenticated with macKey, which must be at
+// least MinCacheKeySize bytes.
+func NewCache(dir string, ttl time.Duration, macKey []byte, opts ...CacheOption) (*Cache, error) {
+	if len(macKey) < MinCacheKeySize {
+		return nil, fmt.Errorf("cache key must be at least %v bytes", MinCacheKeySize)
+	}
+
+	c := &Cache{dir: dir, ttl: ttl, macKey: macKey, now: time.Now}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// Get returns the entry for key if there is one that hasn't expired. Entries that can't be read or whose MAC doesn't
+// match are treated as missing.
+func (c *Cache) Get(key string) (CacheEntry, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return CacheEntry{}, false
+	}
+
+	entry := CacheEntry{}
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Key != key || !c.now().Before(entry.ExpiresAt) {
+		return CacheEntry{}, false
+	}
+
+	mac, err := hex.DecodeString(entry.MAC)
+	if err != nil {
+		return CacheEntry{}, false
+	}
+
+	expected, err := c.mac(entry)
+	if err != nil || !hmac.Equal(mac, expected) {
+		return CacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+// mac returns the HMAC of entry without its MAC.
+func (c *Cache) mac(entry CacheEntry) ([]byte, error) {
+	entry.MAC = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hmac.New(sha256.New, c.macKey)
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// Put records a successful verification for key. The entry expires after the cache's ttl, or when the policy
+// expires if that is sooner.
+func (c *Cache) Put(key string, policyEnvelope dsse.Envelope, evidence []string) error {
+	now := c.now().UTC()
+	entry := CacheEntry{Key: key, VerifiedAt: now, ExpiresAt: now.Add(c.ttl), Evidence: evidence}
+	policy := struct {
+		Expires time.Time `json:"expires"`
+	}{}
+
+	if err := json.Unmarshal(policyEnvelope.Payload, &policy); err != nil {
+		return fmt.Errorf("failed to read policy expiration: %w", err)
+	}
+
+	if policy.Expires.Before(entry.ExpiresAt) {
+		entry.ExpiresAt = policy.Expires.UTC()
+	}
+
+	mac, err := c.mac(entry)
+	if err != nil {
+		return err
+	}
+
+	entry.MAC = hex.EncodeToString(mac)
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(c.dir, ".entry-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
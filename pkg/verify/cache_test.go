@@ -0,0 +1,103 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/dsse"
+)
+
+func TestCacheKeyDigest(t *testing.T) {
+	key := CacheKey{Verifier: "v1", PolicyDigest: "policy", EvidenceDigests: []string{"b", "a"}, Subjects: []string{"s1", "s2"}}
+	digest, err := key.Digest()
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "a"}, key.EvidenceDigests)
+
+	reordered := CacheKey{Verifier: "v1", PolicyDigest: "policy", EvidenceDigests: []string{"a", "b"}, Subjects: []string{"s2", "s1"}}
+	reorderedDigest, err := reordered.Digest()
+	require.NoError(t, err)
+	require.Equal(t, digest, reorderedDigest)
+
+	for _, changed := range []CacheKey{
+		{Verifier: "v1", PolicyDigest: "other", EvidenceDigests: []string{"a", "b"}, Subjects: []string{"s1", "s2"}},
+		{Verifier: "v1", PolicyDigest: "policy", TrustDigests: []string{"root"}, EvidenceDigests: []string{"a", "b"}, Subjects: []string{"s1", "s2"}},
+		{Verifier: "v1", PolicyDigest: "policy", EvidenceDigests: []string{"a"}, Subjects: []string{"s1", "s2"}},
+		{Verifier: "v2", PolicyDigest: "policy", EvidenceDigests: []string{"a", "b"}, Subjects: []string{"s1", "s2"}},
+		{Verifier: "v1", PolicyDigest: "policy", EvidenceDigests: []string{"a", "b"}, Subjects: []string{"s1", "s2"}, StrictStatements: true},
+	} {
+		changedDigest, err := changed.Digest()
+		require.NoError(t, err)
+		require.NotEqual(t, digest, changedDigest)
+	}
+}
+
+func TestCache(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	dir := filepath.Join(t.TempDir(), "cache")
+	key := bytes.Repeat([]byte("k"), MinCacheKeySize)
+	cache, err := NewCache(dir, time.Hour, key, WithCacheClock(func() time.Time { return now }))
+	require.NoError(t, err)
+	policy := dsse.Envelope{Payload: []byte(`{"expires":"2023-01-02T00:00:00Z"}`)}
+
+	_, ok := cache.Get("key")
+	require.False(t, ok)
+	require.NoError(t, cache.Put("key", policy, []string{"build.json"}))
+	entry, ok := cache.Get("key")
+	require.True(t, ok)
+	require.Equal(t, []string{"build.json"}, entry.Evidence)
+	require.Equal(t, now.Add(time.Hour), entry.ExpiresAt)
+
+	now = now.Add(time.Hour)
+	_, ok = cache.Get("key")
+	require.False(t, ok)
+
+	// entries never outlive the policy
+	expiringPolicy := dsse.Envelope{Payload: []byte(`{"expires":"2023-01-01T01:30:00Z"}`)}
+	require.NoError(t, cache.Put("key", expiringPolicy, nil))
+	entry, ok = cache.Get("key")
+	require.True(t, ok)
+	require.Equal(t, time.Date(2023, 1, 1, 1, 30, 0, 0, time.UTC), entry.ExpiresAt)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "corrupt.json"), []byte("{"), 0644))
+	_, ok = cache.Get("corrupt")
+	require.False(t, ok)
+
+	require.NoError(t, os.Rename(filepath.Join(dir, "key.json"), filepath.Join(dir, "moved.json")))
+	_, ok = cache.Get("moved")
+	require.False(t, ok)
+
+	// entries written under another key, or altered after being written, are ignored
+	forger, err := NewCache(dir, time.Hour, bytes.Repeat([]byte("f"), MinCacheKeySize), WithCacheClock(func() time.Time { return now }))
+	require.NoError(t, err)
+	require.NoError(t, forger.Put("forged", policy, nil))
+	_, ok = cache.Get("forged")
+	require.False(t, ok)
+
+	require.NoError(t, cache.Put("altered", policy, []string{"build.json"}))
+	data, err := os.ReadFile(filepath.Join(dir, "altered.json"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "altered.json"), bytes.Replace(data, []byte("build.json"), []byte("other.json"), 1), 0644))
+	_, ok = cache.Get("altered")
+	require.False(t, ok)
+
+	_, err = NewCache(dir, time.Hour, []byte("short"))
+	require.Error(t, err)
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/previousstep"
+)
+
+// verifyChains removes collections that don't reference the signed envelope of an accepted collection for each
+// step they must be chained from. Steps are checked in order, so a chain is only accepted if every link in it is.
+func verifyChains(accepted map[string][]source.VerifiedCollection, chains map[string][]string, order []string) (map[string][]source.VerifiedCollection, error) {
+	result := make(map[string][]source.VerifiedCollection, len(accepted))
+	for step, collections := range accepted {
+		result[step] = collections
+	}
+
+	for _, step := range order {
+		if len(chains[step]) == 0 {
+			continue
+		}
+
+		kept := make([]source.VerifiedCollection, 0, len(result[step]))
+		var lastErr error
+		for _, collection := range result[step] {
+			if err := checkChain(collection, chains[step], result); err != nil {
+				lastErr = fmt.Errorf("%v: %w", collection.Reference, err)
+				continue
+			}
+
+			kept = append(kept, collection)
+		}
+
+		if len(kept) == 0 {
+			return nil, fmt.Errorf("no evidence for step %v has an unbroken chain of custody: %w", step, lastErr)
+		}
+
+		result[step] = kept
+	}
+
+	return result, nil
+}
+
+func checkChain(collection source.VerifiedCollection, chainedFrom []string, accepted map[string][]source.VerifiedCollection) error {
+	referenced := make(map[string]struct{})
+	for _, collectionAttestation := range collection.Collection.Attestations {
+		a, ok := collectionAttestation.Attestation.(*previousstep.Attestor)
+		if !ok {
+			continue
+		}
+
+		for _, previous := range a.PreviousSteps() {
+			if digest, ok := previous.PayloadDigest[cryptoutil.DigestValue{Hash: crypto.SHA256}]; ok {
+				referenced[digest] = struct{}{}
+			}
+		}
+	}
+
+	for _, step := range chainedFrom {
+		linked := false
+		for _, previous := range accepted[step] {
+			digest := sha256.Sum256(previous.Envelope.Payload)
+			if _, ok := referenced[hex.EncodeToString(digest[:])]; ok {
+				linked = true
+				break
+			}
+		}
+
+		if !linked {
+			return fmt.Errorf("does not reference the envelope of an accepted collection for step %v", step)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/policy"
+)
+
+// compromisedKeys returns when each compromised key of the policy was compromised, keyed by key id. Every key must be
+// a public key of the policy.
+func (pe policyExtensions) compromisedKeys(pubKeysByID map[string]cryptoutil.Verifier) (map[string]time.Time, error) {
+	for keyID := range pe.CompromisedKeys {
+		if _, ok := pubKeysByID[keyID]; !ok {
+			return nil, fmt.Errorf("compromised key %v is not a public key in the policy", keyID)
+		}
+	}
+
+	return pe.CompromisedKeys, nil
+}
+
+// beforeCompromise returns whether a signature verified by verifier was made before its key was compromised. Only
+// trusted timestamps can show that, so signatures of compromised keys without one are rejected.
+func (ev envelopeVerifier) beforeCompromise(ctx context.Context, verifier cryptoutil.Verifier, sig dsse.Signature) bool {
+	keyID, err := verifier.KeyID()
+	if err != nil {
+		return false
+	}
+
+	compromisedAt, ok := ev.compromised[keyID]
+	if !ok {
+		return true
+	}
+
+	for _, timestampVerifier := range ev.timestampVerifiers {
+		for _, sigTimestamp := range sig.Timestamps {
+			trustedTime, err := timestampVerifier.Verify(ctx, bytes.NewReader(sigTimestamp.Data), bytes.NewReader(sig.Signature))
+			if err == nil && trustedTime.Before(compromisedAt) {
+				return true
+			}
+		}
+	}
+
+	log.Debugf("(verify) signature of key %v has no trusted timestamp before the key was compromised at %v", keyID, compromisedAt)
+	return false
+}
+
+// RevokeKey marks the public key keyID of a policy as compromised at compromisedAt. Signatures the key made after
+// then, or that have no trusted timestamp from before then, are no longer accepted, while earlier evidence still
+// verifies. The policy is returned unsigned, to be signed again with witness sign.
+func RevokeKey(policyJSON []byte, keyID string, compromisedAt time.Time) ([]byte, error) {
+	pol := policy.Policy{}
+	if err := json.Unmarshal(policyJSON, &pol); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal policy: %w", err)
+	}
+
+	if _, ok := pol.PublicKeys[keyID]; !ok {
+		return nil, fmt.Errorf("key %v is not a public key in the policy", keyID)
+	}
+
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(policyJSON, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal policy: %w", err)
+	}
+
+	compromised, ok := fields["compromisedKeys"].(map[string]interface{})
+	if !ok {
+		compromised = make(map[string]interface{})
+	}
+
+	compromised[keyID] = compromisedAt.UTC().Format(time.RFC3339)
+	fields["compromisedKeys"] = compromised
+	return json.MarshalIndent(fields, "", "  ")
+}
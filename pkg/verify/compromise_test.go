@@ -0,0 +1,113 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/policy"
+)
+
+// fixedTimestamper timestamps signatures at a fixed time, which fixedTimestamper's Verify trusts.
+type fixedTimestamper time.Time
+
+func (f fixedTimestamper) Timestamp(context.Context, io.Reader) ([]byte, error) {
+	return time.Time(f).MarshalText()
+}
+
+func (f fixedTimestamper) Verify(ctx context.Context, ts io.Reader, sig io.Reader) (time.Time, error) {
+	data, err := io.ReadAll(ts)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	trusted := time.Time{}
+	return trusted, trusted.UnmarshalText(data)
+}
+
+func TestCompromisedKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := cryptoutil.NewECDSASigner(key, crypto.SHA256)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	keyID, err := verifier.KeyID()
+	require.NoError(t, err)
+
+	compromisedAt := time.Now().Add(-time.Hour)
+	ev := envelopeVerifier{
+		verifiers:          []cryptoutil.Verifier{verifier},
+		timestampVerifiers: []dsse.TimestampVerifier{fixedTimestamper{}},
+		compromised:        map[string]time.Time{keyID: compromisedAt},
+	}
+
+	sign := func(opts ...dsse.SignOption) dsse.Envelope {
+		env, err := dsse.Sign("text", bytes.NewReader([]byte("test")), append(opts, dsse.SignWithSigners(signer))...)
+		require.NoError(t, err)
+		return env
+	}
+
+	// signatures timestamped before the compromise still verify
+	_, err = ev.verify(context.Background(), sign(dsse.SignWithTimestampers(fixedTimestamper(compromisedAt.Add(-time.Minute)))))
+	require.NoError(t, err)
+
+	_, err = ev.verify(context.Background(), sign(dsse.SignWithTimestampers(fixedTimestamper(compromisedAt.Add(time.Minute)))))
+	require.Error(t, err)
+
+	_, err = ev.verify(context.Background(), sign())
+	require.Error(t, err)
+
+	ev.compromised = nil
+	_, err = ev.verify(context.Background(), sign())
+	require.NoError(t, err)
+
+	extensions := policyExtensions{CompromisedKeys: map[string]time.Time{"unknown": compromisedAt}}
+	_, err = extensions.compromisedKeys(map[string]cryptoutil.Verifier{keyID: verifier})
+	require.Error(t, err)
+}
+
+func TestRevokeKey(t *testing.T) {
+	policyJSON, err := json.Marshal(policy.Policy{
+		Expires:    time.Now().Add(time.Hour),
+		PublicKeys: map[string]policy.PublicKey{"key": {KeyID: "key", Key: []byte("pem")}},
+	})
+	require.NoError(t, err)
+
+	compromisedAt := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	_, err = RevokeKey(policyJSON, "other", compromisedAt)
+	require.Error(t, err)
+
+	revoked, err := RevokeKey(policyJSON, "key", compromisedAt)
+	require.NoError(t, err)
+	extensions := policyExtensions{}
+	require.NoError(t, json.Unmarshal(revoked, &extensions))
+	require.True(t, compromisedAt.Equal(extensions.CompromisedKeys["key"]))
+
+	pol := policy.Policy{}
+	require.NoError(t, json.Unmarshal(revoked, &pol))
+	require.Contains(t, pol.PublicKeys, "key")
+}
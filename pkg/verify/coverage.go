@@ -0,0 +1,307 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/go-witness/source"
+)
+
+// coverageSearchDepth is how many times evidence is searched for again with the back references of the evidence
+// found, as the policy library does when it verifies.
+const coverageSearchDepth = 3
+
+// CoverageReport describes which steps of a policy have evidence for a set of subjects.
+type CoverageReport struct {
+	Steps []StepCoverage `json:"steps"`
+}
+
+// StepCoverage is the evidence found for a step of a policy.
+type StepCoverage struct {
+	Step string `json:"step"`
+	// Evidence are the references of collections signed by a functionary of the step that have every attestation
+	// the step requires and pass its rego policies.
+	Evidence []string `json:"evidence,omitempty"`
+	// Untrusted are the references of collections of the step that no functionary of the step signed.
+	Untrusted []string `json:"untrusted,omitempty"`
+	// Missing are the attestation types the step requires that no collection signed by a functionary has.
+	Missing []string     `json:"missing,omitempty"`
+	Denials []RegoDenial `json:"denials,omitempty"`
+}
+
+// Covered reports whether the step has evidence that satisfies it.
+func (sc StepCoverage) Covered() bool {
+	return len(sc.Evidence) > 0
+}
+
+// Complete reports whether every step of the policy has evidence that satisfies it.
+func (r CoverageReport) Complete() bool {
+	for _, step := range r.Steps {
+		if !step.Covered() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Covered returns the number of steps with evidence that satisfies them.
+func (r CoverageReport) Covered() int {
+	covered := 0
+	for _, step := range r.Steps {
+		if step.Covered() {
+			covered++
+		}
+	}
+
+	return covered
+}
+
+// FormatCoverage describes the report for people, a line per step followed by what the step is missing.
+func FormatCoverage(r CoverageReport) string {
+	sb := &strings.Builder{}
+	for _, step := range r.Steps {
+		if step.Covered() {
+			fmt.Fprintf(sb, "[covered] %v: %v\n", step.Step, strings.Join(step.Evidence, ", "))
+			continue
+		}
+
+		fmt.Fprintf(sb, "[missing] %v\n", step.Step)
+		if len(step.Missing) == 0 && len(step.Denials) == 0 && len(step.Untrusted) == 0 {
+			fmt.Fprintf(sb, "          no evidence found\n")
+		}
+
+		for _, attestationType := range step.Missing {
+			fmt.Fprintf(sb, "          no attestation of type %v\n", attestationType)
+		}
+
+		for _, denial := range step.Denials {
+			fmt.Fprintf(sb, "          %v\n", denial)
+		}
+
+		for _, reference := range step.Untrusted {
+			fmt.Fprintf(sb, "          %v is not signed by a functionary of the step\n", reference)
+		}
+	}
+
+	fmt.Fprintf(sb, "\n%v of %v steps have evidence\n", r.Covered(), len(r.Steps))
+	return sb.String()
+}
+
+// Coverage reports which steps of a policy have evidence for the subjects and what each step is still missing,
+// without failing when the evidence doesn't satisfy the policy. Each step is judged on its own: the order of steps,
+// the artifacts they share, and the checks of the policy's extensions aren't evaluated, so a complete report doesn't
+// mean Verify will accept the evidence.
+func Coverage(ctx context.Context, policyEnvelope dsse.Envelope, policyVerifiers []cryptoutil.Verifier, opts ...Option) (CoverageReport, error) {
+	vo := verifyOptions{
+		policyEnvelope:  policyEnvelope,
+		policyVerifiers: policyVerifiers,
+	}
+
+	for _, opt := range opts {
+		opt(&vo)
+	}
+
+	if vo.clockSkew < 0 {
+		return CoverageReport{}, fmt.Errorf("clock skew must not be negative")
+	}
+
+	pol, extensions, pubKeysById, err := vo.loadPolicy()
+	if err != nil {
+		return CoverageReport{}, err
+	}
+
+	compromised, err := extensions.compromisedKeys(pubKeysById)
+	if err != nil {
+		return CoverageReport{}, fmt.Errorf("invalid policy: %w", err)
+	}
+
+	revoked, err := extensions.revocations(vo.revocations, vo.policyVerifiers, pubKeysById)
+	if err != nil {
+		return CoverageReport{}, fmt.Errorf("failed to verify policy: %w", err)
+	}
+
+	revoked.stored = vo.storedEnvelopes
+	collectionSource := vo.collectionSource
+	if !revoked.empty() {
+		collectionSource = revokedSource{source: collectionSource, revoked: revoked}
+	}
+
+	if collectionSource, err = vo.statementFilter(collectionSource); err != nil {
+		return CoverageReport{}, err
+	}
+
+	ev, err := vo.envelopeVerifier(pol, compromised)
+	if err != nil {
+		return CoverageReport{}, err
+	}
+
+	trustBundles, err := pol.TrustBundles()
+	if err != nil {
+		return CoverageReport{}, fmt.Errorf("failed to load policy trust bundles: %w", err)
+	}
+
+	stepNames := make([]string, 0, len(pol.Steps))
+	for name := range pol.Steps {
+		stepNames = append(stepNames, name)
+	}
+
+	sort.Strings(stepNames)
+	digests := map[string]bool{}
+	subjectDigests := []string{}
+	for _, digest := range vo.subjectDigests {
+		if !digests[digest] {
+			digests[digest] = true
+			subjectDigests = append(subjectDigests, digest)
+		}
+	}
+
+	report := CoverageReport{}
+	for depth := 0; depth < coverageSearchDepth; depth++ {
+		report = CoverageReport{Steps: make([]StepCoverage, 0, len(stepNames))}
+		backRefs := []string{}
+		for _, stepName := range stepNames {
+			coverage, passed, err := stepCoverage(ctx, stepName, pol.Steps[stepName], collectionSource, ev, trustBundles, subjectDigests)
+			if err != nil {
+				return CoverageReport{}, err
+			}
+
+			report.Steps = append(report.Steps, coverage)
+			for _, collection := range passed {
+				for _, digestSet := range collection.Collection.BackRefs() {
+					for _, digest := range digestSet {
+						if !digests[digest] {
+							digests[digest] = true
+							backRefs = append(backRefs, digest)
+						}
+					}
+				}
+			}
+		}
+
+		if len(backRefs) == 0 {
+			break
+		}
+
+		subjectDigests = append(subjectDigests, backRefs...)
+	}
+
+	return report, nil
+}
+
+// stepCoverage searches for every collection of the step regardless of its attestations, so collections that are
+// missing some of them are reported rather than left out by the search.
+func stepCoverage(ctx context.Context, stepName string, step policy.Step, collectionSource source.Sourcer, ev envelopeVerifier, trustBundles map[string]policy.TrustBundle, subjectDigests []string) (StepCoverage, []source.VerifiedCollection, error) {
+	coverage := StepCoverage{Step: stepName}
+	found, err := collectionSource.Search(ctx, stepName, subjectDigests, nil)
+	if err != nil {
+		return StepCoverage{}, nil, fmt.Errorf("failed to search for evidence of step %v: %w", stepName, err)
+	}
+
+	missing := map[string]bool{}
+	for _, expected := range step.Attestations {
+		missing[expected.Type] = true
+	}
+
+	passed := []source.VerifiedCollection{}
+	for _, envelope := range found {
+		verifiers, err := ev.verify(ctx, envelope.Envelope)
+		collection := source.VerifiedCollection{Verifiers: verifiers, CollectionEnvelope: envelope}
+		if err != nil || !signedByFunctionary(step, collection, trustBundles) {
+			coverage.Untrusted = append(coverage.Untrusted, envelope.Reference)
+			continue
+		}
+
+		attestors := map[string]interface{}{}
+		for _, found := range envelope.Collection.Attestations {
+			attestors[found.Type] = found.Attestation
+		}
+
+		complete, denied := true, false
+		for _, expected := range step.Attestations {
+			attestor, ok := attestors[expected.Type]
+			if !ok {
+				complete = false
+				continue
+			}
+
+			delete(missing, expected.Type)
+			for _, module := range expected.RegoPolicies {
+				for _, denial := range evaluateModule(module, attestor) {
+					denial.Step = stepName
+					denial.Attestation = expected.Type
+					denial.Reference = envelope.Reference
+					coverage.Denials = append(coverage.Denials, denial)
+					denied = true
+				}
+			}
+		}
+
+		if complete && !denied {
+			coverage.Evidence = append(coverage.Evidence, envelope.Reference)
+			passed = append(passed, collection)
+		}
+	}
+
+	if !coverage.Covered() {
+		for _, expected := range step.Attestations {
+			if missing[expected.Type] {
+				coverage.Missing = append(coverage.Missing, expected.Type)
+			}
+		}
+	}
+
+	return coverage, passed, nil
+}
+
+// signedByFunctionary reports whether a functionary of the step signed the collection. It mirrors the check the
+// policy library makes before it accepts a collection as evidence of a step.
+func signedByFunctionary(step policy.Step, collection source.VerifiedCollection, trustBundles map[string]policy.TrustBundle) bool {
+	if collection.Statement.PredicateType != attestation.CollectionType {
+		return false
+	}
+
+	for _, verifier := range collection.Verifiers {
+		verifierID, err := verifier.KeyID()
+		if err != nil {
+			continue
+		}
+
+		for _, functionary := range step.Functionaries {
+			if functionary.PublicKeyID != "" && functionary.PublicKeyID == verifierID {
+				return true
+			}
+
+			x509Verifier, ok := verifier.(*cryptoutil.X509Verifier)
+			if !ok || len(functionary.CertConstraint.Roots) == 0 {
+				continue
+			}
+
+			if err := functionary.CertConstraint.Check(x509Verifier, trustBundles); err == nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
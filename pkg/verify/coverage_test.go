@@ -0,0 +1,66 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/go-witness/source"
+)
+
+func TestSignedByFunctionary(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	verifier := cryptoutil.NewRSAVerifier(&priv.PublicKey, crypto.SHA256)
+	keyID, err := verifier.KeyID()
+	require.NoError(t, err)
+
+	step := policy.Step{Name: "build", Functionaries: []policy.Functionary{{Type: "publickey", PublicKeyID: keyID}}}
+	collection := source.VerifiedCollection{
+		Verifiers:          []cryptoutil.Verifier{verifier},
+		CollectionEnvelope: source.CollectionEnvelope{Statement: intoto.Statement{PredicateType: attestation.CollectionType}},
+	}
+
+	require.True(t, signedByFunctionary(step, collection, nil))
+	require.False(t, signedByFunctionary(policy.Step{Name: "build"}, collection, nil))
+	collection.Statement.PredicateType = "https://slsa.dev/provenance/v0.2"
+	require.False(t, signedByFunctionary(step, collection, nil))
+}
+
+func TestFormatCoverage(t *testing.T) {
+	report := CoverageReport{Steps: []StepCoverage{
+		{Step: "build", Evidence: []string{"build.json"}},
+		{Step: "scan", Missing: []string{"https://witness.dev/attestations/sarif/v0.1"}, Untrusted: []string{"scan.json"}},
+		{Step: "test"},
+	}}
+
+	require.False(t, report.Complete())
+	require.Equal(t, 1, report.Covered())
+	require.Equal(t, "[covered] build: build.json\n"+
+		"[missing] scan\n"+
+		"          no attestation of type https://witness.dev/attestations/sarif/v0.1\n"+
+		"          scan.json is not signed by a functionary of the step\n"+
+		"[missing] test\n"+
+		"          no evidence found\n"+
+		"\n1 of 3 steps have evidence\n", FormatCoverage(report))
+}
@@ -0,0 +1,184 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/testifysec/go-witness/source"
+)
+
+const defaultCUETool = "cue"
+
+// attestationExtensions are the fields witness reads from the attestations of a policy step.
+type attestationExtensions struct {
+	Type string `json:"type"`
+	// CUEPolicies are CUE schemas the attestation must satisfy, as an alternative to rego policies.
+	CUEPolicies []cuePolicy `json:"cuepolicies,omitempty"`
+}
+
+// cuePolicy is a CUE schema that is unified with the JSON of an attestation. Like a rego policy's module, the module
+// is base64 encoded in the policy.
+type cuePolicy struct {
+	Name   string `json:"name"`
+	Module []byte `json:"module"`
+}
+
+// cuePolicies returns the CUE policies of each step keyed by step name, then by attestation type.
+func (pe policyExtensions) cuePolicies() map[string]map[string][]cuePolicy {
+	policies := make(map[string]map[string][]cuePolicy)
+	for key, step := range pe.Steps {
+		for _, attestation := range step.Attestations {
+			if len(attestation.CUEPolicies) == 0 {
+				continue
+			}
+
+			name := stepName(key, step)
+			if policies[name] == nil {
+				policies[name] = make(map[string][]cuePolicy)
+			}
+
+			policies[name][attestation.Type] = append(policies[name][attestation.Type], attestation.CUEPolicies...)
+		}
+	}
+
+	return policies
+}
+
+// verifyCUEPolicies removes collections with attestations that don't satisfy the CUE policies of their step. The
+// policies are evaluated with cue vet, so the cue command must be installed where verification runs.
+func verifyCUEPolicies(ctx context.Context, accepted map[string][]source.VerifiedCollection, policies map[string]map[string][]cuePolicy, tool string) (map[string][]source.VerifiedCollection, error) {
+	result := make(map[string][]source.VerifiedCollection, len(accepted))
+	for step, collections := range accepted {
+		result[step] = collections
+	}
+
+	if len(policies) == 0 {
+		return result, nil
+	}
+
+	if tool == "" {
+		tool = defaultCUETool
+	}
+
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return nil, fmt.Errorf("the policy has cue policies, which require the cue command: %w", err)
+	}
+
+	// cue runs in a temporary directory, so a path relative to the working directory is made absolute first
+	if tool, err = filepath.Abs(path); err != nil {
+		return nil, err
+	}
+
+	for step, byType := range policies {
+		kept := make([]source.VerifiedCollection, 0, len(result[step]))
+		var lastErr error
+		for _, collection := range result[step] {
+			if err := checkCUEPolicies(ctx, tool, collection, byType); err != nil {
+				lastErr = fmt.Errorf("%v: %w", collection.Reference, err)
+				continue
+			}
+
+			kept = append(kept, collection)
+		}
+
+		if len(kept) == 0 {
+			if lastErr == nil {
+				lastErr = errors.New("no evidence")
+			}
+
+			return nil, fmt.Errorf("no evidence for step %v satisfies its cue policies: %w", step, lastErr)
+		}
+
+		result[step] = kept
+	}
+
+	return result, nil
+}
+
+func checkCUEPolicies(ctx context.Context, tool string, collection source.VerifiedCollection, byType map[string][]cuePolicy) error {
+	for attestationType, policies := range byType {
+		found := false
+		for _, attestation := range collection.Collection.Attestations {
+			if attestation.Type != attestationType {
+				continue
+			}
+
+			found = true
+			data, err := json.Marshal(attestation.Attestation)
+			if err != nil {
+				return err
+			}
+
+			for _, policy := range policies {
+				if err := vetCUE(ctx, tool, policy, data); err != nil {
+					return fmt.Errorf("cue policy %v denied %v: %w", policy.Name, attestationType, err)
+				}
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("missing %v attestation", attestationType)
+		}
+	}
+
+	return nil
+}
+
+// vetCUE unifies the policy's schema with the attestation and requires the result to be concrete, so fields the
+// schema declares but the attestation doesn't have fail the policy as well as conflicting values.
+func vetCUE(ctx context.Context, tool string, policy cuePolicy, attestation []byte) error {
+	dir, err := os.MkdirTemp("", "witness-cue")
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "policy.cue"), policy.Module, 0600); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "attestation.json"), attestation, 0600); err != nil {
+		return err
+	}
+
+	output := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, tool, "vet", "-c", "policy.cue", "attestation.json")
+	cmd.Dir = dir
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		// cue reports errors against the files it was given, which are named after the policy instead
+		message := strings.TrimSpace(output.String())
+		message = strings.ReplaceAll(message, "./policy.cue", policy.Name)
+		message = strings.ReplaceAll(message, "policy.cue", policy.Name)
+		if message == "" {
+			return err
+		}
+
+		return errors.New(message)
+	}
+
+	return nil
+}
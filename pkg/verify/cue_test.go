@@ -0,0 +1,93 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/source"
+)
+
+// fakeCUE stands in for cue vet, accepting attestations whose exit code is the one the schema pins.
+const fakeCUE = `#!/bin/sh
+[ "$1" = "vet" ] && [ "$2" = "-c" ] || exit 2
+want=$(sed -n 's/^exitcode: *//p' "$3")
+if grep -q "\"exitcode\":$want[,}]" "$4"; then
+	exit 0
+fi
+echo "exitcode: conflicting values $want and other:" >&2
+echo "    ./$3:1:11" >&2
+exit 1
+`
+
+func commandRunCollection(ref string, exitCode int) source.VerifiedCollection {
+	return source.VerifiedCollection{
+		CollectionEnvelope: source.CollectionEnvelope{
+			Reference: ref,
+			Collection: attestation.Collection{Attestations: []attestation.CollectionAttestation{{
+				Type:        commandrun.Type,
+				Attestation: &commandrun.CommandRun{Cmd: []string{"make"}, ExitCode: exitCode},
+			}}},
+		},
+	}
+}
+
+func TestVerifyCUEPolicies(t *testing.T) {
+	tool := filepath.Join(t.TempDir(), "cue")
+	require.NoError(t, os.WriteFile(tool, []byte(fakeCUE), 0755))
+
+	policyJSON := []byte(`{"steps": {"build": {"name": "build", "attestations": [
+		{"type": "` + commandrun.Type + `", "cuepolicies": [{"name": "exitcode.cue", "module": "ZXhpdGNvZGU6IDAK"}]},
+		{"type": "https://witness.dev/attestations/material/v0.1"}
+	]}}}`)
+
+	extensions := policyExtensions{}
+	require.NoError(t, json.Unmarshal(policyJSON, &extensions))
+	policies := extensions.cuePolicies()
+	require.Equal(t, map[string]map[string][]cuePolicy{"build": {commandrun.Type: {{Name: "exitcode.cue", Module: []byte("exitcode: 0\n")}}}}, policies)
+
+	passed := commandRunCollection("passed", 0)
+	failed := commandRunCollection("failed", 1)
+	accepted := map[string][]source.VerifiedCollection{"build": {failed, passed}, "test": nil}
+	result, err := verifyCUEPolicies(context.Background(), accepted, policies, tool)
+	require.NoError(t, err)
+	require.Equal(t, []source.VerifiedCollection{passed}, result["build"])
+
+	_, err = verifyCUEPolicies(context.Background(), map[string][]source.VerifiedCollection{"build": {failed}}, policies, tool)
+	require.ErrorContains(t, err, "no evidence for step build satisfies its cue policies: failed: cue policy exitcode.cue denied "+commandrun.Type+": exitcode: conflicting values 0 and other:\n    exitcode.cue:1:11")
+
+	// a relative path is found from the working directory rather than the directory cue runs in
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(filepath.Dir(tool)))
+	t.Cleanup(func() { require.NoError(t, os.Chdir(wd)) })
+	_, err = verifyCUEPolicies(context.Background(), accepted, policies, "."+string(filepath.Separator)+"cue")
+	require.NoError(t, err)
+
+	_, err = verifyCUEPolicies(context.Background(), accepted, policies, filepath.Join(t.TempDir(), "missing-cue"))
+	require.ErrorContains(t, err, "require the cue command")
+
+	// without cue policies the cue command isn't needed
+	result, err = verifyCUEPolicies(context.Background(), accepted, nil, filepath.Join(t.TempDir(), "missing-cue"))
+	require.NoError(t, err)
+	require.Equal(t, accepted, result)
+}
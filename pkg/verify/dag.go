@@ -0,0 +1,227 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/source"
+)
+
+// policyExtensions holds the fields witness reads from a policy in addition to the ones understood by go-witness.
+// The policy payload is parsed into both so older verifiers ignore the extensions rather than failing.
+type policyExtensions struct {
+	Steps             map[string]stepExtensions `json:"steps"`
+	Witness           *witnessRequirements      `json:"witness,omitempty"`
+	Environments      []string                  `json:"environments,omitempty"`
+	RevocationSigners []string                  `json:"revocationSigners,omitempty"`
+	CompromisedKeys   map[string]time.Time      `json:"compromisedKeys,omitempty"`
+	Groups            *groupRequirements        `json:"groups,omitempty"`
+}
+
+type stepExtensions struct {
+	Name             string                    `json:"name"`
+	DependsOn        []string                  `json:"dependsOn,omitempty"`
+	ChainedFrom      []string                  `json:"chainedFrom,omitempty"`
+	SBOM             *sbomConstraints          `json:"sbom,omitempty"`
+	Vulnerabilities  *vulnerabilityConstraints `json:"vulnerabilities,omitempty"`
+	RequiredProducts []string                  `json:"requiredProducts,omitempty"`
+	Environments     []string                  `json:"environments,omitempty"`
+	Approvers        []string                  `json:"approvers,omitempty"`
+	ApproverGroups   []string                  `json:"approverGroups,omitempty"`
+	Attestations     []attestationExtensions   `json:"attestations,omitempty"`
+	Delegate         *delegation               `json:"delegate,omitempty"`
+}
+
+// chains returns the steps each step must be cryptographically chained from, keyed by step name.
+func (pe policyExtensions) chains() map[string][]string {
+	return pe.edges(func(step stepExtensions) []string { return step.ChainedFrom })
+}
+
+// ordering returns every step that must come before each step, whether it is a dependency or part of a chain.
+func (pe policyExtensions) ordering() map[string][]string {
+	return pe.edges(func(step stepExtensions) []string {
+		return append(append([]string{}, step.DependsOn...), step.ChainedFrom...)
+	})
+}
+
+func (pe policyExtensions) edges(edgesOf func(stepExtensions) []string) map[string][]string {
+	edges := make(map[string][]string, len(pe.Steps))
+	for key, step := range pe.Steps {
+		edges[stepName(key, step)] = edgesOf(step)
+	}
+
+	return edges
+}
+
+// stepName returns the name collections of a step are recorded under, which defaults to its key in the policy.
+func stepName(key string, step stepExtensions) string {
+	if step.Name == "" {
+		return key
+	}
+
+	return step.Name
+}
+
+// stepOrder validates that the declared dependencies form a directed acyclic graph and returns the steps in an order
+// where every step comes after the steps it depends on.
+func stepOrder(deps map[string][]string) ([]string, error) {
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int, len(deps))
+	order := make([]string, 0, len(deps))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("step dependencies contain a cycle: %v", append(path, name))
+		}
+
+		state[name] = visiting
+		for _, dep := range deps[name] {
+			if _, ok := deps[dep]; !ok {
+				return fmt.Errorf("step %v depends on %v, which is not a step in the policy", name, dep)
+			}
+
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// verifyStepOrder removes collections that are inconsistent with the steps they depend on or are chained from, which
+// deps holds for each step. A collection is kept if, for each dependency, some accepted collection of the dependency
+// finished before it started and none of the dependency's artifacts conflict with the collection's materials. Steps
+// are checked in dependency order so collections removed from a step can't satisfy the steps that depend on it.
+func verifyStepOrder(accepted map[string][]source.VerifiedCollection, deps map[string][]string, order []string, skew time.Duration) (map[string][]source.VerifiedCollection, error) {
+	result := make(map[string][]source.VerifiedCollection, len(accepted))
+	for step, collections := range accepted {
+		result[step] = collections
+	}
+
+	for _, step := range order {
+		if len(deps[step]) == 0 {
+			continue
+		}
+
+		kept := make([]source.VerifiedCollection, 0, len(result[step]))
+		var lastErr error
+		for _, collection := range result[step] {
+			if err := checkDependencies(collection, deps[step], result, skew); err != nil {
+				lastErr = fmt.Errorf("%v: %w", collection.Reference, err)
+				continue
+			}
+
+			kept = append(kept, collection)
+		}
+
+		if len(kept) == 0 {
+			return nil, fmt.Errorf("no evidence for step %v is consistent with the steps it depends on: %w", step, lastErr)
+		}
+
+		result[step] = kept
+	}
+
+	return result, nil
+}
+
+func checkDependencies(collection source.VerifiedCollection, deps []string, accepted map[string][]source.VerifiedCollection, skew time.Duration) error {
+	start, _ := collectionTimes(collection)
+	materials := collection.Collection.Materials()
+	for _, dep := range deps {
+		depErr := fmt.Errorf("no evidence for dependency %v", dep)
+		satisfied := false
+		for _, depCollection := range accepted[dep] {
+			_, depEnd := collectionTimes(depCollection)
+			if !start.IsZero() && !depEnd.IsZero() && start.Add(skew).Before(depEnd) {
+				depErr = fmt.Errorf("started at %v, before dependency %v finished at %v", start, dep, depEnd)
+				continue
+			}
+
+			if err := compareArtifacts(materials, depCollection.Collection.Artifacts()); err != nil {
+				depErr = fmt.Errorf("conflicts with artifacts of dependency %v: %w", dep, err)
+				continue
+			}
+
+			satisfied = true
+			break
+		}
+
+		if !satisfied {
+			return depErr
+		}
+	}
+
+	return nil
+}
+
+// compareArtifacts checks that any material that is also an artifact of another collection has the same digest.
+func compareArtifacts(materials, artifacts map[string]cryptoutil.DigestSet) error {
+	for path, material := range materials {
+		artifact, ok := artifacts[path]
+		if !ok {
+			continue
+		}
+
+		if !material.Equal(artifact) {
+			return fmt.Errorf("material %v does not match the artifact", path)
+		}
+	}
+
+	return nil
+}
+
+// collectionTimes returns when the first attestor in a collection started and when the last one finished.
+func collectionTimes(collection source.VerifiedCollection) (start, end time.Time) {
+	for _, attestation := range collection.Collection.Attestations {
+		if !attestation.StartTime.IsZero() && (start.IsZero() || attestation.StartTime.Before(start)) {
+			start = attestation.StartTime
+		}
+
+		if attestation.EndTime.After(end) {
+			end = attestation.EndTime
+		}
+	}
+
+	return start, end
+}
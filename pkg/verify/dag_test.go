@@ -0,0 +1,84 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/material"
+	"github.com/testifysec/go-witness/attestation/product"
+	"github.com/testifysec/go-witness/source"
+)
+
+func TestStepOrder(t *testing.T) {
+	ext := policyExtensions{}
+	require.NoError(t, json.Unmarshal([]byte(`{"steps":{"package":{"name":"package","dependsOn":["test"]},"test":{"name":"test","chainedFrom":["build"]},"build":{"name":"build"}}}`), &ext))
+	require.Equal(t, map[string][]string{"package": {"test"}, "test": {"build"}, "build": {}}, ext.ordering())
+	order, err := stepOrder(ext.ordering())
+	require.NoError(t, err)
+	require.Equal(t, []string{"build", "test", "package"}, order)
+
+	_, err = stepOrder(map[string][]string{"build": {"test"}, "test": {"build"}})
+	require.ErrorContains(t, err, "cycle")
+
+	_, err = stepOrder(map[string][]string{"build": {"clone"}})
+	require.ErrorContains(t, err, "not a step in the policy")
+}
+
+func testCollection(t *testing.T, ref string, start, end time.Time, materials, products string) source.VerifiedCollection {
+	mat := material.New()
+	require.NoError(t, json.Unmarshal([]byte(materials), mat))
+	prod := product.New()
+	require.NoError(t, json.Unmarshal([]byte(products), prod))
+	return source.VerifiedCollection{
+		CollectionEnvelope: source.CollectionEnvelope{
+			Reference: ref,
+			Collection: attestation.Collection{
+				Attestations: []attestation.CollectionAttestation{
+					{Type: material.Type, Attestation: mat, StartTime: start, EndTime: start},
+					{Type: product.Type, Attestation: prod, StartTime: start, EndTime: end},
+				},
+			},
+		},
+	}
+}
+
+func TestVerifyStepOrder(t *testing.T) {
+	now := time.Now()
+	deps := map[string][]string{"build": nil, "package": {"build"}}
+	order := []string{"build", "package"}
+	build := testCollection(t, "build", now, now.Add(time.Minute), `{}`, `{"app":{"mime_type":"application/octet-stream","digest":{"sha256":"aaaa"}}}`)
+
+	good := testCollection(t, "good", now.Add(2*time.Minute), now.Add(3*time.Minute), `{"app":{"sha256":"aaaa"}}`, `{}`)
+	result, err := verifyStepOrder(map[string][]source.VerifiedCollection{"build": {build}, "package": {good}}, deps, order, 0)
+	require.NoError(t, err)
+	require.Len(t, result["package"], 1)
+
+	early := testCollection(t, "early", now.Add(30*time.Second), now.Add(3*time.Minute), `{"app":{"sha256":"aaaa"}}`, `{}`)
+	_, err = verifyStepOrder(map[string][]source.VerifiedCollection{"build": {build}, "package": {early}}, deps, order, 0)
+	require.ErrorContains(t, err, "before dependency build finished")
+
+	_, err = verifyStepOrder(map[string][]source.VerifiedCollection{"build": {build}, "package": {early}}, deps, order, time.Minute)
+	require.NoError(t, err)
+
+	tampered := testCollection(t, "tampered", now.Add(2*time.Minute), now.Add(3*time.Minute), `{"app":{"sha256":"bbbb"}}`, `{}`)
+	result, err = verifyStepOrder(map[string][]source.VerifiedCollection{"build": {build}, "package": {tampered, good}}, deps, order, 0)
+	require.NoError(t, err)
+	require.Equal(t, []source.VerifiedCollection{good}, result["package"])
+}
@@ -0,0 +1,254 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/policy"
+)
+
+// delegation hands the requirements of a step to a sub-policy maintained by the team that owns the step. The root
+// policy decides who may sign the sub-policy, and the sub-policy decides who performs the step and what evidence
+// it requires.
+type delegation struct {
+	// Signers are the ids of public keys of the root policy trusted to sign sub-policies for the step.
+	Signers []string `json:"signers"`
+}
+
+// delegate replaces the functionaries and attestations of each delegated step with those of the step with the same
+// name in a sub-policy signed by one of its delegates. The public keys and roots the step's functionaries use from the
+// sub-policy are added to the policy so the evidence of the step can be verified, and are trusted by no other step. A
+// delegated step without a sub-policy fails verification rather than falling back to what the root policy left in
+// its place. Only the step definitions of sub-policies are used: their expiration is checked, and their extensions
+// are ignored.
+func delegate(pol *policy.Policy, extensions policyExtensions, subPolicies []dsse.Envelope, pubKeysByID map[string]cryptoutil.Verifier, now time.Time) error {
+	keys := make([]string, 0, len(extensions.Steps))
+	for key, step := range extensions.Steps {
+		if _, ok := pol.Steps[key]; ok && step.Delegate != nil {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	sort.Strings(keys)
+	reserved := reservedTrust(*pol, keys)
+	// roots added for delegated steps mustn't be trusted by functionaries of the root policy that trust every root
+	policyRoots := rootIDs(pol.Roots)
+	for name, step := range pol.Steps {
+		step.Functionaries = pinRoots(step.Functionaries, policyRoots)
+		pol.Steps[name] = step
+	}
+
+	for _, key := range keys {
+		rootStep := pol.Steps[key]
+		verifiers := make([]cryptoutil.Verifier, 0, len(extensions.Steps[key].Delegate.Signers))
+		for _, keyID := range extensions.Steps[key].Delegate.Signers {
+			verifier, ok := pubKeysByID[keyID]
+			if !ok {
+				return fmt.Errorf("delegate %v of step %v is not a public key in the policy", keyID, key)
+			}
+
+			verifiers = append(verifiers, verifier)
+		}
+
+		if len(verifiers) == 0 {
+			return fmt.Errorf("step %v is delegated to no one", key)
+		}
+
+		var sub *policy.Policy
+		for i, env := range subPolicies {
+			if env.PayloadType != policy.PolicyPredicate {
+				return fmt.Errorf("sub-policy %v has payload type %v, expected %v", i+1, env.PayloadType, policy.PolicyPredicate)
+			}
+
+			if _, err := env.Verify(dsse.VerifyWithVerifiers(verifiers...)); err != nil {
+				log.Debugf("sub-policy %v isn't signed by a delegate of step %v: %v", i+1, key, err)
+				continue
+			}
+
+			candidate := policy.Policy{}
+			if err := json.Unmarshal(env.Payload, &candidate); err != nil {
+				return fmt.Errorf("failed to parse sub-policy %v: %w", i+1, err)
+			}
+
+			if _, ok := candidate.Steps[key]; !ok {
+				continue
+			}
+
+			if sub != nil {
+				return fmt.Errorf("more than one sub-policy signed by a delegate of step %v defines it", key)
+			}
+
+			if now.After(candidate.Expires) {
+				return fmt.Errorf("sub-policy %v for step %v expired at %v", i+1, key, candidate.Expires.Format(time.RFC3339))
+			}
+
+			sub = &candidate
+		}
+
+		if sub == nil {
+			return fmt.Errorf("step %v is delegated, but no sub-policy signed by its delegates defines it", key)
+		}
+
+		functionaries := pinRoots(sub.Steps[key].Functionaries, rootIDs(sub.Roots))
+		if err := mergeTrust(pol, *sub, functionaries, reserved); err != nil {
+			return fmt.Errorf("sub-policy for step %v: %w", key, err)
+		}
+
+		rootStep.Functionaries = functionaries
+		rootStep.Attestations = sub.Steps[key].Attestations
+		pol.Steps[key] = rootStep
+	}
+
+	return nil
+}
+
+// reservedTrust returns the public key and root ids the steps of the policy that aren't delegated use without the
+// policy defining them. A sub-policy can't define them, since the steps using them would then trust the sub-policy.
+func reservedTrust(pol policy.Policy, delegated []string) map[string]struct{} {
+	isDelegated := make(map[string]struct{}, len(delegated))
+	for _, name := range delegated {
+		isDelegated[name] = struct{}{}
+	}
+
+	reserved := make(map[string]struct{})
+	for name, step := range pol.Steps {
+		if _, ok := isDelegated[name]; ok {
+			continue
+		}
+
+		for _, functionary := range step.Functionaries {
+			if _, ok := pol.PublicKeys[functionary.PublicKeyID]; functionary.PublicKeyID != "" && !ok {
+				reserved[functionary.PublicKeyID] = struct{}{}
+			}
+
+			for _, id := range functionary.CertConstraint.Roots {
+				if _, ok := pol.Roots[id]; id != policy.AllowAllConstraint && !ok {
+					reserved[id] = struct{}{}
+				}
+			}
+		}
+	}
+
+	return reserved
+}
+
+// pinRoots returns functionaries with certificate constraints that trust every root changed to trust the roots of
+// ids, which are the roots of the policy that defines them.
+func pinRoots(functionaries []policy.Functionary, ids []string) []policy.Functionary {
+	pinned := make([]policy.Functionary, 0, len(functionaries))
+	for _, functionary := range functionaries {
+		roots := functionary.CertConstraint.Roots
+		if len(roots) == 1 && roots[0] == policy.AllowAllConstraint {
+			functionary.CertConstraint.Roots = append([]string{}, ids...)
+		}
+
+		pinned = append(pinned, functionary)
+	}
+
+	return pinned
+}
+
+func rootIDs(roots map[string]policy.Root) []string {
+	ids := make([]string, 0, len(roots))
+	for id := range roots {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+// mergeTrust adds the public keys and roots of a sub-policy that functionaries use to the policy. A sub-policy
+// defining an id the policy already uses for something else is rejected, as is one using an id reserved for other
+// steps, so a sub-policy can't change what the rest of the policy trusts. Timestamp authorities vouch for the
+// signatures of every step, so a sub-policy can only name those of the root policy.
+func mergeTrust(pol *policy.Policy, sub policy.Policy, functionaries []policy.Functionary, reserved map[string]struct{}) error {
+	for id, key := range sub.PublicKeys {
+		if existing, ok := pol.PublicKeys[id]; ok && !bytes.Equal(existing.Key, key.Key) {
+			return fmt.Errorf("public key %v differs from the root policy's", id)
+		}
+	}
+
+	for id, root := range sub.Roots {
+		if existing, ok := pol.Roots[id]; ok && !sameRoot(existing, root) {
+			return fmt.Errorf("root %v differs from the root policy's", id)
+		}
+	}
+
+	for id, authority := range sub.TimestampAuthorities {
+		if existing, ok := pol.TimestampAuthorities[id]; !ok || !sameRoot(existing, authority) {
+			return fmt.Errorf("timestamp authority %v isn't one of the root policy's, which are trusted for every step", id)
+		}
+	}
+
+	if pol.PublicKeys == nil {
+		pol.PublicKeys = make(map[string]policy.PublicKey)
+	}
+
+	if pol.Roots == nil {
+		pol.Roots = make(map[string]policy.Root)
+	}
+
+	for _, functionary := range functionaries {
+		if key, ok := sub.PublicKeys[functionary.PublicKeyID]; ok {
+			if _, ok := reserved[functionary.PublicKeyID]; ok {
+				return fmt.Errorf("public key %v is used by steps of the root policy that aren't delegated", functionary.PublicKeyID)
+			}
+
+			pol.PublicKeys[functionary.PublicKeyID] = key
+		}
+
+		for _, id := range functionary.CertConstraint.Roots {
+			root, ok := sub.Roots[id]
+			if !ok {
+				continue
+			}
+
+			if _, ok := reserved[id]; ok {
+				return fmt.Errorf("root %v is used by steps of the root policy that aren't delegated", id)
+			}
+
+			pol.Roots[id] = root
+		}
+	}
+
+	return nil
+}
+
+func sameRoot(a, b policy.Root) bool {
+	if !bytes.Equal(a.Certificate, b.Certificate) || len(a.Intermediates) != len(b.Intermediates) {
+		return false
+	}
+
+	for i := range a.Intermediates {
+		if !bytes.Equal(a.Intermediates[i], b.Intermediates[i]) {
+			return false
+		}
+	}
+
+	return true
+}
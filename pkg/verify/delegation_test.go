@@ -0,0 +1,153 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/go-witness/policy"
+)
+
+func delegateSigner(t *testing.T) (cryptoutil.Signer, cryptoutil.Verifier, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := cryptoutil.NewECDSASigner(key, crypto.SHA256)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	keyID, err := verifier.KeyID()
+	require.NoError(t, err)
+	return signer, verifier, keyID
+}
+
+func signSubPolicy(t *testing.T, signer cryptoutil.Signer, payloadType string, sub policy.Policy) dsse.Envelope {
+	payload, err := json.Marshal(&sub)
+	require.NoError(t, err)
+	env, err := dsse.Sign(payloadType, bytes.NewReader(payload), dsse.SignWithSigners(signer))
+	require.NoError(t, err)
+	return env
+}
+
+func TestDelegate(t *testing.T) {
+	teamSigner, teamVerifier, teamKeyID := delegateSigner(t)
+	otherSigner, _, _ := delegateSigner(t)
+	now := time.Now()
+
+	rootPolicy := func() policy.Policy {
+		return policy.Policy{
+			PublicKeys: map[string]policy.PublicKey{teamKeyID: {KeyID: teamKeyID}},
+			Steps: map[string]policy.Step{
+				"build": {Name: "build", ArtifactsFrom: []string{"clone"}},
+				"clone": {Name: "clone", Functionaries: []policy.Functionary{{PublicKeyID: teamKeyID}}},
+			},
+		}
+	}
+
+	extensions := policyExtensions{Steps: map[string]stepExtensions{"build": {Delegate: &delegation{Signers: []string{teamKeyID}}}}}
+	pubKeysByID := map[string]cryptoutil.Verifier{teamKeyID: teamVerifier}
+	sub := policy.Policy{
+		Expires:    now.Add(time.Hour),
+		PublicKeys: map[string]policy.PublicKey{"builder": {KeyID: "builder", Key: []byte("builder key")}},
+		Steps: map[string]policy.Step{"build": {
+			Name:          "build",
+			Functionaries: []policy.Functionary{{PublicKeyID: "builder"}},
+			Attestations:  []policy.Attestation{{Type: "https://witness.dev/attestations/command-run/v0.1"}},
+		}},
+	}
+
+	// the step takes the functionaries and attestations of the sub-policy, and keeps its place in the root policy
+	pol := rootPolicy()
+	require.NoError(t, delegate(&pol, extensions, []dsse.Envelope{signSubPolicy(t, teamSigner, policy.PolicyPredicate, sub)}, pubKeysByID, now))
+	require.Equal(t, sub.Steps["build"].Functionaries, pol.Steps["build"].Functionaries)
+	require.Equal(t, sub.Steps["build"].Attestations, pol.Steps["build"].Attestations)
+	require.Equal(t, []string{"clone"}, pol.Steps["build"].ArtifactsFrom)
+	require.Contains(t, pol.PublicKeys, "builder")
+
+	// only the trust the step's functionaries use is added, and functionaries of the root policy that trust every
+	// root keep trusting only the roots of the root policy
+	scoped := sub
+	scoped.PublicKeys = map[string]policy.PublicKey{"builder": sub.PublicKeys["builder"], "unused": {KeyID: "unused", Key: []byte("unused key")}}
+	scoped.Roots = map[string]policy.Root{"team-ca": {Certificate: []byte("team ca")}, "unused-ca": {Certificate: []byte("unused ca")}}
+	scoped.Steps = map[string]policy.Step{"build": {
+		Name:          "build",
+		Functionaries: []policy.Functionary{{PublicKeyID: "builder"}, {CertConstraint: policy.CertConstraint{Roots: []string{"team-ca"}}}},
+	}}
+
+	pol = rootPolicy()
+	pol.Roots = map[string]policy.Root{"corp-ca": {Certificate: []byte("corp ca")}}
+	pol.Steps["clone"] = policy.Step{Name: "clone", Functionaries: []policy.Functionary{{CertConstraint: policy.CertConstraint{Roots: []string{policy.AllowAllConstraint}}}}}
+	require.NoError(t, delegate(&pol, extensions, []dsse.Envelope{signSubPolicy(t, teamSigner, policy.PolicyPredicate, scoped)}, pubKeysByID, now))
+	require.Contains(t, pol.PublicKeys, "builder")
+	require.NotContains(t, pol.PublicKeys, "unused")
+	require.Contains(t, pol.Roots, "team-ca")
+	require.NotContains(t, pol.Roots, "unused-ca")
+	require.Equal(t, []string{"corp-ca"}, pol.Steps["clone"].Functionaries[0].CertConstraint.Roots)
+
+	// a sub-policy can't define trust steps that aren't delegated use without the root policy defining it
+	pol = rootPolicy()
+	pol.Steps["clone"] = policy.Step{Name: "clone", Functionaries: []policy.Functionary{{PublicKeyID: "builder"}}}
+	err := delegate(&pol, extensions, []dsse.Envelope{signSubPolicy(t, teamSigner, policy.PolicyPredicate, sub)}, pubKeysByID, now)
+	require.ErrorContains(t, err, "used by steps of the root policy that aren't delegated")
+
+	// timestamp authorities are trusted for every step, so a sub-policy can't add one
+	timestamped := sub
+	timestamped.TimestampAuthorities = map[string]policy.Root{"team-tsa": {Certificate: []byte("team tsa")}}
+	pol = rootPolicy()
+	err = delegate(&pol, extensions, []dsse.Envelope{signSubPolicy(t, teamSigner, policy.PolicyPredicate, timestamped)}, pubKeysByID, now)
+	require.ErrorContains(t, err, "isn't one of the root policy's")
+
+	pol = rootPolicy()
+	require.ErrorContains(t, delegate(&pol, extensions, nil, pubKeysByID, now), "no sub-policy signed by its delegates defines it")
+
+	pol = rootPolicy()
+	err = delegate(&pol, extensions, []dsse.Envelope{signSubPolicy(t, otherSigner, policy.PolicyPredicate, sub)}, pubKeysByID, now)
+	require.ErrorContains(t, err, "no sub-policy signed by its delegates defines it")
+
+	pol = rootPolicy()
+	err = delegate(&pol, extensions, []dsse.Envelope{signSubPolicy(t, teamSigner, intoto.PayloadType, sub)}, pubKeysByID, now)
+	require.ErrorContains(t, err, "expected "+policy.PolicyPredicate)
+
+	pol = rootPolicy()
+	err = delegate(&pol, extensions, []dsse.Envelope{signSubPolicy(t, teamSigner, policy.PolicyPredicate, sub)}, nil, now)
+	require.ErrorContains(t, err, "not a public key in the policy")
+
+	expired := sub
+	expired.Expires = now.Add(-time.Hour)
+	pol = rootPolicy()
+	err = delegate(&pol, extensions, []dsse.Envelope{signSubPolicy(t, teamSigner, policy.PolicyPredicate, expired)}, pubKeysByID, now)
+	require.ErrorContains(t, err, "expired")
+
+	// a sub-policy can't replace a key the root policy trusts, even one its step doesn't use
+	conflicting := sub
+	conflicting.PublicKeys = map[string]policy.PublicKey{teamKeyID: {KeyID: teamKeyID, Key: []byte("another key")}}
+	pol = rootPolicy()
+	err = delegate(&pol, extensions, []dsse.Envelope{signSubPolicy(t, teamSigner, policy.PolicyPredicate, conflicting)}, pubKeysByID, now)
+	require.ErrorContains(t, err, "differs from the root policy's")
+
+	pol = rootPolicy()
+	signed := signSubPolicy(t, teamSigner, policy.PolicyPredicate, sub)
+	err = delegate(&pol, extensions, []dsse.Envelope{signed, signed}, pubKeysByID, now)
+	require.ErrorContains(t, err, "more than one sub-policy")
+}
@@ -0,0 +1,176 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/source"
+)
+
+// envelopeVerifier verifies the signatures on attestation envelopes. It mirrors dsse.Envelope.Verify
+// but allows a tolerance when checking certificate validity against a trusted time.
+type envelopeVerifier struct {
+	verifiers          []cryptoutil.Verifier
+	roots              []*x509.Certificate
+	intermediates      []*x509.Certificate
+	timestampVerifiers []dsse.TimestampVerifier
+	clockSkew          time.Duration
+	compromised        map[string]time.Time
+}
+
+func (ev envelopeVerifier) verify(ctx context.Context, env dsse.Envelope) ([]cryptoutil.Verifier, error) {
+	if len(env.Signatures) == 0 {
+		return nil, dsse.ErrNoSignatures{}
+	}
+
+	pae := preauthEncode(env.PayloadType, env.Payload)
+	passedVerifiers := make([]cryptoutil.Verifier, 0)
+	for _, sig := range env.Signatures {
+		if len(sig.Certificate) > 0 {
+			if verifier, err := ev.verifyCertificate(ctx, sig, pae); err == nil {
+				passedVerifiers = append(passedVerifiers, verifier)
+			} else {
+				log.Debugf("(verify) certificate on signature %v did not verify: %v", sig.KeyID, err)
+			}
+		}
+
+		for _, verifier := range ev.verifiers {
+			if verifier == nil {
+				continue
+			}
+
+			if err := verifier.Verify(bytes.NewReader(pae), sig.Signature); err == nil && ev.beforeCompromise(ctx, verifier, sig) {
+				passedVerifiers = append(passedVerifiers, verifier)
+			}
+		}
+	}
+
+	if len(passedVerifiers) == 0 {
+		return nil, dsse.ErrNoMatchingSigs{}
+	}
+
+	return passedVerifiers, nil
+}
+
+func (ev envelopeVerifier) verifyCertificate(ctx context.Context, sig dsse.Signature, pae []byte) (cryptoutil.Verifier, error) {
+	cert, err := cryptoutil.TryParseCertificate(sig.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	sigIntermediates := make([]*x509.Certificate, 0)
+	for _, intBytes := range sig.Intermediates {
+		intCert, err := cryptoutil.TryParseCertificate(intBytes)
+		if err != nil {
+			continue
+		}
+
+		sigIntermediates = append(sigIntermediates, intCert)
+	}
+
+	sigIntermediates = append(sigIntermediates, ev.intermediates...)
+	if len(ev.timestampVerifiers) == 0 {
+		return ev.verifyX509Time(cert, sigIntermediates, pae, sig.Signature, time.Now())
+	}
+
+	for _, timestampVerifier := range ev.timestampVerifiers {
+		for _, sigTimestamp := range sig.Timestamps {
+			trustedTime, err := timestampVerifier.Verify(ctx, bytes.NewReader(sigTimestamp.Data), bytes.NewReader(sig.Signature))
+			if err != nil {
+				continue
+			}
+
+			if verifier, err := ev.verifyX509Time(cert, sigIntermediates, pae, sig.Signature, trustedTime); err == nil {
+				return verifier, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no trusted timestamp could verify the certificate")
+}
+
+func (ev envelopeVerifier) verifyX509Time(cert *x509.Certificate, intermediates []*x509.Certificate, pae, sig []byte, trustedTime time.Time) (cryptoutil.Verifier, error) {
+	verifier, err := cryptoutil.NewX509Verifier(cert, intermediates, ev.roots, skewedTime(cert, trustedTime, ev.clockSkew))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifier.Verify(bytes.NewReader(pae), sig); err != nil {
+		return nil, err
+	}
+
+	return verifier, nil
+}
+
+// skewedTime returns the time a certificate should be validated at. If t falls outside of the certificate's
+// validity window by no more than skew, the nearest edge of the window is used instead.
+func skewedTime(cert *x509.Certificate, t time.Time, skew time.Duration) time.Time {
+	if t.Before(cert.NotBefore) && cert.NotBefore.Sub(t) <= skew {
+		return cert.NotBefore
+	}
+
+	if t.After(cert.NotAfter) && t.Sub(cert.NotAfter) <= skew {
+		return cert.NotAfter
+	}
+
+	return t
+}
+
+// preauthEncode wraps the data to be verified and it's type in the DSSE protocol's pre-authentication encoding
+// PAE(type, body) = "DSSEv1" + SP + LEN(type) + SP + type + SP + LEN(body) + SP + body
+func preauthEncode(bodyType string, body []byte) []byte {
+	const dsseVersion = "DSSEv1"
+	return []byte(fmt.Sprintf("%s %d %s %d %s", dsseVersion, len(bodyType), bodyType, len(body), body))
+}
+
+type verifiedSource struct {
+	source   source.Sourcer
+	verifier envelopeVerifier
+}
+
+func newVerifiedSource(source source.Sourcer, verifier envelopeVerifier) *verifiedSource {
+	return &verifiedSource{source, verifier}
+}
+
+func (s *verifiedSource) Search(ctx context.Context, collectionName string, subjectDigests, attestations []string) ([]source.VerifiedCollection, error) {
+	unverified, err := s.source.Search(ctx, collectionName, subjectDigests, attestations)
+	if err != nil {
+		return nil, err
+	}
+
+	verified := make([]source.VerifiedCollection, 0)
+	for _, toVerify := range unverified {
+		passedVerifiers, err := s.verifier.verify(ctx, toVerify.Envelope)
+		if err != nil {
+			log.Debugf("(verified source) skipping envelope: couldn't verify enveloper's signature with the policy's verifiers: %+v", err)
+			continue
+		}
+
+		verified = append(verified, source.VerifiedCollection{
+			Verifiers:          passedVerifiers,
+			CollectionEnvelope: toVerify,
+		})
+	}
+
+	return verified, nil
+}
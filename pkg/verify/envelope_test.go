@@ -0,0 +1,105 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+)
+
+func TestSkewedTime(t *testing.T) {
+	now := time.Now()
+	cert := &x509.Certificate{
+		NotBefore: now.Add(2 * time.Minute),
+		NotAfter:  now.Add(10 * time.Minute),
+	}
+
+	require.Equal(t, now, skewedTime(cert, now, 0))
+	require.Equal(t, now, skewedTime(cert, now, time.Minute))
+	require.Equal(t, cert.NotBefore, skewedTime(cert, now, 5*time.Minute))
+
+	late := now.Add(12 * time.Minute)
+	require.Equal(t, late, skewedTime(cert, late, time.Minute))
+	require.Equal(t, cert.NotAfter, skewedTime(cert, late, 5*time.Minute))
+}
+
+func TestVerifyEnvelopeClockSkew(t *testing.T) {
+	root, signer := createFutureChain(t, 2*time.Minute)
+	env, err := dsse.Sign("text", bytes.NewReader([]byte("test")), dsse.SignWithSigners(signer))
+	require.NoError(t, err)
+
+	ev := envelopeVerifier{roots: []*x509.Certificate{root}}
+	_, err = ev.verify(context.Background(), env)
+	require.Error(t, err)
+
+	ev.clockSkew = 5 * time.Minute
+	verifiers, err := ev.verify(context.Background(), env)
+	require.NoError(t, err)
+	require.Len(t, verifiers, 1)
+}
+
+// createFutureChain creates a root and a signer whose leaf certificate only becomes valid after offset,
+// simulating a signer whose clock is ahead of the verifier's.
+func createFutureChain(t *testing.T, offset time.Duration) (*x509.Certificate, cryptoutil.Signer) {
+	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Witness Testing Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	rootBytes, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	require.NoError(t, err)
+	root, err := x509.ParseCertificate(rootBytes)
+	require.NoError(t, err)
+
+	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	leafTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Witness Testing Leaf"},
+		NotBefore:             time.Now().Add(offset),
+		NotAfter:              time.Now().Add(offset + 10*time.Minute),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		BasicConstraintsValid: true,
+	}
+
+	leafBytes, err := x509.CreateCertificate(rand.Reader, leafTemplate, root, &leafKey.PublicKey, rootKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(leafBytes)
+	require.NoError(t, err)
+
+	signer, err := cryptoutil.NewSigner(leafKey, cryptoutil.SignWithCertificate(leaf), cryptoutil.SignWithHash(crypto.SHA256))
+	require.NoError(t, err)
+	return root, signer
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"fmt"
+
+	"github.com/testifysec/go-witness/policy"
+)
+
+// forEnvironment removes the steps of a policy that don't apply to environment, along with references to them from
+// other steps. Steps without environments apply to every environment. When no environment is given every step is
+// kept, so requirements specific to an environment can't be skipped by leaving it out. An environment that neither the
+// policy nor any step names is rejected rather than silently dropping every environment specific requirement, such as
+// when it's misspelled.
+func forEnvironment(pol *policy.Policy, extensions *policyExtensions, environment string) error {
+	if environment == "" {
+		return nil
+	}
+
+	known := false
+	for _, policyEnvironment := range extensions.Environments {
+		if policyEnvironment == environment {
+			known = true
+		}
+	}
+
+	removed := make(map[string]struct{})
+	for key, step := range extensions.Steps {
+		if len(step.Environments) == 0 {
+			continue
+		}
+
+		applies := false
+		for _, stepEnvironment := range step.Environments {
+			if stepEnvironment == environment {
+				applies = true
+				break
+			}
+		}
+
+		if applies {
+			known = true
+			continue
+		}
+
+		removed[stepName(key, step)] = struct{}{}
+		delete(extensions.Steps, key)
+		delete(pol.Steps, key)
+	}
+
+	if !known {
+		return fmt.Errorf("environment %v is not an environment of the policy", environment)
+	}
+
+	for key, step := range pol.Steps {
+		step.ArtifactsFrom = without(step.ArtifactsFrom, removed)
+		pol.Steps[key] = step
+	}
+
+	for key, step := range extensions.Steps {
+		step.DependsOn = without(step.DependsOn, removed)
+		step.ChainedFrom = without(step.ChainedFrom, removed)
+		extensions.Steps[key] = step
+	}
+
+	return nil
+}
+
+func without(steps []string, removed map[string]struct{}) []string {
+	kept := make([]string, 0, len(steps))
+	for _, step := range steps {
+		if _, ok := removed[step]; !ok {
+			kept = append(kept, step)
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/policy"
+)
+
+func TestForEnvironment(t *testing.T) {
+	policyJSON := []byte(`{"environments":["staging"],"steps":{` +
+		`"build":{"name":"build"},` +
+		`"approve":{"name":"approve","environments":["production"]},` +
+		`"deploy":{"name":"deploy","artifactsFrom":["build","approve"],"dependsOn":["approve"]}}}`)
+
+	parse := func() (policy.Policy, policyExtensions) {
+		pol := policy.Policy{}
+		require.NoError(t, json.Unmarshal(policyJSON, &pol))
+		ext := policyExtensions{}
+		require.NoError(t, json.Unmarshal(policyJSON, &ext))
+		return pol, ext
+	}
+
+	pol, ext := parse()
+	require.NoError(t, forEnvironment(&pol, &ext, "production"))
+	require.Len(t, pol.Steps, 3)
+
+	pol, ext = parse()
+	require.NoError(t, forEnvironment(&pol, &ext, "staging"))
+	require.NotContains(t, pol.Steps, "approve")
+	require.NotContains(t, ext.Steps, "approve")
+	require.Equal(t, []string{"build"}, pol.Steps["deploy"].ArtifactsFrom)
+	require.Empty(t, ext.Steps["deploy"].DependsOn)
+
+	pol, ext = parse()
+	require.NoError(t, forEnvironment(&pol, &ext, ""))
+	require.Len(t, pol.Steps, 3)
+
+	pol, ext = parse()
+	require.ErrorContains(t, forEnvironment(&pol, &ext, "prod"), "not an environment of the policy")
+}
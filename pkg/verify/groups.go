@@ -0,0 +1,152 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/witness/pkg/groups"
+)
+
+// groupRequirements configure how the functionary groups of a policy are resolved.
+type groupRequirements struct {
+	// Signers are the ids of policy public keys, besides the policy signer, trusted to sign group snapshots.
+	Signers []string `json:"signers,omitempty"`
+	// MaxAge is how long ago groups may have been resolved, such as 24h. Snapshots of any age are accepted if it
+	// isn't set.
+	MaxAge string `json:"maxAge,omitempty"`
+}
+
+// ReferencedGroups returns the functionary groups a policy names, which must be resolved to verify it.
+func ReferencedGroups(policyPayload []byte) ([]string, error) {
+	extensions := policyExtensions{}
+	if err := json.Unmarshal(policyPayload, &extensions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal policy extensions: %w", err)
+	}
+
+	return extensions.referencedGroups(), nil
+}
+
+func (pe policyExtensions) referencedGroups() []string {
+	seen := make(map[string]struct{})
+	names := make([]string, 0)
+	for _, step := range pe.Steps {
+		for _, name := range step.ApproverGroups {
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// groupMembers returns the members of each group the policy names. Snapshots resolved by the verifier are trusted,
+// while signed snapshots must be signed by the policy signer or one of the policy's group signers. Each group's
+// members are taken from the most recent snapshot that resolved it, so members removed from a group lose access
+// even if an older snapshot still lists them. Snapshots dated after now, allowing for skew, are rejected, since they
+// would otherwise never age past the policy's max age and would win over every genuine snapshot.
+func (pe policyExtensions) groupMembers(signed []dsse.Envelope, resolved []groups.Snapshot, policyVerifiers []cryptoutil.Verifier, pubKeysByID map[string]cryptoutil.Verifier, now time.Time, skew time.Duration) (map[string][]string, error) {
+	names := pe.referencedGroups()
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	requirements := groupRequirements{}
+	if pe.Groups != nil {
+		requirements = *pe.Groups
+	}
+
+	verifiers := make([]cryptoutil.Verifier, 0, len(policyVerifiers)+len(requirements.Signers))
+	for _, verifier := range policyVerifiers {
+		if verifier != nil {
+			verifiers = append(verifiers, verifier)
+		}
+	}
+
+	for _, keyID := range requirements.Signers {
+		verifier, ok := pubKeysByID[keyID]
+		if !ok {
+			return nil, fmt.Errorf("group signer %v is not a public key in the policy", keyID)
+		}
+
+		verifiers = append(verifiers, verifier)
+	}
+
+	var maxAge time.Duration
+	if requirements.MaxAge != "" {
+		var err error
+		if maxAge, err = time.ParseDuration(requirements.MaxAge); err != nil || maxAge <= 0 {
+			return nil, fmt.Errorf("invalid group snapshot max age %q", requirements.MaxAge)
+		}
+	}
+
+	snapshots := append([]groups.Snapshot{}, resolved...)
+	for i, env := range signed {
+		if env.PayloadType != groups.SnapshotType {
+			return nil, fmt.Errorf("group snapshot %v has payload type %v, expected %v", i+1, env.PayloadType, groups.SnapshotType)
+		}
+
+		if _, err := env.Verify(dsse.VerifyWithVerifiers(verifiers...)); err != nil {
+			return nil, fmt.Errorf("group snapshot %v is not signed by the policy signer or a group signer: %w", i+1, err)
+		}
+
+		snapshot := groups.Snapshot{}
+		if err := json.Unmarshal(env.Payload, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to parse group snapshot %v: %w", i+1, err)
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	for _, snapshot := range snapshots {
+		if snapshot.ResolvedAt.After(now.Add(skew)) {
+			return nil, fmt.Errorf("group snapshot from %v is dated %v, which is in the future", snapshot.Source, snapshot.ResolvedAt.Format(time.RFC3339))
+		}
+	}
+
+	members := make(map[string][]string, len(names))
+	for _, name := range names {
+		var newest *groups.Snapshot
+		for i := range snapshots {
+			if _, ok := snapshots[i].Groups[name]; !ok {
+				continue
+			}
+
+			if newest == nil || snapshots[i].ResolvedAt.After(newest.ResolvedAt) {
+				newest = &snapshots[i]
+			}
+		}
+
+		if newest == nil {
+			return nil, fmt.Errorf("group %v was not resolved", name)
+		}
+
+		if maxAge > 0 && now.Add(-skew).Sub(newest.ResolvedAt) > maxAge {
+			return nil, fmt.Errorf("group %v was last resolved at %v, more than %v ago", name, newest.ResolvedAt.Format(time.RFC3339), maxAge)
+		}
+
+		members[name] = newest.Groups[name]
+	}
+
+	return members, nil
+}
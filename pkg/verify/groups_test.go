@@ -0,0 +1,112 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/groups"
+)
+
+func TestGroupMembers(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := cryptoutil.NewECDSASigner(key, crypto.SHA256)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	keyID, err := verifier.KeyID()
+	require.NoError(t, err)
+
+	now := time.Now()
+	older := groups.Snapshot{ResolvedAt: now.Add(-2 * time.Hour), Groups: map[string][]string{"release-engineers": {"alice@example.com", "bob@example.com"}}}
+	newer := groups.Snapshot{ResolvedAt: now.Add(-time.Hour), Groups: map[string][]string{"release-engineers": {"alice@example.com"}}}
+	payload, err := json.Marshal(&newer)
+	require.NoError(t, err)
+	signed, err := dsse.Sign(groups.SnapshotType, bytes.NewReader(payload), dsse.SignWithSigners(signer))
+	require.NoError(t, err)
+
+	pe := policyExtensions{
+		Steps:  map[string]stepExtensions{"approve": {ApproverGroups: []string{"release-engineers"}}},
+		Groups: &groupRequirements{Signers: []string{keyID}},
+	}
+
+	pubKeys := map[string]cryptoutil.Verifier{keyID: verifier}
+	// bob was removed from the group since the older snapshot
+	members, err := pe.groupMembers([]dsse.Envelope{signed}, []groups.Snapshot{older}, nil, pubKeys, now, 0)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{"release-engineers": {"alice@example.com"}}, members)
+	require.Equal(t, map[string]stepApprovers{"approve": {members: []string{"alice@example.com"}}}, pe.approvers(policy.Policy{}, nil, members))
+
+	_, err = pe.groupMembers(nil, nil, nil, pubKeys, now, 0)
+	require.ErrorContains(t, err, "group release-engineers was not resolved")
+
+	_, err = policyExtensions{Steps: pe.Steps}.groupMembers([]dsse.Envelope{signed}, nil, nil, nil, now, 0)
+	require.ErrorContains(t, err, "not signed by the policy signer or a group signer")
+
+	// the policy signer is trusted to sign snapshots without being a group signer
+	_, err = policyExtensions{Steps: pe.Steps}.groupMembers([]dsse.Envelope{signed}, nil, []cryptoutil.Verifier{verifier}, nil, now, 0)
+	require.NoError(t, err)
+
+	pe.Groups.MaxAge = "30m"
+	_, err = pe.groupMembers([]dsse.Envelope{signed}, nil, nil, pubKeys, now, 0)
+	require.ErrorContains(t, err, "more than 30m0s ago")
+
+	// a snapshot dated in the future would never age out
+	future := groups.Snapshot{ResolvedAt: now.Add(time.Hour), Groups: newer.Groups}
+	_, err = pe.groupMembers(nil, []groups.Snapshot{future}, nil, pubKeys, now, time.Minute)
+	require.ErrorContains(t, err, "in the future")
+	future.ResolvedAt = now.Add(30 * time.Second)
+	_, err = pe.groupMembers(nil, []groups.Snapshot{future}, nil, pubKeys, now, time.Minute)
+	require.NoError(t, err)
+}
+
+func TestVerifyApproverGroups(t *testing.T) {
+	ca := newApproverCA(t)
+	alice := ca.collection(t, "alice", "alice@example.com")
+	bob := ca.collection(t, "bob", "bob@example.com")
+	pe := policyExtensions{Steps: map[string]stepExtensions{"approve": {ApproverGroups: []string{"release-engineers"}}}}
+	trusted := trusting(stepApprovers{}, ca)
+	pol := policy.Policy{Steps: map[string]policy.Step{"approve": {Name: "approve", Functionaries: trusted.functionaries}}}
+	approvers := func(members map[string][]string) map[string]stepApprovers {
+		return pe.approvers(pol, trusted.trustBundles, members)
+	}
+
+	result, err := verifyApprovers(map[string][]source.VerifiedCollection{"approve": {alice, bob}}, approvers(map[string][]string{"release-engineers": {"alice@example.com"}}))
+	require.NoError(t, err)
+	require.Len(t, result["approve"], 1)
+	require.Equal(t, "alice", result["approve"][0].Reference)
+
+	// members are compared exactly, so a member named like a pattern only approves itself
+	result, err = verifyApprovers(map[string][]source.VerifiedCollection{"approve": {alice, bob}}, approvers(map[string][]string{"release-engineers": {"*@example.com", "ALICE@example.com"}}))
+	require.NoError(t, err)
+	require.Len(t, result["approve"], 1)
+	require.Equal(t, "alice", result["approve"][0].Reference)
+
+	// an empty group approves no one
+	_, err = verifyApprovers(map[string][]source.VerifiedCollection{"approve": {alice}}, approvers(map[string][]string{"release-engineers": {}}))
+	require.Error(t, err)
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sort"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/source"
+)
+
+// Signer identifies who signed an attestation by their key id and, for keys with a certificate, the identities the
+// certificate was issued to.
+type Signer struct {
+	KeyID      string   `json:"keyid"`
+	CommonName string   `json:"commonname,omitempty"`
+	Emails     []string `json:"emails,omitempty"`
+	URIs       []string `json:"uris,omitempty"`
+}
+
+// SignerOf returns the identity of signer.
+func SignerOf(signer cryptoutil.Signer) (Signer, error) {
+	keyID, err := signer.KeyID()
+	if err != nil {
+		return Signer{}, fmt.Errorf("failed to get key id of signer: %w", err)
+	}
+
+	identity := Signer{KeyID: keyID}
+	certSigner, ok := signer.(interface{ Certificate() *x509.Certificate })
+	if !ok || certSigner.Certificate() == nil {
+		return identity, nil
+	}
+
+	cert := certSigner.Certificate()
+	identity.CommonName = cert.Subject.CommonName
+	identity.Emails = cert.EmailAddresses
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+
+	return identity, nil
+}
+
+// EvidenceReference refers to a collection that satisfied a policy by the step it satisfied and the key ids that
+// signed it.
+type EvidenceReference struct {
+	Step      string   `json:"step"`
+	Reference string   `json:"reference"`
+	Signers   []string `json:"signers"`
+}
+
+// EvidenceReferences returns references to the verified collections of each step, ordered by step and reference.
+func EvidenceReferences(verified map[string][]source.VerifiedCollection) []EvidenceReference {
+	references := make([]EvidenceReference, 0)
+	for step, collections := range verified {
+		for _, collection := range collections {
+			signers := make([]string, 0, len(collection.Verifiers))
+			for _, verifier := range collection.Verifiers {
+				if keyID, err := verifier.KeyID(); err == nil {
+					signers = append(signers, keyID)
+				}
+			}
+
+			sort.Strings(signers)
+			references = append(references, EvidenceReference{Step: step, Reference: collection.Reference, Signers: signers})
+		}
+	}
+
+	sort.Slice(references, func(i, j int) bool {
+		if references[i].Step != references[j].Step {
+			return references[i].Step < references[j].Step
+		}
+
+		return references[i].Reference < references[j].Reference
+	})
+
+	return references
+}
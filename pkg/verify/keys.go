@@ -0,0 +1,67 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/witness/pkg/signer/gpg"
+	"github.com/testifysec/witness/pkg/signer/ssh"
+)
+
+// NewVerifierFromBytes returns a verifier for a PEM encoded public key or certificate, an armored OpenPGP public
+// key, or an SSH public key in authorized_keys format.
+func NewVerifierFromBytes(key []byte) (cryptoutil.Verifier, error) {
+	if gpg.IsArmoredPublicKey(key) {
+		return gpg.NewVerifier(key)
+	}
+
+	if ssh.IsPublicKey(key) {
+		return ssh.NewVerifier(key)
+	}
+
+	return cryptoutil.NewVerifierFromReader(bytes.NewReader(key))
+}
+
+// publicKeyVerifiers returns verifiers for the public keys in a policy keyed by key id. It mirrors
+// policy.PublicKeyVerifiers but also accepts OpenPGP keys, whose key id is the fingerprint of the primary key, and
+// SSH keys, whose key id is their SHA256 fingerprint.
+func publicKeyVerifiers(pol policy.Policy) (map[string]cryptoutil.Verifier, error) {
+	verifiers := make(map[string]cryptoutil.Verifier)
+	for _, key := range pol.PublicKeys {
+		verifier, err := NewVerifierFromBytes(key.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		keyID, err := verifier.KeyID()
+		if err != nil {
+			return nil, err
+		}
+
+		if keyID != key.KeyID {
+			return nil, policy.ErrKeyIDMismatch{
+				Expected: key.KeyID,
+				Actual:   keyID,
+			}
+		}
+
+		verifiers[keyID] = verifier
+	}
+
+	return verifiers, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/source"
+)
+
+func (pe policyExtensions) requiredProducts() map[string][]string {
+	required := make(map[string][]string)
+	for key, step := range pe.Steps {
+		if len(step.RequiredProducts) > 0 {
+			required[stepName(key, step)] = step.RequiredProducts
+		}
+	}
+
+	return required
+}
+
+// verifyRequiredProducts removes collections that are missing a product the policy requires of their step, so a
+// build that stopped producing an expected artifact fails verification even if everything else about it checks out.
+func verifyRequiredProducts(accepted map[string][]source.VerifiedCollection, required map[string][]string) (map[string][]source.VerifiedCollection, error) {
+	result := make(map[string][]source.VerifiedCollection, len(accepted))
+	for step, collections := range accepted {
+		result[step] = collections
+	}
+
+	for step, patterns := range required {
+		kept := make([]source.VerifiedCollection, 0, len(result[step]))
+		var lastErr error
+		for _, collection := range result[step] {
+			if err := checkRequiredProducts(collection, patterns); err != nil {
+				lastErr = fmt.Errorf("%v: %w", collection.Reference, err)
+				continue
+			}
+
+			kept = append(kept, collection)
+		}
+
+		if len(kept) == 0 {
+			if lastErr == nil {
+				lastErr = errors.New("no evidence")
+			}
+
+			return nil, fmt.Errorf("no evidence for step %v has every product the policy requires: %w", step, lastErr)
+		}
+
+		result[step] = kept
+	}
+
+	return result, nil
+}
+
+// checkRequiredProducts checks that every pattern matches at least one product of the collection. Patterns are
+// matched against the product's path relative to the working directory, where * matches any characters.
+func checkRequiredProducts(collection source.VerifiedCollection, patterns []string) error {
+	products := make([]string, 0)
+	for _, collectionAttestation := range collection.Collection.Attestations {
+		producer, ok := collectionAttestation.Attestation.(attestation.Producer)
+		if !ok {
+			continue
+		}
+
+		for path := range producer.Products() {
+			products = append(products, filepath.ToSlash(path))
+		}
+	}
+
+	for _, pattern := range patterns {
+		found := false
+		for _, product := range products {
+			if globMatch(pattern, product) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("no product matches %v", pattern)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/product"
+)
+
+func productCollection(t *testing.T, ref string, paths ...string) source.VerifiedCollection {
+	products := make(map[string]attestation.Product)
+	for _, path := range paths {
+		products[path] = attestation.Product{MimeType: "application/octet-stream"}
+	}
+
+	data, err := json.Marshal(products)
+	require.NoError(t, err)
+	a := product.New()
+	require.NoError(t, json.Unmarshal(data, a))
+	return source.VerifiedCollection{
+		CollectionEnvelope: source.CollectionEnvelope{
+			Reference:  ref,
+			Collection: attestation.Collection{Attestations: []attestation.CollectionAttestation{{Type: product.Type, Attestation: a}}},
+		},
+	}
+}
+
+func TestVerifyRequiredProducts(t *testing.T) {
+	complete := productCollection(t, "complete", "bin/app", "dist/app-linux-amd64.tar.gz")
+	incomplete := productCollection(t, "incomplete", "bin/app")
+	accepted := map[string][]source.VerifiedCollection{"build": {complete, incomplete}, "test": nil}
+
+	required := map[string][]string{"build": {"bin/app", "*.tar.gz"}}
+	result, err := verifyRequiredProducts(accepted, required)
+	require.NoError(t, err)
+	require.Len(t, result["build"], 1)
+	require.Equal(t, "complete", result["build"][0].Reference)
+
+	_, err = verifyRequiredProducts(map[string][]source.VerifiedCollection{"build": {incomplete}}, required)
+	require.ErrorContains(t, err, "no product matches *.tar.gz")
+
+	_, err = verifyRequiredProducts(map[string][]source.VerifiedCollection{"build": {{}}}, map[string][]string{"build": {"bin/app"}})
+	require.ErrorContains(t, err, "no product matches bin/app")
+
+	_, err = verifyRequiredProducts(accepted, map[string][]string{"test": {"report.xml"}})
+	require.ErrorContains(t, err, "no evidence for step test")
+}
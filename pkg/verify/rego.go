@@ -0,0 +1,267 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/policy"
+)
+
+const denyRule = "deny"
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// RegoDenial is a reason a rego module of the policy rejected an attestation.
+type RegoDenial struct {
+	Step        string
+	Attestation string
+	// Reference identifies the rejected collection, such as its gitoid or the file it was read from.
+	Reference string
+	Module    string
+	// Line is the line of the deny rule that produced the message, or 0 if the module couldn't be evaluated.
+	Line    int
+	Message string
+	// Fields are the paths into the attestation the deny rule reads, such as input.exitcode.
+	Fields []string
+}
+
+func (d RegoDenial) String() string {
+	rule := d.Module
+	if d.Line > 0 {
+		rule = fmt.Sprintf("%v:%v", d.Module, d.Line)
+	}
+
+	s := fmt.Sprintf("step %v: %v denied %v in %v: %v", d.Step, rule, d.Attestation, d.Reference, d.Message)
+	if len(d.Fields) > 0 {
+		s += fmt.Sprintf(" (reads %v)", strings.Join(d.Fields, ", "))
+	}
+
+	return s
+}
+
+// ErrRegoDenied is returned when no set of attestations satisfies the policy and the rego modules of the policy
+// rejected some of the attestations that were found.
+type ErrRegoDenied struct {
+	Denials []RegoDenial
+	err     error
+}
+
+func (e ErrRegoDenied) Error() string {
+	lines := []string{e.err.Error(), "attestations rejected by rego policies:"}
+	for _, denial := range e.Denials {
+		lines = append(lines, "  "+denial.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (e ErrRegoDenied) Unwrap() error {
+	return e.err
+}
+
+// regoDenials searches for each step's attestations again to explain a failed verification, evaluating each deny
+// rule of the policy's rego modules on its own so messages can be traced to the rule that produced them. go-witness
+// only reports that no set of attestations satisfied the policy.
+func regoDenials(ctx context.Context, pol policy.Policy, verifiedSource *verifiedSource, subjectDigests []string) []RegoDenial {
+	stepNames := make([]string, 0, len(pol.Steps))
+	for name := range pol.Steps {
+		stepNames = append(stepNames, name)
+	}
+
+	sort.Strings(stepNames)
+	denials := []RegoDenial{}
+	for _, stepName := range stepNames {
+		step := pol.Steps[stepName]
+		types := make([]string, 0, len(step.Attestations))
+		hasRego := false
+		for _, attestation := range step.Attestations {
+			types = append(types, attestation.Type)
+			hasRego = hasRego || len(attestation.RegoPolicies) > 0
+		}
+
+		if !hasRego {
+			continue
+		}
+
+		collections, err := verifiedSource.Search(ctx, stepName, subjectDigests, types)
+		if err != nil {
+			log.Debugf("failed to search for attestations of %v to explain the failure: %v", stepName, err)
+			continue
+		}
+
+		for _, collection := range collections {
+			for _, expected := range step.Attestations {
+				for _, found := range collection.Collection.Attestations {
+					if found.Type != expected.Type {
+						continue
+					}
+
+					for _, module := range expected.RegoPolicies {
+						for _, denial := range evaluateModule(module, found.Attestation) {
+							denial.Step = stepName
+							denial.Attestation = expected.Type
+							denial.Reference = collection.Reference
+							denials = append(denials, denial)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return denials
+}
+
+// evaluateModule evaluates each deny rule of module on its own against attestor.
+func evaluateModule(module policy.RegoPolicy, attestor interface{}) []RegoDenial {
+	fail := func(err error) []RegoDenial {
+		return []RegoDenial{{Module: module.Name, Message: err.Error()}}
+	}
+
+	data, err := json.Marshal(attestor)
+	if err != nil {
+		return fail(err)
+	}
+
+	// numbers are decoded as they are by go-witness so rules compare them the same way
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var input interface{}
+	if err := decoder.Decode(&input); err != nil {
+		return fail(err)
+	}
+
+	parsed, err := ast.ParseModule(module.Name, string(module.Module))
+	if err != nil {
+		return fail(err)
+	}
+
+	others := make([]*ast.Rule, 0, len(parsed.Rules))
+	denies := make([]*ast.Rule, 0, len(parsed.Rules))
+	byName := make(map[ast.Var][]*ast.Rule)
+	for _, rule := range parsed.Rules {
+		if rule.Head.Ref().String() == denyRule {
+			denies = append(denies, rule)
+		} else {
+			others = append(others, rule)
+			byName[rule.Head.Name] = append(byName[rule.Head.Name], rule)
+		}
+	}
+
+	denials := []RegoDenial{}
+	query := fmt.Sprintf("%v.%v", parsed.Package.Path, denyRule)
+	for _, rule := range denies {
+		single := parsed.Copy()
+		single.Rules = append(append([]*ast.Rule{}, others...), rule.Copy())
+		rs, err := rego.New(rego.Query(query), rego.ParsedModule(single), rego.Input(input)).Eval(context.Background())
+		if err != nil {
+			return fail(err)
+		}
+
+		for _, result := range rs {
+			for _, expression := range result.Expressions {
+				messages, ok := expression.Value.([]interface{})
+				if !ok {
+					messages = []interface{}{fmt.Sprintf("deny must be a set of messages, as in deny[msg], but is %v", expression.Value)}
+				}
+
+				for _, message := range messages {
+					denials = append(denials, RegoDenial{
+						Module:  module.Name,
+						Line:    rule.Location.Row,
+						Message: fmt.Sprint(message),
+						Fields:  inputFields(rule, byName),
+					})
+				}
+			}
+		}
+	}
+
+	return denials
+}
+
+// inputFields returns the paths into the input that rule reads, including through the other rules of the module it
+// refers to, with wildcards written as [_].
+func inputFields(rule *ast.Rule, rules map[ast.Var][]*ast.Rule) []string {
+	fields := make(map[string]struct{})
+	visited := map[*ast.Rule]struct{}{}
+	var walk func(*ast.Rule)
+	walk = func(rule *ast.Rule) {
+		if _, ok := visited[rule]; ok {
+			return
+		}
+
+		visited[rule] = struct{}{}
+		ast.WalkRefs(rule, func(ref ast.Ref) bool {
+			if ref.HasPrefix(ast.InputRootRef) {
+				fields[inputPath(ref)] = struct{}{}
+			}
+
+			return false
+		})
+
+		ast.WalkVars(rule.Body, func(v ast.Var) bool {
+			for _, referenced := range rules[v] {
+				walk(referenced)
+			}
+
+			return false
+		})
+	}
+
+	walk(rule)
+	sorted := make([]string, 0, len(fields))
+	for field := range fields {
+		sorted = append(sorted, field)
+	}
+
+	sort.Strings(sorted)
+	return sorted
+}
+
+func inputPath(ref ast.Ref) string {
+	var sb strings.Builder
+	sb.WriteString("input")
+	for _, term := range ref[1:] {
+		switch value := term.Value.(type) {
+		case ast.String:
+			if identifierPattern.MatchString(string(value)) {
+				sb.WriteString("." + string(value))
+			} else {
+				sb.WriteString("[" + value.String() + "]")
+			}
+		case ast.Var:
+			if value.IsWildcard() {
+				sb.WriteString("[_]")
+			} else {
+				sb.WriteString("[" + string(value) + "]")
+			}
+		default:
+			sb.WriteString("[" + term.String() + "]")
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation/commandrun"
+	"github.com/testifysec/go-witness/policy"
+)
+
+const exitCodeModule = `package commandrun.exitcode
+
+deny[msg] {
+	input.exitcode != 0
+	msg := sprintf("command exited with %v", [input.exitcode])
+}
+
+deny[msg] {
+	not allowed_shell
+	msg := "command was not run with bash"
+}
+
+deny[msg] {
+	input.cmd[_] == "--insecure"
+	msg := "command was run with --insecure"
+}
+
+allowed_shell {
+	input.cmd[0] == "bash"
+}
+`
+
+func TestEvaluateModule(t *testing.T) {
+	module := policy.RegoPolicy{Name: "exitcode.rego", Module: []byte(exitCodeModule)}
+	run := &commandrun.CommandRun{Cmd: []string{"sh", "-c", "exit 1"}, ExitCode: 1}
+
+	require.Equal(t, []RegoDenial{
+		{Module: "exitcode.rego", Line: 3, Message: "command exited with 1", Fields: []string{"input.exitcode"}},
+		{Module: "exitcode.rego", Line: 8, Message: "command was not run with bash", Fields: []string{"input.cmd[0]"}},
+	}, evaluateModule(module, run))
+
+	require.Empty(t, evaluateModule(module, &commandrun.CommandRun{Cmd: []string{"bash", "-c", "true"}}))
+	require.Equal(t, []RegoDenial{
+		{Module: "exitcode.rego", Line: 13, Message: "command was run with --insecure", Fields: []string{"input.cmd[_]"}},
+	}, evaluateModule(module, &commandrun.CommandRun{Cmd: []string{"bash", "--insecure"}}))
+}
+
+func TestEvaluateModuleInvalid(t *testing.T) {
+	denials := evaluateModule(policy.RegoPolicy{Name: "bool.rego", Module: []byte("package bool\n\ndeny {\n\tinput.exitcode != 0\n}\n")}, &commandrun.CommandRun{ExitCode: 2})
+	require.Len(t, denials, 1)
+	require.Contains(t, denials[0].Message, "deny must be a set of messages, as in deny[msg]")
+
+	denials = evaluateModule(policy.RegoPolicy{Name: "broken.rego", Module: []byte("package broken\n\ndeny[msg] {")}, &commandrun.CommandRun{})
+	require.Len(t, denials, 1)
+	require.Equal(t, 0, denials[0].Line)
+}
+
+func TestRegoDenialString(t *testing.T) {
+	denial := RegoDenial{
+		Step:        "build",
+		Attestation: commandrun.Type,
+		Reference:   "build.json",
+		Module:      "exitcode.rego",
+		Line:        3,
+		Message:     "command exited with 1",
+		Fields:      []string{"input.exitcode"},
+	}
+
+	require.Equal(t, "step build: exitcode.rego:3 denied https://witness.dev/attestations/command-run/v0.1 in build.json: command exited with 1 (reads input.exitcode)", denial.String())
+}
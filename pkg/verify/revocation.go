@@ -0,0 +1,221 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/previousstep"
+	"github.com/testifysec/witness/pkg/bundle"
+)
+
+// RevocationsType is the payload type of signed revocation lists.
+const RevocationsType = "https://witness.dev/revocations/v0.1"
+
+// Revocations lists attestations and subjects that must no longer be accepted as evidence, so a compromised build
+// can be retracted without rotating the keys that signed it. Attestations are identified by the gitoid of their
+// envelope as it is stored, which Archivista stores it under, or the sha256 digest of their payload.
+type Revocations struct {
+	Attestations []string `json:"attestations,omitempty"`
+	Subjects     []string `json:"subjects,omitempty"`
+	Reason       string   `json:"reason,omitempty"`
+}
+
+// revocationList holds the reason each attestation or subject digest was revoked for.
+type revocationList struct {
+	attestations map[string]string
+	subjects     map[string]string
+	stored       *StoredEnvelopes
+}
+
+// StoredEnvelopes records the gitoids of the bytes envelopes were read from. Sources only return decoded envelopes,
+// and an envelope's gitoid depends on how it was encoded when it was stored, so revocations by gitoid are matched
+// against the gitoids recorded here.
+type StoredEnvelopes struct {
+	mu      sync.Mutex
+	gitoids map[string][]string
+}
+
+func NewStoredEnvelopes() *StoredEnvelopes {
+	return &StoredEnvelopes{gitoids: make(map[string][]string)}
+}
+
+// Add records the gitoid of data, a signed envelope as it was stored.
+func (s *StoredEnvelopes) Add(data []byte) error {
+	env, err := bundle.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	digest, err := EnvelopeDigest(env)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gitoids[digest] = append(s.gitoids[digest], previousstep.GitOID(data))
+	return nil
+}
+
+// GitOIDs returns the gitoids of the bytes env was read from.
+func (s *StoredEnvelopes) GitOIDs(env dsse.Envelope) []string {
+	if s == nil {
+		return nil
+	}
+
+	digest, err := EnvelopeDigest(env)
+	if err != nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.gitoids[digest]...)
+}
+
+// revocations reads the revocation lists in envelopes, which must be signed by the policy signer or one of the
+// policy's revocation signers, the ids of policy public keys.
+func (pe policyExtensions) revocations(envelopes []dsse.Envelope, policyVerifiers []cryptoutil.Verifier, pubKeysByID map[string]cryptoutil.Verifier) (revocationList, error) {
+	verifiers := make([]cryptoutil.Verifier, 0, len(policyVerifiers)+len(pe.RevocationSigners))
+	for _, verifier := range policyVerifiers {
+		if verifier != nil {
+			verifiers = append(verifiers, verifier)
+		}
+	}
+
+	for _, keyID := range pe.RevocationSigners {
+		verifier, ok := pubKeysByID[keyID]
+		if !ok {
+			return revocationList{}, fmt.Errorf("revocation signer %v is not a public key in the policy", keyID)
+		}
+
+		verifiers = append(verifiers, verifier)
+	}
+
+	return loadRevocations(envelopes, verifiers)
+}
+
+// loadRevocations reads the revocation lists in envelopes, after checking that each is signed by one of verifiers.
+// Lists that aren't are rejected rather than ignored, since dropping a revocation would accept retracted evidence.
+func loadRevocations(envelopes []dsse.Envelope, verifiers []cryptoutil.Verifier) (revocationList, error) {
+	revoked := revocationList{attestations: make(map[string]string), subjects: make(map[string]string)}
+	for i, env := range envelopes {
+		if env.PayloadType != RevocationsType {
+			return revoked, fmt.Errorf("revocation list %v has payload type %v, expected %v", i+1, env.PayloadType, RevocationsType)
+		}
+
+		if _, err := env.Verify(dsse.VerifyWithVerifiers(verifiers...)); err != nil {
+			return revoked, fmt.Errorf("revocation list %v is not signed by the policy signer or a revocation signer: %w", i+1, err)
+		}
+
+		revocations := Revocations{}
+		if err := json.Unmarshal(env.Payload, &revocations); err != nil {
+			return revoked, fmt.Errorf("failed to parse revocation list %v: %w", i+1, err)
+		}
+
+		for _, digest := range revocations.Attestations {
+			revoked.attestations[digest] = revocations.Reason
+		}
+
+		for _, digest := range revocations.Subjects {
+			revoked.subjects[digest] = revocations.Reason
+		}
+	}
+
+	return revoked, nil
+}
+
+func (rl revocationList) empty() bool {
+	return len(rl.attestations) == 0 && len(rl.subjects) == 0
+}
+
+// checkSubjects fails if any of the subjects being verified is revoked.
+func (rl revocationList) checkSubjects(subjectDigests []string) error {
+	for _, digest := range subjectDigests {
+		if reason, ok := rl.subjects[digest]; ok {
+			return fmt.Errorf("subject %v is revoked%v", digest, describeReason(reason))
+		}
+	}
+
+	return nil
+}
+
+// revokedCollection reports why a collection is revoked, either because its envelope is or because one of its
+// subjects is.
+func (rl revocationList) revokedCollection(collection source.CollectionEnvelope) (string, bool) {
+	digests := []string{collection.Reference}
+	payloadDigest := sha256.Sum256(collection.Envelope.Payload)
+	digests = append(digests, hex.EncodeToString(payloadDigest[:]))
+	digests = append(digests, rl.stored.GitOIDs(collection.Envelope)...)
+
+	for _, digest := range digests {
+		if reason, ok := rl.attestations[digest]; ok {
+			return fmt.Sprintf("attestation %v is revoked%v", digest, describeReason(reason)), true
+		}
+	}
+
+	for _, subject := range collection.Statement.Subject {
+		for _, digest := range subject.Digest {
+			if reason, ok := rl.subjects[digest]; ok {
+				return fmt.Sprintf("subject %v is revoked%v", subject.Name, describeReason(reason)), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func describeReason(reason string) string {
+	if reason == "" {
+		return ""
+	}
+
+	return ": " + reason
+}
+
+// revokedSource drops revoked collections from the results of a source, so they never count as evidence.
+type revokedSource struct {
+	source  source.Sourcer
+	revoked revocationList
+}
+
+func (s revokedSource) Search(ctx context.Context, collectionName string, subjectDigests, attestations []string) ([]source.CollectionEnvelope, error) {
+	found, err := s.source.Search(ctx, collectionName, subjectDigests, attestations)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]source.CollectionEnvelope, 0, len(found))
+	for _, collection := range found {
+		if why, ok := s.revoked.revokedCollection(collection); ok {
+			log.Warnf("skipping %v: %v", collection.Reference, why)
+			continue
+		}
+
+		kept = append(kept, collection)
+	}
+
+	return kept, nil
+}
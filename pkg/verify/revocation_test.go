@@ -0,0 +1,106 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/previousstep"
+)
+
+type staticSource []source.CollectionEnvelope
+
+func (s staticSource) Search(ctx context.Context, collectionName string, subjectDigests, attestations []string) ([]source.CollectionEnvelope, error) {
+	return s, nil
+}
+
+func TestRevocations(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := cryptoutil.NewECDSASigner(key, crypto.SHA256)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	keyID, err := verifier.KeyID()
+	require.NoError(t, err)
+
+	payload := []byte(`{"_type":"https://in-toto.io/Statement/v0.1"}`)
+	payloadDigest := sha256.Sum256(payload)
+	// stored as formatted by another tool, so its gitoid differs from that of the envelope marshaled again
+	storedEnvelope := dsse.Envelope{Payload: []byte(`{"stored":true}`), PayloadType: intoto.PayloadType}
+	storedBytes, err := json.MarshalIndent(storedEnvelope, "", "  ")
+	require.NoError(t, err)
+	stored := NewStoredEnvelopes()
+	require.NoError(t, stored.Add(append(storedBytes, '\n')))
+	revocations, err := json.Marshal(Revocations{
+		Attestations: []string{hex.EncodeToString(payloadDigest[:]), "build.json", previousstep.GitOID(append(storedBytes, '\n'))},
+		Subjects:     []string{"bbbb"},
+		Reason:       "build runner was compromised",
+	})
+	require.NoError(t, err)
+	signed, err := dsse.Sign(RevocationsType, bytes.NewReader(revocations), dsse.SignWithSigners(signer))
+	require.NoError(t, err)
+
+	pe := policyExtensions{RevocationSigners: []string{keyID}}
+	revoked, err := pe.revocations([]dsse.Envelope{signed}, nil, map[string]cryptoutil.Verifier{keyID: verifier})
+	require.NoError(t, err)
+
+	// the policy signer is trusted to revoke without being a revocation signer
+	_, err = policyExtensions{}.revocations([]dsse.Envelope{signed}, []cryptoutil.Verifier{nil, verifier}, nil)
+	require.NoError(t, err)
+
+	_, err = policyExtensions{}.revocations([]dsse.Envelope{signed}, nil, nil)
+	require.ErrorContains(t, err, "not signed by the policy signer or a revocation signer")
+
+	_, err = pe.revocations([]dsse.Envelope{signed}, nil, nil)
+	require.ErrorContains(t, err, "not a public key in the policy")
+
+	unsigned, err := dsse.Sign(intoto.PayloadType, bytes.NewReader(revocations), dsse.SignWithSigners(signer))
+	require.NoError(t, err)
+	_, err = pe.revocations([]dsse.Envelope{unsigned}, nil, map[string]cryptoutil.Verifier{keyID: verifier})
+	require.ErrorContains(t, err, "expected "+RevocationsType)
+
+	require.NoError(t, revoked.checkSubjects([]string{"aaaa"}))
+	require.ErrorContains(t, revoked.checkSubjects([]string{"aaaa", "bbbb"}), "build runner was compromised")
+	revoked.stored = stored
+
+	good := source.CollectionEnvelope{Reference: "test.json", Envelope: dsse.Envelope{Payload: []byte(`{}`)}}
+	byReference := source.CollectionEnvelope{Reference: "build.json", Envelope: dsse.Envelope{Payload: []byte(`{}`)}}
+	byPayload := source.CollectionEnvelope{Reference: "copy.json", Envelope: dsse.Envelope{Payload: payload}}
+	bySubject := source.CollectionEnvelope{
+		Reference: "package.json",
+		Envelope:  dsse.Envelope{Payload: []byte(`{}`)},
+		Statement: intoto.Statement{Subject: []intoto.Subject{{Name: "app", Digest: map[string]string{"sha256": "bbbb"}}}},
+	}
+
+	byGitOID := source.CollectionEnvelope{Reference: "stored.json", Envelope: storedEnvelope}
+
+	kept, err := revokedSource{source: staticSource{good, byReference, byPayload, bySubject, byGitOID}, revoked: revoked}.Search(context.Background(), "build", nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []source.CollectionEnvelope{good}, kept)
+}
@@ -0,0 +1,345 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/sbom"
+	"golang.org/x/mod/semver"
+)
+
+// sbomConstraints restrict the packages described by the SBOMs a step produced, as recorded by the sbom attestor.
+type sbomConstraints struct {
+	// Deny lists packages that must not appear in any SBOM.
+	Deny []packageMatcher `json:"deny,omitempty"`
+	// AllowedLicenses is the set of licenses packages may be distributed under. Packages without a license
+	// violate the constraint when it is set.
+	AllowedLicenses []string `json:"allowedLicenses,omitempty"`
+	// RequireDigests requires every package to have at least one checksum.
+	RequireDigests bool `json:"requireDigests,omitempty"`
+}
+
+// packageMatcher matches packages by name, version, and purl. Every field that is set must match. Name and PURL
+// are patterns where * matches any characters. Version is an exact version, a pattern, or space separated
+// comparisons such as ">=2.0.0 <2.17.1", which only match semantic versions.
+type packageMatcher struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+	PURL    string `json:"purl,omitempty"`
+}
+
+func (pe policyExtensions) sboms() map[string]sbomConstraints {
+	constraints := make(map[string]sbomConstraints)
+	for key, step := range pe.Steps {
+		if step.SBOM == nil {
+			continue
+		}
+
+		constraints[stepName(key, step)] = *step.SBOM
+	}
+
+	return constraints
+}
+
+// verifySBOMs removes collections whose SBOMs violate the constraints of their step.
+func verifySBOMs(accepted map[string][]source.VerifiedCollection, constraints map[string]sbomConstraints) (map[string][]source.VerifiedCollection, error) {
+	result := make(map[string][]source.VerifiedCollection, len(accepted))
+	for step, collections := range accepted {
+		result[step] = collections
+	}
+
+	for step, constraint := range constraints {
+		kept := make([]source.VerifiedCollection, 0, len(result[step]))
+		var lastErr error
+		for _, collection := range result[step] {
+			if err := constraint.check(collection); err != nil {
+				lastErr = fmt.Errorf("%v: %w", collection.Reference, err)
+				continue
+			}
+
+			kept = append(kept, collection)
+		}
+
+		if len(kept) == 0 {
+			if lastErr == nil {
+				lastErr = errors.New("no evidence")
+			}
+
+			return nil, fmt.Errorf("no evidence for step %v has an sbom that meets the policy: %w", step, lastErr)
+		}
+
+		result[step] = kept
+	}
+
+	return result, nil
+}
+
+func (sc sbomConstraints) check(collection source.VerifiedCollection) error {
+	documents := sbom.FromCollection(collection.Collection)
+	if len(documents) == 0 {
+		return errors.New("evidence does not record an sbom")
+	}
+
+	for path, document := range documents {
+		components, err := document.Components()
+		if err != nil {
+			return fmt.Errorf("failed to parse sbom %v: %w", path, err)
+		}
+
+		for _, component := range components {
+			if err := sc.checkComponent(component); err != nil {
+				return fmt.Errorf("sbom %v: package %v: %w", path, componentName(component), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (sc sbomConstraints) checkComponent(component sbom.Component) error {
+	for _, matcher := range sc.Deny {
+		matched, err := matcher.matches(component)
+		if err != nil {
+			return err
+		}
+
+		if matched {
+			return errors.New("is denied by the policy")
+		}
+	}
+
+	if len(sc.AllowedLicenses) > 0 {
+		if component.License == "" {
+			return errors.New("does not declare a license")
+		}
+
+		allowed, err := licenseAllowed(component.License, sc.AllowedLicenses)
+		if err != nil {
+			return err
+		}
+
+		if !allowed {
+			return fmt.Errorf("license %v is not allowed", component.License)
+		}
+	}
+
+	if sc.RequireDigests && len(component.Digests) == 0 {
+		return errors.New("has no digest")
+	}
+
+	return nil
+}
+
+func (pm packageMatcher) matches(component sbom.Component) (bool, error) {
+	if pm.Name == "" && pm.Version == "" && pm.PURL == "" {
+		return false, errors.New("deny entries must set a name, version, or purl")
+	}
+
+	if pm.Name != "" && !globMatch(pm.Name, component.Name) {
+		return false, nil
+	}
+
+	if pm.PURL != "" && !globMatch(pm.PURL, component.PURL) {
+		return false, nil
+	}
+
+	if pm.Version == "" {
+		return true, nil
+	}
+
+	return versionMatches(pm.Version, component.Version)
+}
+
+func componentName(component sbom.Component) string {
+	if component.Version == "" {
+		return component.Name
+	}
+
+	return component.Name + "@" + component.Version
+}
+
+// globMatch reports whether value matches pattern, where * matches any characters including /.
+func globMatch(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$").MatchString(value)
+}
+
+// versionMatches reports whether version satisfies constraint. Constraints without comparison operators are
+// patterns matched against the version as is.
+func versionMatches(constraint, version string) (bool, error) {
+	if !strings.ContainsAny(constraint, "<>=") {
+		return globMatch(constraint, version), nil
+	}
+
+	canonical := canonicalVersion(version)
+	if !semver.IsValid(canonical) {
+		return false, nil
+	}
+
+	for _, comparison := range strings.Fields(constraint) {
+		op := strings.TrimRight(comparison, "v0123456789.-+abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+		bound := canonicalVersion(strings.TrimPrefix(comparison, op))
+		if !semver.IsValid(bound) {
+			return false, fmt.Errorf("version constraint %v: %v is not a semantic version", constraint, bound)
+		}
+
+		cmp := semver.Compare(canonical, bound)
+		var ok bool
+		switch op {
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "=", "==":
+			ok = cmp == 0
+		default:
+			return false, fmt.Errorf("version constraint %v: unknown comparison %v", constraint, op)
+		}
+
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// licenseAllowed evaluates an SPDX license expression, treating each license in allowed as satisfied. A license
+// with an exception, such as GPL-2.0-only WITH Classpath-exception-2.0, is satisfied if allowed lists it either
+// with or without the exception.
+func licenseAllowed(expression string, allowed []string) (bool, error) {
+	allowedSet := make(map[string]struct{}, len(allowed))
+	for _, license := range allowed {
+		allowedSet[strings.ToLower(license)] = struct{}{}
+	}
+
+	tokens := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expression))
+	p := &licenseParser{tokens: tokens, allowed: allowedSet}
+	result, err := p.or()
+	if err != nil {
+		return false, fmt.Errorf("invalid license expression %v: %w", expression, err)
+	}
+
+	if p.pos != len(p.tokens) {
+		return false, fmt.Errorf("invalid license expression %v: unexpected %v", expression, p.tokens[p.pos])
+	}
+
+	return result, nil
+}
+
+type licenseParser struct {
+	tokens  []string
+	pos     int
+	allowed map[string]struct{}
+}
+
+func (p *licenseParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *licenseParser) or() (bool, error) {
+	result, err := p.and()
+	if err != nil {
+		return false, err
+	}
+
+	for strings.EqualFold(p.peek(), "OR") {
+		p.pos++
+		next, err := p.and()
+		if err != nil {
+			return false, err
+		}
+
+		result = result || next
+	}
+
+	return result, nil
+}
+
+func (p *licenseParser) and() (bool, error) {
+	result, err := p.term()
+	if err != nil {
+		return false, err
+	}
+
+	for strings.EqualFold(p.peek(), "AND") {
+		p.pos++
+		next, err := p.term()
+		if err != nil {
+			return false, err
+		}
+
+		result = result && next
+	}
+
+	return result, nil
+}
+
+func (p *licenseParser) term() (bool, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return false, errors.New("unexpected end of expression")
+	case token == "(":
+		p.pos++
+		result, err := p.or()
+		if err != nil {
+			return false, err
+		}
+
+		if p.peek() != ")" {
+			return false, errors.New("missing )")
+		}
+
+		p.pos++
+		return result, nil
+	case token == ")" || strings.EqualFold(token, "AND") || strings.EqualFold(token, "OR") || strings.EqualFold(token, "WITH"):
+		return false, fmt.Errorf("unexpected %v", token)
+	}
+
+	p.pos++
+	license := strings.ToLower(token)
+	_, ok := p.allowed[license]
+	if strings.EqualFold(p.peek(), "WITH") {
+		p.pos++
+		exception := p.peek()
+		if exception == "" {
+			return false, errors.New("missing exception after WITH")
+		}
+
+		p.pos++
+		_, withException := p.allowed[license+" with "+strings.ToLower(exception)]
+		ok = ok || withException
+	}
+
+	return ok, nil
+}
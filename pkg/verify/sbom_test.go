@@ -0,0 +1,121 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/sbom"
+)
+
+func sbomCollection(t *testing.T, ref string, components ...map[string]interface{}) source.VerifiedCollection {
+	document, err := json.Marshal(map[string]interface{}{"bomFormat": "CycloneDX", "components": components})
+	require.NoError(t, err)
+	data, err := json.Marshal(map[string]sbom.Document{"bom.json": {Format: sbom.FormatCycloneDX, Document: document}})
+	require.NoError(t, err)
+	a := sbom.New()
+	require.NoError(t, json.Unmarshal(data, a))
+	return source.VerifiedCollection{
+		CollectionEnvelope: source.CollectionEnvelope{
+			Reference:  ref,
+			Collection: attestation.Collection{Attestations: []attestation.CollectionAttestation{{Type: sbom.Type, Attestation: a}}},
+		},
+	}
+}
+
+func component(name, version, purl, license string, hashed bool) map[string]interface{} {
+	c := map[string]interface{}{"name": name, "version": version, "purl": purl}
+	if license != "" {
+		c["licenses"] = []interface{}{map[string]interface{}{"expression": license}}
+	}
+
+	if hashed {
+		c["hashes"] = []interface{}{map[string]interface{}{"alg": "SHA-256", "content": "abcd"}}
+	}
+
+	return c
+}
+
+func TestVerifySBOMs(t *testing.T) {
+	vulnerable := sbomCollection(t, "vulnerable", component("log4j-core", "2.14.1", "pkg:maven/org.apache.logging.log4j/log4j-core@2.14.1", "Apache-2.0", true))
+	patched := sbomCollection(t, "patched", component("log4j-core", "2.17.1", "pkg:maven/org.apache.logging.log4j/log4j-core@2.17.1", "Apache-2.0", true))
+	accepted := map[string][]source.VerifiedCollection{"build": {vulnerable, patched}, "test": nil}
+
+	constraints := map[string]sbomConstraints{"build": {Deny: []packageMatcher{{Name: "log4j-core", Version: ">=2.0.0 <2.17.1"}}}}
+	result, err := verifySBOMs(accepted, constraints)
+	require.NoError(t, err)
+	require.Len(t, result["build"], 1)
+	require.Equal(t, "patched", result["build"][0].Reference)
+
+	constraints = map[string]sbomConstraints{"build": {Deny: []packageMatcher{{PURL: "pkg:maven/org.apache.logging.log4j/*"}}}}
+	_, err = verifySBOMs(accepted, constraints)
+	require.ErrorContains(t, err, "is denied by the policy")
+
+	unhashed := sbomCollection(t, "unhashed", component("left-pad", "1.3.0", "pkg:npm/left-pad@1.3.0", "WTFPL", false))
+	_, err = verifySBOMs(map[string][]source.VerifiedCollection{"build": {unhashed}}, map[string]sbomConstraints{"build": {RequireDigests: true}})
+	require.ErrorContains(t, err, "has no digest")
+
+	_, err = verifySBOMs(map[string][]source.VerifiedCollection{"build": {unhashed}}, map[string]sbomConstraints{"build": {AllowedLicenses: []string{"MIT"}}})
+	require.ErrorContains(t, err, "license WTFPL is not allowed")
+
+	_, err = verifySBOMs(map[string][]source.VerifiedCollection{"build": {{}}}, map[string]sbomConstraints{"build": {RequireDigests: true}})
+	require.ErrorContains(t, err, "does not record an sbom")
+}
+
+func TestVersionMatches(t *testing.T) {
+	for constraint, versions := range map[string]map[string]bool{
+		"2.14.1":          {"2.14.1": true, "2.14.10": false},
+		"2.*":             {"2.14.1": true, "1.0": false},
+		"<2.17.1":         {"2.17.0": true, "v2.17.1": false, "2.17.0.Final": false},
+		">=1.0.0 <=1.2.0": {"1.2.0": true, "1.2.1": false, "0.9.0": false},
+	} {
+		for version, expected := range versions {
+			matched, err := versionMatches(constraint, version)
+			require.NoError(t, err)
+			require.Equal(t, expected, matched, "%v %v", constraint, version)
+		}
+	}
+
+	_, err := versionMatches(">=latest", "1.0.0")
+	require.ErrorContains(t, err, "not a semantic version")
+}
+
+func TestLicenseAllowed(t *testing.T) {
+	allowed := []string{"MIT", "Apache-2.0", "GPL-2.0-only WITH Classpath-exception-2.0"}
+	for expression, expected := range map[string]bool{
+		"MIT":                   true,
+		"mit":                   true,
+		"GPL-3.0-only":          false,
+		"MIT OR GPL-3.0-only":   true,
+		"MIT AND GPL-3.0-only":  false,
+		"(MIT AND Apache-2.0)":  true,
+		"GPL-3.0-only OR (MIT)": true,
+		"GPL-2.0-only WITH Classpath-exception-2.0": true,
+		"GPL-2.0-only WITH LLVM-exception":          false,
+	} {
+		ok, err := licenseAllowed(expression, allowed)
+		require.NoError(t, err)
+		require.Equal(t, expected, ok, expression)
+	}
+
+	_, err := licenseAllowed("(MIT", allowed)
+	require.ErrorContains(t, err, "missing )")
+	_, err = licenseAllowed("MIT OR", allowed)
+	require.ErrorContains(t, err, "unexpected end")
+}
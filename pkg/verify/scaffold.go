@@ -0,0 +1,443 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/material"
+	"github.com/testifysec/go-witness/attestation/product"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/policy"
+)
+
+// Scaffold holds the trust a policy is scaffolded with. The signatures of example attestations are verified against
+// its public keys and roots to infer who may perform each step.
+type Scaffold struct {
+	// PublicKeys are PEM encoded public keys that may have signed the examples.
+	PublicKeys [][]byte
+	// Roots are PEM encoded CA certificates that may have issued the certificates the examples were signed with.
+	Roots   [][]byte
+	Expires time.Time
+}
+
+// scaffoldStep is what the examples of a step have in common.
+type scaffoldStep struct {
+	attestations  map[string]bool
+	functionaries []policy.Functionary
+	materials     map[string]bool
+	products      map[string]bool
+}
+
+// Policy scaffolds a policy from example attestations, such as those recorded by a known good run of a pipeline.
+// Each collection name becomes a step that requires the attestation types recorded by all of its examples. Steps
+// are performed by the public keys and certificate identities whose signatures on their examples verify, and take
+// their artifacts from the steps whose products they used as materials. The policy is returned unsigned, to be
+// reviewed and then signed.
+func (s Scaffold) Policy(envelopes []dsse.Envelope) ([]byte, error) {
+	if len(envelopes) == 0 {
+		return nil, fmt.Errorf("at least one example attestation is required")
+	}
+
+	pol := policy.Policy{
+		Expires:    s.Expires,
+		Roots:      map[string]policy.Root{},
+		PublicKeys: map[string]policy.PublicKey{},
+		Steps:      map[string]policy.Step{},
+	}
+
+	publicKeys := map[string][]byte{}
+	verifiers := map[string]cryptoutil.Verifier{}
+	for _, key := range s.PublicKeys {
+		verifier, err := cryptoutil.NewVerifierFromReader(bytes.NewReader(key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load public key: %w", err)
+		}
+
+		keyID, err := verifier.KeyID()
+		if err != nil {
+			return nil, err
+		}
+
+		publicKeys[keyID] = key
+		verifiers[keyID] = verifier
+	}
+
+	roots := map[string]*x509.Certificate{}
+	rootPEMs := map[string][]byte{}
+	for _, rootPEM := range s.Roots {
+		cert, err := parsePEMCertificate(rootPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load root: %w", err)
+		}
+
+		verifier, err := cryptoutil.NewVerifierFromReader(bytes.NewReader(rootPEM))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load root: %w", err)
+		}
+
+		rootID, err := verifier.KeyID()
+		if err != nil {
+			return nil, err
+		}
+
+		roots[rootID] = cert
+		rootPEMs[rootID] = rootPEM
+	}
+
+	steps := map[string]*scaffoldStep{}
+	for i, env := range envelopes {
+		name, types, materials, products, err := readExample(env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read example attestation %v: %w", i+1, err)
+		}
+
+		step, ok := steps[name]
+		if !ok {
+			step = &scaffoldStep{attestations: types, materials: map[string]bool{}, products: map[string]bool{}}
+			steps[name] = step
+		}
+
+		// only the attestation types every example of a step recorded are required
+		for attestationType := range step.attestations {
+			if !types[attestationType] {
+				delete(step.attestations, attestationType)
+			}
+		}
+
+		for digest := range materials {
+			step.materials[digest] = true
+		}
+
+		for digest := range products {
+			step.products[digest] = true
+		}
+
+		pae := preauthEncode(env.PayloadType, env.Payload)
+		for _, sig := range env.Signatures {
+			functionary, usedRoot, ok := signatureFunctionary(sig, pae, verifiers, roots)
+			if !ok {
+				log.Warnf("signature of key %v on an example of %v doesn't verify against any of the given public keys or roots", sig.KeyID, name)
+				continue
+			}
+
+			if functionary.PublicKeyID != "" {
+				pol.PublicKeys[functionary.PublicKeyID] = policy.PublicKey{KeyID: functionary.PublicKeyID, Key: publicKeys[functionary.PublicKeyID]}
+			}
+
+			if usedRoot != "" {
+				pol.Roots[usedRoot] = policy.Root{Certificate: rootPEMs[usedRoot]}
+			}
+
+			step.functionaries = appendFunctionary(step.functionaries, functionary)
+		}
+	}
+
+	for name, step := range steps {
+		if len(step.functionaries) == 0 {
+			return nil, fmt.Errorf("no example of %v has a valid signature by one of the given public keys or a certificate issued by one of the given roots", name)
+		}
+
+		policyStep := policy.Step{Name: name, Functionaries: step.functionaries, Attestations: []policy.Attestation{}}
+		types := make([]string, 0, len(step.attestations))
+		for attestationType := range step.attestations {
+			types = append(types, attestationType)
+		}
+
+		sort.Strings(types)
+		for _, attestationType := range types {
+			policyStep.Attestations = append(policyStep.Attestations, policy.Attestation{Type: attestationType, RegoPolicies: []policy.RegoPolicy{}})
+		}
+
+		for otherName, other := range steps {
+			if otherName != name && sharesDigest(step.materials, other.products) {
+				policyStep.ArtifactsFrom = append(policyStep.ArtifactsFrom, otherName)
+			}
+		}
+
+		sort.Strings(policyStep.ArtifactsFrom)
+		pol.Steps[name] = policyStep
+	}
+
+	return json.MarshalIndent(pol, "", "  ")
+}
+
+// readExample returns the step an example attestation was recorded for, its attestation types, and the digests of its
+// materials and products.
+func readExample(env dsse.Envelope) (string, map[string]bool, map[string]bool, map[string]bool, error) {
+	statement := intoto.Statement{}
+	if err := json.Unmarshal(env.Payload, &statement); err != nil {
+		return "", nil, nil, nil, err
+	}
+
+	if statement.PredicateType != attestation.CollectionType {
+		return "", nil, nil, nil, fmt.Errorf("predicate type %v is not an attestation collection", statement.PredicateType)
+	}
+
+	collection := struct {
+		Name         string `json:"name"`
+		Attestations []struct {
+			Type        string          `json:"type"`
+			Attestation json.RawMessage `json:"attestation"`
+		} `json:"attestations"`
+	}{}
+
+	if err := json.Unmarshal(statement.Predicate, &collection); err != nil {
+		return "", nil, nil, nil, err
+	}
+
+	if collection.Name == "" {
+		return "", nil, nil, nil, fmt.Errorf("collection has no name")
+	}
+
+	types := map[string]bool{}
+	materials := map[string]bool{}
+	for _, a := range collection.Attestations {
+		types[a.Type] = true
+		if a.Type == material.Type {
+			for digest := range materialDigests(a.Attestation) {
+				materials[digest] = true
+			}
+		}
+	}
+
+	products := map[string]bool{}
+	for _, subject := range statement.Subject {
+		if !strings.HasPrefix(subject.Name, product.Type+"/") {
+			continue
+		}
+
+		for _, digest := range subject.Digest {
+			products[digest] = true
+		}
+	}
+
+	return collection.Name, types, materials, products, nil
+}
+
+// materialDigests returns the digests of the files a material attestation recorded. Files recorded by reference to a
+// content table are skipped, so only steps whose materials are recorded in full are linked to their producers.
+func materialDigests(data json.RawMessage) map[string]bool {
+	files := map[string]json.RawMessage{}
+	digests := map[string]bool{}
+	if err := json.Unmarshal(data, &files); err != nil {
+		return digests
+	}
+
+	for _, file := range files {
+		digestSet := map[string]string{}
+		if err := json.Unmarshal(file, &digestSet); err != nil {
+			continue
+		}
+
+		for _, digest := range digestSet {
+			digests[digest] = true
+		}
+	}
+
+	return digests
+}
+
+// signatureFunctionary returns the functionary that made sig over pae, along with the id of the root its
+// certificate chains to if it was made with a certificate. The signature itself is verified, so examples can't be
+// altered, or claim a signer they weren't signed by, to widen the policy.
+func signatureFunctionary(sig dsse.Signature, pae []byte, verifiers map[string]cryptoutil.Verifier, roots map[string]*x509.Certificate) (policy.Functionary, string, bool) {
+	if len(sig.Certificate) == 0 {
+		if verifier, ok := verifiers[sig.KeyID]; ok && verifier.Verify(bytes.NewReader(pae), sig.Signature) == nil {
+			return policy.Functionary{Type: "PublicKey", PublicKeyID: sig.KeyID}, "", true
+		}
+
+		return policy.Functionary{}, "", false
+	}
+
+	leaf, err := parsePEMCertificate(sig.Certificate)
+	if err != nil {
+		return policy.Functionary{}, "", false
+	}
+
+	intermediates := make([]*x509.Certificate, 0, len(sig.Intermediates))
+	for _, intermediate := range sig.Intermediates {
+		if cert, err := parsePEMCertificate(intermediate); err == nil {
+			intermediates = append(intermediates, cert)
+		}
+	}
+
+	rootIDs := make([]string, 0, len(roots))
+	for rootID := range roots {
+		rootIDs = append(rootIDs, rootID)
+	}
+
+	sort.Strings(rootIDs)
+	for _, rootID := range rootIDs {
+		// short lived certificates, such as those issued by Fulcio, have usually expired by the time a policy is
+		// written, so the chain is checked at the time the certificate was issued
+		verifier, err := cryptoutil.NewX509Verifier(leaf, intermediates, []*x509.Certificate{roots[rootID]}, leaf.NotBefore)
+		if err != nil || verifier.Verify(bytes.NewReader(pae), sig.Signature) != nil {
+			continue
+		}
+
+		uris := make([]string, 0, len(leaf.URIs))
+		for _, uri := range leaf.URIs {
+			uris = append(uris, uri.String())
+		}
+
+		return policy.Functionary{
+			Type: "root",
+			CertConstraint: policy.CertConstraint{
+				CommonName:    leaf.Subject.CommonName,
+				DNSNames:      nonNil(leaf.DNSNames),
+				Emails:        nonNil(leaf.EmailAddresses),
+				Organizations: nonNil(leaf.Subject.Organization),
+				URIs:          uris,
+				Roots:         []string{rootID},
+			},
+		}, rootID, true
+	}
+
+	return policy.Functionary{}, "", false
+}
+
+// appendFunctionary adds functionary to functionaries unless an identical one is already there.
+func appendFunctionary(functionaries []policy.Functionary, functionary policy.Functionary) []policy.Functionary {
+	data, _ := json.Marshal(functionary)
+	for _, existing := range functionaries {
+		if existingData, _ := json.Marshal(existing); bytes.Equal(data, existingData) {
+			return functionaries
+		}
+	}
+
+	return append(functionaries, functionary)
+}
+
+func sharesDigest(a, b map[string]bool) bool {
+	for digest := range a {
+		if b[digest] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parsePEMCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
+
+// CheckPolicy checks that an unsigned policy can be verified against before it is signed, catching mistakes made
+// while editing it by hand. Rego modules are not evaluated.
+func CheckPolicy(policyJSON []byte, now time.Time) error {
+	pol := policy.Policy{}
+	if err := json.Unmarshal(policyJSON, &pol); err != nil {
+		return fmt.Errorf("failed to unmarshal policy: %w", err)
+	}
+
+	if !pol.Expires.After(now) {
+		return fmt.Errorf("policy expired at %v", pol.Expires.Format(time.RFC3339))
+	}
+
+	if len(pol.Steps) == 0 {
+		return fmt.Errorf("policy has no steps")
+	}
+
+	extensions := policyExtensions{}
+	if err := json.Unmarshal(policyJSON, &extensions); err != nil {
+		return fmt.Errorf("failed to unmarshal policy extensions: %w", err)
+	}
+
+	for keyID, key := range pol.PublicKeys {
+		if _, err := NewVerifierFromBytes(key.Key); err != nil {
+			return fmt.Errorf("failed to load public key %v: %w", keyID, err)
+		}
+	}
+
+	for rootID, root := range pol.Roots {
+		if _, err := parsePEMCertificate(root.Certificate); err != nil {
+			return fmt.Errorf("failed to load root %v: %w", rootID, err)
+		}
+	}
+
+	for name, step := range pol.Steps {
+		if step.Name != name {
+			return fmt.Errorf("step %v is named %v", name, step.Name)
+		}
+
+		// the functionaries of a delegated step come from its sub-policy
+		if delegated := extensions.Steps[name].Delegate; delegated != nil {
+			if len(delegated.Signers) == 0 {
+				return fmt.Errorf("step %v is delegated to no one", name)
+			}
+
+			for _, keyID := range delegated.Signers {
+				if _, ok := pol.PublicKeys[keyID]; !ok {
+					return fmt.Errorf("delegate %v of step %v is not a public key in the policy", keyID, name)
+				}
+			}
+		} else if len(step.Functionaries) == 0 {
+			return fmt.Errorf("step %v has no functionaries", name)
+		}
+
+		for _, functionary := range step.Functionaries {
+			if functionary.PublicKeyID != "" {
+				if _, ok := pol.PublicKeys[functionary.PublicKeyID]; !ok {
+					return fmt.Errorf("functionary of step %v refers to public key %v, which isn't in the policy", name, functionary.PublicKeyID)
+				}
+
+				continue
+			}
+
+			if len(functionary.CertConstraint.Roots) == 0 {
+				return fmt.Errorf("functionary of step %v has neither a public key nor roots", name)
+			}
+
+			for _, rootID := range functionary.CertConstraint.Roots {
+				if _, ok := pol.Roots[rootID]; !ok && rootID != policy.AllowAllConstraint {
+					return fmt.Errorf("functionary of step %v refers to root %v, which isn't in the policy", name, rootID)
+				}
+			}
+		}
+
+		for _, from := range step.ArtifactsFrom {
+			if _, ok := pol.Steps[from]; !ok {
+				return fmt.Errorf("step %v takes artifacts from %v, which isn't a step of the policy", name, from)
+			}
+		}
+	}
+
+	return nil
+}
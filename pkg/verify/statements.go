@@ -0,0 +1,81 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"context"
+
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/statement"
+)
+
+// statementSource drops collections whose statements aren't of an accepted version of the in-toto statement, or
+// that don't strictly follow the specification when strict is set, so they never count as evidence.
+type statementSource struct {
+	source source.Sourcer
+	// types are the accepted statement types, or nil to accept any
+	types  map[string]bool
+	strict bool
+}
+
+// statementFilter wraps collectionSource to enforce the statement versions and strictness of the options, or
+// returns it unchanged if any statement is accepted.
+func (vo verifyOptions) statementFilter(collectionSource source.Sourcer) (source.Sourcer, error) {
+	if len(vo.statementVersions) == 0 && !vo.strictStatements {
+		return collectionSource, nil
+	}
+
+	s := statementSource{source: collectionSource, strict: vo.strictStatements}
+	if len(vo.statementVersions) > 0 {
+		s.types = make(map[string]bool, len(vo.statementVersions))
+		for _, version := range vo.statementVersions {
+			statementType, err := statement.TypeOfVersion(version)
+			if err != nil {
+				return nil, err
+			}
+
+			s.types[statementType] = true
+		}
+	}
+
+	return s, nil
+}
+
+func (s statementSource) Search(ctx context.Context, collectionName string, subjectDigests, attestations []string) ([]source.CollectionEnvelope, error) {
+	found, err := s.source.Search(ctx, collectionName, subjectDigests, attestations)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]source.CollectionEnvelope, 0, len(found))
+	for _, collection := range found {
+		if s.types != nil && !s.types[collection.Statement.Type] {
+			log.Warnf("skipping %v: statement type %v isn't accepted", collection.Reference, collection.Statement.Type)
+			continue
+		}
+
+		if s.strict {
+			if err := statement.Check(collection.Statement); err != nil {
+				log.Warnf("skipping %v: %v", collection.Reference, err)
+				continue
+			}
+		}
+
+		kept = append(kept, collection)
+	}
+
+	return kept, nil
+}
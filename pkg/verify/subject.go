@@ -0,0 +1,119 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+)
+
+// SubjectTrust is what an attestation's signature is checked against when verifying a subject without a policy.
+type SubjectTrust struct {
+	Verifiers          []cryptoutil.Verifier
+	Roots              []*x509.Certificate
+	Intermediates      []*x509.Certificate
+	TimestampVerifiers []dsse.TimestampVerifier
+	ClockSkew          time.Duration
+}
+
+// SubjectMatch describes an attestation whose signature verified and that has the artifact as a subject.
+type SubjectMatch struct {
+	// Subjects are the names of the subjects with the artifact's digest.
+	Subjects []string
+	// Signers are the key ids of the verifiers that verified the attestation.
+	Signers []string
+}
+
+// VerifySubject checks that env is signed by a key or certificate trusted by trust and that one of its subjects
+// has a digest of the artifact. Digests are compared for every hash function both the artifact and the subject have.
+func VerifySubject(ctx context.Context, env dsse.Envelope, artifact cryptoutil.DigestSet, trust SubjectTrust) (SubjectMatch, error) {
+	signers, err := VerifyEnvelope(ctx, env, trust)
+	if err != nil {
+		return SubjectMatch{}, err
+	}
+
+	match := SubjectMatch{Signers: signers}
+
+	statement := intoto.Statement{}
+	if err := json.Unmarshal(env.Payload, &statement); err != nil {
+		return SubjectMatch{}, fmt.Errorf("failed to parse in-toto statement: %w", err)
+	}
+
+	artifactDigests := make(map[string]string, len(artifact))
+	for digestValue, digest := range artifact {
+		if digestValue.GitOID {
+			continue
+		}
+
+		name, err := cryptoutil.HashToString(digestValue.Hash)
+		if err != nil {
+			return SubjectMatch{}, err
+		}
+
+		artifactDigests[name] = digest
+	}
+
+	for _, subject := range statement.Subject {
+		for name, digest := range subject.Digest {
+			if artifactDigest, ok := artifactDigests[name]; ok && artifactDigest == digest {
+				match.Subjects = append(match.Subjects, subject.Name)
+				break
+			}
+		}
+	}
+
+	if len(match.Subjects) == 0 {
+		return SubjectMatch{}, errors.New("artifact is not a subject of the attestation")
+	}
+
+	return match, nil
+}
+
+// VerifyEnvelope checks that env is signed by a key or certificate trusted by trust and returns the key ids of
+// the verifiers that verified it.
+func VerifyEnvelope(ctx context.Context, env dsse.Envelope, trust SubjectTrust) ([]string, error) {
+	ev := envelopeVerifier{
+		verifiers:          trust.Verifiers,
+		roots:              trust.Roots,
+		intermediates:      trust.Intermediates,
+		timestampVerifiers: trust.TimestampVerifiers,
+		clockSkew:          trust.ClockSkew,
+	}
+
+	passed, err := ev.verify(ctx, env)
+	if err != nil {
+		return nil, fmt.Errorf("signature did not verify: %w", err)
+	}
+
+	signers := make([]string, 0, len(passed))
+	for _, verifier := range passed {
+		keyID, err := verifier.KeyID()
+		if err != nil {
+			return nil, err
+		}
+
+		signers = append(signers, keyID)
+	}
+
+	return signers, nil
+}
@@ -0,0 +1,499 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/go-witness/timestamp"
+	"github.com/testifysec/witness/pkg/attestation/subjectname"
+	"github.com/testifysec/witness/pkg/groups"
+)
+
+type verifyOptions struct {
+	policyEnvelope   dsse.Envelope
+	policyVerifiers  []cryptoutil.Verifier
+	collectionSource source.Sourcer
+	subjectDigests   []string
+	clockSkew        time.Duration
+	subjectNames     []string
+	witnessReleases  []dsse.Envelope
+	vex              []dsse.Envelope
+	environment      string
+	revocations      []dsse.Envelope
+	storedEnvelopes  *StoredEnvelopes
+	groupSnapshots   []dsse.Envelope
+	resolvedGroups   []groups.Snapshot
+	cueTool          string
+	subPolicies      []dsse.Envelope
+	// statementVersions are the versions of the in-toto statement evidence may be, or empty to accept any
+	statementVersions []string
+	strictStatements  bool
+}
+
+type Option func(*verifyOptions)
+
+func WithSubjectDigests(subjectDigests []cryptoutil.DigestSet) Option {
+	return func(vo *verifyOptions) {
+		for _, set := range subjectDigests {
+			for _, digest := range set {
+				vo.subjectDigests = append(vo.subjectDigests, digest)
+			}
+		}
+	}
+}
+
+func WithCollectionSource(source source.Sourcer) Option {
+	return func(vo *verifyOptions) {
+		vo.collectionSource = source
+	}
+}
+
+// WithClockSkew sets how far outside of a certificate's validity window, or past a policy's expiration,
+// a trusted time may fall before verification fails.
+func WithClockSkew(skew time.Duration) Option {
+	return func(vo *verifyOptions) {
+		vo.clockSkew = skew
+	}
+}
+
+// WithSubjectNames requires that verified evidence records one of the subject digests under each of the provided
+// names, as recorded by the subjectname attestor.
+func WithSubjectNames(names []string) Option {
+	return func(vo *verifyOptions) {
+		vo.subjectNames = names
+	}
+}
+
+// WithWitnessReleases provides the release attestations of witness itself, signed by the project, that are checked
+// against the digests of the witness binaries that recorded evidence when a policy requires released binaries.
+func WithWitnessReleases(releases []dsse.Envelope) Option {
+	return func(vo *verifyOptions) {
+		vo.witnessReleases = releases
+	}
+}
+
+// WithVEX provides signed OpenVEX attestations that can remediate vulnerabilities found by the scans of steps with
+// vulnerability constraints.
+func WithVEX(vex []dsse.Envelope) Option {
+	return func(vo *verifyOptions) {
+		vo.vex = vex
+	}
+}
+
+// WithEnvironment verifies evidence for deployment to environment, which only requires the steps of the policy that
+// apply to it.
+func WithEnvironment(environment string) Option {
+	return func(vo *verifyOptions) {
+		vo.environment = environment
+	}
+}
+
+// WithRevocations provides signed revocation lists. Revoked attestations, and attestations of revoked subjects, are
+// never accepted as evidence, and verifying a revoked subject fails. Lists must be signed by the policy signer or one
+// of the policy's revocation signers.
+func WithRevocations(revocations []dsse.Envelope) Option {
+	return func(vo *verifyOptions) {
+		vo.revocations = revocations
+	}
+}
+
+// WithStoredEnvelopes provides the gitoids of the bytes the collection source's envelopes were read from, which
+// revoked attestations are matched against.
+func WithStoredEnvelopes(stored *StoredEnvelopes) Option {
+	return func(vo *verifyOptions) {
+		vo.storedEnvelopes = stored
+	}
+}
+
+// WithGroupSnapshots provides signed snapshots of the members of the functionary groups a policy names. Snapshots
+// must be signed by the policy signer or one of the policy's group signers.
+func WithGroupSnapshots(snapshots []dsse.Envelope) Option {
+	return func(vo *verifyOptions) {
+		vo.groupSnapshots = snapshots
+	}
+}
+
+// WithSubPolicies provides the signed sub-policies that delegated steps of the policy are defined by. Each must be
+// signed by one of the delegates the policy names for the step.
+func WithSubPolicies(subPolicies []dsse.Envelope) Option {
+	return func(vo *verifyOptions) {
+		vo.subPolicies = subPolicies
+	}
+}
+
+// WithStatementVersions only accepts evidence whose statements are of one of the versions of the in-toto statement,
+// such as statement.Version1. By default evidence of any version is accepted.
+func WithStatementVersions(versions ...string) Option {
+	return func(vo *verifyOptions) {
+		vo.statementVersions = versions
+	}
+}
+
+// WithStrictStatements only accepts evidence whose statements strictly follow the in-toto statement specification,
+// such as evidence written with witness run --strict-intoto.
+func WithStrictStatements(strict bool) Option {
+	return func(vo *verifyOptions) {
+		vo.strictStatements = strict
+	}
+}
+
+// WithResolvedGroups provides the members of functionary groups as resolved by the verifier from its identity
+// provider, which are trusted without a signature.
+func WithResolvedGroups(snapshots ...groups.Snapshot) Option {
+	return func(vo *verifyOptions) {
+		vo.resolvedGroups = append(vo.resolvedGroups, snapshots...)
+	}
+}
+
+// WithCUETool sets the cue command that evaluates the CUE policies of a policy's attestations, which is found on the
+// PATH by default.
+func WithCUETool(tool string) Option {
+	return func(vo *verifyOptions) {
+		vo.cueTool = tool
+	}
+}
+
+// Verify verifies a set of attestations against a provided policy. The set of attestations that satisfy the policy will be returned
+// if verification is successful. It behaves like go-witness's Verify but allows the CLI to tune how evidence is verified.
+func Verify(ctx context.Context, policyEnvelope dsse.Envelope, policyVerifiers []cryptoutil.Verifier, opts ...Option) (map[string][]source.VerifiedCollection, error) {
+	vo := verifyOptions{
+		policyEnvelope:  policyEnvelope,
+		policyVerifiers: policyVerifiers,
+	}
+
+	for _, opt := range opts {
+		opt(&vo)
+	}
+
+	if vo.clockSkew < 0 {
+		return nil, fmt.Errorf("clock skew must not be negative")
+	}
+
+	pol, extensions, pubKeysById, err := vo.loadPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	ordering := extensions.ordering()
+	chains := extensions.chains()
+	order, err := stepOrder(ordering)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+
+	compromised, err := extensions.compromisedKeys(pubKeysById)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+
+	members, err := extensions.groupMembers(vo.groupSnapshots, vo.resolvedGroups, vo.policyVerifiers, pubKeysById, time.Now(), vo.clockSkew)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify policy: %w", err)
+	}
+
+	revoked, err := extensions.revocations(vo.revocations, vo.policyVerifiers, pubKeysById)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify policy: %w", err)
+	}
+
+	if err := revoked.checkSubjects(vo.subjectDigests); err != nil {
+		return nil, err
+	}
+
+	revoked.stored = vo.storedEnvelopes
+	collectionSource := vo.collectionSource
+	if !revoked.empty() {
+		collectionSource = revokedSource{source: collectionSource, revoked: revoked}
+	}
+
+	if collectionSource, err = vo.statementFilter(collectionSource); err != nil {
+		return nil, err
+	}
+
+	ev, err := vo.envelopeVerifier(pol, compromised)
+	if err != nil {
+		return nil, err
+	}
+
+	verifiedSource := newVerifiedSource(collectionSource, ev)
+
+	// the policy library compares its expiration against the local clock, so the tolerance is applied by
+	// extending the expiration of our in memory copy of the already verified policy
+	pol.Expires = pol.Expires.Add(vo.clockSkew)
+	accepted, err := pol.Verify(ctx, policy.WithSubjectDigests(vo.subjectDigests), policy.WithVerifiedSource(verifiedSource))
+	denied := policy.ErrPolicyDenied{}
+	if errors.As(err, &denied) {
+		if denials := regoDenials(ctx, pol, verifiedSource, vo.subjectDigests); len(denials) > 0 {
+			err = ErrRegoDenied{Denials: denials, err: err}
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify policy: %w", err)
+	}
+
+	filtered, err := vo.filterCollections(ctx, pol, accepted, extensions, members, pubKeysById)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify policy: %w", err)
+	}
+
+	// collections the filters removed may have been what satisfied the artifactsFrom of other steps, so the policy is
+	// verified again with only the collections that were kept
+	if countCollections(filtered) < countCollections(accepted) {
+		kept := keptSource{source: verifiedSource, kept: collectionDigests(filtered)}
+		if accepted, err = pol.Verify(ctx, policy.WithSubjectDigests(vo.subjectDigests), policy.WithVerifiedSource(kept)); err != nil {
+			return nil, fmt.Errorf("failed to verify policy: %w", err)
+		}
+	}
+
+	// ordering and chains are checked last, so a collection any other check rejects can't satisfy them for the steps
+	// that come after it
+	accepted, err = verifyStepOrder(accepted, ordering, order, vo.clockSkew)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify policy: %w", err)
+	}
+
+	accepted, err = verifyChains(accepted, chains, order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify policy: %w", err)
+	}
+
+	if err := verifySubjectNames(accepted, vo.subjectNames, vo.subjectDigests); err != nil {
+		return nil, err
+	}
+
+	return accepted, nil
+}
+
+// filterCollections removes the collections that fail the checks the policy extensions make of each collection on its
+// own, such as its witness binary, approvers, and SBOMs.
+func (vo verifyOptions) filterCollections(ctx context.Context, pol policy.Policy, accepted map[string][]source.VerifiedCollection, extensions policyExtensions, members map[string][]string, pubKeysById map[string]cryptoutil.Verifier) (map[string][]source.VerifiedCollection, error) {
+	var err error
+	if extensions.Witness != nil {
+		trusted, err := extensions.Witness.trustedReleaseDigests(vo.witnessReleases, pubKeysById)
+		if err != nil {
+			return nil, err
+		}
+
+		accepted, err = verifyWitnessBinaries(accepted, *extensions.Witness, trusted)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	trustBundles, err := pol.TrustBundles()
+	if err != nil {
+		return nil, err
+	}
+
+	accepted, err = verifyApprovers(accepted, extensions.approvers(pol, trustBundles, members))
+	if err != nil {
+		return nil, err
+	}
+
+	accepted, err = verifyRequiredProducts(accepted, extensions.requiredProducts())
+	if err != nil {
+		return nil, err
+	}
+
+	accepted, err = verifyCUEPolicies(ctx, accepted, extensions.cuePolicies(), vo.cueTool)
+	if err != nil {
+		return nil, err
+	}
+
+	accepted, err = verifySBOMs(accepted, extensions.sboms())
+	if err != nil {
+		return nil, err
+	}
+
+	accepted, err = verifyVulnerabilities(accepted, extensions.vulnerabilities(), vo.vex, pubKeysById, vo.subjectDigests)
+	if err != nil {
+		return nil, err
+	}
+
+	return accepted, nil
+}
+
+func countCollections(collections map[string][]source.VerifiedCollection) int {
+	n := 0
+	for _, stepCollections := range collections {
+		n += len(stepCollections)
+	}
+
+	return n
+}
+
+// collectionDigests returns the envelope digests of collections.
+func collectionDigests(collections map[string][]source.VerifiedCollection) map[string]struct{} {
+	digests := make(map[string]struct{})
+	for _, stepCollections := range collections {
+		for _, collection := range stepCollections {
+			if digest, err := EnvelopeDigest(collection.Envelope); err == nil {
+				digests[digest] = struct{}{}
+			}
+		}
+	}
+
+	return digests
+}
+
+// keptSource only returns the collections of source whose envelope digest is in kept.
+type keptSource struct {
+	source source.VerifiedSourcer
+	kept   map[string]struct{}
+}
+
+func (s keptSource) Search(ctx context.Context, collectionName string, subjectDigests, attestations []string) ([]source.VerifiedCollection, error) {
+	found, err := s.source.Search(ctx, collectionName, subjectDigests, attestations)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]source.VerifiedCollection, 0, len(found))
+	for _, collection := range found {
+		digest, err := EnvelopeDigest(collection.Envelope)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := s.kept[digest]; ok {
+			kept = append(kept, collection)
+		}
+	}
+
+	return kept, nil
+}
+
+// loadPolicy verifies the signature on the policy and reads the policy and its extensions for the environment, with
+// its delegated steps defined by their sub-policies. The public keys of the policy are returned without those added by
+// sub-policies, since only they may sign what the extensions of the policy name signers for.
+func (vo verifyOptions) loadPolicy() (policy.Policy, policyExtensions, map[string]cryptoutil.Verifier, error) {
+	if _, err := vo.policyEnvelope.Verify(dsse.VerifyWithVerifiers(vo.policyVerifiers...)); err != nil {
+		return policy.Policy{}, policyExtensions{}, nil, fmt.Errorf("could not verify policy: %w", err)
+	}
+
+	pol := policy.Policy{}
+	if err := json.Unmarshal(vo.policyEnvelope.Payload, &pol); err != nil {
+		return policy.Policy{}, policyExtensions{}, nil, fmt.Errorf("failed to unmarshal policy from envelope: %w", err)
+	}
+
+	extensions := policyExtensions{}
+	if err := json.Unmarshal(vo.policyEnvelope.Payload, &extensions); err != nil {
+		return policy.Policy{}, policyExtensions{}, nil, fmt.Errorf("failed to unmarshal policy extensions from envelope: %w", err)
+	}
+
+	if err := forEnvironment(&pol, &extensions, vo.environment); err != nil {
+		return policy.Policy{}, policyExtensions{}, nil, fmt.Errorf("invalid policy: %w", err)
+	}
+
+	pubKeysById, err := publicKeyVerifiers(pol)
+	if err != nil {
+		return policy.Policy{}, policyExtensions{}, nil, fmt.Errorf("failed to get pulic keys from policy: %w", err)
+	}
+
+	if err := delegate(&pol, extensions, vo.subPolicies, pubKeysById, time.Now().Add(-vo.clockSkew)); err != nil {
+		return policy.Policy{}, policyExtensions{}, nil, fmt.Errorf("failed to verify policy: %w", err)
+	}
+
+	return pol, extensions, pubKeysById, nil
+}
+
+// envelopeVerifier returns the verifier of evidence signatures with the public keys, trust bundles, and timestamp
+// authorities of the policy, including those added by sub-policies.
+func (vo verifyOptions) envelopeVerifier(pol policy.Policy, compromised map[string]time.Time) (envelopeVerifier, error) {
+	pubKeysById, err := publicKeyVerifiers(pol)
+	if err != nil {
+		return envelopeVerifier{}, fmt.Errorf("failed to get pulic keys from policy: %w", err)
+	}
+
+	pubkeys := make([]cryptoutil.Verifier, 0)
+	for _, pubkey := range pubKeysById {
+		pubkeys = append(pubkeys, pubkey)
+	}
+
+	trustBundlesById, err := pol.TrustBundles()
+	if err != nil {
+		return envelopeVerifier{}, fmt.Errorf("failed to load policy trust bundles: %w", err)
+	}
+
+	roots := make([]*x509.Certificate, 0)
+	intermediates := make([]*x509.Certificate, 0)
+	for _, trustBundle := range trustBundlesById {
+		roots = append(roots, trustBundle.Root)
+		intermediates = append(intermediates, trustBundle.Intermediates...)
+	}
+
+	timestampAuthoritiesById, err := pol.TimestampAuthorityTrustBundles()
+	if err != nil {
+		return envelopeVerifier{}, fmt.Errorf("failed to load policy timestamp authorities: %w", err)
+	}
+
+	timestampVerifiers := make([]dsse.TimestampVerifier, 0)
+	for _, timestampAuthority := range timestampAuthoritiesById {
+		certs := []*x509.Certificate{timestampAuthority.Root}
+		certs = append(certs, timestampAuthority.Intermediates...)
+		timestampVerifiers = append(timestampVerifiers, timestamp.NewVerifier(timestamp.VerifyWithCerts(certs)))
+	}
+
+	return envelopeVerifier{
+		verifiers:          pubkeys,
+		roots:              roots,
+		intermediates:      intermediates,
+		timestampVerifiers: timestampVerifiers,
+		clockSkew:          vo.clockSkew,
+		compromised:        compromised,
+	}, nil
+}
+
+func verifySubjectNames(accepted map[string][]source.VerifiedCollection, names []string, subjectDigests []string) error {
+	digests := make(map[string]struct{}, len(subjectDigests))
+	for _, digest := range subjectDigests {
+		digests[digest] = struct{}{}
+	}
+
+	for _, name := range names {
+		found := false
+		for _, collections := range accepted {
+			for _, collection := range collections {
+				subject, ok := subjectname.FromCollection(collection.Collection)[name]
+				if !ok {
+					continue
+				}
+
+				for _, digest := range subject.Digest {
+					if _, ok := digests[digest]; ok {
+						found = true
+					}
+				}
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("no verified evidence names the subject %v", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/policy"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/subjectname"
+	"github.com/testifysec/witness/pkg/signer/gpg"
+	"github.com/testifysec/witness/pkg/signer/ssh"
+	xssh "golang.org/x/crypto/ssh"
+)
+
+func TestVerifySubjectNames(t *testing.T) {
+	named := subjectname.New()
+	require.NoError(t, json.Unmarshal([]byte(`{"release-artifact":{"path":"app.tar.gz","digest":{"sha256":"abcd"}}}`), named))
+	accepted := map[string][]source.VerifiedCollection{
+		"build": {{
+			CollectionEnvelope: source.CollectionEnvelope{
+				Collection: attestation.Collection{
+					Attestations: []attestation.CollectionAttestation{{Type: subjectname.Type, Attestation: named}},
+				},
+			},
+		}},
+	}
+
+	require.NoError(t, verifySubjectNames(accepted, []string{"release-artifact"}, []string{"abcd"}))
+	require.ErrorContains(t, verifySubjectNames(accepted, []string{"release-artifact"}, []string{"ef01"}), "release-artifact")
+	require.ErrorContains(t, verifySubjectNames(accepted, []string{"debug-symbols"}, []string{"abcd"}), "debug-symbols")
+}
+
+func TestPublicKeyVerifiersPGP(t *testing.T) {
+	entity, err := openpgp.NewEntity("witness", "", "witness@example.com", nil)
+	require.NoError(t, err)
+	publicKey := &bytes.Buffer{}
+	require.NoError(t, entity.Serialize(publicKey))
+	verifier, err := gpg.NewVerifier(publicKey.Bytes())
+	require.NoError(t, err)
+	keyID, err := verifier.KeyID()
+	require.NoError(t, err)
+	armored, err := verifier.Bytes()
+	require.NoError(t, err)
+
+	verifiers, err := publicKeyVerifiers(policy.Policy{PublicKeys: map[string]policy.PublicKey{keyID: {KeyID: keyID, Key: armored}}})
+	require.NoError(t, err)
+	require.Contains(t, verifiers, keyID)
+
+	_, err = publicKeyVerifiers(policy.Policy{PublicKeys: map[string]policy.PublicKey{"other": {KeyID: "other", Key: armored}}})
+	require.ErrorAs(t, err, &policy.ErrKeyIDMismatch{})
+}
+
+func TestPublicKeyVerifiersSSH(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := xssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	key := xssh.MarshalAuthorizedKey(sshPub)
+	keyID := xssh.FingerprintSHA256(sshPub)
+
+	verifiers, err := publicKeyVerifiers(policy.Policy{PublicKeys: map[string]policy.PublicKey{keyID: {KeyID: keyID, Key: key}}})
+	require.NoError(t, err)
+	require.IsType(t, &ssh.Verifier{}, verifiers[keyID])
+}
@@ -0,0 +1,147 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/statement"
+)
+
+const (
+	// VSAType is the predicate type of SLSA Verification Summary Attestations.
+	VSAType = "https://slsa.dev/verification_summary/v1"
+
+	VSAPassed = "PASSED"
+	VSAFailed = "FAILED"
+)
+
+// VSA is a SLSA Verification Summary Attestation: a verifier's signed statement that artifacts were, or weren't,
+// verified against a policy, so consumers can trust the decision without repeating the verification.
+type VSA struct {
+	Verifier           VSAVerifier   `json:"verifier"`
+	TimeVerified       time.Time     `json:"timeVerified"`
+	ResourceURI        string        `json:"resourceUri"`
+	Policy             VSAResource   `json:"policy"`
+	InputAttestations  []VSAResource `json:"inputAttestations,omitempty"`
+	VerificationResult string        `json:"verificationResult"`
+	VerifiedLevels     []string      `json:"verifiedLevels"`
+	SLSAVersion        string        `json:"slsaVersion"`
+	subjects           []cryptoutil.DigestSet
+}
+
+type VSAVerifier struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+// VSAResource refers to a policy or attestation by where it was read from and its sha256 digest.
+type VSAResource struct {
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest"`
+}
+
+// NewVSA summarizes the verification of subjects against the policy read from policyURI with digest policyDigest.
+// The evidence that satisfied the policy is listed as the input attestations. If verifyErr is set the verification
+// failed, and it is recorded with no verified levels or input attestations.
+func NewVSA(verifier VSAVerifier, resourceURI string, subjects []cryptoutil.DigestSet, policyURI, policyDigest string, verified map[string][]source.VerifiedCollection, verifiedLevels []string, verifyErr error) (VSA, error) {
+	vsa := VSA{
+		Verifier:           verifier,
+		TimeVerified:       time.Now().UTC().Truncate(time.Second),
+		ResourceURI:        resourceURI,
+		Policy:             VSAResource{URI: policyURI, Digest: map[string]string{"sha256": policyDigest}},
+		VerificationResult: VSAPassed,
+		VerifiedLevels:     append([]string{}, verifiedLevels...),
+		SLSAVersion:        "1.0",
+		subjects:           subjects,
+	}
+
+	if verifyErr != nil {
+		vsa.VerificationResult = VSAFailed
+		vsa.VerifiedLevels = []string{}
+		return vsa, nil
+	}
+
+	for _, collections := range verified {
+		for _, collection := range collections {
+			digest, err := EnvelopeDigest(collection.Envelope)
+			if err != nil {
+				return VSA{}, err
+			}
+
+			vsa.InputAttestations = append(vsa.InputAttestations, VSAResource{URI: collection.Reference, Digest: map[string]string{"sha256": digest}})
+		}
+	}
+
+	sort.Slice(vsa.InputAttestations, func(i, j int) bool {
+		return vsa.InputAttestations[i].URI < vsa.InputAttestations[j].URI
+	})
+
+	return vsa, nil
+}
+
+// Statement returns the in-toto statement of the VSA about its subjects, each named by its digest.
+func (v VSA) Statement() (intoto.Statement, error) {
+	predicate, err := json.Marshal(&v)
+	if err != nil {
+		return intoto.Statement{}, err
+	}
+
+	if predicate, err = statement.Canonicalize(predicate); err != nil {
+		return intoto.Statement{}, err
+	}
+
+	subjects := make(map[string]cryptoutil.DigestSet)
+	for _, digestSet := range v.subjects {
+		nameMap, err := digestSet.ToNameMap()
+		if err != nil {
+			return intoto.Statement{}, err
+		}
+
+		for hash, digest := range nameMap {
+			subjects[fmt.Sprintf("%v:%v", hash, digest)] = digestSet
+		}
+	}
+
+	names := make([]string, 0, len(subjects))
+	for name := range subjects {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	st := intoto.Statement{
+		Type:          intoto.StatementType,
+		PredicateType: VSAType,
+		Subject:       make([]intoto.Subject, 0, len(names)),
+		Predicate:     predicate,
+	}
+
+	for _, name := range names {
+		subject, err := intoto.DigestSetToSubject(name, subjects[name])
+		if err != nil {
+			return intoto.Statement{}, err
+		}
+
+		st.Subject = append(st.Subject, subject)
+	}
+
+	return st, nil
+}
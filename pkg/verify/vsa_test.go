@@ -0,0 +1,60 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/source"
+)
+
+func TestVSA(t *testing.T) {
+	subjects := []cryptoutil.DigestSet{{{Hash: crypto.SHA256}: "abc"}}
+	verifier := VSAVerifier{ID: "https://witness.dev/release-gate"}
+	verified := map[string][]source.VerifiedCollection{
+		"build": {{CollectionEnvelope: source.CollectionEnvelope{Reference: "build.json", Envelope: dsse.Envelope{PayloadType: "a", Payload: []byte("{}")}}}},
+		"test":  {{CollectionEnvelope: source.CollectionEnvelope{Reference: "test.json", Envelope: dsse.Envelope{PayloadType: "b", Payload: []byte("{}")}}}},
+	}
+
+	vsa, err := NewVSA(verifier, "pkg:generic/app", subjects, "policy.json", "def", verified, []string{"SLSA_BUILD_LEVEL_3"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, VSAPassed, vsa.VerificationResult)
+	require.Equal(t, []string{"SLSA_BUILD_LEVEL_3"}, vsa.VerifiedLevels)
+	require.Len(t, vsa.InputAttestations, 2)
+	require.Equal(t, "build.json", vsa.InputAttestations[0].URI)
+
+	st, err := vsa.Statement()
+	require.NoError(t, err)
+	require.Equal(t, VSAType, st.PredicateType)
+	require.Len(t, st.Subject, 1)
+	require.Equal(t, "sha256:abc", st.Subject[0].Name)
+	predicate := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(st.Predicate, &predicate))
+	require.Equal(t, "pkg:generic/app", predicate["resourceUri"])
+	require.Equal(t, map[string]interface{}{"sha256": "def"}, predicate["policy"].(map[string]interface{})["digest"])
+
+	// a failed verification vouches for no levels or evidence
+	vsa, err = NewVSA(verifier, "pkg:generic/app", subjects, "policy.json", "def", verified, []string{"SLSA_BUILD_LEVEL_3"}, errors.New("step test is missing"))
+	require.NoError(t, err)
+	require.Equal(t, VSAFailed, vsa.VerificationResult)
+	require.Empty(t, vsa.VerifiedLevels)
+	require.Empty(t, vsa.InputAttestations)
+}
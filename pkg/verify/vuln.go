@@ -0,0 +1,413 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/owenrumney/go-sarif/sarif"
+	"github.com/testifysec/go-witness/attestation"
+	sarifattestation "github.com/testifysec/go-witness/attestation/sarif"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/go-witness/log"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/vuln"
+)
+
+const (
+	openVEXPredicatePrefix = "https://openvex.dev/ns"
+
+	vexNotAffected = "not_affected"
+	vexFixed       = "fixed"
+)
+
+// vulnerabilityConstraints fail collections whose vulnerability scans, recorded by the sarif or vuln attestor, found
+// vulnerabilities at or above FailOn that aren't covered by a VEX statement of not_affected or fixed from one of
+// VEXSigners, which are ids of policy public keys.
+type vulnerabilityConstraints struct {
+	FailOn     string   `json:"failOn,omitempty"`
+	VEXSigners []string `json:"vexSigners,omitempty"`
+}
+
+type finding struct {
+	ID       string
+	Severity string
+}
+
+// vexStatement is the latest status a VEX author gave for a vulnerability.
+type vexStatement struct {
+	Status    string
+	Timestamp time.Time
+}
+
+func (pe policyExtensions) vulnerabilities() map[string]vulnerabilityConstraints {
+	constraints := make(map[string]vulnerabilityConstraints)
+	for key, step := range pe.Steps {
+		if step.Vulnerabilities != nil {
+			constraints[stepName(key, step)] = *step.Vulnerabilities
+		}
+	}
+
+	return constraints
+}
+
+// verifyVulnerabilities removes collections with unremediated vulnerabilities. VEX attestations only apply if they
+// are signed by one of the step's VEX signers and one of their subjects is a subject being verified.
+func verifyVulnerabilities(accepted map[string][]source.VerifiedCollection, constraints map[string]vulnerabilityConstraints, vex []dsse.Envelope, pubKeysByID map[string]cryptoutil.Verifier, subjectDigests []string) (map[string][]source.VerifiedCollection, error) {
+	result := make(map[string][]source.VerifiedCollection, len(accepted))
+	for step, collections := range accepted {
+		result[step] = collections
+	}
+
+	for step, constraint := range constraints {
+		threshold, err := severityRank(constraint.failOn())
+		if err != nil {
+			return nil, fmt.Errorf("invalid vulnerability constraint for step %v: %w", step, err)
+		}
+
+		verifiers := make([]cryptoutil.Verifier, 0, len(constraint.VEXSigners))
+		for _, keyID := range constraint.VEXSigners {
+			verifier, ok := pubKeysByID[keyID]
+			if !ok {
+				return nil, fmt.Errorf("vex signer %v of step %v is not a public key in the policy", keyID, step)
+			}
+
+			verifiers = append(verifiers, verifier)
+		}
+
+		statements, err := vexStatements(vex, verifiers, subjectDigests)
+		if err != nil {
+			return nil, err
+		}
+
+		kept := make([]source.VerifiedCollection, 0, len(result[step]))
+		var lastErr error
+		for _, collection := range result[step] {
+			if err := checkVulnerabilities(collection, threshold, statements); err != nil {
+				lastErr = fmt.Errorf("%v: %w", collection.Reference, err)
+				continue
+			}
+
+			kept = append(kept, collection)
+		}
+
+		if len(kept) == 0 {
+			if lastErr == nil {
+				lastErr = errors.New("no evidence")
+			}
+
+			return nil, fmt.Errorf("no evidence for step %v is free of unremediated vulnerabilities: %w", step, lastErr)
+		}
+
+		result[step] = kept
+	}
+
+	return result, nil
+}
+
+func (vc vulnerabilityConstraints) failOn() string {
+	if vc.FailOn == "" {
+		return "critical"
+	}
+
+	return vc.FailOn
+}
+
+func severityRank(severity string) (int, error) {
+	if rank := vuln.SeverityRank(severity); rank >= 0 {
+		return rank, nil
+	}
+
+	return 0, fmt.Errorf("unknown severity %v, expected one of %v", severity, strings.Join(vuln.Severities, ", "))
+}
+
+func checkVulnerabilities(collection source.VerifiedCollection, threshold int, statements map[string]vexStatement) error {
+	scanned := false
+	unremediated := []string{}
+	for _, findings := range collectionFindings(collection.Collection) {
+		scanned = true
+		for _, f := range findings {
+			rank, _ := severityRank(f.Severity)
+			if rank < threshold {
+				continue
+			}
+
+			if statement, ok := statements[f.ID]; ok && (statement.Status == vexNotAffected || statement.Status == vexFixed) {
+				continue
+			}
+
+			unremediated = append(unremediated, fmt.Sprintf("%v (%v)", f.ID, f.Severity))
+		}
+	}
+
+	if !scanned {
+		return errors.New("evidence does not record a vulnerability scan")
+	}
+
+	if len(unremediated) > 0 {
+		return fmt.Errorf("unremediated vulnerabilities: %v", strings.Join(unremediated, ", "))
+	}
+
+	return nil
+}
+
+// collectionFindings returns the findings of each sarif report and vuln scan recorded in a collection.
+func collectionFindings(collection attestation.Collection) [][]finding {
+	reports := [][]finding{}
+	for _, collectionAttestation := range collection.Attestations {
+		switch a := collectionAttestation.Attestation.(type) {
+		case *sarifattestation.Attestor:
+			reports = append(reports, sarifFindings(a.Report))
+		case *vuln.Attestor:
+			findings := make([]finding, 0, len(a.Findings))
+			for _, f := range a.Findings {
+				findings = append(findings, finding{ID: f.ID, Severity: f.Severity})
+			}
+
+			reports = append(reports, findings)
+		}
+	}
+
+	return reports
+}
+
+// sarifFindings extracts findings from a report. Scanners such as grype and trivy record a CVSS score in the
+// security-severity property of each rule, and trivy also tags rules with their severity. Results of rules
+// without either are rated by their level.
+func sarifFindings(report sarif.Report) []finding {
+	findings := []finding{}
+	for _, run := range report.Runs {
+		if run == nil {
+			continue
+		}
+
+		rules := make(map[string]*sarif.ReportingDescriptor)
+		for _, rule := range run.Tool.Driver.Rules {
+			if rule != nil {
+				rules[rule.ID] = rule
+			}
+		}
+
+		for _, result := range run.Results {
+			if result == nil {
+				continue
+			}
+
+			var rule *sarif.ReportingDescriptor
+			if result.RuleID != nil {
+				rule = rules[*result.RuleID]
+			}
+
+			if rule == nil && result.RuleIndex != nil && int(*result.RuleIndex) < len(run.Tool.Driver.Rules) {
+				rule = run.Tool.Driver.Rules[*result.RuleIndex]
+			}
+
+			id := ""
+			if result.RuleID != nil {
+				id = *result.RuleID
+			} else if rule != nil {
+				id = rule.ID
+			}
+
+			findings = append(findings, finding{ID: id, Severity: resultSeverity(result, rule)})
+		}
+	}
+
+	return findings
+}
+
+func resultSeverity(result *sarif.Result, rule *sarif.ReportingDescriptor) string {
+	if rule != nil {
+		if score, ok := rule.Properties["security-severity"]; ok {
+			if severity, ok := cvssSeverity(score); ok {
+				return severity
+			}
+		}
+
+		if tags, ok := rule.Properties["tags"].([]interface{}); ok {
+			for i := len(vuln.Severities) - 1; i > 0; i-- {
+				for _, tag := range tags {
+					if tag, ok := tag.(string); ok && strings.EqualFold(tag, vuln.Severities[i]) {
+						return vuln.Severities[i]
+					}
+				}
+			}
+		}
+	}
+
+	level := ""
+	if result.Level != nil {
+		level = *result.Level
+	} else if rule != nil && rule.DefaultConfiguration != nil {
+		level, _ = rule.DefaultConfiguration.Level.(string)
+	}
+
+	switch level {
+	case "error":
+		return "high"
+	case "note":
+		return "low"
+	case "none":
+		return "none"
+	default:
+		return "medium"
+	}
+}
+
+// cvssSeverity rates a CVSS score with the qualitative ratings of the CVSS v3 specification.
+func cvssSeverity(score interface{}) (string, bool) {
+	var value float64
+	switch s := score.(type) {
+	case string:
+		parsed, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return "", false
+		}
+
+		value = parsed
+	case float64:
+		value = s
+	default:
+		return "", false
+	}
+
+	switch {
+	case value >= 9.0:
+		return "critical", true
+	case value >= 7.0:
+		return "high", true
+	case value >= 4.0:
+		return "medium", true
+	case value > 0:
+		return "low", true
+	default:
+		return "none", true
+	}
+}
+
+type openVEXDocument struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Statements []struct {
+		Vulnerability json.RawMessage `json:"vulnerability"`
+		Aliases       []string        `json:"aliases"`
+		Status        string          `json:"status"`
+		Timestamp     time.Time       `json:"timestamp"`
+	} `json:"statements"`
+}
+
+// vexStatements returns the latest status of each vulnerability, keyed by its name and aliases, from the VEX
+// attestations that are signed by one of verifiers and are about one of subjectDigests.
+func vexStatements(envelopes []dsse.Envelope, verifiers []cryptoutil.Verifier, subjectDigests []string) (map[string]vexStatement, error) {
+	statements := make(map[string]vexStatement)
+	if len(verifiers) == 0 {
+		return statements, nil
+	}
+
+	subjects := make(map[string]struct{}, len(subjectDigests))
+	for _, digest := range subjectDigests {
+		subjects[digest] = struct{}{}
+	}
+
+	for i, envelope := range envelopes {
+		if _, err := envelope.Verify(dsse.VerifyWithVerifiers(verifiers...)); err != nil {
+			log.Debugf("vex attestation %v is not signed by a vex signer: %v", i+1, err)
+			continue
+		}
+
+		statement := intoto.Statement{}
+		if err := json.Unmarshal(envelope.Payload, &statement); err != nil {
+			return nil, fmt.Errorf("failed to parse vex attestation %v: %w", i+1, err)
+		}
+
+		if !strings.HasPrefix(statement.PredicateType, openVEXPredicatePrefix) {
+			return nil, fmt.Errorf("vex attestation %v has predicate type %v, expected an OpenVEX document", i+1, statement.PredicateType)
+		}
+
+		if !aboutSubjects(statement, subjects) {
+			log.Debugf("vex attestation %v is not about any of the subjects being verified", i+1)
+			continue
+		}
+
+		doc := openVEXDocument{}
+		if err := json.Unmarshal(statement.Predicate, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse vex attestation %v: %w", i+1, err)
+		}
+
+		for _, s := range doc.Statements {
+			names, err := vulnerabilityNames(s.Vulnerability)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse vex attestation %v: %w", i+1, err)
+			}
+
+			timestamp := s.Timestamp
+			if timestamp.IsZero() {
+				timestamp = doc.Timestamp
+			}
+
+			for _, name := range append(names, s.Aliases...) {
+				if existing, ok := statements[name]; ok && existing.Timestamp.After(timestamp) {
+					continue
+				}
+
+				statements[name] = vexStatement{Status: s.Status, Timestamp: timestamp}
+			}
+		}
+	}
+
+	return statements, nil
+}
+
+func aboutSubjects(statement intoto.Statement, subjects map[string]struct{}) bool {
+	for _, subject := range statement.Subject {
+		for _, digest := range subject.Digest {
+			if _, ok := subjects[digest]; ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// vulnerabilityNames reads the vulnerability of an OpenVEX statement, which is a string in early versions of the
+// spec and an object with a name and aliases in later ones.
+func vulnerabilityNames(data json.RawMessage) ([]string, error) {
+	name := ""
+	if err := json.Unmarshal(data, &name); err == nil {
+		return []string{name}, nil
+	}
+
+	vulnerability := struct {
+		Name    string   `json:"name"`
+		Aliases []string `json:"aliases"`
+	}{}
+
+	if err := json.Unmarshal(data, &vulnerability); err != nil {
+		return nil, fmt.Errorf("invalid vulnerability: %w", err)
+	}
+
+	if vulnerability.Name == "" {
+		return nil, errors.New("statement does not name a vulnerability")
+	}
+
+	return append([]string{vulnerability.Name}, vulnerability.Aliases...), nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	sarifattestation "github.com/testifysec/go-witness/attestation/sarif"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/vuln"
+)
+
+// trivyReport is trimmed from the SARIF output of trivy, which rates rules with security-severity and tags.
+const trivyReport = `{
+  "version": "2.1.0",
+  "runs": [{
+    "tool": {"driver": {"name": "Trivy", "rules": [
+      {"id": "CVE-2021-44228", "shortDescription": {"text": "log4j"}, "properties": {"security-severity": "10.0", "tags": ["vulnerability", "security", "CRITICAL"]}},
+      {"id": "CVE-2022-0001", "shortDescription": {"text": "other"}, "properties": {"tags": ["vulnerability", "security", "HIGH"]}},
+      {"id": "CVE-2022-0002", "shortDescription": {"text": "minor"}, "properties": {"security-severity": "3.1"}}
+    ]}},
+    "results": [
+      {"ruleId": "CVE-2021-44228", "ruleIndex": 0, "level": "error", "message": {"text": "log4j"}},
+      {"ruleId": "CVE-2022-0001", "ruleIndex": 1, "level": "error", "message": {"text": "other"}},
+      {"ruleId": "CVE-2022-0002", "ruleIndex": 2, "level": "note", "message": {"text": "minor"}},
+      {"ruleId": "unrated", "level": "warning", "message": {"text": "unrated"}}
+    ]
+  }]
+}`
+
+func scanCollection(t *testing.T, ref string) source.VerifiedCollection {
+	a := sarifattestation.New()
+	require.NoError(t, json.Unmarshal([]byte(trivyReport), &a.Report))
+	return source.VerifiedCollection{
+		CollectionEnvelope: source.CollectionEnvelope{
+			Reference:  ref,
+			Collection: attestation.Collection{Attestations: []attestation.CollectionAttestation{{Type: sarifattestation.Type, Attestation: a}}},
+		},
+	}
+}
+
+func vexEnvelope(t *testing.T, signer cryptoutil.Signer, subjectDigest string, statements ...map[string]interface{}) dsse.Envelope {
+	predicate, err := json.Marshal(map[string]interface{}{
+		"@context":   "https://openvex.dev/ns/v0.2.0",
+		"timestamp":  "2023-05-01T00:00:00Z",
+		"statements": statements,
+	})
+	require.NoError(t, err)
+	statement, err := json.Marshal(intoto.Statement{
+		Type:          intoto.StatementType,
+		Subject:       []intoto.Subject{{Name: "app", Digest: map[string]string{"sha256": subjectDigest}}},
+		PredicateType: "https://openvex.dev/ns/v0.2.0",
+		Predicate:     predicate,
+	})
+	require.NoError(t, err)
+	envelope, err := dsse.Sign(intoto.PayloadType, bytes.NewReader(statement), dsse.SignWithSigners(signer))
+	require.NoError(t, err)
+	return envelope
+}
+
+func TestSarifFindings(t *testing.T) {
+	collection := scanCollection(t, "scan")
+	findings := collectionFindings(collection.Collection)
+	require.Equal(t, [][]finding{{
+		{ID: "CVE-2021-44228", Severity: "critical"},
+		{ID: "CVE-2022-0001", Severity: "high"},
+		{ID: "CVE-2022-0002", Severity: "low"},
+		{ID: "unrated", Severity: "medium"},
+	}}, findings)
+}
+
+func TestVulnFindings(t *testing.T) {
+	a := vuln.New()
+	a.Findings = []vuln.Finding{{ID: "CVE-2021-44228", Severity: "critical", Package: "log4j-core"}, {ID: "CVE-2023-0002", Severity: "low"}}
+	collection := attestation.Collection{Attestations: []attestation.CollectionAttestation{{Type: vuln.Type, Attestation: a}}}
+	require.Equal(t, [][]finding{{{ID: "CVE-2021-44228", Severity: "critical"}, {ID: "CVE-2023-0002", Severity: "low"}}}, collectionFindings(collection))
+
+	accepted := map[string][]source.VerifiedCollection{"scan": {{CollectionEnvelope: source.CollectionEnvelope{Reference: "scan", Collection: collection}}}}
+	_, err := verifyVulnerabilities(accepted, map[string]vulnerabilityConstraints{"scan": {}}, nil, nil, nil)
+	require.ErrorContains(t, err, "unremediated vulnerabilities: CVE-2021-44228 (critical)")
+
+	a.Findings = a.Findings[1:]
+	result, err := verifyVulnerabilities(accepted, map[string]vulnerabilityConstraints{"scan": {}}, nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, result["scan"], 1)
+}
+
+func TestVerifyVulnerabilities(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := cryptoutil.NewECDSASigner(key, crypto.SHA256)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	keyID, err := verifier.KeyID()
+	require.NoError(t, err)
+	pubKeys := map[string]cryptoutil.Verifier{keyID: verifier}
+
+	accepted := map[string][]source.VerifiedCollection{"scan": {scanCollection(t, "scan")}}
+	_, err = verifyVulnerabilities(accepted, map[string]vulnerabilityConstraints{"scan": {}}, nil, pubKeys, []string{"abcd"})
+	require.ErrorContains(t, err, "unremediated vulnerabilities: CVE-2021-44228 (critical)")
+
+	notAffected := vexEnvelope(t, signer, "abcd", map[string]interface{}{
+		"vulnerability": map[string]interface{}{"name": "CVE-2021-44228"},
+		"status":        "not_affected",
+		"justification": "vulnerable_code_not_in_execute_path",
+	})
+	constraints := map[string]vulnerabilityConstraints{"scan": {VEXSigners: []string{keyID}}}
+	result, err := verifyVulnerabilities(accepted, constraints, []dsse.Envelope{notAffected}, pubKeys, []string{"abcd"})
+	require.NoError(t, err)
+	require.Len(t, result["scan"], 1)
+
+	// vex about another artifact doesn't apply
+	_, err = verifyVulnerabilities(accepted, constraints, []dsse.Envelope{notAffected}, pubKeys, []string{"ef01"})
+	require.ErrorContains(t, err, "CVE-2021-44228")
+
+	// a later statement that the artifact is affected supersedes the earlier one
+	affected := vexEnvelope(t, signer, "abcd", map[string]interface{}{
+		"vulnerability": "CVE-2021-44228",
+		"status":        "affected",
+		"timestamp":     "2023-06-01T00:00:00Z",
+	})
+	_, err = verifyVulnerabilities(accepted, constraints, []dsse.Envelope{affected, notAffected}, pubKeys, []string{"abcd"})
+	require.ErrorContains(t, err, "CVE-2021-44228")
+
+	// vex from keys that aren't the step's vex signers is ignored
+	_, err = verifyVulnerabilities(accepted, map[string]vulnerabilityConstraints{"scan": {}}, []dsse.Envelope{notAffected}, pubKeys, []string{"abcd"})
+	require.ErrorContains(t, err, "CVE-2021-44228")
+
+	highConstraints := map[string]vulnerabilityConstraints{"scan": {FailOn: "high", VEXSigners: []string{keyID}}}
+	_, err = verifyVulnerabilities(accepted, highConstraints, []dsse.Envelope{notAffected}, pubKeys, []string{"abcd"})
+	require.ErrorContains(t, err, "unremediated vulnerabilities: CVE-2022-0001 (high)")
+
+	_, err = verifyVulnerabilities(accepted, map[string]vulnerabilityConstraints{"scan": {FailOn: "severe"}}, nil, pubKeys, nil)
+	require.ErrorContains(t, err, "unknown severity")
+
+	_, err = verifyVulnerabilities(accepted, map[string]vulnerabilityConstraints{"scan": {VEXSigners: []string{"unknown"}}}, nil, pubKeys, nil)
+	require.ErrorContains(t, err, "not a public key in the policy")
+
+	unscanned := map[string][]source.VerifiedCollection{"scan": {{}}}
+	_, err = verifyVulnerabilities(unscanned, map[string]vulnerabilityConstraints{"scan": {}}, nil, pubKeys, nil)
+	require.ErrorContains(t, err, "does not record a vulnerability scan")
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/witnessbinary"
+	"golang.org/x/mod/semver"
+)
+
+// witnessRequirements restrict which witness binaries may have recorded evidence. MinVersion is the oldest
+// acceptable release. ReleaseSigners are ids of policy public keys, and when set the digest of the binary must be a
+// subject of a release attestation signed by one of them.
+type witnessRequirements struct {
+	MinVersion     string   `json:"minVersion,omitempty"`
+	ReleaseSigners []string `json:"releaseSigners,omitempty"`
+}
+
+// trustedReleaseDigests returns the digests of every subject of the release attestations, after checking that each
+// is signed by one of the policy's release signers.
+func (wr witnessRequirements) trustedReleaseDigests(releases []dsse.Envelope, pubKeysByID map[string]cryptoutil.Verifier) (map[string]struct{}, error) {
+	if len(wr.ReleaseSigners) == 0 {
+		return nil, nil
+	}
+
+	if len(releases) == 0 {
+		return nil, errors.New("policy requires a witness binary released by the project, but no release attestations were provided")
+	}
+
+	verifiers := make([]cryptoutil.Verifier, 0, len(wr.ReleaseSigners))
+	for _, keyID := range wr.ReleaseSigners {
+		verifier, ok := pubKeysByID[keyID]
+		if !ok {
+			return nil, fmt.Errorf("release signer %v is not a public key in the policy", keyID)
+		}
+
+		verifiers = append(verifiers, verifier)
+	}
+
+	return ReleaseDigests(releases, verifiers)
+}
+
+// ReleaseDigests returns the digests of every subject of the release attestations, after checking that each is
+// signed by one of verifiers.
+func ReleaseDigests(releases []dsse.Envelope, verifiers []cryptoutil.Verifier) (map[string]struct{}, error) {
+	digests := make(map[string]struct{})
+	for i, release := range releases {
+		if _, err := release.Verify(dsse.VerifyWithVerifiers(verifiers...)); err != nil {
+			return nil, fmt.Errorf("release attestation %v is not signed by a release signer: %w", i+1, err)
+		}
+
+		statement := intoto.Statement{}
+		if err := json.Unmarshal(release.Payload, &statement); err != nil {
+			return nil, fmt.Errorf("failed to parse release attestation %v: %w", i+1, err)
+		}
+
+		for _, subject := range statement.Subject {
+			for _, digest := range subject.Digest {
+				digests[digest] = struct{}{}
+			}
+		}
+	}
+
+	return digests, nil
+}
+
+// verifyWitnessBinaries removes collections that weren't recorded by a witness binary meeting the requirements.
+func verifyWitnessBinaries(accepted map[string][]source.VerifiedCollection, wr witnessRequirements, trusted map[string]struct{}) (map[string][]source.VerifiedCollection, error) {
+	result := make(map[string][]source.VerifiedCollection, len(accepted))
+	for step, collections := range accepted {
+		kept := make([]source.VerifiedCollection, 0, len(collections))
+		var lastErr error
+		for _, collection := range collections {
+			if err := wr.check(collection, trusted); err != nil {
+				lastErr = fmt.Errorf("%v: %w", collection.Reference, err)
+				continue
+			}
+
+			kept = append(kept, collection)
+		}
+
+		if len(kept) == 0 {
+			return nil, fmt.Errorf("no evidence for step %v was recorded by an acceptable witness binary: %w", step, lastErr)
+		}
+
+		result[step] = kept
+	}
+
+	return result, nil
+}
+
+func (wr witnessRequirements) check(collection source.VerifiedCollection, trusted map[string]struct{}) error {
+	var binary *witnessbinary.Attestor
+	for _, collectionAttestation := range collection.Collection.Attestations {
+		if a, ok := collectionAttestation.Attestation.(*witnessbinary.Attestor); ok {
+			binary = a
+		}
+	}
+
+	if binary == nil {
+		return errors.New("evidence does not record the witness binary that produced it")
+	}
+
+	if wr.MinVersion != "" {
+		if err := checkMinVersion(binary.Version, wr.MinVersion); err != nil {
+			return err
+		}
+	}
+
+	if trusted == nil {
+		return nil
+	}
+
+	for _, digest := range binary.Digest {
+		if _, ok := trusted[digest]; ok {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("witness binary %v is not a release signed by the project", binary.Path)
+}
+
+func checkMinVersion(version, minVersion string) error {
+	version, minVersion = canonicalVersion(version), canonicalVersion(minVersion)
+	if !semver.IsValid(minVersion) {
+		return fmt.Errorf("policy minimum witness version %v is not a semantic version", minVersion)
+	}
+
+	if !semver.IsValid(version) {
+		return fmt.Errorf("witness version %v is not a release", version)
+	}
+
+	if semver.Compare(version, minVersion) < 0 {
+		return fmt.Errorf("witness version %v is older than the minimum %v", version, minVersion)
+	}
+
+	return nil
+}
+
+// canonicalVersion accepts versions with or without the v prefix, such as the v0.1.14-abc1234 versions set by
+// release builds.
+func canonicalVersion(version string) string {
+	if version != "" && !strings.HasPrefix(version, "v") {
+		return "v" + version
+	}
+
+	return version
+}
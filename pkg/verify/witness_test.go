@@ -0,0 +1,115 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+	"github.com/testifysec/go-witness/dsse"
+	"github.com/testifysec/go-witness/intoto"
+	"github.com/testifysec/go-witness/source"
+	"github.com/testifysec/witness/pkg/attestation/witnessbinary"
+)
+
+func witnessCollection(ref, version, digest string) source.VerifiedCollection {
+	binary := witnessbinary.New()
+	binary.Version = version
+	binary.Path = "/usr/local/bin/witness"
+	binary.Digest = cryptoutil.DigestSet{cryptoutil.DigestValue{Hash: crypto.SHA256}: digest}
+	return source.VerifiedCollection{
+		CollectionEnvelope: source.CollectionEnvelope{
+			Reference: ref,
+			Collection: attestation.Collection{
+				Attestations: []attestation.CollectionAttestation{{Type: witnessbinary.Type, Attestation: binary}},
+			},
+		},
+	}
+}
+
+func TestCheckMinVersion(t *testing.T) {
+	require.NoError(t, checkMinVersion("v0.1.14", "0.1.12"))
+	require.NoError(t, checkMinVersion("0.1.14-abc1234", "v0.1.14-abc1234"))
+	require.NoError(t, checkMinVersion("v0.2.0", "v0.1.14"))
+	require.ErrorContains(t, checkMinVersion("v0.1.11", "v0.1.12"), "older than")
+	require.ErrorContains(t, checkMinVersion("(devel)", "v0.1.12"), "not a release")
+	require.ErrorContains(t, checkMinVersion("v0.1.14", "latest"), "not a semantic version")
+}
+
+func TestVerifyWitnessBinaries(t *testing.T) {
+	accepted := map[string][]source.VerifiedCollection{
+		"build": {witnessCollection("old", "v0.1.10", "aaaa"), witnessCollection("new", "v0.1.14", "bbbb")},
+	}
+
+	result, err := verifyWitnessBinaries(accepted, witnessRequirements{MinVersion: "v0.1.12"}, nil)
+	require.NoError(t, err)
+	require.Len(t, result["build"], 1)
+	require.Equal(t, "new", result["build"][0].Reference)
+
+	_, err = verifyWitnessBinaries(accepted, witnessRequirements{ReleaseSigners: []string{"project"}}, map[string]struct{}{"cccc": {}})
+	require.ErrorContains(t, err, "not a release signed by the project")
+
+	result, err = verifyWitnessBinaries(accepted, witnessRequirements{ReleaseSigners: []string{"project"}}, map[string]struct{}{"aaaa": {}})
+	require.NoError(t, err)
+	require.Equal(t, "old", result["build"][0].Reference)
+
+	unrecorded := map[string][]source.VerifiedCollection{"build": {{CollectionEnvelope: source.CollectionEnvelope{Reference: "legacy"}}}}
+	_, err = verifyWitnessBinaries(unrecorded, witnessRequirements{MinVersion: "v0.1.12"}, nil)
+	require.ErrorContains(t, err, "does not record the witness binary")
+}
+
+func TestTrustedReleaseDigests(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer := cryptoutil.NewECDSASigner(key, crypto.SHA256)
+	verifier, err := signer.Verifier()
+	require.NoError(t, err)
+	keyID, err := verifier.KeyID()
+	require.NoError(t, err)
+
+	statement, err := json.Marshal(intoto.Statement{
+		Type:    intoto.StatementType,
+		Subject: []intoto.Subject{{Name: "witness-linux-amd64", Digest: map[string]string{"sha256": "aaaa"}}},
+	})
+	require.NoError(t, err)
+	release, err := dsse.Sign(intoto.PayloadType, bytes.NewReader(statement), dsse.SignWithSigners(signer))
+	require.NoError(t, err)
+
+	wr := witnessRequirements{ReleaseSigners: []string{keyID}}
+	digests, err := wr.trustedReleaseDigests([]dsse.Envelope{release}, map[string]cryptoutil.Verifier{keyID: verifier})
+	require.NoError(t, err)
+	require.Equal(t, map[string]struct{}{"aaaa": {}}, digests)
+
+	_, err = wr.trustedReleaseDigests(nil, map[string]cryptoutil.Verifier{keyID: verifier})
+	require.ErrorContains(t, err, "no release attestations")
+
+	_, err = wr.trustedReleaseDigests([]dsse.Envelope{release}, map[string]cryptoutil.Verifier{})
+	require.ErrorContains(t, err, "not a public key in the policy")
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherVerifier, err := cryptoutil.NewECDSASigner(otherKey, crypto.SHA256).Verifier()
+	require.NoError(t, err)
+	_, err = wr.trustedReleaseDigests([]dsse.Envelope{release}, map[string]cryptoutil.Verifier{keyID: otherVerifier})
+	require.ErrorContains(t, err, "not signed by a release signer")
+}
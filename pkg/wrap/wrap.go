@@ -0,0 +1,95 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wrap is the base of the attestors that wrap another attestor to change how it runs or what it records,
+// such as the event log, the guard, and the scheduler.
+package wrap
+
+import (
+	"encoding/json"
+
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+var (
+	_ attestation.Attestor   = Forwarder{}
+	_ attestation.Subjecter  = Forwarder{}
+	_ attestation.Materialer = Forwarder{}
+	_ attestation.Producer   = Forwarder{}
+	_ attestation.BackReffer = Forwarder{}
+)
+
+// Forwarder forwards everything an attestor reports to the attestor it wraps, including its JSON, so the wrapped
+// attestor's attestation is recorded as if it ran alone. Wrappers embed it and override only what they change.
+type Forwarder struct {
+	attestation.Attestor
+}
+
+// Unwrap returns the wrapped attestor, so the interfaces of the attestor under any number of wrappers can be checked.
+func (f Forwarder) Unwrap() attestation.Attestor {
+	return f.Attestor
+}
+
+func (f Forwarder) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Attestor)
+}
+
+func (f Forwarder) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, f.Attestor)
+}
+
+func (f Forwarder) Subjects() map[string]cryptoutil.DigestSet {
+	if subjecter, ok := f.Attestor.(attestation.Subjecter); ok {
+		return subjecter.Subjects()
+	}
+
+	return map[string]cryptoutil.DigestSet{}
+}
+
+func (f Forwarder) Materials() map[string]cryptoutil.DigestSet {
+	if materialer, ok := f.Attestor.(attestation.Materialer); ok {
+		return materialer.Materials()
+	}
+
+	return map[string]cryptoutil.DigestSet{}
+}
+
+func (f Forwarder) Products() map[string]attestation.Product {
+	if producer, ok := f.Attestor.(attestation.Producer); ok {
+		return producer.Products()
+	}
+
+	return map[string]attestation.Product{}
+}
+
+func (f Forwarder) BackRefs() map[string]cryptoutil.DigestSet {
+	if backReffer, ok := f.Attestor.(attestation.BackReffer); ok {
+		return backReffer.BackRefs()
+	}
+
+	return map[string]cryptoutil.DigestSet{}
+}
+
+// Unwrap returns the attestor under every wrapper around attestor.
+func Unwrap(attestor attestation.Attestor) attestation.Attestor {
+	for {
+		wrapper, ok := attestor.(interface{ Unwrap() attestation.Attestor })
+		if !ok {
+			return attestor
+		}
+
+		attestor = wrapper.Unwrap()
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 The Witness Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrap
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testifysec/go-witness/attestation"
+	"github.com/testifysec/go-witness/attestation/environment"
+	"github.com/testifysec/go-witness/attestation/material"
+	"github.com/testifysec/go-witness/cryptoutil"
+)
+
+// renamed stands in for a wrapper, overriding the name and forwarding everything else.
+type renamed struct {
+	Forwarder
+}
+
+func (r *renamed) Name() string {
+	return "renamed"
+}
+
+func TestForwarder(t *testing.T) {
+	inner := material.New()
+	wrapped := &renamed{Forwarder{Attestor: &renamed{Forwarder{Attestor: inner}}}}
+	require.Equal(t, "renamed", wrapped.Name())
+	require.Equal(t, material.Type, wrapped.Type())
+	require.Same(t, inner, Unwrap(wrapped))
+	require.Same(t, inner, Unwrap(inner))
+
+	ctx, err := attestation.NewContext([]attestation.Attestor{wrapped}, attestation.WithWorkingDir(t.TempDir()))
+	require.NoError(t, err)
+	require.NoError(t, ctx.RunAttestors())
+	require.Equal(t, inner.Materials(), wrapped.Materials())
+
+	wrappedJSON, err := json.Marshal(wrapped)
+	require.NoError(t, err)
+	innerJSON, err := json.Marshal(inner)
+	require.NoError(t, err)
+	require.JSONEq(t, string(innerJSON), string(wrappedJSON))
+
+	// attestors that don't report subjects, materials, products, or back references report none
+	env := Forwarder{Attestor: environment.New()}
+	require.Equal(t, map[string]cryptoutil.DigestSet{}, env.Materials())
+	require.Equal(t, map[string]attestation.Product{}, env.Products())
+	require.Equal(t, map[string]cryptoutil.DigestSet{}, env.BackRefs())
+}